@@ -0,0 +1,288 @@
+// Package bodyfilter implements streaming substitutions in response bodies,
+// for backends that hardcode absolute URLs in HTML, CSS and JavaScript.
+package bodyfilter
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultMaxMatchSize is the default longest match, in bytes, found across
+// read boundaries.
+const DefaultMaxMatchSize = 4096
+
+// Supported content codings. Other codings are passed through unfiltered.
+const (
+	EncodingIdentity = "identity"
+	EncodingGzip     = "gzip"
+	EncodingZstd     = "zstd"
+	EncodingBrotli   = "br"
+)
+
+// DefaultContentTypes are the media types filtered by default.
+var DefaultContentTypes = []string{
+	"text/html",
+	"text/css",
+	"text/javascript",
+	"application/javascript",
+}
+
+// Substitution replaces Pattern with Replacement. Regex patterns use RE2
+// syntax and may reference submatches as $1 or ${name}.
+type Substitution struct {
+	Pattern     string
+	Replacement string
+	Regex       bool
+}
+
+// Config holds configuration for a response body filter.
+type Config struct {
+	// ContentTypes are the media types filtered. Defaults to
+	// DefaultContentTypes.
+	ContentTypes []string
+
+	// Substitutions are applied in order.
+	Substitutions []Substitution
+
+	// HTMLAttributes restricts substitutions in text/html to the values of
+	// href, src and action attributes.
+	HTMLAttributes bool
+
+	// MaxMatchSize bounds the buffered input per substitution and is the
+	// longest match found across read boundaries. Defaults to
+	// DefaultMaxMatchSize.
+	MaxMatchSize int
+}
+
+// Filter rewrites matching response bodies. It is safe for concurrent use.
+type Filter struct {
+	contentTypes   map[string]bool
+	replacers      []replacer
+	htmlAttributes bool
+	window         int
+}
+
+// New creates a response body filter.
+func New(config Config) (*Filter, error) {
+	if len(config.Substitutions) == 0 {
+		return nil, ErrNoSubstitutions
+	}
+	if config.MaxMatchSize < 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidMaxMatchSize, config.MaxMatchSize)
+	}
+
+	f := &Filter{
+		contentTypes:   make(map[string]bool),
+		htmlAttributes: config.HTMLAttributes,
+		window:         config.MaxMatchSize,
+	}
+	if f.window == 0 {
+		f.window = DefaultMaxMatchSize
+	}
+
+	contentTypes := config.ContentTypes
+	if len(contentTypes) == 0 {
+		contentTypes = DefaultContentTypes
+	}
+	for _, contentType := range contentTypes {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidContentType, contentType)
+		}
+		f.contentTypes[mediaType] = true
+	}
+
+	for _, sub := range config.Substitutions {
+		r, err := newReplacer(sub, f.window)
+		if err != nil {
+			return nil, err
+		}
+		f.replacers = append(f.replacers, r)
+	}
+
+	return f, nil
+}
+
+// newReplacer compiles a substitution.
+func newReplacer(sub Substitution, window int) (replacer, error) {
+	if sub.Pattern == "" {
+		return nil, fmt.Errorf("%w: empty pattern", ErrInvalidPattern)
+	}
+
+	if !sub.Regex {
+		if len(sub.Pattern) > window {
+			return nil, fmt.Errorf("%w: %q is longer than the max match size", ErrInvalidPattern, sub.Pattern)
+		}
+		return &literalReplacer{old: []byte(sub.Pattern), new: []byte(sub.Replacement)}, nil
+	}
+
+	re, err := regexp.Compile(sub.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPattern, err)
+	}
+	// Empty matches would insert replacements at every read boundary.
+	if re.MatchString("") {
+		return nil, fmt.Errorf("%w: %q matches the empty string", ErrInvalidPattern, sub.Pattern)
+	}
+	return &regexReplacer{re: re, template: []byte(sub.Replacement)}, nil
+}
+
+// Apply replaces the body of resp with a filtered stream when its content
+// type matches. Content-Length is removed and strong ETags are weakened as
+// the filtered length and bytes are not known in advance.
+func (f *Filter) Apply(resp *http.Response) {
+	if f == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return
+	}
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return
+	}
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusPartialContent, http.StatusNotModified:
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !f.contentTypes[mediaType] {
+		return
+	}
+
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", EncodingIdentity:
+		resp.Body = &filteredBody{Reader: f.reader(resp.Body, mediaType), body: resp.Body}
+	case EncodingGzip, EncodingZstd, EncodingBrotli:
+		resp.Body = f.recode(resp.Body, encoding, mediaType)
+	default:
+		return
+	}
+
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Header.Del("Accept-Ranges")
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		resp.Header.Set("ETag", "W/"+etag)
+	}
+}
+
+// reader returns a reader of src with the substitutions applied.
+func (f *Filter) reader(src io.Reader, mediaType string) io.Reader {
+	if f.htmlAttributes && mediaType == "text/html" {
+		return newStreamReader(src, &attributeReplacer{re: htmlURLAttribute, replacers: f.replacers}, f.window)
+	}
+
+	for _, r := range f.replacers {
+		src = newStreamReader(src, r, f.window)
+	}
+	return src
+}
+
+// recode decodes body, applies the substitutions and encodes the result
+// again with the same content coding. Decoding errors are reported to the
+// reader of the returned body.
+func (f *Filter) recode(body io.ReadCloser, encoding, mediaType string) io.ReadCloser {
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(f.recodeTo(pw, body, encoding, mediaType))
+	}()
+
+	return &filteredBody{Reader: pr, body: body, pipe: pr}
+}
+
+// recodeTo writes the filtered and encoded body to w.
+func (f *Filter) recodeTo(w io.Writer, body io.Reader, encoding, mediaType string) error {
+	var decoded io.Reader
+	var encoder io.WriteCloser
+
+	switch encoding {
+	case EncodingGzip:
+		gr, err := gzip.NewReader(body)
+		if err != nil {
+			return err
+		}
+		defer gr.Close()
+		decoded = gr
+		encoder = gzip.NewWriter(w)
+	case EncodingZstd:
+		zr, err := zstd.NewReader(body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		decoded = zr
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return err
+		}
+		encoder = zw
+	case EncodingBrotli:
+		decoded = brotli.NewReader(body)
+		encoder = brotli.NewWriter(w)
+	}
+
+	if _, err := io.Copy(encoder, f.reader(decoded, mediaType)); err != nil {
+		encoder.Close()
+		return err
+	}
+	return encoder.Close()
+}
+
+// filteredBody is a filtered response body. Closing it closes the backend
+// body and stops any encoding goroutine.
+type filteredBody struct {
+	io.Reader
+	body io.Closer
+	pipe *io.PipeReader
+}
+
+// Close implements io.Closer.
+func (b *filteredBody) Close() error {
+	if b.pipe != nil {
+		b.pipe.Close()
+	}
+	return b.body.Close()
+}
+
+// RestrictAcceptEncoding limits the Accept-Encoding header of an outbound
+// request to the codings a Filter can decode, so backend responses are
+// never sent in an encoding that would bypass the filter.
+func RestrictAcceptEncoding(header http.Header) {
+	values := header.Values("Accept-Encoding")
+	if len(values) == 0 {
+		return
+	}
+
+	var kept []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			coding, _, _ := strings.Cut(part, ";")
+			switch strings.ToLower(strings.TrimSpace(coding)) {
+			case EncodingGzip, EncodingZstd, EncodingBrotli, EncodingIdentity:
+				kept = append(kept, strings.TrimSpace(part))
+			}
+		}
+	}
+
+	if len(kept) == 0 {
+		header.Set("Accept-Encoding", EncodingIdentity)
+		return
+	}
+	header.Set("Accept-Encoding", strings.Join(kept, ", "))
+}
+
+// Filter errors.
+var (
+	ErrNoSubstitutions     = fmt.Errorf("body filter requires at least one substitution")
+	ErrInvalidPattern      = fmt.Errorf("invalid substitution pattern")
+	ErrInvalidContentType  = fmt.Errorf("invalid content type")
+	ErrInvalidMaxMatchSize = fmt.Errorf("invalid max match size")
+)
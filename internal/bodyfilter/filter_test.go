@@ -0,0 +1,422 @@
+package bodyfilter
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestResponse creates a response with body and the given headers.
+func newTestResponse(body []byte, header http.Header) *http.Response {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       &http.Request{Method: http.MethodGet},
+	}
+}
+
+// readBody reads and closes the body of resp.
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return string(body)
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		expectedErr error
+	}{
+		{
+			name: "New_LiteralAndRegex_Created",
+			config: Config{Substitutions: []Substitution{
+				{Pattern: "http://10.0.0.5:3000/", Replacement: "/"},
+				{Pattern: `/static/(\w+)`, Replacement: "/app/static/$1", Regex: true},
+			}},
+		},
+		{
+			name:        "New_NoSubstitutions_Error",
+			config:      Config{},
+			expectedErr: ErrNoSubstitutions,
+		},
+		{
+			name:        "New_EmptyPattern_Error",
+			config:      Config{Substitutions: []Substitution{{Replacement: "x"}}},
+			expectedErr: ErrInvalidPattern,
+		},
+		{
+			name:        "New_InvalidRegex_Error",
+			config:      Config{Substitutions: []Substitution{{Pattern: "(", Regex: true}}},
+			expectedErr: ErrInvalidPattern,
+		},
+		{
+			name:        "New_RegexMatchesEmpty_Error",
+			config:      Config{Substitutions: []Substitution{{Pattern: "a*", Regex: true}}},
+			expectedErr: ErrInvalidPattern,
+		},
+		{
+			name: "New_LiteralLongerThanMaxMatch_Error",
+			config: Config{
+				Substitutions: []Substitution{{Pattern: "abcdef"}},
+				MaxMatchSize:  4,
+			},
+			expectedErr: ErrInvalidPattern,
+		},
+		{
+			name: "New_InvalidContentType_Error",
+			config: Config{
+				ContentTypes:  []string{"text/"},
+				Substitutions: []Substitution{{Pattern: "a"}},
+			},
+			expectedErr: ErrInvalidContentType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			f, err := New(tt.config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Nil(t, f)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, f)
+		})
+	}
+}
+
+func TestFilter_Apply(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        Config
+		contentType   string
+		body          string
+		expected      string
+		expectApplied bool
+	}{
+		{
+			name:          "Apply_Literal_Replaced",
+			config:        Config{Substitutions: []Substitution{{Pattern: "http://10.0.0.5:3000/", Replacement: "/wiki/"}}},
+			contentType:   "text/html; charset=utf-8",
+			body:          `<a href="http://10.0.0.5:3000/page">http://10.0.0.5:3000/</a>`,
+			expected:      `<a href="/wiki/page">/wiki/</a>`,
+			expectApplied: true,
+		},
+		{
+			name:          "Apply_RegexSubmatch_Expanded",
+			config:        Config{Substitutions: []Substitution{{Pattern: `url\((/img/[^)]+)\)`, Replacement: "url(/wiki$1)", Regex: true}}},
+			contentType:   "text/css",
+			body:          "a{background:url(/img/a.png)}",
+			expected:      "a{background:url(/wiki/img/a.png)}",
+			expectApplied: true,
+		},
+		{
+			name: "Apply_Chained_InOrder",
+			config: Config{Substitutions: []Substitution{
+				{Pattern: "one", Replacement: "two"},
+				{Pattern: "two", Replacement: "three"},
+			}},
+			contentType:   "application/javascript",
+			body:          "one two",
+			expected:      "three three",
+			expectApplied: true,
+		},
+		{
+			name: "Apply_HTMLAttributes_OnlyAttributes",
+			config: Config{
+				Substitutions:  []Substitution{{Pattern: "/", Replacement: "/wiki/"}},
+				HTMLAttributes: true,
+			},
+			contentType: "text/html",
+			body: `<a HREF="/a" data-href="/b">/c</a><img src='/d'>` +
+				`<form action=/e method=post>`,
+			expected: `<a HREF="/wiki/a" data-href="/b">/c</a><img src='/wiki/d'>` +
+				`<form action=/wiki/e method=post>`,
+			expectApplied: true,
+		},
+		{
+			name: "Apply_HTMLAttributesOtherType_Everywhere",
+			config: Config{
+				Substitutions:  []Substitution{{Pattern: "/api", Replacement: "/wiki/api"}},
+				HTMLAttributes: true,
+			},
+			contentType:   "text/javascript",
+			body:          `fetch("/api/items")`,
+			expected:      `fetch("/wiki/api/items")`,
+			expectApplied: true,
+		},
+		{
+			name:        "Apply_OtherContentType_Unchanged",
+			config:      Config{Substitutions: []Substitution{{Pattern: "a", Replacement: "b"}}},
+			contentType: "application/json",
+			body:        `{"a":1}`,
+			expected:    `{"a":1}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			f, err := New(tt.config)
+			require.NoError(t, err)
+			header := http.Header{
+				"Content-Type":   {tt.contentType},
+				"Content-Length": {"42"},
+				"Etag":           {`"v1"`},
+			}
+			resp := newTestResponse([]byte(tt.body), header)
+
+			// Act
+			f.Apply(resp)
+
+			// Assert
+			assert.Equal(t, tt.expected, readBody(t, resp))
+			if tt.expectApplied {
+				assert.Empty(t, resp.Header.Get("Content-Length"))
+				assert.Equal(t, int64(-1), resp.ContentLength)
+				assert.Equal(t, `W/"v1"`, resp.Header.Get("ETag"))
+			} else {
+				assert.Equal(t, "42", resp.Header.Get("Content-Length"))
+				assert.Equal(t, `"v1"`, resp.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestFilter_Apply_AcrossReads(t *testing.T) {
+	// Arrange
+	f, err := New(Config{Substitutions: []Substitution{
+		{Pattern: "http://backend.internal", Replacement: "https://app.example.com"},
+		{Pattern: `href="/([a-z]+)"`, Replacement: `href="/wiki/$1"`, Regex: true},
+	}})
+	require.NoError(t, err)
+
+	var body, expected strings.Builder
+	for i := 0; i < 2000; i++ {
+		body.WriteString(`<a href="/page">http://backend.internal</a>`)
+		expected.WriteString(`<a href="/wiki/page">https://app.example.com</a>`)
+	}
+	resp := newTestResponse(nil, http.Header{"Content-Type": {"text/html"}})
+	resp.Body = io.NopCloser(iotest.OneByteReader(strings.NewReader(body.String())))
+
+	// Act
+	f.Apply(resp)
+
+	// Assert
+	assert.Equal(t, expected.String(), readBody(t, resp))
+}
+
+func TestFilter_Apply_Streams(t *testing.T) {
+	// Arrange
+	f, err := New(Config{Substitutions: []Substitution{
+		{Pattern: "http://backend.internal", Replacement: "https://app.example.com"},
+	}})
+	require.NoError(t, err)
+
+	src, backend := io.Pipe()
+	resp := newTestResponse(nil, http.Header{"Content-Type": {"text/html"}})
+	resp.Body = src
+	first := strings.Repeat("<p>http://backend.internal</p>", 400)
+	go func() {
+		_, _ = backend.Write([]byte(first))
+	}()
+	t.Cleanup(func() { _ = backend.Close() })
+
+	// Act
+	f.Apply(resp)
+	read := make(chan string, 1)
+	go func() {
+		buf := make([]byte, len(first))
+		n, _ := resp.Body.Read(buf)
+		read <- string(buf[:n])
+	}()
+
+	// Assert
+	select {
+	case got := <-read:
+		assert.NotEmpty(t, got)
+		assert.True(t, strings.HasPrefix(strings.ReplaceAll(first, "http://backend.internal", "https://app.example.com"), got))
+	case <-time.After(time.Second):
+		t.Fatal("filtered body was held back until the backend sent more")
+	}
+}
+
+func TestFilter_Apply_Encodings(t *testing.T) {
+	encoders := map[string]func(io.Writer) io.WriteCloser{
+		EncodingGzip: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		EncodingZstd: func(w io.Writer) io.WriteCloser {
+			zw, _ := zstd.NewWriter(w)
+			return zw
+		},
+		EncodingBrotli: func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	}
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		EncodingGzip:   func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		EncodingZstd:   func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+		EncodingBrotli: func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+
+	for encoding, newEncoder := range encoders {
+		t.Run("Apply_"+encoding+"_Recoded", func(t *testing.T) {
+			// Arrange
+			f, err := New(Config{Substitutions: []Substitution{{Pattern: "http://10.0.0.5:3000", Replacement: ""}}})
+			require.NoError(t, err)
+
+			var encoded bytes.Buffer
+			w := newEncoder(&encoded)
+			_, err = io.WriteString(w, `<script src="http://10.0.0.5:3000/app.js"></script>`)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			resp := newTestResponse(encoded.Bytes(), http.Header{
+				"Content-Type":     {"text/html"},
+				"Content-Encoding": {encoding},
+			})
+
+			// Act
+			f.Apply(resp)
+
+			// Assert
+			assert.Equal(t, encoding, resp.Header.Get("Content-Encoding"))
+			decoded, err := decoders[encoding](strings.NewReader(readBody(t, resp)))
+			require.NoError(t, err)
+			body, err := io.ReadAll(decoded)
+			require.NoError(t, err)
+			assert.Equal(t, `<script src="/app.js"></script>`, string(body))
+		})
+	}
+
+	t.Run("Apply_UnsupportedEncoding_Unchanged", func(t *testing.T) {
+		// Arrange
+		f, err := New(Config{Substitutions: []Substitution{{Pattern: "a", Replacement: "b"}}})
+		require.NoError(t, err)
+		resp := newTestResponse([]byte("opaque"), http.Header{
+			"Content-Type":     {"text/html"},
+			"Content-Encoding": {"deflate"},
+			"Content-Length":   {"6"},
+		})
+
+		// Act
+		f.Apply(resp)
+
+		// Assert
+		assert.Equal(t, "opaque", readBody(t, resp))
+		assert.Equal(t, "6", resp.Header.Get("Content-Length"))
+	})
+
+	t.Run("Apply_CorruptGzip_Error", func(t *testing.T) {
+		// Arrange
+		f, err := New(Config{Substitutions: []Substitution{{Pattern: "a", Replacement: "b"}}})
+		require.NoError(t, err)
+		resp := newTestResponse([]byte("not gzip"), http.Header{
+			"Content-Type":     {"text/html"},
+			"Content-Encoding": {EncodingGzip},
+		})
+
+		// Act
+		f.Apply(resp)
+
+		// Assert
+		_, err = io.ReadAll(resp.Body)
+		assert.Error(t, err)
+		assert.NoError(t, resp.Body.Close())
+	})
+}
+
+func TestFilter_Apply_Skipped(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		method string
+	}{
+		{name: "Apply_PartialContent_Skipped", status: http.StatusPartialContent, method: http.MethodGet},
+		{name: "Apply_NotModified_Skipped", status: http.StatusNotModified, method: http.MethodGet},
+		{name: "Apply_Head_Skipped", status: http.StatusOK, method: http.MethodHead},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			f, err := New(Config{Substitutions: []Substitution{{Pattern: "a", Replacement: "b"}}})
+			require.NoError(t, err)
+			resp := newTestResponse([]byte("aaa"), http.Header{"Content-Type": {"text/html"}, "Content-Length": {"3"}})
+			resp.StatusCode = tt.status
+			resp.Request.Method = tt.method
+
+			// Act
+			f.Apply(resp)
+
+			// Assert
+			assert.Equal(t, "aaa", readBody(t, resp))
+			assert.Equal(t, "3", resp.Header.Get("Content-Length"))
+		})
+	}
+}
+
+func TestRestrictAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected string
+	}{
+		{
+			name:     "Restrict_Brotli_Kept",
+			header:   http.Header{"Accept-Encoding": {"br, gzip;q=0.8", "zstd"}},
+			expected: "br, gzip;q=0.8, zstd",
+		},
+		{
+			name:     "Restrict_Deflate_Removed",
+			header:   http.Header{"Accept-Encoding": {"deflate, gzip;q=0.8"}},
+			expected: "gzip;q=0.8",
+		},
+		{
+			name:     "Restrict_NoneSupported_Identity",
+			header:   http.Header{"Accept-Encoding": {"deflate, compress"}},
+			expected: "identity",
+		},
+		{
+			name:     "Restrict_Absent_Unchanged",
+			header:   http.Header{},
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			RestrictAcceptEncoding(tt.header)
+
+			// Assert
+			assert.Equal(t, tt.expected, tt.header.Get("Accept-Encoding"))
+		})
+	}
+}
+
+func TestFilter_Nil(t *testing.T) {
+	var f *Filter
+	resp := newTestResponse([]byte("a"), http.Header{"Content-Type": {"text/html"}})
+
+	f.Apply(resp)
+
+	assert.Equal(t, "a", readBody(t, resp))
+}
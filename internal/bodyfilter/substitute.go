@@ -0,0 +1,180 @@
+package bodyfilter
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+)
+
+// readChunkSize is the most bytes read from the source at a time.
+const readChunkSize = 32 << 10
+
+// replacer rewrites the matches of a pattern in a buffer.
+type replacer interface {
+	// find returns the index pairs of the non-overlapping matches in buf.
+	find(buf []byte) [][]int
+
+	// replace returns the replacement of the match at loc in buf.
+	replace(buf []byte, loc []int) []byte
+}
+
+// literalReplacer replaces a literal byte string.
+type literalReplacer struct {
+	old, new []byte
+}
+
+func (r *literalReplacer) find(buf []byte) [][]int {
+	var locs [][]int
+	for offset := 0; ; {
+		i := bytes.Index(buf[offset:], r.old)
+		if i < 0 {
+			return locs
+		}
+		start := offset + i
+		locs = append(locs, []int{start, start + len(r.old)})
+		offset = start + len(r.old)
+	}
+}
+
+func (r *literalReplacer) replace(buf []byte, loc []int) []byte {
+	return r.new
+}
+
+// regexReplacer replaces the matches of a regular expression, expanding
+// $1-style references in the template.
+type regexReplacer struct {
+	re       *regexp.Regexp
+	template []byte
+}
+
+func (r *regexReplacer) find(buf []byte) [][]int {
+	return r.re.FindAllSubmatchIndex(buf, -1)
+}
+
+func (r *regexReplacer) replace(buf []byte, loc []int) []byte {
+	return r.re.Expand(nil, r.template, buf, loc)
+}
+
+// streamReader applies a replacer to a stream. It keeps at most window
+// unprocessed bytes between reads, so matches longer than window may be
+// missed, and holds at most one read chunk plus window bytes in memory.
+type streamReader struct {
+	src      io.Reader
+	replacer replacer
+	window   int
+
+	chunk   []byte // read buffer
+	pending []byte // input not yet searched for matches
+	out     []byte // output ready to be returned
+	eof     bool
+	err     error
+}
+
+// newStreamReader returns a reader of src with the matches of replacer
+// substituted.
+func newStreamReader(src io.Reader, r replacer, window int) io.Reader {
+	return &streamReader{src: src, replacer: r, window: window, chunk: make([]byte, readChunkSize)}
+}
+
+// Read implements io.Reader.
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 {
+		if s.eof {
+			return 0, s.err
+		}
+		s.fill()
+	}
+
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// fill reads whatever the source has available and moves the input that can
+// no longer be part of a match straddling the next read to the output. It
+// makes a single read, so a backend that flushes small pieces is not held
+// back until a whole chunk arrives.
+func (s *streamReader) fill() {
+	n, err := s.src.Read(s.chunk)
+	s.pending = append(s.pending, s.chunk[:n]...)
+	if err != nil {
+		s.eof = true
+		s.err = err
+	}
+
+	// Matches starting before cut are complete; the remainder is kept
+	// until more input arrives.
+	cut := len(s.pending)
+	if !s.eof {
+		cut = max(len(s.pending)-s.window, 0)
+		if cut == 0 {
+			return
+		}
+	}
+
+	var out []byte
+	done := 0
+	for _, loc := range s.replacer.find(s.pending) {
+		if loc[0] >= cut && !s.eof {
+			break
+		}
+		out = append(out, s.pending[done:loc[0]]...)
+		out = append(out, s.replacer.replace(s.pending, loc)...)
+		done = loc[1]
+	}
+	if done < cut {
+		out = append(out, s.pending[done:cut]...)
+		done = cut
+	}
+
+	s.out = append(s.out[:0], out...)
+	s.pending = append(s.pending[:0], s.pending[done:]...)
+	if s.eof && len(s.pending) > 0 {
+		s.out = append(s.out, s.pending...)
+		s.pending = s.pending[:0]
+	}
+}
+
+// attributeReplacer applies replacers only inside the values of matched
+// HTML attributes.
+type attributeReplacer struct {
+	re        *regexp.Regexp
+	replacers []replacer
+}
+
+// htmlURLAttribute matches href, src and action attributes, which always
+// follow whitespace inside a tag, so data-href and similar are not matched.
+// The value is the first submatch.
+var htmlURLAttribute = regexp.MustCompile(`(?i)\s(?:href|src|action)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+
+func (r *attributeReplacer) find(buf []byte) [][]int {
+	return r.re.FindAllSubmatchIndex(buf, -1)
+}
+
+func (r *attributeReplacer) replace(buf []byte, loc []int) []byte {
+	valueStart, valueEnd := loc[2], loc[3]
+	value := append([]byte(nil), buf[valueStart:valueEnd]...)
+	for _, replacer := range r.replacers {
+		value = replaceAll(value, replacer)
+	}
+
+	out := append([]byte(nil), buf[loc[0]:valueStart]...)
+	return append(out, value...)
+}
+
+// replaceAll applies a replacer to a complete buffer.
+func replaceAll(buf []byte, r replacer) []byte {
+	locs := r.find(buf)
+	if len(locs) == 0 {
+		return buf
+	}
+
+	var out []byte
+	done := 0
+	for _, loc := range locs {
+		out = append(out, buf[done:loc[0]]...)
+		out = append(out, r.replace(buf, loc)...)
+		done = loc[1]
+	}
+	return append(out, buf[done:]...)
+}
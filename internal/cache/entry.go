@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HeaderSurrogateKey lists the space-separated purge tags of a response. It
+// is consumed by the cache and not forwarded to clients.
+const HeaderSurrogateKey = "Surrogate-Key"
+
+// entryOverhead approximates the bookkeeping cost of an entry in bytes.
+const entryOverhead = 256
+
+// Entry is a stored response. Entries are immutable once stored; updates
+// replace them.
+type Entry struct {
+	Key        string
+	PrimaryKey string
+	Status     int
+	Header     http.Header
+	Body       []byte
+	Tags       []string
+
+	RequestTime  time.Time
+	ResponseTime time.Time
+	InitialAge   time.Duration
+	Lifetime     time.Duration
+
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+
+	// MustRevalidate forbids serving the entry stale.
+	MustRevalidate bool
+}
+
+// NewEntry creates the entry for a response received at responseTime to a
+// request sent at requestTime.
+func NewEntry(
+	primaryKey string,
+	requestHeader http.Header,
+	status int,
+	header http.Header,
+	body []byte,
+	requestTime, responseTime time.Time,
+	policy Policy,
+) *Entry {
+	header = header.Clone()
+	tags := strings.Fields(header.Get(HeaderSurrogateKey))
+	header.Del(HeaderSurrogateKey)
+
+	e := &Entry{
+		Key:          VariantKey(primaryKey, VaryHeaders(header), requestHeader),
+		PrimaryKey:   primaryKey,
+		Status:       status,
+		Header:       header,
+		Body:         body,
+		Tags:         tags,
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+	e.applyPolicy(policy)
+	return e
+}
+
+// Revalidated returns a copy of the entry updated with the header fields of
+// a 304 response to a validation request (RFC 9111 section 4.3.4).
+func (e *Entry) Revalidated(header http.Header, requestTime, responseTime time.Time, policy Policy) *Entry {
+	updated := *e
+	updated.Header = e.Header.Clone()
+	for name, values := range header {
+		switch name {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding", "Content-Range":
+			continue
+		case HeaderSurrogateKey:
+			updated.Tags = strings.Fields(strings.Join(values, " "))
+			continue
+		}
+		updated.Header[name] = append([]string(nil), values...)
+	}
+	updated.RequestTime = requestTime
+	updated.ResponseTime = responseTime
+	updated.applyPolicy(policy)
+	return &updated
+}
+
+// applyPolicy computes the age, lifetime and stale allowances of the entry.
+func (e *Entry) applyPolicy(policy Policy) {
+	cc := ParseCacheControl(e.Header)
+
+	e.InitialAge = InitialAge(e.Header, e.RequestTime, e.ResponseTime)
+	e.Lifetime = FreshnessLifetime(e.Header, policy)
+	e.MustRevalidate = cc.Has("must-revalidate") || cc.Has("proxy-revalidate") ||
+		cc.Has("s-maxage") || (cc.Has("no-cache") && policy.TTL == 0)
+
+	e.StaleWhileRevalidate = policy.StaleWhileRevalidate
+	if window, ok := cc.Duration("stale-while-revalidate"); ok {
+		e.StaleWhileRevalidate = window
+	}
+	e.StaleIfError = policy.StaleIfError
+	if window, ok := cc.Duration("stale-if-error"); ok {
+		e.StaleIfError = window
+	}
+}
+
+// Age returns the current age of the entry.
+func (e *Entry) Age(now time.Time) time.Duration {
+	return e.InitialAge + now.Sub(e.ResponseTime)
+}
+
+// Fresh reports whether the entry may be served without validation.
+func (e *Entry) Fresh(now time.Time) bool {
+	return e.Age(now) < e.Lifetime
+}
+
+// UsableStale reports whether the entry may be served stale within window.
+func (e *Entry) UsableStale(now time.Time, window time.Duration) bool {
+	return !e.MustRevalidate && window > 0 && e.Age(now) < e.Lifetime+window
+}
+
+// HasValidator reports whether the entry can be revalidated.
+func (e *Entry) HasValidator() bool {
+	return e.Header.Get("ETag") != "" || e.Header.Get("Last-Modified") != ""
+}
+
+// Size approximates the memory used by the entry in bytes.
+func (e *Entry) Size() int64 {
+	size := int64(len(e.Key)+len(e.PrimaryKey)+len(e.Body)) + entryOverhead
+	for name, values := range e.Header {
+		size += int64(len(name))
+		for _, value := range values {
+			size += int64(len(value))
+		}
+	}
+	for _, tag := range e.Tags {
+		size += int64(len(tag))
+	}
+	return size
+}
@@ -0,0 +1,294 @@
+// Package cache implements a shared HTTP response cache following RFC 9111,
+// with an in-memory LRU tier bounded by bytes and an optional disk tier.
+package cache
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// heuristicFraction is the share of the time since Last-Modified used as the
+// freshness lifetime of responses without explicit freshness (RFC 9111
+// section 4.2.2), capped at heuristicMax.
+const (
+	heuristicFraction = 10
+	heuristicMax      = 24 * time.Hour
+)
+
+// heuristicStatuses are the status codes that are cacheable by default
+// (RFC 9110 section 15.1), except 206 which this cache does not store.
+var heuristicStatuses = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// CacheControl holds the parsed directives of a Cache-Control header.
+// Directive names are lowercase; directives without a value map to "".
+type CacheControl map[string]string
+
+// ParseCacheControl parses the Cache-Control header fields of h.
+func ParseCacheControl(h http.Header) CacheControl {
+	cc := make(CacheControl)
+	for _, value := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(part), "=")
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			if _, seen := cc[name]; !seen {
+				cc[name] = strings.Trim(strings.TrimSpace(arg), `"`)
+			}
+		}
+	}
+	return cc
+}
+
+// Has reports whether the directive is present.
+func (cc CacheControl) Has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// Duration returns the delta-seconds argument of a directive.
+func (cc CacheControl) Duration(name string) (time.Duration, bool) {
+	arg, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// Policy holds the per-route overrides of cached response lifetimes.
+type Policy struct {
+	// TTL replaces the freshness lifetime of every stored response.
+	TTL time.Duration
+
+	// DefaultTTL is the freshness lifetime of responses without explicit
+	// freshness information.
+	DefaultTTL time.Duration
+
+	// StaleWhileRevalidate and StaleIfError apply when the response does
+	// not carry the corresponding directive.
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+}
+
+// RequestBypassesCache reports whether r must not be answered from or stored
+// in the cache. Range and upgrade requests are not cached.
+func RequestBypassesCache(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return true
+	}
+	if r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+		return true
+	}
+	return ParseCacheControl(r.Header).Has("no-store")
+}
+
+// RequestRequiresValidation reports whether r forbids serving a stored
+// response without validating it first.
+func RequestRequiresValidation(r *http.Request) bool {
+	cc := ParseCacheControl(r.Header)
+	if cc.Has("no-cache") {
+		return true
+	}
+	if maxAge, ok := cc.Duration("max-age"); ok && maxAge == 0 {
+		return true
+	}
+	return len(r.Header.Values("Cache-Control")) == 0 && strings.EqualFold(r.Header.Get("Pragma"), "no-cache")
+}
+
+// Storable reports whether a shared cache may store the response to r
+// (RFC 9111 section 3). Responses that set cookies are never stored.
+func Storable(r *http.Request, status int, header http.Header, policy Policy) bool {
+	if r.Method != http.MethodGet || status < 200 ||
+		status == http.StatusPartialContent || status == http.StatusNotModified {
+		return false
+	}
+
+	cc := ParseCacheControl(header)
+	if cc.Has("no-store") || cc.Has("private") {
+		return false
+	}
+	if header.Get("Set-Cookie") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	for _, name := range VaryHeaders(header) {
+		if name == "*" {
+			return false
+		}
+	}
+
+	if (r.Header.Get("Authorization") != "" || Authenticated(r.Context())) &&
+		!cc.Has("public") && !cc.Has("s-maxage") && !cc.Has("must-revalidate") {
+		return false
+	}
+
+	if policy.TTL > 0 || cc.Has("public") || cc.Has("no-cache") {
+		return true
+	}
+	if _, ok := cc.Duration("s-maxage"); ok {
+		return true
+	}
+	if _, ok := cc.Duration("max-age"); ok {
+		return true
+	}
+	if header.Get("Expires") != "" {
+		return true
+	}
+	return heuristicStatuses[status] && (policy.DefaultTTL > 0 || header.Get("Last-Modified") != "")
+}
+
+// authenticatedKey is the context key marking authenticated requests.
+type authenticatedKey struct{}
+
+// WithAuthenticated returns a context marking the request as authenticated
+// by the proxy. Authentication may strip the Authorization header, so
+// responses to such requests are stored under the same rules as responses
+// to requests that carry one (RFC 9111 section 3.5).
+func WithAuthenticated(ctx context.Context) context.Context {
+	return context.WithValue(ctx, authenticatedKey{}, true)
+}
+
+// Authenticated reports whether the request context was marked as
+// authenticated.
+func Authenticated(ctx context.Context) bool {
+	authenticated, _ := ctx.Value(authenticatedKey{}).(bool)
+	return authenticated
+}
+
+// FreshnessLifetime returns how long a response stays fresh after it was
+// generated (RFC 9111 section 4.2.1).
+func FreshnessLifetime(header http.Header, policy Policy) time.Duration {
+	cc := ParseCacheControl(header)
+	if policy.TTL > 0 {
+		return policy.TTL
+	}
+	if cc.Has("no-cache") {
+		return 0
+	}
+	if lifetime, ok := cc.Duration("s-maxage"); ok {
+		return lifetime
+	}
+	if lifetime, ok := cc.Duration("max-age"); ok {
+		return lifetime
+	}
+
+	date := parseHTTPDate(header.Get("Date"))
+	if expires := header.Get("Expires"); expires != "" {
+		expiresAt := parseHTTPDate(expires)
+		if expiresAt.IsZero() || date.IsZero() || !expiresAt.After(date) {
+			return 0
+		}
+		return expiresAt.Sub(date)
+	}
+
+	if policy.DefaultTTL > 0 {
+		return policy.DefaultTTL
+	}
+	if lastModified := parseHTTPDate(header.Get("Last-Modified")); !lastModified.IsZero() && date.After(lastModified) {
+		return min(date.Sub(lastModified)/heuristicFraction, heuristicMax)
+	}
+	return 0
+}
+
+// InitialAge returns the age of a response when it was received, from its
+// Date and Age headers and the request and response times (RFC 9111
+// section 4.2.3).
+func InitialAge(header http.Header, requestTime, responseTime time.Time) time.Duration {
+	apparentAge := time.Duration(0)
+	if date := parseHTTPDate(header.Get("Date")); !date.IsZero() && responseTime.After(date) {
+		apparentAge = responseTime.Sub(date)
+	}
+
+	ageValue := time.Duration(0)
+	if seconds, err := strconv.ParseInt(strings.TrimSpace(header.Get("Age")), 10, 64); err == nil && seconds > 0 {
+		ageValue = time.Duration(seconds) * time.Second
+	}
+
+	correctedAge := ageValue + responseTime.Sub(requestTime)
+	return max(apparentAge, correctedAge)
+}
+
+// VaryHeaders returns the canonical names of the request headers listed in
+// the Vary header fields, sorted.
+func VaryHeaders(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			if name != "*" {
+				name = http.CanonicalHeaderKey(name)
+			}
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PrimaryKey returns the cache key of a request target. HEAD requests share
+// the stored GET responses.
+func PrimaryKey(host, requestURI string) string {
+	return http.MethodGet + " " + strings.ToLower(host) + requestURI
+}
+
+// VariantKey returns the key of the stored response that matches the
+// request headers for the given Vary header names.
+func VariantKey(primaryKey string, varyHeaders []string, requestHeader http.Header) string {
+	if len(varyHeaders) == 0 {
+		return primaryKey
+	}
+
+	var b strings.Builder
+	b.WriteString(primaryKey)
+	for _, name := range varyHeaders {
+		values := requestHeader.Values(name)
+		normalized := make([]string, 0, len(values))
+		for _, value := range values {
+			for _, part := range strings.Split(value, ",") {
+				if part = strings.TrimSpace(part); part != "" {
+					normalized = append(normalized, part)
+				}
+			}
+		}
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(normalized, ", "))
+	}
+	return b.String()
+}
+
+// parseHTTPDate parses an HTTP date, returning the zero time when invalid.
+func parseHTTPDate(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := http.ParseTime(value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
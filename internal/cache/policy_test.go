@@ -0,0 +1,304 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorable(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		requestHeader http.Header
+		authenticated bool
+		status        int
+		header        http.Header
+		policy        Policy
+		expected      bool
+	}{
+		{
+			name:     "Storable_MaxAge_Stored",
+			method:   http.MethodGet,
+			status:   http.StatusOK,
+			header:   http.Header{"Cache-Control": {"max-age=60"}},
+			expected: true,
+		},
+		{
+			name:     "Storable_NoStore_Rejected",
+			method:   http.MethodGet,
+			status:   http.StatusOK,
+			header:   http.Header{"Cache-Control": {"max-age=60, no-store"}},
+			expected: false,
+		},
+		{
+			name:     "Storable_Private_Rejected",
+			method:   http.MethodGet,
+			status:   http.StatusOK,
+			header:   http.Header{"Cache-Control": {"private, max-age=60"}},
+			expected: false,
+		},
+		{
+			name:     "Storable_SetCookie_Rejected",
+			method:   http.MethodGet,
+			status:   http.StatusOK,
+			header:   http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"session=1"}},
+			expected: false,
+		},
+		{
+			name:     "Storable_VaryStar_Rejected",
+			method:   http.MethodGet,
+			status:   http.StatusOK,
+			header:   http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}},
+			expected: false,
+		},
+		{
+			name:          "Storable_AuthorizedWithoutPublic_Rejected",
+			method:        http.MethodGet,
+			requestHeader: http.Header{"Authorization": {"Bearer token"}},
+			status:        http.StatusOK,
+			header:        http.Header{"Cache-Control": {"max-age=60"}},
+			expected:      false,
+		},
+		{
+			name:          "Storable_AuthorizedWithSMaxAge_Stored",
+			method:        http.MethodGet,
+			requestHeader: http.Header{"Authorization": {"Bearer token"}},
+			status:        http.StatusOK,
+			header:        http.Header{"Cache-Control": {"s-maxage=60"}},
+			expected:      true,
+		},
+		{
+			name:          "Storable_AuthenticatedWithoutPublic_Rejected",
+			method:        http.MethodGet,
+			authenticated: true,
+			status:        http.StatusOK,
+			header:        http.Header{"Cache-Control": {"max-age=60"}},
+			expected:      false,
+		},
+		{
+			name:          "Storable_AuthenticatedWithPublic_Stored",
+			method:        http.MethodGet,
+			authenticated: true,
+			status:        http.StatusOK,
+			header:        http.Header{"Cache-Control": {"public, max-age=60"}},
+			expected:      true,
+		},
+		{
+			name:     "Storable_Post_Rejected",
+			method:   http.MethodPost,
+			status:   http.StatusOK,
+			header:   http.Header{"Cache-Control": {"max-age=60"}},
+			expected: false,
+		},
+		{
+			name:     "Storable_NoFreshness_Rejected",
+			method:   http.MethodGet,
+			status:   http.StatusOK,
+			header:   http.Header{},
+			expected: false,
+		},
+		{
+			name:     "Storable_NoFreshnessWithDefaultTTL_Stored",
+			method:   http.MethodGet,
+			status:   http.StatusOK,
+			header:   http.Header{},
+			policy:   Policy{DefaultTTL: time.Minute},
+			expected: true,
+		},
+		{
+			name:     "Storable_ServerErrorWithDefaultTTL_Rejected",
+			method:   http.MethodGet,
+			status:   http.StatusInternalServerError,
+			header:   http.Header{},
+			policy:   Policy{DefaultTTL: time.Minute},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(tt.method, "http://app.example.com/", nil)
+			for name, values := range tt.requestHeader {
+				req.Header[name] = values
+			}
+			if tt.authenticated {
+				req = req.WithContext(WithAuthenticated(req.Context()))
+			}
+
+			// Act
+			storable := Storable(req, tt.status, tt.header, tt.policy)
+
+			// Assert
+			assert.Equal(t, tt.expected, storable)
+		})
+	}
+}
+
+func TestFreshnessLifetime(t *testing.T) {
+	date := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		policy   Policy
+		expected time.Duration
+	}{
+		{
+			name:     "FreshnessLifetime_SMaxAge_PreferredOverMaxAge",
+			header:   http.Header{"Cache-Control": {"max-age=60, s-maxage=120"}},
+			expected: 120 * time.Second,
+		},
+		{
+			name:     "FreshnessLifetime_MaxAge_Used",
+			header:   http.Header{"Cache-Control": {"max-age=60"}},
+			expected: 60 * time.Second,
+		},
+		{
+			name: "FreshnessLifetime_Expires_RelativeToDate",
+			header: http.Header{
+				"Date":    {date.Format(http.TimeFormat)},
+				"Expires": {date.Add(5 * time.Minute).Format(http.TimeFormat)},
+			},
+			expected: 5 * time.Minute,
+		},
+		{
+			name: "FreshnessLifetime_InvalidExpires_Stale",
+			header: http.Header{
+				"Date":    {date.Format(http.TimeFormat)},
+				"Expires": {"0"},
+			},
+			expected: 0,
+		},
+		{
+			name: "FreshnessLifetime_LastModified_Heuristic",
+			header: http.Header{
+				"Date":          {date.Format(http.TimeFormat)},
+				"Last-Modified": {date.Add(-10 * time.Hour).Format(http.TimeFormat)},
+			},
+			expected: time.Hour,
+		},
+		{
+			name:     "FreshnessLifetime_RouteTTL_Overrides",
+			header:   http.Header{"Cache-Control": {"max-age=60"}},
+			policy:   Policy{TTL: time.Hour},
+			expected: time.Hour,
+		},
+		{
+			name:     "FreshnessLifetime_NoCache_Stale",
+			header:   http.Header{"Cache-Control": {"no-cache, max-age=60"}},
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			lifetime := FreshnessLifetime(tt.header, tt.policy)
+
+			// Assert
+			assert.Equal(t, tt.expected, lifetime)
+		})
+	}
+}
+
+func TestInitialAge(t *testing.T) {
+	responseTime := time.Date(2026, 1, 1, 12, 0, 10, 0, time.UTC)
+	requestTime := responseTime.Add(-2 * time.Second)
+
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected time.Duration
+	}{
+		{
+			name:     "InitialAge_AgeHeader_AddsResponseDelay",
+			header:   http.Header{"Age": {"30"}},
+			expected: 32 * time.Second,
+		},
+		{
+			name:     "InitialAge_OldDate_UsesApparentAge",
+			header:   http.Header{"Date": {responseTime.Add(-time.Minute).Format(http.TimeFormat)}},
+			expected: time.Minute,
+		},
+		{
+			name:     "InitialAge_NoHeaders_UsesResponseDelay",
+			header:   http.Header{},
+			expected: 2 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			age := InitialAge(tt.header, requestTime, responseTime)
+
+			// Assert
+			assert.Equal(t, tt.expected, age)
+		})
+	}
+}
+
+func TestVariantKey(t *testing.T) {
+	primaryKey := PrimaryKey("App.Example.com", "/assets/app.js?v=1")
+	vary := VaryHeaders(http.Header{"Vary": {"accept-encoding, Accept-Language"}})
+
+	gzip := VariantKey(primaryKey, vary, http.Header{"Accept-Encoding": {"gzip,  br"}})
+	gzipSpaced := VariantKey(primaryKey, vary, http.Header{"Accept-Encoding": {"gzip", "br"}})
+	identity := VariantKey(primaryKey, vary, http.Header{})
+
+	assert.Equal(t, "GET app.example.com/assets/app.js?v=1", primaryKey)
+	assert.Equal(t, []string{"Accept-Encoding", "Accept-Language"}, vary)
+	assert.Equal(t, gzip, gzipSpaced)
+	assert.NotEqual(t, gzip, identity)
+	assert.Equal(t, primaryKey, VariantKey(primaryKey, nil, http.Header{"Accept-Encoding": {"gzip"}}))
+}
+
+func TestRequestRequiresValidation(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   http.Header
+		expected bool
+	}{
+		{
+			name:     "RequiresValidation_NoCache_True",
+			header:   http.Header{"Cache-Control": {"no-cache"}},
+			expected: true,
+		},
+		{
+			name:     "RequiresValidation_MaxAgeZero_True",
+			header:   http.Header{"Cache-Control": {"max-age=0"}},
+			expected: true,
+		},
+		{
+			name:     "RequiresValidation_Pragma_True",
+			header:   http.Header{"Pragma": {"no-cache"}},
+			expected: true,
+		},
+		{
+			name:     "RequiresValidation_PragmaWithCacheControl_False",
+			header:   http.Header{"Pragma": {"no-cache"}, "Cache-Control": {"max-age=60"}},
+			expected: false,
+		},
+		{
+			name:     "RequiresValidation_Plain_False",
+			header:   http.Header{},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+			req.Header = tt.header
+
+			// Act & Assert
+			assert.Equal(t, tt.expected, RequestRequiresValidation(req))
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package cache
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// diskEntrySuffix names the files of the disk tier.
+const diskEntrySuffix = ".entry"
+
+// StoreConfig holds configuration for a response store.
+type StoreConfig struct {
+	// MaxBytes bounds the memory tier.
+	MaxBytes int64
+
+	// DiskPath enables the disk tier in this directory. Entries evicted
+	// from memory are moved there and promoted back when requested.
+	DiskPath string
+
+	// DiskMaxBytes bounds the disk tier.
+	DiskMaxBytes int64
+}
+
+// entryMeta tracks where a stored entry lives and what indexes it is in.
+type entryMeta struct {
+	key        string
+	primaryKey string
+	tags       []string
+	size       int64
+
+	// elem is the entry's element in the memory or disk LRU list.
+	elem   *list.Element
+	onDisk bool
+}
+
+// Store is a two-tier LRU store of cached responses, indexed by primary key
+// and surrogate key tags for purging. It is safe for concurrent use.
+type Store struct {
+	config StoreConfig
+
+	mu        sync.Mutex
+	entries   map[string]*entryMeta
+	memory    *list.List // of *Entry, most recently used first
+	memBytes  int64
+	disk      *list.List // of *entryMeta, most recently used first
+	diskBytes int64
+
+	vary      map[string][]string
+	byPrimary map[string]map[string]struct{}
+	byTag     map[string]map[string]struct{}
+}
+
+// NewStore creates a response store. The disk tier directory is created if
+// needed and emptied, since its index is kept in memory.
+func NewStore(config StoreConfig) (*Store, error) {
+	if config.MaxBytes <= 0 {
+		return nil, ErrInvalidStoreSize
+	}
+
+	if config.DiskPath != "" {
+		if config.DiskMaxBytes <= 0 {
+			return nil, ErrInvalidStoreSize
+		}
+		if err := os.MkdirAll(config.DiskPath, 0o700); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDiskTier, err)
+		}
+		stale, err := filepath.Glob(filepath.Join(config.DiskPath, "*"+diskEntrySuffix))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrDiskTier, err)
+		}
+		for _, path := range stale {
+			_ = os.Remove(path)
+		}
+	}
+
+	return &Store{
+		config:    config,
+		entries:   make(map[string]*entryMeta),
+		memory:    list.New(),
+		disk:      list.New(),
+		vary:      make(map[string][]string),
+		byPrimary: make(map[string]map[string]struct{}),
+		byTag:     make(map[string]map[string]struct{}),
+	}, nil
+}
+
+// Lookup returns the stored response for a request with the given primary
+// key and headers.
+func (s *Store) Lookup(primaryKey string, requestHeader http.Header) (*Entry, bool) {
+	s.mu.Lock()
+	varyHeaders, ok := s.vary[primaryKey]
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	return s.Get(VariantKey(primaryKey, varyHeaders, requestHeader))
+}
+
+// Get returns the entry stored under key, promoting it from disk to memory.
+func (s *Store) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	meta, ok := s.entries[key]
+	if !ok {
+		s.mu.Unlock()
+		return nil, false
+	}
+	if !meta.onDisk {
+		s.memory.MoveToFront(meta.elem)
+		entry := meta.elem.Value.(*Entry)
+		s.mu.Unlock()
+		return entry, true
+	}
+	s.mu.Unlock()
+
+	entry, err := s.readDisk(key)
+	if err != nil {
+		return nil, false
+	}
+
+	s.mu.Lock()
+	if current, ok := s.entries[key]; !ok || current != meta || !meta.onDisk {
+		s.mu.Unlock()
+		return entry, true
+	}
+	s.removeLocked(meta)
+	demoted := s.insertLocked(entry)
+	s.mu.Unlock()
+
+	s.removeDisk(key)
+	s.writeDemoted(demoted)
+	return entry, true
+}
+
+// Put stores an entry, replacing any entry with the same key. Entries
+// larger than the memory tier are not stored.
+func (s *Store) Put(entry *Entry) {
+	if entry.Size() > s.config.MaxBytes {
+		return
+	}
+
+	s.mu.Lock()
+	replacedOnDisk := false
+	if meta, ok := s.entries[entry.Key]; ok {
+		replacedOnDisk = meta.onDisk
+		s.removeLocked(meta)
+	}
+	s.vary[entry.PrimaryKey] = VaryHeaders(entry.Header)
+	demoted := s.insertLocked(entry)
+	s.mu.Unlock()
+
+	if replacedOnDisk {
+		s.removeDisk(entry.Key)
+	}
+	s.writeDemoted(demoted)
+}
+
+// PurgePrimary removes every variant stored for a primary key and returns
+// the number of entries removed.
+func (s *Store) PurgePrimary(primaryKey string) int {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.byPrimary[primaryKey]))
+	for key := range s.byPrimary[primaryKey] {
+		keys = append(keys, key)
+	}
+	delete(s.vary, primaryKey)
+	s.mu.Unlock()
+
+	return s.purgeKeys(keys)
+}
+
+// PurgeTag removes every entry tagged with tag and returns the number of
+// entries removed.
+func (s *Store) PurgeTag(tag string) int {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.byTag[tag]))
+	for key := range s.byTag[tag] {
+		keys = append(keys, key)
+	}
+	s.mu.Unlock()
+
+	return s.purgeKeys(keys)
+}
+
+// Len returns the number of stored entries in both tiers.
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// Bytes returns the bytes used by the memory and disk tiers.
+func (s *Store) Bytes() (memory, disk int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.memBytes, s.diskBytes
+}
+
+// purgeKeys removes the entries stored under keys.
+func (s *Store) purgeKeys(keys []string) int {
+	var diskKeys []string
+	removed := 0
+
+	s.mu.Lock()
+	for _, key := range keys {
+		meta, ok := s.entries[key]
+		if !ok {
+			continue
+		}
+		if meta.onDisk {
+			diskKeys = append(diskKeys, key)
+		}
+		s.removeLocked(meta)
+		removed++
+	}
+	s.mu.Unlock()
+
+	for _, key := range diskKeys {
+		s.removeDisk(key)
+	}
+	return removed
+}
+
+// insertLocked adds entry to the memory tier and returns the entries
+// evicted to make room that should move to the disk tier.
+func (s *Store) insertLocked(entry *Entry) []*Entry {
+	meta := &entryMeta{
+		key:        entry.Key,
+		primaryKey: entry.PrimaryKey,
+		tags:       entry.Tags,
+		size:       entry.Size(),
+	}
+	meta.elem = s.memory.PushFront(entry)
+	s.entries[entry.Key] = meta
+	s.memBytes += meta.size
+	s.indexLocked(meta)
+
+	var demoted []*Entry
+	for s.memBytes > s.config.MaxBytes {
+		oldest := s.memory.Back()
+		evicted := oldest.Value.(*Entry)
+		evictedMeta := s.entries[evicted.Key]
+
+		s.memory.Remove(oldest)
+		s.memBytes -= evictedMeta.size
+
+		if s.config.DiskPath == "" || evictedMeta.size > s.config.DiskMaxBytes {
+			s.unindexLocked(evictedMeta)
+			delete(s.entries, evicted.Key)
+			continue
+		}
+
+		evictedMeta.onDisk = true
+		evictedMeta.elem = s.disk.PushFront(evictedMeta)
+		s.diskBytes += evictedMeta.size
+		demoted = append(demoted, evicted)
+	}
+
+	return demoted
+}
+
+// removeLocked removes an entry from its tier and the indexes.
+func (s *Store) removeLocked(meta *entryMeta) {
+	if meta.onDisk {
+		s.disk.Remove(meta.elem)
+		s.diskBytes -= meta.size
+	} else {
+		s.memory.Remove(meta.elem)
+		s.memBytes -= meta.size
+	}
+	s.unindexLocked(meta)
+	delete(s.entries, meta.key)
+}
+
+// indexLocked adds an entry to the purge indexes.
+func (s *Store) indexLocked(meta *entryMeta) {
+	addToIndex(s.byPrimary, meta.primaryKey, meta.key)
+	for _, tag := range meta.tags {
+		addToIndex(s.byTag, tag, meta.key)
+	}
+}
+
+// unindexLocked removes an entry from the purge indexes.
+func (s *Store) unindexLocked(meta *entryMeta) {
+	removeFromIndex(s.byPrimary, meta.primaryKey, meta.key)
+	if _, ok := s.byPrimary[meta.primaryKey]; !ok {
+		delete(s.vary, meta.primaryKey)
+	}
+	for _, tag := range meta.tags {
+		removeFromIndex(s.byTag, tag, meta.key)
+	}
+}
+
+// writeDemoted writes entries evicted from memory to the disk tier and
+// evicts the least recently used disk entries beyond its budget.
+func (s *Store) writeDemoted(demoted []*Entry) {
+	for _, entry := range demoted {
+		if err := s.writeDisk(entry); err != nil {
+			s.mu.Lock()
+			if meta, ok := s.entries[entry.Key]; ok && meta.onDisk {
+				s.removeLocked(meta)
+			}
+			s.mu.Unlock()
+		}
+	}
+
+	var evicted []string
+	s.mu.Lock()
+	for s.diskBytes > s.config.DiskMaxBytes {
+		meta := s.disk.Back().Value.(*entryMeta)
+		s.removeLocked(meta)
+		evicted = append(evicted, meta.key)
+	}
+	s.mu.Unlock()
+
+	for _, key := range evicted {
+		s.removeDisk(key)
+	}
+}
+
+// diskPath returns the file of key in the disk tier.
+func (s *Store) diskPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.config.DiskPath, hex.EncodeToString(sum[:])+diskEntrySuffix)
+}
+
+// writeDisk writes an entry to the disk tier atomically.
+func (s *Store) writeDisk(entry *Entry) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return err
+	}
+
+	path := s.diskPath(entry.Key)
+	tmp, err := os.CreateTemp(s.config.DiskPath, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readDisk reads an entry from the disk tier.
+func (s *Store) readDisk(key string) (*Entry, error) {
+	data, err := os.ReadFile(s.diskPath(key))
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&entry); err != nil {
+		return nil, err
+	}
+	if entry.Key != key {
+		return nil, fmt.Errorf("%w: key mismatch", ErrDiskTier)
+	}
+	return &entry, nil
+}
+
+// removeDisk removes the file of key from the disk tier.
+func (s *Store) removeDisk(key string) {
+	_ = os.Remove(s.diskPath(key))
+}
+
+// addToIndex adds key to the set stored under name.
+func addToIndex(index map[string]map[string]struct{}, name, key string) {
+	keys, ok := index[name]
+	if !ok {
+		keys = make(map[string]struct{})
+		index[name] = keys
+	}
+	keys[key] = struct{}{}
+}
+
+// removeFromIndex removes key from the set stored under name.
+func removeFromIndex(index map[string]map[string]struct{}, name, key string) {
+	keys, ok := index[name]
+	if !ok {
+		return
+	}
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(index, name)
+	}
+}
+
+// Store errors.
+var (
+	ErrInvalidStoreSize = fmt.Errorf("cache store size must be positive")
+	ErrDiskTier         = fmt.Errorf("cache disk tier error")
+)
@@ -0,0 +1,248 @@
+package cache
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestEntry creates a fresh entry for path with the given body size.
+func newTestEntry(path string, size int, header http.Header) *Entry {
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Cache-Control", "max-age=60")
+
+	now := time.Now()
+	return NewEntry(PrimaryKey("app.example.com", path), http.Header{}, http.StatusOK, header,
+		[]byte(strings.Repeat("x", size)), now, now, Policy{})
+}
+
+func TestNewStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      StoreConfig
+		expectedErr error
+	}{
+		{
+			name:   "NewStore_MemoryOnly_Created",
+			config: StoreConfig{MaxBytes: 1 << 20},
+		},
+		{
+			name:        "NewStore_ZeroMemory_Error",
+			config:      StoreConfig{},
+			expectedErr: ErrInvalidStoreSize,
+		},
+		{
+			name:        "NewStore_DiskWithoutBudget_Error",
+			config:      StoreConfig{MaxBytes: 1 << 20, DiskPath: t.TempDir()},
+			expectedErr: ErrInvalidStoreSize,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			store, err := NewStore(tt.config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Nil(t, store)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, store)
+		})
+	}
+}
+
+func TestStore_Lookup_Vary(t *testing.T) {
+	// Arrange
+	store, err := NewStore(StoreConfig{MaxBytes: 1 << 20})
+	require.NoError(t, err)
+
+	primaryKey := PrimaryKey("app.example.com", "/")
+	now := time.Now()
+	header := http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"Accept-Language"}}
+	store.Put(NewEntry(primaryKey, http.Header{"Accept-Language": {"en"}}, http.StatusOK, header,
+		[]byte("hello"), now, now, Policy{}))
+	store.Put(NewEntry(primaryKey, http.Header{"Accept-Language": {"de"}}, http.StatusOK, header,
+		[]byte("hallo"), now, now, Policy{}))
+
+	// Act
+	en, enFound := store.Lookup(primaryKey, http.Header{"Accept-Language": {"en"}})
+	de, deFound := store.Lookup(primaryKey, http.Header{"Accept-Language": {"de"}})
+	_, frFound := store.Lookup(primaryKey, http.Header{"Accept-Language": {"fr"}})
+
+	// Assert
+	require.True(t, enFound)
+	require.True(t, deFound)
+	assert.False(t, frFound)
+	assert.Equal(t, "hello", string(en.Body))
+	assert.Equal(t, "hallo", string(de.Body))
+	assert.Equal(t, 2, store.Len())
+}
+
+func TestStore_Put_EvictsLeastRecentlyUsed(t *testing.T) {
+	// Arrange
+	first := newTestEntry("/first", 400, nil)
+	store, err := NewStore(StoreConfig{MaxBytes: 2*first.Size() + 100})
+	require.NoError(t, err)
+
+	store.Put(first)
+	store.Put(newTestEntry("/second", 400, nil))
+	_, found := store.Get(first.Key)
+	require.True(t, found)
+
+	// Act
+	store.Put(newTestEntry("/third", 400, nil))
+
+	// Assert
+	_, firstFound := store.Get(first.Key)
+	_, secondFound := store.Get(PrimaryKey("app.example.com", "/second"))
+	assert.True(t, firstFound)
+	assert.False(t, secondFound)
+	memory, _ := store.Bytes()
+	assert.LessOrEqual(t, memory, 2*first.Size()+100)
+}
+
+func TestStore_DiskTier(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	first := newTestEntry("/first", 400, nil)
+	store, err := NewStore(StoreConfig{
+		MaxBytes:     first.Size() + 100,
+		DiskPath:     dir,
+		DiskMaxBytes: 10 * first.Size(),
+	})
+	require.NoError(t, err)
+
+	// Act
+	store.Put(first)
+	store.Put(newTestEntry("/second", 400, nil))
+
+	// Assert
+	files, err := filepath.Glob(filepath.Join(dir, "*"+diskEntrySuffix))
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	_, disk := store.Bytes()
+	assert.Equal(t, first.Size(), disk)
+
+	promoted, found := store.Get(first.Key)
+	require.True(t, found)
+	assert.Equal(t, first.Body, promoted.Body)
+	assert.Equal(t, first.Header, promoted.Header)
+	assert.Equal(t, 2, store.Len())
+
+	_, err = os.Stat(store.diskPath(first.Key))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStore_Purge(t *testing.T) {
+	// Arrange
+	store, err := NewStore(StoreConfig{MaxBytes: 1 << 20})
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		store.Put(newTestEntry(fmt.Sprintf("/product/%d", i), 10, http.Header{
+			HeaderSurrogateKey: {fmt.Sprintf("product-%d catalog", i)},
+		}))
+	}
+	store.Put(newTestEntry("/about", 10, nil))
+
+	// Act
+	byURL := store.PurgePrimary(PrimaryKey("app.example.com", "/product/0"))
+	byTag := store.PurgeTag("catalog")
+	missing := store.PurgeTag("unknown")
+
+	// Assert
+	assert.Equal(t, 1, byURL)
+	assert.Equal(t, 2, byTag)
+	assert.Equal(t, 0, missing)
+	assert.Equal(t, 1, store.Len())
+	_, found := store.Get(PrimaryKey("app.example.com", "/about"))
+	assert.True(t, found)
+}
+
+func TestNewEntry_SurrogateKeys(t *testing.T) {
+	// Act
+	entry := newTestEntry("/", 10, http.Header{HeaderSurrogateKey: {"a  b"}})
+
+	// Assert
+	assert.Equal(t, []string{"a", "b"}, entry.Tags)
+	assert.Empty(t, entry.Header.Get(HeaderSurrogateKey))
+}
+
+func TestEntry_Revalidated(t *testing.T) {
+	// Arrange
+	created := time.Now().Add(-time.Minute)
+	entry := NewEntry(PrimaryKey("app.example.com", "/"), http.Header{}, http.StatusOK,
+		http.Header{"Cache-Control": {"max-age=30"}, "Etag": {`"v1"`}, "Content-Length": {"5"}},
+		[]byte("hello"), created, created, Policy{})
+	require.False(t, entry.Fresh(time.Now()))
+
+	// Act
+	now := time.Now()
+	updated := entry.Revalidated(http.Header{"Cache-Control": {"max-age=120"}, "Content-Length": {"0"}}, now, now, Policy{})
+
+	// Assert
+	assert.True(t, updated.Fresh(now))
+	assert.Equal(t, "5", updated.Header.Get("Content-Length"))
+	assert.Equal(t, `"v1"`, updated.Header.Get("ETag"))
+	assert.Equal(t, "max-age=30", entry.Header.Get("Cache-Control"))
+}
+
+func TestEntry_UsableStale(t *testing.T) {
+	created := time.Now().Add(-90 * time.Second)
+
+	tests := []struct {
+		name         string
+		cacheControl string
+		policy       Policy
+		expectedSWR  bool
+		expectedSIE  bool
+	}{
+		{
+			name:         "UsableStale_ResponseDirectives_Honored",
+			cacheControl: "max-age=60, stale-while-revalidate=60, stale-if-error=10",
+			expectedSWR:  true,
+			expectedSIE:  false,
+		},
+		{
+			name:         "UsableStale_PolicyDefaults_Applied",
+			cacheControl: "max-age=60",
+			policy:       Policy{StaleWhileRevalidate: time.Minute, StaleIfError: time.Hour},
+			expectedSWR:  true,
+			expectedSIE:  true,
+		},
+		{
+			name:         "UsableStale_MustRevalidate_Forbidden",
+			cacheControl: "max-age=60, must-revalidate, stale-while-revalidate=60",
+			policy:       Policy{StaleIfError: time.Hour},
+			expectedSWR:  false,
+			expectedSIE:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			entry := NewEntry(PrimaryKey("app.example.com", "/"), http.Header{}, http.StatusOK,
+				http.Header{"Cache-Control": {tt.cacheControl}}, nil, created, created, tt.policy)
+			now := time.Now()
+
+			// Act & Assert
+			assert.False(t, entry.Fresh(now))
+			assert.Equal(t, tt.expectedSWR, entry.UsableStale(now, entry.StaleWhileRevalidate))
+			assert.Equal(t, tt.expectedSIE, entry.UsableStale(now, entry.StaleIfError))
+		})
+	}
+}
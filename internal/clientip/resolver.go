@@ -0,0 +1,291 @@
+// Package clientip resolves the originating client address of HTTP requests
+// behind trusted reverse proxies.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Forwarding header names.
+const (
+	HeaderXForwardedFor   = "X-Forwarded-For"
+	HeaderForwarded       = "Forwarded"
+	HeaderXRealIP         = "X-Real-IP"
+	HeaderXForwardedProto = "X-Forwarded-Proto"
+)
+
+// spoofableHeaders are client address headers that are never consulted and are
+// removed when forwarding headers are overwritten.
+var spoofableHeaders = []string{
+	"CF-Connecting-IP",
+	"True-Client-IP",
+	"X-Client-IP",
+	"X-Cluster-Client-IP",
+	"X-Original-For",
+	"X-Original-Forwarded-For",
+}
+
+// contextKey is the context key type for resolved client addresses.
+type contextKey struct{}
+
+// Result is the outcome of resolving a request's client address.
+type Result struct {
+	// IP is the resolved client address.
+	IP string
+
+	// Peer is the address of the immediate peer connection.
+	Peer string
+
+	// Chain lists the client followed by each trusted proxy that forwarded
+	// the request before the peer, in X-Forwarded-For order. It is empty
+	// when the client connected directly.
+	Chain []string
+
+	// Scheme is the scheme the client used: the protocol reported by a
+	// trusted proxy, otherwise https for TLS connections and http.
+	Scheme string
+}
+
+// Resolver determines the client address of a request. Forwarding headers are
+// only consulted when the peer is a trusted proxy, and are walked right-to-left
+// until the first untrusted hop.
+type Resolver struct {
+	trusted []*net.IPNet
+	header  string
+}
+
+// NewResolver creates a resolver trusting the given proxy CIDRs or addresses.
+// The header selects which forwarding header is walked: X-Forwarded-For
+// (the default) or Forwarded.
+func NewResolver(trustedProxies []string, header string) (*Resolver, error) {
+	r := &Resolver{header: HeaderXForwardedFor}
+
+	switch http.CanonicalHeaderKey(strings.TrimSpace(header)) {
+	case "", HeaderXForwardedFor:
+	case HeaderForwarded:
+		r.header = HeaderForwarded
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedHeader, header)
+	}
+
+	for _, value := range trustedProxies {
+		network, err := ParseNetwork(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTrustedProxy, value)
+		}
+		r.trusted = append(r.trusted, network)
+	}
+
+	return r, nil
+}
+
+// Resolve returns the client address of req.
+func (r *Resolver) Resolve(req *http.Request) Result {
+	peer := parseAddress(req.RemoteAddr)
+	if peer == nil {
+		return Result{IP: req.RemoteAddr, Peer: req.RemoteAddr, Scheme: connectionScheme(req)}
+	}
+
+	result := Result{IP: peer.String(), Peer: peer.String(), Scheme: connectionScheme(req)}
+	if !r.Trusted(peer) {
+		return result
+	}
+
+	if proto := r.proto(req); proto != "" {
+		result.Scheme = proto
+	}
+
+	hops := r.hops(req)
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := parseAddress(hops[i])
+		if ip == nil {
+			// A malformed or obfuscated hop cannot be attributed; the
+			// last trusted hop is the best known client.
+			break
+		}
+
+		result.IP = ip.String()
+		result.Chain = append([]string{result.IP}, result.Chain...)
+		if !r.Trusted(ip) {
+			break
+		}
+	}
+
+	return result
+}
+
+// Trusted reports whether ip belongs to a trusted proxy.
+func (r *Resolver) Trusted(ip net.IP) bool {
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// hops returns the forwarding header addresses in left-to-right order.
+func (r *Resolver) hops(req *http.Request) []string {
+	var hops []string
+	for _, line := range req.Header.Values(r.header) {
+		for _, element := range strings.Split(line, ",") {
+			element = strings.TrimSpace(element)
+			if r.header == HeaderForwarded {
+				element = forwardedParam(element, "for")
+			}
+			hops = append(hops, element)
+		}
+	}
+	return hops
+}
+
+// proto returns the client scheme reported in the forwarding headers, or ""
+// when none or an unknown one is reported. The first element describes the
+// connection of the client to the outermost proxy.
+func (r *Resolver) proto(req *http.Request) string {
+	var value string
+	if r.header == HeaderForwarded {
+		first, _, _ := strings.Cut(req.Header.Get(HeaderForwarded), ",")
+		value = forwardedParam(first, "proto")
+	} else {
+		value, _, _ = strings.Cut(req.Header.Get(HeaderXForwardedProto), ",")
+	}
+
+	switch value = strings.ToLower(strings.TrimSpace(value)); value {
+	case "http", "https":
+		return value
+	default:
+		return ""
+	}
+}
+
+// connectionScheme returns the scheme of the connection req arrived on.
+func connectionScheme(req *http.Request) string {
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// ForwardedFor returns the X-Forwarded-For value describing the chain.
+func (res Result) ForwardedFor() string {
+	return strings.Join(res.Chain, ", ")
+}
+
+// Forwarded returns the RFC 7239 Forwarded value describing the chain.
+func (res Result) Forwarded() string {
+	elements := make([]string, 0, len(res.Chain))
+	for _, address := range res.Chain {
+		if strings.Contains(address, ":") {
+			elements = append(elements, `for="[`+address+`]"`)
+		} else {
+			elements = append(elements, "for="+address)
+		}
+	}
+	return strings.Join(elements, ", ")
+}
+
+// Overwrite replaces the forwarding headers in h with values derived from the
+// resolved chain, discarding anything an untrusted client supplied.
+func (res Result) Overwrite(h http.Header) {
+	for _, name := range spoofableHeaders {
+		h.Del(name)
+	}
+
+	if len(res.Chain) == 0 {
+		h.Del(HeaderXForwardedFor)
+		h.Del(HeaderForwarded)
+	} else {
+		h.Set(HeaderXForwardedFor, res.ForwardedFor())
+		h.Set(HeaderForwarded, res.Forwarded())
+	}
+
+	if res.IP != "" {
+		h.Set(HeaderXRealIP, res.IP)
+	} else {
+		h.Del(HeaderXRealIP)
+	}
+}
+
+// WithResult returns a context carrying the resolved client address.
+func WithResult(ctx context.Context, result Result) context.Context {
+	return context.WithValue(ctx, contextKey{}, result)
+}
+
+// FromContext returns the resolved client address stored in ctx.
+func FromContext(ctx context.Context) (Result, bool) {
+	result, ok := ctx.Value(contextKey{}).(Result)
+	return result, ok
+}
+
+// FromRequest returns the client address resolved for req, or the peer
+// address when no resolution has taken place. Forwarding headers are never
+// trusted without a resolver.
+func FromRequest(req *http.Request) Result {
+	if result, ok := FromContext(req.Context()); ok {
+		return result
+	}
+
+	peer := parseAddress(req.RemoteAddr)
+	if peer == nil {
+		return Result{IP: req.RemoteAddr, Peer: req.RemoteAddr, Scheme: connectionScheme(req)}
+	}
+	return Result{IP: peer.String(), Peer: peer.String(), Scheme: connectionScheme(req)}
+}
+
+// ParseNetwork parses a CIDR or a single IP address as a host network.
+func ParseNetwork(value string) (*net.IPNet, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		return network, err
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", value)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+// parseAddress parses an address that may carry a port or IPv6 brackets.
+func parseAddress(value string) net.IP {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	if ip := net.ParseIP(value); ip != nil {
+		return ip
+	}
+
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return net.ParseIP(host)
+	}
+
+	return net.ParseIP(strings.Trim(value, "[]"))
+}
+
+// forwardedParam extracts the named parameter of a Forwarded element.
+func forwardedParam(element, param string) string {
+	for _, pair := range strings.Split(element, ";") {
+		name, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if found && strings.EqualFold(strings.TrimSpace(name), param) {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return ""
+}
+
+// Resolver configuration errors.
+var (
+	ErrUnsupportedHeader   = fmt.Errorf("unsupported client IP header: must be X-Forwarded-For or Forwarded")
+	ErrInvalidTrustedProxy = fmt.Errorf("invalid trusted proxy")
+)
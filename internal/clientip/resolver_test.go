@@ -0,0 +1,197 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolver_Resolve(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         string
+		remoteAddr     string
+		headers        map[string]string
+		expectedIP     string
+		expectedChain  []string
+		expectedScheme string
+	}{
+		{
+			name:           "Resolve_UntrustedPeer_IgnoresHeaders",
+			remoteAddr:     "203.0.113.10:40000",
+			headers:        map[string]string{"X-Forwarded-For": "198.51.100.1"},
+			expectedIP:     "203.0.113.10",
+			expectedScheme: "http",
+		},
+		{
+			name:           "Resolve_TrustedPeer_UsesRightmostUntrustedHop",
+			remoteAddr:     "10.0.0.1:40000",
+			headers:        map[string]string{"X-Forwarded-For": "198.51.100.66, 203.0.113.5, 10.0.0.2"},
+			expectedIP:     "203.0.113.5",
+			expectedChain:  []string{"203.0.113.5", "10.0.0.2"},
+			expectedScheme: "http",
+		},
+		{
+			name:           "Resolve_AllHopsTrusted_UsesLeftmostHop",
+			remoteAddr:     "10.0.0.1:40000",
+			headers:        map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			expectedIP:     "10.0.0.3",
+			expectedChain:  []string{"10.0.0.3", "10.0.0.2"},
+			expectedScheme: "http",
+		},
+		{
+			name:           "Resolve_MalformedHop_StopsAtLastTrustedHop",
+			remoteAddr:     "10.0.0.1:40000",
+			headers:        map[string]string{"X-Forwarded-For": "203.0.113.5, not-an-ip, 10.0.0.2"},
+			expectedIP:     "10.0.0.2",
+			expectedChain:  []string{"10.0.0.2"},
+			expectedScheme: "http",
+		},
+		{
+			name:           "Resolve_TrustedPeerWithoutHeader_UsesPeer",
+			remoteAddr:     "10.0.0.1:40000",
+			expectedIP:     "10.0.0.1",
+			expectedScheme: "http",
+		},
+		{
+			name:           "Resolve_ForwardedHeader_ParsesForParameter",
+			header:         "Forwarded",
+			remoteAddr:     "10.0.0.1:40000",
+			headers:        map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https, for=10.0.0.2`},
+			expectedIP:     "2001:db8::1",
+			expectedChain:  []string{"2001:db8::1", "10.0.0.2"},
+			expectedScheme: "https",
+		},
+		{
+			name:           "Resolve_ForwardedHeaderMode_IgnoresXForwardedFor",
+			header:         "Forwarded",
+			remoteAddr:     "10.0.0.1:40000",
+			headers:        map[string]string{"X-Forwarded-For": "203.0.113.5"},
+			expectedIP:     "10.0.0.1",
+			expectedScheme: "http",
+		},
+		{
+			name:           "Resolve_TrustedPeer_UsesForwardedProto",
+			remoteAddr:     "10.0.0.1:40000",
+			headers:        map[string]string{"X-Forwarded-Proto": "https, http"},
+			expectedIP:     "10.0.0.1",
+			expectedScheme: "https",
+		},
+		{
+			name:           "Resolve_UntrustedPeer_IgnoresForwardedProto",
+			remoteAddr:     "203.0.113.10:40000",
+			headers:        map[string]string{"X-Forwarded-Proto": "https"},
+			expectedIP:     "203.0.113.10",
+			expectedScheme: "http",
+		},
+		{
+			name:           "Resolve_TrustedPeerUnknownProto_UsesConnection",
+			remoteAddr:     "10.0.0.1:40000",
+			headers:        map[string]string{"X-Forwarded-Proto": "gopher"},
+			expectedIP:     "10.0.0.1",
+			expectedScheme: "http",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			resolver, err := NewResolver([]string{"10.0.0.0/8"}, tt.header)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			// Act
+			result := resolver.Resolve(req)
+
+			// Assert
+			assert.Equal(t, tt.expectedIP, result.IP)
+			assert.Equal(t, tt.expectedChain, result.Chain)
+			assert.Equal(t, tt.expectedScheme, result.Scheme)
+		})
+	}
+}
+
+func TestResult_Overwrite(t *testing.T) {
+	tests := []struct {
+		name              string
+		result            Result
+		expectedXFF       string
+		expectedForwarded string
+		expectedRealIP    string
+	}{
+		{
+			name:           "Overwrite_DirectClient_RemovesForwardingHeaders",
+			result:         Result{IP: "203.0.113.10", Peer: "203.0.113.10"},
+			expectedRealIP: "203.0.113.10",
+		},
+		{
+			name: "Overwrite_TrustedChain_RewritesHeaders",
+			result: Result{
+				IP:    "2001:db8::1",
+				Peer:  "10.0.0.1",
+				Chain: []string{"2001:db8::1", "10.0.0.2"},
+			},
+			expectedXFF:       "2001:db8::1, 10.0.0.2",
+			expectedForwarded: `for="[2001:db8::1]", for=10.0.0.2`,
+			expectedRealIP:    "2001:db8::1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			header := http.Header{}
+			header.Set("X-Forwarded-For", "198.51.100.66")
+			header.Set("Forwarded", "for=198.51.100.66")
+			header.Set("X-Real-IP", "198.51.100.66")
+			header.Set("CF-Connecting-IP", "198.51.100.66")
+
+			// Act
+			tt.result.Overwrite(header)
+
+			// Assert
+			assert.Equal(t, tt.expectedXFF, header.Get("X-Forwarded-For"))
+			assert.Equal(t, tt.expectedForwarded, header.Get("Forwarded"))
+			assert.Equal(t, tt.expectedRealIP, header.Get("X-Real-IP"))
+			assert.Empty(t, header.Get("CF-Connecting-IP"))
+		})
+	}
+}
+
+func TestNewResolver_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		header         string
+		expectedErr    error
+	}{
+		{
+			name:           "NewResolver_InvalidCIDR_ReturnsError",
+			trustedProxies: []string{"10.0.0.0/33"},
+			expectedErr:    ErrInvalidTrustedProxy,
+		},
+		{
+			name:        "NewResolver_UnsupportedHeader_ReturnsError",
+			header:      "X-Real-IP",
+			expectedErr: ErrUnsupportedHeader,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			_, err := NewResolver(tt.trustedProxies, tt.header)
+
+			// Assert
+			assert.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AccessControlConfig contains IP and GeoIP access control for a route.
+// Rules are evaluated in order and the first match decides; requests that
+// match no rule receive the default action.
+type AccessControlConfig struct {
+	Enabled       bool         `mapstructure:"enabled" default:"false"`
+	DefaultAction string       `mapstructure:"default_action" default:"allow"`
+	GeoIPDatabase string       `mapstructure:"geoip_database"`
+	Rules         []AccessRule `mapstructure:"rules"`
+}
+
+// AccessRule defines a single allow or deny rule.
+type AccessRule struct {
+	Name      string   `mapstructure:"name"`
+	Action    string   `mapstructure:"action"`
+	CIDRs     []string `mapstructure:"cidrs"`
+	Countries []string `mapstructure:"countries"`
+}
+
+// validateAccessControl validates the access control configuration of a single route.
+func validateAccessControl(host string, cfg AccessControlConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.DefaultAction != "" && cfg.DefaultAction != "allow" && cfg.DefaultAction != "deny" {
+		return fmt.Errorf("route %s: access control default action must be allow or deny", host)
+	}
+
+	for i, rule := range cfg.Rules {
+		if rule.Action != "allow" && rule.Action != "deny" {
+			return fmt.Errorf("route %s: access rule %d action must be allow or deny", host, i)
+		}
+
+		if len(rule.CIDRs) == 0 && len(rule.Countries) == 0 {
+			return fmt.Errorf("route %s: access rule %d must list CIDRs or countries", host, i)
+		}
+
+		for _, cidr := range rule.CIDRs {
+			if !isValidCIDROrIP(cidr) {
+				return fmt.Errorf("route %s: access rule %d has invalid CIDR %q", host, i, cidr)
+			}
+		}
+
+		if len(rule.Countries) > 0 && cfg.GeoIPDatabase == "" {
+			return fmt.Errorf("route %s: access rule %d uses countries but no GeoIP database is configured", host, i)
+		}
+	}
+
+	return nil
+}
+
+// isValidCIDROrIP reports whether value is a CIDR or a single IP address.
+func isValidCIDROrIP(value string) bool {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		_, _, err := net.ParseCIDR(value)
+		return err == nil
+	}
+	return net.ParseIP(value) != nil
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Minimum length of secrets used to derive cookie encryption keys.
+const minCookieSecretLength = 32
+
+// OIDCConfig contains OpenID Connect relying party configuration for a route.
+// When enabled, browser requests without a valid session are redirected to the
+// identity provider using the authorization code flow with PKCE.
+type OIDCConfig struct {
+	Enabled               bool          `mapstructure:"enabled" default:"false"`
+	IssuerURL             string        `mapstructure:"issuer_url" validate:"omitempty,url"`
+	ClientID              string        `mapstructure:"client_id"`
+	ClientSecret          string        `mapstructure:"client_secret"`
+	RedirectURL           string        `mapstructure:"redirect_url" validate:"omitempty,url"`
+	CallbackPath          string        `mapstructure:"callback_path" default:"/oauth2/callback"`
+	LogoutPath            string        `mapstructure:"logout_path" default:"/oauth2/logout"`
+	PostLogoutRedirectURL string        `mapstructure:"post_logout_redirect_url"`
+	Scopes                []string      `mapstructure:"scopes"`
+	CookieName            string        `mapstructure:"cookie_name" default:"_rwwwrse_oidc"`
+	CookieSecret          string        `mapstructure:"cookie_secret"`
+	CookieDomain          string        `mapstructure:"cookie_domain"`
+	CookieSecure          *bool         `mapstructure:"cookie_secure" default:"true"`
+	SessionTTL            time.Duration `mapstructure:"session_ttl" default:"24h"`
+	GroupsClaim           string        `mapstructure:"groups_claim" default:"groups"`
+	AllowedEmailDomains   []string      `mapstructure:"allowed_email_domains"`
+	AllowedGroups         []string      `mapstructure:"allowed_groups"`
+	AllowedUsers          []string      `mapstructure:"allowed_users"`
+}
+
+// validateOIDC validates the OIDC configuration of a single route.
+func validateOIDC(host string, cfg OIDCConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.IssuerURL == "" {
+		return fmt.Errorf("route %s: OIDC issuer URL is required", host)
+	}
+
+	if cfg.ClientID == "" {
+		return fmt.Errorf("route %s: OIDC client ID is required", host)
+	}
+
+	if len(cfg.CookieSecret) < minCookieSecretLength {
+		return fmt.Errorf("route %s: OIDC cookie secret must be at least %d characters", host, minCookieSecretLength)
+	}
+
+	if cfg.SessionTTL < 0 {
+		return fmt.Errorf("route %s: OIDC session TTL must not be negative", host)
+	}
+
+	return nil
+}
+
+// ForwardAuthConfig contains forward authentication configuration for a route.
+// Each request is first sent to an external authorization service; a 2xx
+// response allows it, any other response is returned to the client.
+type ForwardAuthConfig struct {
+	Enabled         bool          `mapstructure:"enabled" default:"false"`
+	URL             string        `mapstructure:"url" validate:"omitempty,url"`
+	Timeout         time.Duration `mapstructure:"timeout" default:"5s"`
+	RequestHeaders  []string      `mapstructure:"request_headers"`
+	ResponseHeaders []string      `mapstructure:"response_headers"`
+	CacheTTL        time.Duration `mapstructure:"cache_ttl" default:"0s"`
+	CacheKeyHeaders []string      `mapstructure:"cache_key_headers"`
+}
+
+// validateForwardAuth validates the forward authentication configuration of a single route.
+func validateForwardAuth(host string, cfg ForwardAuthConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.URL == "" {
+		return fmt.Errorf("route %s: forward auth URL is required", host)
+	}
+
+	if cfg.Timeout <= 0 {
+		return fmt.Errorf("route %s: forward auth timeout must be positive", host)
+	}
+
+	if cfg.CacheTTL < 0 {
+		return fmt.Errorf("route %s: forward auth cache TTL must not be negative", host)
+	}
+
+	if cfg.CacheTTL > 0 && len(cfg.CacheKeyHeaders) == 0 {
+		return fmt.Errorf("route %s: forward auth cache requires at least one cache key header", host)
+	}
+
+	return nil
+}
+
+// BasicAuthConfig contains HTTP Basic authentication configuration for a route.
+// Credentials are read from an htpasswd file with bcrypt or argon2 hashes.
+type BasicAuthConfig struct {
+	Enabled         bool          `mapstructure:"enabled" default:"false"`
+	Realm           string        `mapstructure:"realm" default:"Restricted"`
+	HTPasswdFile    string        `mapstructure:"htpasswd_file"`
+	UserHeader      string        `mapstructure:"user_header" default:"X-Auth-Request-User"`
+	MaxFailures     int           `mapstructure:"max_failures" default:"10"`
+	FailureInterval time.Duration `mapstructure:"failure_interval" default:"1m"`
+}
+
+// APIKeyConfig contains API key authentication configuration for a route.
+// Keys are stored hashed in a file of "name:sha256:<hex>" lines.
+type APIKeyConfig struct {
+	Enabled         bool          `mapstructure:"enabled" default:"false"`
+	Realm           string        `mapstructure:"realm" default:"Restricted"`
+	KeysFile        string        `mapstructure:"keys_file"`
+	Header          string        `mapstructure:"header" default:"X-API-Key"`
+	QueryParam      string        `mapstructure:"query_param"`
+	UserHeader      string        `mapstructure:"user_header" default:"X-Auth-Request-User"`
+	MaxFailures     int           `mapstructure:"max_failures" default:"10"`
+	FailureInterval time.Duration `mapstructure:"failure_interval" default:"1m"`
+}
+
+// validateBasicAuth validates the basic auth configuration of a single route.
+func validateBasicAuth(host string, cfg BasicAuthConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.HTPasswdFile == "" {
+		return fmt.Errorf("route %s: basic auth htpasswd file is required", host)
+	}
+
+	if cfg.MaxFailures < 0 || cfg.FailureInterval < 0 {
+		return fmt.Errorf("route %s: basic auth failure limits must not be negative", host)
+	}
+
+	return nil
+}
+
+// validateAPIKey validates the API key configuration of a single route.
+func validateAPIKey(host string, cfg APIKeyConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.KeysFile == "" {
+		return fmt.Errorf("route %s: API keys file is required", host)
+	}
+
+	if cfg.MaxFailures < 0 || cfg.FailureInterval < 0 {
+		return fmt.Errorf("route %s: API key failure limits must not be negative", host)
+	}
+
+	return nil
+}
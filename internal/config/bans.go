@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Offense events that can lead to a ban.
+const (
+	BanEventRateLimit   = "rate_limit"
+	BanEventAuthFailure = "auth_failure"
+	BanEventWAF         = "waf"
+)
+
+// BanConfig contains automatic temporary banning of abusive clients. Offense
+// events are counted per client IP over a window; reaching a rule's
+// threshold bans the client. Repeat bans within the escalation window are
+// multiplied up to the maximum ban time. The admin API is served only for
+// requests to AdminHost, so it is not reachable through proxied sites.
+type BanConfig struct {
+	Enabled          bool          `mapstructure:"enabled" default:"false"`
+	BanTime          time.Duration `mapstructure:"ban_time" default:"10m"`
+	MaxBanTime       time.Duration `mapstructure:"max_ban_time" default:"24h"`
+	Multiplier       float64       `mapstructure:"multiplier" default:"2"`
+	EscalationWindow time.Duration `mapstructure:"escalation_window" default:"24h"`
+	Allowlist        []string      `mapstructure:"allowlist"`
+	PersistPath      string        `mapstructure:"persist_path"`
+	AdminPath        string        `mapstructure:"admin_path"`
+	AdminHost        string        `mapstructure:"admin_host"`
+	AdminToken       string        `mapstructure:"admin_token"`
+	Rules            []BanRule     `mapstructure:"rules"`
+}
+
+// BanRule bans a client after Threshold events of one type within Window.
+type BanRule struct {
+	Event     string        `mapstructure:"event"`
+	Threshold int           `mapstructure:"threshold"`
+	Window    time.Duration `mapstructure:"window"`
+}
+
+// validateBans validates the ban manager configuration.
+func validateBans(cfg BanConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.BanTime <= 0 || cfg.MaxBanTime < cfg.BanTime {
+		return fmt.Errorf("ban times require 0 < ban_time <= max_ban_time")
+	}
+
+	if cfg.Multiplier < 1 {
+		return fmt.Errorf("ban multiplier must be at least 1")
+	}
+
+	if cfg.EscalationWindow < 0 {
+		return fmt.Errorf("ban escalation window cannot be negative")
+	}
+
+	for _, entry := range cfg.Allowlist {
+		if !isValidCIDROrIP(entry) {
+			return fmt.Errorf("invalid ban allowlist entry %q", entry)
+		}
+	}
+
+	if cfg.AdminPath != "" {
+		if !strings.HasPrefix(cfg.AdminPath, "/") {
+			return fmt.Errorf("ban admin path must start with /")
+		}
+		if cfg.AdminHost == "" {
+			return fmt.Errorf("ban admin host is required when the admin path is set")
+		}
+		if cfg.AdminToken == "" {
+			return fmt.Errorf("ban admin token is required when the admin path is set")
+		}
+	}
+
+	for i, rule := range cfg.Rules {
+		switch rule.Event {
+		case BanEventRateLimit, BanEventAuthFailure, BanEventWAF:
+		default:
+			return fmt.Errorf("ban rule %d event must be rate_limit, auth_failure or waf", i)
+		}
+		if rule.Threshold <= 0 || rule.Window <= 0 {
+			return fmt.Errorf("ban rule %d requires a positive threshold and window", i)
+		}
+	}
+
+	return nil
+}
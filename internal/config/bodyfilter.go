@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"mime"
+	"regexp"
+)
+
+// BodyFilterConfig contains streaming substitutions applied to response
+// bodies of the listed content types, for backends that hardcode absolute
+// URLs. gzip, zstd and br bodies are decoded and encoded again; with
+// HTMLAttributes, substitutions in HTML only apply to href, src and action
+// attribute values. MaxMatchSize bounds the bytes buffered per
+// substitution and defaults to 4096.
+type BodyFilterConfig struct {
+	Enabled        bool                     `mapstructure:"enabled" default:"false"`
+	ContentTypes   []string                 `mapstructure:"content_types"`
+	Substitutions  []BodyFilterSubstitution `mapstructure:"substitutions"`
+	HTMLAttributes bool                     `mapstructure:"html_attributes" default:"false"`
+	MaxMatchSize   int                      `mapstructure:"max_match_size"`
+}
+
+// BodyFilterSubstitution replaces Pattern with Replacement. Regex patterns
+// may reference submatches as $1.
+type BodyFilterSubstitution struct {
+	Pattern     string `mapstructure:"pattern"`
+	Replacement string `mapstructure:"replacement"`
+	Regex       bool   `mapstructure:"regex" default:"false"`
+}
+
+// validateBodyFilter validates the response body filter of a single route.
+func validateBodyFilter(host string, cfg BodyFilterConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if len(cfg.Substitutions) == 0 {
+		return fmt.Errorf("route %s: body filter requires at least one substitution", host)
+	}
+
+	if cfg.MaxMatchSize < 0 {
+		return fmt.Errorf("route %s: body filter max match size must not be negative", host)
+	}
+
+	for _, contentType := range cfg.ContentTypes {
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return fmt.Errorf("route %s: invalid body filter content type %q", host, contentType)
+		}
+	}
+
+	for i, sub := range cfg.Substitutions {
+		if sub.Pattern == "" {
+			return fmt.Errorf("route %s: body filter substitution %d has an empty pattern", host, i)
+		}
+		if sub.Regex {
+			if _, err := regexp.Compile(sub.Pattern); err != nil {
+				return fmt.Errorf("route %s: body filter substitution %d: %w", host, i, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CacheConfig contains the shared HTTP response cache. Responses are kept
+// in memory up to MaxBytes; entries evicted from memory move to the disk
+// tier when DiskPath is set. Caching is enabled per route. The purge API is
+// served only for requests to PurgeHost, so it is not reachable through
+// proxied sites.
+type CacheConfig struct {
+	Enabled      bool   `mapstructure:"enabled" default:"false"`
+	MaxBytes     int64  `mapstructure:"max_bytes" default:"268435456"`
+	MaxEntrySize int64  `mapstructure:"max_entry_size" default:"8388608"`
+	DiskPath     string `mapstructure:"disk_path"`
+	DiskMaxBytes int64  `mapstructure:"disk_max_bytes" default:"1073741824"`
+	PurgePath    string `mapstructure:"purge_path"`
+	PurgeHost    string `mapstructure:"purge_host"`
+	PurgeToken   string `mapstructure:"purge_token"`
+}
+
+// RouteCacheConfig contains the caching policy of a route. TTL overrides
+// the freshness lifetime of every stored response; DefaultTTL applies only
+// to responses without explicit freshness. The stale durations apply when
+// the response does not set its own stale-while-revalidate or
+// stale-if-error directives.
+type RouteCacheConfig struct {
+	Enabled              bool          `mapstructure:"enabled" default:"false"`
+	TTL                  time.Duration `mapstructure:"ttl" default:"0"`
+	DefaultTTL           time.Duration `mapstructure:"default_ttl" default:"0"`
+	StaleWhileRevalidate time.Duration `mapstructure:"stale_while_revalidate" default:"0"`
+	StaleIfError         time.Duration `mapstructure:"stale_if_error" default:"0"`
+}
+
+// validateCache validates the shared cache configuration and that routes
+// only enable caching when the cache exists.
+func validateCache(cfg CacheConfig, routes map[string]BackendRoute) error {
+	if !cfg.Enabled {
+		for host, route := range routes {
+			if route.Cache.Enabled {
+				return fmt.Errorf("route %s: caching requires the shared cache to be enabled", host)
+			}
+		}
+		return nil
+	}
+
+	if cfg.MaxBytes <= 0 {
+		return fmt.Errorf("cache max bytes must be positive")
+	}
+
+	if cfg.MaxEntrySize <= 0 || cfg.MaxEntrySize > cfg.MaxBytes {
+		return fmt.Errorf("cache max entry size must be positive and at most max bytes")
+	}
+
+	if cfg.DiskPath != "" && cfg.DiskMaxBytes < cfg.MaxEntrySize {
+		return fmt.Errorf("cache disk max bytes must be at least the max entry size")
+	}
+
+	if cfg.PurgePath != "" {
+		if !strings.HasPrefix(cfg.PurgePath, "/") {
+			return fmt.Errorf("cache purge path must start with /")
+		}
+		if cfg.PurgeHost == "" {
+			return fmt.Errorf("cache purge host is required when the purge path is set")
+		}
+		if cfg.PurgeToken == "" {
+			return fmt.Errorf("cache purge token is required when the purge path is set")
+		}
+	}
+
+	return nil
+}
+
+// validateRouteCache validates the caching policy of a single route.
+func validateRouteCache(host string, cfg RouteCacheConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.TTL < 0 || cfg.DefaultTTL < 0 || cfg.StaleWhileRevalidate < 0 || cfg.StaleIfError < 0 {
+		return fmt.Errorf("route %s: cache durations cannot be negative", host)
+	}
+
+	return nil
+}
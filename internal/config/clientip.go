@@ -0,0 +1,33 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ClientIPConfig controls how the client address is resolved behind reverse
+// proxies. Forwarding headers are only trusted when the connecting peer is
+// one of the trusted proxies, and are walked right-to-left until the first
+// untrusted hop.
+type ClientIPConfig struct {
+	TrustedProxies           []string `mapstructure:"trusted_proxies"`
+	Header                   string   `mapstructure:"header" default:"X-Forwarded-For"`
+	PreserveForwardedHeaders bool     `mapstructure:"preserve_forwarded_headers" default:"false"`
+}
+
+// validateClientIP validates the client IP resolution configuration.
+func validateClientIP(cfg ClientIPConfig) error {
+	switch http.CanonicalHeaderKey(cfg.Header) {
+	case "", "X-Forwarded-For", "Forwarded":
+	default:
+		return fmt.Errorf("client IP header must be X-Forwarded-For or Forwarded")
+	}
+
+	for _, proxy := range cfg.TrustedProxies {
+		if !isValidCIDROrIP(proxy) {
+			return fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+	}
+
+	return nil
+}
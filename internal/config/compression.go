@@ -0,0 +1,50 @@
+package config
+
+import "fmt"
+
+// CompressionConfig contains response compression settings for a route.
+// Eligible responses are compressed with the first of the configured
+// encodings that the client accepts, preferring the client's weights. Zero
+// levels and sizes select the defaults.
+type CompressionConfig struct {
+	Enabled      bool     `mapstructure:"enabled" default:"false"`
+	Encodings    []string `mapstructure:"encodings"` // zstd, br, gzip
+	GzipLevel    int      `mapstructure:"gzip_level" default:"6"`
+	ZstdLevel    int      `mapstructure:"zstd_level" default:"2"`
+	BrotliLevel  int      `mapstructure:"brotli_level" default:"4"`
+	MinSize      int      `mapstructure:"min_size" default:"1024"`
+	ContentTypes []string `mapstructure:"content_types"`
+}
+
+// validateCompression validates the compression configuration of a single route.
+func validateCompression(host string, cfg CompressionConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	for _, encoding := range cfg.Encodings {
+		switch encoding {
+		case "gzip", "zstd", "br":
+		default:
+			return fmt.Errorf("route %s: unknown compression encoding %q", host, encoding)
+		}
+	}
+
+	if cfg.GzipLevel < 0 || cfg.GzipLevel > 9 {
+		return fmt.Errorf("route %s: gzip level must be between 1 and 9", host)
+	}
+
+	if cfg.ZstdLevel < 0 || cfg.ZstdLevel > 4 {
+		return fmt.Errorf("route %s: zstd level must be between 1 and 4", host)
+	}
+
+	if cfg.BrotliLevel < 0 || cfg.BrotliLevel > 11 {
+		return fmt.Errorf("route %s: brotli level must be between 1 and 11", host)
+	}
+
+	if cfg.MinSize < 0 {
+		return fmt.Errorf("route %s: compression minimum size cannot be negative", host)
+	}
+
+	return nil
+}
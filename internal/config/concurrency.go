@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ConcurrencyConfig caps in-flight requests to a backend with an adaptive
+// limit. Requests over the limit wait in a bounded priority queue and are
+// shed with 503 when it is full or their queue timeout expires. Zero
+// limits, ratios and queue timeouts select the defaults; an unset queue
+// size selects the default, while a queue size of 0 sheds instead of
+// queueing.
+type ConcurrencyConfig struct {
+	Enabled          bool                      `mapstructure:"enabled" default:"false"`
+	Algorithm        string                    `mapstructure:"algorithm" default:"gradient"`
+	InitialLimit     int                       `mapstructure:"initial_limit" default:"20"`
+	MinLimit         int                       `mapstructure:"min_limit" default:"1"`
+	MaxLimit         int                       `mapstructure:"max_limit" default:"200"`
+	LatencyThreshold time.Duration             `mapstructure:"latency_threshold" default:"1s"`
+	BackoffRatio     float64                   `mapstructure:"backoff_ratio" default:"0.9"`
+	QueueSize        *int                      `mapstructure:"queue_size" default:"100"`
+	QueueTimeout     time.Duration             `mapstructure:"queue_timeout" default:"1s"`
+	RetryAfter       time.Duration             `mapstructure:"retry_after" default:"1s"`
+	DefaultPriority  int                       `mapstructure:"default_priority" default:"0"`
+	Priorities       []ConcurrencyPriorityRule `mapstructure:"priorities"`
+}
+
+// ConcurrencyPriorityRule assigns a queue priority to matching requests.
+// A rule matches when the path has the prefix and the header has the value;
+// an empty value matches any present header. Higher priorities go first.
+type ConcurrencyPriorityRule struct {
+	PathPrefix string `mapstructure:"path_prefix"`
+	Header     string `mapstructure:"header"`
+	Value      string `mapstructure:"value"`
+	Priority   int    `mapstructure:"priority"`
+}
+
+// validateConcurrency validates the concurrency limit configuration of a single route.
+func validateConcurrency(host string, cfg ConcurrencyConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.Algorithm != "" && cfg.Algorithm != "aimd" && cfg.Algorithm != "gradient" {
+		return fmt.Errorf("route %s: concurrency algorithm must be aimd or gradient", host)
+	}
+
+	if cfg.MinLimit < 0 || cfg.MaxLimit < 0 || cfg.InitialLimit < 0 {
+		return fmt.Errorf("route %s: concurrency limits cannot be negative", host)
+	}
+
+	if cfg.MinLimit > 0 && cfg.MaxLimit > 0 && cfg.MaxLimit < cfg.MinLimit {
+		return fmt.Errorf("route %s: concurrency limits require min_limit <= max_limit", host)
+	}
+
+	if cfg.InitialLimit > 0 &&
+		((cfg.MinLimit > 0 && cfg.InitialLimit < cfg.MinLimit) || (cfg.MaxLimit > 0 && cfg.InitialLimit > cfg.MaxLimit)) {
+		return fmt.Errorf("route %s: concurrency initial limit must be between min_limit and max_limit", host)
+	}
+
+	// Only AIMD backs off by a ratio.
+	if cfg.Algorithm == "aimd" && (cfg.BackoffRatio < 0 || cfg.BackoffRatio >= 1) {
+		return fmt.Errorf("route %s: concurrency backoff ratio must be between 0 and 1", host)
+	}
+
+	if (cfg.QueueSize != nil && *cfg.QueueSize < 0) || cfg.QueueTimeout < 0 {
+		return fmt.Errorf("route %s: concurrency queue size and timeout cannot be negative", host)
+	}
+
+	for i, rule := range cfg.Priorities {
+		if rule.PathPrefix == "" && rule.Header == "" {
+			return fmt.Errorf("route %s: concurrency priority rule %d must match a path prefix or header", host, i)
+		}
+		if rule.PathPrefix != "" && !strings.HasPrefix(rule.PathPrefix, "/") {
+			return fmt.Errorf("route %s: concurrency priority rule %d path prefix must start with /", host, i)
+		}
+	}
+
+	return nil
+}
@@ -19,17 +19,21 @@ type Config struct {
 	Metrics   MetricsConfig   `mapstructure:"metrics"`
 	Health    HealthConfig    `mapstructure:"health"`
 	RateLimit RateLimitConfig `mapstructure:"ratelimit"`
+	Cache     CacheConfig     `mapstructure:"cache"`
 }
 
 // ServerConfig contains HTTP/HTTPS server configuration.
 type ServerConfig struct {
-	Host            string        `mapstructure:"host" default:"0.0.0.0"`
-	Port            int           `mapstructure:"port" default:"8080" validate:"min=1,max=65535"`
-	HTTPSPort       int           `mapstructure:"https_port" default:"8443" validate:"min=1,max=65535"`
-	ReadTimeout     time.Duration `mapstructure:"read_timeout" default:"30s"`
-	WriteTimeout    time.Duration `mapstructure:"write_timeout" default:"30s"`
-	IdleTimeout     time.Duration `mapstructure:"idle_timeout" default:"60s"`
-	GracefulTimeout time.Duration `mapstructure:"graceful_timeout" default:"30s"`
+	Host              string              `mapstructure:"host" default:"0.0.0.0"`
+	Port              int                 `mapstructure:"port" default:"8080" validate:"min=1,max=65535"`
+	HTTPSPort         int                 `mapstructure:"https_port" default:"8443" validate:"min=1,max=65535"`
+	ReadTimeout       time.Duration       `mapstructure:"read_timeout" default:"30s"`
+	ReadHeaderTimeout time.Duration       `mapstructure:"read_header_timeout" default:"10s"`
+	WriteTimeout      time.Duration       `mapstructure:"write_timeout" default:"30s"`
+	IdleTimeout       time.Duration       `mapstructure:"idle_timeout" default:"60s"`
+	GracefulTimeout   time.Duration       `mapstructure:"graceful_timeout" default:"30s"`
+	ProxyProtocol     ProxyProtocolConfig `mapstructure:"proxy_protocol"`
+	StrictHTTP        StrictHTTPConfig    `mapstructure:"strict_http"`
 }
 
 // TLSConfig contains TLS certificate management configuration.
@@ -50,21 +54,47 @@ type BackendsConfig struct {
 
 // BackendRoute defines configuration for a single backend service.
 type BackendRoute struct {
-	URL            string        `mapstructure:"url" validate:"required,url"`
-	HealthPath     string        `mapstructure:"health_path" default:"/health"`
-	HealthInterval time.Duration `mapstructure:"health_interval" default:"30s"`
-	Timeout        time.Duration `mapstructure:"timeout" default:"30s"`
-	MaxIdleConns   int           `mapstructure:"max_idle_conns" default:"100"`
-	MaxIdlePerHost int           `mapstructure:"max_idle_per_host" default:"10"`
-	DialTimeout    time.Duration `mapstructure:"dial_timeout" default:"10s"`
+	URL            string               `mapstructure:"url" validate:"required,url"`
+	HealthPath     string               `mapstructure:"health_path" default:"/health"`
+	HealthInterval time.Duration        `mapstructure:"health_interval" default:"30s"`
+	Timeout        time.Duration        `mapstructure:"timeout" default:"30s"`
+	MaxIdleConns   int                  `mapstructure:"max_idle_conns" default:"100"`
+	MaxIdlePerHost int                  `mapstructure:"max_idle_per_host" default:"10"`
+	DialTimeout    time.Duration        `mapstructure:"dial_timeout" default:"10s"`
+	OIDC           OIDCConfig           `mapstructure:"oidc"`
+	ForwardAuth    ForwardAuthConfig    `mapstructure:"forward_auth"`
+	BasicAuth      BasicAuthConfig      `mapstructure:"basic_auth"`
+	APIKey         APIKeyConfig         `mapstructure:"api_key"`
+	AccessControl  AccessControlConfig  `mapstructure:"access_control"`
+	ProxyProtocol  string               `mapstructure:"proxy_protocol"`
+	RateLimit      RouteRateLimitConfig `mapstructure:"rate_limit"`
+	Concurrency    ConcurrencyConfig    `mapstructure:"concurrency"`
+	WAF            WAFConfig            `mapstructure:"waf"`
+	CSRF           CSRFConfig           `mapstructure:"csrf"`
+	CSP            CSPConfig            `mapstructure:"csp"`
+	HeaderProfile  string               `mapstructure:"header_profile"`
+	CORS           CORSConfig           `mapstructure:"cors"`
+	Webhook        WebhookConfig        `mapstructure:"webhook"`
+	OpenAPI        OpenAPIConfig        `mapstructure:"openapi"`
+	Limits         RequestLimitsConfig  `mapstructure:"limits"`
+	ErrorPages     map[string]string    `mapstructure:"error_pages"`
+	Compression    CompressionConfig    `mapstructure:"compression"`
+	Cache          RouteCacheConfig     `mapstructure:"cache"`
+	Headers        HeaderRulesConfig    `mapstructure:"headers"`
+	Rewrite        RewriteConfig        `mapstructure:"rewrite"`
+	BodyFilter     BodyFilterConfig     `mapstructure:"body_filter"`
 }
 
 // SecurityConfig contains security-related configuration.
 type SecurityConfig struct {
-	Headers          SecurityHeaders `mapstructure:"headers"`
-	RateLimitEnabled bool            `mapstructure:"rate_limit_enabled" default:"true"`
-	CORSEnabled      bool            `mapstructure:"cors_enabled" default:"true"`
-	CORSOrigins      []string        `mapstructure:"cors_origins" default:"*"`
+	Headers          SecurityHeaders                `mapstructure:"headers"`
+	RateLimitEnabled bool                           `mapstructure:"rate_limit_enabled" default:"true"`
+	CORSEnabled      bool                           `mapstructure:"cors_enabled" default:"true"`
+	CORSOrigins      []string                       `mapstructure:"cors_origins" default:"*"`
+	ClientIP         ClientIPConfig                 `mapstructure:"client_ip"`
+	Bans             BanConfig                      `mapstructure:"bans"`
+	CSPReports       CSPReportConfig                `mapstructure:"csp_reports"`
+	HeaderProfiles   map[string]HeaderProfileConfig `mapstructure:"header_profiles"`
 }
 
 // SecurityHeaders defines HTTP security headers configuration.
@@ -74,6 +104,13 @@ type SecurityHeaders struct {
 	ContentSecurityPolicy   string `mapstructure:"content_security_policy" default:"default-src 'self'"`
 	StrictTransportSecurity string `mapstructure:"strict_transport_security" default:"max-age=31536000; includeSubDomains"`
 	ReferrerPolicy          string `mapstructure:"referrer_policy" default:"strict-origin-when-cross-origin"`
+
+	// PermissionsPolicy and the cross-origin isolation policies replace
+	// the built-in global values when set.
+	PermissionsPolicy         string `mapstructure:"permissions_policy"`
+	CrossOriginOpenerPolicy   string `mapstructure:"cross_origin_opener_policy"`
+	CrossOriginEmbedderPolicy string `mapstructure:"cross_origin_embedder_policy"`
+	CrossOriginResourcePolicy string `mapstructure:"cross_origin_resource_policy"`
 }
 
 // LoggingConfig contains logging configuration.
@@ -105,6 +142,13 @@ type RateLimitConfig struct {
 	RequestsPerSecond float64       `mapstructure:"requests_per_second" default:"100"`
 	BurstSize         int           `mapstructure:"burst_size" default:"200"`
 	CleanupInterval   time.Duration `mapstructure:"cleanup_interval" default:"10m"`
+	Backend           string        `mapstructure:"backend" default:"memory"`
+	Algorithm         string        `mapstructure:"algorithm" default:"gcra"`
+	Window            time.Duration `mapstructure:"window" default:"1m"`
+	FailureMode       string        `mapstructure:"failure_mode" default:"local"`
+	Redis             RedisConfig   `mapstructure:"redis"`
+
+	Policies map[string]RateLimitPolicyConfig `mapstructure:"policies"`
 }
 
 // GetCAEndpoint returns the appropriate ACME CA endpoint based on staging configuration.
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/albedosehen/rwwwrse/internal/headers"
+)
+
+// Route CORS modes.
+const (
+	CORSModeGlobal      = "global"
+	CORSModePolicy      = "policy"
+	CORSModePassthrough = "passthrough"
+)
+
+// CORSConfig contains the CORS handling of a route. In global mode the
+// global CORS middleware applies; policy mode replaces it with the route's
+// own policy; passthrough leaves CORS entirely to the backend.
+type CORSConfig struct {
+	Mode                  string        `mapstructure:"mode" default:"global"`
+	AllowedOrigins        []string      `mapstructure:"allowed_origins"`
+	AllowedOriginPatterns []string      `mapstructure:"allowed_origin_patterns"`
+	AllowedMethods        []string      `mapstructure:"allowed_methods"`
+	AllowedHeaders        []string      `mapstructure:"allowed_headers"`
+	ExposedHeaders        []string      `mapstructure:"exposed_headers"`
+	AllowCredentials      bool          `mapstructure:"allow_credentials" default:"false"`
+	MaxAge                time.Duration `mapstructure:"max_age" default:"12h"`
+	OptionsPassthrough    bool          `mapstructure:"options_passthrough" default:"false"`
+}
+
+// validateCORS validates the CORS configuration of a single route.
+func validateCORS(host string, cfg CORSConfig) error {
+	switch cfg.Mode {
+	case "", CORSModeGlobal, CORSModePassthrough:
+		return nil
+	case CORSModePolicy:
+	default:
+		return fmt.Errorf("route %s: CORS mode must be global, policy or passthrough", host)
+	}
+
+	err := headers.ValidateCORSPolicy(headers.CORSPolicy{
+		AllowedOrigins:        cfg.AllowedOrigins,
+		AllowedOriginPatterns: cfg.AllowedOriginPatterns,
+		AllowedMethods:        cfg.AllowedMethods,
+		AllowedHeaders:        cfg.AllowedHeaders,
+		ExposedHeaders:        cfg.ExposedHeaders,
+		AllowCredentials:      cfg.AllowCredentials,
+		MaxAge:                cfg.MaxAge,
+	})
+	if err != nil {
+		return fmt.Errorf("route %s: CORS policy: %w", host, err)
+	}
+
+	return nil
+}
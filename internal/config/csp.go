@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// CSPConfig contains the Content-Security-Policy of a route. It replaces
+// the global policy for the route. With nonces enabled every occurrence of
+// the placeholder in the policy and in HTML response bodies is replaced by
+// a fresh per-request nonce.
+type CSPConfig struct {
+	Enabled          bool   `mapstructure:"enabled" default:"false"`
+	Policy           string `mapstructure:"policy"`
+	ReportOnly       bool   `mapstructure:"report_only" default:"false"`
+	Nonce            bool   `mapstructure:"nonce" default:"false"`
+	NoncePlaceholder string `mapstructure:"nonce_placeholder" default:"__CSP_NONCE__"`
+	Report           bool   `mapstructure:"report" default:"false"`
+}
+
+// CSPReportConfig contains the built-in endpoint collecting CSP and
+// Reporting API violation reports. Identical reports are logged once per
+// dedupe window.
+type CSPReportConfig struct {
+	Enabled      bool          `mapstructure:"enabled" default:"false"`
+	Path         string        `mapstructure:"path" default:"/_rwwwrse/csp-report"`
+	DedupeWindow time.Duration `mapstructure:"dedupe_window" default:"10m"`
+	MaxBodySize  int64         `mapstructure:"max_body_size" default:"65536"`
+}
+
+// validateCSPReports validates the violation report endpoint configuration.
+func validateCSPReports(cfg CSPReportConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if !strings.HasPrefix(cfg.Path, "/") {
+		return fmt.Errorf("CSP report path must start with /")
+	}
+
+	if cfg.DedupeWindow < 0 {
+		return fmt.Errorf("CSP report dedupe window cannot be negative")
+	}
+
+	if cfg.MaxBodySize <= 0 {
+		return fmt.Errorf("CSP report max body size must be positive")
+	}
+
+	return nil
+}
+
+// validateCSP validates the Content-Security-Policy of a single route.
+func validateCSP(host string, cfg CSPConfig, reports CSPReportConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if strings.TrimSpace(cfg.Policy) == "" {
+		return fmt.Errorf("route %s: CSP policy is required", host)
+	}
+
+	if cfg.Nonce {
+		if cfg.NoncePlaceholder == "" {
+			return fmt.Errorf("route %s: CSP nonce placeholder is required", host)
+		}
+		if !strings.Contains(cfg.Policy, cfg.NoncePlaceholder) {
+			return fmt.Errorf("route %s: CSP policy must contain the nonce placeholder %q", host, cfg.NoncePlaceholder)
+		}
+	}
+
+	if cfg.Report && !reports.Enabled {
+		return fmt.Errorf("route %s: CSP reporting requires security.csp_reports to be enabled", host)
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// CSRFConfig contains cross-site request forgery protection for a route.
+// Unsafe requests must come from the route's own origin or a trusted origin,
+// judged by Sec-Fetch-Site and then Origin or Referer. The double_submit
+// mode additionally requires a token matching the CSRF cookie.
+type CSRFConfig struct {
+	Enabled        bool     `mapstructure:"enabled" default:"false"`
+	Mode           string   `mapstructure:"mode" default:"origin"`
+	TrustedOrigins []string `mapstructure:"trusted_origins"`
+	ExemptPaths    []string `mapstructure:"exempt_paths"`
+	CookieName     string   `mapstructure:"cookie_name" default:"_rwwwrse_csrf"`
+	CookieDomain   string   `mapstructure:"cookie_domain"`
+	CookieSecure   *bool    `mapstructure:"cookie_secure" default:"true"`
+	HeaderName     string   `mapstructure:"header_name" default:"X-CSRF-Token"`
+	FormField      string   `mapstructure:"form_field" default:"csrf_token"`
+}
+
+// validateCSRF validates the CSRF protection configuration of a single route.
+func validateCSRF(host string, cfg CSRFConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.Mode != "" && cfg.Mode != "origin" && cfg.Mode != "double_submit" {
+		return fmt.Errorf("route %s: CSRF mode must be origin or double_submit", host)
+	}
+
+	for _, origin := range cfg.TrustedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("route %s: CSRF trusted origin %q must be scheme://host[:port]", host, origin)
+		}
+	}
+
+	for _, path := range cfg.ExemptPaths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("route %s: CSRF exempt path %q must start with /", host, path)
+		}
+	}
+
+	if cfg.Mode == "double_submit" && (cfg.CookieName == "" || cfg.HeaderName == "") {
+		return fmt.Errorf("route %s: CSRF double_submit mode requires a cookie name and header name", host)
+	}
+
+	return nil
+}
@@ -16,7 +16,14 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.read_timeout", "30s")
 	v.SetDefault("server.write_timeout", "30s")
 	v.SetDefault("server.idle_timeout", "60s")
+	v.SetDefault("server.read_header_timeout", "10s")
 	v.SetDefault("server.graceful_timeout", "30s")
+	v.SetDefault("server.proxy_protocol.http", false)
+	v.SetDefault("server.proxy_protocol.https", false)
+	v.SetDefault("server.proxy_protocol.header_timeout", "5s")
+	v.SetDefault("server.strict_http.enabled", false)
+	v.SetDefault("server.strict_http.dot_segments", "reject")
+	v.SetDefault("server.strict_http.encoded_slashes", "reject")
 
 	// TLS defaults
 	v.SetDefault("tls.enabled", true)
@@ -29,6 +36,20 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("security.rate_limit_enabled", true)
 	v.SetDefault("security.cors_enabled", true)
 	v.SetDefault("security.cors_origins", []string{"*"})
+	v.SetDefault("security.client_ip.trusted_proxies", []string{})
+	v.SetDefault("security.client_ip.header", "X-Forwarded-For")
+	v.SetDefault("security.client_ip.preserve_forwarded_headers", false)
+	v.SetDefault("security.bans.enabled", false)
+	v.SetDefault("security.bans.ban_time", "10m")
+	v.SetDefault("security.bans.max_ban_time", "24h")
+	v.SetDefault("security.bans.multiplier", 2.0)
+	v.SetDefault("security.bans.escalation_window", "24h")
+
+	// CSP violation report defaults
+	v.SetDefault("security.csp_reports.enabled", false)
+	v.SetDefault("security.csp_reports.path", "/_rwwwrse/csp-report")
+	v.SetDefault("security.csp_reports.dedupe_window", "10m")
+	v.SetDefault("security.csp_reports.max_body_size", 65536)
 
 	// Security headers defaults
 	v.SetDefault("security.headers.content_type_nosniff", true)
@@ -59,6 +80,19 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("ratelimit.requests_per_second", 100.0)
 	v.SetDefault("ratelimit.burst_size", 200)
 	v.SetDefault("ratelimit.cleanup_interval", "10m")
+	v.SetDefault("ratelimit.backend", "memory")
+	v.SetDefault("ratelimit.algorithm", "gcra")
+	v.SetDefault("ratelimit.window", "1m")
+	v.SetDefault("ratelimit.failure_mode", "local")
+	v.SetDefault("ratelimit.redis.address", "localhost:6379")
+	v.SetDefault("ratelimit.redis.username", "")
+	v.SetDefault("ratelimit.redis.password", "")
+	v.SetDefault("ratelimit.redis.db", 0)
+	v.SetDefault("ratelimit.redis.tls", false)
+	v.SetDefault("ratelimit.redis.key_prefix", "rwwwrse:ratelimit:")
+	v.SetDefault("ratelimit.redis.dial_timeout", "2s")
+	v.SetDefault("ratelimit.redis.timeout", "100ms")
+	v.SetDefault("ratelimit.redis.pool_size", 16)
 
 	// Backend route defaults (applied to each backend)
 	setBackendDefaults(v)
@@ -73,6 +107,134 @@ func setBackendDefaults(v *viper.Viper) {
 	v.SetDefault("backends.routes.*.max_idle_conns", 100)
 	v.SetDefault("backends.routes.*.max_idle_per_host", 10)
 	v.SetDefault("backends.routes.*.dial_timeout", "10s")
+
+	// OIDC defaults
+	v.SetDefault("backends.routes.*.oidc.enabled", false)
+	v.SetDefault("backends.routes.*.oidc.callback_path", "/oauth2/callback")
+	v.SetDefault("backends.routes.*.oidc.logout_path", "/oauth2/logout")
+	v.SetDefault("backends.routes.*.oidc.cookie_name", "_rwwwrse_oidc")
+	v.SetDefault("backends.routes.*.oidc.cookie_secure", true)
+	v.SetDefault("backends.routes.*.oidc.session_ttl", "24h")
+	v.SetDefault("backends.routes.*.oidc.groups_claim", "groups")
+
+	// Forward auth defaults
+	v.SetDefault("backends.routes.*.forward_auth.enabled", false)
+	v.SetDefault("backends.routes.*.forward_auth.timeout", "5s")
+	v.SetDefault("backends.routes.*.forward_auth.cache_ttl", "0s")
+
+	// Basic auth and API key defaults
+	v.SetDefault("backends.routes.*.basic_auth.enabled", false)
+	v.SetDefault("backends.routes.*.basic_auth.realm", "Restricted")
+	v.SetDefault("backends.routes.*.basic_auth.user_header", "X-Auth-Request-User")
+	v.SetDefault("backends.routes.*.basic_auth.max_failures", 10)
+	v.SetDefault("backends.routes.*.basic_auth.failure_interval", "1m")
+	v.SetDefault("backends.routes.*.api_key.enabled", false)
+	v.SetDefault("backends.routes.*.api_key.realm", "Restricted")
+	v.SetDefault("backends.routes.*.api_key.header", "X-API-Key")
+	v.SetDefault("backends.routes.*.api_key.user_header", "X-Auth-Request-User")
+	v.SetDefault("backends.routes.*.api_key.max_failures", 10)
+	v.SetDefault("backends.routes.*.api_key.failure_interval", "1m")
+
+	// Access control defaults
+	v.SetDefault("backends.routes.*.access_control.enabled", false)
+	v.SetDefault("backends.routes.*.access_control.default_action", "allow")
+
+	// Backend PROXY protocol defaults
+	v.SetDefault("backends.routes.*.proxy_protocol", "")
+
+	// Backend rate limit policy defaults
+	v.SetDefault("backends.routes.*.rate_limit.policy", "")
+
+	// Backend concurrency limit defaults
+	v.SetDefault("backends.routes.*.concurrency.enabled", false)
+	v.SetDefault("backends.routes.*.concurrency.algorithm", "gradient")
+	v.SetDefault("backends.routes.*.concurrency.initial_limit", 20)
+	v.SetDefault("backends.routes.*.concurrency.min_limit", 1)
+	v.SetDefault("backends.routes.*.concurrency.max_limit", 200)
+	v.SetDefault("backends.routes.*.concurrency.latency_threshold", "1s")
+	v.SetDefault("backends.routes.*.concurrency.backoff_ratio", 0.9)
+	v.SetDefault("backends.routes.*.concurrency.queue_size", 100)
+	v.SetDefault("backends.routes.*.concurrency.queue_timeout", "1s")
+	v.SetDefault("backends.routes.*.concurrency.retry_after", "1s")
+	v.SetDefault("backends.routes.*.concurrency.default_priority", 0)
+
+	// Backend web application firewall defaults
+	v.SetDefault("backends.routes.*.waf.enabled", false)
+	v.SetDefault("backends.routes.*.waf.mode", "blocking")
+	v.SetDefault("backends.routes.*.waf.core_rules", true)
+	v.SetDefault("backends.routes.*.waf.anomaly_threshold", 5)
+	v.SetDefault("backends.routes.*.waf.body_limit", 131072)
+
+	// Backend CSRF protection defaults
+	v.SetDefault("backends.routes.*.csrf.enabled", false)
+	v.SetDefault("backends.routes.*.csrf.mode", "origin")
+	v.SetDefault("backends.routes.*.csrf.cookie_name", "_rwwwrse_csrf")
+	v.SetDefault("backends.routes.*.csrf.cookie_secure", true)
+	v.SetDefault("backends.routes.*.csrf.header_name", "X-CSRF-Token")
+	v.SetDefault("backends.routes.*.csrf.form_field", "csrf_token")
+
+	// Backend Content-Security-Policy defaults
+	v.SetDefault("backends.routes.*.csp.enabled", false)
+	v.SetDefault("backends.routes.*.csp.nonce_placeholder", "__CSP_NONCE__")
+
+	// Backend CORS defaults
+	v.SetDefault("backends.routes.*.cors.mode", "global")
+	v.SetDefault("backends.routes.*.cors.allow_credentials", false)
+	v.SetDefault("backends.routes.*.cors.max_age", "12h")
+
+	// Backend webhook signature defaults
+	v.SetDefault("backends.routes.*.webhook.enabled", false)
+	v.SetDefault("backends.routes.*.webhook.max_body_size", 1048576)
+	v.SetDefault("backends.routes.*.webhook.replay_window", "10m")
+
+	// Backend OpenAPI validation defaults
+	v.SetDefault("backends.routes.*.openapi.enabled", false)
+	v.SetDefault("backends.routes.*.openapi.mode", "enforce")
+	v.SetDefault("backends.routes.*.openapi.max_body_size", 1048576)
+	v.SetDefault("backends.routes.*.openapi.response_sample_rate", 0)
+
+	// Backend request limits defaults
+	v.SetDefault("backends.routes.*.limits.enabled", false)
+	v.SetDefault("backends.routes.*.limits.upload_grace_period", "5s")
+
+	// Backend response compression defaults
+	v.SetDefault("backends.routes.*.compression.enabled", false)
+	v.SetDefault("backends.routes.*.compression.gzip_level", 6)
+	v.SetDefault("backends.routes.*.compression.zstd_level", 2)
+	v.SetDefault("backends.routes.*.compression.brotli_level", 4)
+	v.SetDefault("backends.routes.*.compression.min_size", 1024)
+
+	// Response cache defaults
+	v.SetDefault("cache.enabled", false)
+	v.SetDefault("cache.max_bytes", 268435456)
+	v.SetDefault("cache.max_entry_size", 8388608)
+	v.SetDefault("cache.disk_max_bytes", 1073741824)
+	v.SetDefault("backends.routes.*.cache.enabled", false)
+
+	// Response rewriting defaults
+	v.SetDefault("backends.routes.*.rewrite.enabled", false)
+
+	// Response body filter defaults
+	v.SetDefault("backends.routes.*.body_filter.enabled", false)
+}
+
+// applyRouteDefaults fills per-route settings left unset in the configuration.
+// Viper cannot apply the backends.routes.* defaults to map entries, so the
+// settings validation depends on are defaulted here before validating.
+func applyRouteDefaults(cfg *Config) {
+	for host, route := range cfg.Backends.Routes {
+		if route.WAF.CoreRules == nil {
+			coreRules := true
+			route.WAF.CoreRules = &coreRules
+		}
+		if route.WAF.AnomalyThreshold == 0 {
+			route.WAF.AnomalyThreshold = 5
+		}
+		if route.WAF.BodyLimit == 0 {
+			route.WAF.BodyLimit = 131072
+		}
+		cfg.Backends.Routes[host] = route
+	}
 }
 
 // GetDefaultConfig returns a configuration object with all default values applied.
@@ -80,13 +242,21 @@ func setBackendDefaults(v *viper.Viper) {
 func GetDefaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Host:            "0.0.0.0",
-			Port:            8080,
-			HTTPSPort:       8443,
-			ReadTimeout:     30 * time.Second,
-			WriteTimeout:    30 * time.Second,
-			IdleTimeout:     60 * time.Second,
-			GracefulTimeout: 30 * time.Second,
+			Host:              "0.0.0.0",
+			Port:              8080,
+			HTTPSPort:         8443,
+			ReadTimeout:       30 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       60 * time.Second,
+			ReadHeaderTimeout: 10 * time.Second,
+			GracefulTimeout:   30 * time.Second,
+			ProxyProtocol: ProxyProtocolConfig{
+				HeaderTimeout: 5 * time.Second,
+			},
+			StrictHTTP: StrictHTTPConfig{
+				DotSegments:    "reject",
+				EncodedSlashes: "reject",
+			},
 		},
 		TLS: TLSConfig{
 			Enabled:     true,
@@ -106,6 +276,21 @@ func GetDefaultConfig() *Config {
 			RateLimitEnabled: true,
 			CORSEnabled:      true,
 			CORSOrigins:      []string{"*"},
+			ClientIP: ClientIPConfig{
+				TrustedProxies: []string{},
+				Header:         "X-Forwarded-For",
+			},
+			Bans: BanConfig{
+				BanTime:          10 * time.Minute,
+				MaxBanTime:       24 * time.Hour,
+				Multiplier:       2,
+				EscalationWindow: 24 * time.Hour,
+			},
+			CSPReports: CSPReportConfig{
+				Path:         "/_rwwwrse/csp-report",
+				DedupeWindow: 10 * time.Minute,
+				MaxBodySize:  65536,
+			},
 		},
 		Logging: LoggingConfig{
 			Level:  "info",
@@ -129,6 +314,23 @@ func GetDefaultConfig() *Config {
 			RequestsPerSecond: 100.0,
 			BurstSize:         200,
 			CleanupInterval:   10 * time.Minute,
+			Backend:           RateLimitBackendMemory,
+			Algorithm:         RateLimitAlgorithmGCRA,
+			Window:            time.Minute,
+			FailureMode:       RateLimitFailureLocal,
+			Redis: RedisConfig{
+				Address:     "localhost:6379",
+				KeyPrefix:   "rwwwrse:ratelimit:",
+				DialTimeout: 2 * time.Second,
+				Timeout:     100 * time.Millisecond,
+				PoolSize:    16,
+			},
+			Policies: make(map[string]RateLimitPolicyConfig),
+		},
+		Cache: CacheConfig{
+			MaxBytes:     256 << 20,
+			MaxEntrySize: 8 << 20,
+			DiskMaxBytes: 1 << 30,
 		},
 		Backends: BackendsConfig{
 			Routes: make(map[string]BackendRoute),
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// errorPageKeyPattern matches error page keys: a 4xx or 5xx status code
+// such as "404", or a status class such as "5xx".
+var errorPageKeyPattern = regexp.MustCompile(`^[45](\d\d|xx)$`)
+
+// validateErrorPages validates the custom error page templates of a single
+// route. Pages map status codes or classes to HTML template files.
+func validateErrorPages(host string, pages map[string]string) error {
+	for key, path := range pages {
+		if !errorPageKeyPattern.MatchString(key) {
+			return fmt.Errorf("route %s: error page key %q must be a 4xx or 5xx status code or class", host, key)
+		}
+
+		if path == "" {
+			return fmt.Errorf("route %s: error page %s requires a template file", host, key)
+		}
+	}
+
+	return nil
+}
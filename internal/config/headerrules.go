@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// headerTemplateVariable matches a variable reference in a header rule value.
+var headerTemplateVariable = regexp.MustCompile(`\{\{|\}\}|\{([^{}]*)\}`)
+
+// headerTemplateVariables are the variables header rule values may use in
+// addition to "header:<name>" and "proxy_tlv:<type>".
+var headerTemplateVariables = []string{
+	"client_ip", "request_id", "host", "route", "tls_version", "scheme", "method", "path", "aws_vpce_id",
+}
+
+// HeaderRulesConfig contains the header manipulation rules of a route.
+// Presets apply before the rules of the same direction: hide_backend
+// removes backend identification from responses and strip_internal
+// removes X-Internal-* and X-Rwwwrse-* headers from inbound requests.
+type HeaderRulesConfig struct {
+	Presets  []string           `mapstructure:"presets"`
+	Request  []HeaderRuleConfig `mapstructure:"request"`
+	Response []HeaderRuleConfig `mapstructure:"response"`
+}
+
+// HeaderRuleConfig is a single header change: set, add, remove or rename.
+// Values of set and add rules may reference request data as {client_ip},
+// {request_id}, {host}, {route}, {tls_version}, {scheme}, {method}, {path},
+// {header:<name>}, {aws_vpce_id} or {proxy_tlv:<type>}, the latter taking a
+// PROXY protocol v2 TLV type such as 0xEA. Remove rules accept a trailing
+// "*" to match a prefix.
+type HeaderRuleConfig struct {
+	Action    string `mapstructure:"action"`
+	Name      string `mapstructure:"name"`
+	Value     string `mapstructure:"value"`
+	To        string `mapstructure:"to"`
+	IfPresent string `mapstructure:"if_present"`
+	IfAbsent  string `mapstructure:"if_absent"`
+}
+
+// validateHeaderRules validates the header rules of a single route.
+func validateHeaderRules(host string, cfg HeaderRulesConfig) error {
+	for _, preset := range cfg.Presets {
+		if !oneOf(preset, "hide_backend", "strip_internal") {
+			return fmt.Errorf("route %s: unknown header preset %q", host, preset)
+		}
+	}
+
+	for i, rule := range cfg.Request {
+		if err := validateHeaderRule(rule); err != nil {
+			return fmt.Errorf("route %s: request header rule %d: %w", host, i, err)
+		}
+	}
+
+	for i, rule := range cfg.Response {
+		if err := validateHeaderRule(rule); err != nil {
+			return fmt.Errorf("route %s: response header rule %d: %w", host, i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateHeaderRule validates a single header rule.
+func validateHeaderRule(rule HeaderRuleConfig) error {
+	name := rule.Name
+	if rule.Action == "remove" {
+		name = strings.TrimSuffix(name, "*")
+	}
+	if name == "" || strings.ContainsAny(name, " \t:*") {
+		return fmt.Errorf("invalid header name %q", rule.Name)
+	}
+
+	switch rule.Action {
+	case "set", "add":
+		for _, match := range headerTemplateVariable.FindAllStringSubmatch(rule.Value, -1) {
+			if match[0] == "{{" || match[0] == "}}" {
+				continue
+			}
+			variable := match[1]
+			if tlvType, ok := strings.CutPrefix(variable, "proxy_tlv:"); ok {
+				if _, err := strconv.ParseUint(tlvType, 0, 8); err != nil {
+					return fmt.Errorf("invalid PROXY protocol TLV type %q", tlvType)
+				}
+				continue
+			}
+			if !oneOf(variable, headerTemplateVariables...) && !strings.HasPrefix(variable, "header:") {
+				return fmt.Errorf("unknown template variable %q", variable)
+			}
+		}
+	case "remove":
+	case "rename":
+		if rule.To == "" {
+			return fmt.Errorf("rename requires a target name")
+		}
+	default:
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+
+	return nil
+}
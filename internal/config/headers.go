@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/albedosehen/rwwwrse/internal/headers"
+)
+
+// HeaderProfileConfig is a named set of response header changes applied on
+// top of the global security headers for the routes that select it. Empty
+// fields keep the global value; Set overrides, Add appends and Remove
+// deletes arbitrary headers.
+type HeaderProfileConfig struct {
+	ContentSecurityPolicy     string            `mapstructure:"content_security_policy"`
+	FrameOptions              string            `mapstructure:"frame_options"`
+	ReferrerPolicy            string            `mapstructure:"referrer_policy"`
+	PermissionsPolicy         string            `mapstructure:"permissions_policy"`
+	CrossOriginOpenerPolicy   string            `mapstructure:"cross_origin_opener_policy"`
+	CrossOriginEmbedderPolicy string            `mapstructure:"cross_origin_embedder_policy"`
+	CrossOriginResourcePolicy string            `mapstructure:"cross_origin_resource_policy"`
+	HSTS                      HSTSConfig        `mapstructure:"hsts"`
+	Set                       map[string]string `mapstructure:"set"`
+	Add                       map[string]string `mapstructure:"add"`
+	Remove                    []string          `mapstructure:"remove"`
+}
+
+// HSTSConfig describes a Strict-Transport-Security header. A zero max age
+// keeps the global header.
+type HSTSConfig struct {
+	MaxAge            time.Duration `mapstructure:"max_age"`
+	IncludeSubdomains bool          `mapstructure:"include_subdomains"`
+	Preload           bool          `mapstructure:"preload"`
+}
+
+// validateHeaderProfiles validates the named security header profiles.
+func validateHeaderProfiles(profiles map[string]HeaderProfileConfig) error {
+	for name, profile := range profiles {
+		if err := validateHeaderProfile(profile); err != nil {
+			return fmt.Errorf("header profile %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateSecurityHeaders validates the global security header values.
+func validateSecurityHeaders(h SecurityHeaders) error {
+	if err := headers.ValidateSecurityValues(headers.SecurityValues{
+		ContentSecurityPolicy:     h.ContentSecurityPolicy,
+		StrictTransportSecurity:   h.StrictTransportSecurity,
+		FrameOptions:              h.FrameOptions,
+		ReferrerPolicy:            h.ReferrerPolicy,
+		PermissionsPolicy:         h.PermissionsPolicy,
+		CrossOriginOpenerPolicy:   h.CrossOriginOpenerPolicy,
+		CrossOriginEmbedderPolicy: h.CrossOriginEmbedderPolicy,
+		CrossOriginResourcePolicy: h.CrossOriginResourcePolicy,
+	}); err != nil {
+		return fmt.Errorf("security headers: %w", err)
+	}
+	return nil
+}
+
+// validateHeaderProfile validates a single security header profile.
+func validateHeaderProfile(profile HeaderProfileConfig) error {
+	if profile.HSTS.MaxAge < 0 {
+		return fmt.Errorf("HSTS max age cannot be negative")
+	}
+
+	values := headers.SecurityValues{
+		ContentSecurityPolicy:     profile.ContentSecurityPolicy,
+		FrameOptions:              profile.FrameOptions,
+		ReferrerPolicy:            profile.ReferrerPolicy,
+		PermissionsPolicy:         profile.PermissionsPolicy,
+		CrossOriginOpenerPolicy:   profile.CrossOriginOpenerPolicy,
+		CrossOriginEmbedderPolicy: profile.CrossOriginEmbedderPolicy,
+		CrossOriginResourcePolicy: profile.CrossOriginResourcePolicy,
+	}
+	if profile.HSTS.MaxAge > 0 || profile.HSTS.Preload {
+		values.StrictTransportSecurity = headers.FormatHSTS(profile.HSTS.MaxAge, profile.HSTS.IncludeSubdomains, profile.HSTS.Preload)
+	}
+	if err := headers.ValidateSecurityValues(values); err != nil {
+		return err
+	}
+
+	for name := range profile.Set {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("header names cannot be empty")
+		}
+	}
+
+	for name := range profile.Add {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("header names cannot be empty")
+		}
+	}
+
+	return nil
+}
+
+// oneOf reports whether value is one of the allowed values.
+func oneOf(value string, allowed ...string) bool {
+	for _, candidate := range allowed {
+		if value == candidate {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// RequestLimitsConfig bounds the size of requests accepted on a route and
+// the minimum rate at which a client must upload the request body. A zero
+// value disables the corresponding limit.
+type RequestLimitsConfig struct {
+	Enabled           bool          `mapstructure:"enabled" default:"false"`
+	MaxBodySize       int64         `mapstructure:"max_body_size" default:"0"`
+	MaxHeaderBytes    int           `mapstructure:"max_header_bytes" default:"0"`
+	MaxHeaderCount    int           `mapstructure:"max_header_count" default:"0"`
+	MaxURLLength      int           `mapstructure:"max_url_length" default:"0"`
+	MaxQueryParams    int           `mapstructure:"max_query_params" default:"0"`
+	MinUploadRate     int64         `mapstructure:"min_upload_rate" default:"0"` // bytes per second
+	UploadGracePeriod time.Duration `mapstructure:"upload_grace_period" default:"5s"`
+}
+
+// validateLimits validates the request limits configuration of a single route.
+func validateLimits(host string, cfg RequestLimitsConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.MaxBodySize < 0 || cfg.MaxHeaderBytes < 0 || cfg.MaxHeaderCount < 0 ||
+		cfg.MaxURLLength < 0 || cfg.MaxQueryParams < 0 {
+		return fmt.Errorf("route %s: request limits cannot be negative", host)
+	}
+
+	if cfg.MinUploadRate < 0 {
+		return fmt.Errorf("route %s: minimum upload rate cannot be negative", host)
+	}
+
+	if cfg.MinUploadRate > 0 && cfg.UploadGracePeriod <= 0 {
+		return fmt.Errorf("route %s: upload grace period must be positive when a minimum upload rate is set", host)
+	}
+
+	return nil
+}
@@ -61,6 +61,7 @@ func (l *configLoader) Load() (*Config, error) {
 	if err := v.Unmarshal(&cfg); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
+	applyRouteDefaults(&cfg)
 
 	if err := l.Validate(&cfg); err != nil {
 		return nil, fmt.Errorf("invalid configuration: %w", err)
@@ -101,6 +102,7 @@ func (l *configLoader) Watch(ctx context.Context) (<-chan *Config, error) {
 	// Send initial configuration
 	var initialCfg Config
 	if err := v.Unmarshal(&initialCfg); err == nil {
+		applyRouteDefaults(&initialCfg)
 		if err := l.Validate(&initialCfg); err == nil {
 			select {
 			case configCh <- &initialCfg:
@@ -119,6 +121,7 @@ func (l *configLoader) Watch(ctx context.Context) (<-chan *Config, error) {
 			// Log error but continue watching
 			return
 		}
+		applyRouteDefaults(&newCfg)
 
 		if err := l.Validate(&newCfg); err != nil {
 			// Log validation error but continue watching
@@ -171,11 +174,58 @@ func (l *configLoader) validateCustomRules(cfg *Config) error {
 		}
 	}
 
+	// Validate PROXY protocol listeners
+	if err := validateProxyProtocol(cfg.Server.ProxyProtocol); err != nil {
+		return err
+	}
+
+	// Validate strict HTTP parsing
+	if err := validateStrictHTTP(cfg.Server.StrictHTTP); err != nil {
+		return err
+	}
+
+	// Validate client IP resolution
+	if err := validateClientIP(cfg.Security.ClientIP); err != nil {
+		return err
+	}
+
+	// Validate automatic banning
+	if err := validateBans(cfg.Security.Bans); err != nil {
+		return err
+	}
+
+	// Validate CSP violation reporting
+	if err := validateCSPReports(cfg.Security.CSPReports); err != nil {
+		return err
+	}
+
+	// Validate global security headers and header profiles
+	if err := validateSecurityHeaders(cfg.Security.Headers); err != nil {
+		return err
+	}
+
+	if err := validateHeaderProfiles(cfg.Security.HeaderProfiles); err != nil {
+		return err
+	}
+
 	// Validate backend routes
 	if len(cfg.Backends.Routes) == 0 {
 		return fmt.Errorf("at least one backend route must be configured")
 	}
 
+	if err := validateRateLimitPolicies(cfg.RateLimit.Policies); err != nil {
+		return err
+	}
+
+	if err := l.validateRoutes(cfg.Backends.Routes, cfg.RateLimit.Policies, cfg.Security); err != nil {
+		return err
+	}
+
+	// Validate the shared response cache
+	if err := validateCache(cfg.Cache, cfg.Backends.Routes); err != nil {
+		return err
+	}
+
 	// Validate port conflicts
 	if cfg.Server.Port == cfg.Server.HTTPSPort {
 		return fmt.Errorf("HTTP and HTTPS ports cannot be the same")
@@ -194,6 +244,10 @@ func (l *configLoader) validateCustomRules(cfg *Config) error {
 		return fmt.Errorf("rate limit burst size must be positive")
 	}
 
+	if err := validateRateLimitBackend(cfg.RateLimit); err != nil {
+		return err
+	}
+
 	// Validate health check configuration
 	if cfg.Health.UnhealthyThreshold <= 0 {
 		return fmt.Errorf("unhealthy threshold must be positive")
@@ -205,3 +259,104 @@ func (l *configLoader) validateCustomRules(cfg *Config) error {
 
 	return nil
 }
+
+// validateRoutes validates the per-route policies of each backend route.
+func (l *configLoader) validateRoutes(
+	routes map[string]BackendRoute,
+	policies map[string]RateLimitPolicyConfig,
+	security SecurityConfig,
+) error {
+	for host, route := range routes {
+		if err := validateOIDC(host, route.OIDC); err != nil {
+			return err
+		}
+
+		if err := validateForwardAuth(host, route.ForwardAuth); err != nil {
+			return err
+		}
+
+		if err := validateBasicAuth(host, route.BasicAuth); err != nil {
+			return err
+		}
+
+		if err := validateAPIKey(host, route.APIKey); err != nil {
+			return err
+		}
+
+		if err := validateAccessControl(host, route.AccessControl); err != nil {
+			return err
+		}
+
+		if err := validateBackendProxyProtocol(host, route.ProxyProtocol); err != nil {
+			return err
+		}
+
+		if err := validateRouteRateLimit(host, route.RateLimit, policies); err != nil {
+			return err
+		}
+
+		if err := validateConcurrency(host, route.Concurrency); err != nil {
+			return err
+		}
+
+		if err := validateWAF(host, route.WAF); err != nil {
+			return err
+		}
+
+		if err := validateCSRF(host, route.CSRF); err != nil {
+			return err
+		}
+
+		if err := validateCSP(host, route.CSP, security.CSPReports); err != nil {
+			return err
+		}
+
+		if err := validateCORS(host, route.CORS); err != nil {
+			return err
+		}
+
+		if err := validateWebhook(host, route.Webhook); err != nil {
+			return err
+		}
+
+		if err := validateOpenAPI(host, route.OpenAPI); err != nil {
+			return err
+		}
+
+		if err := validateLimits(host, route.Limits); err != nil {
+			return err
+		}
+
+		if err := validateErrorPages(host, route.ErrorPages); err != nil {
+			return err
+		}
+
+		if err := validateCompression(host, route.Compression); err != nil {
+			return err
+		}
+
+		if err := validateRouteCache(host, route.Cache); err != nil {
+			return err
+		}
+
+		if err := validateHeaderRules(host, route.Headers); err != nil {
+			return err
+		}
+
+		if err := validateRewrite(host, route.Rewrite); err != nil {
+			return err
+		}
+
+		if err := validateBodyFilter(host, route.BodyFilter); err != nil {
+			return err
+		}
+
+		if route.HeaderProfile != "" {
+			if _, ok := security.HeaderProfiles[route.HeaderProfile]; !ok {
+				return fmt.Errorf("route %s: unknown header profile %q", host, route.HeaderProfile)
+			}
+		}
+	}
+
+	return nil
+}
@@ -247,6 +247,683 @@ func TestConfigLoader_Validate(t *testing.T) {
 			}(),
 			wantErr: false,
 		},
+		{
+			name: "OIDC route without cookie secret",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"app.example.com": {
+						URL: "http://app:8080",
+						OIDC: OIDCConfig{
+							Enabled:   true,
+							IssuerURL: "https://idp.example.com",
+							ClientID:  "rwwwrse",
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "OIDC route with valid settings",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"app.example.com": {
+						URL:            "http://app:8080",
+						HealthPath:     "/health",
+						HealthInterval: 30 * time.Second,
+						Timeout:        30 * time.Second,
+						MaxIdleConns:   100,
+						MaxIdlePerHost: 10,
+						DialTimeout:    10 * time.Second,
+						OIDC: OIDCConfig{
+							Enabled:      true,
+							IssuerURL:    "https://idp.example.com",
+							ClientID:     "rwwwrse",
+							CookieSecret: "0123456789abcdef0123456789abcdef",
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: false,
+		},
+		{
+			name: "forward auth cache without key headers",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"app.example.com": {
+						URL: "http://app:8080",
+						ForwardAuth: ForwardAuthConfig{
+							Enabled:  true,
+							URL:      "http://authz:9000/check",
+							Timeout:  5 * time.Second,
+							CacheTTL: time.Minute,
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "invalid trusted proxy CIDR",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Security.ClientIP.TrustedProxies = []string{"10.0.0.0/33"}
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {URL: "http://example.com"},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "unknown rate limit failure mode",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.RateLimit.Backend = RateLimitBackendRedis
+				cfg.RateLimit.FailureMode = "retry"
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {URL: "http://example.com"},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "ban admin path without host",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Security.Bans.Enabled = true
+				cfg.Security.Bans.AdminPath = "/_bans"
+				cfg.Security.Bans.AdminToken = "secret"
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {URL: "http://example.com"},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "ban admin path without token",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Security.Bans.Enabled = true
+				cfg.Security.Bans.AdminPath = "/_bans"
+				cfg.Security.Bans.AdminHost = "admin.example.com"
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {URL: "http://example.com"},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "route references unknown rate limit policy",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL:       "http://example.com",
+						RateLimit: RouteRateLimitConfig{Policy: "missing"},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "rate limit policy with invalid key source",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.RateLimit.Policies = map[string]RateLimitPolicyConfig{
+					"api": {
+						Key:    []string{"header"},
+						Limits: []RateLimitRuleConfig{{Requests: 10, Period: time.Second}},
+					},
+				}
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {URL: "http://example.com"},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "concurrency initial limit above maximum",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						Concurrency: ConcurrencyConfig{
+							Enabled:      true,
+							InitialLimit: 500,
+							MinLimit:     1,
+							MaxLimit:     100,
+							BackoffRatio: 0.9,
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "gradient concurrency route with default limits",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL:         "http://example.com",
+						Concurrency: ConcurrencyConfig{Enabled: true, Algorithm: "gradient"},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: false,
+		},
+		{
+			name: "aimd concurrency backoff ratio of one",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						Concurrency: ConcurrencyConfig{
+							Enabled:      true,
+							Algorithm:    "aimd",
+							BackoffRatio: 1,
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "unknown WAF mode",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						WAF: WAFConfig{
+							Enabled:          true,
+							Mode:             "enforce",
+							CoreRules:        boolPtr(true),
+							AnomalyThreshold: 5,
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "CSRF trusted origin with path",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						CSRF: CSRFConfig{
+							Enabled:        true,
+							Mode:           "origin",
+							TrustedOrigins: []string{"https://app.example.com/login"},
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "CSP nonce without placeholder in policy",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						CSP: CSPConfig{
+							Enabled:          true,
+							Policy:           "default-src 'self'; script-src 'self'",
+							Nonce:            true,
+							NoncePlaceholder: "__CSP_NONCE__",
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "unknown header profile",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL:           "http://example.com",
+						HeaderProfile: "embeddable",
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "HSTS preload with short max age",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Security.HeaderProfiles = map[string]HeaderProfileConfig{
+					"strict": {
+						HSTS: HSTSConfig{MaxAge: 24 * time.Hour, IncludeSubdomains: true, Preload: true},
+					},
+				}
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {URL: "http://example.com", HeaderProfile: "strict"},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "invalid permissions policy",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Security.HeaderProfiles = map[string]HeaderProfileConfig{
+					"embeddable": {
+						FrameOptions:      "SAMEORIGIN",
+						PermissionsPolicy: "camera=(), geolocation=self https://maps.example.com",
+					},
+				}
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {URL: "http://example.com", HeaderProfile: "embeddable"},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "CORS wildcard origin with credentials",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						CORS: CORSConfig{
+							Mode:             CORSModePolicy,
+							AllowedOrigins:   []string{"*"},
+							AllowCredentials: true,
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "CORS policy with invalid method",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						CORS: CORSConfig{
+							Mode:           CORSModePolicy,
+							AllowedOrigins: []string{"https://app.example.com"},
+							AllowedMethods: []string{"get"},
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "webhook with multiple secret sources",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"hooks": {
+						URL: "http://hooks.internal",
+						Webhook: WebhookConfig{
+							Enabled:      true,
+							Preset:       "github",
+							Secret:       "s3cret",
+							SecretEnv:    "GITHUB_WEBHOOK_SECRET",
+							MaxBodySize:  1 << 20,
+							ReplayWindow: 10 * time.Minute,
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "OpenAPI response sample rate above one",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"api": {
+						URL: "http://api.internal",
+						OpenAPI: OpenAPIConfig{
+							Enabled:            true,
+							Spec:               "/etc/rwwwrse/api.yaml",
+							Mode:               "monitor",
+							MaxBodySize:        1 << 20,
+							ResponseSampleRate: 1.5,
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Request limits with upload rate but no grace period",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"uploads": {
+						URL: "http://uploads.internal",
+						Limits: RequestLimitsConfig{
+							Enabled:       true,
+							MaxBodySize:   10 << 20,
+							MinUploadRate: 1024,
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Strict HTTP with unknown encoded slash policy",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Server.StrictHTTP.Enabled = true
+				cfg.Server.StrictHTTP.EncodedSlashes = "decode"
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {URL: "http://example.com"},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Error page with invalid status key",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL:        "http://example.com",
+						ErrorPages: map[string]string{"200": "/etc/rwwwrse/ok.html"},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Compression with unknown encoding",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						Compression: CompressionConfig{
+							Enabled:   true,
+							Encodings: []string{"gzip", "deflate"},
+							GzipLevel: 6,
+							ZstdLevel: 2,
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Compression with brotli",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						Compression: CompressionConfig{
+							Enabled:     true,
+							Encodings:   []string{"br", "gzip"},
+							GzipLevel:   6,
+							ZstdLevel:   2,
+							BrotliLevel: 5,
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: false,
+		},
+		{
+			name: "Compression with brotli level out of range",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						Compression: CompressionConfig{
+							Enabled:     true,
+							Encodings:   []string{"br"},
+							GzipLevel:   6,
+							ZstdLevel:   2,
+							BrotliLevel: 12,
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Route cache without shared cache",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL:   "http://example.com",
+						Cache: RouteCacheConfig{Enabled: true},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Cache purge path without host",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Cache.Enabled = true
+				cfg.Cache.PurgePath = "/_rwwwrse/cache"
+				cfg.Cache.PurgeToken = "secret"
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {URL: "http://example.com"},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Cache purge path without token",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Cache.Enabled = true
+				cfg.Cache.PurgePath = "/_rwwwrse/cache"
+				cfg.Cache.PurgeHost = "admin.example.com"
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {URL: "http://example.com"},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Header rule with unknown template variable",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						Headers: HeaderRulesConfig{
+							Request: []HeaderRuleConfig{
+								{Action: "set", Name: "X-Client", Value: "{client_address}"},
+							},
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Unknown header preset",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL:     "http://example.com",
+						Headers: HeaderRulesConfig{Presets: []string{"hide_everything"}},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Header rule with invalid PROXY protocol TLV type",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						Headers: HeaderRulesConfig{Request: []HeaderRuleConfig{
+							{Action: "set", Name: "X-VPC", Value: "{proxy_tlv:vpce}"},
+						}},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Rewrite with SameSite None without Secure",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						Rewrite: RewriteConfig{
+							Enabled:        true,
+							CookieSameSite: "none",
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Body filter with invalid regex",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {
+						URL: "http://example.com",
+						BodyFilter: BodyFilterConfig{
+							Enabled: true,
+							Substitutions: []BodyFilterSubstitution{
+								{Pattern: "(", Regex: true},
+							},
+						},
+					},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Global security headers with invalid COOP",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Security.Headers.CrossOriginOpenerPolicy = "open"
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "Global security headers with invalid Permissions-Policy",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Security.Headers.PermissionsPolicy = "camera=none"
+				return cfg
+			}(),
+			wantErr: true,
+		},
+		{
+			name: "PROXY protocol without trusted CIDRs",
+			config: func() *Config {
+				cfg := GetDefaultConfig()
+				cfg.TLS.AutoCert = false
+				cfg.Server.ProxyProtocol.HTTP = true
+				cfg.Backends.Routes = map[string]BackendRoute{
+					"example": {URL: "http://example.com"},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+		},
 		{
 			name: "invalid server port - too low",
 			config: &Config{
@@ -309,6 +986,43 @@ func TestConfigLoader_Validate(t *testing.T) {
 	}
 }
 
+func TestConfigLoader_Load_MinimalWAFRoute(t *testing.T) {
+	// Arrange
+	tempDir := t.TempDir()
+	configContent := `
+tls:
+  enabled: false
+  auto_cert: false
+backends:
+  routes:
+    example:
+      url: "http://example.com"
+      waf:
+        enabled: true
+`
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "config.yaml"), []byte(configContent), 0644))
+
+	oldWd, err := os.Getwd()
+	require.NoError(t, err)
+	defer func() {
+		if err := os.Chdir(oldWd); err != nil {
+			t.Errorf("Failed to restore working directory: %v", err)
+		}
+	}()
+	require.NoError(t, os.Chdir(tempDir))
+
+	// Act
+	config, err := NewConfigLoader().Load()
+
+	// Assert
+	require.NoError(t, err)
+	waf := config.Backends.Routes["example"].WAF
+	require.NotNil(t, waf.CoreRules)
+	assert.True(t, *waf.CoreRules)
+	assert.Equal(t, 5, waf.AnomalyThreshold)
+	assert.Equal(t, int64(131072), waf.BodyLimit)
+}
+
 func TestConfigLoader_Watch(t *testing.T) {
 	// Create a temporary config file
 	tempDir := t.TempDir()
@@ -441,3 +1155,7 @@ func BenchmarkGetDefaultBackendRoute(b *testing.B) {
 		_ = GetDefaultBackendRoute()
 	}
 }
+
+func boolPtr(v bool) *bool {
+	return &v
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OpenAPIConfig contains request validation against an OpenAPI 3.x document
+// for a route. In enforce mode invalid requests are rejected with 400; in
+// monitor mode they are only logged. A sample of responses can also be
+// checked to detect contract drift.
+type OpenAPIConfig struct {
+	Enabled            bool    `mapstructure:"enabled" default:"false"`
+	Spec               string  `mapstructure:"spec"`
+	Mode               string  `mapstructure:"mode" default:"enforce"`
+	BasePath           string  `mapstructure:"base_path"`
+	RejectUnknown      bool    `mapstructure:"reject_unknown" default:"false"`
+	MaxBodySize        int64   `mapstructure:"max_body_size" default:"1048576"`
+	ResponseSampleRate float64 `mapstructure:"response_sample_rate" default:"0"`
+}
+
+// validateOpenAPI validates the OpenAPI validation configuration of a single route.
+func validateOpenAPI(host string, cfg OpenAPIConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.Spec == "" {
+		return fmt.Errorf("route %s: OpenAPI spec is required", host)
+	}
+
+	if cfg.Mode != "" && cfg.Mode != "enforce" && cfg.Mode != "monitor" {
+		return fmt.Errorf("route %s: OpenAPI mode must be enforce or monitor", host)
+	}
+
+	if cfg.BasePath != "" && !strings.HasPrefix(cfg.BasePath, "/") {
+		return fmt.Errorf("route %s: OpenAPI base path must start with /", host)
+	}
+
+	if cfg.MaxBodySize <= 0 {
+		return fmt.Errorf("route %s: OpenAPI max body size must be positive", host)
+	}
+
+	if cfg.ResponseSampleRate < 0 || cfg.ResponseSampleRate > 1 {
+		return fmt.Errorf("route %s: OpenAPI response sample rate must be between 0 and 1", host)
+	}
+
+	return nil
+}
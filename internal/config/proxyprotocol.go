@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// ProxyProtocolConfig enables PROXY protocol v1/v2 on the listeners. Headers
+// are only accepted from trusted source networks and must arrive within the
+// header timeout.
+type ProxyProtocolConfig struct {
+	HTTP          bool          `mapstructure:"http" default:"false"`
+	HTTPS         bool          `mapstructure:"https" default:"false"`
+	TrustedCIDRs  []string      `mapstructure:"trusted_cidrs"`
+	HeaderTimeout time.Duration `mapstructure:"header_timeout" default:"5s"`
+}
+
+// validateProxyProtocol validates the listener PROXY protocol configuration.
+func validateProxyProtocol(cfg ProxyProtocolConfig) error {
+	if !cfg.HTTP && !cfg.HTTPS {
+		return nil
+	}
+
+	if len(cfg.TrustedCIDRs) == 0 {
+		return fmt.Errorf("PROXY protocol requires at least one trusted CIDR")
+	}
+
+	for _, cidr := range cfg.TrustedCIDRs {
+		if !isValidCIDROrIP(cidr) {
+			return fmt.Errorf("invalid PROXY protocol trusted CIDR %q", cidr)
+		}
+	}
+
+	if cfg.HeaderTimeout < 0 {
+		return fmt.Errorf("PROXY protocol header timeout cannot be negative")
+	}
+
+	return nil
+}
+
+// validateBackendProxyProtocol validates the PROXY protocol version sent to a backend.
+func validateBackendProxyProtocol(host, version string) error {
+	switch version {
+	case "", "v1", "v2":
+		return nil
+	default:
+		return fmt.Errorf("route %s: proxy protocol must be v1 or v2", host)
+	}
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Rate limit backends.
+const (
+	RateLimitBackendMemory = "memory"
+	RateLimitBackendRedis  = "redis"
+)
+
+// Rate limit algorithms used by the Redis backend.
+const (
+	RateLimitAlgorithmGCRA          = "gcra"
+	RateLimitAlgorithmSlidingWindow = "sliding_window"
+)
+
+// Rate limit behaviours when the shared store is unreachable.
+const (
+	RateLimitFailureLocal  = "local"
+	RateLimitFailureOpen   = "open"
+	RateLimitFailureClosed = "closed"
+)
+
+// RedisConfig contains the connection settings of a Redis-protocol store
+// used for distributed rate limiting.
+type RedisConfig struct {
+	Address     string        `mapstructure:"address" default:"localhost:6379"`
+	Username    string        `mapstructure:"username"`
+	Password    string        `mapstructure:"password"`
+	DB          int           `mapstructure:"db" default:"0"`
+	TLS         bool          `mapstructure:"tls" default:"false"`
+	KeyPrefix   string        `mapstructure:"key_prefix" default:"rwwwrse:ratelimit:"`
+	DialTimeout time.Duration `mapstructure:"dial_timeout" default:"2s"`
+	Timeout     time.Duration `mapstructure:"timeout" default:"100ms"`
+	PoolSize    int           `mapstructure:"pool_size" default:"16"`
+}
+
+// validateRateLimitBackend validates the rate limit backend selection and,
+// for the Redis backend, its store settings.
+func validateRateLimitBackend(cfg RateLimitConfig) error {
+	switch cfg.Backend {
+	case "", RateLimitBackendMemory:
+		return nil
+	case RateLimitBackendRedis:
+	default:
+		return fmt.Errorf("rate limit backend must be memory or redis")
+	}
+
+	switch cfg.Algorithm {
+	case "", RateLimitAlgorithmGCRA, RateLimitAlgorithmSlidingWindow:
+	default:
+		return fmt.Errorf("rate limit algorithm must be gcra or sliding_window")
+	}
+
+	if cfg.Algorithm == RateLimitAlgorithmSlidingWindow && cfg.Window < time.Second {
+		return fmt.Errorf("rate limit sliding window must be at least 1s")
+	}
+
+	switch cfg.FailureMode {
+	case "", RateLimitFailureLocal, RateLimitFailureOpen, RateLimitFailureClosed:
+	default:
+		return fmt.Errorf("rate limit failure mode must be local, open or closed")
+	}
+
+	if _, _, err := net.SplitHostPort(cfg.Redis.Address); err != nil {
+		return fmt.Errorf("invalid rate limit redis address %q: %w", cfg.Redis.Address, err)
+	}
+
+	if cfg.Redis.DB < 0 {
+		return fmt.Errorf("rate limit redis db cannot be negative")
+	}
+
+	if cfg.Redis.Timeout < 0 || cfg.Redis.DialTimeout < 0 || cfg.Redis.PoolSize < 0 {
+		return fmt.Errorf("rate limit redis timeouts and pool size cannot be negative")
+	}
+
+	return nil
+}
+
+// RateLimitPolicyConfig is a named rate limit policy. Requests are keyed by
+// the listed sources and must pass every limit.
+//
+// Key sources are "ip", "header:<name>", "api_key", "api_key:<header>",
+// "jwt_claim:<claim>" and "cookie:<name>"; several sources form a composite key.
+type RateLimitPolicyConfig struct {
+	Key    []string              `mapstructure:"key"`
+	Limits []RateLimitRuleConfig `mapstructure:"limits"`
+}
+
+// RateLimitRuleConfig allows Requests per Period with an optional burst,
+// which defaults to Requests.
+type RateLimitRuleConfig struct {
+	Requests int           `mapstructure:"requests"`
+	Period   time.Duration `mapstructure:"period"`
+	Burst    int           `mapstructure:"burst"`
+}
+
+// RouteRateLimitConfig attaches named policies to a route. The path policy
+// with the longest matching prefix wins; other requests use Policy.
+type RouteRateLimitConfig struct {
+	Policy string               `mapstructure:"policy"`
+	Paths  []RouteRateLimitPath `mapstructure:"paths"`
+}
+
+// RouteRateLimitPath applies a policy to requests under a path prefix.
+type RouteRateLimitPath struct {
+	Path   string `mapstructure:"path"`
+	Policy string `mapstructure:"policy"`
+}
+
+// validateRateLimitPolicies validates the named rate limit policies.
+func validateRateLimitPolicies(policies map[string]RateLimitPolicyConfig) error {
+	for name, policy := range policies {
+		if len(policy.Limits) == 0 {
+			return fmt.Errorf("rate limit policy %s must define at least one limit", name)
+		}
+
+		for i, limit := range policy.Limits {
+			if limit.Requests <= 0 || limit.Period <= 0 {
+				return fmt.Errorf("rate limit policy %s: limit %d requires positive requests and period", name, i)
+			}
+			if limit.Burst < 0 {
+				return fmt.Errorf("rate limit policy %s: limit %d burst cannot be negative", name, i)
+			}
+		}
+
+		for _, source := range policy.Key {
+			if !isValidRateLimitKeySource(source) {
+				return fmt.Errorf("rate limit policy %s: invalid key source %q", name, source)
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateRouteRateLimit validates that a route only references defined policies.
+func validateRouteRateLimit(host string, cfg RouteRateLimitConfig, policies map[string]RateLimitPolicyConfig) error {
+	if cfg.Policy != "" {
+		if _, ok := policies[cfg.Policy]; !ok {
+			return fmt.Errorf("route %s: unknown rate limit policy %q", host, cfg.Policy)
+		}
+	}
+
+	for i, path := range cfg.Paths {
+		if !strings.HasPrefix(path.Path, "/") {
+			return fmt.Errorf("route %s: rate limit path %d must start with /", host, i)
+		}
+		if _, ok := policies[path.Policy]; !ok {
+			return fmt.Errorf("route %s: unknown rate limit policy %q", host, path.Policy)
+		}
+	}
+
+	return nil
+}
+
+// isValidRateLimitKeySource reports whether source names a supported key source.
+func isValidRateLimitKeySource(source string) bool {
+	kind, arg, hasArg := strings.Cut(source, ":")
+	switch kind {
+	case "ip":
+		return !hasArg
+	case "api_key":
+		return !hasArg || arg != ""
+	case "header", "jwt_claim", "cookie":
+		return arg != ""
+	default:
+		return false
+	}
+}
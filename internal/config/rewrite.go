@@ -0,0 +1,47 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// RewriteConfig contains the rewriting of backend URLs and cookie scopes in
+// response headers. Location, Content-Location and Refresh URLs pointing at
+// the backend are rewritten to the public URL, mapping the backend URL path
+// to the public URL path; Set-Cookie Domain and Path attributes follow the
+// same mapping. PublicURL defaults to the scheme and host of each request.
+type RewriteConfig struct {
+	Enabled        bool   `mapstructure:"enabled" default:"false"`
+	PublicURL      string `mapstructure:"public_url"`
+	CookieDomain   string `mapstructure:"cookie_domain"`
+	CookieSecure   bool   `mapstructure:"cookie_secure" default:"false"`
+	CookieHTTPOnly bool   `mapstructure:"cookie_http_only" default:"false"`
+	CookieSameSite string `mapstructure:"cookie_same_site"` // lax, strict, none
+}
+
+// validateRewrite validates the response rewriting of a single route.
+func validateRewrite(host string, cfg RewriteConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.PublicURL != "" {
+		public, err := url.Parse(cfg.PublicURL)
+		if err != nil || (public.Scheme != "http" && public.Scheme != "https") || public.Host == "" {
+			return fmt.Errorf("route %s: rewrite public URL must be an absolute http or https URL", host)
+		}
+	}
+
+	switch strings.ToLower(cfg.CookieSameSite) {
+	case "", "lax", "strict":
+	case "none":
+		if !cfg.CookieSecure {
+			return fmt.Errorf("route %s: cookie SameSite=None requires cookie_secure", host)
+		}
+	default:
+		return fmt.Errorf("route %s: invalid cookie SameSite %q", host, cfg.CookieSameSite)
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// StrictHTTPConfig enables strict HTTP parsing in front of the proxy.
+// Requests with ambiguous framing, malformed headers, unknown methods or
+// non-normalized paths are rejected instead of being forwarded. Raw framing
+// is inspected on HTTP/1.x connections of both listeners; HTTP/2 requests are
+// checked after parsing.
+type StrictHTTPConfig struct {
+	Enabled        bool     `mapstructure:"enabled" default:"false"`
+	ExtraMethods   []string `mapstructure:"extra_methods"`
+	DotSegments    string   `mapstructure:"dot_segments" default:"reject"`
+	EncodedSlashes string   `mapstructure:"encoded_slashes" default:"reject"`
+}
+
+// validateStrictHTTP validates the strict HTTP parsing configuration.
+func validateStrictHTTP(cfg StrictHTTPConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	for _, method := range cfg.ExtraMethods {
+		if method == "" || strings.ToUpper(method) != method || strings.ContainsAny(method, " \t/") {
+			return fmt.Errorf("invalid strict HTTP extra method %q", method)
+		}
+	}
+
+	if cfg.DotSegments != "" && cfg.DotSegments != "reject" && cfg.DotSegments != "allow" {
+		return fmt.Errorf("strict HTTP dot segment policy must be reject or allow")
+	}
+
+	if cfg.EncodedSlashes != "" && cfg.EncodedSlashes != "reject" && cfg.EncodedSlashes != "allow" {
+		return fmt.Errorf("strict HTTP encoded slash policy must be reject or allow")
+	}
+
+	return nil
+}
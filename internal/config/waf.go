@@ -0,0 +1,67 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// WAFConfig contains the web application firewall for a route. Rules are
+// written in a subset of ModSecurity SecLang; matches add to an anomaly
+// score and the request is blocked once the score reaches the threshold.
+// In detection mode matches are only logged. Unset core rules, a zero
+// anomaly threshold and a zero body limit select the defaults.
+type WAFConfig struct {
+	Enabled          bool           `mapstructure:"enabled" default:"false"`
+	Mode             string         `mapstructure:"mode" default:"blocking"`
+	CoreRules        *bool          `mapstructure:"core_rules" default:"true"`
+	RuleFiles        []string       `mapstructure:"rule_files"`
+	Rules            string         `mapstructure:"rules"`
+	AnomalyThreshold int            `mapstructure:"anomaly_threshold" default:"5"`
+	BodyLimit        int64          `mapstructure:"body_limit" default:"131072"`
+	Exclusions       []WAFExclusion `mapstructure:"exclusions"`
+}
+
+// WAFExclusion disables rules, or ignores variables for rules, on requests
+// whose path has the prefix. Rules are selected by ID or tag; with targets
+// set only those variables are ignored, otherwise the rules are skipped.
+type WAFExclusion struct {
+	PathPrefix string   `mapstructure:"path_prefix"`
+	RuleIDs    []int    `mapstructure:"rule_ids"`
+	Tags       []string `mapstructure:"tags"`
+	Targets    []string `mapstructure:"targets"`
+}
+
+// validateWAF validates the web application firewall configuration of a single route.
+func validateWAF(host string, cfg WAFConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.Mode != "" && cfg.Mode != "blocking" && cfg.Mode != "detection" {
+		return fmt.Errorf("route %s: WAF mode must be blocking or detection", host)
+	}
+
+	coreRules := cfg.CoreRules == nil || *cfg.CoreRules
+	if !coreRules && len(cfg.RuleFiles) == 0 && strings.TrimSpace(cfg.Rules) == "" {
+		return fmt.Errorf("route %s: WAF requires core rules, rule files or inline rules", host)
+	}
+
+	if cfg.AnomalyThreshold <= 0 {
+		return fmt.Errorf("route %s: WAF anomaly threshold must be positive", host)
+	}
+
+	if cfg.BodyLimit < 0 {
+		return fmt.Errorf("route %s: WAF body limit cannot be negative", host)
+	}
+
+	for i, exclusion := range cfg.Exclusions {
+		if exclusion.PathPrefix != "" && !strings.HasPrefix(exclusion.PathPrefix, "/") {
+			return fmt.Errorf("route %s: WAF exclusion %d path prefix must start with /", host, i)
+		}
+		if len(exclusion.RuleIDs) == 0 && len(exclusion.Tags) == 0 && len(exclusion.Targets) == 0 {
+			return fmt.Errorf("route %s: WAF exclusion %d must list rule IDs, tags or targets", host, i)
+		}
+	}
+
+	return nil
+}
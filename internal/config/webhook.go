@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// webhookPresets lists the built-in webhook signature schemes.
+var webhookPresets = []string{"github", "stripe", "slack", "shopify"}
+
+// WebhookConfig contains HMAC signature verification for inbound webhooks
+// on a route. A preset provides the scheme of a common provider; the other
+// scheme fields override it or describe a custom scheme.
+type WebhookConfig struct {
+	Enabled         bool          `mapstructure:"enabled" default:"false"`
+	Preset          string        `mapstructure:"preset"`
+	Header          string        `mapstructure:"header"`
+	Algorithm       string        `mapstructure:"algorithm"`
+	Encoding        string        `mapstructure:"encoding"`
+	Prefix          string        `mapstructure:"prefix"`
+	SignatureParam  string        `mapstructure:"signature_param"`
+	TimestampParam  string        `mapstructure:"timestamp_param"`
+	TimestampHeader string        `mapstructure:"timestamp_header"`
+	Payload         string        `mapstructure:"payload"`
+	Tolerance       time.Duration `mapstructure:"tolerance"`
+	Secret          string        `mapstructure:"secret"`
+	SecretEnv       string        `mapstructure:"secret_env"`
+	SecretFile      string        `mapstructure:"secret_file"`
+	Paths           []string      `mapstructure:"paths"`
+	MaxBodySize     int64         `mapstructure:"max_body_size" default:"1048576"`
+	ReplayWindow    time.Duration `mapstructure:"replay_window" default:"10m"`
+}
+
+// validateWebhook validates the webhook signature configuration of a single route.
+func validateWebhook(host string, cfg WebhookConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if cfg.Preset != "" && !slices.Contains(webhookPresets, cfg.Preset) {
+		return fmt.Errorf("route %s: webhook preset must be one of %s", host, strings.Join(webhookPresets, ", "))
+	}
+
+	if cfg.Preset == "" && (cfg.Header == "" || cfg.Algorithm == "") {
+		return fmt.Errorf("route %s: webhook without a preset requires a header and algorithm", host)
+	}
+
+	if cfg.Algorithm != "" && !slices.Contains([]string{"sha1", "sha256", "sha512"}, cfg.Algorithm) {
+		return fmt.Errorf("route %s: webhook algorithm must be sha1, sha256 or sha512", host)
+	}
+
+	if cfg.Encoding != "" && cfg.Encoding != "hex" && cfg.Encoding != "base64" {
+		return fmt.Errorf("route %s: webhook encoding must be hex or base64", host)
+	}
+
+	if cfg.Payload != "" && !strings.Contains(cfg.Payload, "{body}") {
+		return fmt.Errorf("route %s: webhook payload template must contain {body}", host)
+	}
+
+	sources := 0
+	for _, source := range []string{cfg.Secret, cfg.SecretEnv, cfg.SecretFile} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("route %s: webhook requires exactly one of secret, secret_env or secret_file", host)
+	}
+
+	for _, path := range cfg.Paths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("route %s: webhook path %q must start with /", host, path)
+		}
+	}
+
+	if cfg.Tolerance < 0 || cfg.MaxBodySize <= 0 || cfg.ReplayWindow < 0 {
+		return fmt.Errorf("route %s: webhook limits must be positive", host)
+	}
+
+	return nil
+}
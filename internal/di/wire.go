@@ -6,6 +6,7 @@ package di
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
@@ -28,6 +29,7 @@ type Application struct {
 	Router          proxy.Router
 	BackendMgr      proxy.BackendManager
 	Handler         proxy.ProxyHandler
+	HTTPHandler     http.Handler
 	ConnectionPool  proxy.ConnectionPool
 	ServerManager   server.ServerManager
 	TLSManager      tls.Manager
@@ -168,6 +170,7 @@ func ProvideApplication(
 		Router:          router,
 		BackendMgr:      backendMgr,
 		Handler:         handler,
+		HTTPHandler:     middlewareChain.Then(handler),
 		ConnectionPool:  connectionPool,
 		ServerManager:   serverManager,
 		TLSManager:      tlsManager,
@@ -17,6 +17,7 @@ import (
 	"github.com/albedosehen/rwwwrse/internal/server"
 	"github.com/albedosehen/rwwwrse/internal/tls"
 	"github.com/google/wire"
+	"net/http"
 	"sync"
 	"time"
 )
@@ -106,6 +107,7 @@ type Application struct {
 	Router          proxy.Router
 	BackendMgr      proxy.BackendManager
 	Handler         proxy.ProxyHandler
+	HTTPHandler     http.Handler
 	ConnectionPool  proxy.ConnectionPool
 	ServerManager   server.ServerManager
 	TLSManager      tls.Manager
@@ -140,6 +142,7 @@ func ProvideApplication(
 		Router:          router,
 		BackendMgr:      backendMgr,
 		Handler:         handler,
+		HTTPHandler:     middlewareChain.Then(handler),
 		ConnectionPool:  connectionPool,
 		ServerManager:   serverManager,
 		TLSManager:      tlsManager,
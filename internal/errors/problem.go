@@ -0,0 +1,278 @@
+package errors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Media types of error responses.
+const (
+	ProblemContentType = "application/problem+json"
+	jsonContentType    = "application/json"
+	htmlContentType    = "text/html"
+	textContentType    = "text/plain"
+)
+
+// ProblemTypeBase prefixes the error code name to form the problem type URI.
+const ProblemTypeBase = "urn:rwwwrse:error:"
+
+// problemOffers are the representations of an error response in order of
+// preference.
+var problemOffers = []string{ProblemContentType, jsonContentType, htmlContentType, textContentType}
+
+// problemExtensionKeys are the error context entries that are safe to expose
+// to clients as problem extension members.
+var problemExtensionKeys = []string{"violations", "retry_after", "policy", "limit"}
+
+// defaultErrorPage renders HTML error responses without a custom template.
+var defaultErrorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Status}} {{.Title}}</title></head>
+<body>
+<h1>{{.Status}} {{.Title}}</h1>
+{{if .Detail}}<p>{{.Detail}}</p>{{end}}
+{{if .RequestID}}<p><small>Request ID: {{.RequestID}}</small></p>{{end}}
+</body>
+</html>
+`))
+
+// Problem is an RFC 9457 problem details object.
+type Problem struct {
+	Type      string
+	Title     string
+	Status    int
+	Detail    string
+	Instance  string
+	RequestID string
+	Code      string
+
+	// Extensions are additional members of the problem object.
+	Extensions map[string]any
+}
+
+// NewProblem describes err as a problem occurring while serving r.
+func NewProblem(r *http.Request, err *ProxyError, requestID string) Problem {
+	status := err.HTTPStatus
+	if status == 0 {
+		status = err.Code.HTTPStatus()
+	}
+
+	problem := Problem{
+		Type:      ProblemTypeBase + err.Code.String(),
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    err.Message,
+		Instance:  r.URL.Path,
+		RequestID: requestID,
+		Code:      err.Code.String(),
+	}
+
+	for _, key := range problemExtensionKeys {
+		if value, ok := err.Context[key]; ok {
+			if problem.Extensions == nil {
+				problem.Extensions = make(map[string]any)
+			}
+			problem.Extensions[key] = value
+		}
+	}
+
+	return problem
+}
+
+// MarshalJSON encodes the problem with its extension members.
+func (p Problem) MarshalJSON() ([]byte, error) {
+	members := make(map[string]any, len(p.Extensions)+7)
+	for key, value := range p.Extensions {
+		members[key] = value
+	}
+
+	members["type"] = p.Type
+	members["title"] = p.Title
+	members["status"] = p.Status
+	members["code"] = p.Code
+	if p.Detail != "" {
+		members["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		members["instance"] = p.Instance
+	}
+	if p.RequestID != "" {
+		members["request_id"] = p.RequestID
+	}
+
+	return json.Marshal(members)
+}
+
+// Renderer writes error responses as problem details, HTML or plain text
+// depending on the Accept header of the request.
+type Renderer struct {
+	pages map[string]*template.Template
+}
+
+// NewRenderer creates a renderer that uses the given HTML templates. Pages
+// are keyed by status code, such as "404", or status class, such as "5xx".
+func NewRenderer(pages map[string]*template.Template) *Renderer {
+	return &Renderer{pages: pages}
+}
+
+// Render writes err as the response to r.
+func (rr *Renderer) Render(w http.ResponseWriter, r *http.Request, err *ProxyError, requestID string) {
+	problem := NewProblem(r, err, requestID)
+	contentType := NegotiateProblemType(r.Header.Get("Accept"))
+
+	var body []byte
+	switch contentType {
+	case htmlContentType:
+		var buf strings.Builder
+		if execErr := rr.page(problem.Status).Execute(&buf, problem); execErr != nil {
+			buf.Reset()
+			_ = defaultErrorPage.Execute(&buf, problem)
+		}
+		body = []byte(buf.String())
+		contentType += "; charset=utf-8"
+	case textContentType:
+		body = []byte(problemText(problem))
+		contentType += "; charset=utf-8"
+	default:
+		body, _ = json.Marshal(problem)
+		body = append(body, '\n')
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+// page returns the HTML template for status.
+func (rr *Renderer) page(status int) *template.Template {
+	if rr != nil {
+		if page, ok := rr.pages[strconv.Itoa(status)]; ok {
+			return page
+		}
+		if page, ok := rr.pages[fmt.Sprintf("%dxx", status/100)]; ok {
+			return page
+		}
+	}
+	return defaultErrorPage
+}
+
+// problemText renders a problem as plain text.
+func problemText(problem Problem) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d %s\n", problem.Status, problem.Title)
+	if problem.Detail != "" {
+		fmt.Fprintf(&b, "\n%s\n", problem.Detail)
+	}
+	if problem.RequestID != "" {
+		fmt.Fprintf(&b, "\nRequest ID: %s\n", problem.RequestID)
+	}
+	return b.String()
+}
+
+// NegotiateProblemType selects the media type of an error response from an
+// Accept header. Problem JSON is used when the header is absent or nothing
+// else is preferred.
+func NegotiateProblemType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return ProblemContentType
+	}
+
+	ranges := parseAccept(accept)
+	best, bestQ := ProblemContentType, 0.0
+	for _, offer := range problemOffers {
+		if q := acceptQuality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// acceptRange is a media range of an Accept header.
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses an Accept header into its media ranges, most specific first.
+func parseAccept(accept string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range params[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(name, "q") {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed >= 0 && parsed <= 1 {
+					q = parsed
+				}
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType: mediaType, q: q})
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return specificity(ranges[i].mediaType) > specificity(ranges[j].mediaType)
+	})
+	return ranges
+}
+
+// specificity ranks exact types above type/* above */*.
+func specificity(mediaType string) int {
+	switch {
+	case mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(mediaType, "/*"):
+		return 1
+	default:
+		return 2
+	}
+}
+
+// acceptQuality returns the quality of offer under the most specific
+// matching range, or 0 when no range matches.
+func acceptQuality(ranges []acceptRange, offer string) float64 {
+	major, _, _ := strings.Cut(offer, "/")
+	for _, r := range ranges {
+		if r.mediaType == offer || r.mediaType == major+"/*" || r.mediaType == "*/*" {
+			return r.q
+		}
+	}
+	return 0
+}
+
+// rendererKey is the context key of the request's renderer.
+type rendererKey struct{}
+
+// WithRenderer returns a context carrying the renderer for error responses.
+func WithRenderer(ctx context.Context, renderer *Renderer) context.Context {
+	return context.WithValue(ctx, rendererKey{}, renderer)
+}
+
+// RendererFromContext returns the renderer of the request, or a renderer
+// without custom pages.
+func RendererFromContext(ctx context.Context) *Renderer {
+	if renderer, ok := ctx.Value(rendererKey{}).(*Renderer); ok && renderer != nil {
+		return renderer
+	}
+	return &Renderer{}
+}
+
+// WriteProblem writes err as the response to r with the request's renderer.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err *ProxyError, requestID string) {
+	RendererFromContext(r.Context()).Render(w, r, err, requestID)
+}
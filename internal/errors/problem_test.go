@@ -0,0 +1,170 @@
+package errors
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateProblemType(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		expected string
+	}{
+		{
+			name:     "Negotiate_NoAccept_ProblemJSON",
+			accept:   "",
+			expected: ProblemContentType,
+		},
+		{
+			name:     "Negotiate_Wildcard_ProblemJSON",
+			accept:   "*/*",
+			expected: ProblemContentType,
+		},
+		{
+			name:     "Negotiate_Browser_HTML",
+			accept:   "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+			expected: "text/html",
+		},
+		{
+			name:     "Negotiate_PlainJSON_JSON",
+			accept:   "application/json",
+			expected: "application/json",
+		},
+		{
+			name:     "Negotiate_TextWildcard_HTML",
+			accept:   "text/*",
+			expected: "text/html",
+		},
+		{
+			name:     "Negotiate_PreferText_Text",
+			accept:   "text/html;q=0.5, text/plain",
+			expected: "text/plain",
+		},
+		{
+			name:     "Negotiate_Unsupported_ProblemJSON",
+			accept:   "image/png",
+			expected: ProblemContentType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			contentType := NegotiateProblemType(tt.accept)
+
+			// Assert
+			assert.Equal(t, tt.expected, contentType)
+		})
+	}
+}
+
+func TestRenderer_Render(t *testing.T) {
+	pages := map[string]*template.Template{
+		"404": template.Must(template.New("404").Parse(`missing {{.Instance}}`)),
+		"5xx": template.Must(template.New("5xx").Parse(`down {{.Status}} {{.RequestID}}`)),
+	}
+
+	tests := []struct {
+		name                string
+		err                 *ProxyError
+		accept              string
+		expectedStatus      int
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "Render_RoutePage_StatusTemplate",
+			err:                 WrapError(ErrCodeHostNotConfigured, "host not configured", nil),
+			accept:              "text/html",
+			expectedStatus:      http.StatusNotFound,
+			expectedContentType: "text/html; charset=utf-8",
+			expectedBody:        "missing /orders",
+		},
+		{
+			name:                "Render_RoutePage_ClassTemplate",
+			err:                 WrapError(ErrCodeBackendTimeout, "backend timed out", nil),
+			accept:              "text/html",
+			expectedStatus:      http.StatusGatewayTimeout,
+			expectedContentType: "text/html; charset=utf-8",
+			expectedBody:        "down 504 req-1",
+		},
+		{
+			name:                "Render_PlainText_Text",
+			err:                 WrapError(ErrCodeRateLimited, "Rate limit exceeded", nil),
+			accept:              "text/plain",
+			expectedStatus:      http.StatusTooManyRequests,
+			expectedContentType: "text/plain; charset=utf-8",
+			expectedBody:        "429 Too Many Requests\n\nRate limit exceeded\n\nRequest ID: req-1\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			renderer := NewRenderer(pages)
+			req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+
+			// Act
+			renderer.Render(rec, req, tt.err, "req-1")
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, tt.expectedContentType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, tt.expectedBody, rec.Body.String())
+		})
+	}
+}
+
+func TestRenderer_Render_ProblemJSON(t *testing.T) {
+	// Arrange
+	err := WrapError(ErrCodeAccessDenied, "blocked", nil).
+		WithHTTPStatus(http.StatusNotAcceptable).
+		WithContext("retry_after", 30).
+		WithContext("backend_url", "http://internal:8080")
+	req := httptest.NewRequest(http.MethodPost, "/api/items", nil)
+	rec := httptest.NewRecorder()
+
+	// Act
+	WriteProblem(rec, req, err, "req-42")
+
+	// Assert
+	require.Equal(t, http.StatusNotAcceptable, rec.Code)
+	assert.Equal(t, ProblemContentType, rec.Header().Get("Content-Type"))
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, map[string]any{
+		"type":        "urn:rwwwrse:error:access_denied",
+		"title":       "Not Acceptable",
+		"status":      float64(http.StatusNotAcceptable),
+		"detail":      "blocked",
+		"instance":    "/api/items",
+		"request_id":  "req-42",
+		"code":        "access_denied",
+		"retry_after": float64(30),
+	}, body)
+}
+
+func TestRendererFromContext_Default(t *testing.T) {
+	// Arrange
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept", "text/html")
+	rec := httptest.NewRecorder()
+
+	// Act
+	WriteProblem(rec, req, WrapError(ErrCodeInternalError, "<script>", nil), "")
+
+	// Assert
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<h1>500 Internal Server Error</h1>")
+	assert.Contains(t, rec.Body.String(), "&lt;script&gt;")
+}
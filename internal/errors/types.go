@@ -60,6 +60,9 @@ const (
 	ErrCodeInternalError
 	ErrCodeServiceUnavailable
 	ErrCodeNotImplemented
+
+	// Authentication errors
+	ErrCodeUnauthorized
 )
 
 func (e *ProxyError) Error() string {
@@ -155,6 +158,8 @@ func (code ProxyErrorCode) String() string {
 		return "service_unavailable"
 	case ErrCodeNotImplemented:
 		return "not_implemented"
+	case ErrCodeUnauthorized:
+		return "unauthorized"
 	default:
 		return "unknown_error"
 	}
@@ -170,6 +175,8 @@ func (code ProxyErrorCode) HTTPStatus() int {
 		return http.StatusNotFound
 	case ErrCodeRateLimited:
 		return http.StatusTooManyRequests
+	case ErrCodeUnauthorized:
+		return http.StatusUnauthorized
 	case ErrCodeAccessDenied, ErrCodeInvalidOrigin:
 		return http.StatusForbidden
 	case ErrCodeRequestInvalid, ErrCodeBackendInvalidResponse:
@@ -334,7 +341,7 @@ func IsSecurity(err error) bool {
 	var proxyErr *ProxyError
 	if errors.As(err, &proxyErr) {
 		switch proxyErr.Code {
-		case ErrCodeRateLimited, ErrCodeAccessDenied, ErrCodeInvalidOrigin:
+		case ErrCodeRateLimited, ErrCodeAccessDenied, ErrCodeInvalidOrigin, ErrCodeUnauthorized:
 			return true
 		}
 	}
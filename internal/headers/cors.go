@@ -0,0 +1,86 @@
+package headers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// CORSMethods are the methods a CORS policy may allow.
+var CORSMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodConnect,
+	http.MethodOptions,
+	http.MethodTrace,
+}
+
+// CORSPolicy is a CORS policy. An empty method list is valid; the caller
+// supplies its default methods.
+type CORSPolicy struct {
+	AllowedOrigins        []string
+	AllowedOriginPatterns []string
+	AllowedMethods        []string
+	AllowedHeaders        []string
+	ExposedHeaders        []string
+	AllowCredentials      bool
+	MaxAge                time.Duration
+}
+
+// ValidateCORSPolicy validates a CORS policy, both at config load and when
+// the middleware is created.
+func ValidateCORSPolicy(policy CORSPolicy) error {
+	if len(policy.AllowedOrigins) == 0 && len(policy.AllowedOriginPatterns) == 0 {
+		return ErrCORSNoOrigins
+	}
+
+	for _, pattern := range policy.AllowedOriginPatterns {
+		if _, err := CompileOriginPattern(pattern); err != nil {
+			return fmt.Errorf("%w: %q: %v", ErrCORSInvalidOriginPattern, pattern, err)
+		}
+	}
+
+	// Browsers treat "*" literally in credentialed responses, so wildcards
+	// there never match.
+	if policy.AllowCredentials {
+		if slices.Contains(policy.AllowedOrigins, "*") {
+			return ErrCORSWildcardWithCredentials
+		}
+		if slices.Contains(policy.AllowedHeaders, "*") || slices.Contains(policy.ExposedHeaders, "*") {
+			return ErrCORSWildcardHeadersWithCredentials
+		}
+	}
+
+	for _, method := range policy.AllowedMethods {
+		if !slices.Contains(CORSMethods, method) {
+			return fmt.Errorf("%w: %q", ErrCORSInvalidMethod, method)
+		}
+	}
+
+	if policy.MaxAge < 0 {
+		return ErrCORSInvalidMaxAge
+	}
+
+	return nil
+}
+
+// CompileOriginPattern compiles an origin pattern anchored at both ends.
+func CompileOriginPattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+// CORS errors.
+var (
+	ErrCORSNoOrigins                      = fmt.Errorf("no allowed origins configured")
+	ErrCORSWildcardWithCredentials        = fmt.Errorf("wildcard origin cannot be used with credentials")
+	ErrCORSInvalidMethod                  = fmt.Errorf("invalid HTTP method")
+	ErrCORSInvalidMaxAge                  = fmt.Errorf("invalid max age: must be non-negative")
+	ErrCORSInvalidOriginPattern           = fmt.Errorf("invalid origin pattern")
+	ErrCORSWildcardHeadersWithCredentials = fmt.Errorf("wildcard headers cannot be used with credentials")
+)
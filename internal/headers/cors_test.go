@@ -0,0 +1,64 @@
+package headers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCORSPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      CORSPolicy
+		expectedErr error
+	}{
+		{
+			name: "Validate_Policy_NoError",
+			policy: CORSPolicy{
+				AllowedOrigins: []string{"https://app.example.com"},
+				AllowedMethods: []string{http.MethodGet, http.MethodPost},
+				MaxAge:         time.Hour,
+			},
+		},
+		{
+			name:   "Validate_NoMethods_NoError",
+			policy: CORSPolicy{AllowedOriginPatterns: []string{`https://.+\.example\.com`}},
+		},
+		{
+			name:        "Validate_NoOrigins_Error",
+			policy:      CORSPolicy{AllowedMethods: []string{http.MethodGet}},
+			expectedErr: ErrCORSNoOrigins,
+		},
+		{
+			name:        "Validate_InvalidMethod_Error",
+			policy:      CORSPolicy{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"get"}},
+			expectedErr: ErrCORSInvalidMethod,
+		},
+		{
+			name:        "Validate_InvalidPattern_Error",
+			policy:      CORSPolicy{AllowedOriginPatterns: []string{"https://(unclosed"}},
+			expectedErr: ErrCORSInvalidOriginPattern,
+		},
+		{
+			name:        "Validate_NegativeMaxAge_Error",
+			policy:      CORSPolicy{AllowedOrigins: []string{"*"}, MaxAge: -time.Second},
+			expectedErr: ErrCORSInvalidMaxAge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			err := ValidateCORSPolicy(tt.policy)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package headers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Cookie SameSite values accepted by RewriteConfig.
+const (
+	SameSiteLax    = "lax"
+	SameSiteStrict = "strict"
+	SameSiteNone   = "none"
+)
+
+// RewriteConfig holds configuration for rewriting backend URLs and cookie
+// scopes in response headers, like nginx proxy_redirect,
+// proxy_cookie_domain and proxy_cookie_path.
+type RewriteConfig struct {
+	// BackendURL is the URL the route proxies to. Its path is the backend
+	// prefix that maps to the public prefix.
+	BackendURL *url.URL
+
+	// PublicURL is the scheme, host and path prefix clients use. When empty
+	// the scheme and host of each request are used with no prefix.
+	PublicURL string
+
+	// CookieDomain replaces cookie domains scoped to the backend host. When
+	// empty such domains are removed, making the cookies host-only.
+	CookieDomain string
+
+	// CookieSecure, CookieHTTPOnly and CookieSameSite force the
+	// corresponding attributes on every cookie.
+	CookieSecure   bool
+	CookieHTTPOnly bool
+	CookieSameSite string
+}
+
+// Rewriter rewrites Location, Content-Location, Refresh and Set-Cookie
+// headers of backend responses. It is safe for concurrent use.
+type Rewriter struct {
+	config RewriteConfig
+
+	backendHost   string
+	backendPrefix string
+
+	publicScheme string
+	publicHost   string
+	publicPrefix string
+}
+
+// NewRewriter creates a response header rewriter.
+func NewRewriter(config RewriteConfig) (*Rewriter, error) {
+	if config.BackendURL == nil || config.BackendURL.Host == "" {
+		return nil, ErrInvalidBackendURL
+	}
+
+	switch strings.ToLower(config.CookieSameSite) {
+	case "", SameSiteLax, SameSiteStrict:
+	case SameSiteNone:
+		if !config.CookieSecure {
+			return nil, fmt.Errorf("%w: SameSite=None requires Secure", ErrInvalidCookieAttribute)
+		}
+	default:
+		return nil, fmt.Errorf("%w: SameSite %q", ErrInvalidCookieAttribute, config.CookieSameSite)
+	}
+
+	rw := &Rewriter{
+		config:        config,
+		backendHost:   hostWithPort(config.BackendURL.Scheme, config.BackendURL.Host),
+		backendPrefix: strings.TrimSuffix(config.BackendURL.Path, "/"),
+	}
+
+	if config.PublicURL != "" {
+		public, err := url.Parse(config.PublicURL)
+		if err != nil || (public.Scheme != "http" && public.Scheme != "https") || public.Host == "" {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPublicURL, config.PublicURL)
+		}
+		rw.publicScheme = public.Scheme
+		rw.publicHost = public.Host
+		rw.publicPrefix = strings.TrimSuffix(public.Path, "/")
+	}
+
+	return rw, nil
+}
+
+// Apply rewrites the response headers for a request received with scheme
+// and host.
+func (rw *Rewriter) Apply(header http.Header, scheme, host string) {
+	if rw == nil {
+		return
+	}
+	if rw.publicHost != "" {
+		scheme, host = rw.publicScheme, rw.publicHost
+	}
+
+	for _, name := range []string{"Location", "Content-Location"} {
+		if value := header.Get(name); value != "" {
+			header.Set(name, rw.rewriteURL(value, scheme, host))
+		}
+	}
+
+	if refresh := header.Get("Refresh"); refresh != "" {
+		header.Set("Refresh", rw.rewriteRefresh(refresh, scheme, host))
+	}
+
+	if cookies := header.Values("Set-Cookie"); len(cookies) > 0 {
+		rewritten := make([]string, len(cookies))
+		for i, cookie := range cookies {
+			rewritten[i] = rw.rewriteCookie(cookie)
+		}
+		header["Set-Cookie"] = rewritten
+	}
+}
+
+// rewriteURL maps a URL on the backend to the public URL. Other URLs are
+// returned unchanged.
+func (rw *Rewriter) rewriteURL(value, scheme, host string) string {
+	target, err := url.Parse(value)
+	if err != nil || target.Opaque != "" {
+		return value
+	}
+
+	if target.Host != "" {
+		if hostWithPort(target.Scheme, target.Host) != rw.backendHost {
+			return value
+		}
+	} else if !strings.HasPrefix(target.Path, "/") {
+		// Relative references resolve against the public URL already.
+		return value
+	}
+
+	path, ok := rw.mapPath(target.Path)
+	if !ok {
+		return value
+	}
+
+	if target.Host != "" {
+		target.Scheme = scheme
+		target.Host = host
+	}
+	target.Path = path
+	target.RawPath = ""
+	return target.String()
+}
+
+// rewriteRefresh rewrites the URL of a Refresh header such as
+// "5; url=http://backend/next".
+func (rw *Rewriter) rewriteRefresh(value, scheme, host string) string {
+	delay, rest, found := strings.Cut(value, ";")
+	if !found {
+		delay, rest, found = strings.Cut(value, ",")
+	}
+	if !found {
+		return value
+	}
+
+	rest = strings.TrimSpace(rest)
+	if len(rest) < 4 || !strings.EqualFold(rest[:4], "url=") {
+		return value
+	}
+	target := strings.Trim(strings.TrimSpace(rest[4:]), `"'`)
+	return delay + "; url=" + rw.rewriteURL(target, scheme, host)
+}
+
+// rewriteCookie rewrites the Domain and Path attributes of a Set-Cookie
+// header and forces the configured attributes.
+func (rw *Rewriter) rewriteCookie(value string) string {
+	parts := strings.Split(value, ";")
+	attributes := make([]string, 0, len(parts)+3)
+	attributes = append(attributes, strings.TrimSpace(parts[0]))
+
+	backendHostname := strings.ToLower(rw.config.BackendURL.Hostname())
+	hasSecure, hasHTTPOnly := false, false
+
+	for _, part := range parts[1:] {
+		attr := strings.TrimSpace(part)
+		name, arg, _ := strings.Cut(attr, "=")
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "domain":
+			if strings.ToLower(strings.TrimPrefix(strings.TrimSpace(arg), ".")) == backendHostname {
+				if rw.config.CookieDomain == "" {
+					continue
+				}
+				attr = "Domain=" + rw.config.CookieDomain
+			}
+		case "path":
+			if path, ok := rw.mapPath(strings.TrimSpace(arg)); ok {
+				attr = "Path=" + path
+			}
+		case "secure":
+			hasSecure = true
+		case "httponly":
+			hasHTTPOnly = true
+		case "samesite":
+			if rw.config.CookieSameSite != "" {
+				continue
+			}
+		}
+		if attr != "" {
+			attributes = append(attributes, attr)
+		}
+	}
+
+	if rw.config.CookieSecure && !hasSecure {
+		attributes = append(attributes, "Secure")
+	}
+	if rw.config.CookieHTTPOnly && !hasHTTPOnly {
+		attributes = append(attributes, "HttpOnly")
+	}
+	if sameSite := strings.ToLower(rw.config.CookieSameSite); sameSite != "" {
+		attributes = append(attributes, "SameSite="+strings.ToUpper(sameSite[:1])+sameSite[1:])
+	}
+
+	return strings.Join(attributes, "; ")
+}
+
+// mapPath maps a path under the backend prefix to the public prefix and
+// reports whether the path was under the backend prefix.
+func (rw *Rewriter) mapPath(path string) (string, bool) {
+	if rw.backendPrefix == rw.publicPrefix {
+		return path, true
+	}
+	if path != rw.backendPrefix && !strings.HasPrefix(path, rw.backendPrefix+"/") {
+		return path, false
+	}
+
+	mapped := rw.publicPrefix + strings.TrimPrefix(path, rw.backendPrefix)
+	if mapped == "" {
+		mapped = "/"
+	}
+	return mapped, true
+}
+
+// hostWithPort returns the lowercase host of a URL with an explicit port.
+func hostWithPort(scheme, host string) string {
+	host = strings.ToLower(host)
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+
+	port := "80"
+	if strings.EqualFold(scheme, "https") {
+		port = "443"
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), port)
+}
+
+// Rewriter errors.
+var (
+	ErrInvalidBackendURL      = fmt.Errorf("rewrite requires an absolute backend URL")
+	ErrInvalidPublicURL       = fmt.Errorf("invalid public URL")
+	ErrInvalidCookieAttribute = fmt.Errorf("invalid cookie attribute")
+)
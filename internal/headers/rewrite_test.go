@@ -0,0 +1,268 @@
+package headers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRewriter creates a rewriter for backendURL.
+func newTestRewriter(t *testing.T, backendURL string, config RewriteConfig) *Rewriter {
+	t.Helper()
+
+	backend, err := url.Parse(backendURL)
+	require.NoError(t, err)
+	config.BackendURL = backend
+
+	rw, err := NewRewriter(config)
+	require.NoError(t, err)
+	return rw
+}
+
+func TestNewRewriter(t *testing.T) {
+	backend, err := url.Parse("http://10.0.0.5:3000")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		config      RewriteConfig
+		expectedErr error
+	}{
+		{
+			name:   "NewRewriter_Defaults_Created",
+			config: RewriteConfig{BackendURL: backend},
+		},
+		{
+			name:        "NewRewriter_NoBackend_Error",
+			config:      RewriteConfig{},
+			expectedErr: ErrInvalidBackendURL,
+		},
+		{
+			name:        "NewRewriter_RelativePublicURL_Error",
+			config:      RewriteConfig{BackendURL: backend, PublicURL: "/app"},
+			expectedErr: ErrInvalidPublicURL,
+		},
+		{
+			name:        "NewRewriter_SameSiteNoneWithoutSecure_Error",
+			config:      RewriteConfig{BackendURL: backend, CookieSameSite: SameSiteNone},
+			expectedErr: ErrInvalidCookieAttribute,
+		},
+		{
+			name:        "NewRewriter_UnknownSameSite_Error",
+			config:      RewriteConfig{BackendURL: backend, CookieSameSite: "loose"},
+			expectedErr: ErrInvalidCookieAttribute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			rw, err := NewRewriter(tt.config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Nil(t, rw)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, rw)
+		})
+	}
+}
+
+func TestRewriter_Apply_Location(t *testing.T) {
+	tests := []struct {
+		name       string
+		backendURL string
+		publicURL  string
+		location   string
+		expected   string
+	}{
+		{
+			name:       "Location_BackendHost_RequestHost",
+			backendURL: "http://10.0.0.5:3000",
+			location:   "http://10.0.0.5:3000/login?next=%2F#top",
+			expected:   "https://app.example.com/login?next=%2F#top",
+		},
+		{
+			name:       "Location_DefaultPort_Matched",
+			backendURL: "http://backend.internal",
+			location:   "http://BACKEND.internal:80/login",
+			expected:   "https://app.example.com/login",
+		},
+		{
+			name:       "Location_OtherHost_Unchanged",
+			backendURL: "http://10.0.0.5:3000",
+			location:   "https://idp.example.net/authorize",
+			expected:   "https://idp.example.net/authorize",
+		},
+		{
+			name:       "Location_BackendPrefix_Stripped",
+			backendURL: "http://10.0.0.5:3000/app/",
+			location:   "http://10.0.0.5:3000/app/login",
+			expected:   "https://app.example.com/login",
+		},
+		{
+			name:       "Location_AbsolutePathUnderBackendPrefix_Stripped",
+			backendURL: "http://10.0.0.5:3000/app",
+			location:   "/app/login",
+			expected:   "/login",
+		},
+		{
+			name:       "Location_PublicPrefix_Added",
+			backendURL: "http://10.0.0.5:3000",
+			publicURL:  "https://portal.example.com/wiki/",
+			location:   "http://10.0.0.5:3000/page/1",
+			expected:   "https://portal.example.com/wiki/page/1",
+		},
+		{
+			name:       "Location_AbsolutePathWithPublicPrefix_Prefixed",
+			backendURL: "http://10.0.0.5:3000",
+			publicURL:  "https://portal.example.com/wiki",
+			location:   "/",
+			expected:   "/wiki/",
+		},
+		{
+			name:       "Location_Relative_Unchanged",
+			backendURL: "http://10.0.0.5:3000/app",
+			location:   "next",
+			expected:   "next",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			rw := newTestRewriter(t, tt.backendURL, RewriteConfig{PublicURL: tt.publicURL})
+			header := http.Header{"Location": {tt.location}, "Content-Location": {tt.location}}
+
+			// Act
+			rw.Apply(header, "https", "app.example.com")
+
+			// Assert
+			assert.Equal(t, tt.expected, header.Get("Location"))
+			assert.Equal(t, tt.expected, header.Get("Content-Location"))
+		})
+	}
+}
+
+func TestRewriter_Apply_Refresh(t *testing.T) {
+	tests := []struct {
+		name     string
+		refresh  string
+		expected string
+	}{
+		{
+			name:     "Refresh_BackendURL_Rewritten",
+			refresh:  "5; url=http://10.0.0.5:3000/done",
+			expected: "5; url=https://app.example.com/done",
+		},
+		{
+			name:     "Refresh_QuotedCommaSeparated_Rewritten",
+			refresh:  `0,URL="http://10.0.0.5:3000/"`,
+			expected: "0; url=https://app.example.com/",
+		},
+		{
+			name:     "Refresh_DelayOnly_Unchanged",
+			refresh:  "30",
+			expected: "30",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			rw := newTestRewriter(t, "http://10.0.0.5:3000", RewriteConfig{})
+			header := http.Header{"Refresh": {tt.refresh}}
+
+			// Act
+			rw.Apply(header, "https", "app.example.com")
+
+			// Assert
+			assert.Equal(t, tt.expected, header.Get("Refresh"))
+		})
+	}
+}
+
+func TestRewriter_Apply_SetCookie(t *testing.T) {
+	tests := []struct {
+		name       string
+		backendURL string
+		config     RewriteConfig
+		cookie     string
+		expected   string
+	}{
+		{
+			name:       "SetCookie_BackendDomain_Removed",
+			backendURL: "http://backend.internal:3000",
+			cookie:     "sid=abc; Domain=.backend.internal; Path=/; Max-Age=60",
+			expected:   "sid=abc; Path=/; Max-Age=60",
+		},
+		{
+			name:       "SetCookie_BackendDomain_Replaced",
+			backendURL: "http://backend.internal:3000",
+			config:     RewriteConfig{CookieDomain: "example.com"},
+			cookie:     "sid=abc; Domain=backend.internal",
+			expected:   "sid=abc; Domain=example.com",
+		},
+		{
+			name:       "SetCookie_OtherDomain_Unchanged",
+			backendURL: "http://backend.internal:3000",
+			cookie:     "sid=abc; Domain=example.org",
+			expected:   "sid=abc; Domain=example.org",
+		},
+		{
+			name:       "SetCookie_Path_Mapped",
+			backendURL: "http://backend.internal:3000/app",
+			config:     RewriteConfig{PublicURL: "https://portal.example.com/tools"},
+			cookie:     "sid=abc; Path=/app/admin",
+			expected:   "sid=abc; Path=/tools/admin",
+		},
+		{
+			name:       "SetCookie_RootPath_Mapped",
+			backendURL: "http://backend.internal:3000/app",
+			cookie:     "sid=abc; Path=/app",
+			expected:   "sid=abc; Path=/",
+		},
+		{
+			name:       "SetCookie_ForcedAttributes_Added",
+			backendURL: "http://backend.internal:3000",
+			config: RewriteConfig{
+				CookieSecure:   true,
+				CookieHTTPOnly: true,
+				CookieSameSite: SameSiteStrict,
+			},
+			cookie:   "sid=abc; samesite=none; secure",
+			expected: "sid=abc; secure; HttpOnly; SameSite=Strict",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			rw := newTestRewriter(t, tt.backendURL, tt.config)
+			header := http.Header{"Set-Cookie": {tt.cookie, "other=1"}}
+
+			// Act
+			rw.Apply(header, "https", "app.example.com")
+
+			// Assert
+			cookies := header.Values("Set-Cookie")
+			require.Len(t, cookies, 2)
+			assert.Equal(t, tt.expected, cookies[0])
+		})
+	}
+}
+
+func TestRewriter_Nil(t *testing.T) {
+	var rw *Rewriter
+	header := http.Header{"Location": {"http://10.0.0.5:3000/"}}
+
+	rw.Apply(header, "https", "app.example.com")
+
+	assert.Equal(t, "http://10.0.0.5:3000/", header.Get("Location"))
+}
@@ -0,0 +1,253 @@
+// Package headers implements declarative request and response header
+// manipulation rules with values templated from request data.
+package headers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Rule actions.
+const (
+	ActionSet    = "set"
+	ActionAdd    = "add"
+	ActionRemove = "remove"
+	ActionRename = "rename"
+)
+
+// Presets of common header hygiene rules.
+const (
+	// PresetHideBackend removes response headers that identify the
+	// backend software.
+	PresetHideBackend = "hide_backend"
+
+	// PresetStripInternal removes internal headers from inbound requests
+	// so that clients cannot inject them.
+	PresetStripInternal = "strip_internal"
+)
+
+// hideBackendHeaders are the response headers removed by PresetHideBackend.
+var hideBackendHeaders = []string{"Server", "X-Powered-By", "X-AspNet-Version", "X-AspNetMvc-Version"}
+
+// stripInternalHeaders are the request headers removed by PresetStripInternal.
+var stripInternalHeaders = []string{"X-Internal-*", "X-Rwwwrse-*"}
+
+// Rule is a single header change. Name may end in "*" for remove rules to
+// match every header with that prefix. Value is a template for set and add
+// rules; To is the new name for rename rules. IfPresent and IfAbsent make
+// the rule conditional on another header of the same message.
+type Rule struct {
+	Action    string
+	Name      string
+	Value     string
+	To        string
+	IfPresent string
+	IfAbsent  string
+}
+
+// Config holds the header rules of a route.
+type Config struct {
+	Presets  []string
+	Request  []Rule
+	Response []Rule
+}
+
+// compiledRule is a validated rule with a parsed value template.
+type compiledRule struct {
+	action    string
+	name      string
+	prefix    bool
+	value     Template
+	to        string
+	ifPresent string
+	ifAbsent  string
+}
+
+// Rules applies compiled header rules to requests and responses. It is safe
+// for concurrent use.
+type Rules struct {
+	request  []compiledRule
+	response []compiledRule
+}
+
+// Compile validates a header rule configuration. Preset rules run before
+// the configured rules of the same direction.
+func Compile(config Config) (*Rules, error) {
+	rules := &Rules{}
+
+	for _, preset := range config.Presets {
+		switch preset {
+		case PresetHideBackend:
+			for _, name := range hideBackendHeaders {
+				rules.response = append(rules.response, removeRule(name))
+			}
+		case PresetStripInternal:
+			for _, name := range stripInternalHeaders {
+				rules.request = append(rules.request, removeRule(name))
+			}
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrUnknownPreset, preset)
+		}
+	}
+
+	for i, rule := range config.Request {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("request rule %d: %w", i, err)
+		}
+		rules.request = append(rules.request, compiled)
+	}
+
+	for i, rule := range config.Response {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("response rule %d: %w", i, err)
+		}
+		rules.response = append(rules.response, compiled)
+	}
+
+	return rules, nil
+}
+
+// Empty reports whether there are no rules in either direction.
+func (r *Rules) Empty() bool {
+	return r == nil || (len(r.request) == 0 && len(r.response) == 0)
+}
+
+// ApplyRequest applies the request rules to the outbound request headers.
+func (r *Rules) ApplyRequest(header http.Header, vars Vars) {
+	if r == nil {
+		return
+	}
+	apply(r.request, header, vars)
+}
+
+// ApplyResponse applies the response rules to the backend response headers.
+func (r *Rules) ApplyResponse(header http.Header, vars Vars) {
+	if r == nil {
+		return
+	}
+	apply(r.response, header, vars)
+}
+
+// apply applies rules to header in order.
+func apply(rules []compiledRule, header http.Header, vars Vars) {
+	for _, rule := range rules {
+		if rule.ifPresent != "" && len(header.Values(rule.ifPresent)) == 0 {
+			continue
+		}
+		if rule.ifAbsent != "" && len(header.Values(rule.ifAbsent)) > 0 {
+			continue
+		}
+
+		switch rule.action {
+		case ActionSet:
+			header.Set(rule.name, rule.value.Render(vars))
+		case ActionAdd:
+			header.Add(rule.name, rule.value.Render(vars))
+		case ActionRemove:
+			if !rule.prefix {
+				header.Del(rule.name)
+				continue
+			}
+			for name := range header {
+				if strings.HasPrefix(name, rule.name) {
+					delete(header, name)
+				}
+			}
+		case ActionRename:
+			values := header.Values(rule.name)
+			if len(values) == 0 {
+				continue
+			}
+			values = append([]string(nil), values...)
+			header.Del(rule.name)
+			header.Del(rule.to)
+			for _, value := range values {
+				header.Add(rule.to, value)
+			}
+		}
+	}
+}
+
+// compileRule validates a rule and parses its value template.
+func compileRule(rule Rule) (compiledRule, error) {
+	compiled := compiledRule{
+		action:    rule.Action,
+		name:      http.CanonicalHeaderKey(rule.Name),
+		ifPresent: http.CanonicalHeaderKey(rule.IfPresent),
+		ifAbsent:  http.CanonicalHeaderKey(rule.IfAbsent),
+	}
+
+	if strings.HasSuffix(rule.Name, "*") {
+		if rule.Action != ActionRemove {
+			return compiledRule{}, fmt.Errorf("%w: only remove rules accept a prefix", ErrInvalidHeaderName)
+		}
+		compiled.prefix = true
+		compiled.name = http.CanonicalHeaderKey(strings.TrimSuffix(rule.Name, "*"))
+	}
+	if !validHeaderName(strings.TrimSuffix(rule.Name, "*")) {
+		return compiledRule{}, fmt.Errorf("%w: %q", ErrInvalidHeaderName, rule.Name)
+	}
+	for _, name := range []string{rule.IfPresent, rule.IfAbsent} {
+		if name != "" && !validHeaderName(name) {
+			return compiledRule{}, fmt.Errorf("%w: %q", ErrInvalidHeaderName, name)
+		}
+	}
+
+	switch rule.Action {
+	case ActionSet, ActionAdd:
+		value, err := ParseTemplate(rule.Value)
+		if err != nil {
+			return compiledRule{}, err
+		}
+		compiled.value = value
+	case ActionRemove:
+	case ActionRename:
+		if !validHeaderName(rule.To) {
+			return compiledRule{}, fmt.Errorf("%w: rename target %q", ErrInvalidHeaderName, rule.To)
+		}
+		compiled.to = http.CanonicalHeaderKey(rule.To)
+	default:
+		return compiledRule{}, fmt.Errorf("%w: %q", ErrUnknownAction, rule.Action)
+	}
+
+	return compiled, nil
+}
+
+// removeRule returns a compiled remove rule for a header name or prefix.
+func removeRule(name string) compiledRule {
+	prefix := strings.HasSuffix(name, "*")
+	return compiledRule{
+		action: ActionRemove,
+		name:   http.CanonicalHeaderKey(strings.TrimSuffix(name, "*")),
+		prefix: prefix,
+	}
+}
+
+// validHeaderName reports whether name is a non-empty HTTP field name token.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Header rule errors.
+var (
+	ErrUnknownAction        = fmt.Errorf("unknown header rule action")
+	ErrUnknownPreset        = fmt.Errorf("unknown header rule preset")
+	ErrInvalidHeaderName    = fmt.Errorf("invalid header name")
+	ErrUnknownVariable      = fmt.Errorf("unknown header template variable")
+	ErrUnterminatedVariable = fmt.Errorf("unterminated header template variable")
+)
@@ -0,0 +1,245 @@
+package headers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/albedosehen/rwwwrse/internal/proxyproto"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      Config
+		expectedErr error
+	}{
+		{
+			name: "Compile_AllActions_Compiled",
+			config: Config{
+				Presets: []string{PresetHideBackend, PresetStripInternal},
+				Request: []Rule{
+					{Action: ActionSet, Name: "X-Client-IP", Value: "{client_ip}"},
+					{Action: ActionAdd, Name: "Via", Value: "rwwwrse"},
+					{Action: ActionRemove, Name: "X-Debug-*"},
+					{Action: ActionRename, Name: "X-User", To: "X-Remote-User"},
+				},
+			},
+		},
+		{
+			name:        "Compile_UnknownPreset_Error",
+			config:      Config{Presets: []string{"hide_everything"}},
+			expectedErr: ErrUnknownPreset,
+		},
+		{
+			name:        "Compile_UnknownAction_Error",
+			config:      Config{Request: []Rule{{Action: "replace", Name: "X-A"}}},
+			expectedErr: ErrUnknownAction,
+		},
+		{
+			name:        "Compile_InvalidName_Error",
+			config:      Config{Response: []Rule{{Action: ActionSet, Name: "X A", Value: "1"}}},
+			expectedErr: ErrInvalidHeaderName,
+		},
+		{
+			name:        "Compile_PrefixOnSet_Error",
+			config:      Config{Response: []Rule{{Action: ActionSet, Name: "X-A-*", Value: "1"}}},
+			expectedErr: ErrInvalidHeaderName,
+		},
+		{
+			name:        "Compile_RenameWithoutTarget_Error",
+			config:      Config{Response: []Rule{{Action: ActionRename, Name: "X-A"}}},
+			expectedErr: ErrInvalidHeaderName,
+		},
+		{
+			name:        "Compile_UnknownVariable_Error",
+			config:      Config{Request: []Rule{{Action: ActionSet, Name: "X-A", Value: "{client_address}"}}},
+			expectedErr: ErrUnknownVariable,
+		},
+		{
+			name:        "Compile_InvalidTLVType_Error",
+			config:      Config{Request: []Rule{{Action: ActionSet, Name: "X-A", Value: "{proxy_tlv:0x100}"}}},
+			expectedErr: ErrUnknownVariable,
+		},
+		{
+			name:        "Compile_UnterminatedVariable_Error",
+			config:      Config{Request: []Rule{{Action: ActionSet, Name: "X-A", Value: "{client_ip"}}},
+			expectedErr: ErrUnterminatedVariable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			rules, err := Compile(tt.config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Nil(t, rules)
+				return
+			}
+			require.NoError(t, err)
+			assert.False(t, rules.Empty())
+		})
+	}
+}
+
+func TestRules_Apply(t *testing.T) {
+	vars := Vars{
+		ClientIP:  "203.0.113.7",
+		RequestID: "req-1",
+		Host:      "app.example.com",
+		Route:     "app",
+		Header:    http.Header{"User-Agent": {"curl/8"}},
+	}
+
+	tests := []struct {
+		name     string
+		rules    []Rule
+		header   http.Header
+		expected http.Header
+	}{
+		{
+			name:     "Apply_SetTemplate_Rendered",
+			rules:    []Rule{{Action: ActionSet, Name: "x-client", Value: "{client_ip} via {route} ({header:user-agent})"}},
+			header:   http.Header{"X-Client": {"spoofed"}},
+			expected: http.Header{"X-Client": {"203.0.113.7 via app (curl/8)"}},
+		},
+		{
+			name:     "Apply_Add_Appended",
+			rules:    []Rule{{Action: ActionAdd, Name: "Via", Value: "1.1 {host}"}},
+			header:   http.Header{"Via": {"1.1 edge"}},
+			expected: http.Header{"Via": {"1.1 edge", "1.1 app.example.com"}},
+		},
+		{
+			name:     "Apply_RemovePrefix_Removed",
+			rules:    []Rule{{Action: ActionRemove, Name: "x-debug-*"}},
+			header:   http.Header{"X-Debug-Sql": {"1"}, "X-Debug-Time": {"2"}, "X-Debugger": {"3"}},
+			expected: http.Header{"X-Debugger": {"3"}},
+		},
+		{
+			name:     "Apply_Rename_MovesValues",
+			rules:    []Rule{{Action: ActionRename, Name: "X-User", To: "X-Remote-User"}},
+			header:   http.Header{"X-User": {"alice", "bob"}, "X-Remote-User": {"mallory"}},
+			expected: http.Header{"X-Remote-User": {"alice", "bob"}},
+		},
+		{
+			name:     "Apply_RenameMissing_Unchanged",
+			rules:    []Rule{{Action: ActionRename, Name: "X-User", To: "X-Remote-User"}},
+			header:   http.Header{"X-Remote-User": {"mallory"}},
+			expected: http.Header{"X-Remote-User": {"mallory"}},
+		},
+		{
+			name: "Apply_IfPresent_Conditional",
+			rules: []Rule{
+				{Action: ActionSet, Name: "X-Authenticated", Value: "true", IfPresent: "Authorization"},
+				{Action: ActionSet, Name: "X-Anonymous", Value: "true", IfAbsent: "Authorization"},
+			},
+			header:   http.Header{"Authorization": {"Bearer t"}},
+			expected: http.Header{"Authorization": {"Bearer t"}, "X-Authenticated": {"true"}},
+		},
+		{
+			name:     "Apply_EscapedBraces_Literal",
+			rules:    []Rule{{Action: ActionSet, Name: "X-Json", Value: `{{"id":"{request_id}"}}`}},
+			header:   http.Header{},
+			expected: http.Header{"X-Json": {`{"id":"req-1"}`}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			rules, err := Compile(Config{Request: tt.rules, Response: tt.rules})
+			require.NoError(t, err)
+			request := tt.header.Clone()
+			response := tt.header.Clone()
+
+			// Act
+			rules.ApplyRequest(request, vars)
+			rules.ApplyResponse(response, vars)
+
+			// Assert
+			assert.Equal(t, tt.expected, request)
+			assert.Equal(t, tt.expected, response)
+		})
+	}
+}
+
+func TestRules_Apply_ProxyTLVs(t *testing.T) {
+	// Arrange
+	rules, err := Compile(Config{Request: []Rule{
+		{Action: ActionSet, Name: "X-VPC-Endpoint", Value: "{aws_vpce_id}"},
+		{Action: ActionSet, Name: "X-LB-Connection", Value: "{proxy_tlv:0x05}"},
+		{Action: ActionSet, Name: "X-LB-Custom", Value: "{proxy_tlv:225}"},
+		{Action: ActionSet, Name: "X-LB-Missing", Value: "{proxy_tlv:0xE2}"},
+	}})
+	require.NoError(t, err)
+
+	vars := Vars{Proxy: &proxyproto.Header{TLVs: []proxyproto.TLV{
+		{Type: proxyproto.TLVTypeAWS, Value: append([]byte{0x01}, "vpce-0abc123"...)},
+		{Type: proxyproto.TLVTypeUniqueID, Value: []byte("conn-42")},
+		{Type: 0xE1, Value: []byte{0x00, 0xff}},
+	}}}
+	header := http.Header{}
+
+	// Act
+	rules.ApplyRequest(header, vars)
+
+	// Assert
+	assert.Equal(t, "vpce-0abc123", header.Get("X-VPC-Endpoint"))
+	assert.Equal(t, "conn-42", header.Get("X-LB-Connection"))
+	assert.Equal(t, "00ff", header.Get("X-LB-Custom"))
+	assert.Equal(t, []string{""}, header.Values("X-LB-Missing"))
+}
+
+func TestRules_Presets(t *testing.T) {
+	// Arrange
+	rules, err := Compile(Config{Presets: []string{PresetHideBackend, PresetStripInternal}})
+	require.NoError(t, err)
+
+	request := http.Header{"X-Internal-Token": {"t"}, "X-Rwwwrse-Route": {"r"}, "Accept": {"*/*"}}
+	response := http.Header{"Server": {"nginx"}, "X-Powered-By": {"PHP/8"}, "Content-Type": {"text/html"}}
+
+	// Act
+	rules.ApplyRequest(request, Vars{})
+	rules.ApplyResponse(response, Vars{})
+
+	// Assert
+	assert.Equal(t, http.Header{"Accept": {"*/*"}}, request)
+	assert.Equal(t, http.Header{"Content-Type": {"text/html"}}, response)
+}
+
+func TestRules_Nil(t *testing.T) {
+	var rules *Rules
+	header := http.Header{"Server": {"nginx"}}
+
+	rules.ApplyRequest(header, Vars{})
+	rules.ApplyResponse(header, Vars{})
+
+	assert.True(t, rules.Empty())
+	assert.Equal(t, http.Header{"Server": {"nginx"}}, header)
+}
+
+func TestNewVars(t *testing.T) {
+	// Arrange
+	req := httptest.NewRequest(http.MethodPost, "https://app.example.com/api/items?x=1", nil)
+	req.TLS = &tls.ConnectionState{Version: tls.VersionTLS13}
+
+	// Act
+	vars := NewVars(req, "app", "198.51.100.2", "req-9")
+
+	// Assert
+	assert.Equal(t, "https", vars.Scheme)
+	assert.Equal(t, "TLS 1.3", vars.TLSVersion)
+	assert.Equal(t, "app.example.com", vars.Host)
+	assert.Equal(t, "/api/items", vars.Path)
+	assert.Equal(t, http.MethodPost, vars.Method)
+	assert.Equal(t, "198.51.100.2", vars.ClientIP)
+	assert.Equal(t, "req-9", vars.RequestID)
+	assert.Equal(t, "app", vars.Route)
+}
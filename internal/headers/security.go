@@ -0,0 +1,139 @@
+package headers
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HSTSPreloadMinMaxAge is the minimum max-age accepted by the HSTS preload list.
+const HSTSPreloadMinMaxAge = 365 * 24 * time.Hour
+
+// Allowed values of the policy headers.
+var (
+	ReferrerPolicies = []string{
+		"no-referrer", "no-referrer-when-downgrade", "origin", "origin-when-cross-origin",
+		"same-origin", "strict-origin", "strict-origin-when-cross-origin", "unsafe-url",
+	}
+	CrossOriginOpenerPolicies   = []string{"unsafe-none", "same-origin-allow-popups", "same-origin", "noopener-allow-popups"}
+	CrossOriginEmbedderPolicies = []string{"unsafe-none", "require-corp", "credentialless"}
+	CrossOriginResourcePolicies = []string{"same-site", "same-origin", "cross-origin"}
+)
+
+// permissionsPolicyItem matches one Permissions-Policy directive such as
+// camera=() or geolocation=(self "https://maps.example.com").
+var permissionsPolicyItem = regexp.MustCompile(`^[a-z][a-z0-9-]*=(\*|self|\((\s*(self|src|\*|"[^"\s]+"))*\s*\))$`)
+
+// SecurityValues are security response header values. Empty values are not
+// validated.
+type SecurityValues struct {
+	ContentSecurityPolicy     string
+	StrictTransportSecurity   string
+	FrameOptions              string
+	ReferrerPolicy            string
+	PermissionsPolicy         string
+	CrossOriginOpenerPolicy   string
+	CrossOriginEmbedderPolicy string
+	CrossOriginResourcePolicy string
+}
+
+// ValidateSecurityValues validates security response header values, both
+// at config load and when the middleware is created.
+func ValidateSecurityValues(values SecurityValues) error {
+	if values.ContentSecurityPolicy != "" && !strings.Contains(values.ContentSecurityPolicy, "default-src") {
+		return ErrInvalidCSP
+	}
+
+	if values.StrictTransportSecurity != "" {
+		if err := validateHSTS(values.StrictTransportSecurity); err != nil {
+			return err
+		}
+	}
+
+	if values.FrameOptions != "" && !slices.Contains([]string{"DENY", "SAMEORIGIN"}, values.FrameOptions) &&
+		!(len(values.FrameOptions) > 10 && strings.HasPrefix(values.FrameOptions, "ALLOW-FROM")) {
+		return ErrInvalidFrameOptions
+	}
+
+	if values.ReferrerPolicy != "" && !slices.Contains(ReferrerPolicies, values.ReferrerPolicy) {
+		return fmt.Errorf("%w: %q", ErrInvalidReferrerPolicy, values.ReferrerPolicy)
+	}
+
+	if values.PermissionsPolicy != "" {
+		for _, item := range strings.Split(values.PermissionsPolicy, ",") {
+			item = strings.TrimSpace(item)
+			if !permissionsPolicyItem.MatchString(item) {
+				return fmt.Errorf("%w: %q", ErrInvalidPermissionsPolicy, item)
+			}
+		}
+	}
+
+	if values.CrossOriginOpenerPolicy != "" && !slices.Contains(CrossOriginOpenerPolicies, values.CrossOriginOpenerPolicy) {
+		return fmt.Errorf("%w: Cross-Origin-Opener-Policy %q", ErrInvalidCrossOriginPolicy, values.CrossOriginOpenerPolicy)
+	}
+
+	if values.CrossOriginEmbedderPolicy != "" && !slices.Contains(CrossOriginEmbedderPolicies, values.CrossOriginEmbedderPolicy) {
+		return fmt.Errorf("%w: Cross-Origin-Embedder-Policy %q", ErrInvalidCrossOriginPolicy, values.CrossOriginEmbedderPolicy)
+	}
+
+	if values.CrossOriginResourcePolicy != "" && !slices.Contains(CrossOriginResourcePolicies, values.CrossOriginResourcePolicy) {
+		return fmt.Errorf("%w: Cross-Origin-Resource-Policy %q", ErrInvalidCrossOriginPolicy, values.CrossOriginResourcePolicy)
+	}
+
+	return nil
+}
+
+// FormatHSTS returns a Strict-Transport-Security header value.
+func FormatHSTS(maxAge time.Duration, includeSubdomains, preload bool) string {
+	hsts := fmt.Sprintf("max-age=%d", int64(maxAge.Seconds()))
+	if includeSubdomains {
+		hsts += "; includeSubDomains"
+	}
+	if preload {
+		hsts += "; preload"
+	}
+	return hsts
+}
+
+// validateHSTS validates a Strict-Transport-Security header value.
+// Preloading requires a max-age of at least one year and includeSubDomains.
+func validateHSTS(hsts string) error {
+	if !strings.Contains(hsts, "max-age=") {
+		return ErrInvalidHSTS
+	}
+
+	if !strings.Contains(strings.ToLower(hsts), "preload") {
+		return nil
+	}
+
+	maxAge := int64(-1)
+	includeSubdomains := false
+	for _, directive := range strings.Split(hsts, ";") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "max-age":
+			maxAge, _ = strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+		case "includesubdomains":
+			includeSubdomains = true
+		}
+	}
+	if maxAge < int64(HSTSPreloadMinMaxAge.Seconds()) || !includeSubdomains {
+		return ErrInvalidHSTSPreload
+	}
+
+	return nil
+}
+
+// Security header errors.
+var (
+	ErrInvalidCSP               = fmt.Errorf("invalid Content Security Policy")
+	ErrInvalidHSTS              = fmt.Errorf("invalid HTTP Strict Transport Security")
+	ErrInvalidFrameOptions      = fmt.Errorf("invalid X-Frame-Options")
+	ErrInvalidHSTSPreload       = fmt.Errorf("HSTS preload requires max-age of at least one year and includeSubDomains")
+	ErrInvalidReferrerPolicy    = fmt.Errorf("invalid Referrer-Policy")
+	ErrInvalidPermissionsPolicy = fmt.Errorf("invalid Permissions-Policy directive")
+	ErrInvalidCrossOriginPolicy = fmt.Errorf("invalid cross-origin policy")
+)
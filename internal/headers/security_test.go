@@ -0,0 +1,83 @@
+package headers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateSecurityValues(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      SecurityValues
+		expectedErr error
+	}{
+		{
+			name: "Validate_AllValid_NoError",
+			values: SecurityValues{
+				ContentSecurityPolicy:     "default-src 'self'",
+				StrictTransportSecurity:   "max-age=31536000; includeSubDomains; preload",
+				FrameOptions:              "DENY",
+				ReferrerPolicy:            "no-referrer",
+				PermissionsPolicy:         `camera=(), geolocation=(self "https://maps.example.com")`,
+				CrossOriginOpenerPolicy:   "same-origin",
+				CrossOriginEmbedderPolicy: "require-corp",
+				CrossOriginResourcePolicy: "same-site",
+			},
+		},
+		{
+			name:   "Validate_Empty_NoError",
+			values: SecurityValues{},
+		},
+		{
+			name:        "Validate_CSPWithoutDefaultSrc_Error",
+			values:      SecurityValues{ContentSecurityPolicy: "script-src 'self'"},
+			expectedErr: ErrInvalidCSP,
+		},
+		{
+			name:        "Validate_HSTSPreloadShortMaxAge_Error",
+			values:      SecurityValues{StrictTransportSecurity: "max-age=3600; includeSubDomains; preload"},
+			expectedErr: ErrInvalidHSTSPreload,
+		},
+		{
+			name:        "Validate_LowercaseFrameOptions_Error",
+			values:      SecurityValues{FrameOptions: "deny"},
+			expectedErr: ErrInvalidFrameOptions,
+		},
+		{
+			name:        "Validate_InvalidPermissionsPolicy_Error",
+			values:      SecurityValues{PermissionsPolicy: "camera=none"},
+			expectedErr: ErrInvalidPermissionsPolicy,
+		},
+		{
+			name:        "Validate_InvalidCOEP_Error",
+			values:      SecurityValues{CrossOriginEmbedderPolicy: "require-cors"},
+			expectedErr: ErrInvalidCrossOriginPolicy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			err := ValidateSecurityValues(tt.values)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestFormatHSTS(t *testing.T) {
+	// Act
+	hsts := FormatHSTS(HSTSPreloadMinMaxAge, true, true)
+
+	// Assert
+	assert.Equal(t, "max-age=31536000; includeSubDomains; preload", hsts)
+	assert.Equal(t, "max-age=3600", FormatHSTS(time.Hour, false, false))
+	assert.NoError(t, ValidateSecurityValues(SecurityValues{StrictTransportSecurity: hsts}))
+}
@@ -0,0 +1,215 @@
+package headers
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/albedosehen/rwwwrse/internal/proxyproto"
+)
+
+// Template variables available in header values. "{header:<name>}" expands
+// to the named header of the inbound request and "{proxy_tlv:<type>}" to a
+// PROXY protocol v2 TLV of the inbound connection, with the type in decimal
+// or 0x-prefixed hex.
+const (
+	VarClientIP   = "client_ip"
+	VarRequestID  = "request_id"
+	VarHost       = "host"
+	VarRoute      = "route"
+	VarTLSVersion = "tls_version"
+	VarScheme     = "scheme"
+	VarMethod     = "method"
+	VarPath       = "path"
+	VarAWSVPCE    = "aws_vpce_id"
+
+	varHeaderPrefix   = "header:"
+	varProxyTLVPrefix = "proxy_tlv:"
+)
+
+// templateVars are the names accepted by ParseTemplate.
+var templateVars = map[string]bool{
+	VarClientIP:   true,
+	VarRequestID:  true,
+	VarHost:       true,
+	VarRoute:      true,
+	VarTLSVersion: true,
+	VarScheme:     true,
+	VarMethod:     true,
+	VarPath:       true,
+	VarAWSVPCE:    true,
+}
+
+// Vars holds the request data header templates expand to.
+type Vars struct {
+	ClientIP   string
+	RequestID  string
+	Host       string
+	Route      string
+	TLSVersion string
+	Scheme     string
+	Method     string
+	Path       string
+
+	// Header is the inbound request header.
+	Header http.Header
+
+	// Proxy is the PROXY protocol header of the inbound connection, or nil.
+	Proxy *proxyproto.Header
+}
+
+// NewVars returns the template variables of an inbound request routed to
+// route. The client IP and request ID are resolved by the caller.
+func NewVars(r *http.Request, route, clientIP, requestID string) Vars {
+	vars := Vars{
+		ClientIP:  clientIP,
+		RequestID: requestID,
+		Host:      r.Host,
+		Route:     route,
+		Scheme:    "http",
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Header:    r.Header,
+		Proxy:     proxyproto.FromContext(r.Context()),
+	}
+	if r.TLS != nil {
+		vars.Scheme = "https"
+		vars.TLSVersion = tls.VersionName(r.TLS.Version)
+	}
+	return vars
+}
+
+// lookup returns the value of a template variable.
+func (v Vars) lookup(name string) string {
+	switch name {
+	case VarClientIP:
+		return v.ClientIP
+	case VarRequestID:
+		return v.RequestID
+	case VarHost:
+		return v.Host
+	case VarRoute:
+		return v.Route
+	case VarTLSVersion:
+		return v.TLSVersion
+	case VarScheme:
+		return v.Scheme
+	case VarMethod:
+		return v.Method
+	case VarPath:
+		return v.Path
+	case VarAWSVPCE:
+		if v.Proxy != nil {
+			return v.Proxy.AWSVPCEndpointID()
+		}
+		return ""
+	}
+	if header, ok := strings.CutPrefix(name, varHeaderPrefix); ok && v.Header != nil {
+		return strings.Join(v.Header.Values(header), ", ")
+	}
+	if tlvType, ok := strings.CutPrefix(name, varProxyTLVPrefix); ok && v.Proxy != nil {
+		t, _ := parseTLVType(tlvType)
+		if value, found := v.Proxy.TLV(t); found {
+			return formatTLV(value)
+		}
+	}
+	return ""
+}
+
+// parseTLVType parses a PROXY protocol TLV type in decimal or 0x hex.
+func parseTLVType(value string) (byte, bool) {
+	t, err := strconv.ParseUint(value, 0, 8)
+	return byte(t), err == nil
+}
+
+// formatTLV returns printable TLV values as text and others as hex.
+func formatTLV(value []byte) string {
+	if !utf8.Valid(value) {
+		return hex.EncodeToString(value)
+	}
+	for _, r := range string(value) {
+		if !unicode.IsPrint(r) {
+			return hex.EncodeToString(value)
+		}
+	}
+	return string(value)
+}
+
+// templatePart is a literal or, when variable is set, a variable reference.
+type templatePart struct {
+	literal  string
+	variable string
+}
+
+// Template is a parsed header value with "{variable}" references. A literal
+// brace is written as "{{" or "}}".
+type Template struct {
+	parts []templatePart
+}
+
+// ParseTemplate parses a header value template.
+func ParseTemplate(value string) (Template, error) {
+	var t Template
+	var literal strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '{' && i+1 < len(value) && value[i+1] == '{':
+			literal.WriteByte('{')
+			i++
+		case c == '}' && i+1 < len(value) && value[i+1] == '}':
+			literal.WriteByte('}')
+			i++
+		case c == '{':
+			end := strings.IndexByte(value[i:], '}')
+			if end < 0 {
+				return Template{}, fmt.Errorf("%w in %q", ErrUnterminatedVariable, value)
+			}
+			name := value[i+1 : i+end]
+			header, isHeader := strings.CutPrefix(name, varHeaderPrefix)
+			tlvType, isTLV := strings.CutPrefix(name, varProxyTLVPrefix)
+			if isTLV {
+				_, isTLV = parseTLVType(tlvType)
+			}
+			if !templateVars[name] && !(isHeader && validHeaderName(header)) && !isTLV {
+				return Template{}, fmt.Errorf("%w: %q", ErrUnknownVariable, name)
+			}
+			if literal.Len() > 0 {
+				t.parts = append(t.parts, templatePart{literal: literal.String()})
+				literal.Reset()
+			}
+			t.parts = append(t.parts, templatePart{variable: name})
+			i += end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+
+	if literal.Len() > 0 {
+		t.parts = append(t.parts, templatePart{literal: literal.String()})
+	}
+	return t, nil
+}
+
+// Render expands the template with vars.
+func (t Template) Render(vars Vars) string {
+	if len(t.parts) == 1 && t.parts[0].variable == "" {
+		return t.parts[0].literal
+	}
+
+	var b strings.Builder
+	for _, part := range t.parts {
+		if part.variable != "" {
+			b.WriteString(vars.lookup(part.variable))
+		} else {
+			b.WriteString(part.literal)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,244 @@
+package httpstrict
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// contextKey is the context key type for strict parsing values.
+type contextKey int
+
+const connKey contextKey = iota
+
+// Listener accepts connections whose request stream is inspected as it is
+// read by the HTTP server.
+type Listener struct {
+	net.Listener
+}
+
+// NewListener wraps inner so that every accepted connection is inspected.
+func NewListener(inner net.Listener) *Listener {
+	return &Listener{Listener: inner}
+}
+
+// Accept waits for and returns the next connection.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn), nil
+}
+
+// TLSListener completes TLS handshakes itself so that the decrypted request
+// stream of HTTP/1.x connections can be inspected. Connections that negotiate
+// HTTP/2 are returned as *tls.Conn and served natively; the others are served
+// as plain connections, so the HTTP server restores their TLS state from
+// TLSState.
+type TLSListener struct {
+	net.Listener
+
+	config  *tls.Config
+	timeout time.Duration
+
+	start   sync.Once
+	stop    sync.Once
+	results chan acceptResult
+	done    chan struct{}
+}
+
+// acceptResult is a connection, or an error, returned by Accept.
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// NewTLSListener wraps inner so that every accepted connection is served
+// over TLS with config. Handshakes run concurrently and are bounded by
+// timeout when it is positive.
+func NewTLSListener(inner net.Listener, config *tls.Config, timeout time.Duration) *TLSListener {
+	return &TLSListener{
+		Listener: inner,
+		config:   config,
+		timeout:  timeout,
+		results:  make(chan acceptResult),
+		done:     make(chan struct{}),
+	}
+}
+
+// Accept waits for and returns the next connection that completed its handshake.
+func (l *TLSListener) Accept() (net.Conn, error) {
+	l.start.Do(func() { go l.acceptLoop() })
+
+	select {
+	case result := <-l.results:
+		return result.conn, result.err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes the listener and drops connections still in their handshake.
+func (l *TLSListener) Close() error {
+	l.stop.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// acceptLoop accepts raw connections and handshakes each one in its own
+// goroutine, so a slow client cannot hold up the others.
+func (l *TLSListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.results <- acceptResult{err: err}:
+			case <-l.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go l.handshake(conn)
+	}
+}
+
+// handshake completes the TLS handshake on conn and hands it to Accept.
+func (l *TLSListener) handshake(conn net.Conn) {
+	tlsConn := tls.Server(conn, l.config)
+	if l.timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(l.timeout))
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	var accepted net.Conn = tlsConn
+	if tlsConn.ConnectionState().NegotiatedProtocol != "h2" {
+		accepted = NewConn(tlsConn)
+	}
+
+	select {
+	case l.results <- acceptResult{conn: accepted}:
+	case <-l.done:
+		_ = tlsConn.Close()
+	}
+}
+
+// Conn inspects the HTTP/1.x requests read from the underlying connection.
+// Once a request violates the strict grammar the framing of everything that
+// follows is untrusted, so the connection stays flagged until it is closed.
+type Conn struct {
+	net.Conn
+
+	mu        sync.Mutex
+	parser    parser
+	violation string
+}
+
+// NewConn wraps conn for inspection.
+func NewConn(conn net.Conn) *Conn {
+	return &Conn{Conn: conn}
+}
+
+// Read reads from the connection and inspects the bytes read.
+func (c *Conn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.mu.Lock()
+		if c.violation == "" {
+			c.violation = c.parser.feed(b[:n])
+		}
+		c.mu.Unlock()
+	}
+	return n, err
+}
+
+// Violation returns the reason the connection was flagged, or "".
+func (c *Conn) Violation() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.violation
+}
+
+// Hijacked stops inspecting the connection once the HTTP server has handed
+// it off, after which it no longer carries HTTP/1.x requests.
+func (c *Conn) Hijacked() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.parser.state = statePassthrough
+	c.parser.buf = nil
+}
+
+// NetConn returns the underlying connection.
+func (c *Conn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// WithConn returns a context carrying the inspected connection behind c.
+// It matches the signature of http.Server.ConnContext.
+func WithConn(ctx context.Context, c net.Conn) context.Context {
+	if conn, ok := unwrap(c); ok {
+		return context.WithValue(ctx, connKey, conn)
+	}
+	return ctx
+}
+
+// TrackState stops inspecting the connection behind c when the HTTP server
+// hijacks it, as for protocol upgrades and CONNECT tunnels. It matches the
+// signature of http.Server.ConnState.
+func TrackState(c net.Conn, state http.ConnState) {
+	if state != http.StateHijacked {
+		return
+	}
+	if conn, ok := unwrap(c); ok {
+		conn.Hijacked()
+	}
+}
+
+// unwrap returns the inspected connection behind c.
+func unwrap(c net.Conn) (*Conn, bool) {
+	for {
+		if conn, ok := c.(*Conn); ok {
+			return conn, true
+		}
+		wrapper, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			return nil, false
+		}
+		c = wrapper.NetConn()
+	}
+}
+
+// TLSState returns the TLS state of the request's connection when it is an
+// inspected TLS connection, or nil.
+func TLSState(ctx context.Context) *tls.ConnectionState {
+	conn, ok := ctx.Value(connKey).(*Conn)
+	if !ok {
+		return nil
+	}
+	tlsConn, ok := conn.Conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	return &state
+}
+
+// FromContext returns the reason the request's connection was flagged, or
+// "" when it was not flagged or is not inspected.
+func FromContext(ctx context.Context) string {
+	conn, ok := ctx.Value(connKey).(*Conn)
+	if !ok {
+		return ""
+	}
+	return conn.Violation()
+}
@@ -0,0 +1,264 @@
+package httpstrict
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveStrictHTTP starts an HTTP server behind a strict listener and returns
+// its address. The handler reports the violation of the connection.
+func serveStrictHTTP(t *testing.T) string {
+	t.Helper()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := &http.Server{
+		ConnContext: WithConn,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+			_, _ = io.WriteString(w, "violation="+FromContext(r.Context()))
+		}),
+	}
+	go func() { _ = server.Serve(NewListener(inner)) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	return inner.Addr().String()
+}
+
+func TestListener_FlagsConnection(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  string
+		expected string
+	}{
+		{
+			name:     "FlagsConnection_ValidRequest_NotFlagged",
+			request:  "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok",
+			expected: "violation=",
+		},
+		{
+			// Go's parser accepts this request after dropping Content-Length.
+			name: "FlagsConnection_CLTE_Flagged",
+			request: "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n" +
+				"Connection: close\r\n\r\n0\r\n\r\n",
+			expected: "violation=" + ReasonContentLengthWithTE,
+		},
+		{
+			name:     "FlagsConnection_ObsFold_Flagged",
+			request:  "GET / HTTP/1.1\r\nHost: example.com\r\nX-Folded: a\r\n b\r\nConnection: close\r\n\r\n",
+			expected: "violation=" + ReasonObsFold,
+		},
+	}
+
+	address := serveStrictHTTP(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			conn, err := net.Dial("tcp", address)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			// Act
+			_, err = conn.Write([]byte(tt.request))
+			require.NoError(t, err)
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(body))
+		})
+	}
+}
+
+func TestListener_Hijacked_StopsInspecting(t *testing.T) {
+	// Arrange
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &http.Server{
+		ConnContext: WithConn,
+		ConnState:   TrackState,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, brw, err := http.NewResponseController(w).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+
+			_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+			_ = brw.Flush()
+			frame := make([]byte, 6)
+			_, _ = io.ReadFull(brw, frame)
+			_, _ = io.WriteString(conn, "violation="+FromContext(r.Context()))
+		}),
+	}
+	go func() { _ = server.Serve(NewListener(inner)) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// Act
+	_, err = conn.Write([]byte("GET /echo HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n"))
+	require.NoError(t, err)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("\x81\x05hi\n\n"))
+	require.NoError(t, err)
+	body, err := io.ReadAll(reader)
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "violation=", string(body))
+}
+
+// newTestTLSConfig returns a server configuration with a self-signed
+// certificate for example.com that offers HTTP/2 and HTTP/1.1.
+func newTestTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+}
+
+func TestTLSListener_InspectsHTTP1(t *testing.T) {
+	tests := []struct {
+		name       string
+		nextProtos []string
+		expected   string
+	}{
+		{
+			name:       "InspectsHTTP1_HTTP11_Flagged",
+			nextProtos: []string{"http/1.1"},
+			expected:   "tls=true violation=" + ReasonObsFold,
+		},
+		{
+			name:     "InspectsHTTP1_NoALPN_Flagged",
+			expected: "tls=true violation=" + ReasonObsFold,
+		},
+	}
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &http.Server{
+		ConnContext: WithConn,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "tls="+strconv.FormatBool(TLSState(r.Context()) != nil)+" violation="+FromContext(r.Context()))
+		}),
+	}
+	go func() { _ = server.Serve(NewTLSListener(inner, newTestTLSConfig(t), time.Second)) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			conn, err := tls.Dial("tcp", inner.Addr().String(), &tls.Config{
+				InsecureSkipVerify: true, // self-signed test certificate
+				NextProtos:         tt.nextProtos,
+			})
+			require.NoError(t, err)
+			defer conn.Close()
+
+			// Act
+			_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\nX-Folded: a\r\n b\r\nConnection: close\r\n\r\n"))
+			require.NoError(t, err)
+			resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(body))
+		})
+	}
+}
+
+func TestTLSListener_HTTP2_PassedThrough(t *testing.T) {
+	// Arrange
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener := NewTLSListener(inner, newTestTLSConfig(t), time.Second)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	// Act
+	conn, err := tls.Dial("tcp", inner.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true, // self-signed test certificate
+		NextProtos:         []string{"h2"},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Assert
+	select {
+	case serverConn := <-accepted:
+		defer serverConn.Close()
+		assert.IsType(t, &tls.Conn{}, serverConn)
+	case <-time.After(time.Second):
+		t.Fatal("connection was not accepted")
+	}
+}
+
+func TestTLSListener_Close_UnblocksAccept(t *testing.T) {
+	// Arrange
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener := NewTLSListener(inner, newTestTLSConfig(t), time.Second)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := listener.Accept()
+		errs <- err
+	}()
+
+	// Act
+	require.NoError(t, listener.Close())
+
+	// Assert
+	select {
+	case err := <-errs:
+		assert.ErrorIs(t, err, net.ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("Accept did not return after Close")
+	}
+}
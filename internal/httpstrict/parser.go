@@ -0,0 +1,437 @@
+// Package httpstrict inspects the raw HTTP/1.x byte stream of client
+// connections and flags requests whose framing is ambiguous. Go's parser
+// silently normalizes several of these, such as a Content-Length sent next
+// to Transfer-Encoding or folded header lines, so they are only visible
+// before parsing.
+package httpstrict
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// Rejection reasons reported for raw request violations.
+const (
+	ReasonInvalidRequestLine      = "invalid_request_line"
+	ReasonBareLF                  = "bare_lf"
+	ReasonObsFold                 = "obs_fold"
+	ReasonInvalidHeaderName       = "invalid_header_name"
+	ReasonInvalidHeaderValue      = "invalid_header_value"
+	ReasonDuplicateContentLength  = "duplicate_content_length"
+	ReasonInvalidContentLength    = "invalid_content_length"
+	ReasonInvalidTransferEncoding = "invalid_transfer_encoding"
+	ReasonContentLengthWithTE     = "content_length_with_transfer_encoding"
+	ReasonInvalidChunk            = "invalid_chunk"
+)
+
+const (
+	// maxHeadSize bounds the buffered request head. Larger heads are left
+	// to the HTTP server, which rejects them.
+	maxHeadSize = 1<<20 + 4096
+
+	// maxChunkLineSize bounds a chunk size or trailer line.
+	maxChunkLineSize = 4096
+)
+
+// parserState is the position of the parser in the request stream.
+type parserState int
+
+const (
+	stateHead parserState = iota
+	stateBody
+	stateChunkSize
+	stateChunkData
+	stateChunkDataEnd
+	stateTrailer
+	statePassthrough
+)
+
+// Framing describes how the body of a request is delimited.
+type Framing struct {
+	// ContentLength is the body size when Chunked is false.
+	ContentLength int64
+
+	// Chunked is set for chunked transfer coding.
+	Chunked bool
+
+	// Upgrade is set when the request may switch the connection away from
+	// HTTP/1.x, as for upgrades and CONNECT tunnels. The switch only takes
+	// effect once the server hijacks the connection; until then the
+	// following bytes are parsed as requests.
+	Upgrade bool
+}
+
+// parser frames a stream of HTTP/1.x requests and validates each request
+// head and chunked body.
+type parser struct {
+	state     parserState
+	buf       []byte
+	remaining int64
+}
+
+// feed consumes the next bytes of the stream. It returns the rejection
+// reason of the first violation, after which the parser must not be fed.
+func (p *parser) feed(data []byte) string {
+	for len(data) > 0 {
+		switch p.state {
+		case stateHead:
+			// Empty lines preceding a request line are ignored.
+			if len(p.buf) == 0 {
+				data = bytes.TrimLeft(data, "\r\n")
+				if len(data) == 0 {
+					return ""
+				}
+			}
+
+			end := headEnd(p.buf, data)
+			if end < 0 {
+				if len(p.buf)+len(data) > maxHeadSize {
+					p.state = statePassthrough
+					return ""
+				}
+				p.buf = append(p.buf, data...)
+				return ""
+			}
+
+			consumed := end - len(p.buf)
+			p.buf = append(p.buf, data[:consumed]...)
+			data = data[consumed:]
+
+			framing, reason := CheckHead(p.buf)
+			p.buf = p.buf[:0]
+			if reason != "" {
+				return reason
+			}
+			p.startBody(framing)
+
+		case stateBody:
+			n := int64(len(data))
+			if n > p.remaining {
+				n = p.remaining
+			}
+			p.remaining -= n
+			data = data[n:]
+			if p.remaining == 0 {
+				p.state = stateHead
+			}
+
+		case stateChunkSize, stateTrailer:
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				if len(p.buf)+len(data) > maxChunkLineSize {
+					return ReasonInvalidChunk
+				}
+				p.buf = append(p.buf, data...)
+				return ""
+			}
+			p.buf = append(p.buf, data[:i+1]...)
+			data = data[i+1:]
+			if len(p.buf) > maxChunkLineSize {
+				return ReasonInvalidChunk
+			}
+
+			line, ok := trimCRLF(p.buf)
+			if !ok {
+				return ReasonInvalidChunk
+			}
+			if p.state == stateChunkSize {
+				size, ok := parseChunkSize(line)
+				if !ok {
+					return ReasonInvalidChunk
+				}
+				p.remaining = size
+				p.state = stateChunkData
+				if size == 0 {
+					p.state = stateTrailer
+				}
+			} else if len(line) == 0 {
+				p.state = stateHead
+			} else if reason := checkHeaderLine(line); reason != "" {
+				return reason
+			}
+			p.buf = p.buf[:0]
+
+		case stateChunkData:
+			n := int64(len(data))
+			if n > p.remaining {
+				n = p.remaining
+			}
+			p.remaining -= n
+			data = data[n:]
+			if p.remaining == 0 {
+				p.state = stateChunkDataEnd
+			}
+
+		case stateChunkDataEnd:
+			// Every chunk is terminated by exactly CRLF.
+			p.buf = append(p.buf, data[0])
+			data = data[1:]
+			if !bytes.HasPrefix([]byte("\r\n"), p.buf) {
+				return ReasonInvalidChunk
+			}
+			if len(p.buf) == 2 {
+				p.buf = p.buf[:0]
+				p.state = stateChunkSize
+			}
+
+		case statePassthrough:
+			return ""
+		}
+	}
+
+	return ""
+}
+
+// startBody moves the parser past a validated request head.
+func (p *parser) startBody(framing Framing) {
+	switch {
+	case framing.Chunked:
+		p.state = stateChunkSize
+	case framing.ContentLength > 0:
+		p.remaining = framing.ContentLength
+		p.state = stateBody
+	default:
+		p.state = stateHead
+	}
+}
+
+// headEnd returns the offset, counted from the start of buf, just past the
+// blank line ending a request head spread over buf and data, or -1.
+func headEnd(buf, data []byte) int {
+	// The terminator may straddle buf and data, so search from the last
+	// few buffered bytes.
+	overlap := len(buf)
+	if overlap > 3 {
+		overlap = 3
+	}
+	window := append(append([]byte{}, buf[len(buf)-overlap:]...), data...)
+
+	i := bytes.Index(window, []byte("\n\r\n"))
+	j := bytes.Index(window, []byte("\n\n"))
+	switch {
+	case i >= 0 && (j < 0 || i < j):
+		return len(buf) - overlap + i + 3
+	case j >= 0:
+		// A bare LF terminator is reported by CheckHead.
+		return len(buf) - overlap + j + 2
+	}
+	return -1
+}
+
+// CheckHead validates a complete request head, including the terminating
+// blank line, and returns the framing of its body. A non-empty reason is
+// returned when the head is ambiguous or malformed.
+func CheckHead(head []byte) (Framing, string) {
+	if !bytes.HasSuffix(head, []byte("\r\n\r\n")) {
+		return Framing{}, ReasonBareLF
+	}
+
+	lines := bytes.Split(head[:len(head)-4], []byte("\r\n"))
+	for _, line := range lines {
+		// Any CR or LF left inside a line was not part of a CRLF pair.
+		if bytes.ContainsAny(line, "\r\n") {
+			return Framing{}, ReasonBareLF
+		}
+	}
+
+	method, version, ok := parseRequestLine(lines[0])
+	if !ok {
+		return Framing{}, ReasonInvalidRequestLine
+	}
+
+	var (
+		contentLengths    [][]byte
+		transferEncodings [][]byte
+		upgrade           bool
+	)
+	for _, line := range lines[1:] {
+		if reason := checkHeaderLine(line); reason != "" {
+			return Framing{}, reason
+		}
+
+		name, value := splitHeaderLine(line)
+		switch {
+		case asciiEqualFold(name, "Content-Length"):
+			contentLengths = append(contentLengths, value)
+		case asciiEqualFold(name, "Transfer-Encoding"):
+			transferEncodings = append(transferEncodings, value)
+		case asciiEqualFold(name, "Upgrade"):
+			upgrade = true
+		}
+	}
+
+	framing := Framing{Upgrade: upgrade || method == "CONNECT"}
+
+	if len(transferEncodings) > 0 {
+		if len(contentLengths) > 0 {
+			return Framing{}, ReasonContentLengthWithTE
+		}
+		if len(transferEncodings) > 1 || !asciiEqualFold(transferEncodings[0], "chunked") || version == "HTTP/1.0" {
+			return Framing{}, ReasonInvalidTransferEncoding
+		}
+		framing.Chunked = true
+		return framing, ""
+	}
+
+	if len(contentLengths) > 1 {
+		return Framing{}, ReasonDuplicateContentLength
+	}
+	if len(contentLengths) == 1 {
+		n, ok := parseContentLength(contentLengths[0])
+		if !ok {
+			return Framing{}, ReasonInvalidContentLength
+		}
+		framing.ContentLength = n
+	}
+
+	return framing, ""
+}
+
+// parseRequestLine splits a request line into its method and version.
+func parseRequestLine(line []byte) (method, version string, ok bool) {
+	parts := bytes.Split(line, []byte(" "))
+	if len(parts) != 3 || len(parts[0]) == 0 || len(parts[1]) == 0 {
+		return "", "", false
+	}
+
+	for _, c := range parts[0] {
+		if !isTokenChar(c) {
+			return "", "", false
+		}
+	}
+	for _, c := range parts[1] {
+		if c <= ' ' || c == 0x7f {
+			return "", "", false
+		}
+	}
+
+	version = string(parts[2])
+	if version != "HTTP/1.1" && version != "HTTP/1.0" {
+		return "", "", false
+	}
+	return string(parts[0]), version, true
+}
+
+// checkHeaderLine validates a single header field line.
+func checkHeaderLine(line []byte) string {
+	if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') {
+		return ReasonObsFold
+	}
+
+	colon := bytes.IndexByte(line, ':')
+	if colon <= 0 {
+		return ReasonInvalidHeaderName
+	}
+	for _, c := range line[:colon] {
+		if !isTokenChar(c) {
+			return ReasonInvalidHeaderName
+		}
+	}
+	for _, c := range line[colon+1:] {
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return ReasonInvalidHeaderValue
+		}
+	}
+	return ""
+}
+
+// CheckHeader validates a parsed header field. It complements the raw
+// inspection for requests whose byte stream is not visible, such as those
+// received over TLS.
+func CheckHeader(name, value string) string {
+	if !IsToken(name) {
+		return ReasonInvalidHeaderName
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; (c < ' ' && c != '\t') || c == 0x7f {
+			return ReasonInvalidHeaderValue
+		}
+	}
+	return ""
+}
+
+// splitHeaderLine returns the name and the value, without optional
+// whitespace, of a valid header field line.
+func splitHeaderLine(line []byte) ([]byte, []byte) {
+	colon := bytes.IndexByte(line, ':')
+	return line[:colon], bytes.Trim(line[colon+1:], " \t")
+}
+
+// parseContentLength parses a Content-Length value. Only a single decimal
+// number is accepted, without signs or lists.
+func parseContentLength(value []byte) (int64, bool) {
+	if len(value) == 0 || len(value) > 18 {
+		return 0, false
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(string(value), 10, 64)
+	return n, err == nil
+}
+
+// parseChunkSize parses a chunk size line, ignoring chunk extensions.
+func parseChunkSize(line []byte) (int64, bool) {
+	if i := bytes.IndexByte(line, ';'); i >= 0 {
+		line = line[:i]
+	}
+	line = bytes.TrimRight(line, " \t")
+	if len(line) == 0 || len(line) > 15 {
+		return 0, false
+	}
+	for _, c := range line {
+		if !isHexDigit(c) {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(string(line), 16, 64)
+	return n, err == nil
+}
+
+// trimCRLF removes the CRLF ending of line. It reports false when the line
+// ends with a bare LF.
+func trimCRLF(line []byte) ([]byte, bool) {
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, false
+	}
+	line = line[:len(line)-2]
+	// A stray CR inside the line is as ambiguous as a bare LF.
+	if bytes.IndexByte(line, '\r') >= 0 {
+		return nil, false
+	}
+	return line, true
+}
+
+// IsToken reports whether s is a non-empty HTTP token, as used for methods
+// and header names.
+func IsToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTokenChar reports whether c may appear in an HTTP token.
+func isTokenChar(c byte) bool {
+	if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+		return true
+	}
+	return bytes.IndexByte([]byte("!#$%&'*+-.^_`|~"), c) >= 0
+}
+
+// isHexDigit reports whether c is a hexadecimal digit.
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// asciiEqualFold reports whether b equals s, ignoring ASCII case.
+func asciiEqualFold(b []byte, s string) bool {
+	return bytes.EqualFold(b, []byte(s))
+}
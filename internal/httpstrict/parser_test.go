@@ -0,0 +1,239 @@
+package httpstrict
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// smugglingCorpus holds raw request streams, most of them known request
+// smuggling and desync payloads, with the reason they are rejected for.
+var smugglingCorpus = []struct {
+	name     string
+	stream   string
+	expected string
+}{
+	{
+		name:   "Corpus_SimpleGet_Accepted",
+		stream: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+	},
+	{
+		name: "Corpus_PipelinedContentLength_Accepted",
+		stream: "POST /a HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\n\r\nhello" +
+			"GET /b HTTP/1.1\r\nHost: example.com\r\n\r\n",
+	},
+	{
+		name: "Corpus_RequestInsideDeclaredBody_Accepted",
+		stream: "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 39\r\n\r\n" +
+			"GET /admin HTTP/1.1\r\nHost: internal\r\n\r\n",
+	},
+	{
+		name: "Corpus_ChunkedWithExtensionAndTrailer_Accepted",
+		stream: "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"5;name=value\r\nhello\r\n0\r\nChecksum: abc\r\n\r\n" +
+			"GET /next HTTP/1.1\r\nHost: example.com\r\n\r\n",
+	},
+	{
+		name: "Corpus_UpgradeNotSwitchedFollowedByRequest_Accepted",
+		stream: "GET /ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n" +
+			"GET /next HTTP/1.1\r\nHost: example.com\r\n\r\n",
+	},
+	{
+		name: "Corpus_CLTE_Rejected",
+		stream: "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 13\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"0\r\n\r\nSMUGGLED",
+		expected: ReasonContentLengthWithTE,
+	},
+	{
+		name: "Corpus_TECL_Rejected",
+		stream: "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\nContent-Length: 3\r\n\r\n" +
+			"8\r\nSMUGGLED\r\n0\r\n\r\n",
+		expected: ReasonContentLengthWithTE,
+	},
+	{
+		name:     "Corpus_TabSeparatedTEWithCL_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\nTransfer-Encoding:\tchunked\r\n\r\n",
+		expected: ReasonContentLengthWithTE,
+	},
+	{
+		name:     "Corpus_ObfuscatedTEValue_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: xchunked\r\n\r\n",
+		expected: ReasonInvalidTransferEncoding,
+	},
+	{
+		name:     "Corpus_DuplicateTE_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: identity\r\n\r\n",
+		expected: ReasonInvalidTransferEncoding,
+	},
+	{
+		name:     "Corpus_TEList_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked, identity\r\n\r\n",
+		expected: ReasonInvalidTransferEncoding,
+	},
+	{
+		name:     "Corpus_TEOnHTTP10_Rejected",
+		stream:   "POST / HTTP/1.0\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n",
+		expected: ReasonInvalidTransferEncoding,
+	},
+	{
+		name:     "Corpus_SpaceBeforeColon_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding : chunked\r\n\r\n",
+		expected: ReasonInvalidHeaderName,
+	},
+	{
+		name:     "Corpus_ObsFoldedTE_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding:\r\n chunked\r\n\r\n",
+		expected: ReasonObsFold,
+	},
+	{
+		name:     "Corpus_DuplicateEqualCL_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5\r\nContent-Length: 5\r\n\r\nhello",
+		expected: ReasonDuplicateContentLength,
+	},
+	{
+		name:     "Corpus_SignedCL_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: +5\r\n\r\nhello",
+		expected: ReasonInvalidContentLength,
+	},
+	{
+		name:     "Corpus_CLList_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 5, 5\r\n\r\nhello",
+		expected: ReasonInvalidContentLength,
+	},
+	{
+		name:     "Corpus_BareLFLine_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\nContent-Length: 5\r\n\r\nhello",
+		expected: ReasonBareLF,
+	},
+	{
+		name:     "Corpus_BareLFTerminator_Rejected",
+		stream:   "GET / HTTP/1.1\nHost: example.com\n\n",
+		expected: ReasonBareLF,
+	},
+	{
+		name:     "Corpus_StrayCR_Rejected",
+		stream:   "GET / HTTP/1.1\r\nHost: example.com\r\nX-Test: a\rb\r\n\r\n",
+		expected: ReasonBareLF,
+	},
+	{
+		name:     "Corpus_NulInHeaderValue_Rejected",
+		stream:   "GET / HTTP/1.1\r\nHost: example.com\r\nX-Test: a\x00b\r\n\r\n",
+		expected: ReasonInvalidHeaderValue,
+	},
+	{
+		name:     "Corpus_DoubleSpaceRequestLine_Rejected",
+		stream:   "GET  / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+		expected: ReasonInvalidRequestLine,
+	},
+	{
+		name:     "Corpus_HexPrefixedChunkSize_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n0x5\r\nhello\r\n0\r\n\r\n",
+		expected: ReasonInvalidChunk,
+	},
+	{
+		name:     "Corpus_OverflowingChunkSize_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\nfffffffffffffffff1\r\n",
+		expected: ReasonInvalidChunk,
+	},
+	{
+		name:     "Corpus_ChunkLongerThanSize_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhelloX\r\n0\r\n\r\n",
+		expected: ReasonInvalidChunk,
+	},
+	{
+		name:     "Corpus_BareLFChunkSize_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n5\nhello\r\n0\r\n\r\n",
+		expected: ReasonInvalidChunk,
+	},
+	{
+		name:     "Corpus_ObsFoldedTrailer_Rejected",
+		stream:   "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n0\r\nX-Trailer: a\r\n b\r\n\r\n",
+		expected: ReasonObsFold,
+	},
+	{
+		name: "Corpus_UpgradeFollowedBySmuggledCLTE_Rejected",
+		stream: "GET /ws HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n" +
+			"POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 13\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"0\r\n\r\nSMUGGLED",
+		expected: ReasonContentLengthWithTE,
+	},
+	{
+		name: "Corpus_ConnectFollowedBySmuggledCLTE_Rejected",
+		stream: "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n" +
+			"POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 13\r\nTransfer-Encoding: chunked\r\n\r\n" +
+			"0\r\n\r\nSMUGGLED",
+		expected: ReasonContentLengthWithTE,
+	},
+	{
+		name: "Corpus_SmuggledSecondRequest_Rejected",
+		stream: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n" +
+			"POST / HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		expected: ReasonContentLengthWithTE,
+	},
+}
+
+func TestParser_SmugglingCorpus(t *testing.T) {
+	for _, tt := range smugglingCorpus {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			whole := &parser{}
+			bytewise := &parser{}
+
+			// Act
+			wholeReason := whole.feed([]byte(tt.stream))
+			bytewiseReason := ""
+			for i := 0; i < len(tt.stream) && bytewiseReason == ""; i++ {
+				bytewiseReason = bytewise.feed([]byte{tt.stream[i]})
+			}
+
+			// Assert
+			assert.Equal(t, tt.expected, wholeReason)
+			assert.Equal(t, tt.expected, bytewiseReason, "stream split into single bytes")
+		})
+	}
+}
+
+func TestCheckHead_Framing(t *testing.T) {
+	tests := []struct {
+		name     string
+		head     string
+		expected Framing
+	}{
+		{
+			name:     "Framing_NoBody_Empty",
+			head:     "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			expected: Framing{},
+		},
+		{
+			name:     "Framing_ContentLength_Length",
+			head:     "POST / HTTP/1.1\r\nContent-Length: 42\r\n\r\n",
+			expected: Framing{ContentLength: 42},
+		},
+		{
+			name:     "Framing_Chunked_Chunked",
+			head:     "POST / HTTP/1.1\r\nTransfer-Encoding: Chunked\r\n\r\n",
+			expected: Framing{Chunked: true},
+		},
+		{
+			name:     "Framing_Connect_Upgrade",
+			head:     "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n",
+			expected: Framing{Upgrade: true},
+		},
+		{
+			name:     "Framing_UpgradeHeader_Upgrade",
+			head:     "GET /ws HTTP/1.1\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n",
+			expected: Framing{Upgrade: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			framing, reason := CheckHead([]byte(tt.head))
+
+			// Assert
+			assert.Empty(t, reason)
+			assert.Equal(t, tt.expected, framing)
+		})
+	}
+}
@@ -0,0 +1,275 @@
+// Package middleware implements IP and GeoIP based access control.
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/albedosehen/rwwwrse/internal/clientip"
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// Access control actions.
+const (
+	AccessActionAllow = "allow"
+	AccessActionDeny  = "deny"
+)
+
+// accessDefaultRuleName labels requests handled by the default action.
+const accessDefaultRuleName = "default"
+
+// AccessRule is a single allow or deny rule. A rule matches when the client
+// IP is inside any of its CIDRs or resolves to any of its countries.
+type AccessRule struct {
+	// Name identifies the rule in logs and metrics.
+	Name string
+
+	// Action is "allow" or "deny".
+	Action string
+
+	// CIDRs lists networks such as "10.8.0.0/16" or single addresses.
+	CIDRs []string
+
+	// Countries lists ISO 3166-1 alpha-2 codes, resolved via the GeoIP database.
+	Countries []string
+}
+
+// AccessControlConfig holds configuration for the access control middleware.
+type AccessControlConfig struct {
+	// Rules are evaluated in order; the first matching rule decides.
+	Rules []AccessRule
+
+	// DefaultAction applies when no rule matches.
+	DefaultAction string
+
+	// GeoIPDatabase is the path to a MaxMind-format .mmdb file. Required
+	// when any rule lists countries.
+	GeoIPDatabase string
+}
+
+// DefaultAccessControlConfig returns an access control configuration that allows everything.
+func DefaultAccessControlConfig() AccessControlConfig {
+	return AccessControlConfig{
+		Rules:         []AccessRule{},
+		DefaultAction: AccessActionAllow,
+	}
+}
+
+// compiledAccessRule is an AccessRule with parsed networks.
+type compiledAccessRule struct {
+	name      string
+	allow     bool
+	networks  []*net.IPNet
+	countries []string
+}
+
+// accessControlMiddleware restricts requests by client IP and country.
+type accessControlMiddleware struct {
+	rules        []compiledAccessRule
+	defaultAllow bool
+	geoip        *mmdbReader
+	logger       observability.Logger
+	metrics      observability.MetricsCollector
+}
+
+// NewAccessControlMiddleware creates a new IP access control middleware.
+func NewAccessControlMiddleware(
+	config AccessControlConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewAccessControlValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	m := &accessControlMiddleware{
+		defaultAllow: config.DefaultAction != AccessActionDeny,
+		logger:       logger,
+		metrics:      metrics,
+	}
+
+	needsGeoIP := false
+	for i, rule := range config.Rules {
+		compiled := compiledAccessRule{
+			name:  rule.Name,
+			allow: rule.Action == AccessActionAllow,
+		}
+		if compiled.name == "" {
+			compiled.name = fmt.Sprintf("rule_%d", i)
+		}
+
+		for _, cidr := range rule.CIDRs {
+			network, _ := parseAccessCIDR(cidr)
+			compiled.networks = append(compiled.networks, network)
+		}
+
+		for _, country := range rule.Countries {
+			compiled.countries = append(compiled.countries, strings.ToUpper(country))
+			needsGeoIP = true
+		}
+
+		m.rules = append(m.rules, compiled)
+	}
+
+	if needsGeoIP {
+		reader, err := openMMDB(config.GeoIPDatabase)
+		if err != nil {
+			return nil, err
+		}
+		m.geoip = reader
+	}
+
+	return m, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *accessControlMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clientIP := getClientIP(r)
+		allowed, ruleName := m.evaluate(r, clientIP)
+		if allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		route := GetRouteName(r.Context())
+		if route == "" {
+			route = normalizeRouteHost(r.Host)
+		}
+
+		if m.metrics != nil {
+			m.metrics.RecordAccessDenied(route, ruleName)
+		}
+
+		if m.logger != nil {
+			m.logger.Warn(r.Context(), "Request denied by access control",
+				observability.String("request_id", GetRequestID(r.Context())),
+				observability.String("client_ip", clientIP),
+				observability.String("route", route),
+				observability.String("rule", ruleName),
+				observability.String("path", r.URL.Path),
+			)
+		}
+
+		writeErrorResponse(w, r, proxyerrors.NewSecurityError(
+			proxyerrors.ErrCodeAccessDenied,
+			"client address not permitted",
+			nil,
+		))
+	})
+}
+
+// evaluate applies the rules in order and returns the decision and rule name.
+func (m *accessControlMiddleware) evaluate(r *http.Request, clientIP string) (bool, string) {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		// An unidentifiable client only passes when nothing is restricted.
+		return m.defaultAllow && len(m.rules) == 0, accessDefaultRuleName
+	}
+
+	country := ""
+	countryResolved := false
+
+	for _, rule := range m.rules {
+		if rule.matchesIP(ip) {
+			return rule.allow, rule.name
+		}
+
+		if len(rule.countries) == 0 || m.geoip == nil {
+			continue
+		}
+
+		if !countryResolved {
+			var err error
+			country, err = m.geoip.country(ip)
+			if err != nil && m.logger != nil {
+				m.logger.Debug(r.Context(), "GeoIP lookup failed",
+					observability.String("client_ip", clientIP),
+					observability.Error(err),
+				)
+			}
+			countryResolved = true
+		}
+
+		if country != "" && containsString(rule.countries, country) {
+			return rule.allow, rule.name
+		}
+	}
+
+	return m.defaultAllow, accessDefaultRuleName
+}
+
+// matchesIP reports whether ip is inside any of the rule's networks.
+func (r compiledAccessRule) matchesIP(ip net.IP) bool {
+	for _, network := range r.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAccessCIDR parses a CIDR or a single IP address as a host network.
+func parseAccessCIDR(value string) (*net.IPNet, error) {
+	return clientip.ParseNetwork(value)
+}
+
+// AccessControlValidator validates access control configuration.
+type AccessControlValidator struct{}
+
+// NewAccessControlValidator creates a new access control validator.
+func NewAccessControlValidator() *AccessControlValidator {
+	return &AccessControlValidator{}
+}
+
+// Validate validates the access control configuration.
+func (v *AccessControlValidator) Validate(config AccessControlConfig) error {
+	switch config.DefaultAction {
+	case "", AccessActionAllow, AccessActionDeny:
+	default:
+		return fmt.Errorf("%w: default action %q", ErrInvalidAccessAction, config.DefaultAction)
+	}
+
+	needsGeoIP := false
+	for i, rule := range config.Rules {
+		if rule.Action != AccessActionAllow && rule.Action != AccessActionDeny {
+			return fmt.Errorf("%w: rule %d action %q", ErrInvalidAccessAction, i, rule.Action)
+		}
+
+		if len(rule.CIDRs) == 0 && len(rule.Countries) == 0 {
+			return fmt.Errorf("%w: rule %d", ErrEmptyAccessRule, i)
+		}
+
+		for _, cidr := range rule.CIDRs {
+			if _, err := parseAccessCIDR(cidr); err != nil {
+				return fmt.Errorf("%w: %q", ErrInvalidCIDR, cidr)
+			}
+		}
+
+		for _, country := range rule.Countries {
+			if len(country) != 2 {
+				return fmt.Errorf("%w: %q", ErrInvalidCountryCode, country)
+			}
+			needsGeoIP = true
+		}
+	}
+
+	if needsGeoIP && config.GeoIPDatabase == "" {
+		return ErrGeoIPDatabaseRequired
+	}
+
+	return nil
+}
+
+// Access control validation errors.
+var (
+	ErrInvalidAccessAction   = fmt.Errorf("invalid access control action: must be allow or deny")
+	ErrEmptyAccessRule       = fmt.Errorf("access rule must list CIDRs or countries")
+	ErrInvalidCIDR           = fmt.Errorf("invalid CIDR")
+	ErrInvalidCountryCode    = fmt.Errorf("invalid country code: must be ISO 3166-1 alpha-2")
+	ErrGeoIPDatabaseRequired = fmt.Errorf("GeoIP database is required for country rules")
+)
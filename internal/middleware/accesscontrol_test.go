@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+// buildTestMMDB builds a minimal IPv4 MaxMind DB mapping networks to country codes.
+func buildTestMMDB(t *testing.T, countries map[string]string) []byte {
+	t.Helper()
+
+	encodeString := func(s string) []byte {
+		return append([]byte{0x40 | byte(len(s))}, s...)
+	}
+	encodeUint := func(typeBits byte, v uint32) []byte {
+		return []byte{typeBits | 4, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+
+	type node struct {
+		child [2]int
+		data  [2]int
+	}
+	nodes := []node{{child: [2]int{-1, -1}, data: [2]int{-1, -1}}}
+	var data []byte
+
+	for cidr, country := range countries {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		ones, _ := network.Mask.Size()
+		ip := network.IP.To4()
+
+		offset := len(data)
+		record := []byte{0xE1} // map with one entry
+		record = append(record, encodeString("country")...)
+		record = append(record, 0xE1)
+		record = append(record, encodeString("iso_code")...)
+		record = append(record, encodeString(country)...)
+		data = append(data, record...)
+
+		current := 0
+		for i := 0; i < ones; i++ {
+			bit := int(ip[i/8]>>(7-uint(i%8))) & 1
+			if i == ones-1 {
+				nodes[current].data[bit] = offset
+				break
+			}
+			if nodes[current].child[bit] == -1 {
+				nodes = append(nodes, node{child: [2]int{-1, -1}, data: [2]int{-1, -1}})
+				nodes[current].child[bit] = len(nodes) - 1
+			}
+			current = nodes[current].child[bit]
+		}
+	}
+
+	nodeCount := len(nodes)
+	var buffer []byte
+	for _, n := range nodes {
+		for bit := 0; bit < 2; bit++ {
+			value := nodeCount
+			if n.child[bit] != -1 {
+				value = n.child[bit]
+			} else if n.data[bit] != -1 {
+				value = nodeCount + mmdbDataSectionSeparator + n.data[bit]
+			}
+			buffer = append(buffer, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+	buffer = append(buffer, make([]byte, mmdbDataSectionSeparator)...)
+	buffer = append(buffer, data...)
+	buffer = append(buffer, mmdbMetadataMarker...)
+	buffer = append(buffer, 0xE4)
+	buffer = append(buffer, encodeString("node_count")...)
+	buffer = append(buffer, encodeUint(0xC0, uint32(nodeCount))...)
+	buffer = append(buffer, encodeString("record_size")...)
+	buffer = append(buffer, encodeUint(0xA0, 24)...)
+	buffer = append(buffer, encodeString("ip_version")...)
+	buffer = append(buffer, encodeUint(0xA0, 4)...)
+	buffer = append(buffer, encodeString("database_type")...)
+	buffer = append(buffer, encodeString("Test-Country")...)
+
+	return buffer
+}
+
+func TestMMDBReader_Country(t *testing.T) {
+	tests := []struct {
+		name     string
+		ip       string
+		expected string
+	}{
+		{
+			name:     "MMDBReader_KnownNetwork_ReturnsCountry",
+			ip:       "81.2.69.160",
+			expected: "GB",
+		},
+		{
+			name:     "MMDBReader_OtherNetwork_ReturnsCountry",
+			ip:       "89.160.20.112",
+			expected: "SE",
+		},
+		{
+			name:     "MMDBReader_UnknownNetwork_ReturnsEmpty",
+			ip:       "203.0.113.5",
+			expected: "",
+		},
+		{
+			name:     "MMDBReader_IPv6InIPv4Database_ReturnsEmpty",
+			ip:       "2001:db8::1",
+			expected: "",
+		},
+	}
+
+	reader, err := newMMDBReader(buildTestMMDB(t, map[string]string{
+		"81.2.69.0/24":   "GB",
+		"89.160.20.0/22": "SE",
+	}))
+	require.NoError(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			country, err := reader.country(net.ParseIP(tt.ip))
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, country)
+		})
+	}
+}
+
+func TestAccessControlMiddleware_Wrap(t *testing.T) {
+	tests := []struct {
+		name           string
+		clientIP       string
+		expectedStatus int
+		deniedRule     string
+	}{
+		{
+			name:           "AccessControl_OfficeRange_Allowed",
+			clientIP:       "198.51.100.20",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "AccessControl_BlockedHostInsideOffice_DeniedByEarlierRule",
+			clientIP:       "198.51.100.66",
+			expectedStatus: http.StatusForbidden,
+			deniedRule:     "quarantine",
+		},
+		{
+			name:           "AccessControl_AllowedCountry_Allowed",
+			clientIP:       "81.2.69.160",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "AccessControl_DeniedCountry_Denied",
+			clientIP:       "89.160.20.112",
+			expectedStatus: http.StatusForbidden,
+			deniedRule:     "embargo",
+		},
+		{
+			name:           "AccessControl_NoMatch_DefaultDeny",
+			clientIP:       "203.0.113.5",
+			expectedStatus: http.StatusForbidden,
+			deniedRule:     "default",
+		},
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "country.mmdb")
+	require.NoError(t, os.WriteFile(dbPath, buildTestMMDB(t, map[string]string{
+		"81.2.69.0/24":   "GB",
+		"89.160.20.0/22": "SE",
+	}), 0o600))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			metrics := testhelpers.NewMockMetricsCollector()
+			if tt.deniedRule != "" {
+				metrics.On("RecordAccessDenied", "admin.example.com", tt.deniedRule).Return().Once()
+			}
+
+			mw, err := NewAccessControlMiddleware(AccessControlConfig{
+				DefaultAction: AccessActionDeny,
+				GeoIPDatabase: dbPath,
+				Rules: []AccessRule{
+					{Name: "quarantine", Action: AccessActionDeny, CIDRs: []string{"198.51.100.66"}},
+					{Name: "office", Action: AccessActionAllow, CIDRs: []string{"198.51.100.0/24"}},
+					{Name: "embargo", Action: AccessActionDeny, Countries: []string{"se"}},
+					{Name: "uk", Action: AccessActionAllow, Countries: []string{"GB"}},
+				},
+			}, nil, metrics)
+			require.NoError(t, err)
+
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "http://admin.example.com/", nil)
+			req.RemoteAddr = net.JoinHostPort(tt.clientIP, "40000")
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			metrics.AssertExpectations(t)
+			if tt.deniedRule == "" {
+				metrics.AssertNotCalled(t, "RecordAccessDenied", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestAccessControlValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      AccessControlConfig
+		expectedErr error
+	}{
+		{
+			name:   "Validate_DefaultConfig_Valid",
+			config: DefaultAccessControlConfig(),
+		},
+		{
+			name: "Validate_InvalidAction_ReturnsError",
+			config: AccessControlConfig{Rules: []AccessRule{
+				{Action: "permit", CIDRs: []string{"10.0.0.0/8"}},
+			}},
+			expectedErr: ErrInvalidAccessAction,
+		},
+		{
+			name: "Validate_InvalidCIDR_ReturnsError",
+			config: AccessControlConfig{Rules: []AccessRule{
+				{Action: AccessActionAllow, CIDRs: []string{"10.0.0.0/33"}},
+			}},
+			expectedErr: ErrInvalidCIDR,
+		},
+		{
+			name: "Validate_CountryWithoutDatabase_ReturnsError",
+			config: AccessControlConfig{Rules: []AccessRule{
+				{Action: AccessActionDeny, Countries: []string{"RU"}},
+			}},
+			expectedErr: ErrGeoIPDatabaseRequired,
+		},
+		{
+			name: "Validate_EmptyRule_ReturnsError",
+			config: AccessControlConfig{Rules: []AccessRule{
+				{Action: AccessActionDeny},
+			}},
+			expectedErr: ErrEmptyAccessRule,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			validator := NewAccessControlValidator()
+
+			// Act
+			err := validator.Validate(tt.config)
+
+			// Assert
+			if tt.expectedErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Package middleware implements API key authentication backed by a hashed key file.
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// APIKeyConfig holds configuration for the API key middleware.
+type APIKeyConfig struct {
+	// Realm is presented to clients in the authentication challenge.
+	Realm string
+
+	// KeysFile contains "name:sha256:<hex>" lines. Keys are looked up by
+	// digest, so a wrong key costs one hash however many keys are listed.
+	// It is reloaded automatically when it changes.
+	KeysFile string
+
+	// Header carries the API key. QueryParam optionally allows the key in
+	// the query string as well.
+	Header     string
+	QueryParam string
+
+	// UserHeader receives the name of the matched key on upstream requests.
+	UserHeader string
+
+	// MaxFailures is the number of failed attempts a client may make before
+	// being blocked. One failure is forgiven every FailureInterval.
+	MaxFailures     int
+	FailureInterval time.Duration
+}
+
+// DefaultAPIKeyConfig returns an API key configuration with sensible defaults.
+func DefaultAPIKeyConfig() APIKeyConfig {
+	return APIKeyConfig{
+		Realm:           "Restricted",
+		Header:          "X-API-Key",
+		UserHeader:      "X-Auth-Request-User",
+		MaxFailures:     10,
+		FailureInterval: time.Minute,
+	}
+}
+
+// apiKeyMiddleware authenticates requests with API keys.
+type apiKeyMiddleware struct {
+	config   APIKeyConfig
+	store    *credentialStore
+	failures *authFailureTracker
+	logger   observability.Logger
+	metrics  observability.MetricsCollector
+}
+
+// NewAPIKeyMiddleware creates a new API key middleware.
+func NewAPIKeyMiddleware(
+	config APIKeyConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	defaults := DefaultAPIKeyConfig()
+	if config.Realm == "" {
+		config.Realm = defaults.Realm
+	}
+	if config.Header == "" {
+		config.Header = defaults.Header
+	}
+	if config.UserHeader == "" {
+		config.UserHeader = defaults.UserHeader
+	}
+
+	store, err := newCredentialStore(config.KeysFile, true, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API keys file: %w", err)
+	}
+
+	return &apiKeyMiddleware{
+		config:   config,
+		store:    store,
+		failures: newAuthFailureTracker("apikey", config.MaxFailures, config.FailureInterval, logger),
+		logger:   logger,
+		metrics:  metrics,
+	}, nil
+}
+
+// Close stops watching the API keys file and releases the failure tracker.
+func (m *apiKeyMiddleware) Close() error {
+	m.failures.stop()
+	return m.store.Close()
+}
+
+// Wrap implements the Middleware interface.
+func (m *apiKeyMiddleware) Wrap(next http.Handler) http.Handler {
+	challenge := "ApiKey realm=" + quoteRealm(m.config.Realm)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(m.config.UserHeader)
+
+		if retryAfter, blocked := m.failures.blocked(r); blocked {
+			writeAuthBlocked(w, r, retryAfter)
+			return
+		}
+
+		key := m.extractKey(r)
+		if key == "" {
+			writeAuthChallenge(w, r, challenge)
+			return
+		}
+
+		name, ok := m.store.matchDigest(key)
+		if !ok {
+			m.failures.record(r)
+			ReportOffense(r, OffenseAuthFailure)
+
+			if m.logger != nil {
+				m.logger.Warn(r.Context(), "API key authentication failed",
+					observability.String("request_id", GetRequestID(r.Context())),
+					observability.String("realm", m.config.Realm),
+					observability.String("client_ip", getClientIP(r)),
+				)
+			}
+
+			writeAuthChallenge(w, r, challenge)
+			return
+		}
+
+		m.stripKey(r)
+		r.Header.Set(m.config.UserHeader, name)
+
+		next.ServeHTTP(w, markAuthenticated(r))
+	})
+}
+
+// extractKey returns the API key from the header or, if enabled, the query string.
+func (m *apiKeyMiddleware) extractKey(r *http.Request) string {
+	if key := r.Header.Get(m.config.Header); key != "" {
+		return key
+	}
+	if m.config.QueryParam != "" {
+		return r.URL.Query().Get(m.config.QueryParam)
+	}
+	return ""
+}
+
+// stripKey removes the API key so it is not forwarded upstream.
+func (m *apiKeyMiddleware) stripKey(r *http.Request) {
+	r.Header.Del(m.config.Header)
+
+	if m.config.QueryParam == "" {
+		return
+	}
+
+	query := r.URL.Query()
+	if _, exists := query[m.config.QueryParam]; exists {
+		query.Del(m.config.QueryParam)
+		r.URL.RawQuery = query.Encode()
+	}
+}
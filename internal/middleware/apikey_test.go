@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Entry(name, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return name + ":sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestAPIKeyMiddleware_Wrap(t *testing.T) {
+	tests := []struct {
+		name           string
+		target         string
+		header         string
+		expectedStatus int
+		expectedUser   string
+		expectedQuery  string
+	}{
+		{
+			name:           "APIKey_ValidHeader_Allows",
+			target:         "/reports",
+			header:         "key-ci-0123456789",
+			expectedStatus: http.StatusOK,
+			expectedUser:   "ci",
+		},
+		{
+			name:           "APIKey_SecondKey_Allows",
+			target:         "/reports",
+			header:         "key-ops-9876543210",
+			expectedStatus: http.StatusOK,
+			expectedUser:   "ops",
+		},
+		{
+			name:           "APIKey_ValidQueryParam_AllowsAndStripsKey",
+			target:         "/reports?api_key=key-ci-0123456789&page=2",
+			expectedStatus: http.StatusOK,
+			expectedUser:   "ci",
+			expectedQuery:  "page=2",
+		},
+		{
+			name:           "APIKey_InvalidKey_Returns401",
+			target:         "/reports",
+			header:         "key-unknown",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "APIKey_MissingKey_Returns401",
+			target:         "/reports",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			path := filepath.Join(t.TempDir(), "keys")
+			writeCredentialFile(t, path,
+				"# service keys",
+				sha256Entry("ci", "key-ci-0123456789"),
+				sha256Entry("ops", "key-ops-9876543210"),
+			)
+
+			config := DefaultAPIKeyConfig()
+			config.KeysFile = path
+			config.QueryParam = "api_key"
+			mw, err := NewAPIKeyMiddleware(config, nil, nil)
+			require.NoError(t, err)
+			t.Cleanup(func() { _ = mw.(*apiKeyMiddleware).Close() })
+
+			var upstream *http.Request
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstream = r
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				require.NotNil(t, upstream)
+				assert.Equal(t, tt.expectedUser, upstream.Header.Get("X-Auth-Request-User"))
+				assert.Empty(t, upstream.Header.Get("X-API-Key"))
+				assert.Equal(t, tt.expectedQuery, upstream.URL.RawQuery)
+			} else {
+				assert.Equal(t, `ApiKey realm="Restricted"`, rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestNewAPIKeyMiddleware_SlowHash_ReturnsError(t *testing.T) {
+	// Arrange
+	path := filepath.Join(t.TempDir(), "keys")
+	writeCredentialFile(t, path,
+		sha256Entry("ci", "key-ci-0123456789"),
+		bcryptEntry(t, "ops", "key-ops-9876543210"),
+	)
+
+	config := DefaultAPIKeyConfig()
+	config.KeysFile = path
+
+	// Act
+	_, err := NewAPIKeyMiddleware(config, nil, nil)
+
+	// Assert
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `"ops" must use a sha256 hash`)
+}
+
+func TestVerifyCredentialHash(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    string
+		secret   string
+		expected bool
+	}{
+		{
+			name:     "VerifyCredentialHash_SHA256_ReturnsFalse",
+			entry:    sha256Entry("x", "secret"),
+			secret:   "secret",
+			expected: false,
+		},
+		{
+			name:     "VerifyCredentialHash_Argon2Mismatch_ReturnsFalse",
+			entry:    argon2Entry("x", "secret"),
+			secret:   "other",
+			expected: false,
+		},
+		{
+			name:     "VerifyCredentialHash_Argon2Match_ReturnsTrue",
+			entry:    argon2Entry("x", "secret"),
+			secret:   "secret",
+			expected: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			hash := tt.entry[len("x:"):]
+
+			// Act
+			result := verifyCredentialHash(hash, tt.secret)
+
+			// Assert
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
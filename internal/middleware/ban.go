@@ -0,0 +1,752 @@
+// Package middleware implements automatic temporary banning of abusive clients.
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// Offense events reported by other middleware.
+const (
+	OffenseRateLimit   = "rate_limit"
+	OffenseAuthFailure = "auth_failure"
+	OffenseWAF         = "waf"
+)
+
+// banManualReason labels bans created through the admin API.
+const banManualReason = "manual"
+
+// Ban is a temporary ban of a client IP.
+type Ban struct {
+	IP        string    `json:"ip"`
+	Reason    string    `json:"reason"`
+	Level     int       `json:"level"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// BanRule bans a client after Threshold events of one type within Window.
+type BanRule struct {
+	Event     string
+	Threshold int
+	Window    time.Duration
+}
+
+// BanConfig holds configuration for the ban manager and middleware.
+type BanConfig struct {
+	// Rules set the offense thresholds per event type.
+	Rules []BanRule
+
+	// BanTime is the duration of a first ban.
+	BanTime time.Duration
+
+	// MaxBanTime caps escalated bans.
+	MaxBanTime time.Duration
+
+	// Multiplier scales each repeat ban within EscalationWindow.
+	Multiplier float64
+
+	// EscalationWindow is how long previous bans count toward escalation.
+	EscalationWindow time.Duration
+
+	// Allowlist lists networks that are never banned.
+	Allowlist []string
+
+	// PersistPath stores bans as JSON so they survive restarts. Empty disables persistence.
+	PersistPath string
+
+	// AdminPath serves the ban admin API. Empty disables it.
+	AdminPath string
+
+	// AdminHost is the only host the admin API answers on. Requests for the
+	// admin path on other hosts are handled as ordinary requests.
+	AdminHost string
+
+	// AdminToken is the bearer token required by the admin API.
+	AdminToken string
+
+	// CleanupInterval controls how often expired state is removed.
+	CleanupInterval time.Duration
+}
+
+// DefaultBanConfig returns a ban configuration with fail2ban-like defaults.
+func DefaultBanConfig() BanConfig {
+	return BanConfig{
+		Rules: []BanRule{
+			{Event: OffenseRateLimit, Threshold: 20, Window: time.Minute},
+			{Event: OffenseAuthFailure, Threshold: 10, Window: 10 * time.Minute},
+			{Event: OffenseWAF, Threshold: 3, Window: 10 * time.Minute},
+		},
+		BanTime:          10 * time.Minute,
+		MaxBanTime:       24 * time.Hour,
+		Multiplier:       2,
+		EscalationWindow: 24 * time.Hour,
+		Allowlist:        []string{},
+		CleanupInterval:  time.Minute,
+	}
+}
+
+// BanManager counts offenses per client and bans clients that exceed the thresholds.
+type BanManager interface {
+	// RecordOffense records an offense event and reports whether it banned the client.
+	RecordOffense(ip, event string) bool
+
+	// Banned returns the active ban of ip, if any.
+	Banned(ip string) (Ban, bool)
+
+	// Ban bans ip for duration, or for the escalated ban time when duration is zero.
+	Ban(ip, reason string, duration time.Duration) (Ban, error)
+
+	// Unban lifts the ban of ip and forgets its history.
+	Unban(ip string) bool
+
+	// List returns the active bans ordered by expiry.
+	List() []Ban
+
+	// Stop stops background cleanup.
+	Stop()
+}
+
+// banClient tracks the offenses and latest ban of one client.
+type banClient struct {
+	events map[string][]time.Time
+	ban    *Ban
+}
+
+// banManager is the in-memory BanManager with optional file persistence.
+type banManager struct {
+	config    BanConfig
+	rules     map[string]BanRule
+	allowlist []*net.IPNet
+
+	mu      sync.Mutex
+	clients map[string]*banClient
+
+	persistMu sync.Mutex
+	stop      chan struct{}
+	stopOnce  sync.Once
+	now       func() time.Time
+
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+}
+
+// NewBanManager creates a ban manager and loads persisted bans.
+func NewBanManager(
+	config BanConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (BanManager, error) {
+	validator := NewBanValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	m := &banManager{
+		config:  config,
+		rules:   make(map[string]BanRule),
+		clients: make(map[string]*banClient),
+		stop:    make(chan struct{}),
+		now:     time.Now,
+		logger:  logger,
+		metrics: metrics,
+	}
+
+	for _, rule := range config.Rules {
+		m.rules[rule.Event] = rule
+	}
+
+	for _, entry := range config.Allowlist {
+		network, _ := parseAccessCIDR(entry)
+		m.allowlist = append(m.allowlist, network)
+	}
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	if config.CleanupInterval > 0 {
+		go m.cleanupLoop()
+	}
+
+	return m, nil
+}
+
+// RecordOffense implements BanManager.
+func (m *banManager) RecordOffense(ip, event string) bool {
+	rule, ok := m.rules[event]
+	if !ok || ip == "" || m.allowed(ip) {
+		return false
+	}
+
+	now := m.now()
+
+	m.mu.Lock()
+	client := m.client(ip)
+	if client.ban != nil && client.ban.ExpiresAt.After(now) {
+		m.mu.Unlock()
+		return false
+	}
+
+	cutoff := now.Add(-rule.Window)
+	events := client.events[event]
+	kept := events[:0]
+	for _, at := range events {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	kept = append(kept, now)
+	client.events[event] = kept
+
+	if len(kept) < rule.Threshold {
+		m.mu.Unlock()
+		return false
+	}
+
+	ban := m.banLocked(ip, client, event, 0, now)
+	active := m.activeLocked(now)
+	m.mu.Unlock()
+
+	if m.logger != nil {
+		m.logger.Warn(context.Background(), "Client banned",
+			observability.String("client_ip", ip),
+			observability.String("event", event),
+			observability.Int("offenses", len(kept)),
+			observability.Int("level", ban.Level),
+			observability.Duration("duration", ban.ExpiresAt.Sub(ban.CreatedAt)),
+		)
+	}
+
+	if m.metrics != nil {
+		m.metrics.RecordBan(event)
+		m.metrics.SetActiveBans(active)
+	}
+
+	m.persist()
+	return true
+}
+
+// Banned implements BanManager.
+func (m *banManager) Banned(ip string) (Ban, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client, ok := m.clients[ip]
+	if !ok || client.ban == nil || !client.ban.ExpiresAt.After(m.now()) {
+		return Ban{}, false
+	}
+	return *client.ban, true
+}
+
+// Ban implements BanManager.
+func (m *banManager) Ban(ip, reason string, duration time.Duration) (Ban, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return Ban{}, fmt.Errorf("%w: %q", ErrInvalidBanIP, ip)
+	}
+	ip = parsed.String()
+	if reason == "" {
+		reason = banManualReason
+	}
+
+	now := m.now()
+
+	m.mu.Lock()
+	ban := m.banLocked(ip, m.client(ip), reason, duration, now)
+	active := m.activeLocked(now)
+	m.mu.Unlock()
+
+	if m.metrics != nil {
+		m.metrics.SetActiveBans(active)
+	}
+
+	m.persist()
+	return ban, nil
+}
+
+// Unban implements BanManager.
+func (m *banManager) Unban(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	ip = parsed.String()
+
+	now := m.now()
+
+	m.mu.Lock()
+	client, ok := m.clients[ip]
+	banned := ok && client.ban != nil && client.ban.ExpiresAt.After(now)
+	delete(m.clients, ip)
+	active := m.activeLocked(now)
+	m.mu.Unlock()
+
+	if !banned {
+		return false
+	}
+
+	if m.logger != nil {
+		m.logger.Info(context.Background(), "Client ban lifted",
+			observability.String("client_ip", ip),
+		)
+	}
+
+	if m.metrics != nil {
+		m.metrics.SetActiveBans(active)
+	}
+
+	m.persist()
+	return true
+}
+
+// List implements BanManager.
+func (m *banManager) List() []Ban {
+	now := m.now()
+
+	m.mu.Lock()
+	bans := make([]Ban, 0, len(m.clients))
+	for _, client := range m.clients {
+		if client.ban != nil && client.ban.ExpiresAt.After(now) {
+			bans = append(bans, *client.ban)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(bans, func(i, j int) bool {
+		if bans[i].ExpiresAt.Equal(bans[j].ExpiresAt) {
+			return bans[i].IP < bans[j].IP
+		}
+		return bans[i].ExpiresAt.Before(bans[j].ExpiresAt)
+	})
+	return bans
+}
+
+// Stop implements BanManager.
+func (m *banManager) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// client returns the state of ip, creating it if needed.
+func (m *banManager) client(ip string) *banClient {
+	client, ok := m.clients[ip]
+	if !ok {
+		client = &banClient{events: make(map[string][]time.Time)}
+		m.clients[ip] = client
+	}
+	return client
+}
+
+// banLocked bans a client. Without an explicit duration the ban time is
+// escalated for each previous ban within the escalation window.
+func (m *banManager) banLocked(ip string, client *banClient, reason string, duration time.Duration, now time.Time) Ban {
+	level := 0
+	if previous := client.ban; previous != nil && now.Sub(previous.CreatedAt) < m.config.EscalationWindow {
+		level = previous.Level + 1
+	}
+
+	if duration <= 0 {
+		scaled := float64(m.config.BanTime) * math.Pow(m.config.Multiplier, float64(level))
+		duration = m.config.MaxBanTime
+		if scaled < float64(m.config.MaxBanTime) {
+			duration = time.Duration(scaled)
+		}
+	}
+
+	ban := &Ban{
+		IP:        ip,
+		Reason:    reason,
+		Level:     level,
+		CreatedAt: now,
+		ExpiresAt: now.Add(duration),
+	}
+	client.ban = ban
+	client.events = make(map[string][]time.Time)
+	return *ban
+}
+
+// activeLocked counts the active bans.
+func (m *banManager) activeLocked(now time.Time) int {
+	active := 0
+	for _, client := range m.clients {
+		if client.ban != nil && client.ban.ExpiresAt.After(now) {
+			active++
+		}
+	}
+	return active
+}
+
+// allowed reports whether ip is on the allowlist.
+func (m *banManager) allowed(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range m.allowlist {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupLoop periodically removes stale state.
+func (m *banManager) cleanupLoop() {
+	ticker := time.NewTicker(m.config.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.cleanup()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// cleanup forgets clients without recent offenses or bans.
+func (m *banManager) cleanup() {
+	now := m.now()
+
+	m.mu.Lock()
+	for ip, client := range m.clients {
+		for event, events := range client.events {
+			rule := m.rules[event]
+			if len(events) == 0 || !events[len(events)-1].After(now.Add(-rule.Window)) {
+				delete(client.events, event)
+			}
+		}
+
+		expired := client.ban == nil ||
+			(!client.ban.ExpiresAt.After(now) && now.Sub(client.ban.CreatedAt) >= m.config.EscalationWindow)
+		if expired && len(client.events) == 0 {
+			delete(m.clients, ip)
+		}
+	}
+	active := m.activeLocked(now)
+	m.mu.Unlock()
+
+	if m.metrics != nil {
+		m.metrics.SetActiveBans(active)
+	}
+}
+
+// persist writes the bans that still matter for enforcement or escalation.
+func (m *banManager) persist() {
+	if m.config.PersistPath == "" {
+		return
+	}
+
+	now := m.now()
+
+	m.mu.Lock()
+	bans := make([]Ban, 0, len(m.clients))
+	for _, client := range m.clients {
+		if client.ban != nil && (client.ban.ExpiresAt.After(now) || now.Sub(client.ban.CreatedAt) < m.config.EscalationWindow) {
+			bans = append(bans, *client.ban)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(bans, func(i, j int) bool { return bans[i].IP < bans[j].IP })
+
+	m.persistMu.Lock()
+	defer m.persistMu.Unlock()
+
+	if err := writeBanFile(m.config.PersistPath, bans); err != nil && m.logger != nil {
+		m.logger.Error(context.Background(), err, "Failed to persist bans",
+			observability.String("path", m.config.PersistPath),
+		)
+	}
+}
+
+// load restores persisted bans, skipping those no longer relevant.
+func (m *banManager) load() error {
+	if m.config.PersistPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(m.config.PersistPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBanStore, err)
+	}
+
+	var bans []Ban
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return fmt.Errorf("%w: %v", ErrBanStore, err)
+	}
+
+	now := m.now()
+	for _, ban := range bans {
+		if !ban.ExpiresAt.After(now) && now.Sub(ban.CreatedAt) >= m.config.EscalationWindow {
+			continue
+		}
+		restored := ban
+		m.client(ban.IP).ban = &restored
+	}
+
+	if m.metrics != nil {
+		m.metrics.SetActiveBans(m.activeLocked(now))
+	}
+
+	return nil
+}
+
+// writeBanFile atomically replaces path with the JSON encoded bans.
+func writeBanFile(path string, bans []Ban) error {
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReportOffense records an offense for the client of r when a ban manager
+// is active for the request.
+func ReportOffense(r *http.Request, event string) {
+	if manager, ok := r.Context().Value(ContextKeyBanManager).(BanManager); ok {
+		manager.RecordOffense(getClientIP(r), event)
+	}
+}
+
+// banMiddleware rejects banned clients and serves the ban admin API.
+type banMiddleware struct {
+	config  BanConfig
+	manager BanManager
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+}
+
+// NewBanMiddleware creates a new ban middleware with its own ban manager.
+func NewBanMiddleware(
+	config BanConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	manager, err := NewBanManager(config, logger, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return &banMiddleware{
+		config:  config,
+		manager: manager,
+		logger:  logger,
+		metrics: metrics,
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *banMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.isAdminRequest(r) {
+			m.serveAdmin(w, r)
+			return
+		}
+
+		clientIP := getClientIP(r)
+		if ban, banned := m.manager.Banned(clientIP); banned {
+			m.reject(w, r, ban)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), ContextKeyBanManager, m.manager)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// isAdminRequest reports whether r targets the admin API on the admin host.
+func (m *banMiddleware) isAdminRequest(r *http.Request) bool {
+	if m.config.AdminPath == "" || normalizeRouteHost(r.Host) != normalizeRouteHost(m.config.AdminHost) {
+		return false
+	}
+	return r.URL.Path == m.config.AdminPath || strings.HasPrefix(r.URL.Path, m.config.AdminPath+"/")
+}
+
+// reject responds to a banned client with 403 and Retry-After.
+func (m *banMiddleware) reject(w http.ResponseWriter, r *http.Request, ban Ban) {
+	requestID := GetRequestID(r.Context())
+	retryAfter := int64(math.Ceil(time.Until(ban.ExpiresAt).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	if m.logger != nil {
+		m.logger.Debug(r.Context(), "Request from banned client rejected",
+			observability.String("request_id", requestID),
+			observability.String("client_ip", ban.IP),
+			observability.String("reason", ban.Reason),
+			observability.String("path", r.URL.Path),
+		)
+	}
+
+	w.Header().Set(HeaderRetryAfter, strconv.FormatInt(retryAfter, 10))
+	err := proxyerrors.WrapError(proxyerrors.ErrCodeAccessDenied, "Client temporarily banned", nil).
+		WithContext("retry_after", retryAfter)
+	writeErrorResponse(w, r, err)
+}
+
+// banRequest is the body of a manual ban request.
+type banRequest struct {
+	IP       string `json:"ip"`
+	Reason   string `json:"reason"`
+	Duration string `json:"duration"`
+}
+
+// serveAdmin handles the ban admin API:
+//
+//	GET    {admin_path}       lists active bans
+//	POST   {admin_path}       bans {"ip", "reason", "duration"}
+//	DELETE {admin_path}/{ip}  lifts a ban
+func (m *banMiddleware) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(m.config.AdminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="bans"`)
+		writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeUnauthorized, "Invalid admin token", nil))
+		return
+	}
+
+	ip := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, m.config.AdminPath), "/")
+
+	switch {
+	case r.Method == http.MethodGet && ip == "":
+		writeAdminJSON(w, http.StatusOK, map[string]any{"bans": m.manager.List()})
+
+	case r.Method == http.MethodPost && ip == "":
+		var req banRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+			writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, "Invalid request body", nil))
+			return
+		}
+
+		var duration time.Duration
+		if req.Duration != "" {
+			parsed, err := time.ParseDuration(req.Duration)
+			if err != nil || parsed <= 0 {
+				writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, "Invalid duration", nil))
+				return
+			}
+			duration = parsed
+		}
+
+		ban, err := m.manager.Ban(req.IP, req.Reason, duration)
+		if err != nil {
+			writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, err.Error(), nil))
+			return
+		}
+
+		if m.logger != nil {
+			m.logger.Info(r.Context(), "Client banned via admin API",
+				observability.String("request_id", GetRequestID(r.Context())),
+				observability.String("client_ip", ban.IP),
+				observability.String("reason", ban.Reason),
+				observability.Time("expires_at", ban.ExpiresAt),
+			)
+		}
+		writeAdminJSON(w, http.StatusCreated, ban)
+
+	case r.Method == http.MethodDelete && ip != "":
+		if !m.manager.Unban(ip) {
+			writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, "Ban not found", nil).
+				WithHTTPStatus(http.StatusNotFound))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, "Method not allowed", nil).
+			WithHTTPStatus(http.StatusMethodNotAllowed))
+	}
+}
+
+// BanValidator validates ban configuration.
+type BanValidator struct{}
+
+// NewBanValidator creates a new ban validator.
+func NewBanValidator() *BanValidator {
+	return &BanValidator{}
+}
+
+// Validate validates the ban configuration.
+func (v *BanValidator) Validate(config BanConfig) error {
+	if config.BanTime <= 0 || config.MaxBanTime < config.BanTime {
+		return ErrInvalidBanTime
+	}
+
+	if config.Multiplier < 1 {
+		return ErrInvalidBanMultiplier
+	}
+
+	for i, rule := range config.Rules {
+		switch rule.Event {
+		case OffenseRateLimit, OffenseAuthFailure, OffenseWAF:
+		default:
+			return fmt.Errorf("%w: rule %d event %q", ErrInvalidBanRule, i, rule.Event)
+		}
+		if rule.Threshold <= 0 || rule.Window <= 0 {
+			return fmt.Errorf("%w: rule %d requires a positive threshold and window", ErrInvalidBanRule, i)
+		}
+	}
+
+	for _, entry := range config.Allowlist {
+		if _, err := parseAccessCIDR(entry); err != nil {
+			return fmt.Errorf("%w: %q", ErrInvalidCIDR, entry)
+		}
+	}
+
+	if config.AdminPath != "" && config.AdminHost == "" {
+		return ErrBanAdminHostRequired
+	}
+
+	if config.AdminPath != "" && config.AdminToken == "" {
+		return ErrBanAdminTokenRequired
+	}
+
+	return nil
+}
+
+// Ban validation errors.
+var (
+	ErrInvalidBanTime        = fmt.Errorf("ban times require 0 < ban time <= max ban time")
+	ErrInvalidBanMultiplier  = fmt.Errorf("ban multiplier must be at least 1")
+	ErrInvalidBanRule        = fmt.Errorf("invalid ban rule")
+	ErrBanAdminHostRequired  = fmt.Errorf("ban admin host is required when the admin path is set")
+	ErrBanAdminTokenRequired = fmt.Errorf("ban admin token is required when the admin path is set")
+	ErrInvalidBanIP          = fmt.Errorf("invalid ban IP address")
+	ErrBanStore              = fmt.Errorf("failed to load ban store")
+)
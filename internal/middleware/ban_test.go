@@ -0,0 +1,426 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+// newTestBanManager creates a ban manager driven by a controllable clock.
+func newTestBanManager(t *testing.T, mutate func(*BanConfig)) (*banManager, *time.Time) {
+	t.Helper()
+
+	config := DefaultBanConfig()
+	config.CleanupInterval = 0
+	config.Rules = []BanRule{{Event: OffenseAuthFailure, Threshold: 3, Window: time.Minute}}
+	mutate(&config)
+
+	manager, err := NewBanManager(config, nil, nil)
+	require.NoError(t, err)
+	t.Cleanup(manager.Stop)
+
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := manager.(*banManager)
+	m.now = func() time.Time { return now }
+	return m, &now
+}
+
+func TestBanManager_RecordOffense(t *testing.T) {
+	tests := []struct {
+		name         string
+		allowlist    []string
+		ip           string
+		event        string
+		offenses     int
+		spacing      time.Duration
+		expectBanned bool
+	}{
+		{
+			name:         "RecordOffense_ThresholdReached_Bans",
+			ip:           "203.0.113.7",
+			event:        OffenseAuthFailure,
+			offenses:     3,
+			expectBanned: true,
+		},
+		{
+			name:     "RecordOffense_BelowThreshold_NotBanned",
+			ip:       "203.0.113.7",
+			event:    OffenseAuthFailure,
+			offenses: 2,
+		},
+		{
+			name:     "RecordOffense_OutsideWindow_NotBanned",
+			ip:       "203.0.113.7",
+			event:    OffenseAuthFailure,
+			offenses: 5,
+			spacing:  40 * time.Second,
+		},
+		{
+			name:     "RecordOffense_EventWithoutRule_Ignored",
+			ip:       "203.0.113.7",
+			event:    OffenseWAF,
+			offenses: 10,
+		},
+		{
+			name:      "RecordOffense_Allowlisted_NeverBanned",
+			allowlist: []string{"203.0.113.0/24"},
+			ip:        "203.0.113.7",
+			event:     OffenseAuthFailure,
+			offenses:  10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			manager, now := newTestBanManager(t, func(c *BanConfig) { c.Allowlist = tt.allowlist })
+
+			// Act
+			for i := 0; i < tt.offenses; i++ {
+				manager.RecordOffense(tt.ip, tt.event)
+				*now = now.Add(tt.spacing)
+			}
+			_, banned := manager.Banned(tt.ip)
+
+			// Assert
+			assert.Equal(t, tt.expectBanned, banned)
+		})
+	}
+}
+
+func TestBanManager_Escalation(t *testing.T) {
+	// Arrange
+	manager, now := newTestBanManager(t, func(c *BanConfig) {
+		c.BanTime = time.Minute
+		c.MaxBanTime = 3 * time.Minute
+		c.Multiplier = 2
+	})
+	ip := "198.51.100.1"
+	durations := []time.Duration{}
+
+	// Act
+	for round := 0; round < 4; round++ {
+		for i := 0; i < 3; i++ {
+			manager.RecordOffense(ip, OffenseAuthFailure)
+		}
+		ban, banned := manager.Banned(ip)
+		require.True(t, banned)
+		durations = append(durations, ban.ExpiresAt.Sub(ban.CreatedAt))
+		*now = ban.ExpiresAt
+	}
+
+	// Assert
+	assert.Equal(t, []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 3 * time.Minute}, durations)
+}
+
+func TestBanManager_Unban_ResetsEscalation(t *testing.T) {
+	// Arrange
+	metrics := testhelpers.NewMockMetricsCollector()
+	metrics.On("RecordBan", OffenseAuthFailure).Return().Twice()
+	metrics.On("SetActiveBans", 1).Return().Twice()
+	metrics.On("SetActiveBans", 0).Return().Once()
+
+	config := DefaultBanConfig()
+	config.CleanupInterval = 0
+	config.Rules = []BanRule{{Event: OffenseAuthFailure, Threshold: 1, Window: time.Minute}}
+	manager, err := NewBanManager(config, nil, metrics)
+	require.NoError(t, err)
+	defer manager.Stop()
+
+	// Act
+	manager.RecordOffense("198.51.100.1", OffenseAuthFailure)
+	lifted := manager.Unban("198.51.100.1")
+	manager.RecordOffense("198.51.100.1", OffenseAuthFailure)
+	ban, banned := manager.Banned("198.51.100.1")
+
+	// Assert
+	assert.True(t, lifted)
+	assert.True(t, banned)
+	assert.Equal(t, 0, ban.Level)
+	assert.False(t, manager.Unban("192.0.2.1"))
+	metrics.AssertExpectations(t)
+}
+
+func TestBanManager_Persistence_RestoresBans(t *testing.T) {
+	// Arrange
+	config := DefaultBanConfig()
+	config.CleanupInterval = 0
+	config.PersistPath = filepath.Join(t.TempDir(), "bans.json")
+	first, err := NewBanManager(config, nil, nil)
+	require.NoError(t, err)
+	first.Stop()
+	_, err = first.Ban("192.0.2.10", "", time.Hour)
+	require.NoError(t, err)
+
+	// Act
+	second, err := NewBanManager(config, nil, nil)
+	require.NoError(t, err)
+	defer second.Stop()
+	bans := second.List()
+
+	// Assert
+	require.Len(t, bans, 1)
+	assert.Equal(t, "192.0.2.10", bans[0].IP)
+	assert.Equal(t, banManualReason, bans[0].Reason)
+}
+
+// newTestBanHandler wraps an OK handler in a ban middleware with an admin API.
+func newTestBanHandler(t *testing.T) (http.Handler, BanManager) {
+	t.Helper()
+
+	config := DefaultBanConfig()
+	config.CleanupInterval = 0
+	config.AdminPath = "/_bans"
+	config.AdminHost = "admin.example.com"
+	config.AdminToken = "secret"
+	config.Rules = []BanRule{{Event: OffenseAuthFailure, Threshold: 2, Window: time.Minute}}
+
+	mw, err := NewBanMiddleware(config, nil, nil)
+	require.NoError(t, err)
+	manager := mw.(*banMiddleware).manager
+	t.Cleanup(manager.Stop)
+
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login" {
+			ReportOffense(r, OffenseAuthFailure)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return handler, manager
+}
+
+func TestBanMiddleware_OffensesBanClient(t *testing.T) {
+	// Arrange
+	handler, _ := newTestBanHandler(t)
+	statuses := []int{}
+
+	// Act
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/login", nil)
+		req.RemoteAddr = "203.0.113.9:4000"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		statuses = append(statuses, rec.Code)
+
+		if rec.Code == http.StatusForbidden {
+			assert.NotEmpty(t, rec.Header().Get(HeaderRetryAfter))
+		}
+	}
+
+	other := httptest.NewRequest(http.MethodGet, "/", nil)
+	other.RemoteAddr = "203.0.113.10:4000"
+	otherRec := httptest.NewRecorder()
+	handler.ServeHTTP(otherRec, other)
+
+	// Assert
+	assert.Equal(t, []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusForbidden}, statuses)
+	assert.Equal(t, http.StatusOK, otherRec.Code)
+}
+
+func TestBanMiddleware_AdminAPI(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		host           string
+		path           string
+		authorization  string
+		body           string
+		expectedStatus int
+		expectedBanned bool
+	}{
+		{
+			name:           "AdminAPI_MissingToken_Unauthorized",
+			method:         http.MethodGet,
+			path:           "/_bans",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBanned: true,
+		},
+		{
+			name:           "AdminAPI_TokenWithoutScheme_Unauthorized",
+			method:         http.MethodGet,
+			path:           "/_bans",
+			authorization:  "secret",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBanned: true,
+		},
+		{
+			name:           "AdminAPI_List_ReturnsBans",
+			method:         http.MethodGet,
+			path:           "/_bans",
+			authorization:  "Bearer secret",
+			expectedStatus: http.StatusOK,
+			expectedBanned: true,
+		},
+		{
+			name:           "AdminAPI_Create_BansIP",
+			method:         http.MethodPost,
+			path:           "/_bans",
+			authorization:  "Bearer secret",
+			body:           `{"ip":"192.0.2.44","reason":"abuse report","duration":"30m"}`,
+			expectedStatus: http.StatusCreated,
+			expectedBanned: true,
+		},
+		{
+			name:           "AdminAPI_CreateInvalidIP_BadRequest",
+			method:         http.MethodPost,
+			path:           "/_bans",
+			authorization:  "Bearer secret",
+			body:           `{"ip":"not-an-ip"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBanned: true,
+		},
+		{
+			name:           "AdminAPI_Delete_LiftsBan",
+			method:         http.MethodDelete,
+			path:           "/_bans/192.0.2.44",
+			authorization:  "Bearer secret",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "AdminAPI_DeleteMappedIPv4_LiftsBan",
+			method:         http.MethodDelete,
+			path:           "/_bans/::ffff:192.0.2.44",
+			authorization:  "Bearer secret",
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "AdminAPI_OtherHost_NotServed",
+			method:         http.MethodDelete,
+			host:           "app.example.com",
+			path:           "/_bans/192.0.2.44",
+			authorization:  "Bearer secret",
+			expectedStatus: http.StatusOK,
+			expectedBanned: true,
+		},
+		{
+			name:           "AdminAPI_UnsupportedMethod_MethodNotAllowed",
+			method:         http.MethodPut,
+			path:           "/_bans",
+			authorization:  "Bearer secret",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedBanned: true,
+		},
+		{
+			name:           "AdminAPI_DeleteUnknown_NotFound",
+			method:         http.MethodDelete,
+			path:           "/_bans/192.0.2.99",
+			authorization:  "Bearer secret",
+			expectedStatus: http.StatusNotFound,
+			expectedBanned: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			handler, manager := newTestBanHandler(t)
+			_, err := manager.Ban("192.0.2.44", "", time.Hour)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Host = "admin.example.com"
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+			_, banned := manager.Banned("192.0.2.44")
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, tt.expectedBanned, banned)
+			if tt.expectedStatus >= http.StatusBadRequest {
+				assert.Equal(t, proxyerrors.ProblemContentType, rec.Header().Get("Content-Type"))
+			}
+			if tt.expectedStatus == http.StatusOK && tt.host == "" {
+				var body struct {
+					Bans []Ban `json:"bans"`
+				}
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+				require.Len(t, body.Bans, 1)
+				assert.Equal(t, "192.0.2.44", body.Bans[0].IP)
+			}
+		})
+	}
+}
+
+func TestBanValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*BanConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*BanConfig) {},
+		},
+		{
+			name:        "Validate_MaxBelowBanTime_ReturnsError",
+			mutate:      func(c *BanConfig) { c.MaxBanTime = time.Minute },
+			expectedErr: ErrInvalidBanTime,
+		},
+		{
+			name:        "Validate_MultiplierBelowOne_ReturnsError",
+			mutate:      func(c *BanConfig) { c.Multiplier = 0.5 },
+			expectedErr: ErrInvalidBanMultiplier,
+		},
+		{
+			name:        "Validate_UnknownEvent_ReturnsError",
+			mutate:      func(c *BanConfig) { c.Rules = []BanRule{{Event: "spam", Threshold: 1, Window: time.Minute}} },
+			expectedErr: ErrInvalidBanRule,
+		},
+		{
+			name:        "Validate_InvalidAllowlist_ReturnsError",
+			mutate:      func(c *BanConfig) { c.Allowlist = []string{"10.0.0.0/99"} },
+			expectedErr: ErrInvalidCIDR,
+		},
+		{
+			name:        "Validate_AdminPathWithoutHost_ReturnsError",
+			mutate:      func(c *BanConfig) { c.AdminPath = "/_bans" },
+			expectedErr: ErrBanAdminHostRequired,
+		},
+		{
+			name: "Validate_AdminPathWithoutToken_ReturnsError",
+			mutate: func(c *BanConfig) {
+				c.AdminPath = "/_bans"
+				c.AdminHost = "admin.example.com"
+			},
+			expectedErr: ErrBanAdminTokenRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultBanConfig()
+			tt.mutate(&config)
+
+			// Act
+			err := NewBanValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
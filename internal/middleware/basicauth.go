@@ -0,0 +1,146 @@
+// Package middleware implements HTTP Basic authentication backed by htpasswd files.
+package middleware
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// BasicAuthConfig holds configuration for the basic auth middleware.
+type BasicAuthConfig struct {
+	// Realm is presented to clients in the authentication challenge.
+	Realm string
+
+	// HTPasswdFile is an htpasswd file with bcrypt or argon2 hashes.
+	// It is reloaded automatically when it changes.
+	HTPasswdFile string
+
+	// UserHeader receives the authenticated user name on upstream requests.
+	UserHeader string
+
+	// MaxFailures is the number of failed attempts a client may make before
+	// being blocked. One failure is forgiven every FailureInterval.
+	MaxFailures     int
+	FailureInterval time.Duration
+}
+
+// DefaultBasicAuthConfig returns a basic auth configuration with sensible defaults.
+func DefaultBasicAuthConfig() BasicAuthConfig {
+	return BasicAuthConfig{
+		Realm:           "Restricted",
+		UserHeader:      "X-Auth-Request-User",
+		MaxFailures:     10,
+		FailureInterval: time.Minute,
+	}
+}
+
+// basicAuthMiddleware authenticates requests with HTTP Basic credentials.
+type basicAuthMiddleware struct {
+	config   BasicAuthConfig
+	store    *credentialStore
+	failures *authFailureTracker
+	logger   observability.Logger
+	metrics  observability.MetricsCollector
+
+	// dummyHash is compared against for unknown users to keep timing uniform.
+	dummyHash string
+}
+
+// NewBasicAuthMiddleware creates a new basic auth middleware.
+func NewBasicAuthMiddleware(
+	config BasicAuthConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	defaults := DefaultBasicAuthConfig()
+	if config.Realm == "" {
+		config.Realm = defaults.Realm
+	}
+	if config.UserHeader == "" {
+		config.UserHeader = defaults.UserHeader
+	}
+
+	store, err := newCredentialStore(config.HTPasswdFile, false, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load htpasswd file: %w", err)
+	}
+
+	dummy, err := bcrypt.GenerateFromPassword([]byte(fmt.Sprintf("%x", sha256.Sum256([]byte(config.Realm)))), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize basic auth: %w", err)
+	}
+
+	return &basicAuthMiddleware{
+		config:    config,
+		store:     store,
+		failures:  newAuthFailureTracker("basic", config.MaxFailures, config.FailureInterval, logger),
+		logger:    logger,
+		metrics:   metrics,
+		dummyHash: string(dummy),
+	}, nil
+}
+
+// Close stops watching the htpasswd file and releases the failure tracker.
+func (m *basicAuthMiddleware) Close() error {
+	m.failures.stop()
+	return m.store.Close()
+}
+
+// Wrap implements the Middleware interface.
+func (m *basicAuthMiddleware) Wrap(next http.Handler) http.Handler {
+	challenge := "Basic realm=" + quoteRealm(m.config.Realm) + `, charset="UTF-8"`
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(m.config.UserHeader)
+
+		if retryAfter, blocked := m.failures.blocked(r); blocked {
+			writeAuthBlocked(w, r, retryAfter)
+			return
+		}
+
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			writeAuthChallenge(w, r, challenge)
+			return
+		}
+
+		if !m.verify(username, password) {
+			m.failures.record(r)
+			ReportOffense(r, OffenseAuthFailure)
+
+			if m.logger != nil {
+				m.logger.Warn(r.Context(), "Basic authentication failed",
+					observability.String("request_id", GetRequestID(r.Context())),
+					observability.String("user", sanitizeString(username)),
+					observability.String("realm", m.config.Realm),
+					observability.String("client_ip", getClientIP(r)),
+				)
+			}
+
+			writeAuthChallenge(w, r, challenge)
+			return
+		}
+
+		// Credentials are consumed here and not forwarded upstream.
+		r.Header.Del("Authorization")
+		r.Header.Set(m.config.UserHeader, username)
+
+		next.ServeHTTP(w, markAuthenticated(r))
+	})
+}
+
+// verify checks the password for username against the htpasswd store.
+func (m *basicAuthMiddleware) verify(username, password string) bool {
+	hash, exists := m.store.lookup(username)
+	if !exists {
+		verifyCredentialHash(m.dummyHash, password)
+		return false
+	}
+	return verifyCredentialHash(hash, password)
+}
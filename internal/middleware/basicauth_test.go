@@ -0,0 +1,323 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeCredentialFile writes lines to a credential file in a temporary directory.
+func writeCredentialFile(t *testing.T, path string, lines ...string) {
+	t.Helper()
+
+	content := ""
+	for _, line := range lines {
+		content += line + "\n"
+	}
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func bcryptEntry(t *testing.T, user, password string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	require.NoError(t, err)
+	return user + ":" + string(hash)
+}
+
+func argon2Entry(user, password string) string {
+	salt := []byte("0123456789abcdef")
+	hash := argon2.IDKey([]byte(password), salt, 1, 8*1024, 1, 32)
+	return user + ":$argon2id$v=19$m=8192,t=1,p=1$" +
+		base64.RawStdEncoding.EncodeToString(salt) + "$" +
+		base64.RawStdEncoding.EncodeToString(hash)
+}
+
+func newTestBasicAuth(t *testing.T, lines ...string) (Middleware, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	writeCredentialFile(t, path, lines...)
+
+	config := DefaultBasicAuthConfig()
+	config.Realm = "Internal Tools"
+	config.HTPasswdFile = path
+	config.MaxFailures = 3
+	config.FailureInterval = time.Hour
+	mw, err := NewBasicAuthMiddleware(config, nil, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		_ = mw.(*basicAuthMiddleware).Close()
+	})
+
+	return mw, path
+}
+
+func TestBasicAuthMiddleware_Wrap(t *testing.T) {
+	tests := []struct {
+		name           string
+		user           string
+		password       string
+		noCredentials  bool
+		expectedStatus int
+	}{
+		{
+			name:           "BasicAuth_ValidBcrypt_Allows",
+			user:           "alice",
+			password:       "wonderland",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "BasicAuth_ValidArgon2_Allows",
+			user:           "bob",
+			password:       "builder",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "BasicAuth_WrongPassword_Returns401",
+			user:           "alice",
+			password:       "wrong",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "BasicAuth_UnknownUser_Returns401",
+			user:           "mallory",
+			password:       "wonderland",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "BasicAuth_NoCredentials_Returns401",
+			noCredentials:  true,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mw, _ := newTestBasicAuth(t, bcryptEntry(t, "alice", "wonderland"), argon2Entry("bob", "builder"))
+
+			var upstream http.Header
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstream = r.Header.Clone()
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if !tt.noCredentials {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.user, upstream.Get("X-Auth-Request-User"))
+				assert.Empty(t, upstream.Get("Authorization"))
+			} else {
+				assert.Equal(t, `Basic realm="Internal Tools", charset="UTF-8"`, rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestBasicAuthMiddleware_RepeatedFailures_BlocksClient(t *testing.T) {
+	// Arrange
+	mw, _ := newTestBasicAuth(t, bcryptEntry(t, "alice", "wonderland"))
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.10:4321"
+		req.SetBasicAuth("alice", password)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Act
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusUnauthorized, serve("guess").Code)
+	}
+	rec := serve("wonderland")
+
+	// Assert
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+}
+
+func TestBasicAuthMiddleware_FileChange_Reloads(t *testing.T) {
+	// Arrange
+	mw, path := newTestBasicAuth(t, bcryptEntry(t, "alice", "wonderland"))
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth("carol", "secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	require.Equal(t, http.StatusUnauthorized, serve())
+
+	// Act
+	writeCredentialFile(t, path, bcryptEntry(t, "alice", "wonderland"), bcryptEntry(t, "carol", "secret"))
+
+	// Assert
+	assert.Eventually(t, func() bool {
+		return serve() == http.StatusOK
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestBasicAuthMiddleware_SymlinkSwap_Reloads(t *testing.T) {
+	// Arrange: lay out the file the way Kubernetes mounts a secret, with the
+	// file linking through a ..data symlink to a timestamped directory.
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..2026_01"), 0o700))
+	writeCredentialFile(t, filepath.Join(dir, "..2026_01", "htpasswd"), bcryptEntry(t, "alice", "wonderland"))
+	require.NoError(t, os.Symlink("..2026_01", filepath.Join(dir, "..data")))
+	require.NoError(t, os.Symlink(filepath.Join("..data", "htpasswd"), filepath.Join(dir, "htpasswd")))
+
+	config := DefaultBasicAuthConfig()
+	config.HTPasswdFile = filepath.Join(dir, "htpasswd")
+	mw, err := NewBasicAuthMiddleware(config, nil, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = mw.(*basicAuthMiddleware).Close() })
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth("carol", "secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	require.Equal(t, http.StatusUnauthorized, serve())
+
+	// Act
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..2026_02"), 0o700))
+	writeCredentialFile(t, filepath.Join(dir, "..2026_02", "htpasswd"), bcryptEntry(t, "carol", "secret"))
+	require.NoError(t, os.Symlink("..2026_02", filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+
+	// Assert
+	assert.Eventually(t, func() bool {
+		return serve() == http.StatusOK
+	}, 2*time.Second, 20*time.Millisecond)
+}
+
+func TestBasicAuthMiddleware_Close_StopsReloading(t *testing.T) {
+	// Arrange
+	mw, path := newTestBasicAuth(t, bcryptEntry(t, "alice", "wonderland"))
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Act
+	require.NoError(t, mw.(*basicAuthMiddleware).Close())
+	writeCredentialFile(t, path, bcryptEntry(t, "carol", "secret"))
+
+	// Assert
+	assert.Never(t, func() bool {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth("carol", "secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code == http.StatusOK
+	}, 200*time.Millisecond, 20*time.Millisecond)
+}
+
+func TestBasicAuthMiddleware_Success_DoesNotTrackClient(t *testing.T) {
+	// Arrange
+	mw, _ := newTestBasicAuth(t, bcryptEntry(t, "alice", "wonderland"))
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Act
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.SetBasicAuth("alice", "wonderland")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		require.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	// Assert
+	limiter := mw.(*basicAuthMiddleware).failures.limiter
+	limiter.mu.RLock()
+	defer limiter.mu.RUnlock()
+	assert.Empty(t, limiter.limiters)
+}
+
+func TestNewBasicAuthMiddleware_InvalidFile(t *testing.T) {
+	tests := []struct {
+		name          string
+		lines         []string
+		expectedError string
+	}{
+		{
+			name:  "NewBasicAuthMiddleware_PlaintextPassword_ReturnsError",
+			lines: []string{"alice:wonderland"},
+		},
+		{
+			name:  "NewBasicAuthMiddleware_MalformedLine_ReturnsError",
+			lines: []string{"alice"},
+		},
+		{
+			name:          "NewBasicAuthMiddleware_APR1Hash_ReturnsUnsupportedError",
+			lines:         []string{"alice:$apr1$r31.....$HqJZimcKQFAMYayBlzkrA/"},
+			expectedError: "apr1 (MD5) hash, which is not supported",
+		},
+		{
+			name:          "NewBasicAuthMiddleware_SHA256Hash_ReturnsError",
+			lines:         []string{sha256Entry("alice", "wonderland")},
+			expectedError: "only supported for API keys",
+		},
+		{
+			name:          "NewBasicAuthMiddleware_Argon2MemoryOverLimit_ReturnsError",
+			lines:         []string{"alice:$argon2id$v=19$m=4294967295,t=1,p=1$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA"},
+			expectedError: "memory must be between",
+		},
+		{
+			name:          "NewBasicAuthMiddleware_Argon2IterationsOverLimit_ReturnsError",
+			lines:         []string{"alice:$argon2id$v=19$m=8192,t=1000,p=1$c2FsdHNhbHQ$aGFzaGhhc2hoYXNoaGFzaA"},
+			expectedError: "iterations must be between",
+		},
+		{
+			name:          "NewBasicAuthMiddleware_Argon2KeyOverLimit_ReturnsError",
+			lines:         []string{"alice:$argon2id$v=19$m=8192,t=1,p=1$c2FsdHNhbHQ$" + strings.Repeat("A", 100)},
+			expectedError: "hash length must be between",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			path := filepath.Join(t.TempDir(), "htpasswd")
+			writeCredentialFile(t, path, tt.lines...)
+			config := DefaultBasicAuthConfig()
+			config.HTPasswdFile = path
+
+			// Act
+			mw, err := NewBasicAuthMiddleware(config, nil, nil)
+
+			// Assert
+			assert.Error(t, err)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+			}
+			assert.Nil(t, mw)
+		})
+	}
+}
@@ -0,0 +1,598 @@
+// Package middleware implements the shared HTTP response cache.
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/albedosehen/rwwwrse/internal/cache"
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// HeaderXCache reports how the cache answered a request.
+const HeaderXCache = "X-Cache"
+
+// Cache results reported in X-Cache and metrics.
+const (
+	CacheHit         = "HIT"
+	CacheMiss        = "MISS"
+	CacheStale       = "STALE"
+	CacheRevalidated = "REVALIDATED"
+	CacheBypass      = "BYPASS"
+)
+
+// cacheConditionalHeaders are the client preconditions the cache evaluates
+// itself against stored responses instead of forwarding them.
+var cacheConditionalHeaders = []string{"If-None-Match", "If-Modified-Since"}
+
+// CacheConfig holds configuration for the response cache of a route.
+type CacheConfig struct {
+	// Name identifies the route in logs and metrics.
+	Name string
+
+	// MaxEntrySize is the largest response body that is stored.
+	MaxEntrySize int64
+
+	// TTL overrides the freshness lifetime of every stored response.
+	TTL time.Duration
+
+	// DefaultTTL is the freshness lifetime of responses without explicit
+	// freshness information.
+	DefaultTTL time.Duration
+
+	// StaleWhileRevalidate and StaleIfError apply when the response does
+	// not set the corresponding Cache-Control directive.
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+}
+
+// DefaultCacheConfig returns a route cache configuration with sensible defaults.
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		MaxEntrySize: 8 << 20,
+	}
+}
+
+// cacheCall is an in-flight backend request that concurrent requests for
+// the same response wait for.
+type cacheCall struct {
+	done chan struct{}
+}
+
+// cacheMiddleware answers requests from the shared store and stores
+// cacheable backend responses.
+type cacheMiddleware struct {
+	config  CacheConfig
+	policy  cache.Policy
+	store   *cache.Store
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+	now     func() time.Time
+
+	mu       sync.Mutex
+	inflight map[string]*cacheCall
+}
+
+// NewCacheMiddleware creates a new response cache middleware using store.
+func NewCacheMiddleware(
+	config CacheConfig,
+	store *cache.Store,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewCacheValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return nil, ErrCacheStoreRequired
+	}
+
+	return &cacheMiddleware{
+		config: config,
+		policy: cache.Policy{
+			TTL:                  config.TTL,
+			DefaultTTL:           config.DefaultTTL,
+			StaleWhileRevalidate: config.StaleWhileRevalidate,
+			StaleIfError:         config.StaleIfError,
+		},
+		store:    store,
+		logger:   logger,
+		metrics:  metrics,
+		now:      time.Now,
+		inflight: make(map[string]*cacheCall),
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *cacheMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			m.serveUnsafe(w, r, next)
+			return
+		}
+
+		if cache.RequestBypassesCache(r) {
+			m.record(CacheBypass)
+			w.Header().Set(HeaderXCache, CacheBypass)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		primaryKey := cache.PrimaryKey(normalizeRouteHost(r.Host), r.URL.RequestURI())
+		entry, found := m.store.Lookup(primaryKey, r.Header)
+		now := m.now()
+
+		if found && !cache.RequestRequiresValidation(r) {
+			if entry.Fresh(now) {
+				m.serveEntry(w, r, entry, CacheHit)
+				return
+			}
+			if entry.UsableStale(now, entry.StaleWhileRevalidate) {
+				m.serveEntry(w, r, entry, CacheStale)
+				m.refresh(r, primaryKey, entry, next)
+				return
+			}
+		}
+
+		if !found && cache.ParseCacheControl(r.Header).Has("only-if-cached") {
+			m.record(CacheMiss)
+			writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeBackendTimeout, "Response not cached", nil))
+			return
+		}
+
+		m.fetch(w, r, primaryKey, entry, next)
+	})
+}
+
+// serveUnsafe forwards a request with an unsafe method and invalidates the
+// stored responses for its target when it succeeds (RFC 9111 section 4.4).
+func (m *cacheMiddleware) serveUnsafe(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	sw := &simpleResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+	next.ServeHTTP(sw, r)
+
+	if r.Method != http.MethodOptions && r.Method != http.MethodTrace && sw.statusCode < http.StatusBadRequest {
+		m.store.PurgePrimary(cache.PrimaryKey(normalizeRouteHost(r.Host), r.URL.RequestURI()))
+	}
+}
+
+// fetch forwards a request the cache cannot answer. Concurrent requests for
+// the same response wait for the first one and are answered from the store
+// if it produced a usable response.
+func (m *cacheMiddleware) fetch(w http.ResponseWriter, r *http.Request, primaryKey string, stored *cache.Entry, next http.Handler) {
+	key := primaryKey
+	if stored != nil {
+		key = stored.Key
+	}
+
+	call, leader := m.begin(key)
+	if !leader {
+		select {
+		case <-call.done:
+		case <-r.Context().Done():
+			return
+		}
+		if entry, ok := m.store.Lookup(primaryKey, r.Header); ok && entry.Fresh(m.now()) {
+			m.serveEntry(w, r, entry, CacheHit)
+			return
+		}
+		m.forward(w, r, primaryKey, stored, next)
+		return
+	}
+	defer m.end(key, call)
+
+	m.forward(w, r, primaryKey, stored, next)
+}
+
+// refresh revalidates a stale entry in the background.
+func (m *cacheMiddleware) refresh(r *http.Request, primaryKey string, stored *cache.Entry, next http.Handler) {
+	call, leader := m.begin(stored.Key)
+	if !leader {
+		return
+	}
+
+	req := r.Clone(context.WithoutCancel(r.Context()))
+	req.Method = http.MethodGet
+	go func() {
+		defer m.end(stored.Key, call)
+		defer func() {
+			if recovered := recover(); recovered != nil && m.logger != nil {
+				m.logger.Error(req.Context(), fmt.Errorf("panic: %v", recovered), "Background cache revalidation failed",
+					observability.String("route", m.config.Name),
+					observability.String("key", stored.Key),
+				)
+			}
+		}()
+		m.forward(nil, req, primaryKey, stored, next)
+	}()
+}
+
+// forward sends the request to the backend, validating stored if present,
+// and answers w from the response or the store. A nil w only updates the
+// store.
+func (m *cacheMiddleware) forward(w http.ResponseWriter, r *http.Request, primaryKey string, stored *cache.Entry, next http.Handler) {
+	req := r.Clone(r.Context())
+	for _, name := range cacheConditionalHeaders {
+		req.Header.Del(name)
+	}
+	if stored != nil {
+		if etag := stored.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := stored.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	requestTime := m.now()
+	rec := &cacheRecorder{
+		client: w,
+		header: make(http.Header),
+		limit:  m.config.MaxEntrySize,
+		decide: func(status int) bool {
+			if stored == nil {
+				return true
+			}
+			if status == http.StatusNotModified {
+				return false
+			}
+			return status < http.StatusInternalServerError || !stored.UsableStale(m.now(), stored.StaleIfError)
+		},
+	}
+	next.ServeHTTP(rec, req)
+	rec.finish()
+	responseTime := m.now()
+
+	switch {
+	case stored != nil && rec.status == http.StatusNotModified:
+		updated := stored.Revalidated(rec.header, requestTime, responseTime, m.policy)
+		m.store.Put(updated)
+		m.serveEntry(w, r, updated, CacheRevalidated)
+
+	case !rec.passthrough && stored != nil:
+		if m.logger != nil {
+			m.logger.Warn(r.Context(), "Serving stale response after backend error",
+				observability.String("request_id", GetRequestID(r.Context())),
+				observability.String("route", m.config.Name),
+				observability.Int("status", rec.status),
+			)
+		}
+		m.serveEntry(w, r, stored, CacheStale)
+
+	default:
+		if w != nil {
+			m.record(CacheMiss)
+		}
+		if !rec.overflow && cache.Storable(r, rec.status, rec.header, m.policy) {
+			m.store.Put(cache.NewEntry(primaryKey, r.Header, rec.status, rec.header, rec.body.Bytes(),
+				requestTime, responseTime, m.policy))
+		}
+	}
+}
+
+// serveEntry answers w from a stored response. A nil w is ignored.
+func (m *cacheMiddleware) serveEntry(w http.ResponseWriter, r *http.Request, entry *cache.Entry, result string) {
+	if w == nil {
+		return
+	}
+	m.record(result)
+
+	header := w.Header()
+	for name, values := range entry.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.FormatInt(int64(entry.Age(m.now())/time.Second), 10))
+	header.Set(HeaderXCache, result)
+
+	if entry.Status == http.StatusOK && cacheNotModified(r, entry) {
+		for _, name := range []string{"Content-Length", "Content-Type", "Content-Encoding"} {
+			header.Del(name)
+		}
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Length", strconv.Itoa(len(entry.Body)))
+	w.WriteHeader(entry.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(entry.Body)
+	}
+}
+
+// cacheNotModified evaluates the client's preconditions against a stored
+// response (RFC 9110 section 13.2.2).
+func cacheNotModified(r *http.Request, entry *cache.Entry) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		etag := strings.TrimPrefix(entry.Header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lastModified, err := http.ParseTime(entry.Header.Get("Last-Modified"))
+	return err == nil && !lastModified.After(ifModifiedSince)
+}
+
+// begin registers an in-flight request for key and reports whether the
+// caller leads it.
+func (m *cacheMiddleware) begin(key string) (*cacheCall, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if call, ok := m.inflight[key]; ok {
+		return call, false
+	}
+	call := &cacheCall{done: make(chan struct{})}
+	m.inflight[key] = call
+	return call, true
+}
+
+// end completes the in-flight request for key.
+func (m *cacheMiddleware) end(key string, call *cacheCall) {
+	m.mu.Lock()
+	delete(m.inflight, key)
+	m.mu.Unlock()
+	close(call.done)
+}
+
+// record records a cache result.
+func (m *cacheMiddleware) record(result string) {
+	if m.metrics != nil {
+		m.metrics.RecordCacheLookup(m.config.Name, strings.ToLower(result))
+	}
+}
+
+// cacheRecorder captures a backend response for the store. Once the status
+// is known, decide chooses whether the response is passed through to the
+// client, if any; otherwise the cache answers from the stored response.
+type cacheRecorder struct {
+	client http.ResponseWriter
+	header http.Header
+	decide func(status int) bool
+
+	status      int
+	wroteHeader bool
+	passthrough bool
+
+	body     bytes.Buffer
+	limit    int64
+	overflow bool
+}
+
+// Header implements http.ResponseWriter.
+func (rec *cacheRecorder) Header() http.Header {
+	return rec.header
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (rec *cacheRecorder) WriteHeader(code int) {
+	if rec.wroteHeader || (code >= 100 && code < 200) {
+		return
+	}
+	rec.wroteHeader = true
+	rec.status = code
+	rec.passthrough = rec.decide(code)
+
+	if rec.passthrough && rec.client != nil {
+		header := rec.client.Header()
+		for name, values := range rec.header {
+			header[name] = values
+		}
+		header.Del(cache.HeaderSurrogateKey)
+		header.Set(HeaderXCache, CacheMiss)
+		rec.client.WriteHeader(code)
+	}
+}
+
+// Write implements http.ResponseWriter.
+func (rec *cacheRecorder) Write(data []byte) (int, error) {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	if !rec.overflow {
+		if int64(rec.body.Len()+len(data)) > rec.limit {
+			rec.overflow = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(data)
+		}
+	}
+
+	if rec.passthrough && rec.client != nil {
+		return rec.client.Write(data)
+	}
+	return len(data), nil
+}
+
+// Flush implements http.Flusher interface.
+func (rec *cacheRecorder) Flush() {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.passthrough && rec.client != nil {
+		if flusher, ok := rec.client.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+}
+
+// finish completes a response the handler did not write.
+func (rec *cacheRecorder) finish() {
+	if !rec.wroteHeader {
+		rec.WriteHeader(http.StatusOK)
+	}
+}
+
+// CachePurgeConfig holds configuration for the cache purge API.
+type CachePurgeConfig struct {
+	// Path serves the purge API.
+	Path string
+
+	// Host is the only host the purge API answers on. Requests for the
+	// purge path on other hosts are handled as ordinary requests.
+	Host string
+
+	// Token is the bearer token required by the purge API.
+	Token string
+}
+
+// cachePurgeRequest is the body of a purge request.
+type cachePurgeRequest struct {
+	URLs []string `json:"urls"`
+	Tags []string `json:"tags"`
+}
+
+// cachePurgeMiddleware serves the cache purge API.
+type cachePurgeMiddleware struct {
+	config  CachePurgeConfig
+	store   *cache.Store
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+}
+
+// NewCachePurgeMiddleware creates a new cache purge API middleware for store.
+func NewCachePurgeMiddleware(
+	config CachePurgeConfig,
+	store *cache.Store,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	if !strings.HasPrefix(config.Path, "/") {
+		return nil, ErrInvalidCachePurgePath
+	}
+	if config.Host == "" {
+		return nil, ErrCachePurgeHostRequired
+	}
+	if config.Token == "" {
+		return nil, ErrCachePurgeTokenRequired
+	}
+	if store == nil {
+		return nil, ErrCacheStoreRequired
+	}
+
+	return &cachePurgeMiddleware{
+		config:  config,
+		store:   store,
+		logger:  logger,
+		metrics: metrics,
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *cachePurgeMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != m.config.Path || normalizeRouteHost(r.Host) != normalizeRouteHost(m.config.Host) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m.servePurge(w, r)
+	})
+}
+
+// servePurge handles the purge API:
+//
+//	POST {purge_path}  purges {"urls": [...], "tags": [...]}
+func (m *cachePurgeMiddleware) servePurge(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(m.config.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="cache"`)
+		writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeUnauthorized, "Invalid purge token", nil))
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, "Method not allowed", nil).
+			WithHTTPStatus(http.StatusMethodNotAllowed))
+		return
+	}
+
+	var req cachePurgeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 65536)).Decode(&req); err != nil {
+		writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, "Invalid request body", nil))
+		return
+	}
+
+	purged := 0
+	for _, raw := range req.URLs {
+		target, err := url.Parse(raw)
+		if err != nil || target.Host == "" {
+			writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, fmt.Sprintf("Invalid URL %q", raw), nil))
+			return
+		}
+		purged += m.store.PurgePrimary(cache.PrimaryKey(normalizeRouteHost(target.Host), target.RequestURI()))
+	}
+	for _, tag := range req.Tags {
+		purged += m.store.PurgeTag(tag)
+	}
+
+	if m.logger != nil {
+		m.logger.Info(r.Context(), "Cache purged via API",
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.Int("urls", len(req.URLs)),
+			observability.Int("tags", len(req.Tags)),
+			observability.Int("purged", purged),
+		)
+	}
+	writeAdminJSON(w, http.StatusOK, map[string]any{"purged": purged})
+}
+
+// CacheValidator validates route cache configuration.
+type CacheValidator struct{}
+
+// NewCacheValidator creates a new route cache configuration validator.
+func NewCacheValidator() *CacheValidator {
+	return &CacheValidator{}
+}
+
+// Validate validates the route cache configuration.
+func (v *CacheValidator) Validate(config CacheConfig) error {
+	if config.MaxEntrySize <= 0 {
+		return ErrInvalidCacheEntrySize
+	}
+
+	for name, value := range map[string]time.Duration{
+		"ttl":                    config.TTL,
+		"default_ttl":            config.DefaultTTL,
+		"stale_while_revalidate": config.StaleWhileRevalidate,
+		"stale_if_error":         config.StaleIfError,
+	} {
+		if value < 0 {
+			return fmt.Errorf("%w: %s is %s", ErrInvalidCacheDuration, name, value)
+		}
+	}
+
+	return nil
+}
+
+// Cache validation errors.
+var (
+	ErrCacheStoreRequired      = fmt.Errorf("cache store is required")
+	ErrInvalidCacheEntrySize   = fmt.Errorf("cache max entry size must be positive")
+	ErrInvalidCacheDuration    = fmt.Errorf("cache duration cannot be negative")
+	ErrInvalidCachePurgePath   = fmt.Errorf("cache purge path must start with /")
+	ErrCachePurgeHostRequired  = fmt.Errorf("cache purge host is required")
+	ErrCachePurgeTokenRequired = fmt.Errorf("cache purge token is required")
+)
@@ -0,0 +1,628 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/albedosehen/rwwwrse/internal/cache"
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+// cacheTestClock is a settable clock for cache tests.
+type cacheTestClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *cacheTestClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *cacheTestClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newTestCacheMiddleware creates a cache middleware with a fresh store and
+// a test clock.
+func newTestCacheMiddleware(t *testing.T, config CacheConfig) (*cacheMiddleware, *cache.Store, *cacheTestClock) {
+	t.Helper()
+
+	store, err := cache.NewStore(cache.StoreConfig{MaxBytes: 1 << 20})
+	require.NoError(t, err)
+
+	mw, err := NewCacheMiddleware(config, store, nil, nil)
+	require.NoError(t, err)
+
+	clock := &cacheTestClock{now: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)}
+	m := mw.(*cacheMiddleware)
+	m.now = clock.Now
+	return m, store, clock
+}
+
+// serveCache sends a request through handler and returns the recorder.
+func serveCache(handler http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestNewCacheMiddleware(t *testing.T) {
+	store, err := cache.NewStore(cache.StoreConfig{MaxBytes: 1 << 20})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		config      func() CacheConfig
+		store       *cache.Store
+		expectedErr error
+	}{
+		{
+			name:   "NewCacheMiddleware_Defaults_Created",
+			config: DefaultCacheConfig,
+			store:  store,
+		},
+		{
+			name:        "NewCacheMiddleware_NoStore_Error",
+			config:      DefaultCacheConfig,
+			expectedErr: ErrCacheStoreRequired,
+		},
+		{
+			name: "NewCacheMiddleware_ZeroEntrySize_Error",
+			config: func() CacheConfig {
+				return CacheConfig{}
+			},
+			store:       store,
+			expectedErr: ErrInvalidCacheEntrySize,
+		},
+		{
+			name: "NewCacheMiddleware_NegativeTTL_Error",
+			config: func() CacheConfig {
+				config := DefaultCacheConfig()
+				config.TTL = -time.Second
+				return config
+			},
+			store:       store,
+			expectedErr: ErrInvalidCacheDuration,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			mw, err := NewCacheMiddleware(tt.config(), tt.store, nil, nil)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Nil(t, mw)
+				return
+			}
+			require.NoError(t, err)
+			assert.NotNil(t, mw)
+		})
+	}
+}
+
+func TestCacheMiddleware_Wrap_HitAfterMiss(t *testing.T) {
+	// Arrange
+	metrics := testhelpers.NewMockMetricsCollector()
+	metrics.On("RecordCacheLookup", "app.example.com", mock.Anything).Return()
+
+	store, err := cache.NewStore(cache.StoreConfig{MaxBytes: 1 << 20})
+	require.NoError(t, err)
+	config := DefaultCacheConfig()
+	config.Name = "app.example.com"
+	mw, err := NewCacheMiddleware(config, store, nil, metrics)
+	require.NoError(t, err)
+
+	var calls atomic.Int32
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set(cache.HeaderSurrogateKey, "home")
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	// Act
+	first := serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+	second := serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+	head := serveCache(handler, http.MethodHead, "http://app.example.com/", nil)
+
+	// Assert
+	assert.Equal(t, CacheMiss, first.Header().Get(HeaderXCache))
+	assert.Empty(t, first.Header().Get(cache.HeaderSurrogateKey))
+	assert.Equal(t, "hello", first.Body.String())
+
+	assert.Equal(t, CacheHit, second.Header().Get(HeaderXCache))
+	assert.Equal(t, "hello", second.Body.String())
+	assert.Equal(t, "5", second.Header().Get("Content-Length"))
+	assert.NotEmpty(t, second.Header().Get("Age"))
+
+	assert.Equal(t, CacheHit, head.Header().Get(HeaderXCache))
+	assert.Empty(t, head.Body.String())
+
+	assert.Equal(t, int32(1), calls.Load())
+	metrics.AssertCalled(t, "RecordCacheLookup", "app.example.com", "miss")
+	metrics.AssertCalled(t, "RecordCacheLookup", "app.example.com", "hit")
+}
+
+func TestCacheMiddleware_Wrap_Bypass(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		requestHeader  http.Header
+		responseHeader http.Header
+		expectedCache  string
+	}{
+		{
+			name:           "Wrap_NoStoreResponse_NotStored",
+			method:         http.MethodGet,
+			responseHeader: http.Header{"Cache-Control": {"no-store"}},
+			expectedCache:  CacheMiss,
+		},
+		{
+			name:           "Wrap_SetCookie_NotStored",
+			method:         http.MethodGet,
+			responseHeader: http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"id=1"}},
+			expectedCache:  CacheMiss,
+		},
+		{
+			name:           "Wrap_RangeRequest_Bypassed",
+			method:         http.MethodGet,
+			requestHeader:  http.Header{"Range": {"bytes=0-1"}},
+			responseHeader: http.Header{"Cache-Control": {"max-age=60"}},
+			expectedCache:  CacheBypass,
+		},
+		{
+			name:           "Wrap_NoStoreRequest_Bypassed",
+			method:         http.MethodGet,
+			requestHeader:  http.Header{"Cache-Control": {"no-store"}},
+			responseHeader: http.Header{"Cache-Control": {"max-age=60"}},
+			expectedCache:  CacheBypass,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			m, _, _ := newTestCacheMiddleware(t, DefaultCacheConfig())
+			var calls atomic.Int32
+			handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				for name, values := range tt.responseHeader {
+					w.Header()[name] = values
+				}
+				_, _ = w.Write([]byte("body"))
+			}))
+
+			// Act
+			first := serveCache(handler, tt.method, "http://app.example.com/", tt.requestHeader)
+			serveCache(handler, tt.method, "http://app.example.com/", tt.requestHeader)
+
+			// Assert
+			assert.Equal(t, tt.expectedCache, first.Header().Get(HeaderXCache))
+			assert.Equal(t, "body", first.Body.String())
+			assert.Equal(t, int32(2), calls.Load())
+		})
+	}
+}
+
+func TestCacheMiddleware_Wrap_Vary(t *testing.T) {
+	// Arrange
+	m, _, _ := newTestCacheMiddleware(t, DefaultCacheConfig())
+	var calls atomic.Int32
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = w.Write([]byte(r.Header.Get("Accept-Language")))
+	}))
+
+	// Act
+	serveCache(handler, http.MethodGet, "http://app.example.com/", http.Header{"Accept-Language": {"en"}})
+	serveCache(handler, http.MethodGet, "http://app.example.com/", http.Header{"Accept-Language": {"de"}})
+	en := serveCache(handler, http.MethodGet, "http://app.example.com/", http.Header{"Accept-Language": {"en"}})
+	de := serveCache(handler, http.MethodGet, "http://app.example.com/", http.Header{"Accept-Language": {"de"}})
+
+	// Assert
+	assert.Equal(t, "en", en.Body.String())
+	assert.Equal(t, CacheHit, en.Header().Get(HeaderXCache))
+	assert.Equal(t, "de", de.Body.String())
+	assert.Equal(t, CacheHit, de.Header().Get(HeaderXCache))
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCacheMiddleware_Wrap_Revalidate(t *testing.T) {
+	// Arrange
+	m, _, clock := newTestCacheMiddleware(t, DefaultCacheConfig())
+	var conditional atomic.Int32
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			conditional.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+	clock.Advance(2 * time.Minute)
+
+	// Act
+	revalidated := serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+	hit := serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+	notModified := serveCache(handler, http.MethodGet, "http://app.example.com/", http.Header{"If-None-Match": {`W/"v1"`}})
+
+	// Assert
+	assert.Equal(t, http.StatusOK, revalidated.Code)
+	assert.Equal(t, CacheRevalidated, revalidated.Header().Get(HeaderXCache))
+	assert.Equal(t, "hello", revalidated.Body.String())
+	assert.Equal(t, CacheHit, hit.Header().Get(HeaderXCache))
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.String())
+	assert.Equal(t, int32(1), conditional.Load())
+}
+
+func TestCacheMiddleware_Wrap_ClientNoCache(t *testing.T) {
+	// Arrange
+	m, _, _ := newTestCacheMiddleware(t, DefaultCacheConfig())
+	var calls atomic.Int32
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Last-Modified", "Thu, 01 Jan 2026 00:00:00 GMT")
+		if r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte("hello"))
+	}))
+	serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+
+	// Act
+	rec := serveCache(handler, http.MethodGet, "http://app.example.com/", http.Header{"Cache-Control": {"no-cache"}})
+
+	// Assert
+	assert.Equal(t, CacheRevalidated, rec.Header().Get(HeaderXCache))
+	assert.Equal(t, "hello", rec.Body.String())
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCacheMiddleware_Wrap_StaleWhileRevalidate(t *testing.T) {
+	// Arrange
+	m, store, clock := newTestCacheMiddleware(t, DefaultCacheConfig())
+	var version atomic.Int32
+	refreshed := make(chan struct{}, 1)
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v := version.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=120")
+		_, _ = w.Write([]byte(strings.Repeat("v", int(v))))
+		if v > 1 {
+			refreshed <- struct{}{}
+		}
+	}))
+	serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+	clock.Advance(90 * time.Second)
+
+	// Act
+	stale := serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("background revalidation did not run")
+	}
+	require.Eventually(t, func() bool {
+		entry, ok := store.Lookup(cache.PrimaryKey("app.example.com", "/"), http.Header{})
+		return ok && string(entry.Body) == "vv"
+	}, time.Second, 5*time.Millisecond)
+	fresh := serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+
+	// Assert
+	assert.Equal(t, CacheStale, stale.Header().Get(HeaderXCache))
+	assert.Equal(t, "v", stale.Body.String())
+	assert.Equal(t, CacheHit, fresh.Header().Get(HeaderXCache))
+	assert.Equal(t, "vv", fresh.Body.String())
+}
+
+func TestCacheMiddleware_Wrap_StaleIfError(t *testing.T) {
+	tests := []struct {
+		name           string
+		staleIfError   time.Duration
+		expectedStatus int
+		expectedCache  string
+	}{
+		{
+			name:           "Wrap_StaleIfErrorAllowed_ServesStale",
+			staleIfError:   time.Hour,
+			expectedStatus: http.StatusOK,
+			expectedCache:  CacheStale,
+		},
+		{
+			name:           "Wrap_StaleIfErrorNotAllowed_ServesError",
+			expectedStatus: http.StatusBadGateway,
+			expectedCache:  CacheMiss,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultCacheConfig()
+			config.StaleIfError = tt.staleIfError
+			m, _, clock := newTestCacheMiddleware(t, config)
+			var failing atomic.Bool
+			handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if failing.Load() {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				w.Header().Set("Cache-Control", "max-age=60")
+				_, _ = w.Write([]byte("hello"))
+			}))
+			serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+			clock.Advance(2 * time.Minute)
+			failing.Store(true)
+
+			// Act
+			rec := serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, tt.expectedCache, rec.Header().Get(HeaderXCache))
+		})
+	}
+}
+
+func TestCacheMiddleware_Wrap_RouteTTL(t *testing.T) {
+	// Arrange
+	config := DefaultCacheConfig()
+	config.TTL = 10 * time.Minute
+	m, _, clock := newTestCacheMiddleware(t, config)
+	var calls atomic.Int32
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Cache-Control", "max-age=1")
+		_, _ = w.Write([]byte("hello"))
+	}))
+	serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+	clock.Advance(5 * time.Minute)
+
+	// Act
+	rec := serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+
+	// Assert
+	assert.Equal(t, CacheHit, rec.Header().Get(HeaderXCache))
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCacheMiddleware_Wrap_CoalescesMisses(t *testing.T) {
+	// Arrange
+	m, _, _ := newTestCacheMiddleware(t, DefaultCacheConfig())
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	// Act
+	const clients = 5
+	var wg sync.WaitGroup
+	bodies := make([]string, clients)
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			bodies[i] = serveCache(handler, http.MethodGet, "http://app.example.com/", nil).Body.String()
+		}(i)
+	}
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// Assert
+	assert.Equal(t, int32(1), calls.Load())
+	for _, body := range bodies {
+		assert.Equal(t, "hello", body)
+	}
+}
+
+func TestCacheMiddleware_Wrap_UnsafeMethodInvalidates(t *testing.T) {
+	// Arrange
+	m, store, _ := newTestCacheMiddleware(t, DefaultCacheConfig())
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("hello"))
+	}))
+	serveCache(handler, http.MethodGet, "http://app.example.com/items", nil)
+	require.Equal(t, 1, store.Len())
+
+	// Act
+	rec := serveCache(handler, http.MethodPost, "http://app.example.com/items", nil)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestCacheMiddleware_Wrap_OversizedNotStored(t *testing.T) {
+	// Arrange
+	config := DefaultCacheConfig()
+	config.MaxEntrySize = 4
+	m, store, _ := newTestCacheMiddleware(t, config)
+	handler := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("hello"))
+	}))
+
+	// Act
+	rec := serveCache(handler, http.MethodGet, "http://app.example.com/", nil)
+
+	// Assert
+	assert.Equal(t, "hello", rec.Body.String())
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestCacheMiddleware_Wrap_BasicAuthNotShared(t *testing.T) {
+	// Arrange
+	auth, _ := newTestBasicAuth(t, bcryptEntry(t, "alice", "alice-pass"), bcryptEntry(t, "bob", "bob-pass"))
+	m, store, _ := newTestCacheMiddleware(t, DefaultCacheConfig())
+	userHeader := DefaultBasicAuthConfig().UserHeader
+	handler := auth.Wrap(m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		_, _ = w.Write([]byte("account of " + r.Header.Get(userHeader)))
+	})))
+	serve := func(user, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "http://app.example.com/account", nil)
+		req.SetBasicAuth(user, password)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Act
+	alice := serve("alice", "alice-pass")
+	bob := serve("bob", "bob-pass")
+
+	// Assert
+	assert.Equal(t, "account of alice", alice.Body.String())
+	assert.Equal(t, "account of bob", bob.Body.String())
+	assert.Equal(t, 0, store.Len())
+}
+
+func TestCachePurgeMiddleware(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		host           string
+		authorization  string
+		body           string
+		expectedStatus int
+		expectedLen    int
+	}{
+		{
+			name:           "Purge_ByURL_Removed",
+			method:         http.MethodPost,
+			authorization:  "Bearer secret",
+			body:           `{"urls":["https://App.example.com/product/1"]}`,
+			expectedStatus: http.StatusOK,
+			expectedLen:    2,
+		},
+		{
+			name:           "Purge_ByTag_Removed",
+			method:         http.MethodPost,
+			authorization:  "Bearer secret",
+			body:           `{"tags":["catalog"]}`,
+			expectedStatus: http.StatusOK,
+			expectedLen:    1,
+		},
+		{
+			name:           "Purge_OtherHost_NotServed",
+			method:         http.MethodPost,
+			host:           "app.example.com",
+			authorization:  "Bearer secret",
+			body:           `{"tags":["catalog"]}`,
+			expectedStatus: http.StatusOK,
+			expectedLen:    3,
+		},
+		{
+			name:           "Purge_WrongToken_Unauthorized",
+			method:         http.MethodPost,
+			authorization:  "Bearer wrong",
+			body:           `{"tags":["catalog"]}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedLen:    3,
+		},
+		{
+			name:           "Purge_TokenWithoutScheme_Unauthorized",
+			method:         http.MethodPost,
+			authorization:  "secret",
+			body:           `{"tags":["catalog"]}`,
+			expectedStatus: http.StatusUnauthorized,
+			expectedLen:    3,
+		},
+		{
+			name:           "Purge_Get_MethodNotAllowed",
+			method:         http.MethodGet,
+			authorization:  "Bearer secret",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedLen:    3,
+		},
+		{
+			name:           "Purge_RelativeURL_BadRequest",
+			method:         http.MethodPost,
+			authorization:  "Bearer secret",
+			body:           `{"urls":["/product/1"]}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedLen:    3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			m, store, _ := newTestCacheMiddleware(t, DefaultCacheConfig())
+			backend := m.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Cache-Control", "max-age=60")
+				if strings.HasPrefix(r.URL.Path, "/product/") {
+					w.Header().Set(cache.HeaderSurrogateKey, "catalog")
+				}
+				_, _ = w.Write([]byte("hello"))
+			}))
+			for _, path := range []string{"/product/1", "/product/2", "/about"} {
+				serveCache(backend, http.MethodGet, "http://app.example.com"+path, nil)
+			}
+			require.Equal(t, 3, store.Len())
+
+			purge, err := NewCachePurgeMiddleware(CachePurgeConfig{
+				Path:  "/_rwwwrse/cache",
+				Host:  "Proxy.example.com",
+				Token: "secret",
+			}, store, nil, nil)
+			require.NoError(t, err)
+			handler := purge.Wrap(backend)
+
+			req := httptest.NewRequest(tt.method, "http://proxy.example.com/_rwwwrse/cache", strings.NewReader(tt.body))
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			req.Header.Set("Authorization", tt.authorization)
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, tt.expectedLen, store.Len())
+			if tt.expectedStatus >= http.StatusBadRequest {
+				assert.Equal(t, proxyerrors.ProblemContentType, rec.Header().Get("Content-Type"))
+			}
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="cache"`, rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
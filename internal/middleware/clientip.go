@@ -0,0 +1,73 @@
+// Package middleware implements trusted-proxy aware client IP resolution.
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/albedosehen/rwwwrse/internal/clientip"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// ClientIPConfig holds configuration for the client IP middleware.
+type ClientIPConfig struct {
+	// TrustedProxies lists proxy CIDRs or addresses whose forwarding
+	// headers are believed. With none, the peer address is the client.
+	TrustedProxies []string
+
+	// Header is the forwarding header walked to find the client:
+	// "X-Forwarded-For" or "Forwarded".
+	Header string
+
+	// PreserveForwardedHeaders keeps inbound forwarding headers as sent
+	// instead of overwriting them with the resolved chain.
+	PreserveForwardedHeaders bool
+}
+
+// DefaultClientIPConfig returns a configuration that trusts no proxies.
+func DefaultClientIPConfig() ClientIPConfig {
+	return ClientIPConfig{
+		TrustedProxies: []string{},
+		Header:         clientip.HeaderXForwardedFor,
+	}
+}
+
+// clientIPMiddleware resolves the client address once per request.
+type clientIPMiddleware struct {
+	resolver *clientip.Resolver
+	preserve bool
+	logger   observability.Logger
+}
+
+// NewClientIPMiddleware creates a new client IP resolution middleware.
+func NewClientIPMiddleware(config ClientIPConfig, logger observability.Logger) (Middleware, error) {
+	resolver, err := clientip.NewResolver(config.TrustedProxies, config.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientIPMiddleware{
+		resolver: resolver,
+		preserve: config.PreserveForwardedHeaders,
+		logger:   logger,
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *clientIPMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := m.resolver.Resolve(r)
+
+		if !m.preserve {
+			result.Overwrite(r.Header)
+		}
+
+		if m.logger != nil && result.IP != result.Peer {
+			m.logger.Debug(r.Context(), "Resolved client IP from trusted proxy",
+				observability.String("client_ip", result.IP),
+				observability.String("peer", result.Peer),
+			)
+		}
+
+		next.ServeHTTP(w, r.WithContext(clientip.WithResult(r.Context(), result)))
+	})
+}
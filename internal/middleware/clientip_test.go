@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIPMiddleware_Wrap(t *testing.T) {
+	tests := []struct {
+		name             string
+		preserve         bool
+		remoteAddr       string
+		forwardedFor     string
+		expectedClientIP string
+		expectedXFF      string
+	}{
+		{
+			name:             "ClientIP_SpoofedHeaderFromUntrustedPeer_Overwritten",
+			remoteAddr:       "203.0.113.10:40000",
+			forwardedFor:     "198.51.100.1",
+			expectedClientIP: "203.0.113.10",
+			expectedXFF:      "",
+		},
+		{
+			name:             "ClientIP_TrustedProxy_StripsSpoofedPrefix",
+			remoteAddr:       "10.0.0.1:40000",
+			forwardedFor:     "198.51.100.1, 203.0.113.5",
+			expectedClientIP: "203.0.113.5",
+			expectedXFF:      "203.0.113.5",
+		},
+		{
+			name:             "ClientIP_PreserveHeaders_KeepsInboundHeader",
+			preserve:         true,
+			remoteAddr:       "203.0.113.10:40000",
+			forwardedFor:     "198.51.100.1",
+			expectedClientIP: "203.0.113.10",
+			expectedXFF:      "198.51.100.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultClientIPConfig()
+			config.TrustedProxies = []string{"10.0.0.0/8"}
+			config.PreserveForwardedHeaders = tt.preserve
+			mw, err := NewClientIPMiddleware(config, nil)
+			require.NoError(t, err)
+
+			var clientIP, rateLimitKey, forwardedFor string
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				clientIP = getClientIP(r)
+				rateLimitKey = defaultKeyFunc(r)
+				forwardedFor = r.Header.Get("X-Forwarded-For")
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedClientIP, clientIP)
+			assert.Equal(t, tt.expectedClientIP, rateLimitKey)
+			assert.Equal(t, tt.expectedXFF, forwardedFor)
+		})
+	}
+}
@@ -0,0 +1,496 @@
+// Package middleware implements response compression.
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// Supported content codings.
+const (
+	EncodingGzip   = "gzip"
+	EncodingZstd   = "zstd"
+	EncodingBrotli = "br"
+)
+
+// zstdWindowSize is the largest window HTTP clients are required to
+// support for zstd content coding (RFC 9659).
+const zstdWindowSize = 8 << 20
+
+// defaultCompressibleTypes are the media types compressed by default.
+var defaultCompressibleTypes = []string{
+	"text/html",
+	"text/plain",
+	"text/css",
+	"text/csv",
+	"text/javascript",
+	"text/xml",
+	"application/javascript",
+	"application/json",
+	"application/problem+json",
+	"application/ld+json",
+	"application/manifest+json",
+	"application/xml",
+	"application/wasm",
+	"image/svg+xml",
+}
+
+// compressionEncoder is a resettable streaming encoder for one content coding.
+type compressionEncoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// compressionCodecs create encoders for the supported content codings.
+// Levels are validated before an encoder is created.
+var compressionCodecs = map[string]func(level int) compressionEncoder{
+	EncodingGzip: func(level int) compressionEncoder {
+		w, _ := gzip.NewWriterLevel(nil, level)
+		return w
+	},
+	EncodingZstd: func(level int) compressionEncoder {
+		e, _ := zstd.NewWriter(nil,
+			zstd.WithEncoderLevel(zstd.EncoderLevel(level)),
+			zstd.WithEncoderConcurrency(1),
+			zstd.WithWindowSize(zstdWindowSize),
+		)
+		return e
+	},
+	EncodingBrotli: func(level int) compressionEncoder {
+		return brotli.NewWriterLevel(nil, level)
+	},
+}
+
+// CompressionConfig holds configuration for the compression middleware.
+type CompressionConfig struct {
+	// Name identifies the route in logs and metrics.
+	Name string
+
+	// Encodings are the content codings offered, most preferred first.
+	Encodings []string
+
+	// GzipLevel is the gzip compression level, 1 (fastest) to 9 (best).
+	GzipLevel int
+
+	// ZstdLevel is the zstd encoder level, 1 (fastest) to 4 (best).
+	ZstdLevel int
+
+	// BrotliLevel is the brotli compression level, 0 (fastest) to 11 (best).
+	BrotliLevel int
+
+	// MinSize is the smallest response body, in bytes, that is compressed.
+	// Responses that are flushed before reaching it are compressed anyway.
+	MinSize int
+
+	// ContentTypes are the media types that are compressed. A type ending
+	// in "/*" matches every subtype.
+	ContentTypes []string
+}
+
+// DefaultCompressionConfig returns a compression configuration with sensible defaults.
+func DefaultCompressionConfig() CompressionConfig {
+	return CompressionConfig{
+		Encodings:    []string{EncodingZstd, EncodingBrotli, EncodingGzip},
+		GzipLevel:    6,
+		ZstdLevel:    int(zstd.SpeedDefault),
+		BrotliLevel:  4,
+		MinSize:      1024,
+		ContentTypes: append([]string(nil), defaultCompressibleTypes...),
+	}
+}
+
+// compressionMiddleware compresses eligible responses with the best content
+// coding the client accepts.
+type compressionMiddleware struct {
+	config       CompressionConfig
+	contentTypes map[string]bool
+	pools        map[string]*sync.Pool
+	logger       observability.Logger
+	metrics      observability.MetricsCollector
+}
+
+// NewCompressionMiddleware creates a new compression middleware.
+func NewCompressionMiddleware(
+	config CompressionConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewCompressionValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	contentTypes := make(map[string]bool, len(config.ContentTypes))
+	for _, contentType := range config.ContentTypes {
+		contentTypes[strings.ToLower(contentType)] = true
+	}
+
+	levels := map[string]int{
+		EncodingGzip:   config.GzipLevel,
+		EncodingZstd:   config.ZstdLevel,
+		EncodingBrotli: config.BrotliLevel,
+	}
+	pools := make(map[string]*sync.Pool, len(config.Encodings))
+	for _, encoding := range config.Encodings {
+		codec, level := compressionCodecs[encoding], levels[encoding]
+		pools[encoding] = &sync.Pool{New: func() any { return codec(level) }}
+	}
+
+	return &compressionMiddleware{
+		config:       config,
+		contentTypes: contentTypes,
+		pools:        pools,
+		logger:       logger,
+		metrics:      metrics,
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *compressionMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !compressibleRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressionResponseWriter{
+			ResponseWriter: w,
+			middleware:     m,
+			encoding:       m.negotiate(r.Header.Values("Accept-Encoding")),
+		}
+		defer cw.close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressibleRequest reports whether the response to r may be compressed.
+// Range requests address bytes of the identity representation, and upgraded
+// connections and tunnels do not carry an HTTP response body.
+func compressibleRequest(r *http.Request) bool {
+	if r.Method == http.MethodHead || r.Method == http.MethodConnect {
+		return false
+	}
+	if r.Header.Get("Range") != "" || r.Header.Get("Upgrade") != "" {
+		return false
+	}
+	return !headerHasToken(r.Header, "Connection", "upgrade")
+}
+
+// negotiate selects the content coding for an Accept-Encoding header, or ""
+// when the client accepts none of the configured codings. Ties in the
+// client's weights are broken by the configured preference.
+func (m *compressionMiddleware) negotiate(values []string) string {
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			params := strings.Split(part, ";")
+			coding := strings.ToLower(strings.TrimSpace(params[0]))
+			if coding == "" {
+				continue
+			}
+
+			q := 1.0
+			for _, param := range params[1:] {
+				name, raw, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(name, "q") {
+					if parsed, err := strconv.ParseFloat(raw, 64); err == nil && parsed >= 0 && parsed <= 1 {
+						q = parsed
+					}
+				}
+			}
+
+			if coding == "*" {
+				wildcard = q
+			} else {
+				weights[coding] = q
+			}
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range m.config.Encodings {
+		q, ok := weights[encoding]
+		if !ok {
+			q = max(wildcard, 0)
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressibleType reports whether responses of contentType are compressed.
+func (m *compressionMiddleware) compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if m.contentTypes[mediaType] {
+		return true
+	}
+	major, _, _ := strings.Cut(mediaType, "/")
+	return m.contentTypes[major+"/*"]
+}
+
+// compressionResponseWriter buffers the start of a response until it can
+// decide whether to compress it, then streams the rest through the encoder.
+type compressionResponseWriter struct {
+	http.ResponseWriter
+	middleware *compressionMiddleware
+	encoding   string
+
+	status      int
+	wroteHeader bool
+	started     bool
+	buf         []byte
+
+	encoder         compressionEncoder
+	counter         *countingWriter
+	uncompressedLen int64
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *compressionResponseWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = code
+
+	if !w.mayCompress() || w.encoding == "" {
+		w.start(false)
+		return
+	}
+
+	if length := w.Header().Get("Content-Length"); length != "" {
+		size, err := strconv.Atoi(length)
+		w.start(err == nil && size >= w.middleware.config.MinSize)
+	}
+}
+
+// Write implements http.ResponseWriter.
+func (w *compressionResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if !w.started {
+		w.buf = append(w.buf, data...)
+		if len(w.buf) >= w.middleware.config.MinSize {
+			if err := w.startBuffered(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(data), nil
+	}
+
+	if w.encoder != nil {
+		w.uncompressedLen += int64(len(data))
+		return w.encoder.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush implements http.Flusher interface. A response flushed before the
+// minimum size is reached is streaming, so it is compressed if eligible.
+func (w *compressionResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.started {
+		_ = w.startBuffered(w.encoding != "")
+	}
+	if w.encoder != nil {
+		_ = w.encoder.Flush()
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *compressionResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// mayCompress reports whether the response headers allow compression and,
+// if so, marks the response as varying by Accept-Encoding.
+func (w *compressionResponseWriter) mayCompress() bool {
+	header := w.Header()
+	if w.status < http.StatusOK || w.status == http.StatusNoContent ||
+		w.status == http.StatusPartialContent || w.status == http.StatusNotModified {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || headerHasToken(header, "Cache-Control", "no-transform") {
+		return false
+	}
+	if contentType := header.Get("Content-Type"); contentType != "" && !w.middleware.compressibleType(contentType) {
+		return false
+	}
+
+	if !headerHasToken(header, "Vary", "accept-encoding") && !headerHasToken(header, "Vary", "*") {
+		header.Add("Vary", "Accept-Encoding")
+	}
+	return true
+}
+
+// startBuffered starts the response once the buffered body decides it.
+// Without a Content-Type the type is sniffed from the uncompressed body, as
+// net/http would otherwise sniff the compressed bytes.
+func (w *compressionResponseWriter) startBuffered(compress bool) error {
+	if w.Header().Get("Content-Type") == "" && len(w.buf) > 0 {
+		contentType := http.DetectContentType(w.buf)
+		w.Header().Set("Content-Type", contentType)
+		compress = compress && w.middleware.compressibleType(contentType)
+	}
+
+	w.start(compress)
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	_, err := w.Write(buf)
+	return err
+}
+
+// start writes the response header, switching to the encoder if compress.
+func (w *compressionResponseWriter) start(compress bool) {
+	w.started = true
+
+	if compress {
+		header := w.Header()
+		header.Del("Content-Length")
+		header.Del("Accept-Ranges")
+		header.Set("Content-Encoding", w.encoding)
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+
+		w.counter = &countingWriter{w: w.ResponseWriter}
+		w.encoder = w.middleware.pools[w.encoding].Get().(compressionEncoder)
+		w.encoder.Reset(w.counter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+// close finishes the response after the handler returns.
+func (w *compressionResponseWriter) close() {
+	if !w.wroteHeader {
+		return
+	}
+	if !w.started {
+		_ = w.startBuffered(false)
+	}
+	if w.encoder == nil {
+		return
+	}
+
+	_ = w.encoder.Close()
+	w.encoder.Reset(nil)
+	w.middleware.pools[w.encoding].Put(w.encoder)
+	w.encoder = nil
+
+	if w.middleware.metrics != nil {
+		w.middleware.metrics.RecordCompression(w.middleware.config.Name, w.encoding, w.uncompressedLen, w.counter.n)
+	}
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(data []byte) (int, error) {
+	n, err := c.w.Write(data)
+	c.n += int64(n)
+	return n, err
+}
+
+// headerHasToken reports whether a comma-separated header contains token,
+// ignoring case.
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CompressionValidator validates compression configuration.
+type CompressionValidator struct{}
+
+// NewCompressionValidator creates a new compression configuration validator.
+func NewCompressionValidator() *CompressionValidator {
+	return &CompressionValidator{}
+}
+
+// Validate validates the compression configuration.
+func (v *CompressionValidator) Validate(config CompressionConfig) error {
+	if len(config.Encodings) == 0 {
+		return ErrNoCompressionEncodings
+	}
+
+	for _, encoding := range config.Encodings {
+		if _, ok := compressionCodecs[encoding]; !ok {
+			supported := make([]string, 0, len(compressionCodecs))
+			for name := range compressionCodecs {
+				supported = append(supported, name)
+			}
+			sort.Strings(supported)
+			return fmt.Errorf("%w: %q (supported: %s)", ErrUnsupportedEncoding, encoding, strings.Join(supported, ", "))
+		}
+	}
+
+	if config.GzipLevel < gzip.BestSpeed || config.GzipLevel > gzip.BestCompression {
+		return fmt.Errorf("%w: gzip level %d", ErrInvalidCompressionLevel, config.GzipLevel)
+	}
+
+	if config.ZstdLevel < int(zstd.SpeedFastest) || config.ZstdLevel > int(zstd.SpeedBestCompression) {
+		return fmt.Errorf("%w: zstd level %d", ErrInvalidCompressionLevel, config.ZstdLevel)
+	}
+
+	if config.BrotliLevel < brotli.BestSpeed || config.BrotliLevel > brotli.BestCompression {
+		return fmt.Errorf("%w: brotli level %d", ErrInvalidCompressionLevel, config.BrotliLevel)
+	}
+
+	if config.MinSize < 0 {
+		return ErrInvalidCompressionMinSize
+	}
+
+	return nil
+}
+
+// Compression validation errors.
+var (
+	ErrNoCompressionEncodings    = fmt.Errorf("at least one compression encoding is required")
+	ErrUnsupportedEncoding       = fmt.Errorf("unsupported compression encoding")
+	ErrInvalidCompressionLevel   = fmt.Errorf("compression level out of range")
+	ErrInvalidCompressionMinSize = fmt.Errorf("compression minimum size cannot be negative")
+)
@@ -0,0 +1,357 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+// decodeBody decodes a response body with its content coding.
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var reader io.Reader
+	switch encoding {
+	case EncodingGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		reader = gz
+	case EncodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		require.NoError(t, err)
+		defer zr.Close()
+		reader = zr
+	case EncodingBrotli:
+		reader = brotli.NewReader(bytes.NewReader(body))
+	default:
+		return string(body)
+	}
+
+	decoded, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	return string(decoded)
+}
+
+func TestCompressionMiddleware_Negotiate(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		expected       string
+	}{
+		{
+			name:           "Negotiate_Gzip_Gzip",
+			acceptEncoding: "gzip, deflate",
+			expected:       EncodingGzip,
+		},
+		{
+			name:           "Negotiate_BrowserDefaults_Preferred",
+			acceptEncoding: "gzip, deflate, br, zstd",
+			expected:       EncodingZstd,
+		},
+		{
+			name:           "Negotiate_ClientWeights_Honored",
+			acceptEncoding: "zstd;q=0.5, gzip",
+			expected:       EncodingGzip,
+		},
+		{
+			name:           "Negotiate_ExcludedByWildcard_Fallback",
+			acceptEncoding: "zstd;q=0, *",
+			expected:       EncodingBrotli,
+		},
+		{
+			name:           "Negotiate_BrotliPreferred_Brotli",
+			acceptEncoding: "gzip;q=0.8, br",
+			expected:       EncodingBrotli,
+		},
+		{
+			name:           "Negotiate_SafariDefaults_Brotli",
+			acceptEncoding: "gzip, deflate, br",
+			expected:       EncodingBrotli,
+		},
+		{
+			name:           "Negotiate_Unsupported_Identity",
+			acceptEncoding: "deflate",
+			expected:       "",
+		},
+		{
+			name:           "Negotiate_Absent_Identity",
+			acceptEncoding: "",
+			expected:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mw, err := NewCompressionMiddleware(DefaultCompressionConfig(), nil, nil)
+			require.NoError(t, err)
+
+			// Act
+			encoding := mw.(*compressionMiddleware).negotiate([]string{tt.acceptEncoding})
+
+			// Assert
+			assert.Equal(t, tt.expected, encoding)
+		})
+	}
+}
+
+func TestCompressionMiddleware_Wrap(t *testing.T) {
+	large := strings.Repeat(`{"id":1,"name":"widget"},`, 100)
+
+	tests := []struct {
+		name             string
+		acceptEncoding   string
+		requestHeader    http.Header
+		responseHeader   http.Header
+		body             string
+		expectedEncoding string
+		expectedVary     bool
+	}{
+		{
+			name:             "Wrap_LargeJSON_Gzip",
+			acceptEncoding:   "gzip",
+			responseHeader:   http.Header{"Content-Type": {"application/json"}},
+			body:             large,
+			expectedEncoding: EncodingGzip,
+			expectedVary:     true,
+		},
+		{
+			name:             "Wrap_LargeJSON_Zstd",
+			acceptEncoding:   "zstd",
+			responseHeader:   http.Header{"Content-Type": {"application/json"}},
+			body:             large,
+			expectedEncoding: EncodingZstd,
+			expectedVary:     true,
+		},
+		{
+			name:             "Wrap_LargeJSON_Brotli",
+			acceptEncoding:   "br",
+			responseHeader:   http.Header{"Content-Type": {"application/json"}},
+			body:             large,
+			expectedEncoding: EncodingBrotli,
+			expectedVary:     true,
+		},
+		{
+			name:             "Wrap_ContentLengthAboveMinimum_Compressed",
+			acceptEncoding:   "gzip",
+			responseHeader:   http.Header{"Content-Type": {"text/html"}, "Content-Length": {strconv.Itoa(len(large))}},
+			body:             large,
+			expectedEncoding: EncodingGzip,
+			expectedVary:     true,
+		},
+		{
+			name:             "Wrap_SniffedHTML_Compressed",
+			acceptEncoding:   "gzip",
+			body:             "<!DOCTYPE html><html>" + large + "</html>",
+			expectedEncoding: EncodingGzip,
+			expectedVary:     true,
+		},
+		{
+			name:           "Wrap_SmallBody_Identity",
+			acceptEncoding: "gzip",
+			responseHeader: http.Header{"Content-Type": {"application/json"}},
+			body:           `{"ok":true}`,
+			expectedVary:   true,
+		},
+		{
+			name:           "Wrap_NoAcceptEncoding_IdentityWithVary",
+			responseHeader: http.Header{"Content-Type": {"application/json"}},
+			body:           large,
+			expectedVary:   true,
+		},
+		{
+			name:           "Wrap_ImageType_Identity",
+			acceptEncoding: "gzip",
+			responseHeader: http.Header{"Content-Type": {"image/png"}},
+			body:           large,
+		},
+		{
+			name:             "Wrap_AlreadyEncoded_Untouched",
+			acceptEncoding:   "gzip",
+			responseHeader:   http.Header{"Content-Type": {"application/json"}, "Content-Encoding": {"deflate"}},
+			body:             large,
+			expectedEncoding: "deflate",
+		},
+		{
+			name:           "Wrap_NoTransform_Identity",
+			acceptEncoding: "gzip",
+			responseHeader: http.Header{"Content-Type": {"application/json"}, "Cache-Control": {"no-transform"}},
+			body:           large,
+		},
+		{
+			name:           "Wrap_RangeRequest_Identity",
+			acceptEncoding: "gzip",
+			requestHeader:  http.Header{"Range": {"bytes=0-99"}},
+			responseHeader: http.Header{"Content-Type": {"application/json"}},
+			body:           large,
+		},
+		{
+			name:           "Wrap_UpgradeRequest_Identity",
+			acceptEncoding: "gzip",
+			requestHeader:  http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}},
+			responseHeader: http.Header{"Content-Type": {"application/json"}},
+			body:           large,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			_, compressed := compressionCodecs[tt.expectedEncoding]
+			metrics := testhelpers.NewMockMetricsCollector()
+			if compressed {
+				metrics.On("RecordCompression", "app.example.com", tt.expectedEncoding,
+					int64(len(tt.body)), mock.AnythingOfType("int64")).Return().Once()
+			}
+
+			config := DefaultCompressionConfig()
+			config.Name = "app.example.com"
+			mw, err := NewCompressionMiddleware(config, nil, metrics)
+			require.NoError(t, err)
+
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for name, values := range tt.responseHeader {
+					w.Header()[name] = values
+				}
+				_, _ = io.WriteString(w, tt.body)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for name, values := range tt.requestHeader {
+				req.Header[name] = values
+			}
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.expectedEncoding, rec.Header().Get("Content-Encoding"))
+			if tt.expectedVary {
+				assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+			} else {
+				assert.Empty(t, rec.Header().Get("Vary"))
+			}
+			if compressed {
+				assert.Empty(t, rec.Header().Get("Content-Length"))
+				assert.Less(t, rec.Body.Len(), len(tt.body))
+				assert.Equal(t, tt.body, decodeBody(t, tt.expectedEncoding, rec.Body.Bytes()))
+			} else {
+				assert.Equal(t, tt.body, rec.Body.String())
+			}
+			metrics.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCompressionMiddleware_Wrap_Streaming(t *testing.T) {
+	// Arrange
+	mw, err := NewCompressionMiddleware(DefaultCompressionConfig(), nil, nil)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	flushedLen := 0
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = io.WriteString(w, "first event\n")
+		w.(http.Flusher).Flush()
+		flushedLen = rec.Body.Len()
+		_, _ = io.WriteString(w, "second event\n")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/events", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	// Act
+	handler.ServeHTTP(rec, req)
+
+	// Assert
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, EncodingGzip, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, `W/"v1"`, rec.Header().Get("ETag"))
+	assert.Positive(t, flushedLen, "flushed data reaches the client before the handler returns")
+	assert.Equal(t, "first event\nsecond event\n", decodeBody(t, EncodingGzip, rec.Body.Bytes()))
+}
+
+func TestCompressionValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*CompressionConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*CompressionConfig) {},
+		},
+		{
+			name:        "Validate_NoEncodings_ReturnsError",
+			mutate:      func(c *CompressionConfig) { c.Encodings = nil },
+			expectedErr: ErrNoCompressionEncodings,
+		},
+		{
+			name:   "Validate_BrotliOnly_Valid",
+			mutate: func(c *CompressionConfig) { c.Encodings = []string{EncodingBrotli} },
+		},
+		{
+			name:        "Validate_BrotliLevelTooHigh_ReturnsError",
+			mutate:      func(c *CompressionConfig) { c.BrotliLevel = 12 },
+			expectedErr: ErrInvalidCompressionLevel,
+		},
+		{
+			name:        "Validate_UnknownEncoding_ReturnsError",
+			mutate:      func(c *CompressionConfig) { c.Encodings = []string{"deflate", EncodingGzip} },
+			expectedErr: ErrUnsupportedEncoding,
+		},
+		{
+			name:        "Validate_GzipLevelTooHigh_ReturnsError",
+			mutate:      func(c *CompressionConfig) { c.GzipLevel = 10 },
+			expectedErr: ErrInvalidCompressionLevel,
+		},
+		{
+			name:        "Validate_ZstdLevelZero_ReturnsError",
+			mutate:      func(c *CompressionConfig) { c.ZstdLevel = 0 },
+			expectedErr: ErrInvalidCompressionLevel,
+		},
+		{
+			name:        "Validate_NegativeMinSize_ReturnsError",
+			mutate:      func(c *CompressionConfig) { c.MinSize = -1 },
+			expectedErr: ErrInvalidCompressionMinSize,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultCompressionConfig()
+			tt.mutate(&config)
+
+			// Act
+			err := NewCompressionValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,489 @@
+// Package middleware implements adaptive concurrency limiting and load shedding.
+package middleware
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// Concurrency limit algorithms.
+const (
+	ConcurrencyAlgorithmAIMD     = "aimd"
+	ConcurrencyAlgorithmGradient = "gradient"
+)
+
+// Reasons a request is shed, used as metric labels.
+const (
+	LoadShedQueueFull    = "queue_full"
+	LoadShedQueueTimeout = "queue_timeout"
+)
+
+// Gradient algorithm tuning.
+const (
+	gradientRTTSmoothing   = 0.05
+	gradientLimitSmoothing = 0.2
+	gradientTolerance      = 1.5
+	gradientMinChange      = 0.5
+)
+
+// ConcurrencyPriorityRule assigns a queue priority to matching requests.
+type ConcurrencyPriorityRule struct {
+	// PathPrefix restricts the rule to paths with this prefix.
+	PathPrefix string
+
+	// Header restricts the rule to requests carrying this header.
+	Header string
+
+	// Value is the required header value; empty matches any value.
+	Value string
+
+	// Priority is assigned to matching requests. Higher values are served first.
+	Priority int
+}
+
+// ConcurrencyConfig holds configuration for the concurrency limit middleware.
+type ConcurrencyConfig struct {
+	// Name identifies the limited backend in logs and metrics.
+	Name string
+
+	// Algorithm is "aimd" or "gradient".
+	Algorithm string
+
+	// InitialLimit, MinLimit and MaxLimit bound the adaptive limit.
+	InitialLimit int
+	MinLimit     int
+	MaxLimit     int
+
+	// LatencyThreshold is the response time above which AIMD backs off.
+	LatencyThreshold time.Duration
+
+	// BackoffRatio multiplies the AIMD limit when backing off.
+	BackoffRatio float64
+
+	// QueueSize bounds the number of waiting requests.
+	QueueSize int
+
+	// QueueTimeout bounds how long a request may wait for a slot.
+	QueueTimeout time.Duration
+
+	// RetryAfter is advertised to shed clients.
+	RetryAfter time.Duration
+
+	// DefaultPriority applies to requests matching no rule.
+	DefaultPriority int
+
+	// Priorities are evaluated in order; the first match decides.
+	Priorities []ConcurrencyPriorityRule
+}
+
+// DefaultConcurrencyConfig returns a concurrency limit configuration with sensible defaults.
+func DefaultConcurrencyConfig() ConcurrencyConfig {
+	return ConcurrencyConfig{
+		Algorithm:        ConcurrencyAlgorithmGradient,
+		InitialLimit:     20,
+		MinLimit:         1,
+		MaxLimit:         200,
+		LatencyThreshold: time.Second,
+		BackoffRatio:     0.9,
+		QueueSize:        100,
+		QueueTimeout:     time.Second,
+		RetryAfter:       time.Second,
+		Priorities:       []ConcurrencyPriorityRule{},
+	}
+}
+
+// concurrencyAlgorithm adapts a concurrency limit from observed samples.
+type concurrencyAlgorithm interface {
+	// update records a completed request and returns the new limit.
+	update(rtt time.Duration, inflight int, dropped bool) int
+}
+
+// aimdLimit grows the limit by one while requests are fast and shrinks it
+// multiplicatively when a request is slow or fails.
+type aimdLimit struct {
+	limit     float64
+	min, max  float64
+	threshold time.Duration
+	backoff   float64
+}
+
+func (a *aimdLimit) update(rtt time.Duration, inflight int, dropped bool) int {
+	if dropped || rtt > a.threshold {
+		a.limit = math.Max(a.min, math.Floor(a.limit*a.backoff))
+	} else if float64(inflight)*2 >= a.limit {
+		// Only grow while the limit is actually being used.
+		a.limit = math.Min(a.max, a.limit+1)
+	}
+	return int(a.limit)
+}
+
+// gradientLimit compares each sample against a long-term latency baseline
+// and shrinks the limit in proportion to how much latency has grown, while
+// leaving headroom of sqrt(limit) for queueing.
+type gradientLimit struct {
+	limit    float64
+	min, max float64
+	longRTT  float64
+}
+
+func (g *gradientLimit) update(rtt time.Duration, inflight int, dropped bool) int {
+	sample := float64(rtt)
+	if sample <= 0 {
+		sample = 1
+	}
+
+	if g.longRTT == 0 {
+		g.longRTT = sample
+	} else {
+		g.longRTT = g.longRTT*(1-gradientRTTSmoothing) + sample*gradientRTTSmoothing
+	}
+
+	// An app-limited backend says nothing about its capacity.
+	if !dropped && float64(inflight)*2 < g.limit {
+		return int(g.limit)
+	}
+
+	gradient := math.Max(gradientMinChange, math.Min(1, gradientTolerance*g.longRTT/sample))
+	if dropped {
+		gradient = gradientMinChange
+	}
+
+	target := g.limit*gradient + math.Sqrt(g.limit)
+	g.limit = g.limit*(1-gradientLimitSmoothing) + target*gradientLimitSmoothing
+	g.limit = math.Max(g.min, math.Min(g.max, g.limit))
+
+	return int(g.limit)
+}
+
+// concurrencyWaiter is a request queued for a slot.
+type concurrencyWaiter struct {
+	priority int
+	seq      uint64
+	index    int
+	result   chan bool
+}
+
+// concurrencyQueue orders waiters by priority, then by arrival.
+type concurrencyQueue []*concurrencyWaiter
+
+func (q concurrencyQueue) Len() int { return len(q) }
+
+func (q concurrencyQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q concurrencyQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *concurrencyQueue) Push(x any) {
+	w := x.(*concurrencyWaiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *concurrencyQueue) Pop() any {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
+
+// lowest returns the index of the waiter that would be served last.
+func (q concurrencyQueue) lowest() int {
+	lowest := 0
+	for i := 1; i < len(q); i++ {
+		if q.Less(lowest, i) {
+			lowest = i
+		}
+	}
+	return lowest
+}
+
+// concurrencyMiddleware caps in-flight requests with an adaptive limit.
+type concurrencyMiddleware struct {
+	config    ConcurrencyConfig
+	algorithm concurrencyAlgorithm
+	logger    observability.Logger
+	metrics   observability.MetricsCollector
+
+	mu       sync.Mutex
+	limit    int
+	inflight int
+	queue    concurrencyQueue
+	seq      uint64
+}
+
+// NewConcurrencyMiddleware creates a new adaptive concurrency limit middleware.
+func NewConcurrencyMiddleware(
+	config ConcurrencyConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewConcurrencyValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	m := &concurrencyMiddleware{
+		config:  config,
+		limit:   config.InitialLimit,
+		logger:  logger,
+		metrics: metrics,
+	}
+
+	if config.Algorithm == ConcurrencyAlgorithmAIMD {
+		m.algorithm = &aimdLimit{
+			limit:     float64(config.InitialLimit),
+			min:       float64(config.MinLimit),
+			max:       float64(config.MaxLimit),
+			threshold: config.LatencyThreshold,
+			backoff:   config.BackoffRatio,
+		}
+	} else {
+		m.algorithm = &gradientLimit{
+			limit: float64(config.InitialLimit),
+			min:   float64(config.MinLimit),
+			max:   float64(config.MaxLimit),
+		}
+	}
+
+	if metrics != nil {
+		metrics.SetConcurrencyLimit(config.Name, m.limit)
+		metrics.SetConcurrencyQueueDepth(config.Name, 0)
+	}
+
+	return m, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *concurrencyMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reason := m.acquire(r.Context(), m.priority(r)); reason != "" {
+			m.shed(w, r, reason)
+			return
+		}
+
+		start := time.Now()
+		wrapped := &simpleResponseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		dropped := true
+		defer func() {
+			m.release(time.Since(start), dropped)
+		}()
+
+		next.ServeHTTP(wrapped, r)
+
+		dropped = isOverloadStatus(wrapped.statusCode) || errors.Is(r.Context().Err(), context.DeadlineExceeded)
+	})
+}
+
+// priority returns the queue priority of r.
+func (m *concurrencyMiddleware) priority(r *http.Request) int {
+	for _, rule := range m.config.Priorities {
+		if rule.PathPrefix != "" && !strings.HasPrefix(r.URL.Path, rule.PathPrefix) {
+			continue
+		}
+		if rule.Header != "" {
+			value := r.Header.Get(rule.Header)
+			if value == "" || (rule.Value != "" && value != rule.Value) {
+				continue
+			}
+		}
+		return rule.Priority
+	}
+	return m.config.DefaultPriority
+}
+
+// acquire takes a slot, queueing when the limit is reached. It returns the
+// shed reason, or "" once the request holds a slot.
+func (m *concurrencyMiddleware) acquire(ctx context.Context, priority int) string {
+	m.mu.Lock()
+
+	if m.inflight < m.limit && len(m.queue) == 0 {
+		m.inflight++
+		m.mu.Unlock()
+		return ""
+	}
+
+	if len(m.queue) >= m.config.QueueSize {
+		// A full queue admits a request only by displacing a lower-priority one.
+		lowest := -1
+		if len(m.queue) > 0 {
+			lowest = m.queue.lowest()
+		}
+		if lowest < 0 || m.queue[lowest].priority >= priority {
+			m.mu.Unlock()
+			return LoadShedQueueFull
+		}
+		evicted := heap.Remove(&m.queue, lowest).(*concurrencyWaiter)
+		evicted.result <- false
+	}
+
+	m.seq++
+	waiter := &concurrencyWaiter{priority: priority, seq: m.seq, result: make(chan bool, 1)}
+	heap.Push(&m.queue, waiter)
+	m.recordQueueDepthLocked()
+	m.mu.Unlock()
+
+	timer := time.NewTimer(m.config.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case granted := <-waiter.result:
+		if granted {
+			return ""
+		}
+		return LoadShedQueueFull
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if waiter.index >= 0 {
+		heap.Remove(&m.queue, waiter.index)
+		m.recordQueueDepthLocked()
+		return LoadShedQueueTimeout
+	}
+
+	// The waiter was resolved while timing out; keep a granted slot.
+	if <-waiter.result {
+		return ""
+	}
+	return LoadShedQueueFull
+}
+
+// release frees a slot, adapts the limit and admits queued requests.
+func (m *concurrencyMiddleware) release(rtt time.Duration, dropped bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inflight := m.inflight
+	m.inflight--
+
+	limit := m.algorithm.update(rtt, inflight, dropped)
+	if limit != m.limit {
+		m.limit = limit
+		if m.metrics != nil {
+			m.metrics.SetConcurrencyLimit(m.config.Name, limit)
+		}
+	}
+
+	m.grantLocked()
+}
+
+// grantLocked hands free slots to the highest-priority waiters.
+func (m *concurrencyMiddleware) grantLocked() {
+	granted := false
+	for m.inflight < m.limit && len(m.queue) > 0 {
+		waiter := heap.Pop(&m.queue).(*concurrencyWaiter)
+		m.inflight++
+		waiter.result <- true
+		granted = true
+	}
+	if granted {
+		m.recordQueueDepthLocked()
+	}
+}
+
+// recordQueueDepthLocked exports the current queue depth.
+func (m *concurrencyMiddleware) recordQueueDepthLocked() {
+	if m.metrics != nil {
+		m.metrics.SetConcurrencyQueueDepth(m.config.Name, len(m.queue))
+	}
+}
+
+// shed rejects r with 503 and Retry-After.
+func (m *concurrencyMiddleware) shed(w http.ResponseWriter, r *http.Request, reason string) {
+	requestID := GetRequestID(r.Context())
+	retryAfter := int64(math.Ceil(m.config.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	if m.logger != nil {
+		m.logger.Warn(r.Context(), "Request shed by concurrency limit",
+			observability.String("request_id", requestID),
+			observability.String("backend", m.config.Name),
+			observability.String("reason", reason),
+			observability.String("client_ip", getClientIP(r)),
+			observability.String("method", r.Method),
+			observability.String("path", r.URL.Path),
+		)
+	}
+
+	if m.metrics != nil {
+		m.metrics.RecordLoadShed(m.config.Name, reason)
+	}
+
+	w.Header().Set(HeaderRetryAfter, strconv.FormatInt(retryAfter, 10))
+	err := proxyerrors.WrapError(proxyerrors.ErrCodeServiceUnavailable, "Service overloaded", nil).
+		WithContext("retry_after", retryAfter)
+	writeErrorResponse(w, r, err)
+}
+
+// isOverloadStatus reports whether status signals an overloaded backend.
+func isOverloadStatus(status int) bool {
+	return status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
+
+// ConcurrencyValidator validates concurrency limit configuration.
+type ConcurrencyValidator struct{}
+
+// NewConcurrencyValidator creates a new concurrency limit validator.
+func NewConcurrencyValidator() *ConcurrencyValidator {
+	return &ConcurrencyValidator{}
+}
+
+// Validate validates the concurrency limit configuration.
+func (v *ConcurrencyValidator) Validate(config ConcurrencyConfig) error {
+	switch config.Algorithm {
+	case "", ConcurrencyAlgorithmAIMD, ConcurrencyAlgorithmGradient:
+	default:
+		return ErrInvalidConcurrencyAlgorithm
+	}
+
+	if config.MinLimit <= 0 || config.MaxLimit < config.MinLimit ||
+		config.InitialLimit < config.MinLimit || config.InitialLimit > config.MaxLimit {
+		return ErrInvalidConcurrencyLimit
+	}
+
+	if config.Algorithm == ConcurrencyAlgorithmAIMD && (config.BackoffRatio <= 0 || config.BackoffRatio >= 1) {
+		return ErrInvalidBackoffRatio
+	}
+
+	if config.QueueSize < 0 || config.QueueTimeout < 0 {
+		return ErrInvalidConcurrencyQueue
+	}
+
+	return nil
+}
+
+// Concurrency limit validation errors.
+var (
+	ErrInvalidConcurrencyAlgorithm = fmt.Errorf("invalid concurrency algorithm: must be aimd or gradient")
+	ErrInvalidConcurrencyLimit     = fmt.Errorf("invalid concurrency limit: require 0 < min <= initial <= max")
+	ErrInvalidBackoffRatio         = fmt.Errorf("invalid backoff ratio: must be between 0 and 1")
+	ErrInvalidConcurrencyQueue     = fmt.Errorf("invalid concurrency queue: size and timeout cannot be negative")
+)
@@ -0,0 +1,332 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/albedosehen/rwwwrse/internal/observability"
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+// blockingBackend is a handler that holds requests until released.
+type blockingBackend struct {
+	release chan struct{}
+	started chan string
+
+	mu    sync.Mutex
+	order []string
+}
+
+func newBlockingBackend() *blockingBackend {
+	return &blockingBackend{
+		release: make(chan struct{}),
+		started: make(chan string, 16),
+	}
+}
+
+func (b *blockingBackend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b.mu.Lock()
+	b.order = append(b.order, r.URL.Path)
+	b.mu.Unlock()
+
+	b.started <- r.URL.Path
+	<-b.release
+	w.WriteHeader(http.StatusOK)
+}
+
+func (b *blockingBackend) Order() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.order...)
+}
+
+// newTestConcurrencyMiddleware creates a concurrency middleware with a fixed limit.
+func newTestConcurrencyMiddleware(t *testing.T, mutate func(*ConcurrencyConfig), metrics observability.MetricsCollector) *concurrencyMiddleware {
+	t.Helper()
+
+	config := DefaultConcurrencyConfig()
+	config.Name = "api.example.com"
+	config.InitialLimit = 1
+	config.MinLimit = 1
+	config.MaxLimit = 1
+	mutate(&config)
+
+	mw, err := NewConcurrencyMiddleware(config, nil, metrics)
+	require.NoError(t, err)
+	return mw.(*concurrencyMiddleware)
+}
+
+// serveAsync serves a request in the background and returns its recorder.
+func serveAsync(handler http.Handler, path string, header http.Header, wg *sync.WaitGroup) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		handler.ServeHTTP(rec, req)
+	}()
+	return rec
+}
+
+// waitForQueue waits until n requests are queued.
+func waitForQueue(t *testing.T, m *concurrencyMiddleware, n int) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return len(m.queue) == n
+	}, 2*time.Second, 5*time.Millisecond)
+}
+
+func TestConcurrencyMiddleware_QueueFull_Sheds(t *testing.T) {
+	// Arrange
+	metrics := testhelpers.NewMockMetricsCollector()
+	metrics.On("SetConcurrencyLimit", "api.example.com", mock.Anything).Return().Maybe()
+	metrics.On("SetConcurrencyQueueDepth", "api.example.com", mock.Anything).Return().Maybe()
+	metrics.On("RecordLoadShed", "api.example.com", LoadShedQueueFull).Return().Once()
+
+	m := newTestConcurrencyMiddleware(t, func(c *ConcurrencyConfig) {
+		c.QueueSize = 0
+		c.RetryAfter = 2 * time.Second
+	}, metrics)
+	backend := newBlockingBackend()
+	handler := m.Wrap(backend)
+
+	var wg sync.WaitGroup
+	first := serveAsync(handler, "/first", nil, &wg)
+	<-backend.started
+
+	// Act
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/second", nil))
+	close(backend.release)
+	wg.Wait()
+
+	// Assert
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderRetryAfter))
+	metrics.AssertExpectations(t)
+}
+
+func TestConcurrencyMiddleware_QueueTimeout_Sheds(t *testing.T) {
+	// Arrange
+	m := newTestConcurrencyMiddleware(t, func(c *ConcurrencyConfig) {
+		c.QueueSize = 1
+		c.QueueTimeout = 20 * time.Millisecond
+	}, nil)
+	backend := newBlockingBackend()
+	handler := m.Wrap(backend)
+
+	var wg sync.WaitGroup
+	serveAsync(handler, "/first", nil, &wg)
+	<-backend.started
+
+	// Act
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/second", nil))
+	close(backend.release)
+	wg.Wait()
+
+	// Assert
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, []string{"/first"}, backend.Order())
+}
+
+func TestConcurrencyMiddleware_Priority(t *testing.T) {
+	tests := []struct {
+		name          string
+		queueSize     int
+		expectedOrder []string
+		expectLowShed bool
+	}{
+		{
+			name:          "Priority_QueuedRequests_HighestServedFirst",
+			queueSize:     2,
+			expectedOrder: []string{"/first", "/admin", "/low"},
+		},
+		{
+			name:          "Priority_FullQueue_EvictsLowerPriority",
+			queueSize:     1,
+			expectedOrder: []string{"/first", "/admin"},
+			expectLowShed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			m := newTestConcurrencyMiddleware(t, func(c *ConcurrencyConfig) {
+				c.QueueSize = tt.queueSize
+				c.QueueTimeout = 2 * time.Second
+				c.Priorities = []ConcurrencyPriorityRule{
+					{PathPrefix: "/admin", Header: "X-Priority", Value: "high", Priority: 10},
+				}
+			}, nil)
+			backend := newBlockingBackend()
+			handler := m.Wrap(backend)
+
+			var wg sync.WaitGroup
+			serveAsync(handler, "/first", nil, &wg)
+			<-backend.started
+			low := serveAsync(handler, "/low", nil, &wg)
+			waitForQueue(t, m, 1)
+
+			// Act
+			serveAsync(handler, "/admin", http.Header{"X-Priority": {"high"}}, &wg)
+			if tt.queueSize > 1 {
+				waitForQueue(t, m, 2)
+			} else {
+				require.Eventually(t, func() bool {
+					m.mu.Lock()
+					defer m.mu.Unlock()
+					return len(m.queue) == 1 && m.queue[0].priority == 10
+				}, 2*time.Second, 5*time.Millisecond)
+			}
+			close(backend.release)
+			wg.Wait()
+
+			// Assert
+			assert.Equal(t, tt.expectedOrder, backend.Order())
+			if tt.expectLowShed {
+				assert.Equal(t, http.StatusServiceUnavailable, low.Code)
+			} else {
+				assert.Equal(t, http.StatusOK, low.Code)
+			}
+		})
+	}
+}
+
+func TestAIMDLimit_Update(t *testing.T) {
+	tests := []struct {
+		name     string
+		rtt      time.Duration
+		inflight int
+		dropped  bool
+		expected int
+	}{
+		{
+			name:     "AIMD_FastAndUtilized_Increases",
+			rtt:      10 * time.Millisecond,
+			inflight: 10,
+			expected: 11,
+		},
+		{
+			name:     "AIMD_FastButIdle_Unchanged",
+			rtt:      10 * time.Millisecond,
+			inflight: 2,
+			expected: 10,
+		},
+		{
+			name:     "AIMD_SlowResponse_BacksOff",
+			rtt:      2 * time.Second,
+			inflight: 10,
+			expected: 9,
+		},
+		{
+			name:     "AIMD_Dropped_BacksOff",
+			rtt:      10 * time.Millisecond,
+			inflight: 10,
+			dropped:  true,
+			expected: 9,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			limit := &aimdLimit{limit: 10, min: 1, max: 20, threshold: time.Second, backoff: 0.9}
+
+			// Act
+			result := limit.update(tt.rtt, tt.inflight, tt.dropped)
+
+			// Assert
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestGradientLimit_LatencyIncrease_ShrinksLimit(t *testing.T) {
+	// Arrange
+	limit := &gradientLimit{limit: 50, min: 1, max: 100}
+	for i := 0; i < 50; i++ {
+		limit.update(10*time.Millisecond, 50, false)
+	}
+	steady := int(limit.limit)
+
+	// Act
+	var result int
+	for i := 0; i < 10; i++ {
+		result = limit.update(100*time.Millisecond, steady, false)
+	}
+
+	// Assert
+	assert.Less(t, result, steady)
+	assert.GreaterOrEqual(t, result, 1)
+}
+
+func TestConcurrencyValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*ConcurrencyConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*ConcurrencyConfig) {},
+		},
+		{
+			name:        "Validate_UnknownAlgorithm_ReturnsError",
+			mutate:      func(c *ConcurrencyConfig) { c.Algorithm = "vegas" },
+			expectedErr: ErrInvalidConcurrencyAlgorithm,
+		},
+		{
+			name:        "Validate_InitialAboveMax_ReturnsError",
+			mutate:      func(c *ConcurrencyConfig) { c.InitialLimit = c.MaxLimit + 1 },
+			expectedErr: ErrInvalidConcurrencyLimit,
+		},
+		{
+			name: "Validate_AIMDInvalidBackoff_ReturnsError",
+			mutate: func(c *ConcurrencyConfig) {
+				c.Algorithm = ConcurrencyAlgorithmAIMD
+				c.BackoffRatio = 1.5
+			},
+			expectedErr: ErrInvalidBackoffRatio,
+		},
+		{
+			name:        "Validate_NegativeQueue_ReturnsError",
+			mutate:      func(c *ConcurrencyConfig) { c.QueueSize = -1 },
+			expectedErr: ErrInvalidConcurrencyQueue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultConcurrencyConfig()
+			tt.mutate(&config)
+
+			// Act
+			err := NewConcurrencyValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -4,19 +4,27 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/headers"
 	"github.com/albedosehen/rwwwrse/internal/observability"
 )
 
 // CORSConfig holds configuration for CORS middleware.
 type CORSConfig struct {
 	// AllowedOrigins is a list of origins that may access the resource.
-	// Use ["*"] to allow any origin.
+	// Use ["*"] to allow any origin, and "*.example.com" or
+	// "https://*.example.com" to allow any subdomain.
 	AllowedOrigins []string
 
+	// AllowedOriginPatterns lists regular expressions matched against the
+	// full origin. Patterns are anchored at both ends.
+	AllowedOriginPatterns []string
+
 	// AllowedMethods is a list of methods the client is allowed to use.
 	AllowedMethods []string
 
@@ -86,9 +94,10 @@ func RestrictiveCORSConfig() CORSConfig {
 
 // corsMiddleware implements CORS middleware.
 type corsMiddleware struct {
-	config  CORSConfig
-	logger  observability.Logger
-	metrics observability.MetricsCollector
+	config         CORSConfig
+	originPatterns []*regexp.Regexp
+	logger         observability.Logger
+	metrics        observability.MetricsCollector
 }
 
 // NewCORSMiddleware creates a new CORS middleware with default config.
@@ -110,7 +119,7 @@ func NewCORSMiddlewareWithConfig(
 	metrics observability.MetricsCollector,
 ) Middleware {
 	// Validate and normalize config
-	if len(config.AllowedOrigins) == 0 {
+	if len(config.AllowedOrigins) == 0 && len(config.AllowedOriginPatterns) == 0 {
 		config.AllowedOrigins = []string{"*"}
 	}
 	if len(config.AllowedMethods) == 0 {
@@ -120,11 +129,34 @@ func NewCORSMiddlewareWithConfig(
 		config.AllowedHeaders = []string{"Accept", "Content-Type"}
 	}
 
+	patterns := make([]*regexp.Regexp, 0, len(config.AllowedOriginPatterns))
+	for _, pattern := range config.AllowedOriginPatterns {
+		if re, err := headers.CompileOriginPattern(pattern); err == nil {
+			patterns = append(patterns, re)
+		}
+	}
+
 	return &corsMiddleware{
-		config:  config,
-		logger:  logger,
-		metrics: metrics,
+		config:         config,
+		originPatterns: patterns,
+		logger:         logger,
+		metrics:        metrics,
+	}
+}
+
+// NewCORSPolicyMiddleware creates a CORS middleware for a route policy,
+// rejecting invalid configurations instead of normalizing them.
+func NewCORSPolicyMiddleware(
+	config CORSConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewCORSValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
 	}
+
+	return NewCORSMiddlewareWithConfig(config, logger, metrics), nil
 }
 
 // Wrap implements the Middleware interface.
@@ -156,7 +188,7 @@ func (m *corsMiddleware) Wrap(next http.Handler) http.Handler {
 				_ = m.metrics // Acknowledge metrics is available but not used yet
 			}
 
-			w.WriteHeader(http.StatusForbidden)
+			writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeInvalidOrigin, "Origin not allowed", nil))
 			return
 		}
 
@@ -204,6 +236,18 @@ func (m *corsMiddleware) isOriginAllowed(origin string) bool {
 				return true
 			}
 		}
+		// Support scheme-qualified wildcard subdomains (e.g., "https://*.example.com")
+		if scheme, domain, found := strings.Cut(allowedOrigin, "://*."); found {
+			host, ok := strings.CutPrefix(origin, scheme+"://")
+			if ok && strings.HasSuffix(host, "."+domain) && !strings.ContainsAny(host, "/") {
+				return true
+			}
+		}
+	}
+	for _, pattern := range m.originPatterns {
+		if pattern.MatchString(origin) {
+			return true
+		}
 	}
 	return false
 }
@@ -367,71 +411,29 @@ func NewCORSValidator() *CORSValidator {
 
 // Validate validates the CORS configuration.
 func (v *CORSValidator) Validate(config CORSConfig) error {
-	// Validate origins
-	if len(config.AllowedOrigins) == 0 {
-		return ErrCORSNoOrigins
-	}
-
-	// Check for conflicting configuration
-	hasWildcard := false
-	for _, origin := range config.AllowedOrigins {
-		if origin == "*" {
-			hasWildcard = true
-			break
-		}
-	}
-
-	if hasWildcard && config.AllowCredentials {
-		return ErrCORSWildcardWithCredentials
-	}
-
-	// Validate methods
 	if len(config.AllowedMethods) == 0 {
 		return ErrCORSNoMethods
 	}
 
-	for _, method := range config.AllowedMethods {
-		if !isValidHTTPMethod(method) {
-			return ErrCORSInvalidMethod
-		}
-	}
-
-	// Validate max age
-	if config.MaxAge < 0 {
-		return ErrCORSInvalidMaxAge
-	}
-
-	return nil
-}
-
-// isValidHTTPMethod checks if the method is a valid HTTP method.
-func isValidHTTPMethod(method string) bool {
-	validMethods := []string{
-		http.MethodGet,
-		http.MethodHead,
-		http.MethodPost,
-		http.MethodPut,
-		http.MethodPatch,
-		http.MethodDelete,
-		http.MethodConnect,
-		http.MethodOptions,
-		http.MethodTrace,
-	}
-
-	for _, validMethod := range validMethods {
-		if method == validMethod {
-			return true
-		}
-	}
-
-	return false
+	return headers.ValidateCORSPolicy(headers.CORSPolicy{
+		AllowedOrigins:        config.AllowedOrigins,
+		AllowedOriginPatterns: config.AllowedOriginPatterns,
+		AllowedMethods:        config.AllowedMethods,
+		AllowedHeaders:        config.AllowedHeaders,
+		ExposedHeaders:        config.ExposedHeaders,
+		AllowCredentials:      config.AllowCredentials,
+		MaxAge:                config.MaxAge,
+	})
 }
 
 // CORS error definitions.
 var (
-	ErrCORSNoOrigins               = fmt.Errorf("no allowed origins configured")
-	ErrCORSWildcardWithCredentials = fmt.Errorf("wildcard origin cannot be used with credentials")
+	ErrCORSNoOrigins               = headers.ErrCORSNoOrigins
+	ErrCORSWildcardWithCredentials = headers.ErrCORSWildcardWithCredentials
 	ErrCORSNoMethods               = fmt.Errorf("no allowed methods configured")
-	ErrCORSInvalidMethod           = fmt.Errorf("invalid HTTP method")
-	ErrCORSInvalidMaxAge           = fmt.Errorf("invalid max age: must be non-negative")
+	ErrCORSInvalidMethod           = headers.ErrCORSInvalidMethod
+	ErrCORSInvalidMaxAge           = headers.ErrCORSInvalidMaxAge
+
+	ErrCORSInvalidOriginPattern           = headers.ErrCORSInvalidOriginPattern
+	ErrCORSWildcardHeadersWithCredentials = headers.ErrCORSWildcardHeadersWithCredentials
 )
@@ -8,7 +8,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
 	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
 )
 
@@ -556,6 +558,7 @@ func TestCORSMiddleware_OriginMatching(t *testing.T) {
 	tests := []struct {
 		name           string
 		allowedOrigins []string
+		originPatterns []string
 		testOrigin     string
 		shouldAllow    bool
 	}{
@@ -589,6 +592,30 @@ func TestCORSMiddleware_OriginMatching(t *testing.T) {
 			testOrigin:     "https://sub.example.com",
 			shouldAllow:    false,
 		},
+		{
+			name:           "OriginMatching_SchemeWildcardSubdomain",
+			allowedOrigins: []string{"https://*.example.com"},
+			testOrigin:     "https://app.example.com",
+			shouldAllow:    true,
+		},
+		{
+			name:           "OriginMatching_SchemeWildcardWrongScheme",
+			allowedOrigins: []string{"https://*.example.com"},
+			testOrigin:     "http://app.example.com",
+			shouldAllow:    false,
+		},
+		{
+			name:           "OriginMatching_PatternMatch",
+			originPatterns: []string{`https://pr-[0-9]+\.preview\.example\.com`},
+			testOrigin:     "https://pr-42.preview.example.com",
+			shouldAllow:    true,
+		},
+		{
+			name:           "OriginMatching_PatternIsAnchored",
+			originPatterns: []string{`https://pr-[0-9]+\.preview\.example\.com`},
+			testOrigin:     "https://pr-42.preview.example.com.evil.test",
+			shouldAllow:    false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -618,9 +645,10 @@ func TestCORSMiddleware_OriginMatching(t *testing.T) {
 			}
 
 			config := CORSConfig{
-				AllowedOrigins: tt.allowedOrigins,
-				AllowedMethods: []string{http.MethodGet},
-				AllowedHeaders: []string{"Content-Type"},
+				AllowedOrigins:        tt.allowedOrigins,
+				AllowedOriginPatterns: tt.originPatterns,
+				AllowedMethods:        []string{http.MethodGet},
+				AllowedHeaders:        []string{"Content-Type"},
 			}
 
 			middleware := NewCORSMiddlewareWithConfig(config, logger, metrics)
@@ -646,7 +674,8 @@ func TestCORSMiddleware_OriginMatching(t *testing.T) {
 				assert.Equal(t, "success", rec.Body.String())
 			} else {
 				assert.Equal(t, http.StatusForbidden, rec.Code)
-				assert.Empty(t, rec.Body.String())
+				assert.Equal(t, proxyerrors.ProblemContentType, rec.Header().Get("Content-Type"))
+				assert.Contains(t, rec.Body.String(), `"code":"invalid_origin"`)
 			}
 
 			logger.AssertExpectations(t)
@@ -654,6 +683,105 @@ func TestCORSMiddleware_OriginMatching(t *testing.T) {
 	}
 }
 
+func TestNewCORSPolicyMiddleware_Credentials_EchoesOrigin(t *testing.T) {
+	// Arrange
+	config := DefaultCORSConfig()
+	config.AllowedOrigins = []string{"https://*.example.com"}
+	config.AllowCredentials = true
+	config.ExposedHeaders = []string{"X-Request-ID"}
+	mw, err := NewCORSPolicyMiddleware(config, nil, nil)
+	require.NoError(t, err)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	rec := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rec, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Equal(t, "X-Request-ID", rec.Header().Get("Access-Control-Expose-Headers"))
+}
+
+func TestCORSValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*CORSConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*CORSConfig) {},
+		},
+		{
+			name: "Validate_PatternsOnly_Valid",
+			mutate: func(c *CORSConfig) {
+				c.AllowedOrigins = nil
+				c.AllowedOriginPatterns = []string{`https://.+\.example\.com`}
+			},
+		},
+		{
+			name: "Validate_NoOrigins_ReturnsError",
+			mutate: func(c *CORSConfig) {
+				c.AllowedOrigins = nil
+			},
+			expectedErr: ErrCORSNoOrigins,
+		},
+		{
+			name:        "Validate_InvalidPattern_ReturnsError",
+			mutate:      func(c *CORSConfig) { c.AllowedOriginPatterns = []string{"https://(unclosed"} },
+			expectedErr: ErrCORSInvalidOriginPattern,
+		},
+		{
+			name:        "Validate_WildcardWithCredentials_ReturnsError",
+			mutate:      func(c *CORSConfig) { c.AllowCredentials = true },
+			expectedErr: ErrCORSWildcardWithCredentials,
+		},
+		{
+			name: "Validate_WildcardHeadersWithCredentials_ReturnsError",
+			mutate: func(c *CORSConfig) {
+				c.AllowedOrigins = []string{"https://app.example.com"}
+				c.ExposedHeaders = []string{"*"}
+				c.AllowCredentials = true
+			},
+			expectedErr: ErrCORSWildcardHeadersWithCredentials,
+		},
+		{
+			name:        "Validate_InvalidMethod_ReturnsError",
+			mutate:      func(c *CORSConfig) { c.AllowedMethods = []string{"FETCH"} },
+			expectedErr: ErrCORSInvalidMethod,
+		},
+		{
+			name:        "Validate_NoMethods_ReturnsError",
+			mutate:      func(c *CORSConfig) { c.AllowedMethods = nil },
+			expectedErr: ErrCORSNoMethods,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultCORSConfig()
+			tt.mutate(&config)
+
+			// Act
+			err := NewCORSValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
 func TestCORSMiddleware_Integration(t *testing.T) {
 	tests := []struct {
 		name string
@@ -0,0 +1,505 @@
+// Package middleware implements hashed credential stores shared by authentication middleware.
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/albedosehen/rwwwrse/internal/cache"
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// Bounds on argon2 parameters accepted from credential files, so a single
+// entry cannot make every verification exhaust memory or CPU.
+const (
+	maxArgon2Memory      = 256 * 1024 // KiB
+	maxArgon2Iterations  = 16
+	maxArgon2Parallelism = 16
+	maxArgon2KeyLength   = 64
+)
+
+// credentialEntry is a single name/hash pair from a credential file.
+type credentialEntry struct {
+	name string
+	hash string
+}
+
+// credentialStore holds the entries of a "name:hash" credential file and
+// reloads them whenever the file changes on disk.
+type credentialStore struct {
+	path       string
+	digestOnly bool
+	logger     observability.Logger
+	mu         sync.RWMutex
+	entries    []credentialEntry
+	digests    map[[sha256.Size]byte]string
+	watcher    *fsnotify.Watcher
+	done       chan struct{}
+
+	// resolved is the file the path pointed to at the last reload. It is
+	// only touched by the constructor and the watch loop.
+	resolved string
+}
+
+// newCredentialStore loads the credential file and starts watching it for
+// changes. A digestOnly store accepts only sha256 entries, so secrets can be
+// matched with a single digest lookup. Other stores hold passwords and reject
+// sha256 entries, since an unsalted digest is unsuitable for them.
+func newCredentialStore(path string, digestOnly bool, logger observability.Logger) (*credentialStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("credential file path is required")
+	}
+
+	store := &credentialStore{
+		path:       path,
+		digestOnly: digestOnly,
+		logger:     logger,
+	}
+
+	if err := store.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch credential file: %w", err)
+	}
+
+	// Watch the directory so atomic replacements via rename are seen.
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		_ = watcher.Close()
+		return nil, fmt.Errorf("failed to watch credential file: %w", err)
+	}
+
+	store.watcher = watcher
+	store.done = make(chan struct{})
+	go store.watchLoop()
+
+	return store, nil
+}
+
+// reload reads and parses the credential file, replacing the current entries.
+func (s *credentialStore) reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read credential file %s: %w", s.path, err)
+	}
+
+	entries, err := parseCredentialFile(data)
+	if err != nil {
+		return fmt.Errorf("invalid credential file %s: %w", s.path, err)
+	}
+
+	digests := make(map[[sha256.Size]byte]string)
+	for _, entry := range entries {
+		digest, ok := sha256CredentialDigest(entry.hash)
+		if !s.digestOnly {
+			if strings.HasPrefix(entry.hash, "sha256:") {
+				return fmt.Errorf("invalid credential file %s: %q uses an unsalted sha256 hash, which is only supported for API keys; use bcrypt or argon2", s.path, entry.name)
+			}
+			continue
+		}
+		if !ok {
+			return fmt.Errorf("invalid credential file %s: %q must use a sha256 hash", s.path, entry.name)
+		}
+		if _, exists := digests[digest]; !exists {
+			digests[digest] = entry.name
+		}
+	}
+
+	s.mu.Lock()
+	s.entries = entries
+	s.digests = digests
+	s.mu.Unlock()
+
+	s.resolved = resolveCredentialPath(s.path)
+
+	return nil
+}
+
+// resolveCredentialPath returns the file path points to after following
+// symlinks, or path itself when it cannot be resolved.
+func resolveCredentialPath(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return resolved
+}
+
+// watchLoop reloads the store when the credential file changes. It returns
+// once the watcher is closed.
+func (s *credentialStore) watchLoop() {
+	defer close(s.done)
+
+	for {
+		select {
+		case event, ok := <-s.watcher.Events:
+			if !ok {
+				return
+			}
+			if !s.changed(event) {
+				continue
+			}
+
+			if err := s.reload(); err != nil {
+				if s.logger != nil {
+					s.logger.Warn(context.Background(), "Keeping previous credentials after failed reload",
+						observability.String("path", s.path),
+						observability.Error(err),
+					)
+				}
+				continue
+			}
+
+			if s.logger != nil {
+				s.logger.Info(context.Background(), "Credential file reloaded",
+					observability.String("path", s.path),
+					observability.Int("entries", s.size()),
+				)
+			}
+		case err, ok := <-s.watcher.Errors:
+			if !ok {
+				return
+			}
+			if s.logger != nil {
+				s.logger.Warn(context.Background(), "Credential file watcher error",
+					observability.String("path", s.path),
+					observability.Error(err),
+				)
+			}
+		}
+	}
+}
+
+// changed reports whether event affects the credential file. Besides writes
+// to the file itself, a swap of a symlink the path resolves through counts,
+// such as the ..data link Kubernetes replaces when a mounted secret changes.
+func (s *credentialStore) changed(event fsnotify.Event) bool {
+	if filepath.Clean(event.Name) == filepath.Clean(s.path) {
+		return event.Has(fsnotify.Write | fsnotify.Create | fsnotify.Rename)
+	}
+	if !event.Has(fsnotify.Create | fsnotify.Rename | fsnotify.Remove) {
+		return false
+	}
+	return resolveCredentialPath(s.path) != s.resolved
+}
+
+// lookup returns the hash stored for name.
+func (s *credentialStore) lookup(name string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, entry := range s.entries {
+		if entry.name == name {
+			return entry.hash, true
+		}
+	}
+	return "", false
+}
+
+// matchDigest returns the name of the sha256 entry matching secret. It costs
+// one digest regardless of the number of entries.
+func (s *credentialStore) matchDigest(secret string) (string, bool) {
+	digest := sha256.Sum256([]byte(secret))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name, ok := s.digests[digest]
+	return name, ok
+}
+
+// size returns the number of loaded entries.
+func (s *credentialStore) size() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.entries)
+}
+
+// Close stops watching the credential file and waits for the watch loop to
+// exit.
+func (s *credentialStore) Close() error {
+	if s.watcher == nil {
+		return nil
+	}
+	err := s.watcher.Close()
+	<-s.done
+	return err
+}
+
+// parseCredentialFile parses "name:hash" lines, skipping blanks and # comments.
+func parseCredentialFile(data []byte) ([]credentialEntry, error) {
+	var entries []credentialEntry
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		name, hash, found := strings.Cut(text, ":")
+		if !found || name == "" || hash == "" {
+			return nil, fmt.Errorf("line %d: expected name:hash", line)
+		}
+
+		if strings.HasPrefix(hash, "$apr1$") {
+			return nil, fmt.Errorf("line %d: %q uses an apr1 (MD5) hash, which is not supported; regenerate it with htpasswd -B for bcrypt", line, name)
+		}
+		if strings.HasPrefix(hash, "$argon2") {
+			if _, err := parseArgon2Hash(hash); err != nil {
+				return nil, fmt.Errorf("line %d: invalid argon2 hash for %q: %w", line, name, err)
+			}
+		}
+		if !isSupportedCredentialHash(hash) {
+			return nil, fmt.Errorf("line %d: unsupported hash format for %q", line, name)
+		}
+
+		entries = append(entries, credentialEntry{name: name, hash: hash})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// isSupportedCredentialHash reports whether hash uses a supported scheme.
+// Plaintext and legacy crypt schemes, including htpasswd's default apr1,
+// are deliberately rejected.
+func isSupportedCredentialHash(hash string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return true
+	case strings.HasPrefix(hash, "$argon2id$"), strings.HasPrefix(hash, "$argon2i$"):
+		return true
+	case strings.HasPrefix(hash, "sha256:"):
+		_, err := hex.DecodeString(strings.TrimPrefix(hash, "sha256:"))
+		return err == nil
+	default:
+		return false
+	}
+}
+
+// sha256CredentialDigest returns the digest of a sha256:<hex> hash.
+func sha256CredentialDigest(hash string) ([sha256.Size]byte, bool) {
+	var digest [sha256.Size]byte
+
+	encoded, found := strings.CutPrefix(hash, "sha256:")
+	if !found {
+		return digest, false
+	}
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil || len(decoded) != sha256.Size {
+		return digest, false
+	}
+
+	copy(digest[:], decoded)
+	return digest, true
+}
+
+// verifyCredentialHash checks a password against a bcrypt or argon2 hash.
+// Unsalted sha256 digests are only matched through the digest lookup.
+func verifyCredentialHash(hash, secret string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil
+	case strings.HasPrefix(hash, "$argon2"):
+		return verifyArgon2Hash(hash, secret)
+	default:
+		return false
+	}
+}
+
+// argon2Hash is a parsed PHC-formatted argon2 hash.
+type argon2Hash struct {
+	variant     string
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+// parseArgon2Hash parses a PHC-formatted argon2 hash such as
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>, rejecting parameters
+// outside the supported bounds.
+func parseArgon2Hash(hash string) (argon2Hash, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || (parts[1] != "argon2id" && parts[1] != "argon2i") || parts[2] != "v=19" {
+		return argon2Hash{}, fmt.Errorf("expected $argon2id$v=19$m=...,t=...,p=...$<salt>$<hash>")
+	}
+
+	var memory, iterations, parallelism uint64
+	for _, param := range strings.Split(parts[3], ",") {
+		key, value, _ := strings.Cut(param, "=")
+		n, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return argon2Hash{}, fmt.Errorf("invalid parameter %q", param)
+		}
+		switch key {
+		case "m":
+			memory = n
+		case "t":
+			iterations = n
+		case "p":
+			parallelism = n
+		}
+	}
+	if memory == 0 || memory > maxArgon2Memory {
+		return argon2Hash{}, fmt.Errorf("memory must be between 1 and %d KiB", maxArgon2Memory)
+	}
+	if iterations == 0 || iterations > maxArgon2Iterations {
+		return argon2Hash{}, fmt.Errorf("iterations must be between 1 and %d", maxArgon2Iterations)
+	}
+	if parallelism == 0 || parallelism > maxArgon2Parallelism {
+		return argon2Hash{}, fmt.Errorf("parallelism must be between 1 and %d", maxArgon2Parallelism)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2Hash{}, fmt.Errorf("invalid salt encoding")
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return argon2Hash{}, fmt.Errorf("invalid hash encoding")
+	}
+	if len(key) == 0 || len(key) > maxArgon2KeyLength {
+		return argon2Hash{}, fmt.Errorf("hash length must be between 1 and %d bytes", maxArgon2KeyLength)
+	}
+
+	return argon2Hash{
+		variant:     parts[1],
+		memory:      uint32(memory),
+		iterations:  uint32(iterations),
+		parallelism: uint8(parallelism),
+		salt:        salt,
+		key:         key,
+	}, nil
+}
+
+// verifyArgon2Hash checks secret against a PHC-formatted argon2 hash.
+func verifyArgon2Hash(hash, secret string) bool {
+	parsed, err := parseArgon2Hash(hash)
+	if err != nil {
+		return false
+	}
+
+	keyLength := uint32(len(parsed.key))
+	var computed []byte
+	if parsed.variant == "argon2id" {
+		computed = argon2.IDKey([]byte(secret), parsed.salt, parsed.iterations, parsed.memory, parsed.parallelism, keyLength)
+	} else {
+		computed = argon2.Key([]byte(secret), parsed.salt, parsed.iterations, parsed.memory, parsed.parallelism, keyLength)
+	}
+
+	return subtle.ConstantTimeCompare(computed, parsed.key) == 1
+}
+
+// authFailureTracker records failed authentication attempts per client in a
+// RateLimiter so that repeated failures temporarily block the client.
+type authFailureTracker struct {
+	limiter  *tokenBucketRateLimiter
+	prefix   string
+	stopOnce sync.Once
+}
+
+// newAuthFailureTracker creates a tracker allowing maxFailures failures, one of
+// which is forgiven every interval.
+func newAuthFailureTracker(prefix string, maxFailures int, interval time.Duration, logger observability.Logger) *authFailureTracker {
+	if maxFailures <= 0 {
+		maxFailures = 10
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	return &authFailureTracker{
+		limiter: newTokenBucketRateLimiter(1/interval.Seconds(), maxFailures, logger),
+		prefix:  prefix,
+	}
+}
+
+// blocked reports whether the client has exhausted its failure budget.
+// Clients without failures are not tracked, so checking them allocates
+// nothing.
+func (t *authFailureTracker) blocked(r *http.Request) (time.Duration, bool) {
+	stats, ok := t.limiter.peekStats(t.key(r))
+	if !ok {
+		return 0, false
+	}
+	return stats.RetryAfter, stats.Remaining <= 0
+}
+
+// record counts a failed attempt for the client.
+func (t *authFailureTracker) record(r *http.Request) {
+	t.limiter.Allow(r.Context(), t.key(r))
+}
+
+// stop stops the limiter cleanup goroutine.
+func (t *authFailureTracker) stop() {
+	t.stopOnce.Do(t.limiter.Stop)
+}
+
+// key returns the limiter key for the requesting client.
+func (t *authFailureTracker) key(r *http.Request) string {
+	return t.prefix + ":" + getClientIP(r)
+}
+
+// markAuthenticated marks r as authenticated, so the response cache does not
+// store a personalized response as shared once the credentials are removed.
+func markAuthenticated(r *http.Request) *http.Request {
+	return r.WithContext(cache.WithAuthenticated(r.Context()))
+}
+
+// writeAuthChallenge responds with 401 and an authentication challenge.
+func writeAuthChallenge(w http.ResponseWriter, r *http.Request, challenge string) {
+	w.Header().Set("WWW-Authenticate", challenge)
+	writeErrorResponse(w, r, proxyerrors.NewSecurityError(
+		proxyerrors.ErrCodeUnauthorized,
+		"authentication required",
+		nil,
+	))
+}
+
+// writeAuthBlocked responds with 429 when a client has too many failed attempts.
+func writeAuthBlocked(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int(retryAfter.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeErrorResponse(w, r, proxyerrors.NewSecurityError(
+		proxyerrors.ErrCodeRateLimited,
+		"too many failed authentication attempts",
+		nil,
+	))
+}
+
+// quoteRealm quotes a realm for use in a WWW-Authenticate challenge.
+func quoteRealm(realm string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(realm)
+	return `"` + escaped + `"`
+}
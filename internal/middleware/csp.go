@@ -0,0 +1,622 @@
+// Package middleware implements per-route Content-Security-Policy with nonces
+// and collection of violation reports.
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// Content-Security-Policy header names.
+const (
+	HeaderContentSecurityPolicy           = "Content-Security-Policy"
+	HeaderContentSecurityPolicyReportOnly = "Content-Security-Policy-Report-Only"
+	HeaderReportingEndpoints              = "Reporting-Endpoints"
+)
+
+// cspReportGroup is the Reporting API endpoint name used in report-to.
+const cspReportGroup = "csp-endpoint"
+
+// cspNonceBytes is the number of random bytes in a nonce.
+const cspNonceBytes = 16
+
+// cspDedupeMaxEntries bounds the number of distinct reports remembered.
+const cspDedupeMaxEntries = 10000
+
+// Metric labels for reports from unconfigured hosts and unknown directives.
+const (
+	cspUnknownRoute   = "unknown"
+	cspOtherDirective = "other"
+)
+
+// cspDirectives are the directives reported under their own metric label.
+var cspDirectives = map[string]bool{
+	"default-src":               true,
+	"child-src":                 true,
+	"connect-src":               true,
+	"font-src":                  true,
+	"frame-src":                 true,
+	"img-src":                   true,
+	"manifest-src":              true,
+	"media-src":                 true,
+	"object-src":                true,
+	"prefetch-src":              true,
+	"script-src":                true,
+	"script-src-elem":           true,
+	"script-src-attr":           true,
+	"style-src":                 true,
+	"style-src-elem":            true,
+	"style-src-attr":            true,
+	"worker-src":                true,
+	"base-uri":                  true,
+	"sandbox":                   true,
+	"form-action":               true,
+	"frame-ancestors":           true,
+	"navigate-to":               true,
+	"require-trusted-types-for": true,
+	"trusted-types":             true,
+}
+
+// CSPConfig holds configuration for the per-route Content-Security-Policy middleware.
+type CSPConfig struct {
+	// Name identifies the route in logs.
+	Name string
+
+	// Policy is the policy sent to clients.
+	Policy string
+
+	// ReportOnly sends the policy as Content-Security-Policy-Report-Only.
+	ReportOnly bool
+
+	// Nonce replaces NoncePlaceholder in the policy and in HTML bodies with
+	// a fresh nonce for every request.
+	Nonce bool
+
+	// NoncePlaceholder is the text replaced by the nonce.
+	NoncePlaceholder string
+
+	// ReportPath adds report-uri and report-to directives pointing at the
+	// violation report endpoint. Empty disables reporting.
+	ReportPath string
+}
+
+// DefaultCSPConfig returns a CSP configuration with a same-origin policy.
+func DefaultCSPConfig() CSPConfig {
+	return CSPConfig{
+		Policy:           "default-src 'self'",
+		NoncePlaceholder: "__CSP_NONCE__",
+	}
+}
+
+// cspMiddleware sets a route's Content-Security-Policy.
+type cspMiddleware struct {
+	config  CSPConfig
+	header  string
+	policy  string
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+}
+
+// NewCSPMiddleware creates a new per-route Content-Security-Policy middleware.
+func NewCSPMiddleware(
+	config CSPConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewCSPValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	header := HeaderContentSecurityPolicy
+	if config.ReportOnly {
+		header = HeaderContentSecurityPolicyReportOnly
+	}
+
+	policy := strings.TrimRight(strings.TrimSpace(config.Policy), ";")
+	if config.ReportPath != "" {
+		policy += "; report-uri " + config.ReportPath + "; report-to " + cspReportGroup
+	}
+
+	return &cspMiddleware{
+		config:  config,
+		header:  header,
+		policy:  policy,
+		logger:  logger,
+		metrics: metrics,
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *cspMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := m.policy
+		nonce := ""
+		if m.config.Nonce {
+			nonce = newCSPNonce()
+			policy = strings.ReplaceAll(policy, m.config.NoncePlaceholder, nonce)
+		}
+
+		// The route policy replaces the global one, whichever mode it used.
+		headers := w.Header()
+		headers.Del(HeaderContentSecurityPolicy)
+		headers.Del(HeaderContentSecurityPolicyReportOnly)
+		headers.Set(m.header, policy)
+		if m.config.ReportPath != "" {
+			headers.Set(HeaderReportingEndpoints, cspReportGroup+`="`+m.config.ReportPath+`"`)
+		}
+
+		if !m.config.Nonce {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Only uncompressed bodies can be rewritten, so the backend must not
+		// encode them; compression further out encodes the rewritten body.
+		r = r.WithContext(r.Context())
+		r.Header = r.Header.Clone()
+		r.Header.Set("Accept-Encoding", "identity")
+
+		nw := &cspNonceWriter{
+			ResponseWriter: w,
+			placeholder:    []byte(m.config.NoncePlaceholder),
+			nonce:          []byte(nonce),
+		}
+		next.ServeHTTP(nw, r)
+		nw.finish()
+	})
+}
+
+// newCSPNonce returns a base64 encoded random nonce.
+func newCSPNonce() string {
+	b := make([]byte, cspNonceBytes)
+	if _, err := rand.Read(b); err != nil {
+		return base64.StdEncoding.EncodeToString([]byte(generateRequestID()))
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// cspNonceWriter substitutes the nonce placeholder in uncompressed HTML
+// bodies. A trailing partial placeholder is held back until the next write.
+type cspNonceWriter struct {
+	http.ResponseWriter
+	placeholder []byte
+	nonce       []byte
+	rewrite     bool
+	wroteHeader bool
+	pending     []byte
+}
+
+// WriteHeader decides whether the body is rewritten.
+func (w *cspNonceWriter) WriteHeader(statusCode int) {
+	if statusCode >= 100 && statusCode < 200 && statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if isUncompressedHTML(w.Header()) {
+		w.rewrite = true
+		w.Header().Del("Content-Length")
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write substitutes placeholders in the body.
+func (w *cspNonceWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if !w.rewrite {
+		return w.ResponseWriter.Write(data)
+	}
+
+	buf := append(w.pending, data...)
+
+	// Hold back the longest suffix that may start a placeholder, ignoring
+	// bytes that belong to a complete placeholder.
+	searchFrom := 0
+	if last := bytes.LastIndex(buf, w.placeholder); last >= 0 {
+		searchFrom = last + len(w.placeholder)
+	}
+	keep := len(w.placeholder) - 1
+	if rest := len(buf) - searchFrom; rest < keep {
+		keep = rest
+	}
+	for ; keep > 0; keep-- {
+		if bytes.HasPrefix(w.placeholder, buf[len(buf)-keep:]) {
+			break
+		}
+	}
+
+	out := bytes.ReplaceAll(buf[:len(buf)-keep], w.placeholder, w.nonce)
+	w.pending = append([]byte(nil), buf[len(buf)-keep:]...)
+
+	if _, err := w.ResponseWriter.Write(out); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Flush writes held back bytes and flushes them, so a placeholder split
+// across a flush is not substituted.
+func (w *cspNonceWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.finish()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *cspNonceWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes any held back bytes.
+func (w *cspNonceWriter) finish() {
+	if len(w.pending) > 0 {
+		_, _ = w.ResponseWriter.Write(w.pending)
+		w.pending = nil
+	}
+}
+
+// isUncompressedHTML reports whether the response is an HTML document
+// without a content coding.
+func isUncompressedHTML(headers http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(headers.Get("Content-Type"))
+	if err != nil || mediaType != "text/html" {
+		return false
+	}
+	encoding := headers.Get("Content-Encoding")
+	return encoding == "" || strings.EqualFold(encoding, "identity")
+}
+
+// CSPReportConfig holds configuration for the violation report endpoint.
+type CSPReportConfig struct {
+	// Path is where browsers send reports.
+	Path string
+
+	// DedupeWindow suppresses logging of identical reports within the window.
+	DedupeWindow time.Duration
+
+	// MaxBodySize limits the size of a report request.
+	MaxBodySize int64
+
+	// Routes are the configured route hosts. Reports for other hosts are
+	// counted under the "unknown" route.
+	Routes []string
+}
+
+// DefaultCSPReportConfig returns the default violation report endpoint configuration.
+func DefaultCSPReportConfig() CSPReportConfig {
+	return CSPReportConfig{
+		Path:         "/_rwwwrse/csp-report",
+		DedupeWindow: 10 * time.Minute,
+		MaxBodySize:  64 * 1024,
+	}
+}
+
+// cspViolation is a violation normalized from either report format.
+type cspViolation struct {
+	DocumentURI string
+	Directive   string
+	BlockedURI  string
+	Disposition string
+	SourceFile  string
+	Line        int
+}
+
+// cspLegacyReport is the report-uri format (application/csp-report).
+type cspLegacyReport struct {
+	Report struct {
+		DocumentURI        string `json:"document-uri"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effective-directive"`
+		BlockedURI         string `json:"blocked-uri"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+	} `json:"csp-report"`
+}
+
+// cspReportingAPIReport is a Reporting API report (application/reports+json).
+type cspReportingAPIReport struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	Body struct {
+		DocumentURL        string `json:"documentURL"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		BlockedURL         string `json:"blockedURL"`
+		Disposition        string `json:"disposition"`
+		SourceFile         string `json:"sourceFile"`
+		LineNumber         int    `json:"lineNumber"`
+	} `json:"body"`
+}
+
+// cspReportMiddleware serves the violation report endpoint.
+type cspReportMiddleware struct {
+	config  CSPReportConfig
+	routes  map[string]bool
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+	now  func() time.Time
+}
+
+// NewCSPReportMiddleware creates a new violation report collection middleware.
+func NewCSPReportMiddleware(
+	config CSPReportConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewCSPValidator()
+	if err := validator.ValidateReports(config); err != nil {
+		return nil, err
+	}
+
+	routes := make(map[string]bool, len(config.Routes))
+	for _, host := range config.Routes {
+		routes[normalizeRouteHost(host)] = true
+	}
+
+	return &cspReportMiddleware{
+		config:  config,
+		routes:  routes,
+		logger:  logger,
+		metrics: metrics,
+		seen:    make(map[string]time.Time),
+		now:     time.Now,
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *cspReportMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != m.config.Path {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, "Method not allowed", nil).
+				WithHTTPStatus(http.StatusMethodNotAllowed))
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, m.config.MaxBodySize+1))
+		if err != nil {
+			writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, "Invalid report body", err))
+			return
+		}
+		if int64(len(body)) > m.config.MaxBodySize {
+			writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestTooLarge, "Report body too large", nil))
+			return
+		}
+
+		violations, err := parseCSPReports(body)
+		if err != nil {
+			writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, "Invalid report body", err))
+			return
+		}
+
+		host := normalizeRouteHost(r.Host)
+		for _, violation := range violations {
+			m.record(r, host, violation)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// record counts a violation and logs it unless an identical report was
+// logged within the dedupe window.
+func (m *cspReportMiddleware) record(r *http.Request, host string, violation cspViolation) {
+	if m.metrics != nil {
+		m.metrics.RecordCSPViolation(m.routeLabel(host), cspDirectiveLabel(violation.Directive))
+	}
+
+	key := strings.Join([]string{
+		host,
+		violation.DocumentURI,
+		violation.Directive,
+		violation.BlockedURI,
+		violation.SourceFile,
+		strconv.Itoa(violation.Line),
+	}, "\x00")
+
+	if !m.firstSeen(key) || m.logger == nil {
+		return
+	}
+
+	m.logger.Warn(r.Context(), "CSP violation reported",
+		observability.String("request_id", GetRequestID(r.Context())),
+		observability.String("route", sanitizeString(host)),
+		observability.String("document_uri", sanitizeString(violation.DocumentURI)),
+		observability.String("directive", sanitizeString(violation.Directive)),
+		observability.String("blocked_uri", sanitizeString(violation.BlockedURI)),
+		observability.String("disposition", sanitizeString(violation.Disposition)),
+		observability.String("source_file", sanitizeString(violation.SourceFile)),
+		observability.Int("line", violation.Line),
+	)
+}
+
+// routeLabel returns the metric label for a report host. The host comes from
+// the request, so only configured routes get a label of their own.
+func (m *cspReportMiddleware) routeLabel(host string) string {
+	if m.routes[host] {
+		return host
+	}
+	return cspUnknownRoute
+}
+
+// cspDirectiveLabel returns the metric label for a reported directive.
+func cspDirectiveLabel(directive string) string {
+	directive = strings.ToLower(directive)
+	if cspDirectives[directive] {
+		return directive
+	}
+	return cspOtherDirective
+}
+
+// firstSeen reports whether key was not seen within the dedupe window.
+func (m *cspReportMiddleware) firstSeen(key string) bool {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if last, ok := m.seen[key]; ok && now.Sub(last) < m.config.DedupeWindow {
+		return false
+	}
+
+	if len(m.seen) >= cspDedupeMaxEntries {
+		for k, last := range m.seen {
+			if now.Sub(last) >= m.config.DedupeWindow {
+				delete(m.seen, k)
+			}
+		}
+		if len(m.seen) >= cspDedupeMaxEntries {
+			// Under a flood of distinct reports keep logging without remembering.
+			return true
+		}
+	}
+
+	m.seen[key] = now
+	return true
+}
+
+// parseCSPReports decodes a legacy report or a batch of Reporting API reports.
+func parseCSPReports(body []byte) ([]cspViolation, error) {
+	trimmed := bytes.TrimSpace(body)
+
+	if bytes.HasPrefix(trimmed, []byte("[")) {
+		var reports []cspReportingAPIReport
+		if err := json.Unmarshal(trimmed, &reports); err != nil {
+			return nil, err
+		}
+
+		violations := make([]cspViolation, 0, len(reports))
+		for _, report := range reports {
+			if report.Type != "csp-violation" {
+				continue
+			}
+			documentURI := report.Body.DocumentURL
+			if documentURI == "" {
+				documentURI = report.URL
+			}
+			violations = append(violations, cspViolation{
+				DocumentURI: stripCSPQuery(documentURI),
+				Directive:   report.Body.EffectiveDirective,
+				BlockedURI:  stripCSPQuery(report.Body.BlockedURL),
+				Disposition: report.Body.Disposition,
+				SourceFile:  stripCSPQuery(report.Body.SourceFile),
+				Line:        report.Body.LineNumber,
+			})
+		}
+		return violations, nil
+	}
+
+	var report cspLegacyReport
+	if err := json.Unmarshal(trimmed, &report); err != nil {
+		return nil, err
+	}
+	if report.Report.DocumentURI == "" {
+		return nil, fmt.Errorf("missing csp-report")
+	}
+
+	directive := report.Report.EffectiveDirective
+	if directive == "" {
+		directive, _, _ = strings.Cut(report.Report.ViolatedDirective, " ")
+	}
+
+	return []cspViolation{{
+		DocumentURI: stripCSPQuery(report.Report.DocumentURI),
+		Directive:   directive,
+		BlockedURI:  stripCSPQuery(report.Report.BlockedURI),
+		Disposition: report.Report.Disposition,
+		SourceFile:  stripCSPQuery(report.Report.SourceFile),
+		Line:        report.Report.LineNumber,
+	}}, nil
+}
+
+// stripCSPQuery removes the query and fragment of reported URLs, which may
+// carry user data and would defeat deduplication.
+func stripCSPQuery(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme == "" {
+		return raw
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+// CSPValidator validates Content-Security-Policy configuration.
+type CSPValidator struct{}
+
+// NewCSPValidator creates a new CSP validator.
+func NewCSPValidator() *CSPValidator {
+	return &CSPValidator{}
+}
+
+// Validate validates the per-route policy configuration.
+func (v *CSPValidator) Validate(config CSPConfig) error {
+	if strings.TrimSpace(config.Policy) == "" {
+		return ErrCSPPolicyRequired
+	}
+
+	if config.Nonce && (config.NoncePlaceholder == "" || !strings.Contains(config.Policy, config.NoncePlaceholder)) {
+		return ErrCSPNoncePlaceholder
+	}
+
+	if config.ReportPath != "" && !strings.HasPrefix(config.ReportPath, "/") {
+		return fmt.Errorf("%w: %q", ErrInvalidCSPReportPath, config.ReportPath)
+	}
+
+	return nil
+}
+
+// ValidateReports validates the violation report endpoint configuration.
+func (v *CSPValidator) ValidateReports(config CSPReportConfig) error {
+	if !strings.HasPrefix(config.Path, "/") {
+		return fmt.Errorf("%w: %q", ErrInvalidCSPReportPath, config.Path)
+	}
+
+	if config.MaxBodySize <= 0 {
+		return ErrInvalidCSPReportBodySize
+	}
+
+	return nil
+}
+
+// CSP validation errors.
+var (
+	ErrCSPPolicyRequired        = fmt.Errorf("CSP policy is required")
+	ErrCSPNoncePlaceholder      = fmt.Errorf("CSP policy must contain the nonce placeholder")
+	ErrInvalidCSPReportPath     = fmt.Errorf("CSP report path must start with /")
+	ErrInvalidCSPReportBodySize = fmt.Errorf("CSP report max body size must be positive")
+)
@@ -0,0 +1,475 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+func TestCSPMiddleware_Headers(t *testing.T) {
+	tests := []struct {
+		name             string
+		config           CSPConfig
+		expectedHeader   string
+		unexpectedHeader string
+		expectedPolicy   string
+	}{
+		{
+			name:             "Headers_Enforced_ReplacesGlobalPolicy",
+			config:           CSPConfig{Policy: "default-src 'none'; img-src 'self';"},
+			expectedHeader:   HeaderContentSecurityPolicy,
+			unexpectedHeader: HeaderContentSecurityPolicyReportOnly,
+			expectedPolicy:   "default-src 'none'; img-src 'self'",
+		},
+		{
+			name:             "Headers_ReportOnly_RemovesEnforcedPolicy",
+			config:           CSPConfig{Policy: "default-src 'self'", ReportOnly: true},
+			expectedHeader:   HeaderContentSecurityPolicyReportOnly,
+			unexpectedHeader: HeaderContentSecurityPolicy,
+			expectedPolicy:   "default-src 'self'",
+		},
+		{
+			name:             "Headers_Reporting_AddsReportDirectives",
+			config:           CSPConfig{Policy: "default-src 'self'", ReportPath: "/_csp"},
+			expectedHeader:   HeaderContentSecurityPolicy,
+			unexpectedHeader: HeaderContentSecurityPolicyReportOnly,
+			expectedPolicy:   "default-src 'self'; report-uri /_csp; report-to csp-endpoint",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mw, err := NewCSPMiddleware(tt.config, nil, nil)
+			require.NoError(t, err)
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			rec := httptest.NewRecorder()
+			rec.Header().Set(HeaderContentSecurityPolicy, "default-src 'self' global")
+
+			// Act
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			// Assert
+			assert.Equal(t, tt.expectedPolicy, rec.Header().Get(tt.expectedHeader))
+			assert.Empty(t, rec.Header().Get(tt.unexpectedHeader))
+			if tt.config.ReportPath != "" {
+				assert.Equal(t, `csp-endpoint="/_csp"`, rec.Header().Get(HeaderReportingEndpoints))
+			}
+		})
+	}
+}
+
+func TestCSPMiddleware_Nonce(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentType   string
+		chunks        []string
+		expectRewrite bool
+	}{
+		{
+			name:          "Nonce_HTMLBody_Substituted",
+			contentType:   "text/html; charset=utf-8",
+			chunks:        []string{`<script nonce="__CSP_NONCE__">a()</script><style nonce="__CSP_NONCE__"></style>`},
+			expectRewrite: true,
+		},
+		{
+			name:          "Nonce_PlaceholderSplitAcrossWrites_Substituted",
+			contentType:   "text/html",
+			chunks:        []string{`<script nonce="__CSP_`, `NON`, `CE__">a()</script>__`},
+			expectRewrite: true,
+		},
+		{
+			name:        "Nonce_JSONBody_Untouched",
+			contentType: "application/json",
+			chunks:      []string{`{"nonce":"__CSP_NONCE__"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultCSPConfig()
+			config.Policy = "script-src 'nonce-__CSP_NONCE__'; style-src 'nonce-__CSP_NONCE__'"
+			config.Nonce = true
+			mw, err := NewCSPMiddleware(config, nil, nil)
+			require.NoError(t, err)
+
+			body := strings.Join(tt.chunks, "")
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Header().Set("Content-Length", "999")
+				for _, chunk := range tt.chunks {
+					_, _ = w.Write([]byte(chunk))
+				}
+			}))
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			// Assert
+			policy := rec.Header().Get(HeaderContentSecurityPolicy)
+			match := regexp.MustCompile(`'nonce-([A-Za-z0-9+/=]+)'`).FindStringSubmatch(policy)
+			require.Len(t, match, 2)
+			nonce := match[1]
+			assert.Equal(t, "script-src 'nonce-"+nonce+"'; style-src 'nonce-"+nonce+"'", policy)
+
+			if tt.expectRewrite {
+				assert.Equal(t, strings.ReplaceAll(body, "__CSP_NONCE__", nonce), rec.Body.String())
+				assert.Empty(t, rec.Header().Get("Content-Length"))
+			} else {
+				assert.Equal(t, body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCSPMiddleware_Nonce_GzipBackend_Substituted(t *testing.T) {
+	// Arrange
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		body := []byte(`<script nonce="__CSP_NONCE__">a()</script>`)
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			var buf bytes.Buffer
+			gw := gzip.NewWriter(&buf)
+			_, _ = gw.Write(body)
+			_ = gw.Close()
+			w.Header().Set("Content-Encoding", "gzip")
+			body = buf.Bytes()
+		}
+		_, _ = w.Write(body)
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+
+	config := DefaultCSPConfig()
+	config.Policy = "script-src 'nonce-__CSP_NONCE__'"
+	config.Nonce = true
+	mw, err := NewCSPMiddleware(config, nil, nil)
+	require.NoError(t, err)
+	handler := mw.Wrap(httputil.NewSingleHostReverseProxy(backendURL))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	rec := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rec, req)
+
+	// Assert
+	nonce := strings.TrimSuffix(strings.TrimPrefix(rec.Header().Get(HeaderContentSecurityPolicy), "script-src 'nonce-"), "'")
+	require.NotEmpty(t, nonce)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, `<script nonce="`+nonce+`">a()</script>`, rec.Body.String())
+	assert.Equal(t, "gzip, br", req.Header.Get("Accept-Encoding"))
+}
+
+func TestCSPMiddleware_Nonce_FreshPerRequest(t *testing.T) {
+	// Arrange
+	config := DefaultCSPConfig()
+	config.Policy = "script-src 'nonce-__CSP_NONCE__'"
+	config.Nonce = true
+	mw, err := NewCSPMiddleware(config, nil, nil)
+	require.NoError(t, err)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Act
+	first := httptest.NewRecorder()
+	handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/", nil))
+	second := httptest.NewRecorder()
+	handler.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// Assert
+	assert.NotEqual(t, first.Header().Get(HeaderContentSecurityPolicy), second.Header().Get(HeaderContentSecurityPolicy))
+}
+
+func TestCSPMiddleware_Nonce_Flush_WritesHeldBackBytes(t *testing.T) {
+	// Arrange
+	config := DefaultCSPConfig()
+	config.Policy = "script-src 'nonce-__CSP_NONCE__'"
+	config.Nonce = true
+	mw, err := NewCSPMiddleware(config, nil, nil)
+	require.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	var flushed string
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<p>first</p>__CSP"))
+		w.(http.Flusher).Flush()
+		flushed = rec.Body.String()
+		_, _ = w.Write([]byte("<p>second</p>"))
+	}))
+
+	// Act
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	// Assert
+	assert.Equal(t, "<p>first</p>__CSP", flushed)
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "<p>first</p>__CSP<p>second</p>", rec.Body.String())
+}
+
+func TestCSPMiddleware_Nonce_Upgrade(t *testing.T) {
+	// Arrange
+	config := DefaultCSPConfig()
+	config.Policy = "script-src 'nonce-__CSP_NONCE__'"
+	config.Nonce = true
+	mw, err := NewCSPMiddleware(config, nil, nil)
+	require.NoError(t, err)
+
+	// Act
+	resp, echoed := proxyUpgrade(t, mw)
+
+	// Assert
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "ping\n", echoed)
+}
+
+func TestCSPMiddleware_Nonce_InformationalResponse_PassedThrough(t *testing.T) {
+	// Arrange
+	config := DefaultCSPConfig()
+	config.Policy = "script-src 'nonce-__CSP_NONCE__'"
+	config.Nonce = true
+	mw, err := NewCSPMiddleware(config, nil, nil)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</app.js>; rel=preload; as=script")
+		w.WriteHeader(http.StatusEarlyHints)
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`<script nonce="__CSP_NONCE__"></script>`))
+	})))
+	t.Cleanup(server.Close)
+
+	var informational []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, _ textproto.MIMEHeader) error {
+			informational = append(informational, code)
+			return nil
+		},
+	}
+	req, err := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+
+	// Act
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	// Assert
+	assert.Equal(t, []int{http.StatusEarlyHints}, informational)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NotContains(t, string(body), "__CSP_NONCE__")
+}
+
+func TestCSPReportMiddleware_Reports(t *testing.T) {
+	tests := []struct {
+		name              string
+		method            string
+		host              string
+		body              string
+		expectedStatus    int
+		expectedRoute     string
+		expectedDirective string
+	}{
+		{
+			name:   "Reports_LegacyFormat_Accepted",
+			method: http.MethodPost,
+			body: `{"csp-report":{"document-uri":"https://app.example.com/page?user=1",
+				"violated-directive":"script-src-elem 'self'","blocked-uri":"https://cdn.evil.example/x.js"}}`,
+			expectedStatus:    http.StatusNoContent,
+			expectedRoute:     "app.example.com",
+			expectedDirective: "script-src-elem",
+		},
+		{
+			name:   "Reports_ReportingAPI_Accepted",
+			method: http.MethodPost,
+			body: `[{"type":"csp-violation","url":"https://app.example.com/",
+				"body":{"documentURL":"https://app.example.com/","effectiveDirective":"img-src",
+				"blockedURL":"https://img.example/a.png","disposition":"report"}},
+				{"type":"deprecation","body":{}}]`,
+			expectedStatus:    http.StatusNoContent,
+			expectedRoute:     "app.example.com",
+			expectedDirective: "img-src",
+		},
+		{
+			name:   "Reports_UnconfiguredHost_UnknownRoute",
+			method: http.MethodPost,
+			host:   "random-1234.example.net",
+			body: `{"csp-report":{"document-uri":"https://random-1234.example.net/",
+				"violated-directive":"img-src 'self'"}}`,
+			expectedStatus:    http.StatusNoContent,
+			expectedRoute:     "unknown",
+			expectedDirective: "img-src",
+		},
+		{
+			name:   "Reports_UnknownDirective_Other",
+			method: http.MethodPost,
+			body: `{"csp-report":{"document-uri":"https://app.example.com/",
+				"effective-directive":"random-directive-1234"}}`,
+			expectedStatus:    http.StatusNoContent,
+			expectedRoute:     "app.example.com",
+			expectedDirective: "other",
+		},
+		{
+			name:           "Reports_Malformed_BadRequest",
+			method:         http.MethodPost,
+			body:           `{"csp-report":`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Reports_TooLarge_Rejected",
+			method:         http.MethodPost,
+			body:           `{"csp-report":{"document-uri":"` + strings.Repeat("a", 2048) + `"}}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:           "Reports_Get_MethodNotAllowed",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			metrics := testhelpers.NewMockMetricsCollector()
+			if tt.expectedDirective != "" {
+				metrics.On("RecordCSPViolation", tt.expectedRoute, tt.expectedDirective).Return().Once()
+			}
+
+			config := DefaultCSPReportConfig()
+			config.MaxBodySize = 1024
+			config.Routes = []string{"App.Example.com"}
+			mw, err := NewCSPReportMiddleware(config, nil, metrics)
+			require.NoError(t, err)
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			}))
+
+			req := httptest.NewRequest(tt.method, "https://app.example.com/_rwwwrse/csp-report", strings.NewReader(tt.body))
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus >= http.StatusBadRequest {
+				assert.Equal(t, proxyerrors.ProblemContentType, rec.Header().Get("Content-Type"))
+			}
+			metrics.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCSPReportMiddleware_Dedupe(t *testing.T) {
+	// Arrange
+	mw, err := NewCSPReportMiddleware(DefaultCSPReportConfig(), nil, nil)
+	require.NoError(t, err)
+	reports := mw.(*cspReportMiddleware)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	reports.now = func() time.Time { return now }
+
+	// Act
+	first := reports.firstSeen("a")
+	duplicate := reports.firstSeen("a")
+	other := reports.firstSeen("b")
+	now = now.Add(11 * time.Minute)
+	expired := reports.firstSeen("a")
+
+	// Assert
+	assert.True(t, first)
+	assert.False(t, duplicate)
+	assert.True(t, other)
+	assert.True(t, expired)
+}
+
+func TestCSPReportMiddleware_OtherPaths_PassedThrough(t *testing.T) {
+	// Arrange
+	mw, err := NewCSPReportMiddleware(DefaultCSPReportConfig(), nil, nil)
+	require.NoError(t, err)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	rec := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+}
+
+func TestCSPValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*CSPConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*CSPConfig) {},
+		},
+		{
+			name:        "Validate_EmptyPolicy_ReturnsError",
+			mutate:      func(c *CSPConfig) { c.Policy = " " },
+			expectedErr: ErrCSPPolicyRequired,
+		},
+		{
+			name:        "Validate_NonceWithoutPlaceholder_ReturnsError",
+			mutate:      func(c *CSPConfig) { c.Nonce = true },
+			expectedErr: ErrCSPNoncePlaceholder,
+		},
+		{
+			name:        "Validate_RelativeReportPath_ReturnsError",
+			mutate:      func(c *CSPConfig) { c.ReportPath = "csp" },
+			expectedErr: ErrInvalidCSPReportPath,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultCSPConfig()
+			tt.mutate(&config)
+
+			// Act
+			err := NewCSPValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
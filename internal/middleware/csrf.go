@@ -0,0 +1,357 @@
+// Package middleware implements cross-site request forgery protection.
+package middleware
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// CSRF protection modes.
+const (
+	CSRFModeOrigin       = "origin"
+	CSRFModeDoubleSubmit = "double_submit"
+)
+
+// csrfFormLimit bounds how much of a form body is read to find the token.
+const csrfFormLimit = 64 << 10
+
+// csrfTokenBytes is the number of random bytes in a CSRF token.
+const csrfTokenBytes = 32
+
+// CSRFConfig holds configuration for the CSRF protection middleware.
+type CSRFConfig struct {
+	// Name identifies the route in logs.
+	Name string
+
+	// Mode is "origin" or "double_submit". Both verify the request origin;
+	// double_submit also requires a token matching the CSRF cookie.
+	Mode string
+
+	// TrustedOrigins lists other origins (scheme://host[:port]) allowed to
+	// send unsafe requests.
+	TrustedOrigins []string
+
+	// ExemptPaths lists path prefixes that are not checked.
+	ExemptPaths []string
+
+	// CookieName is the double-submit token cookie.
+	CookieName string
+
+	// CookieDomain is the domain of the token cookie.
+	CookieDomain string
+
+	// CookieSecure marks the token cookie Secure.
+	CookieSecure bool
+
+	// HeaderName carries the token on unsafe requests.
+	HeaderName string
+
+	// FormField carries the token in URL-encoded form submissions.
+	FormField string
+}
+
+// DefaultCSRFConfig returns a CSRF configuration using origin checks only.
+func DefaultCSRFConfig() CSRFConfig {
+	return CSRFConfig{
+		Mode:           CSRFModeOrigin,
+		TrustedOrigins: []string{},
+		ExemptPaths:    []string{},
+		CookieName:     "_rwwwrse_csrf",
+		CookieSecure:   true,
+		HeaderName:     "X-CSRF-Token",
+		FormField:      "csrf_token",
+	}
+}
+
+// csrfMiddleware implements CSRF protection.
+type csrfMiddleware struct {
+	config  CSRFConfig
+	trusted map[string]bool
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+}
+
+// NewCSRFMiddleware creates a new CSRF protection middleware.
+func NewCSRFMiddleware(
+	config CSRFConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewCSRFValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	trusted := make(map[string]bool, len(config.TrustedOrigins))
+	for _, origin := range config.TrustedOrigins {
+		trusted[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return &csrfMiddleware{
+		config:  config,
+		trusted: trusted,
+		logger:  logger,
+		metrics: metrics,
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *csrfMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.exempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token := ""
+		if m.config.Mode == CSRFModeDoubleSubmit {
+			token = m.ensureToken(w, r)
+		}
+
+		if isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if reason := m.checkOrigin(r); reason != "" {
+			m.reject(w, r, reason)
+			return
+		}
+
+		if m.config.Mode == CSRFModeDoubleSubmit {
+			if reason := m.checkToken(r, token); reason != "" {
+				m.reject(w, r, reason)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// exempt reports whether path is excluded from checks.
+func (m *csrfMiddleware) exempt(path string) bool {
+	for _, prefix := range m.config.ExemptPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin verifies that an unsafe request was not sent cross-site. It
+// returns the reason for rejection, or "" when the request is allowed.
+func (m *csrfMiddleware) checkOrigin(r *http.Request) string {
+	origin := r.Header.Get("Origin")
+
+	switch site := r.Header.Get("Sec-Fetch-Site"); site {
+	case "same-origin", "none":
+		return ""
+	case "":
+		// Browsers without Fetch Metadata: fall back to Origin and Referer.
+	default:
+		if origin != "" && m.originAllowed(r, origin) {
+			return ""
+		}
+		return "sec-fetch-site " + site
+	}
+
+	if origin != "" {
+		if m.originAllowed(r, origin) {
+			return ""
+		}
+		return "origin mismatch"
+	}
+
+	if referer := r.Header.Get("Referer"); referer != "" {
+		if m.originAllowed(r, referer) {
+			return ""
+		}
+		return "referer mismatch"
+	}
+
+	// Requests without any browser provenance headers are not browser
+	// initiated and cannot carry ambient credentials cross-site.
+	return ""
+}
+
+// originAllowed reports whether the origin of rawURL is the route itself or
+// trusted. The route matches only with the scheme the client used, so a page
+// served over plain HTTP cannot post to the HTTPS site.
+func (m *csrfMiddleware) originAllowed(r *http.Request, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+
+	if m.trusted[strings.ToLower(u.Scheme+"://"+u.Host)] {
+		return true
+	}
+
+	if !strings.EqualFold(u.Scheme, getRequestScheme(r)) {
+		return false
+	}
+
+	host := normalizeRouteHost(u.Host)
+	return host == normalizeRouteHost(r.Host) ||
+		(m.config.Name != "" && host == normalizeRouteHost(m.config.Name))
+}
+
+// ensureToken returns the token from the CSRF cookie, issuing a new cookie
+// when the client has none. A new token is also added to the request so
+// the backend can embed it in the response.
+func (m *csrfMiddleware) ensureToken(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(m.config.CookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	token := randomToken(csrfTokenBytes)
+	cookie := &http.Cookie{
+		Name:     m.config.CookieName,
+		Value:    token,
+		Domain:   m.config.CookieDomain,
+		Path:     "/",
+		Secure:   m.config.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+		// Readable by scripts so they can echo the token in a header.
+		HttpOnly: false,
+	}
+	http.SetCookie(w, cookie)
+	r.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+
+	// A token issued on an unsafe request cannot be matched by the client.
+	if !isSafeMethod(r.Method) {
+		return ""
+	}
+	return token
+}
+
+// checkToken verifies the double-submit token of an unsafe request.
+func (m *csrfMiddleware) checkToken(r *http.Request, expected string) string {
+	if expected == "" {
+		return "missing csrf cookie"
+	}
+
+	submitted := r.Header.Get(m.config.HeaderName)
+	if submitted == "" && m.config.FormField != "" {
+		submitted = m.formToken(r)
+	}
+
+	if submitted == "" {
+		return "missing csrf token"
+	}
+
+	if subtle.ConstantTimeCompare([]byte(submitted), []byte(expected)) != 1 {
+		return "csrf token mismatch"
+	}
+
+	return ""
+}
+
+// formToken reads the token field from a URL-encoded body and restores the
+// body for the backend.
+func (m *csrfMiddleware) formToken(r *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" || r.Body == nil || r.Body == http.NoBody {
+		return ""
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(r.Body, csrfFormLimit))
+	r.Body = &replayBody{
+		Reader: io.MultiReader(bytes.NewReader(body), r.Body),
+		Closer: r.Body,
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return ""
+	}
+	return values.Get(m.config.FormField)
+}
+
+// reject logs and denies a request that failed CSRF checks.
+func (m *csrfMiddleware) reject(w http.ResponseWriter, r *http.Request, reason string) {
+	route := m.config.Name
+	if route == "" {
+		route = normalizeRouteHost(r.Host)
+	}
+
+	if m.logger != nil {
+		m.logger.Warn(r.Context(), "Request rejected by CSRF protection",
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.String("client_ip", getClientIP(r)),
+			observability.String("route", route),
+			observability.String("reason", reason),
+			observability.String("method", r.Method),
+			observability.String("path", r.URL.Path),
+			observability.String("origin", sanitizeString(r.Header.Get("Origin"))),
+		)
+	}
+
+	writeErrorResponse(w, r, proxyerrors.NewSecurityError(
+		proxyerrors.ErrCodeAccessDenied,
+		"cross-site request rejected",
+		nil,
+	))
+}
+
+// isSafeMethod reports whether method is safe per RFC 9110 section 9.2.1.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// CSRFValidator validates CSRF protection configuration.
+type CSRFValidator struct{}
+
+// NewCSRFValidator creates a new CSRF validator.
+func NewCSRFValidator() *CSRFValidator {
+	return &CSRFValidator{}
+}
+
+// Validate validates the CSRF configuration.
+func (v *CSRFValidator) Validate(config CSRFConfig) error {
+	if config.Mode != CSRFModeOrigin && config.Mode != CSRFModeDoubleSubmit {
+		return fmt.Errorf("%w: %q", ErrInvalidCSRFMode, config.Mode)
+	}
+
+	for _, origin := range config.TrustedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("%w: %q", ErrInvalidCSRFOrigin, origin)
+		}
+	}
+
+	for _, path := range config.ExemptPaths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("%w: %q", ErrInvalidCSRFExemptPath, path)
+		}
+	}
+
+	if config.Mode == CSRFModeDoubleSubmit && (config.CookieName == "" || config.HeaderName == "") {
+		return ErrCSRFTokenNamesRequired
+	}
+
+	return nil
+}
+
+// CSRF validation errors.
+var (
+	ErrInvalidCSRFMode        = fmt.Errorf("CSRF mode must be origin or double_submit")
+	ErrInvalidCSRFOrigin      = fmt.Errorf("CSRF trusted origin must be scheme://host[:port]")
+	ErrInvalidCSRFExemptPath  = fmt.Errorf("CSRF exempt path must start with /")
+	ErrCSRFTokenNamesRequired = fmt.Errorf("CSRF double_submit mode requires a cookie name and header name")
+)
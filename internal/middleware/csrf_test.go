@@ -0,0 +1,332 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCSRFHandler wraps a handler that echoes the request body in a CSRF middleware.
+func newTestCSRFHandler(t *testing.T, mutate func(*CSRFConfig)) http.Handler {
+	t.Helper()
+
+	config := DefaultCSRFConfig()
+	config.Name = "app.example.com"
+	mutate(&config)
+
+	mw, err := NewCSRFMiddleware(config, nil, nil)
+	require.NoError(t, err)
+
+	return mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	}))
+}
+
+func TestCSRFMiddleware_OriginChecks(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		header         http.Header
+		expectedStatus int
+	}{
+		{
+			name:           "OriginChecks_SafeMethodCrossSite_Passes",
+			method:         http.MethodGet,
+			path:           "/",
+			header:         http.Header{"Sec-Fetch-Site": {"cross-site"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "OriginChecks_SecFetchSameOrigin_Passes",
+			method:         http.MethodPost,
+			path:           "/",
+			header:         http.Header{"Sec-Fetch-Site": {"same-origin"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "OriginChecks_SecFetchCrossSite_Rejected",
+			method:         http.MethodPost,
+			path:           "/",
+			header:         http.Header{"Sec-Fetch-Site": {"cross-site"}, "Origin": {"https://evil.example"}},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "OriginChecks_SecFetchSameSiteTrustedOrigin_Passes",
+			method:         http.MethodPost,
+			path:           "/",
+			header:         http.Header{"Sec-Fetch-Site": {"same-site"}, "Origin": {"https://admin.example.com"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "OriginChecks_MatchingOrigin_Passes",
+			method:         http.MethodPut,
+			path:           "/",
+			header:         http.Header{"Origin": {"https://app.example.com"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "OriginChecks_ForeignOrigin_Rejected",
+			method:         http.MethodDelete,
+			path:           "/",
+			header:         http.Header{"Origin": {"https://evil.example"}},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "OriginChecks_MismatchedScheme_Rejected",
+			method:         http.MethodPost,
+			path:           "/",
+			header:         http.Header{"Origin": {"http://app.example.com"}},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "OriginChecks_NullOrigin_Rejected",
+			method:         http.MethodPost,
+			path:           "/",
+			header:         http.Header{"Origin": {"null"}},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "OriginChecks_ForeignReferer_Rejected",
+			method:         http.MethodPost,
+			path:           "/",
+			header:         http.Header{"Referer": {"https://evil.example/form"}},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "OriginChecks_MatchingReferer_Passes",
+			method:         http.MethodPost,
+			path:           "/",
+			header:         http.Header{"Referer": {"https://app.example.com/form"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "OriginChecks_NoBrowserHeaders_Passes",
+			method:         http.MethodPost,
+			path:           "/",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "OriginChecks_ExemptPath_Passes",
+			method:         http.MethodPost,
+			path:           "/webhooks/github",
+			header:         http.Header{"Sec-Fetch-Site": {"cross-site"}},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	handler := newTestCSRFHandler(t, func(c *CSRFConfig) {
+		c.TrustedOrigins = []string{"https://admin.example.com"}
+		c.ExemptPaths = []string{"/webhooks/"}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(tt.method, "https://app.example.com"+tt.path, nil)
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.Contains(t, rec.Body.String(), "access_denied")
+			}
+		})
+	}
+}
+
+func TestCSRFMiddleware_OriginChecks_ForwardedProto(t *testing.T) {
+	tests := []struct {
+		name           string
+		header         http.Header
+		expectedStatus int
+	}{
+		{
+			name:           "ForwardedProto_TrustedHTTPS_MatchesHTTPSOrigin",
+			header:         http.Header{"X-Forwarded-Proto": {"https"}, "Origin": {"https://app.example.com"}},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "ForwardedProto_Missing_RejectsHTTPSOrigin",
+			header:         http.Header{"Origin": {"https://app.example.com"}},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	clientIP, err := NewClientIPMiddleware(ClientIPConfig{TrustedProxies: []string{"192.0.2.0/24"}}, nil)
+	require.NoError(t, err)
+	handler := clientIP.Wrap(newTestCSRFHandler(t, func(*CSRFConfig) {}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(http.MethodPost, "http://app.example.com/", nil)
+			req.RemoteAddr = "192.0.2.10:4000"
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestCSRFMiddleware_DoubleSubmit(t *testing.T) {
+	tests := []struct {
+		name           string
+		cookie         string
+		header         string
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{
+			name:           "DoubleSubmit_HeaderMatchesCookie_Passes",
+			cookie:         "tok123",
+			header:         "tok123",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "DoubleSubmit_FormFieldMatchesCookie_PassesWithBody",
+			cookie:         "tok123",
+			contentType:    "application/x-www-form-urlencoded",
+			body:           "name=x&csrf_token=tok123",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "DoubleSubmit_TokenMismatch_Rejected",
+			cookie:         "tok123",
+			header:         "other",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "DoubleSubmit_MissingToken_Rejected",
+			cookie:         "tok123",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "DoubleSubmit_MissingCookie_Rejected",
+			header:         "tok123",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	handler := newTestCSRFHandler(t, func(c *CSRFConfig) { c.Mode = CSRFModeDoubleSubmit })
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(http.MethodPost, "https://app.example.com/", strings.NewReader(tt.body))
+			req.Header.Set("Sec-Fetch-Site", "same-origin")
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "_rwwwrse_csrf", Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set("X-CSRF-Token", tt.header)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestCSRFMiddleware_DoubleSubmit_IssuesCookieOnSafeRequest(t *testing.T) {
+	// Arrange
+	handler := newTestCSRFHandler(t, func(c *CSRFConfig) { c.Mode = CSRFModeDoubleSubmit })
+	req := httptest.NewRequest(http.MethodGet, "https://app.example.com/form", nil)
+	rec := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rec, req)
+
+	// Assert
+	require.Len(t, rec.Result().Cookies(), 1)
+	cookie := rec.Result().Cookies()[0]
+	assert.Equal(t, "_rwwwrse_csrf", cookie.Name)
+	assert.NotEmpty(t, cookie.Value)
+	assert.True(t, cookie.Secure)
+	assert.False(t, cookie.HttpOnly)
+}
+
+func TestCSRFValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*CSRFConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*CSRFConfig) {},
+		},
+		{
+			name:        "Validate_UnknownMode_ReturnsError",
+			mutate:      func(c *CSRFConfig) { c.Mode = "token" },
+			expectedErr: ErrInvalidCSRFMode,
+		},
+		{
+			name:        "Validate_OriginWithPath_ReturnsError",
+			mutate:      func(c *CSRFConfig) { c.TrustedOrigins = []string{"https://app.example.com/login"} },
+			expectedErr: ErrInvalidCSRFOrigin,
+		},
+		{
+			name:        "Validate_RelativeExemptPath_ReturnsError",
+			mutate:      func(c *CSRFConfig) { c.ExemptPaths = []string{"webhooks"} },
+			expectedErr: ErrInvalidCSRFExemptPath,
+		},
+		{
+			name: "Validate_DoubleSubmitWithoutHeader_ReturnsError",
+			mutate: func(c *CSRFConfig) {
+				c.Mode = CSRFModeDoubleSubmit
+				c.HeaderName = ""
+			},
+			expectedErr: ErrCSRFTokenNamesRequired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultCSRFConfig()
+			tt.mutate(&config)
+
+			// Act
+			err := NewCSRFValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Package middleware implements per-route error page rendering.
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"net/http"
+	"regexp"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// errorPageKeyPattern matches a 4xx or 5xx status code or status class.
+var errorPageKeyPattern = regexp.MustCompile(`^[45](\d\d|xx)$`)
+
+// ErrorPagesConfig holds configuration for the error pages middleware.
+type ErrorPagesConfig struct {
+	// Name identifies the route in logs.
+	Name string
+
+	// Pages maps status codes, such as "404", or status classes, such as
+	// "5xx", to HTML template files. Templates receive the problem details
+	// of the error, e.g. {{.Status}}, {{.Title}}, {{.Detail}} and
+	// {{.RequestID}}.
+	Pages map[string]string
+}
+
+// DefaultErrorPagesConfig returns an error pages configuration without custom pages.
+func DefaultErrorPagesConfig() ErrorPagesConfig {
+	return ErrorPagesConfig{
+		Pages: make(map[string]string),
+	}
+}
+
+// errorPagesMiddleware makes the route's error renderer available to every
+// component that writes an error response for the request.
+type errorPagesMiddleware struct {
+	renderer *proxyerrors.Renderer
+}
+
+// NewErrorPagesMiddleware creates a new error pages middleware. Templates
+// are parsed once, so invalid templates are reported at startup.
+func NewErrorPagesMiddleware(
+	config ErrorPagesConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewErrorPagesValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	pages := make(map[string]*template.Template, len(config.Pages))
+	for key, path := range config.Pages {
+		page, err := template.ParseFiles(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidErrorPage, key, err)
+		}
+		pages[key] = page
+	}
+
+	if logger != nil && len(pages) > 0 {
+		logger.Debug(context.Background(), "Error pages loaded",
+			observability.String("route", config.Name),
+			observability.Int("pages", len(pages)),
+		)
+	}
+
+	return &errorPagesMiddleware{
+		renderer: proxyerrors.NewRenderer(pages),
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *errorPagesMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(proxyerrors.WithRenderer(r.Context(), m.renderer)))
+	})
+}
+
+// ErrorPagesValidator validates error pages configuration.
+type ErrorPagesValidator struct{}
+
+// NewErrorPagesValidator creates a new error pages configuration validator.
+func NewErrorPagesValidator() *ErrorPagesValidator {
+	return &ErrorPagesValidator{}
+}
+
+// Validate validates the error pages configuration.
+func (v *ErrorPagesValidator) Validate(config ErrorPagesConfig) error {
+	for key, path := range config.Pages {
+		if !errorPageKeyPattern.MatchString(key) {
+			return fmt.Errorf("%w: %q", ErrInvalidErrorPageKey, key)
+		}
+		if path == "" {
+			return fmt.Errorf("%w: %s", ErrInvalidErrorPage, key)
+		}
+	}
+
+	return nil
+}
+
+// Error pages validation errors.
+var (
+	ErrInvalidErrorPageKey = fmt.Errorf("error page key must be a 4xx or 5xx status code or class")
+	ErrInvalidErrorPage    = fmt.Errorf("error page template is invalid")
+)
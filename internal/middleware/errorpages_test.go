@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+)
+
+func TestErrorPagesMiddleware_Wrap(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "503.html")
+	require.NoError(t, os.WriteFile(page, []byte(`<p>Back soon ({{.Code}})</p>`), 0o600))
+
+	tests := []struct {
+		name                string
+		accept              string
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			name:                "Wrap_BrowserRequest_CustomPage",
+			accept:              "text/html",
+			expectedContentType: "text/html; charset=utf-8",
+			expectedBody:        "<p>Back soon (service_unavailable)</p>",
+		},
+		{
+			name:                "Wrap_APIRequest_ProblemJSON",
+			accept:              "application/json, application/problem+json",
+			expectedContentType: proxyerrors.ProblemContentType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultErrorPagesConfig()
+			config.Pages["5xx"] = page
+			mw, err := NewErrorPagesMiddleware(config, nil, nil)
+			require.NoError(t, err)
+
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeServiceUnavailable, "Service overloaded", nil))
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+			assert.Equal(t, tt.expectedContentType, rec.Header().Get("Content-Type"))
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestErrorPagesValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		pages       map[string]string
+		expectedErr error
+	}{
+		{
+			name:  "Validate_StatusAndClass_Valid",
+			pages: map[string]string{"404": "/pages/404.html", "5xx": "/pages/5xx.html"},
+		},
+		{
+			name:        "Validate_SuccessStatus_ReturnsError",
+			pages:       map[string]string{"200": "/pages/ok.html"},
+			expectedErr: ErrInvalidErrorPageKey,
+		},
+		{
+			name:        "Validate_EmptyPath_ReturnsError",
+			pages:       map[string]string{"404": ""},
+			expectedErr: ErrInvalidErrorPage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := ErrorPagesConfig{Pages: tt.pages}
+
+			// Act
+			err := NewErrorPagesValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestNewErrorPagesMiddleware_InvalidTemplate(t *testing.T) {
+	// Arrange
+	page := filepath.Join(t.TempDir(), "404.html")
+	require.NoError(t, os.WriteFile(page, []byte(`{{.Status`), 0o600))
+	config := DefaultErrorPagesConfig()
+	config.Pages["404"] = page
+
+	// Act
+	_, err := NewErrorPagesMiddleware(config, nil, nil)
+
+	// Assert
+	assert.ErrorIs(t, err, ErrInvalidErrorPage)
+}
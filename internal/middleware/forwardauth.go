@@ -0,0 +1,328 @@
+// Package middleware implements forward authentication against an external service.
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// Forward auth constants.
+const (
+	// maxForwardAuthBodySize bounds the denial body relayed to the client.
+	maxForwardAuthBodySize = 64 * 1024
+
+	// maxForwardAuthCacheEntries bounds the decision cache size.
+	maxForwardAuthCacheEntries = 10000
+)
+
+// forwardAuthHopHeaders are never copied between the auth request and response.
+var forwardAuthHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Content-Length",
+}
+
+// ForwardAuthConfig holds configuration for the forward auth middleware.
+type ForwardAuthConfig struct {
+	// URL of the authorization service.
+	URL string
+
+	// Timeout bounds each authorization subrequest. Timeouts and server
+	// errors from the service fail closed and are never cached.
+	Timeout time.Duration
+
+	// RequestHeaders lists the original request headers sent to the
+	// authorization service. When empty, all end-to-end headers are sent.
+	RequestHeaders []string
+
+	// ResponseHeaders lists the authorization response headers copied onto
+	// the upstream request when access is granted.
+	ResponseHeaders []string
+
+	// CacheTTL enables a decision cache when positive.
+	CacheTTL time.Duration
+
+	// CacheKeyHeaders lists the request headers that, together with the
+	// method, host and URI, identify a cached decision.
+	CacheKeyHeaders []string
+
+	// HTTPClient is used for authorization subrequests.
+	HTTPClient *http.Client
+}
+
+// DefaultForwardAuthConfig returns a forward auth configuration with sensible defaults.
+func DefaultForwardAuthConfig() ForwardAuthConfig {
+	return ForwardAuthConfig{
+		Timeout:         5 * time.Second,
+		RequestHeaders:  []string{},
+		ResponseHeaders: []string{},
+		CacheKeyHeaders: []string{"Authorization", "Cookie"},
+	}
+}
+
+// forwardAuthDecision is the outcome of an authorization subrequest.
+type forwardAuthDecision struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// allowed reports whether the decision grants access.
+func (d *forwardAuthDecision) allowed() bool {
+	return d.status >= 200 && d.status < 300
+}
+
+// forwardAuthMiddleware consults an external service before proxying requests.
+type forwardAuthMiddleware struct {
+	config  ForwardAuthConfig
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+
+	mu    sync.Mutex
+	cache map[string]*forwardAuthDecision
+}
+
+// NewForwardAuthMiddleware creates a new forward auth middleware.
+func NewForwardAuthMiddleware(
+	config ForwardAuthConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("forward auth URL is required")
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultForwardAuthConfig().Timeout
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{
+			// Redirects from the auth service are relayed to the client.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	return &forwardAuthMiddleware{
+		config:  config,
+		logger:  logger,
+		metrics: metrics,
+		cache:   make(map[string]*forwardAuthDecision),
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *forwardAuthMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision, err := m.authorize(r)
+		if err != nil {
+			if m.logger != nil {
+				m.logger.Error(r.Context(), err, "Forward auth request failed",
+					observability.String("request_id", GetRequestID(r.Context())),
+					observability.String("auth_url", m.config.URL),
+					observability.String("host", r.Host),
+				)
+			}
+
+			writeErrorResponse(w, r, proxyerrors.WrapError(
+				proxyerrors.ErrCodeServiceUnavailable,
+				"authorization service unavailable",
+				err,
+			))
+			return
+		}
+
+		if !decision.allowed() {
+			if m.logger != nil {
+				m.logger.Debug(r.Context(), "Forward auth denied request",
+					observability.String("request_id", GetRequestID(r.Context())),
+					observability.String("host", r.Host),
+					observability.String("path", r.URL.Path),
+					observability.Int("status", decision.status),
+				)
+			}
+
+			if decision.status == http.StatusUnauthorized || decision.status == http.StatusForbidden {
+				ReportOffense(r, OffenseAuthFailure)
+			}
+
+			writeForwardAuthDenial(w, decision)
+			return
+		}
+
+		for _, name := range m.config.ResponseHeaders {
+			r.Header.Del(name)
+			for _, value := range decision.header.Values(name) {
+				r.Header.Add(name, value)
+			}
+		}
+
+		next.ServeHTTP(w, markAuthenticated(r))
+	})
+}
+
+// authorize returns a cached decision or performs an authorization subrequest.
+func (m *forwardAuthMiddleware) authorize(r *http.Request) (*forwardAuthDecision, error) {
+	key := m.cacheKey(r)
+	if key != "" {
+		if decision := m.cachedDecision(key); decision != nil {
+			return decision, nil
+		}
+	}
+
+	decision, err := m.subrequest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != "" {
+		m.storeDecision(key, decision)
+	}
+
+	return decision, nil
+}
+
+// subrequest sends the original request metadata to the authorization service.
+func (m *forwardAuthMiddleware) subrequest(r *http.Request) (*forwardAuthDecision, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), m.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.config.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create auth request: %w", err)
+	}
+
+	if len(m.config.RequestHeaders) == 0 {
+		for name, values := range r.Header {
+			req.Header[name] = append([]string(nil), values...)
+		}
+		for _, name := range forwardAuthHopHeaders {
+			req.Header.Del(name)
+		}
+	} else {
+		for _, name := range m.config.RequestHeaders {
+			for _, value := range r.Header.Values(name) {
+				req.Header.Add(name, value)
+			}
+		}
+	}
+
+	scheme := getRequestScheme(r)
+	req.Header.Set("X-Forwarded-Method", r.Method)
+	req.Header.Set("X-Forwarded-Proto", scheme)
+	req.Header.Set("X-Forwarded-Host", r.Host)
+	req.Header.Set("X-Forwarded-Uri", r.URL.RequestURI())
+	req.Header.Set("X-Original-Url", scheme+"://"+r.Host+r.URL.RequestURI())
+	req.Header.Set("X-Forwarded-For", getClientIP(r))
+
+	resp, err := m.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("auth request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("auth service returned status %d", resp.StatusCode)
+	}
+
+	decision := &forwardAuthDecision{
+		status: resp.StatusCode,
+		header: resp.Header.Clone(),
+	}
+	for _, name := range forwardAuthHopHeaders {
+		decision.header.Del(name)
+	}
+
+	if !decision.allowed() {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxForwardAuthBodySize))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read auth response: %w", err)
+		}
+		decision.body = body
+	}
+
+	return decision, nil
+}
+
+// cacheKey identifies a decision, or returns "" when caching is disabled.
+func (m *forwardAuthMiddleware) cacheKey(r *http.Request) string {
+	if m.config.CacheTTL <= 0 || len(m.config.CacheKeyHeaders) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(0)
+	b.WriteString(strings.ToLower(r.Host))
+	b.WriteByte(0)
+	b.WriteString(r.URL.RequestURI())
+	for _, name := range m.config.CacheKeyHeaders {
+		b.WriteByte(0)
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// cachedDecision returns an unexpired cached decision.
+func (m *forwardAuthMiddleware) cachedDecision(key string) *forwardAuthDecision {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	decision, exists := m.cache[key]
+	if !exists {
+		return nil
+	}
+
+	if time.Now().After(decision.expires) {
+		delete(m.cache, key)
+		return nil
+	}
+
+	return decision
+}
+
+// storeDecision caches a decision, evicting expired entries when the cache is full.
+func (m *forwardAuthMiddleware) storeDecision(key string, decision *forwardAuthDecision) {
+	now := time.Now()
+	decision.expires = now.Add(m.config.CacheTTL)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.cache) >= maxForwardAuthCacheEntries {
+		for k, d := range m.cache {
+			if now.After(d.expires) {
+				delete(m.cache, k)
+			}
+		}
+		if len(m.cache) >= maxForwardAuthCacheEntries {
+			m.cache = make(map[string]*forwardAuthDecision)
+		}
+	}
+
+	m.cache[key] = decision
+}
+
+// writeForwardAuthDenial relays the authorization service response verbatim.
+func writeForwardAuthDenial(w http.ResponseWriter, decision *forwardAuthDecision) {
+	for name, values := range decision.header {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	w.WriteHeader(decision.status)
+	_, _ = w.Write(decision.body)
+}
@@ -0,0 +1,225 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/albedosehen/rwwwrse/internal/clientip"
+)
+
+// newForwardAuthServer starts an authorization service that allows requests
+// carrying "Authorization: Bearer good", fails those carrying "Bearer broken"
+// and rejects everything else.
+func newForwardAuthServer(t *testing.T, calls *int32) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+
+		switch r.Header.Get("Authorization") {
+		case "Bearer good":
+			w.Header().Set("X-Auth-User", "alice")
+			w.Header().Set("X-Auth-Internal", "secret")
+			w.Header().Set("X-Seen-Uri", r.Header.Get("X-Forwarded-Uri"))
+			w.WriteHeader(http.StatusOK)
+		case "Bearer broken":
+			w.WriteHeader(http.StatusBadGateway)
+		case "Bearer slow":
+			time.Sleep(200 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("login required"))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestForwardAuthMiddleware_Wrap(t *testing.T) {
+	tests := []struct {
+		name           string
+		authorization  string
+		expectedStatus int
+		expectedBody   string
+		upstreamCalled bool
+	}{
+		{
+			name:           "ForwardAuth_Allowed_ProxiesWithResponseHeaders",
+			authorization:  "Bearer good",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "upstream",
+			upstreamCalled: true,
+		},
+		{
+			name:           "ForwardAuth_Denied_RelaysAuthResponse",
+			authorization:  "Bearer bad",
+			expectedStatus: http.StatusUnauthorized,
+			expectedBody:   "login required",
+		},
+		{
+			name:           "ForwardAuth_ServerError_FailsClosed",
+			authorization:  "Bearer broken",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:           "ForwardAuth_Timeout_FailsClosed",
+			authorization:  "Bearer slow",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var calls int32
+			server := newForwardAuthServer(t, &calls)
+
+			config := DefaultForwardAuthConfig()
+			config.URL = server.URL
+			config.Timeout = 50 * time.Millisecond
+			config.RequestHeaders = []string{"Authorization"}
+			config.ResponseHeaders = []string{"X-Auth-User"}
+			mw, err := NewForwardAuthMiddleware(config, nil, nil)
+			require.NoError(t, err)
+
+			var upstream http.Header
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				upstream = r.Header.Clone()
+				_, _ = w.Write([]byte("upstream"))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "http://app.example.com/api?x=1", nil)
+			req.Header.Set("Authorization", tt.authorization)
+			req.Header.Set("X-Auth-User", "spoofed")
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rec.Body.String())
+			}
+			assert.Equal(t, tt.upstreamCalled, upstream != nil)
+			if tt.upstreamCalled {
+				assert.Equal(t, "alice", upstream.Get("X-Auth-User"))
+				assert.Empty(t, upstream.Get("X-Auth-Internal"))
+			}
+			if tt.expectedStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="test"`, rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestForwardAuthMiddleware_Cache(t *testing.T) {
+	tests := []struct {
+		name          string
+		cacheTTL      time.Duration
+		firstAuth     string
+		secondAuth    string
+		expectedCalls int32
+	}{
+		{
+			name:          "ForwardAuth_CacheEnabled_SameKey_ReusesDecision",
+			cacheTTL:      time.Minute,
+			secondAuth:    "Bearer good",
+			expectedCalls: 1,
+		},
+		{
+			name:          "ForwardAuth_CacheEnabled_DifferentKey_Subrequests",
+			cacheTTL:      time.Minute,
+			secondAuth:    "Bearer bad",
+			expectedCalls: 2,
+		},
+		{
+			name:          "ForwardAuth_CacheEnabled_ServerError_NotCached",
+			cacheTTL:      time.Minute,
+			firstAuth:     "Bearer broken",
+			secondAuth:    "Bearer broken",
+			expectedCalls: 2,
+		},
+		{
+			name:          "ForwardAuth_CacheDisabled_AlwaysSubrequests",
+			cacheTTL:      0,
+			secondAuth:    "Bearer good",
+			expectedCalls: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var calls int32
+			server := newForwardAuthServer(t, &calls)
+
+			config := DefaultForwardAuthConfig()
+			config.URL = server.URL
+			config.CacheTTL = tt.cacheTTL
+			config.CacheKeyHeaders = []string{"Authorization"}
+			mw, err := NewForwardAuthMiddleware(config, nil, nil)
+			require.NoError(t, err)
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			// Act
+			firstAuth := tt.firstAuth
+			if firstAuth == "" {
+				firstAuth = "Bearer good"
+			}
+			for _, auth := range []string{firstAuth, tt.secondAuth} {
+				req := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+				req.Header.Set("Authorization", auth)
+				handler.ServeHTTP(httptest.NewRecorder(), req)
+			}
+
+			// Assert
+			assert.Equal(t, tt.expectedCalls, atomic.LoadInt32(&calls))
+		})
+	}
+}
+
+func TestForwardAuthMiddleware_ForwardedProto_UsesClientScheme(t *testing.T) {
+	// Arrange
+	var seen http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	config := DefaultForwardAuthConfig()
+	config.URL = server.URL
+	mw, err := NewForwardAuthMiddleware(config, nil, nil)
+	require.NoError(t, err)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/api?x=1", nil)
+	req = req.WithContext(clientip.WithResult(req.Context(), clientip.Result{Scheme: "https"}))
+
+	// Act
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Assert
+	require.NotNil(t, seen)
+	assert.Equal(t, "https", seen.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "https://app.example.com/api?x=1", seen.Get("X-Original-Url"))
+}
+
+func TestNewForwardAuthMiddleware_MissingURL_ReturnsError(t *testing.T) {
+	// Act
+	mw, err := NewForwardAuthMiddleware(DefaultForwardAuthConfig(), nil, nil)
+
+	// Assert
+	assert.Error(t, err)
+	assert.Nil(t, mw)
+}
@@ -129,6 +129,12 @@ const (
 
 	// ContextKeyRemoteAddr is the context key for remote address.
 	ContextKeyRemoteAddr ContextKey = "remote_addr"
+
+	// ContextKeyRouteName is the context key for the matched route name.
+	ContextKeyRouteName ContextKey = "route_name"
+
+	// ContextKeyBanManager is the context key for the active ban manager.
+	ContextKeyBanManager ContextKey = "ban_manager"
 )
 
 // GetRequestID extracts the request ID from the context.
@@ -156,3 +162,16 @@ func WithRequestID(ctx context.Context, requestID string) context.Context {
 func WithStartTime(ctx context.Context, startTime time.Time) context.Context {
 	return context.WithValue(ctx, ContextKeyStartTime, startTime)
 }
+
+// GetRouteName extracts the matched route name from the context.
+func GetRouteName(ctx context.Context) string {
+	if name, ok := ctx.Value(ContextKeyRouteName).(string); ok {
+		return name
+	}
+	return ""
+}
+
+// WithRouteName adds the matched route name to the context.
+func WithRouteName(ctx context.Context, routeName string) context.Context {
+	return context.WithValue(ctx, ContextKeyRouteName, routeName)
+}
@@ -0,0 +1,398 @@
+// Package middleware implements JSON Web Token parsing and verification.
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// JWT verification constants.
+const (
+	// jwtClockSkew is the tolerance applied to exp, iat and nbf checks.
+	jwtClockSkew = time.Minute
+
+	// jwksMinRefreshInterval bounds how often an unknown key ID triggers a refetch.
+	jwksMinRefreshInterval = time.Minute
+)
+
+// jwtHeader is the decoded JOSE header of a compact JWS.
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	Type      string `json:"typ"`
+}
+
+// jwtClaims holds the decoded claims of a token.
+type jwtClaims map[string]any
+
+// jwtToken is a parsed but not necessarily verified compact JWS.
+type jwtToken struct {
+	header       jwtHeader
+	claims       jwtClaims
+	signingInput string
+	signature    []byte
+}
+
+// parseJWT decodes a compact JWS without verifying its signature.
+func parseJWT(raw string) (*jwtToken, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed token: expected 3 parts, got %d", len(parts))
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("malformed token header: %w", err)
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+
+	claims := make(jwtClaims)
+	decoder := json.NewDecoder(strings.NewReader(string(claimsJSON)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("malformed token claims: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed token signature: %w", err)
+	}
+
+	return &jwtToken{
+		header:       header,
+		claims:       claims,
+		signingInput: parts[0] + "." + parts[1],
+		signature:    signature,
+	}, nil
+}
+
+// verifySignature checks the token signature against the given public key.
+func (t *jwtToken) verifySignature(key crypto.PublicKey) error {
+	var hash crypto.Hash
+	switch t.header.Algorithm {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", t.header.Algorithm)
+	}
+
+	h := hash.New()
+	h.Write([]byte(t.signingInput))
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(t.header.Algorithm, "RS") {
+			return fmt.Errorf("algorithm %s does not match RSA key", t.header.Algorithm)
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, t.signature); err != nil {
+			return fmt.Errorf("invalid token signature: %w", err)
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(t.header.Algorithm, "ES") {
+			return fmt.Errorf("algorithm %s does not match EC key", t.header.Algorithm)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(t.signature) != 2*size {
+			return fmt.Errorf("invalid token signature length")
+		}
+		r := new(big.Int).SetBytes(t.signature[:size])
+		s := new(big.Int).SetBytes(t.signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("invalid token signature")
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", key)
+	}
+
+	return nil
+}
+
+// validateTimes checks the exp, nbf and iat claims against now.
+func (c jwtClaims) validateTimes(now time.Time) error {
+	if exp, ok := c.time("exp"); ok {
+		if now.After(exp.Add(jwtClockSkew)) {
+			return fmt.Errorf("token expired at %s", exp.UTC().Format(time.RFC3339))
+		}
+	} else {
+		return fmt.Errorf("token has no expiry")
+	}
+
+	if nbf, ok := c.time("nbf"); ok && now.Add(jwtClockSkew).Before(nbf) {
+		return fmt.Errorf("token not valid before %s", nbf.UTC().Format(time.RFC3339))
+	}
+
+	if iat, ok := c.time("iat"); ok && now.Add(jwtClockSkew).Before(iat) {
+		return fmt.Errorf("token issued in the future")
+	}
+
+	return nil
+}
+
+// hasAudience reports whether the aud claim contains audience.
+func (c jwtClaims) hasAudience(audience string) bool {
+	return containsString(c.strings("aud"), audience)
+}
+
+// string returns a string claim.
+func (c jwtClaims) string(name string) string {
+	if v, ok := c[name].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// strings returns a claim that may be a single string or an array of strings.
+func (c jwtClaims) strings(name string) []string {
+	return claimStrings(c[name])
+}
+
+// bool returns a boolean claim and whether it was present.
+func (c jwtClaims) bool(name string) (bool, bool) {
+	switch v := c[name].(type) {
+	case bool:
+		return v, true
+	case string:
+		return v == "true", true
+	default:
+		return false, false
+	}
+}
+
+// time returns a NumericDate claim.
+func (c jwtClaims) time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case json.Number:
+		seconds, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		return time.Unix(int64(seconds), 0), true
+	case float64:
+		return time.Unix(int64(v), 0), true
+	default:
+		return time.Time{}, false
+	}
+}
+
+// lookup resolves a dotted claim path such as "realm_access.roles".
+func (c jwtClaims) lookup(path string) any {
+	var current any = map[string]any(c)
+	for _, part := range strings.Split(path, ".") {
+		m, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		current = m[part]
+	}
+	return current
+}
+
+// jsonWebKey is a single key from a JWK Set.
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+// publicKey converts the JWK to a crypto.PublicKey.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA exponent: %w", err)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve %q", k.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x coordinate: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+// jwksCache fetches and caches the signing keys published at a JWKS URI.
+type jwksCache struct {
+	uri       string
+	client    *http.Client
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	refresh   singleflight.Group
+}
+
+// newJWKSCache creates a key cache for the given JWKS URI.
+func newJWKSCache(uri string, client *http.Client) *jwksCache {
+	return &jwksCache{
+		uri:    uri,
+		client: client,
+		keys:   make(map[string]crypto.PublicKey),
+	}
+}
+
+// key returns the public key with the given ID, refetching the key set when
+// the ID is unknown so that provider key rotation is picked up. Concurrent
+// callers share one request, made without holding c.mu, so lookups of known
+// keys are not held up by a slow provider.
+func (c *jwksCache) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := c.cached(kid); ok {
+		return key, nil
+	}
+	if !c.refreshDue() {
+		return nil, fmt.Errorf("signing key %q not found", kid)
+	}
+
+	_, err, _ := c.refresh.Do("refresh", func() (interface{}, error) {
+		// A flight that finished since the check above may have fetched the key.
+		if _, ok := c.cached(kid); ok || !c.refreshDue() {
+			return nil, nil
+		}
+
+		// The shared request must not fail because the first caller went away.
+		keys, err := c.fetch(context.WithoutCancel(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		c.mu.Lock()
+		c.keys = keys
+		c.fetchedAt = time.Now()
+		c.mu.Unlock()
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if key, ok := c.cached(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("signing key %q not found", kid)
+}
+
+// refreshDue reports whether the key set may be fetched again.
+func (c *jwksCache) refreshDue() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.fetchedAt.IsZero() || time.Since(c.fetchedAt) >= jwksMinRefreshInterval
+}
+
+// cached returns a key without fetching.
+func (c *jwksCache) cached(kid string) (crypto.PublicKey, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lookupLocked(kid)
+}
+
+// lookupLocked finds a key by ID. An empty ID matches a single-key set.
+func (c *jwksCache) lookupLocked(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+// fetch downloads and parses the key set.
+func (c *jwksCache) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.uri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWKS request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS document: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,392 @@
+// Package middleware implements request size limits and slow upload protection.
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// Request limit types used in logs and metrics.
+const (
+	LimitBodySize    = "body_size"
+	LimitHeaderSize  = "header_size"
+	LimitHeaderCount = "header_count"
+	LimitURLLength   = "url_length"
+	LimitQueryParams = "query_params"
+	LimitUploadRate  = "upload_rate"
+)
+
+// RequestLimitsConfig holds configuration for the request limits middleware.
+// A zero limit is not enforced.
+type RequestLimitsConfig struct {
+	// Name identifies the route in logs and metrics.
+	Name string
+
+	// MaxBodySize is the maximum request body size in bytes.
+	MaxBodySize int64
+
+	// MaxHeaderBytes is the maximum combined size of all header fields.
+	MaxHeaderBytes int
+
+	// MaxHeaderCount is the maximum number of header field values.
+	MaxHeaderCount int
+
+	// MaxURLLength is the maximum length of the request target.
+	MaxURLLength int
+
+	// MaxQueryParams is the maximum number of query parameters.
+	MaxQueryParams int
+
+	// MinUploadRate is the minimum average rate, in bytes per second, at
+	// which the client must send the request body once UploadGracePeriod
+	// has elapsed.
+	MinUploadRate int64
+
+	// UploadGracePeriod is the time a client may take before the minimum
+	// upload rate is enforced.
+	UploadGracePeriod time.Duration
+}
+
+// DefaultRequestLimitsConfig returns a request limits configuration with sensible defaults.
+func DefaultRequestLimitsConfig() RequestLimitsConfig {
+	return RequestLimitsConfig{
+		UploadGracePeriod: 5 * time.Second,
+	}
+}
+
+// requestLimitsMiddleware enforces request size limits and a minimum upload rate.
+type requestLimitsMiddleware struct {
+	config  RequestLimitsConfig
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+
+	now func() time.Time
+}
+
+// NewRequestLimitsMiddleware creates a new request limits middleware.
+func NewRequestLimitsMiddleware(
+	config RequestLimitsConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewRequestLimitsValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	return &requestLimitsMiddleware{
+		config:  config,
+		logger:  logger,
+		metrics: metrics,
+		now:     time.Now,
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *requestLimitsMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limit := m.checkHead(r); limit != "" {
+			m.reject(w, r, limit)
+			return
+		}
+
+		if !m.limitsBody() || r.Body == nil || r.Body == http.NoBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if m.config.MaxBodySize > 0 && r.ContentLength > m.config.MaxBodySize {
+			m.reject(w, r, LimitBodySize)
+			return
+		}
+
+		body := &limitedBody{
+			body:       r.Body,
+			config:     m.config,
+			controller: http.NewResponseController(w),
+			now:        m.now,
+			start:      m.now(),
+		}
+		r.Body = body
+
+		lw := &limitsResponseWriter{ResponseWriter: w, middleware: m, request: r, body: body}
+		next.ServeHTTP(lw, r)
+
+		if limit := body.violated(); limit != "" && !lw.wroteHeader {
+			m.reject(w, r, limit)
+		}
+	})
+}
+
+// limitsBody reports whether the request body needs to be wrapped.
+func (m *requestLimitsMiddleware) limitsBody() bool {
+	return m.config.MaxBodySize > 0 || m.config.MinUploadRate > 0
+}
+
+// checkHead checks the request line and headers. It returns the violated
+// limit, or "" when the request is within limits.
+func (m *requestLimitsMiddleware) checkHead(r *http.Request) string {
+	if m.config.MaxURLLength > 0 {
+		target := r.RequestURI
+		if target == "" {
+			target = r.URL.RequestURI()
+		}
+		if len(target) > m.config.MaxURLLength {
+			return LimitURLLength
+		}
+	}
+
+	if m.config.MaxQueryParams > 0 && countQueryParams(r.URL.RawQuery) > m.config.MaxQueryParams {
+		return LimitQueryParams
+	}
+
+	if m.config.MaxHeaderCount > 0 || m.config.MaxHeaderBytes > 0 {
+		count, size := 0, 0
+		for name, values := range r.Header {
+			for _, value := range values {
+				count++
+				// Account for ": " and CRLF as sent on the wire.
+				size += len(name) + len(value) + 4
+			}
+		}
+		if m.config.MaxHeaderCount > 0 && count > m.config.MaxHeaderCount {
+			return LimitHeaderCount
+		}
+		if m.config.MaxHeaderBytes > 0 && size > m.config.MaxHeaderBytes {
+			return LimitHeaderSize
+		}
+	}
+
+	return ""
+}
+
+// countQueryParams counts the parameters of a raw query string.
+func countQueryParams(rawQuery string) int {
+	count := 0
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param != "" {
+			count++
+		}
+	}
+	return count
+}
+
+// reject logs and records a violated limit and writes the matching error response.
+func (m *requestLimitsMiddleware) reject(w http.ResponseWriter, r *http.Request, limit string) {
+	route := m.config.Name
+	if route == "" {
+		route = normalizeRouteHost(r.Host)
+	}
+
+	if m.logger != nil {
+		m.logger.Warn(r.Context(), "Request limit exceeded",
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.String("route", route),
+			observability.String("limit", limit),
+			observability.String("method", r.Method),
+			observability.String("path", r.URL.Path),
+			observability.String("client_ip", getClientIP(r)),
+		)
+	}
+
+	if m.metrics != nil {
+		m.metrics.RecordRequestLimitExceeded(route, limit)
+	}
+
+	writeErrorResponse(w, r, limitError(limit))
+}
+
+// limitError returns the error response for a violated limit.
+func limitError(limit string) *proxyerrors.ProxyError {
+	var err *proxyerrors.ProxyError
+	switch limit {
+	case LimitURLLength, LimitQueryParams:
+		err = proxyerrors.WrapError(proxyerrors.ErrCodeRequestTooLarge, "request URI too long", nil).
+			WithHTTPStatus(http.StatusRequestURITooLong)
+	case LimitHeaderSize, LimitHeaderCount:
+		err = proxyerrors.WrapError(proxyerrors.ErrCodeRequestTooLarge, "request header fields too large", nil).
+			WithHTTPStatus(http.StatusRequestHeaderFieldsTooLarge)
+	case LimitUploadRate:
+		err = proxyerrors.WrapError(proxyerrors.ErrCodeRequestTimeout, "request body upload too slow", nil).
+			WithHTTPStatus(http.StatusRequestTimeout)
+	default:
+		err = proxyerrors.WrapError(proxyerrors.ErrCodeRequestTooLarge, "request body too large", nil)
+	}
+	return err.WithContext("limit", limit)
+}
+
+// limitedBody enforces the body size limit and minimum upload rate while
+// the request body is read. It may be read from a different goroutine than
+// the handler, so the violated limit is stored atomically.
+type limitedBody struct {
+	body       io.ReadCloser
+	config     RequestLimitsConfig
+	controller *http.ResponseController
+	now        func() time.Time
+	start      time.Time
+
+	read      int64
+	violation atomic.Value
+}
+
+// Read implements io.Reader.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if limit := b.violated(); limit != "" {
+		return 0, limitViolationError(limit)
+	}
+
+	if b.config.MaxBodySize > 0 {
+		if remaining := b.config.MaxBodySize - b.read + 1; int64(len(p)) > remaining {
+			p = p[:remaining]
+		}
+	}
+	if b.config.MinUploadRate > 0 {
+		_ = b.controller.SetReadDeadline(b.deadline())
+	}
+
+	n, err := b.body.Read(p)
+	b.read += int64(n)
+
+	switch {
+	case b.config.MaxBodySize > 0 && b.read > b.config.MaxBodySize:
+		return b.fail(n, LimitBodySize)
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return b.fail(n, LimitUploadRate)
+	case b.config.MinUploadRate > 0 && err == nil && b.now().After(b.deadline()):
+		return b.fail(n, LimitUploadRate)
+	}
+
+	if err == io.EOF && b.config.MinUploadRate > 0 {
+		_ = b.controller.SetReadDeadline(time.Time{})
+	}
+	return n, err
+}
+
+// Close implements io.Closer.
+func (b *limitedBody) Close() error {
+	if b.config.MinUploadRate > 0 {
+		_ = b.controller.SetReadDeadline(time.Time{})
+	}
+	return b.body.Close()
+}
+
+// deadline returns the time by which the next byte must have arrived to
+// keep the average upload rate above the minimum.
+func (b *limitedBody) deadline() time.Time {
+	allowed := float64(b.read+1) / float64(b.config.MinUploadRate) * float64(time.Second)
+	return b.start.Add(b.config.UploadGracePeriod + time.Duration(allowed))
+}
+
+// fail records a violated limit and returns its error.
+func (b *limitedBody) fail(n int, limit string) (int, error) {
+	b.violation.CompareAndSwap(nil, limit)
+	return n, limitViolationError(limit)
+}
+
+// violated returns the violated limit, or "" when the body is within limits.
+func (b *limitedBody) violated() string {
+	limit, _ := b.violation.Load().(string)
+	return limit
+}
+
+// limitViolationError returns the read error reported for a violated limit.
+func limitViolationError(limit string) error {
+	if limit == LimitUploadRate {
+		return ErrRequestUploadTooSlow
+	}
+	return ErrRequestBodyTooLarge
+}
+
+// limitsResponseWriter replaces the downstream response with the limit
+// error when the request body violated a limit before the response started.
+type limitsResponseWriter struct {
+	http.ResponseWriter
+	middleware *requestLimitsMiddleware
+	request    *http.Request
+	body       *limitedBody
+
+	wroteHeader bool
+	rejected    bool
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *limitsResponseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		if !w.rejected {
+			w.ResponseWriter.WriteHeader(code)
+		}
+		return
+	}
+	w.wroteHeader = true
+
+	if limit := w.body.violated(); limit != "" {
+		w.rejected = true
+		w.middleware.reject(w.ResponseWriter, w.request, limit)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write implements http.ResponseWriter.
+func (w *limitsResponseWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.rejected {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *limitsResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// RequestLimitsValidator validates request limits configuration.
+type RequestLimitsValidator struct{}
+
+// NewRequestLimitsValidator creates a new request limits configuration validator.
+func NewRequestLimitsValidator() *RequestLimitsValidator {
+	return &RequestLimitsValidator{}
+}
+
+// Validate validates the request limits configuration.
+func (v *RequestLimitsValidator) Validate(config RequestLimitsConfig) error {
+	limits := map[string]int64{
+		"max_body_size":    config.MaxBodySize,
+		"max_header_bytes": int64(config.MaxHeaderBytes),
+		"max_header_count": int64(config.MaxHeaderCount),
+		"max_url_length":   int64(config.MaxURLLength),
+		"max_query_params": int64(config.MaxQueryParams),
+		"min_upload_rate":  config.MinUploadRate,
+	}
+	for name, value := range limits {
+		if value < 0 {
+			return fmt.Errorf("%w: %s is %d", ErrInvalidRequestLimit, name, value)
+		}
+	}
+
+	if config.MinUploadRate > 0 && config.UploadGracePeriod <= 0 {
+		return ErrInvalidUploadGracePeriod
+	}
+
+	return nil
+}
+
+// Request limits errors.
+var (
+	ErrInvalidRequestLimit      = fmt.Errorf("request limits must not be negative")
+	ErrInvalidUploadGracePeriod = fmt.Errorf("upload grace period must be positive when a minimum upload rate is set")
+	ErrRequestBodyTooLarge      = fmt.Errorf("request body exceeds the maximum size")
+	ErrRequestUploadTooSlow     = fmt.Errorf("request body upload is below the minimum rate")
+)
@@ -0,0 +1,256 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/albedosehen/rwwwrse/internal/observability"
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+// newTestLimitsHandler wraps a handler that echoes the request body in a
+// request limits middleware.
+func newTestLimitsHandler(t *testing.T, config RequestLimitsConfig, metrics *testhelpers.MockMetricsCollector) (http.Handler, *requestLimitsMiddleware) {
+	t.Helper()
+
+	var collector observability.MetricsCollector
+	if metrics != nil {
+		collector = metrics
+	}
+	mw, err := NewRequestLimitsMiddleware(config, nil, collector)
+	require.NoError(t, err)
+
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			// Mirrors the reverse proxy reporting a failed upload.
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	}))
+	return handler, mw.(*requestLimitsMiddleware)
+}
+
+func TestRequestLimitsMiddleware_Limits(t *testing.T) {
+	manyHeaders := http.Header{}
+	for i := 0; i < 5; i++ {
+		manyHeaders.Add("X-Extra", "value")
+	}
+
+	tests := []struct {
+		name           string
+		config         RequestLimitsConfig
+		target         string
+		header         http.Header
+		body           string
+		chunked        bool
+		expectedStatus int
+		expectedLimit  string
+	}{
+		{
+			name:           "Limits_WithinAllLimits_Passes",
+			config:         RequestLimitsConfig{MaxBodySize: 16, MaxURLLength: 64, MaxQueryParams: 2, MaxHeaderCount: 4},
+			target:         "/upload?a=1&b=2",
+			body:           "hello",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Limits_LongURL_URITooLong",
+			config:         RequestLimitsConfig{MaxURLLength: 16},
+			target:         "/" + strings.Repeat("a", 32),
+			expectedStatus: http.StatusRequestURITooLong,
+			expectedLimit:  LimitURLLength,
+		},
+		{
+			name:           "Limits_TooManyQueryParams_URITooLong",
+			config:         RequestLimitsConfig{MaxQueryParams: 2},
+			target:         "/search?a=1&b=2&c=3",
+			expectedStatus: http.StatusRequestURITooLong,
+			expectedLimit:  LimitQueryParams,
+		},
+		{
+			name:           "Limits_TooManyHeaders_HeaderFieldsTooLarge",
+			config:         RequestLimitsConfig{MaxHeaderCount: 4},
+			target:         "/",
+			header:         manyHeaders,
+			expectedStatus: http.StatusRequestHeaderFieldsTooLarge,
+			expectedLimit:  LimitHeaderCount,
+		},
+		{
+			name:           "Limits_LargeHeaders_HeaderFieldsTooLarge",
+			config:         RequestLimitsConfig{MaxHeaderBytes: 64},
+			target:         "/",
+			header:         http.Header{"Cookie": {strings.Repeat("c", 128)}},
+			expectedStatus: http.StatusRequestHeaderFieldsTooLarge,
+			expectedLimit:  LimitHeaderSize,
+		},
+		{
+			name:           "Limits_DeclaredBodyTooLarge_EntityTooLarge",
+			config:         RequestLimitsConfig{MaxBodySize: 8},
+			target:         "/upload",
+			body:           strings.Repeat("a", 16),
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedLimit:  LimitBodySize,
+		},
+		{
+			name:           "Limits_ChunkedBodyTooLarge_EntityTooLarge",
+			config:         RequestLimitsConfig{MaxBodySize: 8},
+			target:         "/upload",
+			body:           strings.Repeat("a", 16),
+			chunked:        true,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedLimit:  LimitBodySize,
+		},
+		{
+			name:           "Limits_ChunkedBodyAtLimit_Passes",
+			config:         RequestLimitsConfig{MaxBodySize: 8},
+			target:         "/upload",
+			body:           strings.Repeat("a", 8),
+			chunked:        true,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			metrics := testhelpers.NewMockMetricsCollector()
+			if tt.expectedLimit != "" {
+				metrics.On("RecordRequestLimitExceeded", "example.com", tt.expectedLimit).Return().Once()
+			}
+			tt.config.Name = "example.com"
+			handler, _ := newTestLimitsHandler(t, tt.config, metrics)
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.body, rec.Body.String())
+			}
+			metrics.AssertExpectations(t)
+		})
+	}
+}
+
+// slowReader delivers one chunk per read and advances a fake clock.
+type slowReader struct {
+	chunks []string
+	clock  *time.Time
+	step   time.Duration
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	*r.clock = r.clock.Add(r.step)
+	n := copy(p, r.chunks[0])
+	r.chunks = r.chunks[1:]
+	return n, nil
+}
+
+func TestRequestLimitsMiddleware_MinUploadRate(t *testing.T) {
+	tests := []struct {
+		name           string
+		step           time.Duration
+		expectedStatus int
+	}{
+		{
+			name:           "MinUploadRate_FastClient_Passes",
+			step:           100 * time.Millisecond,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "MinUploadRate_SlowClient_RequestTimeout",
+			step:           3 * time.Second,
+			expectedStatus: http.StatusRequestTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			config := DefaultRequestLimitsConfig()
+			config.MinUploadRate = 100
+			config.UploadGracePeriod = 2 * time.Second
+			handler, mw := newTestLimitsHandler(t, config, nil)
+			mw.now = func() time.Time { return now }
+
+			chunks := []string{strings.Repeat("a", 100), strings.Repeat("b", 100), strings.Repeat("c", 100)}
+			body := &slowReader{chunks: chunks, clock: &now, step: tt.step}
+			req := httptest.NewRequest(http.MethodPost, "/upload", io.NopCloser(body))
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestRequestLimitsValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*RequestLimitsConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*RequestLimitsConfig) {},
+		},
+		{
+			name:        "Validate_NegativeBodySize_ReturnsError",
+			mutate:      func(c *RequestLimitsConfig) { c.MaxBodySize = -1 },
+			expectedErr: ErrInvalidRequestLimit,
+		},
+		{
+			name: "Validate_UploadRateWithoutGrace_ReturnsError",
+			mutate: func(c *RequestLimitsConfig) {
+				c.MinUploadRate = 1024
+				c.UploadGracePeriod = 0
+			},
+			expectedErr: ErrInvalidUploadGracePeriod,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultRequestLimitsConfig()
+			tt.mutate(&config)
+
+			// Act
+			err := NewRequestLimitsValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/albedosehen/rwwwrse/internal/observability"
+	"github.com/albedosehen/rwwwrse/internal/proxyproto"
 )
 
 // LoggingConfig holds configuration for logging middleware.
@@ -171,6 +172,7 @@ func (m *loggingMiddleware) logIncomingRequest(r *http.Request, requestID string
 		observability.String("path", r.URL.Path),
 		observability.String("query", r.URL.RawQuery),
 		observability.String("remote_addr", r.RemoteAddr),
+		observability.String("client_ip", getClientIP(r)),
 		observability.String("user_agent", r.Header.Get("User-Agent")),
 		observability.String("referer", r.Header.Get("Referer")),
 		observability.String("host", r.Host),
@@ -186,6 +188,20 @@ func (m *loggingMiddleware) logIncomingRequest(r *http.Request, requestID string
 		fields = append(fields, observability.String("x_real_ip", xrealip))
 	}
 
+	// Add PROXY protocol details reported by the load balancer
+	if header := proxyproto.FromContext(r.Context()); header != nil {
+		fields = append(fields, observability.Int("proxy_protocol_version", header.Version))
+		if vpce := header.AWSVPCEndpointID(); vpce != "" {
+			fields = append(fields, observability.String("aws_vpce_id", vpce))
+		}
+		if ssl := header.SSL(); ssl != nil && ssl.ClientSSL {
+			fields = append(fields,
+				observability.String("proxy_ssl_version", ssl.Version),
+				observability.String("proxy_ssl_cipher", ssl.Cipher),
+			)
+		}
+	}
+
 	// Log request body if enabled
 	if m.config.LogRequestBody && r.Body != nil && r.ContentLength > 0 && r.ContentLength <= m.config.MaxBodySize {
 		body, err := m.readAndReplaceBody(r)
@@ -274,6 +290,11 @@ func (rw *responseWriter) Write(data []byte) (int, error) {
 	return rw.ResponseWriter.Write(data)
 }
 
+// Unwrap returns the underlying writer for http.ResponseController.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Hijack implements http.Hijacker interface.
 func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
@@ -341,6 +362,7 @@ func (m *accessLogMiddleware) Wrap(next http.Handler) http.Handler {
 				observability.String("method", r.Method),
 				observability.String("path", r.URL.Path),
 				observability.String("remote_addr", r.RemoteAddr),
+				observability.String("client_ip", getClientIP(r)),
 				observability.Int("status", wrapped.statusCode),
 				observability.Duration("duration", duration),
 				observability.String("user_agent", r.Header.Get("User-Agent")),
@@ -368,6 +390,11 @@ func (rw *simpleResponseWriter) WriteHeader(statusCode int) {
 	rw.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Unwrap returns the underlying writer for http.ResponseController.
+func (rw *simpleResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Hijack implements http.Hijacker interface.
 func (rw *simpleResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	hijacker, ok := rw.ResponseWriter.(http.Hijacker)
@@ -214,7 +214,7 @@ func TestLoggingMiddleware_Wrap_ErrorRequest(t *testing.T) {
 			// Expect incoming request log - match any arguments after context and message
 			logger.On("Info", mock.MatchedBy(func(ctx context.Context) bool {
 				return true
-			}), "HTTP request received", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
+			}), "HTTP request received", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return()
 
 			// Expect log based on status code
 			switch tt.logLevel {
@@ -297,7 +297,7 @@ func TestLoggingMiddleware_Wrap_RequestWithBody(t *testing.T) {
 				"HTTP request received",
 				mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
 				mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything,
-				mock.Anything, // request_body field when enabled
+				mock.Anything, mock.Anything, // request_body field when enabled
 			).Maybe().Return()
 
 			// Expect Info log for request completion
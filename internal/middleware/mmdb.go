@@ -0,0 +1,395 @@
+// Package middleware implements a reader for MaxMind DB (.mmdb) files.
+package middleware
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// MaxMind DB format constants.
+const (
+	// mmdbMetadataMarker precedes the metadata section at the end of the file.
+	mmdbMetadataMarker = "\xAB\xCD\xEFMaxMind.com"
+
+	// mmdbDataSectionSeparator is the size of the zero padding after the search tree.
+	mmdbDataSectionSeparator = 16
+
+	// mmdbMaxDepth bounds pointer and container nesting while decoding.
+	mmdbMaxDepth = 32
+)
+
+// MaxMind DB data field types.
+const (
+	mmdbTypeExtended = iota
+	mmdbTypePointer
+	mmdbTypeString
+	mmdbTypeDouble
+	mmdbTypeBytes
+	mmdbTypeUint16
+	mmdbTypeUint32
+	mmdbTypeMap
+	mmdbTypeInt32
+	mmdbTypeUint64
+	mmdbTypeUint128
+	mmdbTypeArray
+	mmdbTypeContainer
+	mmdbTypeEndMarker
+	mmdbTypeBool
+	mmdbTypeFloat
+)
+
+// mmdbReader performs lookups in an in-memory MaxMind DB file.
+type mmdbReader struct {
+	buffer     []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+	dbType     string
+}
+
+// openMMDB reads and parses a MaxMind DB file.
+func openMMDB(path string) (*mmdbReader, error) {
+	buffer, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GeoIP database: %w", err)
+	}
+	return newMMDBReader(buffer)
+}
+
+// newMMDBReader parses a MaxMind DB from memory.
+func newMMDBReader(buffer []byte) (*mmdbReader, error) {
+	markerIndex := bytes.LastIndex(buffer, []byte(mmdbMetadataMarker))
+	if markerIndex == -1 {
+		return nil, fmt.Errorf("invalid GeoIP database: metadata marker not found")
+	}
+
+	metadataStart := markerIndex + len(mmdbMetadataMarker)
+	metadataDecoder := mmdbDecoder{buffer: buffer[metadataStart:]}
+	value, _, err := metadataDecoder.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GeoIP database metadata: %w", err)
+	}
+
+	metadata, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid GeoIP database metadata: expected map")
+	}
+
+	reader := &mmdbReader{
+		buffer:     buffer,
+		nodeCount:  uint(mmdbUint(metadata["node_count"])),
+		recordSize: uint(mmdbUint(metadata["record_size"])),
+		ipVersion:  uint(mmdbUint(metadata["ip_version"])),
+	}
+	reader.dbType, _ = metadata["database_type"].(string)
+
+	switch reader.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("invalid GeoIP database: unsupported record size %d", reader.recordSize)
+	}
+
+	treeSize := reader.nodeCount * reader.recordSize / 4
+	dataStart := treeSize + mmdbDataSectionSeparator
+	if dataStart > uint(markerIndex) {
+		return nil, fmt.Errorf("invalid GeoIP database: search tree exceeds file size")
+	}
+	reader.data = buffer[dataStart:markerIndex]
+
+	// IPv4 addresses live under ::/96 in IPv6 databases.
+	if reader.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < reader.nodeCount; i++ {
+			node, err = reader.readRecord(node, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		reader.ipv4Start = node
+	}
+
+	return reader, nil
+}
+
+// lookup returns the data record for ip, or nil if the address is not in the database.
+func (r *mmdbReader) lookup(ip net.IP) (any, error) {
+	var address []byte
+	node := uint(0)
+
+	if ip4 := ip.To4(); ip4 != nil {
+		address = ip4
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else {
+		if r.ipVersion == 4 {
+			return nil, nil
+		}
+		address = ip.To16()
+		if address == nil {
+			return nil, fmt.Errorf("invalid IP address")
+		}
+	}
+
+	bitCount := uint(len(address) * 8)
+	for i := uint(0); i < bitCount && node < r.nodeCount; i++ {
+		bit := uint(address[i>>3]>>(7-(i%8))) & 1
+		next, err := r.readRecord(node, bit)
+		if err != nil {
+			return nil, err
+		}
+		node = next
+	}
+
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, fmt.Errorf("invalid GeoIP database: search tree is too deep")
+	}
+
+	offset := node - r.nodeCount - mmdbDataSectionSeparator
+	if offset >= uint(len(r.data)) {
+		return nil, fmt.Errorf("invalid GeoIP database: data pointer out of range")
+	}
+
+	decoder := mmdbDecoder{buffer: r.data}
+	value, _, err := decoder.decode(offset, 0)
+	return value, err
+}
+
+// country returns the ISO country code for ip, or "" if unknown.
+func (r *mmdbReader) country(ip net.IP) (string, error) {
+	record, err := r.lookup(ip)
+	if err != nil || record == nil {
+		return "", err
+	}
+
+	fields, ok := record.(map[string]any)
+	if !ok {
+		return "", nil
+	}
+
+	for _, key := range []string{"country", "registered_country"} {
+		if country, ok := fields[key].(map[string]any); ok {
+			if code, ok := country["iso_code"].(string); ok && code != "" {
+				return code, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// readRecord returns the left (bit 0) or right (bit 1) record of a search tree node.
+func (r *mmdbReader) readRecord(node, bit uint) (uint, error) {
+	nodeSize := r.recordSize / 4
+	offset := node * nodeSize
+	if offset+nodeSize > uint(len(r.buffer)) {
+		return 0, fmt.Errorf("invalid GeoIP database: node %d out of range", node)
+	}
+	b := r.buffer[offset : offset+nodeSize]
+
+	switch r.recordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5]), nil
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b[0:4])), nil
+		}
+		return uint(binary.BigEndian.Uint32(b[4:8])), nil
+	}
+}
+
+// mmdbDecoder decodes values from a MaxMind DB data section.
+type mmdbDecoder struct {
+	buffer []byte
+}
+
+// decode decodes the value at offset and returns it with the offset of the next value.
+func (d *mmdbDecoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("maximum data depth exceeded")
+	}
+
+	typeNum, size, offset, err := d.decodeControl(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typeNum == mmdbTypePointer {
+		pointer, next, err := d.decodePointer(size, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	switch typeNum {
+	case mmdbTypeMap:
+		result := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is not a string")
+			}
+			value, after, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result[name] = value
+			offset = after
+		}
+		return result, offset, nil
+	case mmdbTypeArray:
+		result := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result = append(result, value)
+			offset = next
+		}
+		return result, offset, nil
+	case mmdbTypeBool:
+		return size != 0, offset, nil
+	}
+
+	end := offset + size
+	if end > uint(len(d.buffer)) {
+		return nil, 0, fmt.Errorf("value at offset %d exceeds data section", offset)
+	}
+	raw := d.buffer[offset:end]
+
+	switch typeNum {
+	case mmdbTypeString:
+		return string(raw), end, nil
+	case mmdbTypeBytes, mmdbTypeUint128:
+		return append([]byte(nil), raw...), end, nil
+	case mmdbTypeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), end, nil
+	case mmdbTypeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), end, nil
+	case mmdbTypeUint16, mmdbTypeUint32, mmdbTypeUint64:
+		var value uint64
+		for _, b := range raw {
+			value = value<<8 | uint64(b)
+		}
+		return value, end, nil
+	case mmdbTypeInt32:
+		var value uint32
+		for _, b := range raw {
+			value = value<<8 | uint32(b)
+		}
+		return int64(int32(value)), end, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typeNum)
+	}
+}
+
+// decodeControl decodes a control byte, returning the type, payload size and payload offset.
+func (d *mmdbDecoder) decodeControl(offset uint) (int, uint, uint, error) {
+	if offset >= uint(len(d.buffer)) {
+		return 0, 0, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+	}
+
+	ctrl := d.buffer[offset]
+	offset++
+
+	typeNum := int(ctrl >> 5)
+	if typeNum == mmdbTypePointer {
+		return typeNum, uint(ctrl & 0x1F), offset, nil
+	}
+
+	if typeNum == mmdbTypeExtended {
+		if offset >= uint(len(d.buffer)) {
+			return 0, 0, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+		}
+		typeNum = int(d.buffer[offset]) + 7
+		offset++
+	}
+
+	size := uint(ctrl & 0x1F)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(d.buffer)) {
+			return 0, 0, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+		}
+		var value uint
+		for _, b := range d.buffer[offset : offset+extra] {
+			value = value<<8 | uint(b)
+		}
+		switch extra {
+		case 1:
+			size = 29 + value
+		case 2:
+			size = 285 + value
+		default:
+			size = 65821 + value
+		}
+		offset += extra
+	}
+
+	return typeNum, size, offset, nil
+}
+
+// decodePointer decodes a pointer whose control bits are ctrl.
+func (d *mmdbDecoder) decodePointer(ctrl, offset uint) (uint, uint, error) {
+	pointerSize := ((ctrl >> 3) & 0x3) + 1
+	if offset+pointerSize > uint(len(d.buffer)) {
+		return 0, 0, fmt.Errorf("unexpected end of data at offset %d", offset)
+	}
+
+	var prefix uint
+	if pointerSize != 4 {
+		prefix = ctrl & 0x7
+	}
+
+	value := prefix
+	for _, b := range d.buffer[offset : offset+pointerSize] {
+		value = value<<8 | uint(b)
+	}
+
+	switch pointerSize {
+	case 2:
+		value += 2048
+	case 3:
+		value += 526336
+	}
+
+	return value, offset + pointerSize, nil
+}
+
+// mmdbUint converts a decoded unsigned integer to uint64.
+func mmdbUint(value any) uint64 {
+	if v, ok := value.(uint64); ok {
+		return v
+	}
+	return 0
+}
@@ -0,0 +1,939 @@
+// Package middleware implements an OpenID Connect relying party for browser apps.
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// OIDC flow constants.
+const (
+	// oidcStateCookieSuffix is appended to the session cookie name for the login state cookie.
+	oidcStateCookieSuffix = "_state"
+
+	// oidcLoginTimeout bounds how long a login round trip to the provider may take.
+	oidcLoginTimeout = 10 * time.Minute
+
+	// oidcRefreshSkew refreshes tokens slightly before they expire.
+	oidcRefreshSkew = 30 * time.Second
+
+	// oidcDefaultTokenLifetime is used when the provider does not report an expiry.
+	oidcDefaultTokenLifetime = time.Hour
+
+	// oidcDiscoveryRetryInterval is how long a failed discovery is reported
+	// before the provider is asked again.
+	oidcDiscoveryRetryInterval = 5 * time.Second
+)
+
+// OIDCConfig holds configuration for the OpenID Connect middleware.
+type OIDCConfig struct {
+	// IssuerURL is the provider issuer used for discovery and token validation.
+	IssuerURL string
+
+	// ClientID and ClientSecret identify this relying party at the provider.
+	ClientID     string
+	ClientSecret string
+
+	// RedirectURL is the absolute callback URL. When empty it is derived from
+	// the request host and CallbackPath.
+	RedirectURL string
+
+	// CallbackPath is the path that receives the authorization response.
+	CallbackPath string
+
+	// LogoutPath clears the session and ends the provider session if
+	// supported. It only accepts POST, so a cross-site link or image cannot
+	// log users out.
+	LogoutPath string
+
+	// PostLogoutRedirectURL is where users land after logout.
+	PostLogoutRedirectURL string
+
+	// Scopes requested from the provider. "openid" is always included.
+	Scopes []string
+
+	// CookieName is the name of the encrypted session cookie.
+	CookieName string
+
+	// CookieSecret is used to derive the session encryption key.
+	CookieSecret string
+
+	// CookieDomain optionally scopes the session cookie to a parent domain.
+	CookieDomain string
+
+	// CookieSecure marks session cookies as Secure.
+	CookieSecure bool
+
+	// SessionTTL is the maximum lifetime of a session, regardless of refreshes.
+	SessionTTL time.Duration
+
+	// GroupsClaim is the ID token claim holding group membership. Dotted paths
+	// such as "realm_access.roles" are supported.
+	GroupsClaim string
+
+	// AllowedEmailDomains, AllowedGroups and AllowedUsers restrict access.
+	// A user is admitted if any rule matches; with no rules every
+	// authenticated user is admitted.
+	AllowedEmailDomains []string
+	AllowedGroups       []string
+	AllowedUsers        []string
+
+	// UserHeader, EmailHeader and GroupsHeader name the identity headers
+	// injected into upstream requests.
+	UserHeader   string
+	EmailHeader  string
+	GroupsHeader string
+
+	// HTTPClient is used for discovery, JWKS and token requests.
+	HTTPClient *http.Client
+}
+
+// DefaultOIDCConfig returns an OIDC configuration with default paths and headers.
+func DefaultOIDCConfig() OIDCConfig {
+	return OIDCConfig{
+		CallbackPath: "/oauth2/callback",
+		LogoutPath:   "/oauth2/logout",
+		Scopes:       []string{"openid", "email", "profile"},
+		CookieName:   "_rwwwrse_oidc",
+		CookieSecure: true,
+		SessionTTL:   24 * time.Hour,
+		GroupsClaim:  "groups",
+		UserHeader:   "X-Auth-Request-User",
+		EmailHeader:  "X-Auth-Request-Email",
+		GroupsHeader: "X-Auth-Request-Groups",
+	}
+}
+
+// oidcProviderMetadata holds the discovered provider endpoints.
+type oidcProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+// oidcLoginState is stored in a short-lived cookie during the login round trip.
+type oidcLoginState struct {
+	State        string `json:"s"`
+	Nonce        string `json:"n"`
+	CodeVerifier string `json:"v"`
+	ReturnTo     string `json:"r"`
+}
+
+// oidcSession is the authenticated session stored in the encrypted cookie.
+type oidcSession struct {
+	Subject      string    `json:"sub"`
+	Email        string    `json:"email,omitempty"`
+	Username     string    `json:"user,omitempty"`
+	Groups       []string  `json:"groups,omitempty"`
+	RefreshToken string    `json:"rt,omitempty"`
+	IDToken      string    `json:"idt,omitempty"`
+	Expiry       time.Time `json:"exp"`
+	CreatedAt    time.Time `json:"iat"`
+}
+
+// oidcTokenResponse is the token endpoint response.
+type oidcTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Error        string `json:"error"`
+	ErrorDesc    string `json:"error_description"`
+}
+
+// oidcMiddleware implements the OpenID Connect authorization code flow with PKCE.
+type oidcMiddleware struct {
+	config  OIDCConfig
+	sealer  *cookieSealer
+	cookies cookieOptions
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+
+	mu                sync.Mutex
+	provider          *oidcProviderMetadata
+	jwks              *jwksCache
+	discoveryErr      error
+	discoveryFailedAt time.Time
+	discovery         singleflight.Group
+}
+
+// NewOIDCMiddleware creates a new OpenID Connect relying party middleware.
+func NewOIDCMiddleware(
+	config OIDCConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	defaults := DefaultOIDCConfig()
+	if config.IssuerURL == "" {
+		return nil, fmt.Errorf("OIDC issuer URL is required")
+	}
+	if config.ClientID == "" {
+		return nil, fmt.Errorf("OIDC client ID is required")
+	}
+	if config.CallbackPath == "" {
+		config.CallbackPath = defaults.CallbackPath
+	}
+	if config.LogoutPath == "" {
+		config.LogoutPath = defaults.LogoutPath
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = defaults.Scopes
+	}
+	if !containsString(config.Scopes, "openid") {
+		config.Scopes = append([]string{"openid"}, config.Scopes...)
+	}
+	if config.CookieName == "" {
+		config.CookieName = defaults.CookieName
+	}
+	if config.SessionTTL <= 0 {
+		config.SessionTTL = defaults.SessionTTL
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = defaults.GroupsClaim
+	}
+	if config.UserHeader == "" {
+		config.UserHeader = defaults.UserHeader
+	}
+	if config.EmailHeader == "" {
+		config.EmailHeader = defaults.EmailHeader
+	}
+	if config.GroupsHeader == "" {
+		config.GroupsHeader = defaults.GroupsHeader
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	sealer, err := newCookieSealer(config.CookieSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &oidcMiddleware{
+		config: config,
+		sealer: sealer,
+		cookies: cookieOptions{
+			Domain:   config.CookieDomain,
+			Secure:   config.CookieSecure,
+			SameSite: http.SameSiteLaxMode,
+		},
+		logger:  logger,
+		metrics: metrics,
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *oidcMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case m.config.CallbackPath:
+			m.handleCallback(w, r)
+			return
+		case m.config.LogoutPath:
+			m.handleLogout(w, r)
+			return
+		}
+
+		// Identity headers are only trusted when set by this middleware.
+		r.Header.Del(m.config.UserHeader)
+		r.Header.Del(m.config.EmailHeader)
+		r.Header.Del(m.config.GroupsHeader)
+
+		session, ok := m.loadSession(w, r)
+		if !ok {
+			m.handleUnauthenticated(w, r)
+			return
+		}
+
+		if !m.isAuthorized(session) {
+			m.deny(w, r, session)
+			return
+		}
+
+		m.setIdentityHeaders(r, session)
+		next.ServeHTTP(w, markAuthenticated(r))
+	})
+}
+
+// loadSession decodes the session cookie, refreshing tokens when they are about to expire.
+func (m *oidcMiddleware) loadSession(w http.ResponseWriter, r *http.Request) (*oidcSession, bool) {
+	cookie, err := r.Cookie(m.config.CookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, false
+	}
+
+	var session oidcSession
+	if err := m.sealer.open(m.config.CookieName, cookie.Value, &session); err != nil {
+		m.logDebug(r, "Discarding invalid OIDC session cookie", observability.Error(err))
+		return nil, false
+	}
+
+	now := time.Now()
+	if now.After(session.CreatedAt.Add(m.config.SessionTTL)) {
+		return nil, false
+	}
+
+	if now.Add(oidcRefreshSkew).Before(session.Expiry) {
+		return &session, true
+	}
+
+	if session.RefreshToken == "" {
+		return nil, false
+	}
+
+	refreshed, err := m.refreshSession(r.Context(), &session)
+	if err != nil {
+		if m.logger != nil {
+			m.logger.Warn(r.Context(), "OIDC token refresh failed",
+				observability.String("request_id", GetRequestID(r.Context())),
+				observability.String("subject", session.Subject),
+				observability.Error(err),
+			)
+		}
+		return nil, false
+	}
+
+	if err := m.writeSession(w, refreshed); err != nil {
+		m.logDebug(r, "Failed to store refreshed OIDC session", observability.Error(err))
+	}
+
+	return refreshed, true
+}
+
+// handleUnauthenticated starts a login for navigations and rejects other requests.
+func (m *oidcMiddleware) handleUnauthenticated(w http.ResponseWriter, r *http.Request) {
+	if (r.Method != http.MethodGet && r.Method != http.MethodHead) ||
+		r.Header.Get("X-Requested-With") == "XMLHttpRequest" {
+		writeErrorResponse(w, r, proxyerrors.NewSecurityError(
+			proxyerrors.ErrCodeUnauthorized,
+			"authentication required",
+			nil,
+		))
+		return
+	}
+
+	m.startLogin(w, r)
+}
+
+// startLogin redirects the browser to the provider's authorization endpoint.
+func (m *oidcMiddleware) startLogin(w http.ResponseWriter, r *http.Request) {
+	provider, err := m.discover(r.Context())
+	if err != nil {
+		m.providerUnavailable(w, r, err)
+		return
+	}
+
+	state := oidcLoginState{
+		State:        randomToken(32),
+		Nonce:        randomToken(32),
+		CodeVerifier: randomToken(32),
+		ReturnTo:     safeReturnPath(r.URL.RequestURI()),
+	}
+
+	sealed, err := m.sealer.seal(m.stateCookieName(), state)
+	if err != nil {
+		m.providerUnavailable(w, r, err)
+		return
+	}
+	http.SetCookie(w, m.cookies.newCookie(m.stateCookieName(), sealed, oidcLoginTimeout))
+
+	challenge := sha256.Sum256([]byte(state.CodeVerifier))
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", m.config.ClientID)
+	query.Set("redirect_uri", m.redirectURL(r))
+	query.Set("scope", strings.Join(m.config.Scopes, " "))
+	query.Set("state", state.State)
+	query.Set("nonce", state.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	authURL, err := url.Parse(provider.AuthorizationEndpoint)
+	if err != nil {
+		m.providerUnavailable(w, r, err)
+		return
+	}
+	authURL.RawQuery = mergeQuery(authURL.Query(), query).Encode()
+
+	m.logDebug(r, "Redirecting to OIDC provider for login",
+		observability.String("return_to", state.ReturnTo),
+	)
+
+	http.Redirect(w, r, authURL.String(), http.StatusFound)
+}
+
+// handleCallback completes the authorization code flow.
+func (m *oidcMiddleware) handleCallback(w http.ResponseWriter, r *http.Request) {
+	stateCookie, err := r.Cookie(m.stateCookieName())
+	if err != nil {
+		m.rejectCallback(w, r, "missing login state", nil)
+		return
+	}
+	http.SetCookie(w, m.cookies.expiredCookie(m.stateCookieName()))
+
+	var state oidcLoginState
+	if err := m.sealer.open(m.stateCookieName(), stateCookie.Value, &state); err != nil {
+		m.rejectCallback(w, r, "invalid login state", err)
+		return
+	}
+
+	query := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state.State)) != 1 {
+		m.rejectCallback(w, r, "state mismatch", nil)
+		return
+	}
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		m.rejectCallback(w, r, "provider returned error", fmt.Errorf("%s: %s", providerErr, query.Get("error_description")))
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		m.rejectCallback(w, r, "missing authorization code", nil)
+		return
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", m.redirectURL(r))
+	form.Set("code_verifier", state.CodeVerifier)
+
+	tokens, err := m.tokenRequest(r.Context(), form)
+	if err != nil {
+		m.rejectCallback(w, r, "token exchange failed", err)
+		return
+	}
+
+	session, err := m.sessionFromTokens(r.Context(), tokens, nil, state.Nonce)
+	if err != nil {
+		m.rejectCallback(w, r, "ID token validation failed", err)
+		return
+	}
+
+	if !m.isAuthorized(session) {
+		m.deny(w, r, session)
+		return
+	}
+
+	if err := m.writeSession(w, session); err != nil {
+		m.rejectCallback(w, r, "failed to store session", err)
+		return
+	}
+
+	if m.logger != nil {
+		m.logger.Info(r.Context(), "OIDC login completed",
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.String("subject", session.Subject),
+			observability.String("email", session.Email),
+		)
+	}
+
+	http.Redirect(w, r, state.ReturnTo, http.StatusFound)
+}
+
+// handleLogout clears the session and ends the provider session when supported.
+func (m *oidcMiddleware) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, "Method not allowed", nil).
+			WithHTTPStatus(http.StatusMethodNotAllowed))
+		return
+	}
+
+	var session oidcSession
+	if cookie, err := r.Cookie(m.config.CookieName); err == nil {
+		_ = m.sealer.open(m.config.CookieName, cookie.Value, &session)
+	}
+
+	http.SetCookie(w, m.cookies.expiredCookie(m.config.CookieName))
+
+	target := m.config.PostLogoutRedirectURL
+	if target == "" {
+		target = "/"
+	}
+
+	if provider, err := m.discover(r.Context()); err == nil && provider.EndSessionEndpoint != "" {
+		if endSession, err := url.Parse(provider.EndSessionEndpoint); err == nil {
+			query := endSession.Query()
+			query.Set("client_id", m.config.ClientID)
+			if session.IDToken != "" {
+				query.Set("id_token_hint", session.IDToken)
+			}
+			if m.config.PostLogoutRedirectURL != "" {
+				query.Set("post_logout_redirect_uri", m.config.PostLogoutRedirectURL)
+			}
+			endSession.RawQuery = query.Encode()
+			target = endSession.String()
+		}
+	}
+
+	if m.logger != nil {
+		m.logger.Info(r.Context(), "OIDC logout",
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.String("subject", session.Subject),
+		)
+	}
+
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// refreshSession uses the refresh token to obtain fresh tokens.
+func (m *oidcMiddleware) refreshSession(ctx context.Context, session *oidcSession) (*oidcSession, error) {
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", session.RefreshToken)
+
+	tokens, err := m.tokenRequest(ctx, form)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.sessionFromTokens(ctx, tokens, session, "")
+}
+
+// sessionFromTokens builds a session from a token response. When previous is
+// set, identity is carried over if the response omits an ID token.
+func (m *oidcMiddleware) sessionFromTokens(
+	ctx context.Context,
+	tokens *oidcTokenResponse,
+	previous *oidcSession,
+	nonce string,
+) (*oidcSession, error) {
+	now := time.Now()
+	session := &oidcSession{CreatedAt: now}
+	if previous != nil {
+		*session = *previous
+	}
+
+	switch {
+	case tokens.IDToken != "":
+		claims, err := m.verifyIDToken(ctx, tokens.IDToken, nonce)
+		if err != nil {
+			return nil, err
+		}
+		if previous != nil && claims.string("sub") != previous.Subject {
+			return nil, fmt.Errorf("refreshed ID token subject does not match session")
+		}
+		session.Subject = claims.string("sub")
+		session.Email = claims.string("email")
+		session.Username = claims.string("preferred_username")
+		session.Groups = claimStrings(claims.lookup(m.config.GroupsClaim))
+		session.IDToken = tokens.IDToken
+		if verified, present := claims.bool("email_verified"); present && !verified {
+			session.Email = ""
+		}
+		if exp, ok := claims.time("exp"); ok {
+			session.Expiry = exp
+		}
+	case previous == nil:
+		return nil, fmt.Errorf("token response did not include an ID token")
+	}
+
+	if tokens.ExpiresIn > 0 {
+		session.Expiry = now.Add(time.Duration(tokens.ExpiresIn) * time.Second)
+	} else if session.Expiry.Before(now) {
+		session.Expiry = now.Add(oidcDefaultTokenLifetime)
+	}
+
+	if tokens.RefreshToken != "" {
+		session.RefreshToken = tokens.RefreshToken
+	}
+
+	return session, nil
+}
+
+// verifyIDToken validates the signature and standard claims of an ID token.
+func (m *oidcMiddleware) verifyIDToken(ctx context.Context, raw, nonce string) (jwtClaims, error) {
+	provider, err := m.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := parseJWT(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	jwks := m.jwks
+	m.mu.Unlock()
+
+	key, err := jwks.key(ctx, token.header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := token.verifySignature(key); err != nil {
+		return nil, err
+	}
+
+	claims := token.claims
+	if claims.string("iss") != provider.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.string("iss"))
+	}
+
+	if !claims.hasAudience(m.config.ClientID) {
+		return nil, fmt.Errorf("token audience does not include client ID")
+	}
+
+	if err := claims.validateTimes(time.Now()); err != nil {
+		return nil, err
+	}
+
+	if nonce != "" && subtle.ConstantTimeCompare([]byte(claims.string("nonce")), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("nonce mismatch")
+	}
+
+	if claims.string("sub") == "" {
+		return nil, fmt.Errorf("token has no subject")
+	}
+
+	return claims, nil
+}
+
+// tokenRequest posts a grant to the provider's token endpoint.
+func (m *oidcMiddleware) tokenRequest(ctx context.Context, form url.Values) (*oidcTokenResponse, error) {
+	provider, err := m.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if m.config.ClientSecret == "" {
+		form.Set("client_id", m.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if m.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(m.config.ClientID), url.QueryEscape(m.config.ClientSecret))
+	}
+
+	resp, err := m.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokens oidcTokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK || tokens.Error != "" {
+		return nil, fmt.Errorf("token endpoint returned status %d: %s %s", resp.StatusCode, tokens.Error, tokens.ErrorDesc)
+	}
+
+	return &tokens, nil
+}
+
+// discover fetches and caches the provider metadata. Concurrent callers
+// share one request, made without holding m.mu, and a failure is reported
+// for oidcDiscoveryRetryInterval before the provider is asked again.
+func (m *oidcMiddleware) discover(ctx context.Context) (*oidcProviderMetadata, error) {
+	if provider, ok, err := m.cachedDiscovery(); ok {
+		return provider, err
+	}
+
+	result, err, _ := m.discovery.Do("discover", func() (interface{}, error) {
+		// A flight that finished since the check above may have cached a result.
+		if provider, ok, err := m.cachedDiscovery(); ok {
+			return provider, err
+		}
+
+		// The shared request must not fail because the first caller went away.
+		metadata, err := m.fetchDiscovery(context.WithoutCancel(ctx))
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if err != nil {
+			m.discoveryErr = err
+			m.discoveryFailedAt = time.Now()
+			return nil, err
+		}
+
+		m.provider = metadata
+		m.jwks = newJWKSCache(metadata.JWKSURI, m.config.HTTPClient)
+		m.discoveryErr = nil
+		return metadata, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result.(*oidcProviderMetadata), nil
+}
+
+// cachedDiscovery returns the discovered metadata, or the last failure while
+// it is recent. ok is false when the provider should be asked.
+func (m *oidcMiddleware) cachedDiscovery() (*oidcProviderMetadata, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.provider != nil {
+		return m.provider, true, nil
+	}
+	if m.discoveryErr != nil && time.Since(m.discoveryFailedAt) < oidcDiscoveryRetryInterval {
+		return nil, true, m.discoveryErr
+	}
+	return nil, false, nil
+}
+
+// fetchDiscovery requests and validates the provider's discovery document.
+func (m *oidcMiddleware) fetchDiscovery(ctx context.Context) (*oidcProviderMetadata, error) {
+	issuer := strings.TrimSuffix(m.config.IssuerURL, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create discovery request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := m.config.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OIDC discovery failed: status %d", resp.StatusCode)
+	}
+
+	var metadata oidcProviderMetadata
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("invalid OIDC discovery document: %w", err)
+	}
+
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovered issuer %q does not match configured issuer", metadata.Issuer)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document is missing required endpoints")
+	}
+
+	return &metadata, nil
+}
+
+// isAuthorized applies the route's access rules to the session identity.
+func (m *oidcMiddleware) isAuthorized(session *oidcSession) bool {
+	if len(m.config.AllowedUsers) == 0 && len(m.config.AllowedEmailDomains) == 0 && len(m.config.AllowedGroups) == 0 {
+		return true
+	}
+
+	for _, user := range m.config.AllowedUsers {
+		if strings.EqualFold(user, session.Email) ||
+			strings.EqualFold(user, session.Username) ||
+			user == session.Subject {
+			return true
+		}
+	}
+
+	if at := strings.LastIndex(session.Email, "@"); at != -1 {
+		domain := session.Email[at+1:]
+		for _, allowed := range m.config.AllowedEmailDomains {
+			if strings.EqualFold(strings.TrimPrefix(allowed, "@"), domain) {
+				return true
+			}
+		}
+	}
+
+	for _, group := range session.Groups {
+		if containsString(m.config.AllowedGroups, group) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setIdentityHeaders injects the authenticated identity into the upstream request.
+func (m *oidcMiddleware) setIdentityHeaders(r *http.Request, session *oidcSession) {
+	user := session.Username
+	if user == "" {
+		user = session.Subject
+	}
+
+	r.Header.Set(m.config.UserHeader, user)
+	if session.Email != "" {
+		r.Header.Set(m.config.EmailHeader, session.Email)
+	}
+	if len(session.Groups) > 0 {
+		r.Header.Set(m.config.GroupsHeader, strings.Join(session.Groups, ","))
+	}
+}
+
+// writeSession seals the session into the session cookie, dropping the ID
+// token hint if the cookie would otherwise exceed browser limits.
+func (m *oidcMiddleware) writeSession(w http.ResponseWriter, session *oidcSession) error {
+	sealed, err := m.sealer.seal(m.config.CookieName, session)
+	if err != nil {
+		return err
+	}
+
+	if len(sealed) > maxCookieValueSize && session.IDToken != "" {
+		trimmed := *session
+		trimmed.IDToken = ""
+		if sealed, err = m.sealer.seal(m.config.CookieName, &trimmed); err != nil {
+			return err
+		}
+	}
+
+	if len(sealed) > maxCookieValueSize {
+		return fmt.Errorf("session cookie exceeds %d bytes", maxCookieValueSize)
+	}
+
+	ttl := time.Until(session.CreatedAt.Add(m.config.SessionTTL))
+	http.SetCookie(w, m.cookies.newCookie(m.config.CookieName, sealed, ttl))
+	return nil
+}
+
+// deny rejects an authenticated user that does not satisfy the access rules.
+func (m *oidcMiddleware) deny(w http.ResponseWriter, r *http.Request, session *oidcSession) {
+	if m.logger != nil {
+		m.logger.Warn(r.Context(), "OIDC access denied",
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.String("subject", session.Subject),
+			observability.String("email", session.Email),
+			observability.String("host", r.Host),
+			observability.String("path", r.URL.Path),
+		)
+	}
+
+	writeErrorResponse(w, r, proxyerrors.NewSecurityError(
+		proxyerrors.ErrCodeAccessDenied,
+		"user not permitted",
+		nil,
+	))
+}
+
+// rejectCallback fails a login callback with 401.
+func (m *oidcMiddleware) rejectCallback(w http.ResponseWriter, r *http.Request, reason string, cause error) {
+	if m.logger != nil {
+		fields := []observability.Field{
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.String("reason", reason),
+		}
+		if cause != nil {
+			fields = append(fields, observability.Error(cause))
+		}
+		m.logger.Warn(r.Context(), "OIDC login rejected", fields...)
+	}
+
+	writeErrorResponse(w, r, proxyerrors.NewSecurityError(
+		proxyerrors.ErrCodeUnauthorized,
+		reason,
+		nil,
+	))
+}
+
+// providerUnavailable reports that the identity provider could not be reached.
+func (m *oidcMiddleware) providerUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	if m.logger != nil {
+		m.logger.Error(r.Context(), err, "OIDC provider unavailable",
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.String("issuer", m.config.IssuerURL),
+		)
+	}
+
+	writeErrorResponse(w, r, proxyerrors.WrapError(
+		proxyerrors.ErrCodeServiceUnavailable,
+		"identity provider unavailable",
+		err,
+	))
+}
+
+// redirectURL returns the callback URL registered with the provider.
+func (m *oidcMiddleware) redirectURL(r *http.Request) string {
+	if m.config.RedirectURL != "" {
+		return m.config.RedirectURL
+	}
+
+	return getRequestScheme(r) + "://" + r.Host + m.config.CallbackPath
+}
+
+// stateCookieName returns the name of the login state cookie.
+func (m *oidcMiddleware) stateCookieName() string {
+	return m.config.CookieName + oidcStateCookieSuffix
+}
+
+// logDebug logs a debug message with the request ID when a logger is configured.
+func (m *oidcMiddleware) logDebug(r *http.Request, msg string, fields ...observability.Field) {
+	if m.logger == nil {
+		return
+	}
+	fields = append([]observability.Field{
+		observability.String("request_id", GetRequestID(r.Context())),
+	}, fields...)
+	m.logger.Debug(r.Context(), msg, fields...)
+}
+
+// claimStrings converts a claim value to a list of strings.
+func claimStrings(value any) []string {
+	switch v := value.(type) {
+	case string:
+		if v == "" {
+			return nil
+		}
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// randomToken returns a URL-safe random string built from n random bytes.
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return generateRequestID() + generateRequestID()
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// safeReturnPath only allows local paths as post-login redirect targets.
+func safeReturnPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return path
+}
+
+// mergeQuery adds the values of extra to base and returns base.
+func mergeQuery(base, extra url.Values) url.Values {
+	for key, values := range extra {
+		base[key] = values
+	}
+	return base
+}
@@ -0,0 +1,602 @@
+package middleware
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/albedosehen/rwwwrse/internal/clientip"
+)
+
+const testOIDCCookieSecret = "0123456789abcdef0123456789abcdef"
+
+// mockOIDCProvider is a minimal OpenID provider for exercising the login flow.
+type mockOIDCProvider struct {
+	t         *testing.T
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	clientID  string
+	email     string
+	groups    []string
+	expiresIn int64
+
+	mu        sync.Mutex
+	codes     map[string]mockAuthorization
+	refreshes int
+}
+
+// mockAuthorization records the parameters of an authorization request.
+type mockAuthorization struct {
+	nonce     string
+	challenge string
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	p := &mockOIDCProvider{
+		t:         t,
+		key:       key,
+		clientID:  "rwwwrse",
+		email:     "alice@example.com",
+		groups:    []string{"engineering"},
+		expiresIn: 3600,
+		codes:     make(map[string]mockAuthorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.handleDiscovery)
+	mux.HandleFunc("/jwks", p.handleJWKS)
+	mux.HandleFunc("/token", p.handleToken)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *mockOIDCProvider) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 p.server.URL,
+		"authorization_endpoint": p.server.URL + "/authorize",
+		"token_endpoint":         p.server.URL + "/token",
+		"jwks_uri":               p.server.URL + "/jwks",
+		"end_session_endpoint":   p.server.URL + "/logout",
+	})
+}
+
+func (p *mockOIDCProvider) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *mockOIDCProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != p.clientID || secret != "client-secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":"invalid_client"}`))
+		return
+	}
+
+	require.NoError(p.t, r.ParseForm())
+
+	nonce := ""
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		p.mu.Lock()
+		auth, exists := p.codes[r.PostForm.Get("code")]
+		delete(p.codes, r.PostForm.Get("code"))
+		p.mu.Unlock()
+
+		verifier := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !exists || base64.RawURLEncoding.EncodeToString(verifier[:]) != auth.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		nonce = auth.nonce
+	case "refresh_token":
+		if r.PostForm.Get("refresh_token") != "refresh-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		p.mu.Lock()
+		p.refreshes++
+		p.mu.Unlock()
+	}
+
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"access_token":  "access-token",
+		"token_type":    "Bearer",
+		"refresh_token": "refresh-token",
+		"expires_in":    p.expiresIn,
+		"id_token":      p.idToken(nonce),
+	})
+}
+
+// idToken issues a signed ID token for the configured user.
+func (p *mockOIDCProvider) idToken(nonce string) string {
+	now := time.Now()
+	claims := map[string]any{
+		"iss":                p.server.URL,
+		"sub":                "user-123",
+		"aud":                p.clientID,
+		"exp":                now.Add(time.Hour).Unix(),
+		"iat":                now.Unix(),
+		"email":              p.email,
+		"email_verified":     true,
+		"preferred_username": "alice",
+		"groups":             p.groups,
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	require.NoError(p.t, err)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// authorize simulates the user approving the login and returns the callback URL.
+func (p *mockOIDCProvider) authorize(t *testing.T, location string) string {
+	t.Helper()
+
+	authURL, err := url.Parse(location)
+	require.NoError(t, err)
+	require.Equal(t, p.server.URL+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+
+	query := authURL.Query()
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Contains(t, query.Get("scope"), "openid")
+
+	p.mu.Lock()
+	p.codes["auth-code"] = mockAuthorization{
+		nonce:     query.Get("nonce"),
+		challenge: query.Get("code_challenge"),
+	}
+	p.mu.Unlock()
+
+	callback, err := url.Parse(query.Get("redirect_uri"))
+	require.NoError(t, err)
+	callback.RawQuery = url.Values{"code": {"auth-code"}, "state": {query.Get("state")}}.Encode()
+	return callback.String()
+}
+
+func newTestOIDCMiddleware(t *testing.T, provider *mockOIDCProvider, modify func(*OIDCConfig)) Middleware {
+	t.Helper()
+
+	config := DefaultOIDCConfig()
+	config.IssuerURL = provider.server.URL
+	config.ClientID = provider.clientID
+	config.ClientSecret = "client-secret"
+	config.CookieSecret = testOIDCCookieSecret
+	config.CookieSecure = false
+	config.PostLogoutRedirectURL = "https://app.example.com/"
+	if modify != nil {
+		modify(&config)
+	}
+
+	mw, err := NewOIDCMiddleware(config, nil, nil)
+	require.NoError(t, err)
+	return mw
+}
+
+// serveWithCookies performs a request against handler, sending the given cookies.
+func serveWithCookies(handler http.Handler, method, target string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// responseCookie returns the named cookie set by a response.
+func responseCookie(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+// login runs the full browser login flow and returns the session cookie.
+func login(t *testing.T, handler http.Handler, provider *mockOIDCProvider) *http.Cookie {
+	t.Helper()
+
+	rec := serveWithCookies(handler, http.MethodGet, "http://app.example.com/dashboard?tab=1", nil)
+	require.Equal(t, http.StatusFound, rec.Code)
+	stateCookie := responseCookie(rec, "_rwwwrse_oidc_state")
+	require.NotNil(t, stateCookie)
+
+	callback := provider.authorize(t, rec.Header().Get("Location"))
+	rec = serveWithCookies(handler, http.MethodGet, callback, []*http.Cookie{stateCookie})
+	require.Equal(t, http.StatusFound, rec.Code, rec.Body.String())
+	assert.Equal(t, "/dashboard?tab=1", rec.Header().Get("Location"))
+
+	session := responseCookie(rec, "_rwwwrse_oidc")
+	require.NotNil(t, session)
+	assert.True(t, session.HttpOnly)
+	return session
+}
+
+func TestOIDCMiddleware_LoginFlow(t *testing.T) {
+	// Arrange
+	provider := newMockOIDCProvider(t)
+	mw := newTestOIDCMiddleware(t, provider, func(c *OIDCConfig) {
+		c.AllowedEmailDomains = []string{"example.com"}
+	})
+
+	var upstream http.Header
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	session := login(t, handler, provider)
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/dashboard", nil)
+	req.AddCookie(session)
+	req.Header.Set("X-Auth-Request-User", "mallory")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "alice", upstream.Get("X-Auth-Request-User"))
+	assert.Equal(t, "alice@example.com", upstream.Get("X-Auth-Request-Email"))
+	assert.Equal(t, "engineering", upstream.Get("X-Auth-Request-Groups"))
+}
+
+func TestOIDCMiddleware_Unauthenticated(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		expectedStatus int
+	}{
+		{
+			name:           "Unauthenticated_GET_RedirectsToProvider",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusFound,
+		},
+		{
+			name:           "Unauthenticated_POST_Returns401",
+			method:         http.MethodPost,
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			provider := newMockOIDCProvider(t)
+			mw := newTestOIDCMiddleware(t, provider, nil)
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Fatal("upstream must not be reached without a session")
+			}))
+
+			// Act
+			rec := serveWithCookies(handler, tt.method, "http://app.example.com/", []*http.Cookie{
+				{Name: "_rwwwrse_oidc", Value: "forged"},
+			})
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestOIDCMiddleware_Authorization(t *testing.T) {
+	tests := []struct {
+		name           string
+		modify         func(*OIDCConfig)
+		expectedStatus int
+	}{
+		{
+			name: "Authorization_AllowedGroup_Admits",
+			modify: func(c *OIDCConfig) {
+				c.AllowedGroups = []string{"engineering"}
+			},
+			expectedStatus: http.StatusFound,
+		},
+		{
+			name: "Authorization_AllowedUser_Admits",
+			modify: func(c *OIDCConfig) {
+				c.AllowedUsers = []string{"Alice@Example.com"}
+			},
+			expectedStatus: http.StatusFound,
+		},
+		{
+			name: "Authorization_GroupNotAllowed_Returns403",
+			modify: func(c *OIDCConfig) {
+				c.AllowedGroups = []string{"admins"}
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name: "Authorization_DomainNotAllowed_Returns403",
+			modify: func(c *OIDCConfig) {
+				c.AllowedEmailDomains = []string{"corp.example.org"}
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			provider := newMockOIDCProvider(t)
+			mw := newTestOIDCMiddleware(t, provider, tt.modify)
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			rec := serveWithCookies(handler, http.MethodGet, "http://app.example.com/", nil)
+			stateCookie := responseCookie(rec, "_rwwwrse_oidc_state")
+			callback := provider.authorize(t, rec.Header().Get("Location"))
+
+			// Act
+			rec = serveWithCookies(handler, http.MethodGet, callback, []*http.Cookie{stateCookie})
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.Nil(t, responseCookie(rec, "_rwwwrse_oidc"))
+			}
+		})
+	}
+}
+
+func TestOIDCMiddleware_CallbackStateMismatch_Returns401(t *testing.T) {
+	// Arrange
+	provider := newMockOIDCProvider(t)
+	mw := newTestOIDCMiddleware(t, provider, nil)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := serveWithCookies(handler, http.MethodGet, "http://app.example.com/", nil)
+	stateCookie := responseCookie(rec, "_rwwwrse_oidc_state")
+	callback := provider.authorize(t, rec.Header().Get("Location"))
+	callback = strings.Replace(callback, "state=", "state=tampered", 1)
+
+	// Act
+	rec = serveWithCookies(handler, http.MethodGet, callback, []*http.Cookie{stateCookie})
+
+	// Assert
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestOIDCMiddleware_RedirectURL_UsesClientScheme(t *testing.T) {
+	// Arrange
+	provider := newMockOIDCProvider(t)
+	mw := newTestOIDCMiddleware(t, provider, nil)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("upstream must not be reached without a session")
+	}))
+	req := httptest.NewRequest(http.MethodGet, "http://app.example.com/", nil)
+	req = req.WithContext(clientip.WithResult(req.Context(), clientip.Result{Scheme: "https"}))
+	rec := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rec, req)
+
+	// Assert
+	require.Equal(t, http.StatusFound, rec.Code)
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "https://app.example.com/oauth2/callback", location.Query().Get("redirect_uri"))
+}
+
+func TestOIDCMiddleware_Refresh(t *testing.T) {
+	// Arrange
+	provider := newMockOIDCProvider(t)
+	provider.expiresIn = 1 // expires within the refresh skew
+	mw := newTestOIDCMiddleware(t, provider, nil)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	session := login(t, handler, provider)
+
+	// Act
+	rec := serveWithCookies(handler, http.MethodGet, "http://app.example.com/", []*http.Cookie{session})
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, 1, provider.refreshes)
+	assert.NotNil(t, responseCookie(rec, "_rwwwrse_oidc"))
+}
+
+func TestOIDCMiddleware_Logout(t *testing.T) {
+	// Arrange
+	provider := newMockOIDCProvider(t)
+	mw := newTestOIDCMiddleware(t, provider, nil)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	session := login(t, handler, provider)
+
+	// Act
+	rec := serveWithCookies(handler, http.MethodPost, "http://app.example.com/oauth2/logout", []*http.Cookie{session})
+
+	// Assert
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "/logout", location.Path)
+	assert.NotEmpty(t, location.Query().Get("id_token_hint"))
+	assert.Equal(t, "https://app.example.com/", location.Query().Get("post_logout_redirect_uri"))
+
+	cleared := responseCookie(rec, "_rwwwrse_oidc")
+	require.NotNil(t, cleared)
+	assert.Equal(t, -1, cleared.MaxAge)
+}
+
+func TestOIDCMiddleware_Logout_Get_MethodNotAllowed(t *testing.T) {
+	// Arrange
+	provider := newMockOIDCProvider(t)
+	mw := newTestOIDCMiddleware(t, provider, nil)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	session := login(t, handler, provider)
+
+	// Act
+	rec := serveWithCookies(handler, http.MethodGet, "http://app.example.com/oauth2/logout", []*http.Cookie{session})
+
+	// Assert
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+	assert.Nil(t, responseCookie(rec, "_rwwwrse_oidc"))
+}
+
+func TestOIDCMiddleware_DiscoveryFailure_SharedAndCached(t *testing.T) {
+	// Arrange
+	var requests atomic.Int32
+	release := make(chan struct{})
+	issuer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(issuer.Close)
+
+	config := DefaultOIDCConfig()
+	config.IssuerURL = issuer.URL
+	config.ClientID = "rwwwrse"
+	config.CookieSecret = testOIDCCookieSecret
+	mw, err := NewOIDCMiddleware(config, nil, nil)
+	require.NoError(t, err)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	// Act
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serveWithCookies(handler, http.MethodGet, "http://app.example.com/", nil).Code
+		}(i)
+	}
+	require.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	after := serveWithCookies(handler, http.MethodGet, "http://app.example.com/", nil)
+
+	// Assert
+	for _, code := range codes {
+		assert.Equal(t, http.StatusServiceUnavailable, code)
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, after.Code)
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestJWKSCache_Refresh_SharedAndNotBlockingCachedKeys(t *testing.T) {
+	// Arrange
+	provider := newMockOIDCProvider(t)
+	var requests atomic.Int32
+	release := make(chan struct{})
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		provider.handleJWKS(w, r)
+	}))
+	t.Cleanup(jwks.Close)
+
+	cache := newJWKSCache(jwks.URL, jwks.Client())
+	cache.keys["cached-key"] = &provider.key.PublicKey
+
+	// Act
+	var wg sync.WaitGroup
+	errs := make([]error, 5)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = cache.key(context.Background(), "test-key")
+		}(i)
+	}
+	require.Eventually(t, func() bool { return requests.Load() == 1 }, time.Second, time.Millisecond)
+
+	cached := make(chan error, 1)
+	go func() {
+		_, err := cache.key(context.Background(), "cached-key")
+		cached <- err
+	}()
+
+	// Assert
+	select {
+	case err := <-cached:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Error("cached key lookup blocked on the JWKS refresh")
+	}
+
+	close(release)
+	wg.Wait()
+	for _, err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), requests.Load())
+}
+
+func TestNewOIDCMiddleware_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config OIDCConfig
+	}{
+		{
+			name:   "NewOIDCMiddleware_MissingIssuer_ReturnsError",
+			config: OIDCConfig{ClientID: "id", CookieSecret: testOIDCCookieSecret},
+		},
+		{
+			name:   "NewOIDCMiddleware_MissingClientID_ReturnsError",
+			config: OIDCConfig{IssuerURL: "https://idp.example.com", CookieSecret: testOIDCCookieSecret},
+		},
+		{
+			name:   "NewOIDCMiddleware_MissingSecret_ReturnsError",
+			config: OIDCConfig{IssuerURL: "https://idp.example.com", ClientID: "id"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			mw, err := NewOIDCMiddleware(tt.config, nil, nil)
+
+			// Assert
+			assert.Error(t, err)
+			assert.Nil(t, mw)
+		})
+	}
+}
@@ -0,0 +1,651 @@
+// Package middleware implements request validation against OpenAPI 3 documents.
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// OpenAPI validation modes.
+const (
+	OpenAPIModeEnforce = "enforce"
+	OpenAPIModeMonitor = "monitor"
+)
+
+// openAPITemplateParam matches a path template parameter such as {id}.
+var openAPITemplateParam = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// OpenAPIConfig holds configuration for the OpenAPI validation middleware.
+type OpenAPIConfig struct {
+	// Name identifies the route in logs and metrics.
+	Name string
+
+	// SpecFile is an OpenAPI 3.x document in YAML or JSON.
+	SpecFile string
+
+	// Mode is "enforce" to reject invalid requests or "monitor" to only
+	// log them.
+	Mode string
+
+	// BasePath is stripped from request paths before matching. It defaults
+	// to the path of the document's first server URL.
+	BasePath string
+
+	// RejectUnknown treats requests that match no operation as invalid.
+	RejectUnknown bool
+
+	// MaxBodySize limits the size of a body that is buffered for validation.
+	MaxBodySize int64
+
+	// ResponseSampleRate is the fraction of responses, between 0 and 1,
+	// validated against the document. Response violations are only logged.
+	ResponseSampleRate float64
+}
+
+// DefaultOpenAPIConfig returns an OpenAPI validation configuration with sensible defaults.
+func DefaultOpenAPIConfig() OpenAPIConfig {
+	return OpenAPIConfig{
+		Mode:        OpenAPIModeEnforce,
+		MaxBodySize: 1 << 20,
+	}
+}
+
+// openAPIRoute is a compiled path template of the document.
+type openAPIRoute struct {
+	template   string
+	pattern    *regexp.Regexp
+	params     int
+	item       *openAPIPathItem
+	operations map[string]*openAPIOperation
+}
+
+// openAPIMiddleware validates requests against an OpenAPI document.
+type openAPIMiddleware struct {
+	config  OpenAPIConfig
+	doc     *openAPIDocument
+	routes  []*openAPIRoute
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+}
+
+// NewOpenAPIMiddleware creates a new OpenAPI validation middleware.
+func NewOpenAPIMiddleware(
+	config OpenAPIConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewOpenAPIValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(config.SpecFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOpenAPISpec, err)
+	}
+
+	doc, err := parseOpenAPIDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.BasePath == "" && len(doc.Servers) > 0 {
+		if u, err := url.Parse(doc.Servers[0].URL); err == nil {
+			config.BasePath = u.Path
+		}
+	}
+	config.BasePath = strings.TrimSuffix(config.BasePath, "/")
+
+	return &openAPIMiddleware{
+		config:  config,
+		doc:     doc,
+		routes:  compileOpenAPIRoutes(doc),
+		logger:  logger,
+		metrics: metrics,
+	}, nil
+}
+
+// compileOpenAPIRoutes turns path templates into patterns ordered so that
+// concrete paths are matched before templated ones.
+func compileOpenAPIRoutes(doc *openAPIDocument) []*openAPIRoute {
+	routes := make([]*openAPIRoute, 0, len(doc.Paths))
+	for template, item := range doc.Paths {
+		pattern := "^"
+		last := 0
+		matches := openAPITemplateParam.FindAllStringSubmatchIndex(template, -1)
+		for _, match := range matches {
+			pattern += regexp.QuoteMeta(template[last:match[0]])
+			pattern += "(?P<" + sanitizeGroupName(template[match[2]:match[3]]) + ">[^/]+)"
+			last = match[1]
+		}
+		pattern += regexp.QuoteMeta(template[last:]) + "$"
+
+		routes = append(routes, &openAPIRoute{
+			template:   template,
+			pattern:    regexp.MustCompile(pattern),
+			params:     len(matches),
+			item:       item,
+			operations: item.operations(),
+		})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].params != routes[j].params {
+			return routes[i].params < routes[j].params
+		}
+		if len(routes[i].template) != len(routes[j].template) {
+			return len(routes[i].template) > len(routes[j].template)
+		}
+		return routes[i].template < routes[j].template
+	})
+
+	return routes
+}
+
+// sanitizeGroupName makes a template parameter usable as a regexp group name.
+func sanitizeGroupName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || (r >= '0' && r <= '9') || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// Wrap implements the Middleware interface.
+func (m *openAPIMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, params, op := m.match(r)
+		if op == nil {
+			if m.config.RejectUnknown {
+				violations := []string{fmt.Sprintf("operation: no operation for %s %s", r.Method, r.URL.Path)}
+				if m.handleViolations(w, r, nil, "request", violations) {
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		check := &schemaCheck{doc: m.doc}
+		m.validateParameters(check, r, route, op, params)
+		m.validateBody(check, r, op)
+		if len(check.violations) > 0 && m.handleViolations(w, r, op, "request", check.violations) {
+			return
+		}
+
+		if m.config.ResponseSampleRate <= 0 || rand.Float64() >= m.config.ResponseSampleRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		capture := &openAPIResponseWriter{ResponseWriter: w, limit: m.config.MaxBodySize}
+		next.ServeHTTP(capture, r)
+		m.validateResponse(r, op, capture)
+	})
+}
+
+// match finds the operation of a request and its path parameters.
+func (m *openAPIMiddleware) match(r *http.Request) (*openAPIRoute, map[string]string, *openAPIOperation) {
+	path := r.URL.Path
+	if m.config.BasePath != "" {
+		rest, ok := strings.CutPrefix(path, m.config.BasePath)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			return nil, nil, nil
+		}
+		path = rest
+		if path == "" {
+			path = "/"
+		}
+	}
+
+	for _, route := range m.routes {
+		match := route.pattern.FindStringSubmatch(path)
+		if match == nil {
+			continue
+		}
+
+		op := route.operations[r.Method]
+		if op == nil {
+			continue
+		}
+
+		params := make(map[string]string, route.params)
+		for i, name := range route.pattern.SubexpNames() {
+			if i > 0 && name != "" {
+				params[name] = match[i]
+			}
+		}
+		return route, params, op
+	}
+
+	return nil, nil, nil
+}
+
+// validateParameters checks path, query, header and cookie parameters.
+func (m *openAPIMiddleware) validateParameters(
+	check *schemaCheck,
+	r *http.Request,
+	route *openAPIRoute,
+	op *openAPIOperation,
+	params map[string]string,
+) {
+	// Operation parameters override path item parameters of the same name and location.
+	merged := make(map[string]*openAPIParameter)
+	order := []string{}
+	for _, list := range [][]*openAPIParameter{route.item.Parameters, op.Parameters} {
+		for _, p := range list {
+			p = m.doc.parameter(p)
+			if p == nil {
+				continue
+			}
+			key := p.In + ":" + p.Name
+			if _, exists := merged[key]; !exists {
+				order = append(order, key)
+			}
+			merged[key] = p
+		}
+	}
+
+	query := r.URL.Query()
+	for _, key := range order {
+		p := merged[key]
+		location := p.In + "." + p.Name
+
+		var values []string
+		switch p.In {
+		case "path":
+			if value, ok := params[sanitizeGroupName(p.Name)]; ok {
+				values = []string{value}
+			}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = r.Header.Values(p.Name)
+		case "cookie":
+			if cookie, err := r.Cookie(p.Name); err == nil {
+				values = []string{cookie.Value}
+			}
+		}
+
+		if len(values) == 0 {
+			if p.Required || p.In == "path" {
+				check.addf(location, "is required")
+			}
+			continue
+		}
+
+		if p.Schema == nil {
+			continue
+		}
+
+		explode := p.In == "query" || p.In == "cookie"
+		if p.Explode != nil {
+			explode = *p.Explode
+		}
+
+		value, ok := m.coerceParameter(p.Schema, values, p.In == "query" && explode)
+		if !ok {
+			check.addf(location, "expected %s", strings.Join(m.doc.resolve(p.Schema).Type, " or "))
+			continue
+		}
+		if value != nil {
+			check.validate(p.Schema, value, location, 0)
+		}
+	}
+}
+
+// coerceParameter converts parameter strings into the JSON value described
+// by schema. It returns nil for values that are not validated.
+func (m *openAPIMiddleware) coerceParameter(schema *openAPISchema, values []string, repeated bool) (any, bool) {
+	resolved := m.doc.resolve(schema)
+	if resolved == nil {
+		return nil, true
+	}
+
+	switch primaryType(resolved) {
+	case "array":
+		if !repeated && len(values) == 1 {
+			values = strings.Split(values[0], ",")
+		}
+		items := make([]any, 0, len(values))
+		for _, v := range values {
+			item, ok := m.coerceParameter(resolved.Items, []string{v}, false)
+			if !ok {
+				return nil, false
+			}
+			items = append(items, item)
+		}
+		return items, true
+	case "object":
+		return nil, true
+	default:
+		return coerceScalar(primaryType(resolved), values[0])
+	}
+}
+
+// primaryType returns the first non-null type of a schema.
+func primaryType(schema *openAPISchema) string {
+	if schema == nil {
+		return ""
+	}
+	for _, t := range schema.Type {
+		if t != "null" {
+			return t
+		}
+	}
+	return ""
+}
+
+// coerceScalar converts a parameter string to a JSON scalar of type t.
+func coerceScalar(t, value string) (any, bool) {
+	switch t {
+	case "integer":
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			return nil, false
+		}
+		return json.Number(value), true
+	case "number":
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, false
+		}
+		return json.Number(value), true
+	case "boolean":
+		b, err := strconv.ParseBool(value)
+		if err != nil || (value != "true" && value != "false") {
+			return nil, false
+		}
+		return b, true
+	default:
+		return value, true
+	}
+}
+
+// validateBody checks the request body against the operation's request body.
+func (m *openAPIMiddleware) validateBody(check *schemaCheck, r *http.Request, op *openAPIOperation) {
+	spec := m.doc.requestBody(op.RequestBody)
+	if spec == nil {
+		return
+	}
+
+	var body []byte
+	tooLarge := false
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, m.config.MaxBodySize+1))
+		if err != nil {
+			check.addf("body", "could not be read")
+			return
+		}
+		tooLarge = int64(len(body)) > m.config.MaxBodySize
+		r.Body = &replayBody{Reader: io.MultiReader(bytes.NewReader(body), r.Body), Closer: r.Body}
+	}
+
+	if len(body) == 0 {
+		if spec.Required {
+			check.addf("body", "is required")
+		}
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	media, ok := matchMediaType(spec.Content, mediaType)
+	if !ok {
+		check.addf("body", "unsupported content type %q", mediaType)
+		return
+	}
+
+	if tooLarge {
+		check.addf("body", "exceeds %d bytes", m.config.MaxBodySize)
+		return
+	}
+
+	if media.Schema == nil || !isJSONMediaType(mediaType) {
+		return
+	}
+
+	value, err := decodeJSONValue(body)
+	if err != nil {
+		check.addf("body", "is not valid JSON")
+		return
+	}
+	check.validate(media.Schema, value, "body", 0)
+}
+
+// validateResponse checks a captured response against the operation's
+// responses. Violations are logged but never change the response.
+func (m *openAPIMiddleware) validateResponse(r *http.Request, op *openAPIOperation, rw *openAPIResponseWriter) {
+	status := rw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	check := &schemaCheck{doc: m.doc, response: true}
+	spec := op.Responses[strconv.Itoa(status)]
+	if spec == nil {
+		spec = op.Responses[strconv.Itoa(status/100)+"XX"]
+	}
+	if spec == nil {
+		spec = op.Responses["default"]
+	}
+	spec = m.doc.response(spec)
+
+	switch {
+	case spec == nil:
+		check.addf("status", "%d is not documented", status)
+	case rw.body.Len() > 0 && !rw.truncated && len(spec.Content) > 0:
+		if encoding := rw.Header().Get("Content-Encoding"); encoding != "" && encoding != "identity" {
+			break
+		}
+		mediaType, _, _ := mime.ParseMediaType(rw.Header().Get("Content-Type"))
+		media, ok := matchMediaType(spec.Content, mediaType)
+		if !ok {
+			check.addf("body", "undocumented content type %q", mediaType)
+			break
+		}
+		if media.Schema == nil || !isJSONMediaType(mediaType) {
+			break
+		}
+		value, err := decodeJSONValue(rw.body.Bytes())
+		if err != nil {
+			check.addf("body", "is not valid JSON")
+			break
+		}
+		check.validate(media.Schema, value, "body", 0)
+	}
+
+	if len(check.violations) > 0 {
+		m.report(r, op, "response", check.violations)
+	}
+}
+
+// handleViolations reports violations and, in enforce mode, rejects the
+// request. It returns true when the request was rejected.
+func (m *openAPIMiddleware) handleViolations(
+	w http.ResponseWriter,
+	r *http.Request,
+	op *openAPIOperation,
+	direction string,
+	violations []string,
+) bool {
+	m.report(r, op, direction, violations)
+
+	if m.config.Mode != OpenAPIModeEnforce {
+		return false
+	}
+
+	writeErrorResponse(w, r, proxyerrors.WrapError(
+		proxyerrors.ErrCodeRequestInvalid,
+		"request does not match the API specification",
+		nil,
+	).WithContext("violations", violations))
+	return true
+}
+
+// report logs and records violations.
+func (m *openAPIMiddleware) report(r *http.Request, op *openAPIOperation, direction string, violations []string) {
+	route := m.config.Name
+	if route == "" {
+		route = normalizeRouteHost(r.Host)
+	}
+
+	operationID := ""
+	if op != nil {
+		operationID = op.OperationID
+	}
+
+	if m.logger != nil {
+		m.logger.Warn(r.Context(), "OpenAPI validation failed",
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.String("route", route),
+			observability.String("direction", direction),
+			observability.String("mode", m.config.Mode),
+			observability.String("method", r.Method),
+			observability.String("path", r.URL.Path),
+			observability.String("operation_id", operationID),
+			observability.String("violations", sanitizeString(strings.Join(violations, "; "))),
+		)
+	}
+
+	if m.metrics != nil {
+		m.metrics.RecordOpenAPIViolation(route, direction)
+	}
+}
+
+// matchMediaType finds the media type object for mediaType, falling back
+// to "type/*" and "*/*" ranges.
+func matchMediaType(content map[string]openAPIMediaType, mediaType string) (openAPIMediaType, bool) {
+	if media, ok := content[mediaType]; ok {
+		return media, true
+	}
+	if major, _, found := strings.Cut(mediaType, "/"); found {
+		if media, ok := content[major+"/*"]; ok {
+			return media, true
+		}
+	}
+	media, ok := content["*/*"]
+	return media, ok
+}
+
+// isJSONMediaType reports whether mediaType is JSON.
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// decodeJSONValue decodes a single JSON value, keeping numbers exact.
+func decodeJSONValue(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after JSON value")
+	}
+	return value, nil
+}
+
+// openAPIResponseWriter captures the status and the start of the body of
+// a sampled response while passing it through unchanged.
+type openAPIResponseWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+// WriteHeader records the status code.
+func (w *openAPIResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Write captures the body up to the limit.
+func (w *openAPIResponseWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if !w.truncated {
+		if int64(w.body.Len()+len(data)) > w.limit {
+			w.truncated = true
+			w.body.Reset()
+		} else {
+			w.body.Write(data)
+		}
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush implements http.Flusher interface.
+func (w *openAPIResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *openAPIResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// OpenAPIValidator validates OpenAPI validation configuration.
+type OpenAPIValidator struct{}
+
+// NewOpenAPIValidator creates a new OpenAPI validator.
+func NewOpenAPIValidator() *OpenAPIValidator {
+	return &OpenAPIValidator{}
+}
+
+// Validate validates the OpenAPI configuration.
+func (v *OpenAPIValidator) Validate(config OpenAPIConfig) error {
+	if config.SpecFile == "" {
+		return ErrOpenAPISpecRequired
+	}
+
+	if config.Mode != OpenAPIModeEnforce && config.Mode != OpenAPIModeMonitor {
+		return fmt.Errorf("%w: %q", ErrInvalidOpenAPIMode, config.Mode)
+	}
+
+	if config.BasePath != "" && !strings.HasPrefix(config.BasePath, "/") {
+		return fmt.Errorf("%w: %q", ErrInvalidOpenAPIBasePath, config.BasePath)
+	}
+
+	if config.MaxBodySize <= 0 {
+		return ErrInvalidOpenAPIBodySize
+	}
+
+	if config.ResponseSampleRate < 0 || config.ResponseSampleRate > 1 {
+		return ErrInvalidOpenAPISampleRate
+	}
+
+	return nil
+}
+
+// OpenAPI validation errors.
+var (
+	ErrOpenAPISpecRequired      = fmt.Errorf("OpenAPI spec file is required")
+	ErrInvalidOpenAPISpec       = fmt.Errorf("invalid OpenAPI document")
+	ErrInvalidOpenAPIMode       = fmt.Errorf("OpenAPI mode must be enforce or monitor")
+	ErrInvalidOpenAPIBasePath   = fmt.Errorf("OpenAPI base path must start with /")
+	ErrInvalidOpenAPIBodySize   = fmt.Errorf("OpenAPI max body size must be positive")
+	ErrInvalidOpenAPISampleRate = fmt.Errorf("OpenAPI response sample rate must be between 0 and 1")
+)
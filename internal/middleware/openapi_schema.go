@@ -0,0 +1,724 @@
+// Package middleware implements the OpenAPI 3 document model and JSON Schema checks.
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// openAPIMaxViolations bounds the number of violations reported per message.
+const openAPIMaxViolations = 20
+
+// openAPIMaxRefDepth bounds $ref resolution to guard against cyclic schemas.
+const openAPIMaxRefDepth = 64
+
+// openAPIComponentsPrefix is the only $ref target supported.
+const openAPIComponentsPrefix = "#/components/"
+
+// openAPIDocument is the subset of an OpenAPI 3.0/3.1 document used for validation.
+type openAPIDocument struct {
+	OpenAPI    string                      `yaml:"openapi"`
+	Servers    []openAPIServer             `yaml:"servers"`
+	Paths      map[string]*openAPIPathItem `yaml:"paths"`
+	Components openAPIComponents           `yaml:"components"`
+}
+
+// openAPIServer is an OpenAPI Server Object.
+type openAPIServer struct {
+	URL string `yaml:"url"`
+}
+
+// openAPIComponents holds the reusable objects that $ref may point to.
+type openAPIComponents struct {
+	Schemas       map[string]*openAPISchema      `yaml:"schemas"`
+	Parameters    map[string]*openAPIParameter   `yaml:"parameters"`
+	RequestBodies map[string]*openAPIRequestBody `yaml:"requestBodies"`
+	Responses     map[string]*openAPIResponse    `yaml:"responses"`
+}
+
+// openAPIPathItem is an OpenAPI Path Item Object.
+type openAPIPathItem struct {
+	Parameters []*openAPIParameter `yaml:"parameters"`
+	Get        *openAPIOperation   `yaml:"get"`
+	Put        *openAPIOperation   `yaml:"put"`
+	Post       *openAPIOperation   `yaml:"post"`
+	Delete     *openAPIOperation   `yaml:"delete"`
+	Options    *openAPIOperation   `yaml:"options"`
+	Head       *openAPIOperation   `yaml:"head"`
+	Patch      *openAPIOperation   `yaml:"patch"`
+	Trace      *openAPIOperation   `yaml:"trace"`
+}
+
+// operations returns the operations of the path item by HTTP method.
+func (p *openAPIPathItem) operations() map[string]*openAPIOperation {
+	ops := map[string]*openAPIOperation{
+		"GET": p.Get, "PUT": p.Put, "POST": p.Post, "DELETE": p.Delete,
+		"OPTIONS": p.Options, "HEAD": p.Head, "PATCH": p.Patch, "TRACE": p.Trace,
+	}
+	for method, op := range ops {
+		if op == nil {
+			delete(ops, method)
+		}
+	}
+	return ops
+}
+
+// openAPIOperation is an OpenAPI Operation Object.
+type openAPIOperation struct {
+	OperationID string                      `yaml:"operationId"`
+	Parameters  []*openAPIParameter         `yaml:"parameters"`
+	RequestBody *openAPIRequestBody         `yaml:"requestBody"`
+	Responses   map[string]*openAPIResponse `yaml:"responses"`
+}
+
+// openAPIParameter is an OpenAPI Parameter Object.
+type openAPIParameter struct {
+	Ref      string         `yaml:"$ref"`
+	Name     string         `yaml:"name"`
+	In       string         `yaml:"in"`
+	Required bool           `yaml:"required"`
+	Explode  *bool          `yaml:"explode"`
+	Schema   *openAPISchema `yaml:"schema"`
+}
+
+// openAPIRequestBody is an OpenAPI Request Body Object.
+type openAPIRequestBody struct {
+	Ref      string                      `yaml:"$ref"`
+	Required bool                        `yaml:"required"`
+	Content  map[string]openAPIMediaType `yaml:"content"`
+}
+
+// openAPIResponse is an OpenAPI Response Object.
+type openAPIResponse struct {
+	Ref     string                      `yaml:"$ref"`
+	Content map[string]openAPIMediaType `yaml:"content"`
+}
+
+// openAPIMediaType is an OpenAPI Media Type Object.
+type openAPIMediaType struct {
+	Schema *openAPISchema `yaml:"schema"`
+}
+
+// openAPISchema is the subset of the Schema Object checked by the validator.
+type openAPISchema struct {
+	Ref                  string                    `yaml:"$ref"`
+	Type                 openAPITypes              `yaml:"type"`
+	Format               string                    `yaml:"format"`
+	Nullable             bool                      `yaml:"nullable"`
+	ReadOnly             bool                      `yaml:"readOnly"`
+	WriteOnly            bool                      `yaml:"writeOnly"`
+	Enum                 []any                     `yaml:"enum"`
+	Properties           map[string]*openAPISchema `yaml:"properties"`
+	Required             []string                  `yaml:"required"`
+	AdditionalProperties *openAPIAdditional        `yaml:"additionalProperties"`
+	MinProperties        *int                      `yaml:"minProperties"`
+	MaxProperties        *int                      `yaml:"maxProperties"`
+	Items                *openAPISchema            `yaml:"items"`
+	MinItems             *int                      `yaml:"minItems"`
+	MaxItems             *int                      `yaml:"maxItems"`
+	UniqueItems          bool                      `yaml:"uniqueItems"`
+	MinLength            *int                      `yaml:"minLength"`
+	MaxLength            *int                      `yaml:"maxLength"`
+	Pattern              string                    `yaml:"pattern"`
+	Minimum              *float64                  `yaml:"minimum"`
+	Maximum              *float64                  `yaml:"maximum"`
+	ExclusiveMinimum     openAPIBound              `yaml:"exclusiveMinimum"`
+	ExclusiveMaximum     openAPIBound              `yaml:"exclusiveMaximum"`
+	MultipleOf           *float64                  `yaml:"multipleOf"`
+	AllOf                []*openAPISchema          `yaml:"allOf"`
+	AnyOf                []*openAPISchema          `yaml:"anyOf"`
+	OneOf                []*openAPISchema          `yaml:"oneOf"`
+	Not                  *openAPISchema            `yaml:"not"`
+
+	pattern *regexp.Regexp
+}
+
+// openAPITypes holds a schema type, which OpenAPI 3.1 allows to be a list.
+type openAPITypes []string
+
+// UnmarshalYAML accepts a single type name or a list of names.
+func (t *openAPITypes) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*t = openAPITypes{node.Value}
+		return nil
+	}
+	var types []string
+	if err := node.Decode(&types); err != nil {
+		return err
+	}
+	*t = types
+	return nil
+}
+
+// openAPIBound is an exclusive bound: a boolean modifier in OpenAPI 3.0
+// and a number in OpenAPI 3.1.
+type openAPIBound struct {
+	flag  bool
+	value *float64
+}
+
+// UnmarshalYAML accepts either form of an exclusive bound.
+func (b *openAPIBound) UnmarshalYAML(node *yaml.Node) error {
+	if node.Tag == "!!bool" {
+		return node.Decode(&b.flag)
+	}
+	var value float64
+	if err := node.Decode(&value); err != nil {
+		return err
+	}
+	b.value = &value
+	return nil
+}
+
+// openAPIAdditional is additionalProperties: a boolean or a schema.
+type openAPIAdditional struct {
+	allowed bool
+	schema  *openAPISchema
+}
+
+// UnmarshalYAML accepts either form of additionalProperties.
+func (a *openAPIAdditional) UnmarshalYAML(node *yaml.Node) error {
+	if node.Tag == "!!bool" {
+		return node.Decode(&a.allowed)
+	}
+	a.allowed = true
+	return node.Decode(&a.schema)
+}
+
+// parseOpenAPIDocument parses an OpenAPI 3.x document in YAML or JSON and
+// checks that it can be used for validation.
+func parseOpenAPIDocument(data []byte) (*openAPIDocument, error) {
+	var doc openAPIDocument
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOpenAPISpec, err)
+	}
+
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrInvalidOpenAPISpec, doc.OpenAPI)
+	}
+
+	if err := doc.prepare(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOpenAPISpec, err)
+	}
+
+	return &doc, nil
+}
+
+// prepare compiles patterns and checks that every $ref can be resolved.
+func (d *openAPIDocument) prepare() error {
+	var walk func(s *openAPISchema) error
+	walk = func(s *openAPISchema) error {
+		if s == nil {
+			return nil
+		}
+		if s.Ref != "" {
+			if d.schemaRef(s.Ref) == nil {
+				return fmt.Errorf("unresolved reference %q", s.Ref)
+			}
+			return nil
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern %q: %v", s.Pattern, err)
+			}
+			s.pattern = re
+		}
+		children := []*openAPISchema{s.Items, s.Not}
+		children = append(children, s.AllOf...)
+		children = append(children, s.AnyOf...)
+		children = append(children, s.OneOf...)
+		for _, prop := range s.Properties {
+			children = append(children, prop)
+		}
+		if s.AdditionalProperties != nil {
+			children = append(children, s.AdditionalProperties.schema)
+		}
+		for _, child := range children {
+			if err := walk(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	walkContent := func(content map[string]openAPIMediaType) error {
+		for _, media := range content {
+			if err := walk(media.Schema); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	walkParams := func(params []*openAPIParameter) error {
+		for _, param := range params {
+			resolved := d.parameter(param)
+			if resolved == nil {
+				return fmt.Errorf("unresolved reference %q", param.Ref)
+			}
+			if err := walk(resolved.Schema); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, schema := range d.Components.Schemas {
+		if err := walk(schema); err != nil {
+			return err
+		}
+	}
+
+	for path, item := range d.Paths {
+		if item == nil || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid path %q", path)
+		}
+		if err := walkParams(item.Parameters); err != nil {
+			return err
+		}
+		for _, op := range item.operations() {
+			if err := walkParams(op.Parameters); err != nil {
+				return err
+			}
+			if op.RequestBody != nil {
+				body := d.requestBody(op.RequestBody)
+				if body == nil {
+					return fmt.Errorf("unresolved reference %q", op.RequestBody.Ref)
+				}
+				if err := walkContent(body.Content); err != nil {
+					return err
+				}
+			}
+			for _, resp := range op.Responses {
+				resolved := d.response(resp)
+				if resolved == nil {
+					return fmt.Errorf("unresolved response reference in %s", path)
+				}
+				if err := walkContent(resolved.Content); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// componentName returns the name of a local component reference of kind.
+func componentName(ref, kind string) (string, bool) {
+	return strings.CutPrefix(ref, openAPIComponentsPrefix+kind+"/")
+}
+
+// schemaRef resolves a schema reference.
+func (d *openAPIDocument) schemaRef(ref string) *openAPISchema {
+	name, ok := componentName(ref, "schemas")
+	if !ok {
+		return nil
+	}
+	return d.Components.Schemas[name]
+}
+
+// parameter resolves a parameter that may be a reference.
+func (d *openAPIDocument) parameter(p *openAPIParameter) *openAPIParameter {
+	if p == nil || p.Ref == "" {
+		return p
+	}
+	name, ok := componentName(p.Ref, "parameters")
+	if !ok {
+		return nil
+	}
+	return d.Components.Parameters[name]
+}
+
+// requestBody resolves a request body that may be a reference.
+func (d *openAPIDocument) requestBody(b *openAPIRequestBody) *openAPIRequestBody {
+	if b == nil || b.Ref == "" {
+		return b
+	}
+	name, ok := componentName(b.Ref, "requestBodies")
+	if !ok {
+		return nil
+	}
+	return d.Components.RequestBodies[name]
+}
+
+// response resolves a response that may be a reference.
+func (d *openAPIDocument) response(r *openAPIResponse) *openAPIResponse {
+	if r == nil || r.Ref == "" {
+		return r
+	}
+	name, ok := componentName(r.Ref, "responses")
+	if !ok {
+		return nil
+	}
+	return d.Components.Responses[name]
+}
+
+// resolve follows schema references.
+func (d *openAPIDocument) resolve(s *openAPISchema) *openAPISchema {
+	for depth := 0; s != nil && s.Ref != "" && depth < openAPIMaxRefDepth; depth++ {
+		s = d.schemaRef(s.Ref)
+	}
+	return s
+}
+
+// schemaCheck collects violations while validating one message.
+type schemaCheck struct {
+	doc        *openAPIDocument
+	response   bool
+	violations []string
+}
+
+// addf records a violation at location.
+func (c *schemaCheck) addf(location, format string, args ...any) {
+	if len(c.violations) >= openAPIMaxViolations {
+		return
+	}
+	c.violations = append(c.violations, location+": "+fmt.Sprintf(format, args...))
+}
+
+// full reports whether no more violations will be recorded.
+func (c *schemaCheck) full() bool {
+	return len(c.violations) >= openAPIMaxViolations
+}
+
+// passes reports whether value satisfies schema without recording violations.
+func (c *schemaCheck) passes(schema *openAPISchema, value any, depth int) bool {
+	sub := &schemaCheck{doc: c.doc, response: c.response}
+	sub.validate(schema, value, "", depth)
+	return len(sub.violations) == 0
+}
+
+// validate checks a decoded JSON value against schema.
+func (c *schemaCheck) validate(schema *openAPISchema, value any, location string, depth int) {
+	if depth > openAPIMaxRefDepth || c.full() {
+		return
+	}
+
+	schema = c.doc.resolve(schema)
+	if schema == nil {
+		return
+	}
+
+	if value == nil {
+		if len(schema.Type) > 0 && !schema.Nullable && !slices.Contains(schema.Type, "null") &&
+			!slices.Contains(schema.Enum, nil) {
+			c.addf(location, "expected %s, got null", strings.Join(schema.Type, " or "))
+		}
+		c.validateComposition(schema, value, location, depth)
+		return
+	}
+
+	kind := jsonKind(value)
+	if len(schema.Type) > 0 && !typeMatches(schema.Type, kind, value) {
+		c.addf(location, "expected %s, got %s", strings.Join(schema.Type, " or "), kind)
+		return
+	}
+
+	if len(schema.Enum) > 0 && !enumContains(schema.Enum, value) {
+		c.addf(location, "value is not one of the allowed values")
+	}
+
+	switch v := value.(type) {
+	case string:
+		c.validateString(schema, v, location)
+	case json.Number:
+		c.validateNumber(schema, v, location)
+	case []any:
+		c.validateArray(schema, v, location, depth)
+	case map[string]any:
+		c.validateObject(schema, v, location, depth)
+	}
+
+	c.validateComposition(schema, value, location, depth)
+}
+
+// validateComposition applies allOf, anyOf, oneOf and not.
+func (c *schemaCheck) validateComposition(schema *openAPISchema, value any, location string, depth int) {
+	for _, sub := range schema.AllOf {
+		c.validate(sub, value, location, depth+1)
+	}
+
+	if len(schema.AnyOf) > 0 {
+		matched := false
+		for _, sub := range schema.AnyOf {
+			if c.passes(sub, value, depth+1) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			c.addf(location, "value does not match any allowed schema")
+		}
+	}
+
+	if len(schema.OneOf) > 0 {
+		matches := 0
+		for _, sub := range schema.OneOf {
+			if c.passes(sub, value, depth+1) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			c.addf(location, "value must match exactly one schema, matched %d", matches)
+		}
+	}
+
+	if schema.Not != nil && c.passes(schema.Not, value, depth+1) {
+		c.addf(location, "value matches a disallowed schema")
+	}
+}
+
+// validateString applies string keywords.
+func (c *schemaCheck) validateString(schema *openAPISchema, value, location string) {
+	length := utf8.RuneCountInString(value)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		c.addf(location, "length must be at least %d", *schema.MinLength)
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		c.addf(location, "length must be at most %d", *schema.MaxLength)
+	}
+	if schema.pattern != nil && !schema.pattern.MatchString(value) {
+		c.addf(location, "does not match pattern %s", schema.Pattern)
+	}
+	if !formatMatches(schema.Format, value) {
+		c.addf(location, "is not a valid %s", schema.Format)
+	}
+}
+
+// validateNumber applies numeric keywords.
+func (c *schemaCheck) validateNumber(schema *openAPISchema, value json.Number, location string) {
+	n, err := value.Float64()
+	if err != nil {
+		c.addf(location, "is not a valid number")
+		return
+	}
+
+	if schema.Minimum != nil {
+		if schema.ExclusiveMinimum.flag && n <= *schema.Minimum {
+			c.addf(location, "must be greater than %v", *schema.Minimum)
+		} else if n < *schema.Minimum {
+			c.addf(location, "must be at least %v", *schema.Minimum)
+		}
+	}
+	if schema.ExclusiveMinimum.value != nil && n <= *schema.ExclusiveMinimum.value {
+		c.addf(location, "must be greater than %v", *schema.ExclusiveMinimum.value)
+	}
+
+	if schema.Maximum != nil {
+		if schema.ExclusiveMaximum.flag && n >= *schema.Maximum {
+			c.addf(location, "must be less than %v", *schema.Maximum)
+		} else if n > *schema.Maximum {
+			c.addf(location, "must be at most %v", *schema.Maximum)
+		}
+	}
+	if schema.ExclusiveMaximum.value != nil && n >= *schema.ExclusiveMaximum.value {
+		c.addf(location, "must be less than %v", *schema.ExclusiveMaximum.value)
+	}
+
+	if schema.MultipleOf != nil && *schema.MultipleOf > 0 {
+		quotient := n / *schema.MultipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			c.addf(location, "must be a multiple of %v", *schema.MultipleOf)
+		}
+	}
+}
+
+// validateArray applies array keywords and validates the items.
+func (c *schemaCheck) validateArray(schema *openAPISchema, value []any, location string, depth int) {
+	if schema.MinItems != nil && len(value) < *schema.MinItems {
+		c.addf(location, "must have at least %d items", *schema.MinItems)
+	}
+	if schema.MaxItems != nil && len(value) > *schema.MaxItems {
+		c.addf(location, "must have at most %d items", *schema.MaxItems)
+	}
+
+	if schema.UniqueItems {
+		for i := range value {
+			for j := i + 1; j < len(value); j++ {
+				if reflect.DeepEqual(normalizeJSONValue(value[i]), normalizeJSONValue(value[j])) {
+					c.addf(location, "items %d and %d are equal", i, j)
+				}
+			}
+		}
+	}
+
+	if schema.Items != nil {
+		for i, item := range value {
+			c.validate(schema.Items, item, fmt.Sprintf("%s[%d]", location, i), depth+1)
+		}
+	}
+}
+
+// validateObject applies object keywords and validates the properties.
+func (c *schemaCheck) validateObject(schema *openAPISchema, value map[string]any, location string, depth int) {
+	if schema.MinProperties != nil && len(value) < *schema.MinProperties {
+		c.addf(location, "must have at least %d properties", *schema.MinProperties)
+	}
+	if schema.MaxProperties != nil && len(value) > *schema.MaxProperties {
+		c.addf(location, "must have at most %d properties", *schema.MaxProperties)
+	}
+
+	for _, name := range schema.Required {
+		if _, ok := value[name]; ok {
+			continue
+		}
+		// readOnly properties are not sent in requests, writeOnly ones are
+		// not returned in responses.
+		if prop := c.doc.resolve(schema.Properties[name]); prop != nil &&
+			((prop.ReadOnly && !c.response) || (prop.WriteOnly && c.response)) {
+			continue
+		}
+		c.addf(joinLocation(location, name), "is required")
+	}
+
+	names := make([]string, 0, len(value))
+	for name := range value {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if prop, ok := schema.Properties[name]; ok {
+			c.validate(prop, value[name], joinLocation(location, name), depth+1)
+			continue
+		}
+		if schema.AdditionalProperties == nil {
+			continue
+		}
+		if !schema.AdditionalProperties.allowed {
+			c.addf(joinLocation(location, name), "is not allowed")
+		} else if schema.AdditionalProperties.schema != nil {
+			c.validate(schema.AdditionalProperties.schema, value[name], joinLocation(location, name), depth+1)
+		}
+	}
+}
+
+// joinLocation appends a property name to a location.
+func joinLocation(location, name string) string {
+	if location == "" {
+		return name
+	}
+	return location + "." + name
+}
+
+// jsonKind returns the JSON Schema type name of a decoded value.
+func jsonKind(value any) string {
+	switch v := value.(type) {
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return "null"
+	}
+}
+
+// typeMatches reports whether kind satisfies one of the schema types.
+func typeMatches(types []string, kind string, value any) bool {
+	for _, t := range types {
+		switch {
+		case t == kind:
+			return true
+		case t == "number" && kind == "integer":
+			return true
+		case t == "integer" && kind == "number":
+			// 1.0 is an integer in JSON Schema.
+			if n, err := value.(json.Number).Float64(); err == nil && n == math.Trunc(n) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// enumContains reports whether value equals one of the enum values.
+func enumContains(enum []any, value any) bool {
+	normalized := normalizeJSONValue(value)
+	for _, candidate := range enum {
+		if reflect.DeepEqual(normalizeJSONValue(candidate), normalized) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeJSONValue converts numbers to float64 so that values decoded
+// from JSON and YAML compare equal.
+func normalizeJSONValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		n, _ := v.Float64()
+		return n
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = normalizeJSONValue(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = normalizeJSONValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// openAPIUUIDPattern matches RFC 9562 UUIDs.
+var openAPIUUIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// formatMatches checks the string formats that are cheap to verify.
+// Unknown formats are accepted.
+func formatMatches(format, value string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	case "uuid":
+		return openAPIUUIDPattern.MatchString(value)
+	case "ipv4":
+		ip := net.ParseIP(value)
+		return ip != nil && ip.To4() != nil && !strings.Contains(value, ":")
+	case "ipv6":
+		ip := net.ParseIP(value)
+		return ip != nil && strings.Contains(value, ":")
+	default:
+		return true
+	}
+}
@@ -0,0 +1,513 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/albedosehen/rwwwrse/internal/observability"
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+// testOpenAPISpec is the API document used by the OpenAPI tests.
+const testOpenAPISpec = `
+openapi: 3.0.3
+info: {title: Users, version: "1"}
+servers:
+  - url: https://api.example.com/v1
+paths:
+  /users:
+    get:
+      operationId: listUsers
+      parameters:
+        - name: limit
+          in: query
+          schema: {type: integer, minimum: 1, maximum: 100}
+        - name: role
+          in: query
+          schema:
+            type: array
+            items: {type: string, enum: [admin, member]}
+      responses:
+        "200":
+          description: ok
+    post:
+      operationId: createUser
+      parameters:
+        - $ref: '#/components/parameters/Tenant'
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema: {$ref: '#/components/schemas/User'}
+      responses:
+        "201":
+          description: created
+          content:
+            application/json:
+              schema: {$ref: '#/components/schemas/User'}
+  /users/me:
+    get:
+      operationId: currentUser
+      responses:
+        "200": {description: ok}
+  /users/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema: {type: integer, minimum: 1}
+    get:
+      operationId: getUser
+      responses:
+        "200": {description: ok}
+components:
+  parameters:
+    Tenant:
+      name: X-Tenant
+      in: header
+      required: true
+      schema: {type: string, pattern: '^[a-z]+$'}
+  schemas:
+    User:
+      type: object
+      additionalProperties: false
+      required: [id, name]
+      properties:
+        id: {type: integer, readOnly: true}
+        name: {type: string, minLength: 1}
+        email: {type: string, format: email}
+        age: {type: integer, minimum: 0, nullable: true}
+`
+
+// writeTestOpenAPISpec writes the test document and returns its path.
+func writeTestOpenAPISpec(t *testing.T, spec string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "openapi.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(spec), 0o600))
+	return path
+}
+
+// newTestOpenAPIHandler wraps a handler that echoes the request body in an
+// OpenAPI middleware for the test document.
+func newTestOpenAPIHandler(
+	t *testing.T,
+	mutate func(*OpenAPIConfig),
+	metrics *testhelpers.MockMetricsCollector,
+	backend http.HandlerFunc,
+) http.Handler {
+	t.Helper()
+
+	config := DefaultOpenAPIConfig()
+	config.Name = "api.example.com"
+	config.SpecFile = writeTestOpenAPISpec(t, testOpenAPISpec)
+	mutate(&config)
+
+	// A nil mock must not become a non-nil interface.
+	var collector observability.MetricsCollector
+	if metrics != nil {
+		collector = metrics
+	}
+	mw, err := NewOpenAPIMiddleware(config, nil, collector)
+	require.NoError(t, err)
+
+	if backend == nil {
+		backend = func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write(body)
+		}
+	}
+	return mw.Wrap(backend)
+}
+
+func TestOpenAPIMiddleware_Requests(t *testing.T) {
+	tests := []struct {
+		name               string
+		method             string
+		target             string
+		header             http.Header
+		body               string
+		expectedStatus     int
+		expectedViolations []string
+	}{
+		{
+			name:           "Requests_ValidPathParameter_Passes",
+			method:         http.MethodGet,
+			target:         "/v1/users/42",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:               "Requests_NonIntegerPathParameter_Rejected",
+			method:             http.MethodGet,
+			target:             "/v1/users/abc",
+			expectedStatus:     http.StatusBadRequest,
+			expectedViolations: []string{"path.id: expected integer"},
+		},
+		{
+			name:               "Requests_PathParameterBelowMinimum_Rejected",
+			method:             http.MethodGet,
+			target:             "/v1/users/0",
+			expectedStatus:     http.StatusBadRequest,
+			expectedViolations: []string{"path.id: must be at least 1"},
+		},
+		{
+			name:           "Requests_ConcretePathBeforeTemplate_Passes",
+			method:         http.MethodGet,
+			target:         "/v1/users/me",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:               "Requests_QueryAboveMaximum_Rejected",
+			method:             http.MethodGet,
+			target:             "/v1/users?limit=500&role=admin&role=guest",
+			expectedStatus:     http.StatusBadRequest,
+			expectedViolations: []string{"query.limit: must be at most 100", "query.role[1]: value is not one of the allowed values"},
+		},
+		{
+			name:           "Requests_ValidBody_PassesWithBody",
+			method:         http.MethodPost,
+			target:         "/v1/users",
+			header:         http.Header{"Content-Type": {"application/json"}, "X-Tenant": {"acme"}},
+			body:           `{"name":"Ada","email":"ada@example.com","age":null}`,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Requests_InvalidBody_Rejected",
+			method:         http.MethodPost,
+			target:         "/v1/users",
+			header:         http.Header{"Content-Type": {"application/json"}, "X-Tenant": {"acme"}},
+			body:           `{"email":"not-an-email","age":-1,"admin":true}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedViolations: []string{
+				"body.name: is required",
+				"body.admin: is not allowed",
+				"body.age: must be at least 0",
+				"body.email: is not a valid email",
+			},
+		},
+		{
+			name:               "Requests_MissingBodyAndHeader_Rejected",
+			method:             http.MethodPost,
+			target:             "/v1/users",
+			expectedStatus:     http.StatusBadRequest,
+			expectedViolations: []string{"header.X-Tenant: is required", "body: is required"},
+		},
+		{
+			name:               "Requests_UnsupportedContentType_Rejected",
+			method:             http.MethodPost,
+			target:             "/v1/users",
+			header:             http.Header{"Content-Type": {"text/plain"}, "X-Tenant": {"acme"}},
+			body:               "name=Ada",
+			expectedStatus:     http.StatusBadRequest,
+			expectedViolations: []string{`body: unsupported content type "text/plain"`},
+		},
+		{
+			name:           "Requests_UnknownOperation_PassesThrough",
+			method:         http.MethodDelete,
+			target:         "/v1/users/42",
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	handler := newTestOpenAPIHandler(t, func(*OpenAPIConfig) {}, nil, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(tt.method, "https://api.example.com"+tt.target, strings.NewReader(tt.body))
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.body, rec.Body.String())
+				return
+			}
+
+			var response struct {
+				Code       string   `json:"code"`
+				Violations []string `json:"violations"`
+			}
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+			assert.Equal(t, "request_invalid", response.Code)
+			assert.ElementsMatch(t, tt.expectedViolations, response.Violations)
+		})
+	}
+}
+
+func TestOpenAPIMiddleware_MonitorMode_PassesInvalidRequests(t *testing.T) {
+	// Arrange
+	metrics := testhelpers.NewMockMetricsCollector()
+	metrics.On("RecordOpenAPIViolation", "api.example.com", "request").Return().Once()
+	handler := newTestOpenAPIHandler(t, func(c *OpenAPIConfig) { c.Mode = OpenAPIModeMonitor }, metrics, nil)
+	rec := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/users/abc", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+	metrics.AssertExpectations(t)
+}
+
+func TestOpenAPIMiddleware_RejectUnknown(t *testing.T) {
+	// Arrange
+	handler := newTestOpenAPIHandler(t, func(c *OpenAPIConfig) { c.RejectUnknown = true }, nil, nil)
+	rec := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/orders", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "no operation for GET /v1/orders")
+}
+
+func TestOpenAPIMiddleware_ResponseSampling(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		body            string
+		expectViolation bool
+	}{
+		{
+			name:   "ResponseSampling_MatchingResponse_NoViolation",
+			status: http.StatusCreated,
+			body:   `{"id":7,"name":"Ada"}`,
+		},
+		{
+			name:            "ResponseSampling_MissingRequiredProperty_Recorded",
+			status:          http.StatusCreated,
+			body:            `{"name":"Ada"}`,
+			expectViolation: true,
+		},
+		{
+			name:            "ResponseSampling_UndocumentedStatus_Recorded",
+			status:          http.StatusConflict,
+			body:            `{"error":"exists"}`,
+			expectViolation: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			metrics := testhelpers.NewMockMetricsCollector()
+			if tt.expectViolation {
+				metrics.On("RecordOpenAPIViolation", "api.example.com", "response").Return().Once()
+			}
+			handler := newTestOpenAPIHandler(t, func(c *OpenAPIConfig) { c.ResponseSampleRate = 1 }, metrics,
+				func(w http.ResponseWriter, r *http.Request) {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(tt.status)
+					_, _ = w.Write([]byte(tt.body))
+				})
+			req := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(`{"name":"Ada"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Tenant", "acme")
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, tt.body, rec.Body.String())
+			metrics.AssertExpectations(t)
+		})
+	}
+}
+
+func TestOpenAPIMiddleware_ResponseSampling_ResponseController(t *testing.T) {
+	// Arrange
+	metrics := testhelpers.NewMockMetricsCollector()
+	var deadlineErr error
+	handler := newTestOpenAPIHandler(t, func(c *OpenAPIConfig) { c.ResponseSampleRate = 1 }, metrics,
+		func(w http.ResponseWriter, r *http.Request) {
+			deadlineErr = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Minute))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":7,"name":"Ada"}`))
+		})
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/users", strings.NewReader(`{"name":"Ada"}`))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant", "acme")
+
+	// Act
+	resp, err := server.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// Assert
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.NoError(t, deadlineErr)
+	metrics.AssertExpectations(t)
+}
+
+func TestSchemaCheck_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		schema      string
+		value       string
+		expectValid bool
+	}{
+		{
+			name:        "Validate_TypeListWithNull_AcceptsNull",
+			schema:      `{type: [string, "null"]}`,
+			value:       `null`,
+			expectValid: true,
+		},
+		{
+			name:   "Validate_ExclusiveMinimumNumber_RejectsBound",
+			schema: `{type: number, exclusiveMinimum: 0}`,
+			value:  `0`,
+		},
+		{
+			name:        "Validate_IntegerWithZeroFraction_Accepted",
+			schema:      `{type: integer}`,
+			value:       `2.0`,
+			expectValid: true,
+		},
+		{
+			name:   "Validate_OneOfMatchingBoth_Rejected",
+			schema: `{oneOf: [{type: integer}, {type: number}]}`,
+			value:  `3`,
+		},
+		{
+			name:        "Validate_AnyOfMatchingOne_Accepted",
+			schema:      `{anyOf: [{type: string}, {type: integer}]}`,
+			value:       `3`,
+			expectValid: true,
+		},
+		{
+			name:   "Validate_UniqueItemsDuplicate_Rejected",
+			schema: `{type: array, uniqueItems: true}`,
+			value:  `[1, 1.0]`,
+		},
+		{
+			name:   "Validate_NotMatching_Rejected",
+			schema: `{not: {type: string}}`,
+			value:  `"x"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			doc, err := parseOpenAPIDocument([]byte("openapi: 3.1.0\npaths: {}\ncomponents:\n  schemas:\n    S: " + tt.schema))
+			require.NoError(t, err)
+			value, err := decodeJSONValue([]byte(tt.value))
+			require.NoError(t, err)
+			check := &schemaCheck{doc: doc}
+
+			// Act
+			check.validate(doc.Components.Schemas["S"], value, "body", 0)
+
+			// Assert
+			assert.Equal(t, tt.expectValid, len(check.violations) == 0, check.violations)
+		})
+	}
+}
+
+func TestParseOpenAPIDocument_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+	}{
+		{
+			name: "Parse_Swagger2_ReturnsError",
+			spec: "swagger: \"2.0\"\npaths: {}",
+		},
+		{
+			name: "Parse_UnresolvedReference_ReturnsError",
+			spec: "openapi: 3.0.0\npaths:\n  /a:\n    post:\n      requestBody:\n        content:\n          application/json:\n            schema: {$ref: '#/components/schemas/Missing'}",
+		},
+		{
+			name: "Parse_InvalidPattern_ReturnsError",
+			spec: "openapi: 3.0.0\npaths: {}\ncomponents:\n  schemas:\n    S: {type: string, pattern: '('}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			_, err := parseOpenAPIDocument([]byte(tt.spec))
+
+			// Assert
+			assert.ErrorIs(t, err, ErrInvalidOpenAPISpec)
+		})
+	}
+}
+
+func TestOpenAPIValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*OpenAPIConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*OpenAPIConfig) {},
+		},
+		{
+			name:        "Validate_MissingSpec_ReturnsError",
+			mutate:      func(c *OpenAPIConfig) { c.SpecFile = "" },
+			expectedErr: ErrOpenAPISpecRequired,
+		},
+		{
+			name:        "Validate_UnknownMode_ReturnsError",
+			mutate:      func(c *OpenAPIConfig) { c.Mode = "block" },
+			expectedErr: ErrInvalidOpenAPIMode,
+		},
+		{
+			name:        "Validate_RelativeBasePath_ReturnsError",
+			mutate:      func(c *OpenAPIConfig) { c.BasePath = "v1" },
+			expectedErr: ErrInvalidOpenAPIBasePath,
+		},
+		{
+			name:        "Validate_SampleRateAboveOne_ReturnsError",
+			mutate:      func(c *OpenAPIConfig) { c.ResponseSampleRate = 2 },
+			expectedErr: ErrInvalidOpenAPISampleRate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultOpenAPIConfig()
+			config.SpecFile = "/etc/rwwwrse/api.yaml"
+			tt.mutate(&config)
+
+			// Act
+			err := NewOpenAPIValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
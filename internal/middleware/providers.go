@@ -4,12 +4,15 @@ package middleware
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/google/wire"
 
+	"github.com/albedosehen/rwwwrse/internal/cache"
 	"github.com/albedosehen/rwwwrse/internal/config"
+	"github.com/albedosehen/rwwwrse/internal/headers"
 	"github.com/albedosehen/rwwwrse/internal/observability"
 )
 
@@ -48,6 +51,26 @@ func NewDefaultLoggingMiddleware(
 	}
 }
 
+// NewDefaultClientIPMiddleware creates a client IP resolution middleware with Wire.
+func NewDefaultClientIPMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	clientIPConfig := DefaultClientIPConfig()
+	clientIPConfig.TrustedProxies = cfg.Security.ClientIP.TrustedProxies
+	clientIPConfig.PreserveForwardedHeaders = cfg.Security.ClientIP.PreserveForwardedHeaders
+	if cfg.Security.ClientIP.Header != "" {
+		clientIPConfig.Header = cfg.Security.ClientIP.Header
+	}
+
+	mw, err := NewClientIPMiddleware(clientIPConfig, logger)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create client IP middleware: %v", err))
+	}
+	return mw
+}
+
 // NewDefaultCORSMiddleware creates a CORS middleware with Wire.
 func NewDefaultCORSMiddleware(
 	logger observability.Logger,
@@ -60,6 +83,46 @@ func NewDefaultCORSMiddleware(
 	}
 }
 
+// NewRouteCORSMiddleware creates the per-route CORS middleware with Wire.
+// Routes with a CORS policy use it instead of the global CORS handling,
+// passthrough routes leave CORS to the backend, and all other routes use
+// the global CORS middleware.
+func NewRouteCORSMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		switch route.CORS.Mode {
+		case config.CORSModePassthrough:
+			routes[host] = MiddlewareFunc(func(next http.Handler) http.Handler { return next })
+		case config.CORSModePolicy:
+			corsConfig := DefaultCORSConfig()
+			corsConfig.AllowedOrigins = route.CORS.AllowedOrigins
+			corsConfig.AllowedOriginPatterns = route.CORS.AllowedOriginPatterns
+			if len(route.CORS.AllowedMethods) > 0 {
+				corsConfig.AllowedMethods = route.CORS.AllowedMethods
+			}
+			if len(route.CORS.AllowedHeaders) > 0 {
+				corsConfig.AllowedHeaders = route.CORS.AllowedHeaders
+			}
+			corsConfig.ExposedHeaders = route.CORS.ExposedHeaders
+			corsConfig.AllowCredentials = route.CORS.AllowCredentials
+			corsConfig.MaxAge = route.CORS.MaxAge
+			corsConfig.OptionsPassthrough = route.CORS.OptionsPassthrough
+
+			mw, err := NewCORSPolicyMiddleware(corsConfig, logger, metrics)
+			if err != nil {
+				panic(fmt.Sprintf("failed to create CORS middleware for route %s: %v", host, err))
+			}
+			routes[host] = mw
+		}
+	}
+
+	return NewRouteMiddlewareWithFallback(routes, NewDefaultCORSMiddleware(logger, metrics))
+}
+
 // NewDefaultSecurityHeadersMiddleware creates a security headers middleware with Wire.
 func NewDefaultSecurityHeadersMiddleware(
 	logger observability.Logger,
@@ -72,6 +135,31 @@ func NewDefaultSecurityHeadersMiddleware(
 	}
 }
 
+// NewGlobalSecurityHeadersMiddleware creates the global security headers
+// middleware, replacing the built-in Permissions-Policy and cross-origin
+// isolation policies with the configured values.
+func NewGlobalSecurityHeadersMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	security := DefaultSecurityConfig()
+	if v := cfg.Security.Headers.PermissionsPolicy; v != "" {
+		security.PermissionsPolicy = v
+	}
+	if v := cfg.Security.Headers.CrossOriginOpenerPolicy; v != "" {
+		security.CrossOriginOpenerPolicy = v
+	}
+	if v := cfg.Security.Headers.CrossOriginEmbedderPolicy; v != "" {
+		security.CrossOriginEmbedderPolicy = v
+	}
+	if v := cfg.Security.Headers.CrossOriginResourcePolicy; v != "" {
+		security.CrossOriginResourcePolicy = v
+	}
+
+	return NewSecurityHeadersMiddlewareWithConfig(security, logger, metrics)
+}
+
 // NewDefaultRateLimitMiddleware creates a rate limiting middleware with Wire.
 func NewDefaultRateLimitMiddleware(
 	cfg *config.Config,
@@ -79,9 +167,10 @@ func NewDefaultRateLimitMiddleware(
 	metrics observability.MetricsCollector,
 ) Middleware {
 	// Create rate limiter with configuration
-	limiter := NewDefaultTokenBucketRateLimiter(logger)
+	limiter := NewRateLimiterFromConfig(cfg, logger)
 
 	return &rateLimitMiddleware{
+		policy:  globalRateLimitPolicy,
 		limiter: limiter,
 		keyFunc: defaultKeyFunc,
 		logger:  logger,
@@ -89,6 +178,971 @@ func NewDefaultRateLimitMiddleware(
 	}
 }
 
+// NewDefaultBanMiddleware creates the client ban middleware with Wire.
+// When banning is disabled requests are passed through unchanged.
+func NewDefaultBanMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	bans := cfg.Security.Bans
+	if !bans.Enabled {
+		return MiddlewareFunc(func(next http.Handler) http.Handler { return next })
+	}
+
+	banConfig := DefaultBanConfig()
+	banConfig.BanTime = bans.BanTime
+	banConfig.MaxBanTime = bans.MaxBanTime
+	banConfig.Multiplier = bans.Multiplier
+	banConfig.EscalationWindow = bans.EscalationWindow
+	banConfig.Allowlist = bans.Allowlist
+	banConfig.PersistPath = bans.PersistPath
+	banConfig.AdminPath = bans.AdminPath
+	banConfig.AdminHost = bans.AdminHost
+	banConfig.AdminToken = bans.AdminToken
+	if len(bans.Rules) > 0 {
+		banConfig.Rules = nil
+		for _, rule := range bans.Rules {
+			banConfig.Rules = append(banConfig.Rules, BanRule{
+				Event:     rule.Event,
+				Threshold: rule.Threshold,
+				Window:    rule.Window,
+			})
+		}
+	}
+
+	mw, err := NewBanMiddleware(banConfig, logger, metrics)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create ban middleware: %v", err))
+	}
+	return mw
+}
+
+// NewDefaultCSPReportMiddleware creates the CSP violation report endpoint with Wire.
+// When report collection is disabled requests are passed through unchanged.
+func NewDefaultCSPReportMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	reports := cfg.Security.CSPReports
+	if !reports.Enabled {
+		return MiddlewareFunc(func(next http.Handler) http.Handler { return next })
+	}
+
+	reportConfig := DefaultCSPReportConfig()
+	if reports.Path != "" {
+		reportConfig.Path = reports.Path
+	}
+	reportConfig.DedupeWindow = reports.DedupeWindow
+	if reports.MaxBodySize > 0 {
+		reportConfig.MaxBodySize = reports.MaxBodySize
+	}
+	for host := range cfg.Backends.Routes {
+		reportConfig.Routes = append(reportConfig.Routes, host)
+	}
+
+	mw, err := NewCSPReportMiddleware(reportConfig, logger, metrics)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create CSP report middleware: %v", err))
+	}
+	return mw
+}
+
+// NewRouteHeaderProfileMiddleware creates the per-route security header profile middleware with Wire.
+// Routes without a profile keep the global security headers.
+func NewRouteHeaderProfileMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if route.HeaderProfile == "" {
+			continue
+		}
+
+		profile, ok := cfg.Security.HeaderProfiles[route.HeaderProfile]
+		if !ok {
+			panic(fmt.Sprintf("failed to create header profile middleware for route %s: unknown profile %q", host, route.HeaderProfile))
+		}
+
+		profileConfig := HeaderProfileConfig{
+			Name: route.HeaderProfile,
+			Headers: SecurityConfig{
+				ContentSecurityPolicy:     profile.ContentSecurityPolicy,
+				FrameOptions:              profile.FrameOptions,
+				ReferrerPolicy:            profile.ReferrerPolicy,
+				PermissionsPolicy:         profile.PermissionsPolicy,
+				CrossOriginOpenerPolicy:   profile.CrossOriginOpenerPolicy,
+				CrossOriginEmbedderPolicy: profile.CrossOriginEmbedderPolicy,
+				CrossOriginResourcePolicy: profile.CrossOriginResourcePolicy,
+			},
+			Set:    profile.Set,
+			Add:    profile.Add,
+			Remove: profile.Remove,
+		}
+		if profile.HSTS.MaxAge > 0 {
+			profileConfig.Headers.StrictTransportSecurity = headers.FormatHSTS(
+				profile.HSTS.MaxAge, profile.HSTS.IncludeSubdomains, profile.HSTS.Preload)
+		}
+
+		mw, err := NewHeaderProfileMiddleware(profileConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create header profile middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteCSPMiddleware creates the per-route Content-Security-Policy middleware with Wire.
+// Routes without a policy keep the global security headers.
+func NewRouteCSPMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.CSP.Enabled {
+			continue
+		}
+
+		cspConfig := DefaultCSPConfig()
+		cspConfig.Name = host
+		cspConfig.Policy = route.CSP.Policy
+		cspConfig.ReportOnly = route.CSP.ReportOnly
+		cspConfig.Nonce = route.CSP.Nonce
+		if route.CSP.NoncePlaceholder != "" {
+			cspConfig.NoncePlaceholder = route.CSP.NoncePlaceholder
+		}
+		if route.CSP.Report && cfg.Security.CSPReports.Enabled {
+			cspConfig.ReportPath = cfg.Security.CSPReports.Path
+		}
+
+		mw, err := NewCSPMiddleware(cspConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create CSP middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteAccessControlMiddleware creates the per-route IP access control middleware with Wire.
+// Routes without access control enabled are passed through unchanged.
+func NewRouteAccessControlMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.AccessControl.Enabled {
+			continue
+		}
+
+		accessConfig := DefaultAccessControlConfig()
+		accessConfig.GeoIPDatabase = route.AccessControl.GeoIPDatabase
+		if route.AccessControl.DefaultAction != "" {
+			accessConfig.DefaultAction = route.AccessControl.DefaultAction
+		}
+		for _, rule := range route.AccessControl.Rules {
+			accessConfig.Rules = append(accessConfig.Rules, AccessRule{
+				Name:      rule.Name,
+				Action:    rule.Action,
+				CIDRs:     rule.CIDRs,
+				Countries: rule.Countries,
+			})
+		}
+
+		mw, err := NewAccessControlMiddleware(accessConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create access control middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteOIDCMiddleware creates the per-route OIDC login middleware with Wire.
+// Routes without OIDC enabled are passed through unchanged.
+func NewRouteOIDCMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.OIDC.Enabled {
+			continue
+		}
+
+		oidcConfig := DefaultOIDCConfig()
+		oidcConfig.IssuerURL = route.OIDC.IssuerURL
+		oidcConfig.ClientID = route.OIDC.ClientID
+		oidcConfig.ClientSecret = route.OIDC.ClientSecret
+		oidcConfig.RedirectURL = route.OIDC.RedirectURL
+		oidcConfig.PostLogoutRedirectURL = route.OIDC.PostLogoutRedirectURL
+		oidcConfig.CookieSecret = route.OIDC.CookieSecret
+		oidcConfig.CookieDomain = route.OIDC.CookieDomain
+		if route.OIDC.CookieSecure != nil {
+			oidcConfig.CookieSecure = *route.OIDC.CookieSecure
+		}
+		oidcConfig.AllowedEmailDomains = route.OIDC.AllowedEmailDomains
+		oidcConfig.AllowedGroups = route.OIDC.AllowedGroups
+		oidcConfig.AllowedUsers = route.OIDC.AllowedUsers
+		if route.OIDC.CallbackPath != "" {
+			oidcConfig.CallbackPath = route.OIDC.CallbackPath
+		}
+		if route.OIDC.LogoutPath != "" {
+			oidcConfig.LogoutPath = route.OIDC.LogoutPath
+		}
+		if len(route.OIDC.Scopes) > 0 {
+			oidcConfig.Scopes = route.OIDC.Scopes
+		}
+		if route.OIDC.CookieName != "" {
+			oidcConfig.CookieName = route.OIDC.CookieName
+		}
+		if route.OIDC.SessionTTL > 0 {
+			oidcConfig.SessionTTL = route.OIDC.SessionTTL
+		}
+		if route.OIDC.GroupsClaim != "" {
+			oidcConfig.GroupsClaim = route.OIDC.GroupsClaim
+		}
+
+		mw, err := NewOIDCMiddleware(oidcConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create OIDC middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteForwardAuthMiddleware creates the per-route forward auth middleware with Wire.
+// Routes without forward auth enabled are passed through unchanged.
+func NewRouteForwardAuthMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.ForwardAuth.Enabled {
+			continue
+		}
+
+		authConfig := DefaultForwardAuthConfig()
+		authConfig.URL = route.ForwardAuth.URL
+		authConfig.RequestHeaders = route.ForwardAuth.RequestHeaders
+		authConfig.ResponseHeaders = route.ForwardAuth.ResponseHeaders
+		authConfig.CacheTTL = route.ForwardAuth.CacheTTL
+		if route.ForwardAuth.Timeout > 0 {
+			authConfig.Timeout = route.ForwardAuth.Timeout
+		}
+		if len(route.ForwardAuth.CacheKeyHeaders) > 0 {
+			authConfig.CacheKeyHeaders = route.ForwardAuth.CacheKeyHeaders
+		}
+
+		mw, err := NewForwardAuthMiddleware(authConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create forward auth middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteBasicAuthMiddleware creates the per-route basic auth middleware with Wire.
+// Routes without basic auth enabled are passed through unchanged.
+func NewRouteBasicAuthMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.BasicAuth.Enabled {
+			continue
+		}
+
+		authConfig := DefaultBasicAuthConfig()
+		authConfig.HTPasswdFile = route.BasicAuth.HTPasswdFile
+		if route.BasicAuth.Realm != "" {
+			authConfig.Realm = route.BasicAuth.Realm
+		}
+		if route.BasicAuth.UserHeader != "" {
+			authConfig.UserHeader = route.BasicAuth.UserHeader
+		}
+		if route.BasicAuth.MaxFailures > 0 {
+			authConfig.MaxFailures = route.BasicAuth.MaxFailures
+		}
+		if route.BasicAuth.FailureInterval > 0 {
+			authConfig.FailureInterval = route.BasicAuth.FailureInterval
+		}
+
+		mw, err := NewBasicAuthMiddleware(authConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create basic auth middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteAPIKeyMiddleware creates the per-route API key middleware with Wire.
+// Routes without API keys enabled are passed through unchanged.
+func NewRouteAPIKeyMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.APIKey.Enabled {
+			continue
+		}
+
+		keyConfig := DefaultAPIKeyConfig()
+		keyConfig.KeysFile = route.APIKey.KeysFile
+		keyConfig.QueryParam = route.APIKey.QueryParam
+		if route.APIKey.Realm != "" {
+			keyConfig.Realm = route.APIKey.Realm
+		}
+		if route.APIKey.Header != "" {
+			keyConfig.Header = route.APIKey.Header
+		}
+		if route.APIKey.UserHeader != "" {
+			keyConfig.UserHeader = route.APIKey.UserHeader
+		}
+		if route.APIKey.MaxFailures > 0 {
+			keyConfig.MaxFailures = route.APIKey.MaxFailures
+		}
+		if route.APIKey.FailureInterval > 0 {
+			keyConfig.FailureInterval = route.APIKey.FailureInterval
+		}
+
+		mw, err := NewAPIKeyMiddleware(keyConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create API key middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRateLimiterFromConfig creates the rate limiter selected by the rate limit
+// backend: the in-memory token bucket or the distributed Redis-backed limiter.
+func NewRateLimiterFromConfig(
+	cfg *config.Config,
+	logger observability.Logger,
+) RateLimiter {
+	if cfg == nil || cfg.RateLimit.Backend != config.RateLimitBackendRedis {
+		return NewDefaultTokenBucketRateLimiter(logger)
+	}
+
+	redisConfig := newRedisRateLimiterConfig(cfg)
+	redisConfig.RequestsPerSecond = cfg.RateLimit.RequestsPerSecond
+	redisConfig.BurstSize = cfg.RateLimit.BurstSize
+
+	limiter, err := NewRedisRateLimiter(redisConfig, logger)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create distributed rate limiter: %v", err))
+	}
+
+	return limiter
+}
+
+// NewRateLimiterFactoryFromConfig creates the factory backing rate limit
+// policies on the configured backend. Limiters are shared by name so that
+// routes using the same policy share its counters.
+func NewRateLimiterFactoryFromConfig(
+	cfg *config.Config,
+	logger observability.Logger,
+) RateLimiterFactory {
+	create := NewMemoryRateLimiterFactory(logger)
+	if cfg != nil && cfg.RateLimit.Backend == config.RateLimitBackendRedis {
+		create = func(name string, rule RateLimitRule) (RateLimiter, error) {
+			redisConfig := newRedisRateLimiterConfig(cfg)
+			redisConfig.KeyPrefix += name + ":"
+			redisConfig.RequestsPerSecond = rule.RequestsPerSecond()
+			redisConfig.BurstSize = rule.Burst
+			redisConfig.Window = rule.Period
+			return NewRedisRateLimiter(redisConfig, logger)
+		}
+	}
+
+	var mu sync.Mutex
+	limiters := make(map[string]RateLimiter)
+
+	return func(name string, rule RateLimitRule) (RateLimiter, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if limiter, ok := limiters[name]; ok {
+			return limiter, nil
+		}
+
+		limiter, err := create(name, rule)
+		if err != nil {
+			return nil, err
+		}
+		limiters[name] = limiter
+		return limiter, nil
+	}
+}
+
+// newRedisRateLimiterConfig maps the store settings of the rate limit configuration.
+func newRedisRateLimiterConfig(cfg *config.Config) RedisRateLimiterConfig {
+	redisConfig := DefaultRedisRateLimiterConfig()
+	redisConfig.Address = cfg.RateLimit.Redis.Address
+	redisConfig.Username = cfg.RateLimit.Redis.Username
+	redisConfig.Password = cfg.RateLimit.Redis.Password
+	redisConfig.DB = cfg.RateLimit.Redis.DB
+	redisConfig.TLS = cfg.RateLimit.Redis.TLS
+	if cfg.RateLimit.Redis.KeyPrefix != "" {
+		redisConfig.KeyPrefix = cfg.RateLimit.Redis.KeyPrefix
+	}
+	if cfg.RateLimit.Redis.DialTimeout > 0 {
+		redisConfig.DialTimeout = cfg.RateLimit.Redis.DialTimeout
+	}
+	if cfg.RateLimit.Redis.Timeout > 0 {
+		redisConfig.Timeout = cfg.RateLimit.Redis.Timeout
+	}
+	if cfg.RateLimit.Redis.PoolSize > 0 {
+		redisConfig.PoolSize = cfg.RateLimit.Redis.PoolSize
+	}
+	if cfg.RateLimit.Algorithm != "" {
+		redisConfig.Algorithm = cfg.RateLimit.Algorithm
+	}
+	if cfg.RateLimit.Window > 0 {
+		redisConfig.Window = cfg.RateLimit.Window
+	}
+	if cfg.RateLimit.FailureMode != "" {
+		redisConfig.FailureMode = cfg.RateLimit.FailureMode
+	}
+	return redisConfig
+}
+
+// NewRouteRateLimitMiddleware creates the per-route rate limit policy middleware with Wire.
+// Routes without rate limit policies are passed through unchanged.
+func NewRouteRateLimitMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	factory := NewRateLimiterFactoryFromConfig(cfg, logger)
+
+	policy := func(name string) RateLimitPolicy {
+		policyConfig := cfg.RateLimit.Policies[name]
+		policy := RateLimitPolicy{Name: name, Key: policyConfig.Key}
+		for _, limit := range policyConfig.Limits {
+			policy.Limits = append(policy.Limits, RateLimitRule{
+				Requests: limit.Requests,
+				Period:   limit.Period,
+				Burst:    limit.Burst,
+			})
+		}
+		return policy
+	}
+
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if route.RateLimit.Policy == "" && len(route.RateLimit.Paths) == 0 {
+			continue
+		}
+
+		policyConfig := RateLimitPolicyConfig{}
+		if route.RateLimit.Policy != "" {
+			policyConfig.Policy = policy(route.RateLimit.Policy)
+		}
+		for _, path := range route.RateLimit.Paths {
+			policyConfig.Paths = append(policyConfig.Paths, RateLimitPathPolicy{
+				PathPrefix: path.Path,
+				Policy:     policy(path.Policy),
+			})
+		}
+
+		mw, err := NewRateLimitPolicyMiddleware(policyConfig, factory, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create rate limit policy middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteConcurrencyMiddleware creates the per-route adaptive concurrency limit middleware with Wire.
+// Routes without concurrency limiting enabled are passed through unchanged.
+func NewRouteConcurrencyMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.Concurrency.Enabled {
+			continue
+		}
+
+		concurrencyConfig := DefaultConcurrencyConfig()
+		concurrencyConfig.Name = host
+		if route.Concurrency.Algorithm != "" {
+			concurrencyConfig.Algorithm = route.Concurrency.Algorithm
+		}
+		if route.Concurrency.InitialLimit > 0 {
+			concurrencyConfig.InitialLimit = route.Concurrency.InitialLimit
+		}
+		if route.Concurrency.MinLimit > 0 {
+			concurrencyConfig.MinLimit = route.Concurrency.MinLimit
+		}
+		if route.Concurrency.MaxLimit > 0 {
+			concurrencyConfig.MaxLimit = route.Concurrency.MaxLimit
+		}
+		if route.Concurrency.LatencyThreshold > 0 {
+			concurrencyConfig.LatencyThreshold = route.Concurrency.LatencyThreshold
+		}
+		// Default limits yield to the ones the route sets, so setting only
+		// one bound never leaves the others outside it.
+		if concurrencyConfig.MaxLimit < concurrencyConfig.MinLimit {
+			if route.Concurrency.MaxLimit > 0 {
+				concurrencyConfig.MinLimit = concurrencyConfig.MaxLimit
+			} else {
+				concurrencyConfig.MaxLimit = concurrencyConfig.MinLimit
+			}
+		}
+		if concurrencyConfig.InitialLimit < concurrencyConfig.MinLimit {
+			concurrencyConfig.InitialLimit = concurrencyConfig.MinLimit
+		}
+		if concurrencyConfig.InitialLimit > concurrencyConfig.MaxLimit {
+			concurrencyConfig.InitialLimit = concurrencyConfig.MaxLimit
+		}
+		if route.Concurrency.BackoffRatio > 0 {
+			concurrencyConfig.BackoffRatio = route.Concurrency.BackoffRatio
+		}
+		if route.Concurrency.QueueSize != nil {
+			concurrencyConfig.QueueSize = *route.Concurrency.QueueSize
+		}
+		if route.Concurrency.QueueTimeout > 0 {
+			concurrencyConfig.QueueTimeout = route.Concurrency.QueueTimeout
+		}
+		if route.Concurrency.RetryAfter > 0 {
+			concurrencyConfig.RetryAfter = route.Concurrency.RetryAfter
+		}
+		concurrencyConfig.DefaultPriority = route.Concurrency.DefaultPriority
+		for _, rule := range route.Concurrency.Priorities {
+			concurrencyConfig.Priorities = append(concurrencyConfig.Priorities, ConcurrencyPriorityRule{
+				PathPrefix: rule.PathPrefix,
+				Header:     rule.Header,
+				Value:      rule.Value,
+				Priority:   rule.Priority,
+			})
+		}
+
+		mw, err := NewConcurrencyMiddleware(concurrencyConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create concurrency middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteWAFMiddleware creates the per-route web application firewall middleware with Wire.
+// Routes without the WAF enabled are passed through unchanged.
+func NewRouteWAFMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.WAF.Enabled {
+			continue
+		}
+
+		wafConfig := DefaultWAFConfig()
+		wafConfig.Name = host
+		if route.WAF.Mode != "" {
+			wafConfig.Mode = route.WAF.Mode
+		}
+		if route.WAF.CoreRules != nil {
+			wafConfig.CoreRules = *route.WAF.CoreRules
+		}
+		wafConfig.RuleFiles = route.WAF.RuleFiles
+		wafConfig.Rules = route.WAF.Rules
+		if route.WAF.AnomalyThreshold > 0 {
+			wafConfig.AnomalyThreshold = route.WAF.AnomalyThreshold
+		}
+		if route.WAF.BodyLimit > 0 {
+			wafConfig.BodyLimit = route.WAF.BodyLimit
+		}
+		for _, exclusion := range route.WAF.Exclusions {
+			wafConfig.Exclusions = append(wafConfig.Exclusions, WAFExclusion{
+				PathPrefix: exclusion.PathPrefix,
+				RuleIDs:    exclusion.RuleIDs,
+				Tags:       exclusion.Tags,
+				Targets:    exclusion.Targets,
+			})
+		}
+
+		mw, err := NewWAFMiddleware(wafConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create WAF middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteWebhookMiddleware creates the per-route webhook signature middleware with Wire.
+// Routes without webhook verification enabled are passed through unchanged.
+func NewRouteWebhookMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.Webhook.Enabled {
+			continue
+		}
+
+		webhookConfig := DefaultWebhookConfig()
+		webhookConfig.Name = host
+		webhookConfig.Preset = route.Webhook.Preset
+		webhookConfig.Scheme = WebhookScheme{
+			Header:          route.Webhook.Header,
+			Algorithm:       route.Webhook.Algorithm,
+			Encoding:        route.Webhook.Encoding,
+			Prefix:          route.Webhook.Prefix,
+			SignatureParam:  route.Webhook.SignatureParam,
+			TimestampParam:  route.Webhook.TimestampParam,
+			TimestampHeader: route.Webhook.TimestampHeader,
+			Payload:         route.Webhook.Payload,
+			Tolerance:       route.Webhook.Tolerance,
+		}
+		webhookConfig.Secret = route.Webhook.Secret
+		webhookConfig.SecretEnv = route.Webhook.SecretEnv
+		webhookConfig.SecretFile = route.Webhook.SecretFile
+		webhookConfig.Paths = route.Webhook.Paths
+		if route.Webhook.MaxBodySize > 0 {
+			webhookConfig.MaxBodySize = route.Webhook.MaxBodySize
+		}
+		webhookConfig.ReplayWindow = route.Webhook.ReplayWindow
+
+		mw, err := NewWebhookMiddleware(webhookConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create webhook middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteOpenAPIMiddleware creates the per-route OpenAPI validation middleware with Wire.
+// Routes without OpenAPI validation enabled are passed through unchanged.
+func NewRouteOpenAPIMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.OpenAPI.Enabled {
+			continue
+		}
+
+		openAPIConfig := DefaultOpenAPIConfig()
+		openAPIConfig.Name = host
+		openAPIConfig.SpecFile = route.OpenAPI.Spec
+		if route.OpenAPI.Mode != "" {
+			openAPIConfig.Mode = route.OpenAPI.Mode
+		}
+		openAPIConfig.BasePath = route.OpenAPI.BasePath
+		openAPIConfig.RejectUnknown = route.OpenAPI.RejectUnknown
+		if route.OpenAPI.MaxBodySize > 0 {
+			openAPIConfig.MaxBodySize = route.OpenAPI.MaxBodySize
+		}
+		openAPIConfig.ResponseSampleRate = route.OpenAPI.ResponseSampleRate
+
+		mw, err := NewOpenAPIMiddleware(openAPIConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create OpenAPI middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewDefaultStrictHTTPMiddleware creates the strict HTTP middleware with Wire.
+// When strict parsing is disabled requests are passed through unchanged.
+func NewDefaultStrictHTTPMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	if !cfg.Server.StrictHTTP.Enabled {
+		return MiddlewareFunc(func(next http.Handler) http.Handler { return next })
+	}
+
+	strictConfig := DefaultStrictHTTPConfig()
+	strictConfig.ExtraMethods = cfg.Server.StrictHTTP.ExtraMethods
+	if cfg.Server.StrictHTTP.DotSegments != "" {
+		strictConfig.DotSegments = cfg.Server.StrictHTTP.DotSegments
+	}
+	if cfg.Server.StrictHTTP.EncodedSlashes != "" {
+		strictConfig.EncodedSlashes = cfg.Server.StrictHTTP.EncodedSlashes
+	}
+
+	mw, err := NewStrictHTTPMiddleware(strictConfig, logger, metrics)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create strict HTTP middleware: %v", err))
+	}
+	return mw
+}
+
+// NewRouteRequestLimitsMiddleware creates the per-route request limits middleware with Wire.
+// Routes without request limits enabled are passed through unchanged.
+func NewRouteRequestLimitsMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.Limits.Enabled {
+			continue
+		}
+
+		limitsConfig := DefaultRequestLimitsConfig()
+		limitsConfig.Name = host
+		limitsConfig.MaxBodySize = route.Limits.MaxBodySize
+		limitsConfig.MaxHeaderBytes = route.Limits.MaxHeaderBytes
+		limitsConfig.MaxHeaderCount = route.Limits.MaxHeaderCount
+		limitsConfig.MaxURLLength = route.Limits.MaxURLLength
+		limitsConfig.MaxQueryParams = route.Limits.MaxQueryParams
+		limitsConfig.MinUploadRate = route.Limits.MinUploadRate
+		if route.Limits.UploadGracePeriod > 0 {
+			limitsConfig.UploadGracePeriod = route.Limits.UploadGracePeriod
+		}
+
+		mw, err := NewRequestLimitsMiddleware(limitsConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create request limits middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteErrorPagesMiddleware creates the per-route error pages middleware with Wire.
+// Routes without custom error pages use the built-in representations.
+func NewRouteErrorPagesMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if len(route.ErrorPages) == 0 {
+			continue
+		}
+
+		pagesConfig := DefaultErrorPagesConfig()
+		pagesConfig.Name = host
+		for key, path := range route.ErrorPages {
+			pagesConfig.Pages[key] = path
+		}
+
+		mw, err := NewErrorPagesMiddleware(pagesConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create error pages middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewRouteCompressionMiddleware creates the per-route response compression middleware with Wire.
+// Routes without compression enabled are passed through unchanged.
+func NewRouteCompressionMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.Compression.Enabled {
+			continue
+		}
+
+		compressionConfig := DefaultCompressionConfig()
+		compressionConfig.Name = host
+		if len(route.Compression.Encodings) > 0 {
+			compressionConfig.Encodings = route.Compression.Encodings
+		}
+		if route.Compression.GzipLevel > 0 {
+			compressionConfig.GzipLevel = route.Compression.GzipLevel
+		}
+		if route.Compression.ZstdLevel > 0 {
+			compressionConfig.ZstdLevel = route.Compression.ZstdLevel
+		}
+		if route.Compression.BrotliLevel > 0 {
+			compressionConfig.BrotliLevel = route.Compression.BrotliLevel
+		}
+		if route.Compression.MinSize > 0 {
+			compressionConfig.MinSize = route.Compression.MinSize
+		}
+		if len(route.Compression.ContentTypes) > 0 {
+			compressionConfig.ContentTypes = route.Compression.ContentTypes
+		}
+
+		mw, err := NewCompressionMiddleware(compressionConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create compression middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewCacheStoreFromConfig creates the shared response store with Wire.
+// It returns nil when the cache is disabled.
+func NewCacheStoreFromConfig(cfg *config.Config) *cache.Store {
+	if !cfg.Cache.Enabled {
+		return nil
+	}
+
+	store, err := cache.NewStore(cache.StoreConfig{
+		MaxBytes:     cfg.Cache.MaxBytes,
+		DiskPath:     cfg.Cache.DiskPath,
+		DiskMaxBytes: cfg.Cache.DiskMaxBytes,
+	})
+	if err != nil {
+		panic(fmt.Sprintf("failed to create cache store: %v", err))
+	}
+	return store
+}
+
+// NewRouteCacheMiddleware creates the per-route response cache middleware with Wire.
+// Routes without caching enabled are passed through unchanged.
+func NewRouteCacheMiddleware(
+	cfg *config.Config,
+	store *cache.Store,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.Cache.Enabled || store == nil {
+			continue
+		}
+
+		cacheConfig := DefaultCacheConfig()
+		cacheConfig.Name = host
+		if cfg.Cache.MaxEntrySize > 0 {
+			cacheConfig.MaxEntrySize = cfg.Cache.MaxEntrySize
+		}
+		cacheConfig.TTL = route.Cache.TTL
+		cacheConfig.DefaultTTL = route.Cache.DefaultTTL
+		cacheConfig.StaleWhileRevalidate = route.Cache.StaleWhileRevalidate
+		cacheConfig.StaleIfError = route.Cache.StaleIfError
+
+		mw, err := NewCacheMiddleware(cacheConfig, store, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create cache middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
+// NewDefaultCachePurgeMiddleware creates the cache purge API with Wire.
+// When the cache or its purge path is not configured requests are passed through unchanged.
+func NewDefaultCachePurgeMiddleware(
+	cfg *config.Config,
+	store *cache.Store,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	if store == nil || cfg.Cache.PurgePath == "" {
+		return MiddlewareFunc(func(next http.Handler) http.Handler { return next })
+	}
+
+	mw, err := NewCachePurgeMiddleware(CachePurgeConfig{
+		Path:  cfg.Cache.PurgePath,
+		Host:  cfg.Cache.PurgeHost,
+		Token: cfg.Cache.PurgeToken,
+	}, store, logger, metrics)
+	if err != nil {
+		panic(fmt.Sprintf("failed to create cache purge middleware: %v", err))
+	}
+	return mw
+}
+
+// NewRouteCSRFMiddleware creates the per-route CSRF protection middleware with Wire.
+// Routes without CSRF protection enabled are passed through unchanged.
+func NewRouteCSRFMiddleware(
+	cfg *config.Config,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) Middleware {
+	routes := make(map[string]Middleware)
+	for host, route := range cfg.Backends.Routes {
+		if !route.CSRF.Enabled {
+			continue
+		}
+
+		csrfConfig := DefaultCSRFConfig()
+		csrfConfig.Name = host
+		if route.CSRF.Mode != "" {
+			csrfConfig.Mode = route.CSRF.Mode
+		}
+		csrfConfig.TrustedOrigins = route.CSRF.TrustedOrigins
+		csrfConfig.ExemptPaths = route.CSRF.ExemptPaths
+		if route.CSRF.CookieName != "" {
+			csrfConfig.CookieName = route.CSRF.CookieName
+		}
+		csrfConfig.CookieDomain = route.CSRF.CookieDomain
+		if route.CSRF.CookieSecure != nil {
+			csrfConfig.CookieSecure = *route.CSRF.CookieSecure
+		}
+		if route.CSRF.HeaderName != "" {
+			csrfConfig.HeaderName = route.CSRF.HeaderName
+		}
+		if route.CSRF.FormField != "" {
+			csrfConfig.FormField = route.CSRF.FormField
+		}
+
+		mw, err := NewCSRFMiddleware(csrfConfig, logger, metrics)
+		if err != nil {
+			panic(fmt.Sprintf("failed to create CSRF middleware for route %s: %v", host, err))
+		}
+		routes[host] = mw
+	}
+
+	return NewRouteMiddleware(routes)
+}
+
 // NewDefaultTokenBucketRateLimiter creates a token bucket rate limiter with Wire.
 func NewDefaultTokenBucketRateLimiter(
 	logger observability.Logger,
@@ -405,23 +1459,90 @@ func CreateCompleteMiddlewareChain(
 	metrics observability.MetricsCollector,
 ) Chain {
 	chain := NewMiddlewareChain()
+	cacheStore := NewCacheStoreFromConfig(cfg)
 
 	// Add middleware in order (they will be executed in reverse order)
 
-	// 1. Recovery (outermost - catches panics from all other middleware)
-	chain.Use(NewDefaultRecoveryMiddleware(logger, metrics))
+	// 1. Error pages (outermost - every error response, including recovered panics, uses the route's renderer)
+	chain = chain.Use(NewRouteErrorPagesMiddleware(cfg, logger, metrics))
+
+	// 2. Recovery (catches panics from all other middleware)
+	chain = chain.Use(NewDefaultRecoveryMiddleware(logger, metrics))
+
+	// 3. Client IP resolution (must precede everything that uses the client address)
+	chain = chain.Use(NewDefaultClientIPMiddleware(cfg, logger, metrics))
+
+	// 4. Logging (logs all requests/responses)
+	chain = chain.Use(NewDefaultLoggingMiddleware(logger, metrics))
+
+	// 5. Compression (encodes responses from everything below; logging sees the bytes sent)
+	chain = chain.Use(NewRouteCompressionMiddleware(cfg, logger, metrics))
+
+	// 6. Ban check (rejects banned clients early and collects offenses from later middleware)
+	chain = chain.Use(NewDefaultBanMiddleware(cfg, logger, metrics))
+
+	// 7. IP access control (rejects disallowed networks before the admin endpoints and route work)
+	chain = chain.Use(NewRouteAccessControlMiddleware(cfg, logger, metrics))
+
+	// 8. Strict HTTP parsing (rejects ambiguous requests, normalizes hop-by-hop headers)
+	chain = chain.Use(NewDefaultStrictHTTPMiddleware(cfg, logger, metrics))
+
+	// 9. Request limits (rejects oversized requests and slow uploads per route)
+	chain = chain.Use(NewRouteRequestLimitsMiddleware(cfg, logger, metrics))
+
+	// 10. CSP violation reports (terminal endpoint for browser reports)
+	chain = chain.Use(NewDefaultCSPReportMiddleware(cfg, logger, metrics))
+
+	// 11. Cache purge API (terminal endpoint for purging stored responses)
+	chain = chain.Use(NewDefaultCachePurgeMiddleware(cfg, cacheStore, logger, metrics))
+
+	// 12. Security headers (sets security headers)
+	chain = chain.Use(NewGlobalSecurityHeadersMiddleware(cfg, logger, metrics))
+
+	// 13. Security header profiles (per-route overrides of the global headers)
+	chain = chain.Use(NewRouteHeaderProfileMiddleware(cfg, logger, metrics))
+
+	// 14. Route Content-Security-Policy (overrides the global policy, adds nonces)
+	chain = chain.Use(NewRouteCSPMiddleware(cfg, logger, metrics))
+
+	// 15. CORS (handles cross-origin requests with global or per-route policies)
+	chain = chain.Use(NewRouteCORSMiddleware(cfg, logger, metrics))
+
+	// 16. Rate limiting
+	chain = chain.Use(NewDefaultRateLimitMiddleware(cfg, logger, metrics))
+
+	// 17. Rate limit policies (named per-route and per-path limits, before authentication)
+	chain = chain.Use(NewRouteRateLimitMiddleware(cfg, logger, metrics))
+
+	// 18. Web application firewall (inspects request line, headers and body)
+	chain = chain.Use(NewRouteWAFMiddleware(cfg, logger, metrics))
+
+	// 19. OIDC login (authenticates browser sessions per route)
+	chain = chain.Use(NewRouteOIDCMiddleware(cfg, logger, metrics))
+
+	// 20. Forward auth (consults external authorization per route)
+	chain = chain.Use(NewRouteForwardAuthMiddleware(cfg, logger, metrics))
+
+	// 21. Basic auth (htpasswd credentials per route)
+	chain = chain.Use(NewRouteBasicAuthMiddleware(cfg, logger, metrics))
+
+	// 22. API keys (hashed key file per route)
+	chain = chain.Use(NewRouteAPIKeyMiddleware(cfg, logger, metrics))
+
+	// 23. Webhook signatures (HMAC verification of inbound webhooks per route)
+	chain = chain.Use(NewRouteWebhookMiddleware(cfg, logger, metrics))
 
-	// 2. Logging (logs all requests/responses)
-	chain.Use(NewDefaultLoggingMiddleware(logger, metrics))
+	// 24. CSRF protection (origin and token checks for unsafe methods per route)
+	chain = chain.Use(NewRouteCSRFMiddleware(cfg, logger, metrics))
 
-	// 3. Security headers (sets security headers)
-	chain.Use(NewDefaultSecurityHeadersMiddleware(logger, metrics))
+	// 25. OpenAPI validation (rejects requests that do not match the route's API document)
+	chain = chain.Use(NewRouteOpenAPIMiddleware(cfg, logger, metrics))
 
-	// 4. CORS (handles cross-origin requests)
-	chain.Use(NewDefaultCORSMiddleware(logger, metrics))
+	// 26. Response cache (answers validated requests from the shared store)
+	chain = chain.Use(NewRouteCacheMiddleware(cfg, cacheStore, logger, metrics))
 
-	// 5. Rate limiting (innermost - closest to business logic)
-	chain.Use(NewDefaultRateLimitMiddleware(cfg, logger, metrics))
+	// 27. Concurrency limiting (innermost - adaptive in-flight cap per backend)
+	chain = chain.Use(NewRouteConcurrencyMiddleware(cfg, logger, metrics))
 
 	return chain
 }
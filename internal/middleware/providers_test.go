@@ -4,6 +4,9 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,6 +15,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/albedosehen/rwwwrse/internal/config"
+	"github.com/albedosehen/rwwwrse/internal/observability"
 	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
 )
 
@@ -420,12 +424,287 @@ func TestDefaultMiddlewareConfig(t *testing.T) {
 	}
 }
 
+func TestNewRouteConcurrencyMiddleware_QueueDefaults(t *testing.T) {
+	tests := []struct {
+		name                 string
+		queueSize            *int
+		queueTimeout         time.Duration
+		expectedQueueSize    int
+		expectedQueueTimeout time.Duration
+	}{
+		{
+			name:                 "QueueDefaults_Unset_Defaults",
+			expectedQueueSize:    100,
+			expectedQueueTimeout: time.Second,
+		},
+		{
+			name:                 "QueueDefaults_OnlySize_DefaultTimeout",
+			queueSize:            intPtr(10),
+			expectedQueueSize:    10,
+			expectedQueueTimeout: time.Second,
+		},
+		{
+			name:                 "QueueDefaults_Both_Configured",
+			queueSize:            intPtr(10),
+			queueTimeout:         5 * time.Second,
+			expectedQueueSize:    10,
+			expectedQueueTimeout: 5 * time.Second,
+		},
+		{
+			name:                 "QueueDefaults_ZeroSize_Kept",
+			queueSize:            intPtr(0),
+			expectedQueueSize:    0,
+			expectedQueueTimeout: time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			route := config.BackendRoute{}
+			route.Concurrency = config.ConcurrencyConfig{
+				Enabled:      true,
+				InitialLimit: 10,
+				MinLimit:     1,
+				MaxLimit:     100,
+				QueueSize:    tt.queueSize,
+				QueueTimeout: tt.queueTimeout,
+			}
+			cfg := &config.Config{}
+			cfg.Backends.Routes = map[string]config.BackendRoute{"app.example.com": route}
+
+			// Act
+			mw := NewRouteConcurrencyMiddleware(cfg, nil, nil)
+
+			// Assert
+			concurrency := mw.(*routeMiddleware).routes["app.example.com"].(*concurrencyMiddleware)
+			assert.Equal(t, tt.expectedQueueSize, concurrency.config.QueueSize)
+			assert.Equal(t, tt.expectedQueueTimeout, concurrency.config.QueueTimeout)
+		})
+	}
+}
+
+func TestNewRouteConcurrencyMiddleware_LimitDefaults(t *testing.T) {
+	tests := []struct {
+		name                 string
+		concurrency          config.ConcurrencyConfig
+		expectedInitialLimit int
+		expectedMinLimit     int
+		expectedMaxLimit     int
+		expectedBackoffRatio float64
+	}{
+		{
+			name:                 "LimitDefaults_GradientUnset_Defaults",
+			concurrency:          config.ConcurrencyConfig{Enabled: true, Algorithm: "gradient"},
+			expectedInitialLimit: 20,
+			expectedMinLimit:     1,
+			expectedMaxLimit:     200,
+			expectedBackoffRatio: 0.9,
+		},
+		{
+			name:                 "LimitDefaults_OnlyMaxLimit_DefaultsOthers",
+			concurrency:          config.ConcurrencyConfig{Enabled: true, MaxLimit: 50},
+			expectedInitialLimit: 20,
+			expectedMinLimit:     1,
+			expectedMaxLimit:     50,
+			expectedBackoffRatio: 0.9,
+		},
+		{
+			name:                 "LimitDefaults_OnlyLowMaxLimit_ClampsInitial",
+			concurrency:          config.ConcurrencyConfig{Enabled: true, MaxLimit: 10},
+			expectedInitialLimit: 10,
+			expectedMinLimit:     1,
+			expectedMaxLimit:     10,
+			expectedBackoffRatio: 0.9,
+		},
+		{
+			name:                 "LimitDefaults_OnlyHighMinLimit_ClampsInitial",
+			concurrency:          config.ConcurrencyConfig{Enabled: true, MinLimit: 50},
+			expectedInitialLimit: 50,
+			expectedMinLimit:     50,
+			expectedMaxLimit:     200,
+			expectedBackoffRatio: 0.9,
+		},
+		{
+			name:                 "LimitDefaults_MinLimitAboveDefaultMax_RaisesMax",
+			concurrency:          config.ConcurrencyConfig{Enabled: true, MinLimit: 300},
+			expectedInitialLimit: 300,
+			expectedMinLimit:     300,
+			expectedMaxLimit:     300,
+			expectedBackoffRatio: 0.9,
+		},
+		{
+			name: "LimitDefaults_AIMDConfigured_Kept",
+			concurrency: config.ConcurrencyConfig{
+				Enabled:      true,
+				Algorithm:    "aimd",
+				InitialLimit: 5,
+				MinLimit:     2,
+				MaxLimit:     10,
+				BackoffRatio: 0.5,
+			},
+			expectedInitialLimit: 5,
+			expectedMinLimit:     2,
+			expectedMaxLimit:     10,
+			expectedBackoffRatio: 0.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			route := config.BackendRoute{Concurrency: tt.concurrency}
+			cfg := &config.Config{}
+			cfg.Backends.Routes = map[string]config.BackendRoute{"app.example.com": route}
+
+			// Act
+			mw := NewRouteConcurrencyMiddleware(cfg, nil, nil)
+
+			// Assert
+			concurrency := mw.(*routeMiddleware).routes["app.example.com"].(*concurrencyMiddleware)
+			assert.Equal(t, tt.expectedInitialLimit, concurrency.config.InitialLimit)
+			assert.Equal(t, tt.expectedMinLimit, concurrency.config.MinLimit)
+			assert.Equal(t, tt.expectedMaxLimit, concurrency.config.MaxLimit)
+			assert.Equal(t, tt.expectedBackoffRatio, concurrency.config.BackoffRatio)
+		})
+	}
+}
+
+func TestNewRouteOIDCMiddleware_CookieSecure(t *testing.T) {
+	tests := []struct {
+		name           string
+		cookieSecure   *bool
+		expectedSecure bool
+	}{
+		{
+			name:           "CookieSecure_Unset_KeepsSecureDefault",
+			expectedSecure: true,
+		},
+		{
+			name:           "CookieSecure_False_Overrides",
+			cookieSecure:   boolPtr(false),
+			expectedSecure: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			provider := newMockOIDCProvider(t)
+			cfg := &config.Config{}
+			cfg.Backends.Routes = map[string]config.BackendRoute{
+				"app.example.com": {
+					URL: "http://backend.internal",
+					OIDC: config.OIDCConfig{
+						Enabled:      true,
+						IssuerURL:    provider.server.URL,
+						ClientID:     provider.clientID,
+						ClientSecret: "client-secret",
+						CookieSecret: testOIDCCookieSecret,
+						CookieSecure: tt.cookieSecure,
+					},
+				},
+			}
+
+			// Act
+			mw := NewRouteOIDCMiddleware(cfg, nil, nil)
+
+			// Assert
+			oidc := mw.(*routeMiddleware).routes["app.example.com"].(*oidcMiddleware)
+			assert.Equal(t, tt.expectedSecure, oidc.config.CookieSecure)
+		})
+	}
+}
+
+func TestNewRouteCSRFMiddleware_CookieSecure(t *testing.T) {
+	tests := []struct {
+		name           string
+		cookieSecure   *bool
+		expectedSecure bool
+	}{
+		{
+			name:           "CookieSecure_Unset_KeepsSecureDefault",
+			expectedSecure: true,
+		},
+		{
+			name:           "CookieSecure_False_Overrides",
+			cookieSecure:   boolPtr(false),
+			expectedSecure: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			cfg := &config.Config{}
+			cfg.Backends.Routes = map[string]config.BackendRoute{
+				"app.example.com": {
+					URL:  "http://backend.internal",
+					CSRF: config.CSRFConfig{Enabled: true, Mode: "double_submit", CookieSecure: tt.cookieSecure},
+				},
+			}
+
+			// Act
+			mw := NewRouteCSRFMiddleware(cfg, nil, nil)
+
+			// Assert
+			csrf := mw.(*routeMiddleware).routes["app.example.com"].(*csrfMiddleware)
+			assert.Equal(t, tt.expectedSecure, csrf.config.CookieSecure)
+		})
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+// newChainTestMetrics returns a metrics mock that accepts every call the
+// complete middleware chain makes while serving a request.
+func newChainTestMetrics() *testhelpers.MockMetricsCollector {
+	metrics := testhelpers.NewMockMetricsCollector()
+	metrics.On("RecordRequest", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("RecordHistogram", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("RecordCounter", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("RecordGauge", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("SetActiveBans", mock.Anything).Return().Maybe()
+	metrics.On("RecordBan", mock.Anything).Return().Maybe()
+	metrics.On("RecordRateLimitHit", mock.Anything).Return().Maybe()
+	metrics.On("RecordAccessDenied", mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("SetConcurrencyLimit", mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("SetConcurrencyQueueDepth", mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("RecordLoadShed", mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("RecordWAFRuleMatch", mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("RecordWAFDecision", mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("RecordWebhookVerificationFailure", mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("RecordOpenAPIViolation", mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("RecordRequestLimitExceeded", mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("RecordCompression", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	metrics.On("RecordCacheLookup", mock.Anything, mock.Anything).Return().Maybe()
+	return metrics
+}
+
 func TestCreateCompleteMiddlewareChain(t *testing.T) {
 	tests := []struct {
-		name string
+		name            string
+		path            string
+		expectedStatus  int
+		expectedReached bool
 	}{
 		{
-			name: "CreateCompleteMiddlewareChain_WithValidDeps",
+			name:            "CreateCompleteMiddlewareChain_Request_SecurityHeadersSet",
+			path:            "/",
+			expectedStatus:  http.StatusOK,
+			expectedReached: true,
+		},
+		{
+			name:            "CreateCompleteMiddlewareChain_BanAdminPath_AnsweredByBanMiddleware",
+			path:            "/_bans",
+			expectedStatus:  http.StatusUnauthorized,
+			expectedReached: false,
 		},
 	}
 
@@ -433,15 +712,345 @@ func TestCreateCompleteMiddlewareChain(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Arrange
 			cfg := &config.Config{}
-			logger := testhelpers.NewMockLogger()
-			metrics := testhelpers.NewMockMetricsCollector()
+			cfg.Security.Bans = config.BanConfig{
+				Enabled:    true,
+				BanTime:    time.Minute,
+				MaxBanTime: time.Hour,
+				Multiplier: 2,
+				AdminPath:  "/_bans",
+				AdminHost:  "example.com",
+				AdminToken: "secret",
+			}
+			logger := observability.NewLogger(observability.LoggingConfig{Level: observability.LevelError, Output: "stderr"})
+			metrics := newChainTestMetrics()
+
+			reached := false
+			handler := CreateCompleteMiddlewareChain(cfg, logger, metrics).Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached = true
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
 
 			// Act
-			chain := CreateCompleteMiddlewareChain(cfg, logger, metrics)
+			handler.ServeHTTP(rec, req)
 
 			// Assert
-			assert.NotNil(t, chain)
-			assert.Implements(t, (*Chain)(nil), chain)
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, tt.expectedReached, reached)
+			assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+		})
+	}
+}
+
+// writeChainTestFile writes content to a file in a temporary directory and
+// returns its path.
+func writeChainTestFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestCreateCompleteMiddlewareChain_RouteMiddlewares(t *testing.T) {
+	const host = "app.example.com"
+
+	tests := []struct {
+		name            string
+		configure       func(t *testing.T, cfg *config.Config, route *config.BackendRoute)
+		method          string
+		target          string
+		header          http.Header
+		backendStatus   int
+		requests        int
+		expectedStatus  int
+		expectedReached int
+		assert          func(t *testing.T, rec *httptest.ResponseRecorder, metrics *testhelpers.MockMetricsCollector)
+	}{
+		{
+			name: "RouteMiddlewares_ErrorPages_RendersRoutePage",
+			configure: func(t *testing.T, cfg *config.Config, route *config.BackendRoute) {
+				route.AccessControl = config.AccessControlConfig{Enabled: true, DefaultAction: "deny"}
+				route.ErrorPages = map[string]string{
+					"403": writeChainTestFile(t, "403.html", "<p>route page {{.Status}}</p>"),
+				}
+			},
+			header:          http.Header{"Accept": {"text/html"}},
+			expectedStatus:  http.StatusForbidden,
+			expectedReached: 0,
+			assert: func(t *testing.T, rec *httptest.ResponseRecorder, _ *testhelpers.MockMetricsCollector) {
+				assert.Contains(t, rec.Body.String(), "route page 403")
+			},
+		},
+		{
+			name: "RouteMiddlewares_Compression_EncodesResponse",
+			configure: func(_ *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.Compression = config.CompressionConfig{Enabled: true, Encodings: []string{"gzip"}}
+			},
+			header:          http.Header{"Accept-Encoding": {"gzip"}},
+			expectedStatus:  http.StatusOK,
+			expectedReached: 1,
+			assert: func(t *testing.T, rec *httptest.ResponseRecorder, _ *testhelpers.MockMetricsCollector) {
+				assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+			},
+		},
+		{
+			name: "RouteMiddlewares_RequestLimits_RejectsLongURL",
+			configure: func(_ *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.Limits = config.RequestLimitsConfig{Enabled: true, MaxURLLength: 16}
+			},
+			target:          "/" + strings.Repeat("a", 64),
+			expectedStatus:  http.StatusRequestURITooLong,
+			expectedReached: 0,
+		},
+		{
+			name: "RouteMiddlewares_HeaderProfile_OverridesGlobalHeaders",
+			configure: func(_ *testing.T, cfg *config.Config, route *config.BackendRoute) {
+				cfg.Security.HeaderProfiles = map[string]config.HeaderProfileConfig{
+					"embed": {FrameOptions: "SAMEORIGIN"},
+				}
+				route.HeaderProfile = "embed"
+			},
+			expectedStatus:  http.StatusOK,
+			expectedReached: 1,
+			assert: func(t *testing.T, rec *httptest.ResponseRecorder, _ *testhelpers.MockMetricsCollector) {
+				assert.Equal(t, "SAMEORIGIN", rec.Header().Get("X-Frame-Options"))
+			},
+		},
+		{
+			name: "RouteMiddlewares_CSP_SetsRoutePolicy",
+			configure: func(_ *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.CSP = config.CSPConfig{Enabled: true, Policy: "default-src 'none'"}
+			},
+			expectedStatus:  http.StatusOK,
+			expectedReached: 1,
+			assert: func(t *testing.T, rec *httptest.ResponseRecorder, _ *testhelpers.MockMetricsCollector) {
+				assert.Equal(t, "default-src 'none'", rec.Header().Get("Content-Security-Policy"))
+			},
+		},
+		{
+			name: "RouteMiddlewares_CORS_AllowsRouteOrigin",
+			configure: func(_ *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.CORS = config.CORSConfig{Mode: config.CORSModePolicy, AllowedOrigins: []string{"https://web.example.com"}}
+			},
+			header:          http.Header{"Origin": {"https://web.example.com"}},
+			expectedStatus:  http.StatusOK,
+			expectedReached: 1,
+			assert: func(t *testing.T, rec *httptest.ResponseRecorder, _ *testhelpers.MockMetricsCollector) {
+				assert.Equal(t, "https://web.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+			},
+		},
+		{
+			name: "RouteMiddlewares_AccessControl_RejectsDeniedNetwork",
+			configure: func(_ *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.AccessControl = config.AccessControlConfig{Enabled: true, DefaultAction: "deny"}
+			},
+			expectedStatus:  http.StatusForbidden,
+			expectedReached: 0,
+		},
+		{
+			name: "RouteMiddlewares_AccessControl_GuardsPurgeEndpoint",
+			configure: func(_ *testing.T, cfg *config.Config, route *config.BackendRoute) {
+				cfg.Cache = config.CacheConfig{Enabled: true, MaxBytes: 1 << 20, PurgePath: "/_purge", PurgeHost: host, PurgeToken: "secret"}
+				route.AccessControl = config.AccessControlConfig{Enabled: true, DefaultAction: "deny"}
+			},
+			method:          http.MethodPost,
+			target:          "/_purge",
+			expectedStatus:  http.StatusForbidden,
+			expectedReached: 0,
+		},
+		{
+			name: "RouteMiddlewares_RateLimitPolicy_RejectsOverLimit",
+			configure: func(_ *testing.T, cfg *config.Config, route *config.BackendRoute) {
+				cfg.RateLimit.Policies = map[string]config.RateLimitPolicyConfig{
+					"strict": {Limits: []config.RateLimitRuleConfig{{Requests: 1, Period: time.Minute}}},
+				}
+				route.RateLimit = config.RouteRateLimitConfig{Policy: "strict"}
+			},
+			requests:        2,
+			expectedStatus:  http.StatusTooManyRequests,
+			expectedReached: 1,
+		},
+		{
+			name: "RouteMiddlewares_WAF_BlocksAttack",
+			configure: func(_ *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.WAF = config.WAFConfig{Enabled: true}
+			},
+			target:          "/?q=%3Cscript%3Ealert(1)%3C%2Fscript%3E",
+			expectedStatus:  http.StatusForbidden,
+			expectedReached: 0,
+		},
+		{
+			name: "RouteMiddlewares_OIDC_RedirectsToProvider",
+			configure: func(t *testing.T, _ *config.Config, route *config.BackendRoute) {
+				provider := newMockOIDCProvider(t)
+				route.OIDC = config.OIDCConfig{
+					Enabled:      true,
+					IssuerURL:    provider.server.URL,
+					ClientID:     provider.clientID,
+					ClientSecret: "client-secret",
+					CookieSecret: testOIDCCookieSecret,
+				}
+			},
+			expectedStatus:  http.StatusFound,
+			expectedReached: 0,
+			assert: func(t *testing.T, rec *httptest.ResponseRecorder, _ *testhelpers.MockMetricsCollector) {
+				assert.Contains(t, rec.Header().Get("Location"), "/authorize")
+			},
+		},
+		{
+			name: "RouteMiddlewares_ForwardAuth_RejectsUnauthorized",
+			configure: func(t *testing.T, _ *config.Config, route *config.BackendRoute) {
+				var calls int32
+				route.ForwardAuth = config.ForwardAuthConfig{Enabled: true, URL: newForwardAuthServer(t, &calls).URL}
+			},
+			expectedStatus:  http.StatusUnauthorized,
+			expectedReached: 0,
+		},
+		{
+			name: "RouteMiddlewares_BasicAuth_ChallengesAnonymous",
+			configure: func(t *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.BasicAuth = config.BasicAuthConfig{
+					Enabled:      true,
+					HTPasswdFile: writeChainTestFile(t, "htpasswd", bcryptEntry(t, "alice", "secret")+"\n"),
+				}
+			},
+			expectedStatus:  http.StatusUnauthorized,
+			expectedReached: 0,
+			assert: func(t *testing.T, rec *httptest.ResponseRecorder, _ *testhelpers.MockMetricsCollector) {
+				assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Basic")
+			},
+		},
+		{
+			name: "RouteMiddlewares_APIKey_RejectsMissingKey",
+			configure: func(t *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.APIKey = config.APIKeyConfig{
+					Enabled:  true,
+					KeysFile: writeChainTestFile(t, "keys", sha256Entry("ci", "key-ci-0123456789")+"\n"),
+				}
+			},
+			expectedStatus:  http.StatusUnauthorized,
+			expectedReached: 0,
+		},
+		{
+			name: "RouteMiddlewares_Webhook_RejectsUnsignedBody",
+			configure: func(_ *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.Webhook = config.WebhookConfig{Enabled: true, Preset: "github", Secret: "webhook-secret"}
+			},
+			method:          http.MethodPost,
+			expectedStatus:  http.StatusUnauthorized,
+			expectedReached: 0,
+		},
+		{
+			name: "RouteMiddlewares_CSRF_RejectsCrossOriginPost",
+			configure: func(_ *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.CSRF = config.CSRFConfig{Enabled: true}
+			},
+			method:          http.MethodPost,
+			header:          http.Header{"Origin": {"https://evil.example.com"}},
+			expectedStatus:  http.StatusForbidden,
+			expectedReached: 0,
+		},
+		{
+			name: "RouteMiddlewares_OpenAPI_RejectsUnknownOperation",
+			configure: func(t *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.OpenAPI = config.OpenAPIConfig{
+					Enabled:       true,
+					Spec:          writeTestOpenAPISpec(t, testOpenAPISpec),
+					RejectUnknown: true,
+				}
+			},
+			target:          "/unknown",
+			expectedStatus:  http.StatusBadRequest,
+			expectedReached: 0,
+		},
+		{
+			name: "RouteMiddlewares_Cache_AnswersRepeatFromStore",
+			configure: func(_ *testing.T, cfg *config.Config, route *config.BackendRoute) {
+				cfg.Cache = config.CacheConfig{Enabled: true, MaxBytes: 1 << 20}
+				route.Cache = config.RouteCacheConfig{Enabled: true, TTL: time.Minute}
+			},
+			requests:        2,
+			expectedStatus:  http.StatusOK,
+			expectedReached: 1,
+		},
+		{
+			name: "RouteMiddlewares_Concurrency_BacksOffOnOverload",
+			configure: func(_ *testing.T, _ *config.Config, route *config.BackendRoute) {
+				route.Concurrency = config.ConcurrencyConfig{
+					Enabled:      true,
+					Algorithm:    "aimd",
+					InitialLimit: 20,
+					MinLimit:     1,
+					MaxLimit:     100,
+					BackoffRatio: 0.9,
+				}
+			},
+			backendStatus:   http.StatusServiceUnavailable,
+			expectedStatus:  http.StatusServiceUnavailable,
+			expectedReached: 1,
+			assert: func(t *testing.T, _ *httptest.ResponseRecorder, metrics *testhelpers.MockMetricsCollector) {
+				metrics.AssertCalled(t, "SetConcurrencyLimit", host, 18)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			cfg := &config.Config{}
+			route := config.BackendRoute{URL: "http://127.0.0.1:8080"}
+			tt.configure(t, cfg, &route)
+			cfg.Backends.Routes = map[string]config.BackendRoute{host: route}
+
+			logger := observability.NewLogger(observability.LoggingConfig{Level: observability.LevelError, Output: "stderr"})
+			metrics := newChainTestMetrics()
+
+			status := tt.backendStatus
+			if status == 0 {
+				status = http.StatusOK
+			}
+			reached := 0
+			handler := CreateCompleteMiddlewareChain(cfg, logger, metrics).Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				reached++
+				w.Header().Set("Content-Type", "text/plain")
+				w.Header().Set("Cache-Control", "public, max-age=60")
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(strings.Repeat("route middleware ", 128)))
+			}))
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			target := tt.target
+			if target == "" {
+				target = "/"
+			}
+			requests := tt.requests
+			if requests == 0 {
+				requests = 1
+			}
+
+			// Act
+			var rec *httptest.ResponseRecorder
+			for range requests {
+				req := httptest.NewRequest(method, "http://"+host+target, nil)
+				for name, values := range tt.header {
+					req.Header[name] = values
+				}
+				rec = httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+			}
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			assert.Equal(t, tt.expectedReached, reached)
+			if tt.assert != nil {
+				tt.assert(t, rec, metrics)
+			}
 		})
 	}
 }
@@ -589,21 +1198,8 @@ func TestCompleteMiddlewareChain_Integration(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Arrange
 			cfg := &config.Config{}
-			logger := testhelpers.NewMockLogger()
-			metrics := testhelpers.NewMockMetricsCollector()
-
-			// Mock logger calls that may occur during middleware execution
-			logger.On("Info",
-				mock.Anything,
-				mock.Anything,
-				mock.Anything,
-			).Return().Maybe()
-
-			logger.On("Debug",
-				mock.Anything,
-				mock.Anything,
-				mock.Anything,
-			).Return().Maybe()
+			logger := observability.NewLogger(observability.LoggingConfig{Level: observability.LevelError, Output: "stderr"})
+			metrics := newChainTestMetrics()
 
 			// Act
 			chain := CreateCompleteMiddlewareChain(cfg, logger, metrics)
@@ -4,14 +4,14 @@ package middleware
 import (
 	"context"
 	"fmt"
-	"net"
+	"math"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
 
 	"golang.org/x/time/rate"
 
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
 	"github.com/albedosehen/rwwwrse/internal/observability"
 )
 
@@ -28,6 +28,12 @@ type tokenBucketRateLimiter struct {
 
 // NewTokenBucketRateLimiter creates a new token bucket rate limiter.
 func NewTokenBucketRateLimiter(requestsPerSec float64, burstSize int, logger observability.Logger) RateLimiter {
+	return newTokenBucketRateLimiter(requestsPerSec, burstSize, logger)
+}
+
+// newTokenBucketRateLimiter creates a token bucket rate limiter and starts its
+// cleanup goroutine.
+func newTokenBucketRateLimiter(requestsPerSec float64, burstSize int, logger observability.Logger) *tokenBucketRateLimiter {
 	rl := &tokenBucketRateLimiter{
 		limiters:       make(map[string]*rate.Limiter),
 		requestsPerSec: rate.Limit(requestsPerSec),
@@ -60,27 +66,42 @@ func (rl *tokenBucketRateLimiter) Reset(key string) error {
 
 // Stats returns rate limiting statistics for a key.
 func (rl *tokenBucketRateLimiter) Stats(key string) RateLimitStats {
-	limiter := rl.getLimiter(key)
+	return rl.stats(rl.getLimiter(key))
+}
+
+// peekStats returns the statistics for key without creating a limiter for
+// it; ok is false when the key has no limiter yet.
+func (rl *tokenBucketRateLimiter) peekStats(key string) (stats RateLimitStats, ok bool) {
+	rl.mu.RLock()
+	limiter, exists := rl.limiters[key]
+	rl.mu.RUnlock()
 
-	// Calculate remaining tokens (approximate)
-	reservation := limiter.Reserve()
-	remaining := rl.burstSize
-	if !reservation.OK() {
+	if !exists {
+		return RateLimitStats{}, false
+	}
+	return rl.stats(limiter), true
+}
+
+// stats reads the statistics of limiter.
+func (rl *tokenBucketRateLimiter) stats(limiter *rate.Limiter) RateLimitStats {
+	// Read the available tokens without consuming any
+	remaining := int(limiter.Tokens())
+	if remaining < 0 {
 		remaining = 0
-	} else {
-		delay := reservation.Delay()
-		reservation.Cancel() // Cancel the reservation since we're just checking
+	}
 
-		if delay > 0 {
-			remaining = 0
-		}
+	// Time until the next token is added; computed in float to support
+	// rates below one request per second.
+	var interval time.Duration
+	if rl.requestsPerSec > 0 {
+		interval = time.Duration(float64(time.Second) / float64(rl.requestsPerSec))
 	}
 
 	return RateLimitStats{
 		Requests:   rl.burstSize - remaining,
 		Remaining:  remaining,
-		ResetTime:  time.Now().Add(time.Second / time.Duration(rl.requestsPerSec)),
-		RetryAfter: time.Second / time.Duration(rl.requestsPerSec),
+		ResetTime:  time.Now().Add(interval),
+		RetryAfter: interval,
 	}
 }
 
@@ -143,8 +164,12 @@ func (rl *tokenBucketRateLimiter) Stop() {
 	close(rl.stopCleanup)
 }
 
+// globalRateLimitPolicy names the global rate limit in metrics.
+const globalRateLimitPolicy = "global"
+
 // rateLimitMiddleware implements rate limiting middleware.
 type rateLimitMiddleware struct {
+	policy  string
 	limiter RateLimiter
 	keyFunc func(*http.Request) string
 	logger  observability.Logger
@@ -158,6 +183,7 @@ func NewRateLimitMiddleware(
 	metrics observability.MetricsCollector,
 ) Middleware {
 	return &rateLimitMiddleware{
+		policy:  globalRateLimitPolicy,
 		limiter: limiter,
 		keyFunc: defaultKeyFunc,
 		logger:  logger,
@@ -173,6 +199,7 @@ func NewRateLimitMiddlewareWithKeyFunc(
 	metrics observability.MetricsCollector,
 ) Middleware {
 	return &rateLimitMiddleware{
+		policy:  globalRateLimitPolicy,
 		limiter: limiter,
 		keyFunc: keyFunc,
 		logger:  logger,
@@ -199,6 +226,8 @@ func (m *rateLimitMiddleware) handleRateLimit(w http.ResponseWriter, r *http.Req
 	stats := m.limiter.Stats(key)
 	requestID := GetRequestID(r.Context())
 
+	ReportOffense(r, OffenseRateLimit)
+
 	// Log rate limit hit
 	if m.logger != nil {
 		m.logger.Warn(r.Context(), "Rate limit exceeded",
@@ -212,7 +241,7 @@ func (m *rateLimitMiddleware) handleRateLimit(w http.ResponseWriter, r *http.Req
 
 	// Record metrics
 	if m.metrics != nil {
-		m.metrics.RecordRateLimitHit(key)
+		m.metrics.RecordRateLimitHit(m.policy)
 	}
 
 	// Set rate limit headers
@@ -220,46 +249,16 @@ func (m *rateLimitMiddleware) handleRateLimit(w http.ResponseWriter, r *http.Req
 	w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", stats.Remaining))
 	w.Header().Set("X-RateLimit-Reset", fmt.Sprintf("%d", stats.ResetTime.Unix()))
 	w.Header().Set("Retry-After", fmt.Sprintf("%.0f", stats.RetryAfter.Seconds()))
+	w.Header().Set(HeaderRateLimitLimit, fmt.Sprintf("%d", stats.Requests+stats.Remaining))
+	w.Header().Set(HeaderRateLimitRemaining, fmt.Sprintf("%d", stats.Remaining))
+	w.Header().Set(HeaderRateLimitReset, fmt.Sprintf("%.0f", math.Ceil(time.Until(stats.ResetTime).Seconds())))
 
-	// Return 429 Too Many Requests
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusTooManyRequests)
-
-	response := fmt.Sprintf(`{
-		"error": "Rate limit exceeded",
-		"status": 429,
-		"request_id": "%s",
-		"retry_after": %.0f,
-		"timestamp": "%s"
-	}`, requestID, stats.RetryAfter.Seconds(), time.Now().UTC().Format(time.RFC3339))
-
-	_, _ = w.Write([]byte(response))
+	err := proxyerrors.WrapError(proxyerrors.ErrCodeRateLimited, "Rate limit exceeded", nil).
+		WithContext("retry_after", int64(math.Ceil(stats.RetryAfter.Seconds())))
+	writeErrorResponse(w, r, err)
 }
 
-// defaultKeyFunc extracts client IP from request for rate limiting.
+// defaultKeyFunc keys rate limits by the resolved client IP.
 func defaultKeyFunc(r *http.Request) string {
-	// Check for forwarded IP first
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// Take the first IP in the list
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			ip := strings.TrimSpace(ips[0])
-			if ip != "" {
-				return ip
-			}
-		}
-	}
-
-	// Check for real IP header
-	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
-		return realIP
-	}
-
-	// Fall back to remote address
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr
-	}
-
-	return host
+	return getClientIP(r)
 }
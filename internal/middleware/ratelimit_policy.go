@@ -0,0 +1,468 @@
+// Package middleware implements named rate limit policies with custom keys.
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// Rate limit key sources.
+const (
+	RateLimitKeyIP       = "ip"
+	RateLimitKeyHeader   = "header"
+	RateLimitKeyAPIKey   = "api_key"
+	RateLimitKeyJWTClaim = "jwt_claim"
+	RateLimitKeyCookie   = "cookie"
+)
+
+// defaultRateLimitAPIKeyHeader is read by the api_key source when no header is named.
+const defaultRateLimitAPIKeyHeader = "X-API-Key"
+
+// IETF rate limit response headers.
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+	HeaderRetryAfter         = "Retry-After"
+)
+
+// RateLimitRule allows Requests per Period.
+type RateLimitRule struct {
+	// Requests is the number of requests allowed per Period.
+	Requests int
+
+	// Period is the length of the quota window, such as time.Second or time.Hour.
+	Period time.Duration
+
+	// Burst is the number of requests that may arrive at once. Defaults to Requests.
+	Burst int
+}
+
+// RateLimitPolicy is a named set of limits applied to requests grouped by key.
+type RateLimitPolicy struct {
+	// Name identifies the policy in metrics, logs and limiter state.
+	Name string
+
+	// Key lists the sources combined into the rate limit key: "ip",
+	// "header:<name>", "api_key", "api_key:<header>", "jwt_claim:<claim>"
+	// and "cookie:<name>". Defaults to the client IP.
+	//
+	// API keys are hashed before use. JWT claims are read from the bearer
+	// token without verifying its signature, so they group requests but do
+	// not authenticate them.
+	Key []string
+
+	// Limits must all allow a request; they are checked in order.
+	Limits []RateLimitRule
+}
+
+// RateLimitPathPolicy applies a policy to requests under a path prefix.
+type RateLimitPathPolicy struct {
+	// PathPrefix such as "/api/"; the longest matching prefix wins.
+	PathPrefix string
+
+	// Policy applies to matching requests.
+	Policy RateLimitPolicy
+}
+
+// RateLimitPolicyConfig holds configuration for the policy rate limit middleware.
+type RateLimitPolicyConfig struct {
+	// Policy applies to requests matching no path policy. A policy without
+	// a name disables limiting for those requests.
+	Policy RateLimitPolicy
+
+	// Paths attach policies to path prefixes.
+	Paths []RateLimitPathPolicy
+}
+
+// RateLimiterFactory creates the limiter backing one limit of a policy. The
+// name is unique per policy limit, so factories may share limiters by name.
+// The rule's burst is already defaulted.
+type RateLimiterFactory func(name string, rule RateLimitRule) (RateLimiter, error)
+
+// NewMemoryRateLimiterFactory returns a factory of in-memory token bucket limiters.
+func NewMemoryRateLimiterFactory(logger observability.Logger) RateLimiterFactory {
+	return func(name string, rule RateLimitRule) (RateLimiter, error) {
+		return NewTokenBucketRateLimiter(rule.RequestsPerSecond(), rule.Burst, logger), nil
+	}
+}
+
+// RequestsPerSecond returns the sustained rate of the rule.
+func (r RateLimitRule) RequestsPerSecond() float64 {
+	return float64(r.Requests) / r.Period.Seconds()
+}
+
+// rateLimitKeySource extracts one component of a rate limit key.
+type rateLimitKeySource struct {
+	kind string
+	arg  string
+}
+
+// compiledRateLimit is a rule with its limiter.
+type compiledRateLimit struct {
+	rule    RateLimitRule
+	limiter RateLimiter
+}
+
+// compiledRateLimitPolicy is a policy ready to evaluate requests.
+type compiledRateLimitPolicy struct {
+	name   string
+	key    []rateLimitKeySource
+	limits []compiledRateLimit
+	quota  string
+}
+
+// compiledRateLimitPath is a path policy ready to evaluate requests.
+type compiledRateLimitPath struct {
+	prefix string
+	policy *compiledRateLimitPolicy
+}
+
+// rateLimitPolicyMiddleware enforces named rate limit policies.
+type rateLimitPolicyMiddleware struct {
+	policy  *compiledRateLimitPolicy
+	paths   []compiledRateLimitPath
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+}
+
+// NewRateLimitPolicyMiddleware creates a middleware enforcing the configured
+// policies, backed by limiters from factory.
+func NewRateLimitPolicyMiddleware(
+	config RateLimitPolicyConfig,
+	factory RateLimiterFactory,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewRateLimitPolicyValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	m := &rateLimitPolicyMiddleware{
+		logger:  logger,
+		metrics: metrics,
+	}
+
+	if config.Policy.Name != "" {
+		policy, err := compileRateLimitPolicy(config.Policy, factory)
+		if err != nil {
+			return nil, err
+		}
+		m.policy = policy
+	}
+
+	for _, path := range config.Paths {
+		policy, err := compileRateLimitPolicy(path.Policy, factory)
+		if err != nil {
+			return nil, err
+		}
+		m.paths = append(m.paths, compiledRateLimitPath{prefix: path.PathPrefix, policy: policy})
+	}
+
+	// Longest prefix first so the most specific path policy wins.
+	sort.SliceStable(m.paths, func(i, j int) bool {
+		return len(m.paths[i].prefix) > len(m.paths[j].prefix)
+	})
+
+	return m, nil
+}
+
+// compileRateLimitPolicy parses key sources and creates one limiter per limit.
+func compileRateLimitPolicy(policy RateLimitPolicy, factory RateLimiterFactory) (*compiledRateLimitPolicy, error) {
+	compiled := &compiledRateLimitPolicy{name: policy.Name}
+
+	sources := policy.Key
+	if len(sources) == 0 {
+		sources = []string{RateLimitKeyIP}
+	}
+	for _, source := range sources {
+		kind, arg, _ := strings.Cut(source, ":")
+		compiled.key = append(compiled.key, rateLimitKeySource{kind: kind, arg: arg})
+	}
+
+	quotas := make([]string, 0, len(policy.Limits))
+	for i, rule := range policy.Limits {
+		if rule.Burst <= 0 {
+			rule.Burst = rule.Requests
+		}
+
+		limiter, err := factory(fmt.Sprintf("%s:%d", policy.Name, i), rule)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create limiter for rate limit policy %s: %w", policy.Name, err)
+		}
+
+		compiled.limits = append(compiled.limits, compiledRateLimit{rule: rule, limiter: limiter})
+		quotas = append(quotas, fmt.Sprintf("%d;w=%d", rule.Requests, int64(math.Ceil(rule.Period.Seconds()))))
+	}
+	compiled.quota = strings.Join(quotas, ", ")
+
+	return compiled, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *rateLimitPolicyMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := m.match(r.URL.Path)
+		if policy == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !m.enforce(w, r, policy, policy.requestKey(r)) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// match returns the policy for path, or nil when none applies.
+func (m *rateLimitPolicyMiddleware) match(path string) *compiledRateLimitPolicy {
+	for _, candidate := range m.paths {
+		if strings.HasPrefix(path, candidate.prefix) {
+			return candidate.policy
+		}
+	}
+	return m.policy
+}
+
+// enforce checks every limit of policy and writes the rate limit headers.
+// It returns false after writing a 429 response.
+func (m *rateLimitPolicyMiddleware) enforce(w http.ResponseWriter, r *http.Request, policy *compiledRateLimitPolicy, key string) bool {
+	deny := func(limit *compiledRateLimit, retryAfter time.Duration) bool {
+		setRateLimitHeaders(w.Header(), policy.quota, limit.rule, 0)
+		m.handleRateLimit(w, r, policy, limit.rule, retryAfter)
+		return false
+	}
+
+	// Every limit is checked before any is consumed, so a request denied
+	// by one limit does not drain the others.
+	for i := range policy.limits {
+		limit := &policy.limits[i]
+		if stats := limit.limiter.Stats(key); stats.Remaining < 1 {
+			return deny(limit, stats.RetryAfter)
+		}
+	}
+
+	var tightest *compiledRateLimit
+	tightestRemaining := math.MaxInt
+
+	for i := range policy.limits {
+		limit := &policy.limits[i]
+
+		// Only a concurrent request can exhaust a limit after the check
+		if !limit.limiter.Allow(r.Context(), key) {
+			return deny(limit, limit.limiter.Stats(key).RetryAfter)
+		}
+
+		remaining := limit.limiter.Stats(key).Remaining
+		if remaining > limit.rule.Requests {
+			remaining = limit.rule.Requests
+		}
+		if remaining < tightestRemaining {
+			tightest, tightestRemaining = limit, remaining
+		}
+	}
+
+	setRateLimitHeaders(w.Header(), policy.quota, tightest.rule, tightestRemaining)
+	return true
+}
+
+// handleRateLimit writes the response for a request rejected by policy.
+func (m *rateLimitPolicyMiddleware) handleRateLimit(
+	w http.ResponseWriter,
+	r *http.Request,
+	policy *compiledRateLimitPolicy,
+	rule RateLimitRule,
+	retryAfter time.Duration,
+) {
+	requestID := GetRequestID(r.Context())
+	retrySeconds := int64(math.Ceil(retryAfter.Seconds()))
+	if retrySeconds < 1 {
+		retrySeconds = 1
+	}
+
+	ReportOffense(r, OffenseRateLimit)
+
+	if m.logger != nil {
+		m.logger.Warn(r.Context(), "Rate limit exceeded",
+			observability.String("request_id", requestID),
+			observability.String("policy", policy.name),
+			observability.String("client_ip", getClientIP(r)),
+			observability.String("method", r.Method),
+			observability.String("path", r.URL.Path),
+			observability.Int("limit", rule.Requests),
+			observability.Duration("period", rule.Period),
+		)
+	}
+
+	if m.metrics != nil {
+		m.metrics.RecordRateLimitHit(policy.name)
+	}
+
+	w.Header().Set(HeaderRetryAfter, strconv.FormatInt(retrySeconds, 10))
+	err := proxyerrors.WrapError(proxyerrors.ErrCodeRateLimited, "Rate limit exceeded", nil).
+		WithContext("policy", policy.name).
+		WithContext("retry_after", retrySeconds)
+	writeErrorResponse(w, r, err)
+}
+
+// requestKey builds the composite key of r. Sources without a value fall
+// back to the client IP so that requests lacking them are not pooled together.
+func (p *compiledRateLimitPolicy) requestKey(r *http.Request) string {
+	parts := make([]string, 0, len(p.key))
+	for _, source := range p.key {
+		value := source.value(r)
+		if value == "" {
+			value = "ip=" + getClientIP(r)
+		} else {
+			value = source.kind + "=" + value
+		}
+		parts = append(parts, value)
+	}
+	return strings.Join(parts, "|")
+}
+
+// value extracts the source's value from r, or "" when absent.
+func (s rateLimitKeySource) value(r *http.Request) string {
+	switch s.kind {
+	case RateLimitKeyIP:
+		return getClientIP(r)
+	case RateLimitKeyHeader:
+		return r.Header.Get(s.arg)
+	case RateLimitKeyAPIKey:
+		header := s.arg
+		if header == "" {
+			header = defaultRateLimitAPIKeyHeader
+		}
+		key := r.Header.Get(header)
+		if key == "" {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(key))
+		return hex.EncodeToString(sum[:16])
+	case RateLimitKeyJWTClaim:
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return ""
+		}
+		parsed, err := parseJWT(strings.TrimSpace(token))
+		if err != nil {
+			return ""
+		}
+		switch claim := parsed.claims.lookup(s.arg).(type) {
+		case nil, map[string]any, []any:
+			return ""
+		default:
+			return fmt.Sprint(claim)
+		}
+	case RateLimitKeyCookie:
+		cookie, err := r.Cookie(s.arg)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	default:
+		return ""
+	}
+}
+
+// setRateLimitHeaders sets the IETF rate limit headers for rule.
+func setRateLimitHeaders(h http.Header, quota string, rule RateLimitRule, remaining int) {
+	// Time for the quota to refill completely at the configured rate.
+	reset := time.Duration(float64(rule.Requests-remaining) * float64(rule.Period) / float64(rule.Requests))
+
+	h.Set(HeaderRateLimitLimit, strconv.Itoa(rule.Requests))
+	h.Set(HeaderRateLimitRemaining, strconv.Itoa(remaining))
+	h.Set(HeaderRateLimitReset, strconv.FormatInt(int64(math.Ceil(reset.Seconds())), 10))
+	if quota != "" {
+		h.Set(HeaderRateLimitPolicy, quota)
+	}
+}
+
+// RateLimitPolicyValidator validates rate limit policy configuration.
+type RateLimitPolicyValidator struct{}
+
+// NewRateLimitPolicyValidator creates a new rate limit policy validator.
+func NewRateLimitPolicyValidator() *RateLimitPolicyValidator {
+	return &RateLimitPolicyValidator{}
+}
+
+// Validate validates the rate limit policy configuration.
+func (v *RateLimitPolicyValidator) Validate(config RateLimitPolicyConfig) error {
+	if config.Policy.Name != "" {
+		if err := v.validatePolicy(config.Policy); err != nil {
+			return err
+		}
+	}
+
+	for _, path := range config.Paths {
+		if !strings.HasPrefix(path.PathPrefix, "/") {
+			return fmt.Errorf("%w: %q", ErrInvalidRateLimitPath, path.PathPrefix)
+		}
+		if path.Policy.Name == "" {
+			return ErrRateLimitPolicyName
+		}
+		if err := v.validatePolicy(path.Policy); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validatePolicy validates a single policy.
+func (v *RateLimitPolicyValidator) validatePolicy(policy RateLimitPolicy) error {
+	if len(policy.Limits) == 0 {
+		return fmt.Errorf("%w: %s", ErrRateLimitPolicyNoLimits, policy.Name)
+	}
+
+	for _, rule := range policy.Limits {
+		if rule.Requests <= 0 || rule.Period <= 0 || rule.Burst < 0 {
+			return fmt.Errorf("%w: %s", ErrInvalidRateLimitRule, policy.Name)
+		}
+	}
+
+	for _, source := range policy.Key {
+		kind, arg, hasArg := strings.Cut(source, ":")
+		switch kind {
+		case RateLimitKeyIP:
+			if hasArg {
+				return fmt.Errorf("%w: %q", ErrInvalidRateLimitKey, source)
+			}
+		case RateLimitKeyAPIKey:
+			if hasArg && arg == "" {
+				return fmt.Errorf("%w: %q", ErrInvalidRateLimitKey, source)
+			}
+		case RateLimitKeyHeader, RateLimitKeyJWTClaim, RateLimitKeyCookie:
+			if arg == "" {
+				return fmt.Errorf("%w: %q", ErrInvalidRateLimitKey, source)
+			}
+		default:
+			return fmt.Errorf("%w: %q", ErrInvalidRateLimitKey, source)
+		}
+	}
+
+	return nil
+}
+
+// Rate limit policy validation errors.
+var (
+	ErrRateLimitPolicyName     = fmt.Errorf("rate limit policy requires a name")
+	ErrRateLimitPolicyNoLimits = fmt.Errorf("rate limit policy requires at least one limit")
+	ErrInvalidRateLimitRule    = fmt.Errorf("invalid rate limit: requests and period must be positive")
+	ErrInvalidRateLimitKey     = fmt.Errorf("invalid rate limit key source")
+	ErrInvalidRateLimitPath    = fmt.Errorf("invalid rate limit path: must start with /")
+)
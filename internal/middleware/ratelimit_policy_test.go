@@ -0,0 +1,296 @@
+package middleware
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/albedosehen/rwwwrse/internal/observability"
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+// unsignedJWT builds a compact JWT with the given JSON claims and a dummy signature.
+func unsignedJWT(claims string) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(claims))
+	return header + "." + payload + ".c2ln"
+}
+
+// newTestPolicyMiddleware wraps an OK handler in a policy middleware backed by memory limiters.
+func newTestPolicyMiddleware(t *testing.T, config RateLimitPolicyConfig, metrics observability.MetricsCollector) http.Handler {
+	t.Helper()
+
+	mw, err := NewRateLimitPolicyMiddleware(config, NewMemoryRateLimiterFactory(nil), nil, metrics)
+	require.NoError(t, err)
+
+	return mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestRateLimitPolicyMiddleware_StackedLimits(t *testing.T) {
+	// Arrange
+	metrics := testhelpers.NewMockMetricsCollector()
+	metrics.On("RecordRateLimitHit", "api").Return().Once()
+	handler := newTestPolicyMiddleware(t, RateLimitPolicyConfig{
+		Policy: RateLimitPolicy{
+			Name: "api",
+			Limits: []RateLimitRule{
+				{Requests: 5, Period: time.Second},
+				{Requests: 2, Period: time.Hour},
+			},
+		},
+	}, metrics)
+
+	// Act
+	recorders := make([]*httptest.ResponseRecorder, 3)
+	for i := range recorders {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		recorders[i] = httptest.NewRecorder()
+		handler.ServeHTTP(recorders[i], req)
+	}
+
+	// Assert
+	assert.Equal(t, http.StatusOK, recorders[0].Code)
+	assert.Equal(t, "2", recorders[0].Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", recorders[0].Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "1800", recorders[0].Header().Get(HeaderRateLimitReset))
+	assert.Equal(t, "5;w=1, 2;w=3600", recorders[0].Header().Get(HeaderRateLimitPolicy))
+
+	assert.Equal(t, http.StatusOK, recorders[1].Code)
+	assert.Equal(t, "0", recorders[1].Header().Get(HeaderRateLimitRemaining))
+
+	assert.Equal(t, http.StatusTooManyRequests, recorders[2].Code)
+	assert.Equal(t, "0", recorders[2].Header().Get(HeaderRateLimitRemaining))
+	assert.NotEmpty(t, recorders[2].Header().Get(HeaderRetryAfter))
+	assert.Contains(t, recorders[2].Body.String(), `"policy":"api"`)
+	metrics.AssertExpectations(t)
+}
+
+func TestRateLimitPolicyMiddleware_StackedLimits_DeniedRequestKeepsTokens(t *testing.T) {
+	// Arrange
+	limiters := make(map[string]RateLimiter)
+	factory := func(name string, rule RateLimitRule) (RateLimiter, error) {
+		limiters[name] = NewTokenBucketRateLimiter(rule.RequestsPerSecond(), rule.Burst, nil)
+		return limiters[name], nil
+	}
+	mw, err := NewRateLimitPolicyMiddleware(RateLimitPolicyConfig{
+		Policy: RateLimitPolicy{
+			Name: "api",
+			Limits: []RateLimitRule{
+				{Requests: 10, Period: time.Hour},
+				{Requests: 1, Period: time.Hour},
+			},
+		},
+	}, factory, nil, nil)
+	require.NoError(t, err)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	// Act
+	codes := make([]int, 4)
+	for i := range codes {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		codes[i] = rr.Code
+	}
+
+	// Assert
+	assert.Equal(t, []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests}, codes)
+	assert.Equal(t, 9, limiters["api:0"].Stats("ip=203.0.113.7").Remaining)
+}
+
+func TestRateLimitPolicyMiddleware_PathPolicies(t *testing.T) {
+	tests := []struct {
+		name          string
+		path          string
+		expectedLimit string
+	}{
+		{
+			name:          "PathPolicy_LongestPrefix_Wins",
+			path:          "/api/login",
+			expectedLimit: "1",
+		},
+		{
+			name:          "PathPolicy_ShorterPrefix_Applies",
+			path:          "/api/users",
+			expectedLimit: "10",
+		},
+		{
+			name:          "PathPolicy_NoPrefix_UsesRoutePolicy",
+			path:          "/static/app.js",
+			expectedLimit: "100",
+		},
+	}
+
+	config := RateLimitPolicyConfig{
+		Policy: RateLimitPolicy{Name: "site", Limits: []RateLimitRule{{Requests: 100, Period: time.Second}}},
+		Paths: []RateLimitPathPolicy{
+			{PathPrefix: "/api/", Policy: RateLimitPolicy{Name: "api", Limits: []RateLimitRule{{Requests: 10, Period: time.Second}}}},
+			{PathPrefix: "/api/login", Policy: RateLimitPolicy{Name: "login", Limits: []RateLimitRule{{Requests: 1, Period: time.Minute}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			handler := newTestPolicyMiddleware(t, config, nil)
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.expectedLimit, rec.Header().Get(HeaderRateLimitLimit))
+		})
+	}
+}
+
+func TestRateLimitPolicy_RequestKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        []string
+		setup      func(*http.Request)
+		expected   string
+		unexpected string
+	}{
+		{
+			name:     "RequestKey_Default_UsesClientIP",
+			expected: "ip=203.0.113.7",
+		},
+		{
+			name:     "RequestKey_Header_UsesHeaderValue",
+			key:      []string{"header:X-Tenant"},
+			setup:    func(r *http.Request) { r.Header.Set("X-Tenant", "acme") },
+			expected: "header=acme",
+		},
+		{
+			name:     "RequestKey_MissingHeader_FallsBackToClientIP",
+			key:      []string{"header:X-Tenant"},
+			expected: "ip=203.0.113.7",
+		},
+		{
+			name:       "RequestKey_APIKey_IsHashed",
+			key:        []string{"api_key"},
+			setup:      func(r *http.Request) { r.Header.Set("X-API-Key", "secret-key") },
+			expected:   "api_key=",
+			unexpected: "secret-key",
+		},
+		{
+			name: "RequestKey_JWTClaim_UsesClaim",
+			key:  []string{"jwt_claim:org.id"},
+			setup: func(r *http.Request) {
+				r.Header.Set("Authorization", "Bearer "+unsignedJWT(`{"sub":"u1","org":{"id":"org-42"}}`))
+			},
+			expected: "jwt_claim=org-42",
+		},
+		{
+			name:     "RequestKey_Cookie_UsesCookieValue",
+			key:      []string{"cookie:session"},
+			setup:    func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: "abc"}) },
+			expected: "cookie=abc",
+		},
+		{
+			name:     "RequestKey_Composite_JoinsSources",
+			key:      []string{"ip", "header:X-Tenant"},
+			setup:    func(r *http.Request) { r.Header.Set("X-Tenant", "acme") },
+			expected: "ip=203.0.113.7|header=acme",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			policy, err := compileRateLimitPolicy(RateLimitPolicy{
+				Name:   "test",
+				Key:    tt.key,
+				Limits: []RateLimitRule{{Requests: 1, Period: time.Second}},
+			}, NewMemoryRateLimiterFactory(nil))
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "203.0.113.7:1234"
+			if tt.setup != nil {
+				tt.setup(req)
+			}
+
+			// Act
+			key := policy.requestKey(req)
+
+			// Assert
+			assert.True(t, strings.HasPrefix(key, tt.expected), "unexpected key %q", key)
+			if tt.unexpected != "" {
+				assert.NotContains(t, key, tt.unexpected)
+			}
+		})
+	}
+}
+
+func TestRateLimitPolicyValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      RateLimitPolicyConfig
+		expectedErr error
+	}{
+		{
+			name: "Validate_ValidPolicy_Succeeds",
+			config: RateLimitPolicyConfig{
+				Policy: RateLimitPolicy{Name: "api", Key: []string{"ip", "api_key:X-Key"}, Limits: []RateLimitRule{{Requests: 1, Period: time.Second}}},
+			},
+		},
+		{
+			name: "Validate_NoLimits_ReturnsError",
+			config: RateLimitPolicyConfig{
+				Policy: RateLimitPolicy{Name: "api"},
+			},
+			expectedErr: ErrRateLimitPolicyNoLimits,
+		},
+		{
+			name: "Validate_ZeroPeriod_ReturnsError",
+			config: RateLimitPolicyConfig{
+				Policy: RateLimitPolicy{Name: "api", Limits: []RateLimitRule{{Requests: 1}}},
+			},
+			expectedErr: ErrInvalidRateLimitRule,
+		},
+		{
+			name: "Validate_UnknownKeySource_ReturnsError",
+			config: RateLimitPolicyConfig{
+				Policy: RateLimitPolicy{Name: "api", Key: []string{"query:id"}, Limits: []RateLimitRule{{Requests: 1, Period: time.Second}}},
+			},
+			expectedErr: ErrInvalidRateLimitKey,
+		},
+		{
+			name: "Validate_RelativePath_ReturnsError",
+			config: RateLimitPolicyConfig{
+				Paths: []RateLimitPathPolicy{{PathPrefix: "api", Policy: RateLimitPolicy{Name: "api", Limits: []RateLimitRule{{Requests: 1, Period: time.Second}}}}},
+			},
+			expectedErr: ErrInvalidRateLimitPath,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			err := NewRateLimitPolicyValidator().Validate(tt.config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
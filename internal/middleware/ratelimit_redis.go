@@ -0,0 +1,445 @@
+// Package middleware implements distributed rate limiting backed by a Redis-protocol store.
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/albedosehen/rwwwrse/internal/observability"
+	"github.com/albedosehen/rwwwrse/internal/resp"
+)
+
+// Distributed rate limiting algorithms.
+const (
+	RateLimitAlgorithmGCRA          = "gcra"
+	RateLimitAlgorithmSlidingWindow = "sliding_window"
+)
+
+// Behaviours when the rate limit store is unreachable.
+const (
+	RateLimitFailureLocal  = "local"
+	RateLimitFailureOpen   = "open"
+	RateLimitFailureClosed = "closed"
+)
+
+// gcraScript implements the generic cell rate algorithm. The key stores the
+// theoretical arrival time (TAT) in microseconds of the store's clock.
+// ARGV: emission interval (us), burst tolerance (us), consume flag.
+// Returns {allowed, remaining, retry_after_us, reset_after_us}.
+var gcraScript = resp.NewScript(`
+if redis.replicate_commands then redis.replicate_commands() end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local interval = tonumber(ARGV[1])
+local tolerance = tonumber(ARGV[2])
+local consume = tonumber(ARGV[3])
+local tat = tonumber(redis.call('GET', KEYS[1])) or now
+if tat < now then tat = now end
+local remaining = math.floor((tolerance - (tat - now)) / interval)
+if remaining < 1 then
+  return {0, 0, tat + interval - tolerance - now, tat - now}
+end
+if consume == 1 then
+  local new_tat = tat + interval
+  redis.call('SET', KEYS[1], string.format('%d', new_tat), 'PX', math.ceil((new_tat - now) / 1000) + 1)
+  return {1, remaining - 1, 0, new_tat - now}
+end
+return {1, remaining, 0, tat - now}
+`)
+
+// slidingWindowScript implements an approximated sliding window counter that
+// weights the previous fixed window by its overlap with the sliding window.
+// ARGV: window (us), limit, consume flag.
+// Returns {allowed, remaining, retry_after_us, reset_after_us}.
+var slidingWindowScript = resp.NewScript(`
+if redis.replicate_commands then redis.replicate_commands() end
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+local consume = tonumber(ARGV[3])
+local current = math.floor(now / window)
+local data = redis.call('HMGET', KEYS[1], 'w', 'c', 'p')
+local w = tonumber(data[1]) or current
+local c = tonumber(data[2]) or 0
+local p = tonumber(data[3]) or 0
+if w ~= current then
+  if w == current - 1 then p = c else p = 0 end
+  c = 0
+end
+local elapsed = now - current * window
+local used = p * (window - elapsed) / window + c
+if used >= limit then
+  local retry = window - elapsed
+  if c < limit and p > 0 then
+    retry = math.ceil(window * (1 - (limit - c) / p)) - elapsed
+    if retry < 1 then retry = 1 end
+  end
+  return {0, 0, retry, window - elapsed}
+end
+if consume == 1 then
+  redis.call('HSET', KEYS[1], 'w', current, 'c', c + 1, 'p', p)
+  redis.call('PEXPIRE', KEYS[1], math.ceil(2 * window / 1000))
+  return {1, math.max(0, math.floor(limit - used - 1)), 0, window - elapsed}
+end
+return {1, math.floor(limit - used), 0, window - elapsed}
+`)
+
+// RedisRateLimiterConfig holds configuration for the distributed rate limiter.
+type RedisRateLimiterConfig struct {
+	// Address is the host:port of the Redis-protocol store.
+	Address string
+
+	// Username and Password authenticate with AUTH when Password is set.
+	Username string
+	Password string
+
+	// DB selects the logical database.
+	DB int
+
+	// TLS enables TLS to the store.
+	TLS bool
+
+	// KeyPrefix namespaces rate limit keys in the store.
+	KeyPrefix string
+
+	// DialTimeout bounds connection establishment; Timeout bounds each command.
+	DialTimeout time.Duration
+	Timeout     time.Duration
+
+	// PoolSize caps the open connections to the store.
+	PoolSize int
+
+	// Algorithm is "gcra" or "sliding_window".
+	Algorithm string
+
+	// RequestsPerSecond and BurstSize define the GCRA rate. The sliding
+	// window allows RequestsPerSecond multiplied by Window requests per window.
+	RequestsPerSecond float64
+	BurstSize         int
+	Window            time.Duration
+
+	// FailureMode is "local", "open" or "closed" and decides requests while
+	// the store is unreachable.
+	FailureMode string
+
+	// RetryInterval is how long the store is bypassed after a failure.
+	RetryInterval time.Duration
+}
+
+// DefaultRedisRateLimiterConfig returns a distributed rate limiter configuration with sensible defaults.
+func DefaultRedisRateLimiterConfig() RedisRateLimiterConfig {
+	return RedisRateLimiterConfig{
+		Address:           "localhost:6379",
+		KeyPrefix:         "rwwwrse:ratelimit:",
+		DialTimeout:       2 * time.Second,
+		Timeout:           100 * time.Millisecond,
+		PoolSize:          16,
+		Algorithm:         RateLimitAlgorithmGCRA,
+		RequestsPerSecond: 100,
+		BurstSize:         200,
+		Window:            time.Minute,
+		FailureMode:       RateLimitFailureLocal,
+		RetryInterval:     time.Second,
+	}
+}
+
+// redisRateLimitResult is the decoded reply of a rate limit script.
+type redisRateLimitResult struct {
+	allowed    bool
+	remaining  int
+	retryAfter time.Duration
+	resetAfter time.Duration
+}
+
+// redisRateLimiter implements RateLimiter on top of a shared Redis-protocol
+// store so that limits hold across proxy instances.
+type redisRateLimiter struct {
+	client      *resp.Client
+	script      *resp.Script
+	args        []string
+	limit       int
+	keyPrefix   string
+	timeout     time.Duration
+	failureMode string
+	retryAfter  time.Duration
+	fallback    RateLimiter
+	logger      observability.Logger
+
+	mu               sync.Mutex
+	degraded         bool
+	unavailableUntil time.Time
+}
+
+// NewRedisRateLimiter creates a rate limiter that keeps its state in a
+// Redis-protocol store and degrades according to the failure mode when the
+// store is unreachable.
+func NewRedisRateLimiter(config RedisRateLimiterConfig, logger observability.Logger) (RateLimiter, error) {
+	validator := NewRedisRateLimiterValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	rl := &redisRateLimiter{
+		client: resp.NewClient(resp.Config{
+			Address:     config.Address,
+			Username:    config.Username,
+			Password:    config.Password,
+			DB:          config.DB,
+			TLS:         config.TLS,
+			DialTimeout: config.DialTimeout,
+			Timeout:     config.Timeout,
+			PoolSize:    config.PoolSize,
+		}),
+		keyPrefix:   config.KeyPrefix,
+		timeout:     config.Timeout,
+		failureMode: config.FailureMode,
+		retryAfter:  config.RetryInterval,
+		logger:      logger,
+	}
+	if rl.failureMode == "" {
+		rl.failureMode = RateLimitFailureLocal
+	}
+	if rl.retryAfter <= 0 {
+		rl.retryAfter = time.Second
+	}
+
+	if config.Algorithm == RateLimitAlgorithmSlidingWindow {
+		rl.limit = int(math.Max(1, math.Floor(config.RequestsPerSecond*config.Window.Seconds())))
+		rl.script = slidingWindowScript
+		rl.args = []string{
+			strconv.FormatInt(config.Window.Microseconds(), 10),
+			strconv.Itoa(rl.limit),
+		}
+	} else {
+		interval := int64(math.Max(1, math.Round(float64(time.Second/time.Microsecond)/config.RequestsPerSecond)))
+		rl.limit = config.BurstSize
+		rl.script = gcraScript
+		rl.args = []string{
+			strconv.FormatInt(interval, 10),
+			strconv.FormatInt(interval*int64(config.BurstSize), 10),
+		}
+	}
+
+	if rl.failureMode == RateLimitFailureLocal {
+		rl.fallback = NewTokenBucketRateLimiter(config.RequestsPerSecond, config.BurstSize, logger)
+	}
+
+	return rl, nil
+}
+
+// Allow checks if a request should be allowed based on the key.
+func (rl *redisRateLimiter) Allow(ctx context.Context, key string) bool {
+	if !rl.storeAvailable() {
+		return rl.degradedAllow(ctx, key)
+	}
+
+	result, err := rl.eval(ctx, key, true)
+	if err != nil {
+		rl.markUnavailable(ctx, err)
+		return rl.degradedAllow(ctx, key)
+	}
+
+	rl.markAvailable(ctx)
+	return result.allowed
+}
+
+// Reset resets the rate limit for a specific key.
+func (rl *redisRateLimiter) Reset(key string) error {
+	if rl.fallback != nil {
+		_ = rl.fallback.Reset(key)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rl.timeout)
+	defer cancel()
+
+	if _, err := rl.client.Do(ctx, "DEL", rl.keyPrefix+key); err != nil {
+		return fmt.Errorf("failed to reset rate limit for %s: %w", key, err)
+	}
+	return nil
+}
+
+// Stats returns rate limiting statistics for a key without consuming a request.
+func (rl *redisRateLimiter) Stats(key string) RateLimitStats {
+	if rl.storeAvailable() {
+		ctx, cancel := context.WithTimeout(context.Background(), rl.timeout)
+		defer cancel()
+
+		result, err := rl.eval(ctx, key, false)
+		if err == nil {
+			return RateLimitStats{
+				Requests:   rl.limit - result.remaining,
+				Remaining:  result.remaining,
+				ResetTime:  time.Now().Add(result.resetAfter),
+				RetryAfter: result.retryAfter,
+			}
+		}
+		rl.markUnavailable(ctx, err)
+	}
+
+	if rl.fallback != nil {
+		return rl.fallback.Stats(key)
+	}
+
+	if rl.failureMode == RateLimitFailureOpen {
+		return RateLimitStats{
+			Remaining: rl.limit,
+			ResetTime: time.Now(),
+		}
+	}
+
+	return RateLimitStats{
+		Requests:   rl.limit,
+		Remaining:  0,
+		ResetTime:  time.Now().Add(rl.retryAfter),
+		RetryAfter: rl.retryAfter,
+	}
+}
+
+// Cleanup removes expired rate limit entries. Store keys expire on their
+// own, so only the local fallback needs cleaning.
+func (rl *redisRateLimiter) Cleanup(ctx context.Context) error {
+	if rl.fallback != nil {
+		return rl.fallback.Cleanup(ctx)
+	}
+	return nil
+}
+
+// Stop releases the store connections and stops the local fallback.
+func (rl *redisRateLimiter) Stop() {
+	if stopper, ok := rl.fallback.(interface{ Stop() }); ok {
+		stopper.Stop()
+	}
+	_ = rl.client.Close()
+}
+
+// eval runs the rate limit script for key and decodes its reply.
+func (rl *redisRateLimiter) eval(ctx context.Context, key string, consume bool) (redisRateLimitResult, error) {
+	flag := "0"
+	if consume {
+		flag = "1"
+	}
+
+	reply, err := rl.client.Eval(ctx, rl.script, []string{rl.keyPrefix + key}, append(rl.args, flag)...)
+	if err != nil {
+		return redisRateLimitResult{}, err
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 4 {
+		return redisRateLimitResult{}, fmt.Errorf("%w: %v", ErrInvalidRateLimitReply, reply)
+	}
+
+	numbers := make([]int64, len(values))
+	for i, value := range values {
+		if numbers[i], err = resp.Int(value); err != nil {
+			return redisRateLimitResult{}, fmt.Errorf("%w: %v", ErrInvalidRateLimitReply, err)
+		}
+	}
+
+	return redisRateLimitResult{
+		allowed:    numbers[0] == 1,
+		remaining:  int(numbers[1]),
+		retryAfter: time.Duration(numbers[2]) * time.Microsecond,
+		resetAfter: time.Duration(numbers[3]) * time.Microsecond,
+	}, nil
+}
+
+// degradedAllow decides a request while the store is unreachable.
+func (rl *redisRateLimiter) degradedAllow(ctx context.Context, key string) bool {
+	switch rl.failureMode {
+	case RateLimitFailureOpen:
+		return true
+	case RateLimitFailureClosed:
+		return false
+	default:
+		return rl.fallback.Allow(ctx, key)
+	}
+}
+
+// storeAvailable reports whether the store should be tried.
+func (rl *redisRateLimiter) storeAvailable() bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	return !time.Now().Before(rl.unavailableUntil)
+}
+
+// markUnavailable bypasses the store for the retry interval.
+func (rl *redisRateLimiter) markUnavailable(ctx context.Context, err error) {
+	rl.mu.Lock()
+	wasDegraded := rl.degraded
+	rl.degraded = true
+	rl.unavailableUntil = time.Now().Add(rl.retryAfter)
+	rl.mu.Unlock()
+
+	if !wasDegraded && rl.logger != nil {
+		rl.logger.Warn(ctx, "Rate limit store unavailable, degrading",
+			observability.String("failure_mode", rl.failureMode),
+			observability.Error(err),
+		)
+	}
+}
+
+// markAvailable records that the store answered again.
+func (rl *redisRateLimiter) markAvailable(ctx context.Context) {
+	rl.mu.Lock()
+	wasDegraded := rl.degraded
+	rl.degraded = false
+	rl.mu.Unlock()
+
+	if wasDegraded && rl.logger != nil {
+		rl.logger.Info(ctx, "Rate limit store recovered")
+	}
+}
+
+// RedisRateLimiterValidator validates distributed rate limiter configuration.
+type RedisRateLimiterValidator struct{}
+
+// NewRedisRateLimiterValidator creates a new distributed rate limiter validator.
+func NewRedisRateLimiterValidator() *RedisRateLimiterValidator {
+	return &RedisRateLimiterValidator{}
+}
+
+// Validate validates the distributed rate limiter configuration.
+func (v *RedisRateLimiterValidator) Validate(config RedisRateLimiterConfig) error {
+	if _, _, err := net.SplitHostPort(config.Address); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRateLimitStore, err)
+	}
+
+	if config.RequestsPerSecond <= 0 || config.BurstSize <= 0 {
+		return ErrInvalidRateLimit
+	}
+
+	switch config.Algorithm {
+	case "", RateLimitAlgorithmGCRA:
+	case RateLimitAlgorithmSlidingWindow:
+		if config.Window < time.Second {
+			return ErrInvalidRateLimitWindow
+		}
+	default:
+		return ErrInvalidRateLimitAlgorithm
+	}
+
+	switch config.FailureMode {
+	case "", RateLimitFailureLocal, RateLimitFailureOpen, RateLimitFailureClosed:
+	default:
+		return ErrInvalidRateLimitFailureMode
+	}
+
+	return nil
+}
+
+// Distributed rate limiting errors.
+var (
+	ErrInvalidRateLimitStore       = fmt.Errorf("invalid rate limit store address")
+	ErrInvalidRateLimitAlgorithm   = fmt.Errorf("invalid rate limit algorithm: must be gcra or sliding_window")
+	ErrInvalidRateLimitWindow      = fmt.Errorf("invalid rate limit window: must be at least 1s")
+	ErrInvalidRateLimitFailureMode = fmt.Errorf("invalid rate limit failure mode: must be local, open or closed")
+	ErrInvalidRateLimitReply       = fmt.Errorf("unexpected rate limit store reply")
+)
@@ -0,0 +1,502 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/albedosehen/rwwwrse/internal/resp"
+)
+
+// fakeRESPServer is an in-process stand-in for a Redis-compatible store. It
+// understands the commands used by the distributed rate limiter and runs Go
+// equivalents of the rate limit scripts.
+type fakeRESPServer struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	strings  map[string]int64
+	hashes   map[string]map[string]int64
+	scripts  map[string]bool
+	commands []string
+}
+
+// newFakeRESPServer starts a fake store and returns it.
+func newFakeRESPServer(t *testing.T) *fakeRESPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &fakeRESPServer{
+		listener: listener,
+		strings:  make(map[string]int64),
+		hashes:   make(map[string]map[string]int64),
+		scripts:  make(map[string]bool),
+	}
+	go s.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+
+	return s
+}
+
+// Addr returns the listening address of the store.
+func (s *fakeRESPServer) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Commands returns the names of the commands received so far.
+func (s *fakeRESPServer) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *fakeRESPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeRESPServer) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	for {
+		request, err := resp.ReadReply(reader)
+		if err != nil {
+			return
+		}
+		items, _ := request.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		if _, err := io.WriteString(conn, s.execute(args)); err != nil {
+			return
+		}
+	}
+}
+
+// execute runs a command and returns its encoded reply.
+func (s *fakeRESPServer) execute(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	command := strings.ToUpper(args[0])
+	s.commands = append(s.commands, command)
+
+	switch command {
+	case "PING", "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := s.strings[key]; ok {
+				deleted++
+			}
+			if _, ok := s.hashes[key]; ok {
+				deleted++
+			}
+			delete(s.strings, key)
+			delete(s.hashes, key)
+		}
+		return ":" + strconv.Itoa(deleted) + "\r\n"
+	case "EVAL":
+		sha := resp.NewScript(args[1]).SHA()
+		s.scripts[sha] = true
+		return s.runScript(sha, args[2:])
+	case "EVALSHA":
+		if !s.scripts[args[1]] {
+			return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+		}
+		return s.runScript(args[1], args[2:])
+	default:
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+// runScript dispatches a script by digest to its Go equivalent.
+func (s *fakeRESPServer) runScript(sha string, args []string) string {
+	numKeys, _ := strconv.Atoi(args[0])
+	keys, argv := args[1:1+numKeys], args[1+numKeys:]
+	values := make([]int64, len(argv))
+	for i, arg := range argv {
+		values[i], _ = strconv.ParseInt(arg, 10, 64)
+	}
+	now := time.Now().UnixMicro()
+
+	var result [4]int64
+	switch sha {
+	case gcraScript.SHA():
+		result = s.gcra(keys[0], now, values[0], values[1], values[2] == 1)
+	case slidingWindowScript.SHA():
+		result = s.slidingWindow(keys[0], now, values[0], values[1], values[2] == 1)
+	default:
+		return "-ERR unknown script\r\n"
+	}
+
+	return fmt.Sprintf("*4\r\n:%d\r\n:%d\r\n:%d\r\n:%d\r\n", result[0], result[1], result[2], result[3])
+}
+
+func (s *fakeRESPServer) gcra(key string, now, interval, tolerance int64, consume bool) [4]int64 {
+	tat, ok := s.strings[key]
+	if !ok || tat < now {
+		tat = now
+	}
+	remaining := (tolerance - (tat - now)) / interval
+	if remaining < 1 {
+		return [4]int64{0, 0, tat + interval - tolerance - now, tat - now}
+	}
+	if consume {
+		s.strings[key] = tat + interval
+		return [4]int64{1, remaining - 1, 0, tat + interval - now}
+	}
+	return [4]int64{1, remaining, 0, tat - now}
+}
+
+func (s *fakeRESPServer) slidingWindow(key string, now, window, limit int64, consume bool) [4]int64 {
+	current := now / window
+	hash := s.hashes[key]
+	w, c, p := current, int64(0), int64(0)
+	if hash != nil {
+		w, c, p = hash["w"], hash["c"], hash["p"]
+	}
+	if w != current {
+		if w == current-1 {
+			p = c
+		} else {
+			p = 0
+		}
+		c = 0
+	}
+	elapsed := now - current*window
+	used := float64(p)*float64(window-elapsed)/float64(window) + float64(c)
+	if used >= float64(limit) {
+		return [4]int64{0, 0, window - elapsed, window - elapsed}
+	}
+	if consume {
+		s.hashes[key] = map[string]int64{"w": current, "c": c + 1, "p": p}
+		return [4]int64{1, int64(math.Max(0, float64(limit)-used-1)), 0, window - elapsed}
+	}
+	return [4]int64{1, int64(float64(limit) - used), 0, window - elapsed}
+}
+
+// unreachableAddress returns an address with nothing listening on it.
+func unreachableAddress(t *testing.T) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+	return address
+}
+
+func newTestRedisRateLimiter(t *testing.T, config RedisRateLimiterConfig) *redisRateLimiter {
+	t.Helper()
+
+	limiter, err := NewRedisRateLimiter(config, nil)
+	require.NoError(t, err)
+	rl := limiter.(*redisRateLimiter)
+	t.Cleanup(rl.Stop)
+	return rl
+}
+
+func TestRedisRateLimiter_Allow(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		rps       float64
+		burst     int
+		window    time.Duration
+		expected  []bool
+	}{
+		{
+			name:      "RedisRateLimiter_GCRABurstExhausted_Denies",
+			algorithm: RateLimitAlgorithmGCRA,
+			rps:       1,
+			burst:     3,
+			expected:  []bool{true, true, true, false},
+		},
+		{
+			name:      "RedisRateLimiter_SlidingWindowLimitReached_Denies",
+			algorithm: RateLimitAlgorithmSlidingWindow,
+			rps:       1,
+			burst:     1,
+			window:    2 * time.Second,
+			expected:  []bool{true, true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			server := newFakeRESPServer(t)
+			config := DefaultRedisRateLimiterConfig()
+			config.Address = server.Addr()
+			config.Algorithm = tt.algorithm
+			config.RequestsPerSecond = tt.rps
+			config.BurstSize = tt.burst
+			config.Window = tt.window
+			rl := newTestRedisRateLimiter(t, config)
+
+			// Act
+			results := make([]bool, 0, len(tt.expected))
+			for range tt.expected {
+				results = append(results, rl.Allow(context.Background(), "client"))
+			}
+			stats := rl.Stats("client")
+
+			// Assert
+			assert.Equal(t, tt.expected, results)
+			assert.Equal(t, 0, stats.Remaining)
+			assert.Greater(t, stats.RetryAfter, time.Duration(0))
+		})
+	}
+}
+
+// TestRedisRateLimiter_LuaScripts runs the shipped scripts in an embedded
+// Lua interpreter, unlike the fake server which re-implements them in Go.
+func TestRedisRateLimiter_LuaScripts(t *testing.T) {
+	tests := []struct {
+		name      string
+		algorithm string
+		rps       float64
+		burst     int
+		window    time.Duration
+		advance   time.Duration
+		expected  []bool
+		refilled  []bool
+	}{
+		{
+			name:      "LuaScripts_GCRA_LimitsAndRefills",
+			algorithm: RateLimitAlgorithmGCRA,
+			rps:       2,
+			burst:     3,
+			advance:   time.Second,
+			expected:  []bool{true, true, true, false},
+			refilled:  []bool{true, true, false},
+		},
+		{
+			name:      "LuaScripts_SlidingWindow_LimitsAndRefills",
+			algorithm: RateLimitAlgorithmSlidingWindow,
+			rps:       1,
+			burst:     1,
+			window:    2 * time.Second,
+			advance:   4 * time.Second,
+			expected:  []bool{true, true, false},
+			refilled:  []bool{true, true, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			server := miniredis.RunT(t)
+			now := time.Unix(1700000000, 0)
+			server.SetTime(now)
+
+			config := DefaultRedisRateLimiterConfig()
+			config.Address = server.Addr()
+			config.Algorithm = tt.algorithm
+			config.RequestsPerSecond = tt.rps
+			config.BurstSize = tt.burst
+			config.Window = tt.window
+			config.FailureMode = RateLimitFailureClosed
+			rl := newTestRedisRateLimiter(t, config)
+
+			// Act
+			results := make([]bool, 0, len(tt.expected))
+			for range tt.expected {
+				results = append(results, rl.Allow(context.Background(), "client"))
+			}
+			stats := rl.Stats("client")
+
+			server.SetTime(now.Add(tt.advance))
+			server.FastForward(tt.advance)
+			refilled := make([]bool, 0, len(tt.refilled))
+			for range tt.refilled {
+				refilled = append(refilled, rl.Allow(context.Background(), "client"))
+			}
+
+			// Assert
+			assert.Equal(t, tt.expected, results)
+			assert.Equal(t, 0, stats.Remaining)
+			assert.Greater(t, stats.RetryAfter, time.Duration(0))
+			assert.Equal(t, tt.refilled, refilled)
+			assert.True(t, server.Exists(config.KeyPrefix+"client"))
+		})
+	}
+}
+
+func TestRedisRateLimiter_SharedStore_LimitsAcrossInstances(t *testing.T) {
+	// Arrange
+	server := newFakeRESPServer(t)
+	config := DefaultRedisRateLimiterConfig()
+	config.Address = server.Addr()
+	config.RequestsPerSecond = 1
+	config.BurstSize = 2
+	first := newTestRedisRateLimiter(t, config)
+	second := newTestRedisRateLimiter(t, config)
+
+	// Act
+	firstAllowed := first.Allow(context.Background(), "client")
+	secondAllowed := second.Allow(context.Background(), "client")
+	thirdAllowed := first.Allow(context.Background(), "client")
+
+	// Assert
+	assert.True(t, firstAllowed)
+	assert.True(t, secondAllowed)
+	assert.False(t, thirdAllowed)
+}
+
+func TestRedisRateLimiter_UnknownScript_LoadsWithEval(t *testing.T) {
+	// Arrange
+	server := newFakeRESPServer(t)
+	config := DefaultRedisRateLimiterConfig()
+	config.Address = server.Addr()
+	rl := newTestRedisRateLimiter(t, config)
+
+	// Act
+	rl.Allow(context.Background(), "client")
+	rl.Allow(context.Background(), "client")
+
+	// Assert
+	assert.Equal(t, []string{"EVALSHA", "EVAL", "EVALSHA"}, server.Commands())
+}
+
+func TestRedisRateLimiter_Reset_ClearsKey(t *testing.T) {
+	// Arrange
+	server := newFakeRESPServer(t)
+	config := DefaultRedisRateLimiterConfig()
+	config.Address = server.Addr()
+	config.RequestsPerSecond = 1
+	config.BurstSize = 1
+	rl := newTestRedisRateLimiter(t, config)
+	require.True(t, rl.Allow(context.Background(), "client"))
+	require.False(t, rl.Allow(context.Background(), "client"))
+
+	// Act
+	err := rl.Reset("client")
+
+	// Assert
+	require.NoError(t, err)
+	assert.True(t, rl.Allow(context.Background(), "client"))
+}
+
+func TestRedisRateLimiter_StoreUnavailable(t *testing.T) {
+	tests := []struct {
+		name        string
+		failureMode string
+		expected    []bool
+	}{
+		{
+			name:        "RedisRateLimiter_FailureLocal_UsesLocalLimiter",
+			failureMode: RateLimitFailureLocal,
+			expected:    []bool{true, true, false},
+		},
+		{
+			name:        "RedisRateLimiter_FailureOpen_AllowsAll",
+			failureMode: RateLimitFailureOpen,
+			expected:    []bool{true, true, true},
+		},
+		{
+			name:        "RedisRateLimiter_FailureClosed_DeniesAll",
+			failureMode: RateLimitFailureClosed,
+			expected:    []bool{false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultRedisRateLimiterConfig()
+			config.Address = unreachableAddress(t)
+			config.DialTimeout = 200 * time.Millisecond
+			config.RequestsPerSecond = 0.1
+			config.BurstSize = 2
+			config.FailureMode = tt.failureMode
+			rl := newTestRedisRateLimiter(t, config)
+
+			// Act
+			results := make([]bool, 0, len(tt.expected))
+			for range tt.expected {
+				results = append(results, rl.Allow(context.Background(), "client"))
+			}
+
+			// Assert
+			assert.Equal(t, tt.expected, results)
+		})
+	}
+}
+
+func TestRedisRateLimiterValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*RedisRateLimiterConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*RedisRateLimiterConfig) {},
+		},
+		{
+			name:        "Validate_AddressWithoutPort_ReturnsError",
+			mutate:      func(c *RedisRateLimiterConfig) { c.Address = "localhost" },
+			expectedErr: ErrInvalidRateLimitStore,
+		},
+		{
+			name:        "Validate_UnknownAlgorithm_ReturnsError",
+			mutate:      func(c *RedisRateLimiterConfig) { c.Algorithm = "leaky" },
+			expectedErr: ErrInvalidRateLimitAlgorithm,
+		},
+		{
+			name: "Validate_ShortSlidingWindow_ReturnsError",
+			mutate: func(c *RedisRateLimiterConfig) {
+				c.Algorithm = RateLimitAlgorithmSlidingWindow
+				c.Window = time.Millisecond
+			},
+			expectedErr: ErrInvalidRateLimitWindow,
+		},
+		{
+			name:        "Validate_UnknownFailureMode_ReturnsError",
+			mutate:      func(c *RedisRateLimiterConfig) { c.FailureMode = "retry" },
+			expectedErr: ErrInvalidRateLimitFailureMode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultRedisRateLimiterConfig()
+			tt.mutate(&config)
+
+			// Act
+			err := NewRedisRateLimiterValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
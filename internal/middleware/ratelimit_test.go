@@ -380,7 +380,7 @@ func TestRateLimitMiddleware_Wrap_RateLimitExceeded(t *testing.T) {
 			requestCount:    5,
 			expectedBlocked: 3,
 			expectedHeaders: map[string]string{
-				"Content-Type": "application/json",
+				"Content-Type": "application/problem+json",
 			},
 		},
 		{
@@ -390,7 +390,7 @@ func TestRateLimitMiddleware_Wrap_RateLimitExceeded(t *testing.T) {
 			requestCount:    1,
 			expectedBlocked: 1,
 			expectedHeaders: map[string]string{
-				"Content-Type": "application/json",
+				"Content-Type": "application/problem+json",
 			},
 		},
 	}
@@ -554,7 +554,7 @@ func TestRateLimitMiddleware_Wrap_ResponseFormat(t *testing.T) {
 		{
 			name: "ResponseFormat_JSONError",
 			expectedJSON: []string{
-				`"error"`,
+				`"detail"`,
 				`"Rate limit exceeded"`,
 				`"status"`,
 				`429`,
@@ -604,7 +604,7 @@ func TestRateLimitMiddleware_Wrap_ResponseFormat(t *testing.T) {
 
 			// Assert
 			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
-			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
 
 			responseBody := rec.Body.String()
 			for _, expectedField := range tt.expectedJSON {
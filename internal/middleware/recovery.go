@@ -5,8 +5,8 @@ import (
 	"fmt"
 	"net/http"
 	"runtime/debug"
-	"time"
 
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
 	"github.com/albedosehen/rwwwrse/internal/observability"
 )
 
@@ -48,16 +48,5 @@ func (m *recoveryMiddleware) handlePanic(w http.ResponseWriter, r *http.Request,
 		observability.String("stack", string(stack)),
 	)
 
-	// Return 500 Internal Server Error
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusInternalServerError)
-
-	response := fmt.Sprintf(`{
-		"error": "Internal server error",
-		"status": 500,
-		"request_id": "%s",
-		"timestamp": "%s"
-	}`, requestID, time.Now().UTC().Format(time.RFC3339))
-
-	_, _ = w.Write([]byte(response))
+	writeErrorResponse(w, r, proxyerrors.WrapError(proxyerrors.ErrCodeInternalError, "Internal server error", nil))
 }
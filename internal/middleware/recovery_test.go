@@ -168,13 +168,13 @@ func TestRecoveryMiddleware_Wrap_PanicRecovery(t *testing.T) {
 
 			// Assert
 			assert.Equal(t, http.StatusInternalServerError, rec.Code)
-			assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+			assert.Equal(t, "application/problem+json", rec.Header().Get("Content-Type"))
 
 			// Check response body structure
 			body := rec.Body.String()
-			assert.Contains(t, body, `"error": "Internal server error"`)
-			assert.Contains(t, body, `"status": 500`)
-			assert.Contains(t, body, `"timestamp"`)
+			assert.Contains(t, body, `"detail":"Internal server error"`)
+			assert.Contains(t, body, `"status":500`)
+			assert.Contains(t, body, `"code":"internal_error"`)
 
 			// Verify logger was called
 			logger.AssertExpectations(t)
@@ -192,20 +192,19 @@ func TestRecoveryMiddleware_Wrap_ResponseFormat(t *testing.T) {
 			name:      "ResponseFormat_WithRequestID",
 			requestID: "test-request-id",
 			wantFields: []string{
-				`"error": "Internal server error"`,
-				`"status": 500`,
-				`"request_id": "test-request-id"`,
-				`"timestamp"`,
+				`"detail":"Internal server error"`,
+				`"status":500`,
+				`"request_id":"test-request-id"`,
+				`"type":"urn:rwwwrse:error:internal_error"`,
 			},
 		},
 		{
 			name:      "ResponseFormat_EmptyRequestID",
 			requestID: "",
 			wantFields: []string{
-				`"error": "Internal server error"`,
-				`"status": 500`,
-				`"request_id": ""`,
-				`"timestamp"`,
+				`"detail":"Internal server error"`,
+				`"status":500`,
+				`"type":"urn:rwwwrse:error:internal_error"`,
 			},
 		},
 	}
@@ -0,0 +1,93 @@
+// Package middleware implements per-route middleware dispatch.
+package middleware
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// routeMiddleware applies a different middleware to each configured route.
+// Routes are keyed by host name; requests for hosts without an entry go
+// through the fallback middleware, or straight to the next handler.
+type routeMiddleware struct {
+	routes   map[string]Middleware
+	fallback Middleware
+}
+
+// NewRouteMiddleware creates a middleware that dispatches to per-route middleware by host.
+// Host keys are matched case-insensitively and without the port.
+func NewRouteMiddleware(routes map[string]Middleware) Middleware {
+	return NewRouteMiddlewareWithFallback(routes, nil)
+}
+
+// NewRouteMiddlewareWithFallback creates a per-route middleware that applies
+// fallback to hosts without an entry of their own.
+func NewRouteMiddlewareWithFallback(routes map[string]Middleware, fallback Middleware) Middleware {
+	normalized := make(map[string]Middleware, len(routes))
+	for host, mw := range routes {
+		if mw == nil {
+			continue
+		}
+		normalized[normalizeRouteHost(host)] = mw
+	}
+
+	return &routeMiddleware{
+		routes:   normalized,
+		fallback: fallback,
+	}
+}
+
+// Wrap implements the Middleware interface.
+func (m *routeMiddleware) Wrap(next http.Handler) http.Handler {
+	handlers := make(map[string]http.Handler, len(m.routes))
+	for host, mw := range m.routes {
+		handlers[host] = mw.Wrap(next)
+	}
+
+	fallback := next
+	if m.fallback != nil {
+		fallback = m.fallback.Wrap(next)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := normalizeRouteHost(r.Host)
+
+		handler, exists := handlers[host]
+		if !exists {
+			fallback.ServeHTTP(w, r)
+			return
+		}
+
+		if GetRouteName(r.Context()) == "" {
+			r = r.WithContext(WithRouteName(r.Context(), host))
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Close closes every route and fallback middleware that holds resources,
+// such as the credential file watchers of the authentication middleware.
+func (m *routeMiddleware) Close() error {
+	var errs []error
+	for _, mw := range m.routes {
+		if closer, ok := mw.(io.Closer); ok {
+			errs = append(errs, closer.Close())
+		}
+	}
+	if closer, ok := m.fallback.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// normalizeRouteHost lowercases a host and strips any port.
+func normalizeRouteHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.Trim(host, "[]"))
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// headerMiddleware marks responses so tests can see which route handled them.
+type headerMiddleware struct {
+	value string
+}
+
+func (m *headerMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Route", m.value+":"+GetRouteName(r.Context()))
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestRouteMiddleware_Wrap(t *testing.T) {
+	tests := []struct {
+		name          string
+		host          string
+		expectedRoute string
+	}{
+		{
+			name:          "RouteMiddleware_MatchingHost_AppliesRouteMiddleware",
+			host:          "app.example.com",
+			expectedRoute: "app:app.example.com",
+		},
+		{
+			name:          "RouteMiddleware_HostWithPortAndCase_AppliesRouteMiddleware",
+			host:          "APP.example.com:8443",
+			expectedRoute: "app:app.example.com",
+		},
+		{
+			name:          "RouteMiddleware_UnknownHost_PassesThrough",
+			host:          "other.example.com",
+			expectedRoute: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mw := NewRouteMiddleware(map[string]Middleware{
+				"App.Example.com": &headerMiddleware{value: "app"},
+				"nil.example.com": nil,
+			})
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tt.expectedRoute, rec.Header().Get("X-Route"))
+		})
+	}
+}
+
+func TestRouteMiddleware_Fallback(t *testing.T) {
+	tests := []struct {
+		name          string
+		host          string
+		expectedRoute string
+	}{
+		{
+			name:          "Fallback_MatchingHost_AppliesRouteMiddleware",
+			host:          "app.example.com",
+			expectedRoute: "app:app.example.com",
+		},
+		{
+			name:          "Fallback_UnknownHost_AppliesFallback",
+			host:          "other.example.com",
+			expectedRoute: "global:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			mw := NewRouteMiddlewareWithFallback(
+				map[string]Middleware{"app.example.com": &headerMiddleware{value: "app"}},
+				&headerMiddleware{value: "global"},
+			)
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedRoute, rec.Header().Get("X-Route"))
+		})
+	}
+}
+
+// closingMiddleware records whether it was closed.
+type closingMiddleware struct {
+	headerMiddleware
+	closed bool
+}
+
+func (m *closingMiddleware) Close() error {
+	m.closed = true
+	return nil
+}
+
+func TestRouteMiddleware_Close_ClosesRoutesAndFallback(t *testing.T) {
+	// Arrange
+	route := &closingMiddleware{}
+	fallback := &closingMiddleware{}
+	mw := NewRouteMiddlewareWithFallback(
+		map[string]Middleware{
+			"app.example.com":   route,
+			"other.example.com": &headerMiddleware{value: "other"},
+		},
+		fallback,
+	)
+
+	// Act
+	err := mw.(io.Closer).Close()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, route.closed)
+	assert.True(t, fallback.closed)
+}
@@ -4,8 +4,8 @@ package middleware
 import (
 	"fmt"
 	"net/http"
-	"slices"
 
+	"github.com/albedosehen/rwwwrse/internal/headers"
 	"github.com/albedosehen/rwwwrse/internal/observability"
 )
 
@@ -111,70 +111,76 @@ func (m *securityHeadersMiddleware) Wrap(next http.Handler) http.Handler {
 func (m *securityHeadersMiddleware) setSecurityHeaders(w http.ResponseWriter, r *http.Request) {
 	headers := w.Header()
 
+	applySecurityHeaders(headers, m.config, r.TLS != nil)
+
+	// Server header (hide server information)
+	headers.Set("Server", "rwwwrse")
+
+	// X-Powered-By header (remove if exists)
+	headers.Del("X-Powered-By")
+
+	if m.logger != nil {
+		requestID := GetRequestID(r.Context())
+		m.logger.Debug(r.Context(), "Security headers applied",
+			observability.String("request_id", requestID),
+			observability.String("method", r.Method),
+			observability.String("path", r.URL.Path),
+			observability.Bool("https", r.TLS != nil),
+		)
+	}
+}
+
+// applySecurityHeaders sets every non-empty header of config. HSTS is only
+// sent over HTTPS.
+func applySecurityHeaders(headers http.Header, config SecurityConfig, https bool) {
 	// Content Security Policy
-	if m.config.ContentSecurityPolicy != "" {
-		headers.Set("Content-Security-Policy", m.config.ContentSecurityPolicy)
+	if config.ContentSecurityPolicy != "" {
+		headers.Set("Content-Security-Policy", config.ContentSecurityPolicy)
 	}
 
 	// Strict Transport Security (only for HTTPS)
-	if r.TLS != nil && m.config.StrictTransportSecurity != "" {
-		headers.Set("Strict-Transport-Security", m.config.StrictTransportSecurity)
+	if https && config.StrictTransportSecurity != "" {
+		headers.Set("Strict-Transport-Security", config.StrictTransportSecurity)
 	}
 
 	// X-Frame-Options
-	if m.config.FrameOptions != "" {
-		headers.Set("X-Frame-Options", m.config.FrameOptions)
+	if config.FrameOptions != "" {
+		headers.Set("X-Frame-Options", config.FrameOptions)
 	}
 
 	// X-Content-Type-Options
-	if m.config.ContentTypeOptions != "" {
-		headers.Set("X-Content-Type-Options", m.config.ContentTypeOptions)
+	if config.ContentTypeOptions != "" {
+		headers.Set("X-Content-Type-Options", config.ContentTypeOptions)
 	}
 
 	// X-XSS-Protection
-	if m.config.XSSProtection != "" {
-		headers.Set("X-XSS-Protection", m.config.XSSProtection)
+	if config.XSSProtection != "" {
+		headers.Set("X-XSS-Protection", config.XSSProtection)
 	}
 
 	// Referrer-Policy
-	if m.config.ReferrerPolicy != "" {
-		headers.Set("Referrer-Policy", m.config.ReferrerPolicy)
+	if config.ReferrerPolicy != "" {
+		headers.Set("Referrer-Policy", config.ReferrerPolicy)
 	}
 
 	// Permissions-Policy
-	if m.config.PermissionsPolicy != "" {
-		headers.Set("Permissions-Policy", m.config.PermissionsPolicy)
+	if config.PermissionsPolicy != "" {
+		headers.Set("Permissions-Policy", config.PermissionsPolicy)
 	}
 
 	// Cross-Origin-Embedder-Policy
-	if m.config.CrossOriginEmbedderPolicy != "" {
-		headers.Set("Cross-Origin-Embedder-Policy", m.config.CrossOriginEmbedderPolicy)
+	if config.CrossOriginEmbedderPolicy != "" {
+		headers.Set("Cross-Origin-Embedder-Policy", config.CrossOriginEmbedderPolicy)
 	}
 
 	// Cross-Origin-Opener-Policy
-	if m.config.CrossOriginOpenerPolicy != "" {
-		headers.Set("Cross-Origin-Opener-Policy", m.config.CrossOriginOpenerPolicy)
+	if config.CrossOriginOpenerPolicy != "" {
+		headers.Set("Cross-Origin-Opener-Policy", config.CrossOriginOpenerPolicy)
 	}
 
 	// Cross-Origin-Resource-Policy
-	if m.config.CrossOriginResourcePolicy != "" {
-		headers.Set("Cross-Origin-Resource-Policy", m.config.CrossOriginResourcePolicy)
-	}
-
-	// Server header (hide server information)
-	headers.Set("Server", "rwwwrse")
-
-	// X-Powered-By header (remove if exists)
-	headers.Del("X-Powered-By")
-
-	if m.logger != nil {
-		requestID := GetRequestID(r.Context())
-		m.logger.Debug(r.Context(), "Security headers applied",
-			observability.String("request_id", requestID),
-			observability.String("method", r.Method),
-			observability.String("path", r.URL.Path),
-			observability.Bool("https", r.TLS != nil),
-		)
+	if config.CrossOriginResourcePolicy != "" {
+		headers.Set("Cross-Origin-Resource-Policy", config.CrossOriginResourcePolicy)
 	}
 }
 
@@ -225,108 +231,145 @@ func (m *secureHeadersOnlyMiddleware) Wrap(next http.Handler) http.Handler {
 	})
 }
 
-// SecurityHeadersValidator validates security headers configuration.
-type SecurityHeadersValidator struct{}
+// HeaderProfileConfig holds a named set of response header changes applied
+// on top of the global security headers.
+type HeaderProfileConfig struct {
+	// Name identifies the profile in logs.
+	Name string
 
-// NewSecurityHeadersValidator creates a new security headers validator.
-func NewSecurityHeadersValidator() *SecurityHeadersValidator {
-	return &SecurityHeadersValidator{}
-}
+	// Headers overrides the global security headers; empty fields are kept.
+	Headers SecurityConfig
 
-// Validate validates the security configuration.
-func (v *SecurityHeadersValidator) Validate(config SecurityConfig) error {
-	// Validate CSP
-	if config.ContentSecurityPolicy != "" {
-		if err := v.validateCSP(config.ContentSecurityPolicy); err != nil {
-			return err
-		}
-	}
+	// Set overrides arbitrary response headers, including backend ones.
+	Set map[string]string
 
-	// Validate HSTS
-	if config.StrictTransportSecurity != "" {
-		if err := v.validateHSTS(config.StrictTransportSecurity); err != nil {
-			return err
-		}
-	}
+	// Add appends values to arbitrary response headers.
+	Add map[string]string
 
-	// Validate Frame Options
-	if config.FrameOptions != "" {
-		if err := v.validateFrameOptions(config.FrameOptions); err != nil {
-			return err
-		}
-	}
+	// Remove deletes response headers, including backend ones.
+	Remove []string
+}
 
-	return nil
+// headerProfileMiddleware applies a security header profile.
+type headerProfileMiddleware struct {
+	config  HeaderProfileConfig
+	logger  observability.Logger
+	metrics observability.MetricsCollector
 }
 
-// validateCSP validates Content Security Policy syntax.
-func (v *SecurityHeadersValidator) validateCSP(csp string) error {
-	// Basic CSP validation - check for required directives
-	if csp == "" {
-		return nil
+// NewHeaderProfileMiddleware creates a new security header profile middleware.
+func NewHeaderProfileMiddleware(
+	config HeaderProfileConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewSecurityHeadersValidator()
+	if err := validator.Validate(config.Headers); err != nil {
+		return nil, fmt.Errorf("header profile %s: %w", config.Name, err)
 	}
 
-	// CSP should contain at least default-src
-	if !contains(csp, "default-src") {
-		return ErrInvalidCSP
-	}
+	return &headerProfileMiddleware{
+		config:  config,
+		logger:  logger,
+		metrics: metrics,
+	}, nil
+}
 
-	return nil
+// Wrap implements the Middleware interface.
+func (m *headerProfileMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		applySecurityHeaders(w.Header(), m.config.Headers, r.TLS != nil)
+
+		// Arbitrary header changes also apply to backend headers, so they
+		// are made when the response is committed.
+		pw := &headerProfileWriter{ResponseWriter: w, profile: &m.config}
+		next.ServeHTTP(pw, r)
+		pw.apply()
+	})
 }
 
-// validateHSTS validates HTTP Strict Transport Security syntax.
-func (v *SecurityHeadersValidator) validateHSTS(hsts string) error {
-	if hsts == "" {
-		return nil
-	}
+// headerProfileWriter applies a profile's header changes before the
+// response header is written.
+type headerProfileWriter struct {
+	http.ResponseWriter
+	profile *HeaderProfileConfig
+	applied bool
+}
 
-	// HSTS should contain max-age
-	if !contains(hsts, "max-age=") {
-		return ErrInvalidHSTS
+// apply makes the profile's set, add and remove changes once.
+func (w *headerProfileWriter) apply() {
+	if w.applied {
+		return
 	}
+	w.applied = true
 
-	return nil
+	headers := w.Header()
+	for name, value := range w.profile.Set {
+		headers.Set(name, value)
+	}
+	for name, value := range w.profile.Add {
+		headers.Add(name, value)
+	}
+	for _, name := range w.profile.Remove {
+		headers.Del(name)
+	}
 }
 
-// validateFrameOptions validates X-Frame-Options values.
-func (v *SecurityHeadersValidator) validateFrameOptions(frameOptions string) error {
-	validOptions := []string{"DENY", "SAMEORIGIN"}
+// WriteHeader applies the profile and writes the status code.
+func (w *headerProfileWriter) WriteHeader(statusCode int) {
+	w.apply()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
 
-	if slices.Contains(validOptions, frameOptions) {
-		return nil
-	}
+// Write applies the profile and writes the body.
+func (w *headerProfileWriter) Write(data []byte) (int, error) {
+	w.apply()
+	return w.ResponseWriter.Write(data)
+}
 
-	// Check for ALLOW-FROM syntax
-	if len(frameOptions) > 10 && frameOptions[:10] == "ALLOW-FROM" {
-		return nil
+// Flush implements http.Flusher interface.
+func (w *headerProfileWriter) Flush() {
+	w.apply()
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
 	}
+}
 
-	return ErrInvalidFrameOptions
+// Unwrap returns the underlying writer for http.ResponseController.
+func (w *headerProfileWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
 }
 
-// contains is a helper function to check if a string contains a substring.
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) &&
-		(s == substr ||
-			(len(s) > len(substr) &&
-				(s[:len(substr)] == substr ||
-					s[len(s)-len(substr):] == substr ||
-					containsMiddle(s, substr))))
+// SecurityHeadersValidator validates security headers configuration.
+type SecurityHeadersValidator struct{}
+
+// NewSecurityHeadersValidator creates a new security headers validator.
+func NewSecurityHeadersValidator() *SecurityHeadersValidator {
+	return &SecurityHeadersValidator{}
 }
 
-// containsMiddle checks if substring exists in the middle of string.
-func containsMiddle(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
-		}
-	}
-	return false
+// Validate validates the security configuration.
+func (v *SecurityHeadersValidator) Validate(config SecurityConfig) error {
+	return headers.ValidateSecurityValues(headers.SecurityValues{
+		ContentSecurityPolicy:     config.ContentSecurityPolicy,
+		StrictTransportSecurity:   config.StrictTransportSecurity,
+		FrameOptions:              config.FrameOptions,
+		ReferrerPolicy:            config.ReferrerPolicy,
+		PermissionsPolicy:         config.PermissionsPolicy,
+		CrossOriginOpenerPolicy:   config.CrossOriginOpenerPolicy,
+		CrossOriginEmbedderPolicy: config.CrossOriginEmbedderPolicy,
+		CrossOriginResourcePolicy: config.CrossOriginResourcePolicy,
+	})
 }
 
 // Security error definitions.
 var (
-	ErrInvalidCSP          = fmt.Errorf("invalid Content Security Policy")
-	ErrInvalidHSTS         = fmt.Errorf("invalid HTTP Strict Transport Security")
-	ErrInvalidFrameOptions = fmt.Errorf("invalid X-Frame-Options")
+	ErrInvalidCSP          = headers.ErrInvalidCSP
+	ErrInvalidHSTS         = headers.ErrInvalidHSTS
+	ErrInvalidFrameOptions = headers.ErrInvalidFrameOptions
+
+	ErrInvalidHSTSPreload       = headers.ErrInvalidHSTSPreload
+	ErrInvalidReferrerPolicy    = headers.ErrInvalidReferrerPolicy
+	ErrInvalidPermissionsPolicy = headers.ErrInvalidPermissionsPolicy
+	ErrInvalidCrossOriginPolicy = headers.ErrInvalidCrossOriginPolicy
 )
@@ -1,13 +1,20 @@
 package middleware
 
 import (
+	"bufio"
 	"crypto/tls"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
 )
@@ -693,3 +700,219 @@ func BenchmarkSecurityHeadersMiddleware_EmptyConfig(b *testing.B) {
 		wrappedHandler.ServeHTTP(rec, req)
 	}
 }
+
+func TestHeaderProfileMiddleware_Wrap(t *testing.T) {
+	tests := []struct {
+		name            string
+		profile         HeaderProfileConfig
+		backendHeaders  map[string]string
+		expectedHeaders map[string]string
+		removedHeaders  []string
+	}{
+		{
+			name: "Wrap_EmbeddableProfile_OverridesFrameOptions",
+			profile: HeaderProfileConfig{
+				Name: "embeddable",
+				Headers: SecurityConfig{
+					FrameOptions:              "SAMEORIGIN",
+					CrossOriginResourcePolicy: "cross-origin",
+				},
+			},
+			expectedHeaders: map[string]string{
+				"X-Frame-Options":              "SAMEORIGIN",
+				"Cross-Origin-Resource-Policy": "cross-origin",
+				"X-Content-Type-Options":       "nosniff",
+			},
+		},
+		{
+			name: "Wrap_SetAndRemove_AppliedToBackendHeaders",
+			profile: HeaderProfileConfig{
+				Name:   "api",
+				Set:    map[string]string{"cache-control": "no-store"},
+				Remove: []string{"X-Powered-By", "X-Frame-Options"},
+			},
+			backendHeaders: map[string]string{
+				"Cache-Control": "public, max-age=60",
+				"X-Powered-By":  "Express",
+			},
+			expectedHeaders: map[string]string{"Cache-Control": "no-store"},
+			removedHeaders:  []string{"X-Powered-By", "X-Frame-Options"},
+		},
+		{
+			name: "Wrap_HSTSPreload_SetOverHTTPS",
+			profile: HeaderProfileConfig{
+				Name:    "strict",
+				Headers: SecurityConfig{StrictTransportSecurity: "max-age=63072000; includeSubDomains; preload"},
+			},
+			expectedHeaders: map[string]string{"Strict-Transport-Security": "max-age=63072000; includeSubDomains; preload"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			global := NewSecurityHeadersMiddlewareWithConfig(DefaultSecurityConfig(), nil, nil)
+			profile, err := NewHeaderProfileMiddleware(tt.profile, nil, nil)
+			require.NoError(t, err)
+
+			handler := global.Wrap(profile.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for name, value := range tt.backendHeaders {
+					w.Header().Set(name, value)
+				}
+				w.WriteHeader(http.StatusOK)
+			})))
+
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+			req.TLS = &tls.ConnectionState{}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			for name, value := range tt.expectedHeaders {
+				assert.Equal(t, value, rec.Header().Get(name), "Header %s should match", name)
+			}
+			for _, name := range tt.removedHeaders {
+				assert.Empty(t, rec.Header().Get(name), "Header %s should be removed", name)
+			}
+		})
+	}
+}
+
+// proxyUpgrade sends a protocol upgrade through mw and a reverse proxy to a
+// backend that echoes one line over the upgraded connection. It returns the
+// upgrade response and the echoed line.
+func proxyUpgrade(t *testing.T, mw Middleware) (*http.Response, string) {
+	t.Helper()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+		_ = brw.Flush()
+		line, _ := brw.ReadString('\n')
+		_, _ = brw.WriteString(line)
+		_ = brw.Flush()
+	}))
+	t.Cleanup(backend.Close)
+
+	target, err := url.Parse(backend.URL)
+	require.NoError(t, err)
+	front := httptest.NewServer(mw.Wrap(httputil.NewSingleHostReverseProxy(target)))
+	t.Cleanup(front.Close)
+
+	conn, err := net.Dial("tcp", front.Listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	_, err = fmt.Fprint(conn, "GET / HTTP/1.1\r\nHost: app.example.com\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\n")
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	require.NoError(t, err)
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return resp, ""
+	}
+
+	_, err = fmt.Fprint(conn, "ping\n")
+	require.NoError(t, err)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	return resp, line
+}
+
+func TestHeaderProfileMiddleware_Wrap_Upgrade(t *testing.T) {
+	// Arrange
+	mw, err := NewHeaderProfileMiddleware(HeaderProfileConfig{
+		Name:    "embeddable",
+		Headers: SecurityConfig{FrameOptions: "SAMEORIGIN"},
+	}, nil, nil)
+	require.NoError(t, err)
+
+	// Act
+	resp, echoed := proxyUpgrade(t, mw)
+
+	// Assert
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "echo", resp.Header.Get("Upgrade"))
+	assert.Equal(t, "ping\n", echoed)
+}
+
+func TestSecurityHeadersValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*SecurityConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*SecurityConfig) {},
+		},
+		{
+			name:        "Validate_PreloadShortMaxAge_ReturnsError",
+			mutate:      func(c *SecurityConfig) { c.StrictTransportSecurity = "max-age=86400; includeSubDomains; preload" },
+			expectedErr: ErrInvalidHSTSPreload,
+		},
+		{
+			name:        "Validate_PreloadWithoutSubdomains_ReturnsError",
+			mutate:      func(c *SecurityConfig) { c.StrictTransportSecurity = "max-age=63072000; preload" },
+			expectedErr: ErrInvalidHSTSPreload,
+		},
+		{
+			name:        "Validate_UnknownReferrerPolicy_ReturnsError",
+			mutate:      func(c *SecurityConfig) { c.ReferrerPolicy = "never" },
+			expectedErr: ErrInvalidReferrerPolicy,
+		},
+		{
+			name: "Validate_PermissionsPolicyAllowlist_Valid",
+			mutate: func(c *SecurityConfig) {
+				c.PermissionsPolicy = `camera=(), geolocation=(self "https://maps.example.com"), fullscreen=*`
+			},
+		},
+		{
+			name:        "Validate_PermissionsPolicyFeaturePolicySyntax_ReturnsError",
+			mutate:      func(c *SecurityConfig) { c.PermissionsPolicy = "geolocation 'self'" },
+			expectedErr: ErrInvalidPermissionsPolicy,
+		},
+		{
+			name:        "Validate_UnknownCOOP_ReturnsError",
+			mutate:      func(c *SecurityConfig) { c.CrossOriginOpenerPolicy = "isolated" },
+			expectedErr: ErrInvalidCrossOriginPolicy,
+		},
+		{
+			name:        "Validate_UnknownCOEP_ReturnsError",
+			mutate:      func(c *SecurityConfig) { c.CrossOriginEmbedderPolicy = "require-cors" },
+			expectedErr: ErrInvalidCrossOriginPolicy,
+		},
+		{
+			name:        "Validate_UnknownCORP_ReturnsError",
+			mutate:      func(c *SecurityConfig) { c.CrossOriginResourcePolicy = "any" },
+			expectedErr: ErrInvalidCrossOriginPolicy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultSecurityConfig()
+			tt.mutate(&config)
+
+			// Act
+			err := NewSecurityHeadersValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Package middleware implements encrypted cookie sessions.
+package middleware
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxCookieValueSize is the largest cookie value browsers reliably accept.
+const maxCookieValueSize = 4000
+
+// cookieSealer encrypts and authenticates cookie payloads using AES-GCM.
+// The cookie name is bound to the ciphertext as additional data so a value
+// cannot be replayed under a different cookie.
+type cookieSealer struct {
+	aead cipher.AEAD
+}
+
+// newCookieSealer derives an AES-256 key from the secret and creates a sealer.
+func newCookieSealer(secret string) (*cookieSealer, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("cookie secret cannot be empty")
+	}
+
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cookie cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cookie AEAD: %w", err)
+	}
+
+	return &cookieSealer{aead: aead}, nil
+}
+
+// seal encodes v as JSON and encrypts it for the named cookie.
+func (s *cookieSealer) seal(name string, v any) (string, error) {
+	plaintext, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cookie payload: %w", err)
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate cookie nonce: %w", err)
+	}
+
+	sealed := s.aead.Seal(nonce, nonce, plaintext, []byte(name))
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a value produced by seal for the named cookie into v.
+func (s *cookieSealer) open(name, value string, v any) error {
+	sealed, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return fmt.Errorf("invalid cookie encoding: %w", err)
+	}
+
+	nonceSize := s.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return fmt.Errorf("cookie value too short")
+	}
+
+	plaintext, err := s.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], []byte(name))
+	if err != nil {
+		return fmt.Errorf("cookie authentication failed: %w", err)
+	}
+
+	if err := json.Unmarshal(plaintext, v); err != nil {
+		return fmt.Errorf("invalid cookie payload: %w", err)
+	}
+
+	return nil
+}
+
+// cookieOptions holds the attributes applied to session cookies.
+type cookieOptions struct {
+	Domain   string
+	Path     string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+// newCookie creates an HttpOnly cookie with the configured attributes.
+func (o cookieOptions) newCookie(name, value string, maxAge time.Duration) *http.Cookie {
+	path := o.Path
+	if path == "" {
+		path = "/"
+	}
+
+	sameSite := o.SameSite
+	if sameSite == 0 {
+		sameSite = http.SameSiteLaxMode
+	}
+
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Domain:   o.Domain,
+		Path:     path,
+		Secure:   o.Secure,
+		HttpOnly: true,
+		SameSite: sameSite,
+	}
+
+	if maxAge > 0 {
+		cookie.MaxAge = int(maxAge.Seconds())
+		cookie.Expires = time.Now().Add(maxAge)
+	}
+
+	return cookie
+}
+
+// expiredCookie creates a cookie that instructs the browser to delete name.
+func (o cookieOptions) expiredCookie(name string) *http.Cookie {
+	cookie := o.newCookie(name, "", 0)
+	cookie.MaxAge = -1
+	cookie.Expires = time.Unix(0, 0)
+	return cookie
+}
@@ -0,0 +1,275 @@
+// Package middleware implements strict HTTP parsing against request smuggling.
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/httpstrict"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// Strict HTTP path policies.
+const (
+	StrictPolicyReject = "reject"
+	StrictPolicyAllow  = "allow"
+)
+
+// Strict HTTP rejection reasons detected on parsed requests. Reasons found
+// in the raw request stream are defined by the httpstrict package.
+const (
+	StrictReasonUnknownMethod = "unknown_method"
+	StrictReasonDotSegment    = "dot_segment"
+	StrictReasonEncodedSlash  = "encoded_slash"
+	StrictReasonNullByte      = "null_byte"
+)
+
+// strictStandardMethods are the methods of RFC 9110 and RFC 5789.
+var strictStandardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// strictProtectedHeaders may not be removed by naming them in the
+// Connection header, which would otherwise let a client strip headers that
+// the proxy or backends rely on.
+var strictProtectedHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Authorization":     true,
+	"Cookie":            true,
+	"Forwarded":         true,
+	"X-Forwarded-For":   true,
+	"X-Forwarded-Host":  true,
+	"X-Forwarded-Proto": true,
+	"X-Real-Ip":         true,
+	"X-Request-Id":      true,
+}
+
+// StrictHTTPConfig holds configuration for the strict HTTP middleware.
+type StrictHTTPConfig struct {
+	// ExtraMethods are accepted in addition to the standard methods, e.g.
+	// WebDAV methods such as PROPFIND.
+	ExtraMethods []string
+
+	// DotSegments is "reject" or "allow" for "." and ".." path segments,
+	// including percent-encoded forms.
+	DotSegments string
+
+	// EncodedSlashes is "reject" or "allow" for %2F, %5C and backslashes
+	// in the path.
+	EncodedSlashes string
+}
+
+// DefaultStrictHTTPConfig returns a strict HTTP configuration with sensible defaults.
+func DefaultStrictHTTPConfig() StrictHTTPConfig {
+	return StrictHTTPConfig{
+		DotSegments:    StrictPolicyReject,
+		EncodedSlashes: StrictPolicyReject,
+	}
+}
+
+// strictHTTPMiddleware rejects ambiguous requests and normalizes hop-by-hop
+// headers before anything else inspects the request.
+type strictHTTPMiddleware struct {
+	config  StrictHTTPConfig
+	methods map[string]bool
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+}
+
+// NewStrictHTTPMiddleware creates a new strict HTTP middleware.
+func NewStrictHTTPMiddleware(
+	config StrictHTTPConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewStrictHTTPValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	methods := make(map[string]bool)
+	for _, method := range strictStandardMethods {
+		methods[method] = true
+	}
+	for _, method := range config.ExtraMethods {
+		methods[method] = true
+	}
+
+	return &strictHTTPMiddleware{
+		config:  config,
+		methods: methods,
+		logger:  logger,
+		metrics: metrics,
+	}, nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *strictHTTPMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reason := m.check(r); reason != "" {
+			m.reject(w, r, reason)
+			return
+		}
+
+		normalizeHopByHopHeaders(r.Header)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// check returns the reason to reject r, or "" when it is acceptable.
+func (m *strictHTTPMiddleware) check(r *http.Request) string {
+	if reason := httpstrict.FromContext(r.Context()); reason != "" {
+		return reason
+	}
+
+	if !m.methods[r.Method] {
+		return StrictReasonUnknownMethod
+	}
+
+	for name, values := range r.Header {
+		for _, value := range values {
+			if reason := httpstrict.CheckHeader(name, value); reason != "" {
+				return reason
+			}
+		}
+	}
+
+	return m.checkPath(r)
+}
+
+// checkPath applies the path policies to the request target.
+func (m *strictHTTPMiddleware) checkPath(r *http.Request) string {
+	if r.URL.Path == "" || r.URL.Path == "*" {
+		return ""
+	}
+
+	if strings.Contains(r.URL.Path, "\x00") {
+		return StrictReasonNullByte
+	}
+
+	if m.config.EncodedSlashes == StrictPolicyReject {
+		lower := strings.ToLower(r.URL.EscapedPath())
+		if strings.Contains(lower, "%2f") || strings.Contains(lower, "%5c") || strings.Contains(r.URL.Path, `\`) {
+			return StrictReasonEncodedSlash
+		}
+	}
+
+	if m.config.DotSegments == StrictPolicyReject {
+		// The decoded path also exposes percent-encoded dots.
+		for _, segment := range strings.Split(r.URL.Path, "/") {
+			if segment == "." || segment == ".." {
+				return StrictReasonDotSegment
+			}
+		}
+	}
+
+	return ""
+}
+
+// reject logs and records the rejection and closes the connection, since
+// the boundaries of any further requests on it cannot be trusted.
+func (m *strictHTTPMiddleware) reject(w http.ResponseWriter, r *http.Request, reason string) {
+	if m.logger != nil {
+		m.logger.Warn(r.Context(), "Request rejected by strict HTTP parsing",
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.String("reason", reason),
+			observability.String("method", sanitizeString(r.Method)),
+			observability.String("path", sanitizeString(r.URL.EscapedPath())),
+			observability.String("client_ip", getClientIP(r)),
+		)
+	}
+
+	if m.metrics != nil {
+		m.metrics.RecordStrictHTTPRejection(reason)
+	}
+
+	err := proxyerrors.WrapError(proxyerrors.ErrCodeRequestInvalid, "malformed request", nil)
+	if reason == StrictReasonUnknownMethod {
+		err = proxyerrors.WrapError(proxyerrors.ErrCodeNotImplemented, "method not implemented", nil)
+	}
+
+	w.Header().Set("Connection", "close")
+	writeErrorResponse(w, r, err.WithContext("reason", reason))
+}
+
+// normalizeHopByHopHeaders removes the headers that only apply to the
+// client connection. Headers nominated by Connection are removed unless
+// they are protected, and Connection keeps only its standard options.
+func normalizeHopByHopHeaders(header http.Header) {
+	var options []string
+	for _, value := range header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			token = textproto.TrimString(token)
+			if token == "" {
+				continue
+			}
+
+			switch strings.ToLower(token) {
+			case "close", "keep-alive", "upgrade":
+				options = append(options, strings.ToLower(token))
+				continue
+			}
+
+			if name := http.CanonicalHeaderKey(token); !strictProtectedHeaders[name] {
+				header.Del(name)
+			}
+		}
+	}
+
+	header.Del("Connection")
+	if len(options) > 0 {
+		header.Set("Connection", strings.Join(options, ", "))
+	}
+
+	header.Del("Keep-Alive")
+	header.Del("Proxy-Connection")
+
+	// Only the trailers option of TE is meaningful to a backend.
+	if te := header.Values("Te"); len(te) > 0 {
+		header.Del("Te")
+		for _, value := range te {
+			for _, token := range strings.Split(value, ",") {
+				if strings.EqualFold(textproto.TrimString(token), "trailers") {
+					header.Set("Te", "trailers")
+				}
+			}
+		}
+	}
+}
+
+// StrictHTTPValidator validates strict HTTP configuration.
+type StrictHTTPValidator struct{}
+
+// NewStrictHTTPValidator creates a new strict HTTP configuration validator.
+func NewStrictHTTPValidator() *StrictHTTPValidator {
+	return &StrictHTTPValidator{}
+}
+
+// Validate validates the strict HTTP configuration.
+func (v *StrictHTTPValidator) Validate(config StrictHTTPConfig) error {
+	for _, method := range config.ExtraMethods {
+		if !httpstrict.IsToken(method) || strings.ToUpper(method) != method {
+			return fmt.Errorf("%w: %q", ErrInvalidStrictMethod, method)
+		}
+	}
+
+	for _, policy := range []string{config.DotSegments, config.EncodedSlashes} {
+		if policy != StrictPolicyReject && policy != StrictPolicyAllow {
+			return fmt.Errorf("%w: %q", ErrInvalidStrictPolicy, policy)
+		}
+	}
+
+	return nil
+}
+
+// Strict HTTP validation errors.
+var (
+	ErrInvalidStrictMethod = fmt.Errorf("strict HTTP extra method must be an uppercase token")
+	ErrInvalidStrictPolicy = fmt.Errorf("strict HTTP path policy must be reject or allow")
+)
@@ -0,0 +1,208 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/albedosehen/rwwwrse/internal/httpstrict"
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+// rawStreamConn is a connection that reads a fixed raw request stream.
+type rawStreamConn struct {
+	net.Conn
+	stream io.Reader
+}
+
+func (c *rawStreamConn) Read(b []byte) (int, error) {
+	return c.stream.Read(b)
+}
+
+// newStrictTestConnContext returns a context whose connection has read stream.
+func newStrictTestConnContext(t *testing.T, stream string) context.Context {
+	t.Helper()
+
+	conn := httpstrict.NewConn(&rawStreamConn{stream: strings.NewReader(stream)})
+	_, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return httpstrict.WithConn(context.Background(), conn)
+}
+
+func TestStrictHTTPMiddleware_Rejections(t *testing.T) {
+	tests := []struct {
+		name           string
+		mutate         func(*StrictHTTPConfig)
+		method         string
+		target         string
+		stream         string
+		expectedStatus int
+		expectedReason string
+	}{
+		{
+			name:           "Rejections_PlainRequest_Passes",
+			method:         http.MethodGet,
+			target:         "/api/items",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Rejections_FlaggedConnection_BadRequest",
+			method:         http.MethodPost,
+			target:         "/",
+			stream:         "POST / HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			expectedStatus: http.StatusBadRequest,
+			expectedReason: httpstrict.ReasonContentLengthWithTE,
+		},
+		{
+			name:           "Rejections_UnknownMethod_NotImplemented",
+			method:         "PROPFIND",
+			target:         "/",
+			expectedStatus: http.StatusNotImplemented,
+			expectedReason: StrictReasonUnknownMethod,
+		},
+		{
+			name:           "Rejections_ExtraMethod_Passes",
+			mutate:         func(c *StrictHTTPConfig) { c.ExtraMethods = []string{"PROPFIND"} },
+			method:         "PROPFIND",
+			target:         "/",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Rejections_EncodedDotSegment_BadRequest",
+			method:         http.MethodGet,
+			target:         "/static/%2e%2e/admin",
+			expectedStatus: http.StatusBadRequest,
+			expectedReason: StrictReasonDotSegment,
+		},
+		{
+			name:           "Rejections_EncodedSlash_BadRequest",
+			method:         http.MethodGet,
+			target:         "/files/a%2Fb",
+			expectedStatus: http.StatusBadRequest,
+			expectedReason: StrictReasonEncodedSlash,
+		},
+		{
+			name:           "Rejections_EncodedSlashAllowed_Passes",
+			mutate:         func(c *StrictHTTPConfig) { c.EncodedSlashes = StrictPolicyAllow },
+			method:         http.MethodGet,
+			target:         "/files/a%2Fb",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Rejections_EncodedNull_BadRequest",
+			method:         http.MethodGet,
+			target:         "/files/a%00.txt",
+			expectedStatus: http.StatusBadRequest,
+			expectedReason: StrictReasonNullByte,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			metrics := testhelpers.NewMockMetricsCollector()
+			if tt.expectedReason != "" {
+				metrics.On("RecordStrictHTTPRejection", tt.expectedReason).Return().Once()
+			}
+
+			config := DefaultStrictHTTPConfig()
+			if tt.mutate != nil {
+				tt.mutate(&config)
+			}
+			mw, err := NewStrictHTTPMiddleware(config, nil, metrics)
+			require.NoError(t, err)
+			handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.stream != "" {
+				req = req.WithContext(newStrictTestConnContext(t, tt.stream))
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedReason != "" {
+				assert.Equal(t, "close", rec.Header().Get("Connection"))
+			}
+			metrics.AssertExpectations(t)
+		})
+	}
+}
+
+func TestNormalizeHopByHopHeaders(t *testing.T) {
+	// Arrange
+	header := http.Header{
+		"Connection":       {"keep-alive, X-Debug, X-Forwarded-For", "Upgrade"},
+		"X-Debug":          {"1"},
+		"X-Forwarded-For":  {"203.0.113.7"},
+		"Keep-Alive":       {"timeout=5"},
+		"Proxy-Connection": {"keep-alive"},
+		"Te":               {"gzip, trailers"},
+		"Upgrade":          {"websocket"},
+	}
+
+	// Act
+	normalizeHopByHopHeaders(header)
+
+	// Assert
+	assert.Equal(t, "keep-alive, upgrade", header.Get("Connection"))
+	assert.Empty(t, header.Get("X-Debug"))
+	assert.Equal(t, "203.0.113.7", header.Get("X-Forwarded-For"))
+	assert.Empty(t, header.Get("Keep-Alive"))
+	assert.Empty(t, header.Get("Proxy-Connection"))
+	assert.Equal(t, "trailers", header.Get("Te"))
+	assert.Equal(t, "websocket", header.Get("Upgrade"))
+}
+
+func TestStrictHTTPValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*StrictHTTPConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*StrictHTTPConfig) {},
+		},
+		{
+			name:        "Validate_LowercaseMethod_ReturnsError",
+			mutate:      func(c *StrictHTTPConfig) { c.ExtraMethods = []string{"propfind"} },
+			expectedErr: ErrInvalidStrictMethod,
+		},
+		{
+			name:        "Validate_UnknownPolicy_ReturnsError",
+			mutate:      func(c *StrictHTTPConfig) { c.DotSegments = "normalize" },
+			expectedErr: ErrInvalidStrictPolicy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultStrictHTTPConfig()
+			tt.mutate(&config)
+
+			// Act
+			err := NewStrictHTTPValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -5,12 +5,15 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"maps"
-	"net"
 	"net/http"
 	"slices"
-	"strings"
+
+	"github.com/albedosehen/rwwwrse/internal/clientip"
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
 )
 
 // contextKey is a custom type for context keys to avoid collisions.
@@ -21,28 +24,6 @@ const (
 	requestIDKey contextKey = "request_id"
 )
 
-// HTTP headers used for client IP extraction.
-const (
-	headerXForwardedFor    = "X-Forwarded-For"
-	headerXRealIP          = "X-Real-IP"
-	headerXClientIP        = "X-Client-IP"
-	headerXOriginalFor     = "X-Original-For"
-	headerXClusterClientIP = "X-Cluster-Client-IP"
-	headerForwarded        = "Forwarded"
-	headerCFConnectingIP   = "CF-Connecting-IP"
-	headerTrueClientIP     = "True-Client-IP"
-)
-
-// IP address validation constants.
-const (
-	// ipv4LoopbackCIDR = "127.0.0.0/8"
-	// ipv6LoopbackCIDR = "::1/128"
-	ipv4PrivateCIDR1 = "10.0.0.0/8"
-	ipv4PrivateCIDR2 = "172.16.0.0/12"
-	ipv4PrivateCIDR3 = "192.168.0.0/16"
-	ipv6PrivateCIDR  = "fc00::/7"
-)
-
 // SetRequestID sets the request ID in the context.
 func SetRequestID(ctx context.Context, requestID string) context.Context {
 	return context.WithValue(ctx, requestIDKey, requestID)
@@ -116,167 +97,22 @@ func isSuccessStatus(statusCode int) bool {
 	return statusCode >= 200 && statusCode < 300
 }
 
-// getClientIP extracts the real client IP address from HTTP request headers.
-// It checks various proxy headers in order of preference and validates IP addresses.
-// Returns the first valid, non-private IP address found, or falls back to RemoteAddr.
+// getClientIP returns the client IP address of the request as determined by
+// the client IP middleware. Forwarding headers are only honoured when they
+// were added by a trusted proxy; without a resolved address the peer address
+// is used.
 func getClientIP(r *http.Request) string {
 	if r == nil {
 		return ""
 	}
 
-	// Define header priority order for IP extraction
-	headerPriority := []string{
-		headerCFConnectingIP,   // Cloudflare
-		headerTrueClientIP,     // Akamai, Cloudflare
-		headerXRealIP,          // Nginx proxy
-		headerXForwardedFor,    // Standard proxy header
-		headerXClientIP,        // Apache mod_proxy
-		headerXClusterClientIP, // Kubernetes
-		headerXOriginalFor,     // Custom proxy setups
-		headerForwarded,        // RFC 7239
-	}
-
-	// Check each header in priority order
-	for _, header := range headerPriority {
-		if ip := extractIPFromHeader(r, header); ip != "" {
-			if validIP := validateAndCleanIP(ip); validIP != "" {
-				return validIP
-			}
-		}
-	}
-
-	// Fall back to RemoteAddr if no valid IP found in headers
-	if remoteIP := extractIPFromRemoteAddr(r.RemoteAddr); remoteIP != "" {
-		return remoteIP
-	}
-
-	return ""
+	return clientip.FromRequest(r).IP
 }
 
-// extractIPFromHeader extracts IP address from a specific header.
-func extractIPFromHeader(r *http.Request, headerName string) string {
-	headerValue := strings.TrimSpace(r.Header.Get(headerName))
-	if headerValue == "" {
-		return ""
-	}
-
-	// Handle special case for Forwarded header (RFC 7239)
-	if headerName == headerForwarded {
-		return extractIPFromForwardedHeader(headerValue)
-	}
-
-	// For comma-separated values, take the first (leftmost) IP
-	// which represents the original client
-	if idx := strings.Index(headerValue, ","); idx != -1 {
-		headerValue = strings.TrimSpace(headerValue[:idx])
-	}
-
-	return headerValue
-}
-
-// extractIPFromForwardedHeader parses RFC 7239 Forwarded header.
-// Example: "for=192.0.2.60;proto=http;by=203.0.113.43"
-func extractIPFromForwardedHeader(forwarded string) string {
-	// Look for "for=" parameter
-	parts := strings.Split(forwarded, ";")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if strings.HasPrefix(strings.ToLower(part), "for=") {
-			forValue := strings.TrimSpace(part[4:])
-			// Remove quotes if present
-			forValue = strings.Trim(forValue, `"`)
-			// Handle IPv6 brackets
-			if strings.HasPrefix(forValue, "[") && strings.HasSuffix(forValue, "]") {
-				forValue = forValue[1 : len(forValue)-1]
-			}
-			return forValue
-		}
-	}
-	return ""
-}
-
-// extractIPFromRemoteAddr extracts IP from RemoteAddr, removing port if present.
-func extractIPFromRemoteAddr(remoteAddr string) string {
-	if remoteAddr == "" {
-		return ""
-	}
-
-	// Handle IPv6 addresses with port
-	if strings.HasPrefix(remoteAddr, "[") {
-		if idx := strings.LastIndex(remoteAddr, "]:"); idx != -1 {
-			return remoteAddr[1:idx]
-		}
-		return strings.Trim(remoteAddr, "[]")
-	}
-
-	// Handle IPv4 addresses with port
-	if idx := strings.LastIndex(remoteAddr, ":"); idx != -1 {
-		// Check if this is actually a port separator (not IPv6)
-		if !strings.Contains(remoteAddr[:idx], ":") {
-			return remoteAddr[:idx]
-		}
-	}
-
-	return remoteAddr
-}
-
-// validateAndCleanIP validates and cleans an IP address string.
-// Returns empty string if IP is invalid or private/loopback.
-func validateAndCleanIP(ipStr string) string {
-	if ipStr == "" {
-		return ""
-	}
-
-	// Parse the IP address
-	ip := net.ParseIP(strings.TrimSpace(ipStr))
-	if ip == nil {
-		return ""
-	}
-
-	// Reject loopback addresses
-	if ip.IsLoopback() {
-		return ""
-	}
-
-	// Reject private addresses for security
-	if isPrivateIP(ip) {
-		return ""
-	}
-
-	// Reject unspecified addresses (0.0.0.0 or ::)
-	if ip.IsUnspecified() {
-		return ""
-	}
-
-	// Return the cleaned IP string
-	return ip.String()
-}
-
-// isPrivateIP checks if an IP address is in a private range.
-func isPrivateIP(ip net.IP) bool {
-	if ip == nil {
-		return false
-	}
-
-	// Define private IP ranges
-	privateRanges := []string{
-		ipv4PrivateCIDR1, // 10.0.0.0/8
-		ipv4PrivateCIDR2, // 172.16.0.0/12
-		ipv4PrivateCIDR3, // 192.168.0.0/16
-		ipv6PrivateCIDR,  // fc00::/7
-	}
-
-	for _, cidr := range privateRanges {
-		_, network, err := net.ParseCIDR(cidr)
-		if err != nil {
-			continue
-		}
-		if network.Contains(ip) {
-			return true
-		}
-	}
-
-	return false
+// getRequestScheme returns the scheme the client used for the request. A
+// forwarded protocol is only honoured when a trusted proxy reported it.
+func getRequestScheme(r *http.Request) string {
+	return clientip.FromRequest(r).Scheme
 }
 
 // validateContentType checks if a content type is allowed.
@@ -326,3 +162,29 @@ func validateMiddlewareConfig(config interface{}) error {
 	// For now, just return nil
 	return nil
 }
+
+// writeErrorResponse writes a proxy error as an RFC 9457 problem, or as
+// HTML or plain text when the client prefers them.
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, err *proxyerrors.ProxyError) {
+	requestID := GetRequestID(r.Context())
+	if requestID == "" {
+		requestID = r.Header.Get("X-Request-ID")
+	}
+
+	proxyerrors.WriteProblem(w, r, err, requestID)
+}
+
+// replayBody is a request body that replays buffered bytes before the rest
+// of the original body, which it closes.
+type replayBody struct {
+	io.Reader
+	io.Closer
+}
+
+// writeAdminJSON writes a successful admin API response. Errors are
+// written with writeErrorResponse.
+func writeAdminJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -2,12 +2,13 @@ package middleware
 
 import (
 	"context"
-	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/albedosehen/rwwwrse/internal/clientip"
 )
 
 func TestSetRequestID(t *testing.T) {
@@ -484,76 +485,6 @@ func TestGetClientIP(t *testing.T) {
 			},
 			expected: "",
 		},
-		{
-			name: "GetClientIP_CloudflareConnectingIP",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("CF-Connecting-IP", "203.0.113.1")
-				req.RemoteAddr = "192.168.1.1:8080"
-				return req
-			},
-			expected: "203.0.113.1",
-		},
-		{
-			name: "GetClientIP_TrueClientIP",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("True-Client-IP", "203.0.113.2")
-				req.RemoteAddr = "192.168.1.1:8080"
-				return req
-			},
-			expected: "203.0.113.2",
-		},
-		{
-			name: "GetClientIP_XRealIP",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("X-Real-IP", "203.0.113.3")
-				req.RemoteAddr = "192.168.1.1:8080"
-				return req
-			},
-			expected: "203.0.113.3",
-		},
-		{
-			name: "GetClientIP_XForwardedFor_Single",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("X-Forwarded-For", "203.0.113.4")
-				req.RemoteAddr = "192.168.1.1:8080"
-				return req
-			},
-			expected: "203.0.113.4",
-		},
-		{
-			name: "GetClientIP_XForwardedFor_Multiple",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("X-Forwarded-For", "203.0.113.5, 192.168.1.2, 10.0.0.1")
-				req.RemoteAddr = "192.168.1.1:8080"
-				return req
-			},
-			expected: "203.0.113.5",
-		},
-		{
-			name: "GetClientIP_ForwardedHeader",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("Forwarded", "for=203.0.113.6;proto=https;by=192.168.1.1")
-				req.RemoteAddr = "192.168.1.1:8080"
-				return req
-			},
-			expected: "203.0.113.6",
-		},
-		{
-			name: "GetClientIP_ForwardedHeader_IPv6",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("Forwarded", `for="[2001:db8::1]";proto=https`)
-				req.RemoteAddr = "192.168.1.1:8080"
-				return req
-			},
-			expected: "2001:db8::1",
-		},
 		{
 			name: "GetClientIP_RemoteAddr_IPv4",
 			setupReq: func() *http.Request {
@@ -573,115 +504,29 @@ func TestGetClientIP(t *testing.T) {
 			expected: "2001:db8::2",
 		},
 		{
-			name: "GetClientIP_PrivateIP_Filtered",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("X-Forwarded-For", "192.168.1.100")
-				req.RemoteAddr = "203.0.113.8:8080"
-				return req
-			},
-			expected: "203.0.113.8",
-		},
-		{
-			name: "GetClientIP_LoopbackIP_Filtered",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("X-Real-IP", "127.0.0.1")
-				req.RemoteAddr = "203.0.113.9:8080"
-				return req
-			},
-			expected: "203.0.113.9",
-		},
-		{
-			name: "GetClientIP_InvalidIP_Filtered",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("X-Forwarded-For", "invalid-ip")
-				req.RemoteAddr = "203.0.113.10:8080"
-				return req
-			},
-			expected: "203.0.113.10",
-		},
-		{
-			name: "GetClientIP_EmptyHeaders_FallbackToRemoteAddr",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.RemoteAddr = "203.0.113.11:8080"
-				return req
-			},
-			expected: "203.0.113.11",
-		},
-		{
-			name: "GetClientIP_HeaderPriority",
+			name: "GetClientIP_UnresolvedForwardingHeaders_Ignored",
 			setupReq: func() *http.Request {
 				req := httptest.NewRequest("GET", "/", nil)
 				req.Header.Set("X-Forwarded-For", "203.0.113.12")
+				req.Header.Set("X-Real-IP", "203.0.113.14")
 				req.Header.Set("CF-Connecting-IP", "203.0.113.13")
-				req.RemoteAddr = "192.168.1.1:8080"
-				return req
-			},
-			expected: "203.0.113.13", // CF-Connecting-IP has higher priority
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Arrange
-			req := tt.setupReq()
-
-			// Act
-			result := getClientIP(req)
-
-			// Assert
-			assert.Equal(t, tt.expected, result)
-		})
-	}
-}
-
-func TestExtractIPFromHeader(t *testing.T) {
-	tests := []struct {
-		name       string
-		headerName string
-		setupReq   func() *http.Request
-		expected   string
-	}{
-		{
-			name:       "ExtractIPFromHeader_XForwardedFor",
-			headerName: "X-Forwarded-For",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("X-Forwarded-For", "203.0.113.1")
+				req.RemoteAddr = "198.51.100.1:8080"
 				return req
 			},
-			expected: "203.0.113.1",
+			expected: "198.51.100.1",
 		},
 		{
-			name:       "ExtractIPFromHeader_EmptyHeader",
-			headerName: "X-Real-IP",
-			setupReq: func() *http.Request {
-				return httptest.NewRequest("GET", "/", nil)
-			},
-			expected: "",
-		},
-		{
-			name:       "ExtractIPFromHeader_CommaSeparated",
-			headerName: "X-Forwarded-For",
-			setupReq: func() *http.Request {
-				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("X-Forwarded-For", "203.0.113.1, 192.168.1.1, 10.0.0.1")
-				return req
-			},
-			expected: "203.0.113.1",
-		},
-		{
-			name:       "ExtractIPFromHeader_ForwardedSpecial",
-			headerName: "Forwarded",
+			name: "GetClientIP_ResolvedAddress_Used",
 			setupReq: func() *http.Request {
 				req := httptest.NewRequest("GET", "/", nil)
-				req.Header.Set("Forwarded", "for=203.0.113.1;proto=https")
-				return req
+				req.RemoteAddr = "10.0.0.1:8080"
+				return req.WithContext(clientip.WithResult(req.Context(), clientip.Result{
+					IP:    "203.0.113.5",
+					Peer:  "10.0.0.1",
+					Chain: []string{"203.0.113.5"},
+				}))
 			},
-			expected: "203.0.113.1",
+			expected: "203.0.113.5",
 		},
 	}
 
@@ -691,229 +536,7 @@ func TestExtractIPFromHeader(t *testing.T) {
 			req := tt.setupReq()
 
 			// Act
-			result := extractIPFromHeader(req, tt.headerName)
-
-			// Assert
-			assert.Equal(t, tt.expected, result)
-		})
-	}
-}
-
-func TestExtractIPFromForwardedHeader(t *testing.T) {
-	tests := []struct {
-		name      string
-		forwarded string
-		expected  string
-	}{
-		{
-			name:      "ExtractIPFromForwardedHeader_Simple",
-			forwarded: "for=203.0.113.1",
-			expected:  "203.0.113.1",
-		},
-		{
-			name:      "ExtractIPFromForwardedHeader_WithQuotes",
-			forwarded: `for="203.0.113.1"`,
-			expected:  "203.0.113.1",
-		},
-		{
-			name:      "ExtractIPFromForwardedHeader_IPv6",
-			forwarded: `for="[2001:db8::1]"`,
-			expected:  "2001:db8::1",
-		},
-		{
-			name:      "ExtractIPFromForwardedHeader_Multiple",
-			forwarded: "for=203.0.113.1;proto=https;by=192.168.1.1",
-			expected:  "203.0.113.1",
-		},
-		{
-			name:      "ExtractIPFromForwardedHeader_NoFor",
-			forwarded: "proto=https;by=192.168.1.1",
-			expected:  "",
-		},
-		{
-			name:      "ExtractIPFromForwardedHeader_Empty",
-			forwarded: "",
-			expected:  "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Act
-			result := extractIPFromForwardedHeader(tt.forwarded)
-
-			// Assert
-			assert.Equal(t, tt.expected, result)
-		})
-	}
-}
-
-func TestExtractIPFromRemoteAddr(t *testing.T) {
-	tests := []struct {
-		name       string
-		remoteAddr string
-		expected   string
-	}{
-		{
-			name:       "ExtractIPFromRemoteAddr_IPv4WithPort",
-			remoteAddr: "203.0.113.1:8080",
-			expected:   "203.0.113.1",
-		},
-		{
-			name:       "ExtractIPFromRemoteAddr_IPv6WithPort",
-			remoteAddr: "[2001:db8::1]:8080",
-			expected:   "2001:db8::1",
-		},
-		{
-			name:       "ExtractIPFromRemoteAddr_IPv4NoPort",
-			remoteAddr: "203.0.113.1",
-			expected:   "203.0.113.1",
-		},
-		{
-			name:       "ExtractIPFromRemoteAddr_IPv6NoPort",
-			remoteAddr: "2001:db8::1",
-			expected:   "2001:db8::1",
-		},
-		{
-			name:       "ExtractIPFromRemoteAddr_Empty",
-			remoteAddr: "",
-			expected:   "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Act
-			result := extractIPFromRemoteAddr(tt.remoteAddr)
-
-			// Assert
-			assert.Equal(t, tt.expected, result)
-		})
-	}
-}
-
-func TestValidateAndCleanIP(t *testing.T) {
-	tests := []struct {
-		name     string
-		ipStr    string
-		expected string
-	}{
-		{
-			name:     "ValidateAndCleanIP_ValidPublicIPv4",
-			ipStr:    "203.0.113.1",
-			expected: "203.0.113.1",
-		},
-		{
-			name:     "ValidateAndCleanIP_ValidPublicIPv6",
-			ipStr:    "2001:db8::1",
-			expected: "2001:db8::1",
-		},
-		{
-			name:     "ValidateAndCleanIP_PrivateIPv4",
-			ipStr:    "192.168.1.1",
-			expected: "",
-		},
-		{
-			name:     "ValidateAndCleanIP_LoopbackIPv4",
-			ipStr:    "127.0.0.1",
-			expected: "",
-		},
-		{
-			name:     "ValidateAndCleanIP_LoopbackIPv6",
-			ipStr:    "::1",
-			expected: "",
-		},
-		{
-			name:     "ValidateAndCleanIP_UnspecifiedIPv4",
-			ipStr:    "0.0.0.0",
-			expected: "",
-		},
-		{
-			name:     "ValidateAndCleanIP_UnspecifiedIPv6",
-			ipStr:    "::",
-			expected: "",
-		},
-		{
-			name:     "ValidateAndCleanIP_InvalidIP",
-			ipStr:    "invalid-ip",
-			expected: "",
-		},
-		{
-			name:     "ValidateAndCleanIP_Empty",
-			ipStr:    "",
-			expected: "",
-		},
-		{
-			name:     "ValidateAndCleanIP_WithWhitespace",
-			ipStr:    "  203.0.113.1  ",
-			expected: "203.0.113.1",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Act
-			result := validateAndCleanIP(tt.ipStr)
-
-			// Assert
-			assert.Equal(t, tt.expected, result)
-		})
-	}
-}
-
-func TestIsPrivateIP(t *testing.T) {
-	tests := []struct {
-		name     string
-		ipStr    string
-		expected bool
-	}{
-		{
-			name:     "IsPrivateIP_PublicIPv4",
-			ipStr:    "203.0.113.1",
-			expected: false,
-		},
-		{
-			name:     "IsPrivateIP_PrivateIPv4_10",
-			ipStr:    "10.0.0.1",
-			expected: true,
-		},
-		{
-			name:     "IsPrivateIP_PrivateIPv4_172",
-			ipStr:    "172.16.0.1",
-			expected: true,
-		},
-		{
-			name:     "IsPrivateIP_PrivateIPv4_192",
-			ipStr:    "192.168.1.1",
-			expected: true,
-		},
-		{
-			name:     "IsPrivateIP_PrivateIPv6",
-			ipStr:    "fc00::1",
-			expected: true,
-		},
-		{
-			name:     "IsPrivateIP_PublicIPv6",
-			ipStr:    "2001:db8::1",
-			expected: false,
-		},
-		{
-			name:     "IsPrivateIP_NilIP",
-			ipStr:    "",
-			expected: false,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Arrange
-			var ip net.IP
-			if tt.ipStr != "" {
-				ip = net.ParseIP(tt.ipStr)
-			}
-
-			// Act
-			result := isPrivateIP(ip)
+			result := getClientIP(req)
 
 			// Assert
 			assert.Equal(t, tt.expected, result)
@@ -933,15 +556,6 @@ func BenchmarkGetClientIP(b *testing.B) {
 	}
 }
 
-func BenchmarkValidateAndCleanIP(b *testing.B) {
-	ipStr := "203.0.113.1"
-
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		_ = validateAndCleanIP(ipStr)
-	}
-}
-
 func TestValidateContentType(t *testing.T) {
 	tests := []struct {
 		name         string
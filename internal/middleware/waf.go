@@ -0,0 +1,583 @@
+// Package middleware implements the web application firewall.
+package middleware
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// WAF modes.
+const (
+	WAFModeBlocking  = "blocking"
+	WAFModeDetection = "detection"
+)
+
+// WAF decisions, used as metric labels.
+const (
+	WAFOutcomeBlocked  = "blocked"
+	WAFOutcomeDetected = "detected"
+)
+
+// wafMaxLoggedValue bounds the matched data included in audit logs.
+const wafMaxLoggedValue = 128
+
+// wafCoreRules is the built-in OWASP CRS-style rule set.
+//
+//go:embed waf_core_rules.conf
+var wafCoreRules string
+
+// WAFExclusion disables rules or ignores variables on matching paths.
+type WAFExclusion struct {
+	// PathPrefix restricts the exclusion to paths with this prefix; empty matches all.
+	PathPrefix string
+
+	// RuleIDs and Tags select the affected rules. With neither set, Targets
+	// are ignored for every rule.
+	RuleIDs []int
+	Tags    []string
+
+	// Targets lists variables such as "ARGS:password" to ignore for the
+	// selected rules. When empty the selected rules are skipped entirely.
+	Targets []string
+}
+
+// WAFConfig holds configuration for the web application firewall middleware.
+type WAFConfig struct {
+	// Name identifies the protected route in logs and metrics.
+	Name string
+
+	// Mode is "blocking" or "detection". Detection only logs matches.
+	Mode string
+
+	// CoreRules loads the built-in core rule set before custom rules.
+	CoreRules bool
+
+	// RuleFiles lists SecLang rule files or glob patterns, loaded in order.
+	RuleFiles []string
+
+	// Rules holds inline SecLang directives, loaded after the rule files.
+	Rules string
+
+	// AnomalyThreshold is the inbound anomaly score at which requests are blocked.
+	AnomalyThreshold int
+
+	// BodyLimit caps how much of the request body is inspected.
+	BodyLimit int64
+
+	// Exclusions tune rules per path.
+	Exclusions []WAFExclusion
+}
+
+// DefaultWAFConfig returns a blocking WAF configuration using the core rule set.
+func DefaultWAFConfig() WAFConfig {
+	return WAFConfig{
+		Mode:             WAFModeBlocking,
+		CoreRules:        true,
+		AnomalyThreshold: 5,
+		BodyLimit:        128 << 10,
+		Exclusions:       []WAFExclusion{},
+	}
+}
+
+// wafExclusion is a compiled WAFExclusion.
+type wafExclusion struct {
+	pathPrefix string
+	ids        map[int]bool
+	tags       []string
+	targets    []wafTarget
+}
+
+// selects reports whether the exclusion applies to rule.
+func (e wafExclusion) selects(rule *wafRule) bool {
+	if len(e.ids) == 0 && len(e.tags) == 0 {
+		return true
+	}
+	if e.ids[rule.id] {
+		return true
+	}
+	for _, tag := range e.tags {
+		if containsString(rule.tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// wafExclusions are the exclusions active for one request.
+type wafExclusions []wafExclusion
+
+func (e wafExclusions) skip(rule *wafRule) bool {
+	for _, exclusion := range e {
+		if len(exclusion.targets) == 0 && exclusion.selects(rule) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e wafExclusions) excludedTargets(rule *wafRule) []wafTarget {
+	var targets []wafTarget
+	for _, exclusion := range e {
+		if len(exclusion.targets) > 0 && exclusion.selects(rule) {
+			targets = append(targets, exclusion.targets...)
+		}
+	}
+	return targets
+}
+
+// wafMiddleware inspects requests against a SecLang rule set.
+type wafMiddleware struct {
+	config     WAFConfig
+	rules      *wafRuleSet
+	exclusions []wafExclusion
+	logger     observability.Logger
+	metrics    observability.MetricsCollector
+}
+
+// NewWAFMiddleware creates a new web application firewall middleware.
+func NewWAFMiddleware(
+	config WAFConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewWAFValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	rules, err := loadWAFRules(config)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &wafMiddleware{
+		config:  config,
+		rules:   rules,
+		logger:  logger,
+		metrics: metrics,
+	}
+
+	for _, exclusion := range config.Exclusions {
+		compiled := wafExclusion{
+			pathPrefix: exclusion.PathPrefix,
+			ids:        make(map[int]bool),
+			tags:       exclusion.Tags,
+		}
+		for _, id := range exclusion.RuleIDs {
+			compiled.ids[id] = true
+		}
+		if len(exclusion.Targets) > 0 {
+			targets, _, err := parseWAFTargets(strings.Join(exclusion.Targets, "|"))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrInvalidWAFExclusion, err)
+			}
+			compiled.targets = targets
+		}
+		m.exclusions = append(m.exclusions, compiled)
+	}
+
+	return m, nil
+}
+
+// loadWAFRules parses the core rules, rule files and inline rules in order.
+func loadWAFRules(config WAFConfig) (*wafRuleSet, error) {
+	parser := newWAFParser()
+
+	if config.CoreRules {
+		if err := parser.parse(wafCoreRules, "", "core rules"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, pattern := range config.RuleFiles {
+		files, err := filepath.Glob(pattern)
+		if err != nil || len(files) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrWAFRuleFileNotFound, pattern)
+		}
+		sort.Strings(files)
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %v", ErrWAFRuleFileNotFound, file, err)
+			}
+			if err := parser.parse(string(data), filepath.Dir(file), file); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if strings.TrimSpace(config.Rules) != "" {
+		if err := parser.parse(config.Rules, "", "inline rules"); err != nil {
+			return nil, err
+		}
+	}
+
+	return parser.build()
+}
+
+// Wrap implements the Middleware interface.
+func (m *wafMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := newWAFTransaction(m.config.AnomalyThreshold)
+		addWAFRequestVariables(t, r)
+
+		exclusions := m.activeExclusions(r.URL.Path)
+		result := &wafResult{}
+		m.rules.evaluate(t, wafPhaseRequestHeaders, exclusions, result)
+
+		if !result.done() && m.rules.phases[wafPhaseRequestBody] {
+			body := m.readBody(r)
+			addWAFBodyVariables(t, r.Header.Get("Content-Type"), body)
+			m.rules.evaluate(t, wafPhaseRequestBody, exclusions, result)
+		}
+
+		score := t.anomalyScore()
+		blocked := result.interrupted != nil ||
+			(!result.allowed && score >= m.config.AnomalyThreshold)
+
+		m.audit(r, result, score, blocked)
+
+		if blocked && m.config.Mode != WAFModeDetection {
+			status := http.StatusForbidden
+			if result.interrupted != nil && result.interrupted.rule.status != 0 {
+				status = result.interrupted.rule.status
+			}
+			ReportOffense(r, OffenseWAF)
+			writeWAFBlockResponse(w, r, status)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// activeExclusions returns the exclusions whose path prefix matches.
+func (m *wafMiddleware) activeExclusions(requestPath string) wafExclusions {
+	var active wafExclusions
+	for _, exclusion := range m.exclusions {
+		if strings.HasPrefix(requestPath, exclusion.pathPrefix) {
+			active = append(active, exclusion)
+		}
+	}
+	return active
+}
+
+// readBody reads up to BodyLimit bytes of the request body and restores it
+// so the backend still receives the complete body.
+func (m *wafMiddleware) readBody(r *http.Request) []byte {
+	if r.Body == nil || r.Body == http.NoBody || m.config.BodyLimit <= 0 {
+		return nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, m.config.BodyLimit))
+	if err != nil && m.logger != nil {
+		m.logger.Debug(r.Context(), "WAF failed to read request body",
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.Error(err),
+		)
+	}
+
+	r.Body = &replayBody{
+		Reader: io.MultiReader(bytes.NewReader(body), r.Body),
+		Closer: r.Body,
+	}
+	return body
+}
+
+// audit logs the matched rules and the decision.
+func (m *wafMiddleware) audit(r *http.Request, result *wafResult, score int, blocked bool) {
+	if len(result.matches) == 0 && !blocked {
+		return
+	}
+
+	route := GetRouteName(r.Context())
+	if route == "" {
+		route = m.config.Name
+	}
+	requestID := GetRequestID(r.Context())
+
+	ruleIDs := make([]string, 0, len(result.matches))
+	for _, match := range result.matches {
+		ruleID := strconv.Itoa(match.rule.id)
+		ruleIDs = append(ruleIDs, ruleID)
+
+		if m.metrics != nil {
+			m.metrics.RecordWAFRuleMatch(route, ruleID)
+		}
+
+		if m.logger != nil {
+			m.logger.Warn(r.Context(), "WAF rule matched",
+				observability.String("request_id", requestID),
+				observability.String("route", route),
+				observability.Int("rule_id", match.rule.id),
+				observability.String("msg", match.rule.msg),
+				observability.String("severity", wafSeverityName(match.rule.severity)),
+				observability.String("tags", strings.Join(match.rule.tags, ",")),
+				observability.String("variable", match.variable),
+				observability.String("match", truncateWAFValue(match.value)),
+				observability.Int("score", match.score),
+				observability.String("mode", m.config.Mode),
+			)
+		}
+	}
+
+	if !blocked {
+		return
+	}
+
+	outcome := WAFOutcomeBlocked
+	message := "WAF blocked request"
+	if m.config.Mode == WAFModeDetection {
+		outcome = WAFOutcomeDetected
+		message = "WAF would block request (detection only)"
+	}
+
+	if m.metrics != nil {
+		m.metrics.RecordWAFDecision(route, outcome)
+	}
+
+	if m.logger != nil {
+		fields := []observability.Field{
+			observability.String("request_id", requestID),
+			observability.String("route", route),
+			observability.String("client_ip", getClientIP(r)),
+			observability.String("method", r.Method),
+			observability.String("path", r.URL.Path),
+			observability.Int("anomaly_score", score),
+			observability.Int("threshold", m.config.AnomalyThreshold),
+			observability.String("rule_ids", strings.Join(ruleIDs, ",")),
+			observability.String("mode", m.config.Mode),
+		}
+		if result.interrupted != nil {
+			fields = append(fields, observability.Int("interrupting_rule", result.interrupted.rule.id))
+		}
+		m.logger.Warn(r.Context(), message, fields...)
+	}
+}
+
+// writeWAFBlockResponse writes the JSON error returned for blocked requests.
+func writeWAFBlockResponse(w http.ResponseWriter, r *http.Request, status int) {
+	err := proxyerrors.WrapError(proxyerrors.ErrCodeAccessDenied, "Request blocked by web application firewall", nil).
+		WithHTTPStatus(status)
+	writeErrorResponse(w, r, err)
+}
+
+// wafSeverityName returns the SecLang name of a severity level.
+func wafSeverityName(severity int) string {
+	for name, level := range wafSeverityNames {
+		if level == severity {
+			return name
+		}
+	}
+	return ""
+}
+
+// truncateWAFValue shortens matched data for logging.
+func truncateWAFValue(value string) string {
+	if len(value) <= wafMaxLoggedValue {
+		return value
+	}
+	return value[:wafMaxLoggedValue] + "..."
+}
+
+// addWAFRequestVariables populates the request line, query, header and
+// cookie variables.
+func addWAFRequestVariables(t *wafTransaction, r *http.Request) {
+	uri := r.RequestURI
+	if uri == "" {
+		uri = r.URL.RequestURI()
+	}
+
+	t.set("REQUEST_METHOD", r.Method)
+	t.set("REQUEST_PROTOCOL", r.Proto)
+	t.set("REQUEST_LINE", r.Method+" "+uri+" "+r.Proto)
+	t.set("REQUEST_URI", uri)
+	t.set("REQUEST_URI_RAW", uri)
+	t.set("REQUEST_FILENAME", r.URL.Path)
+	t.set("REQUEST_BASENAME", path.Base(r.URL.Path))
+	t.set("QUERY_STRING", r.URL.RawQuery)
+	t.set("REMOTE_ADDR", getClientIP(r))
+
+	// ParseQuery keeps the valid pairs of a malformed query.
+	query, _ := url.ParseQuery(r.URL.RawQuery)
+	addWAFArgs(t, "ARGS_GET", query)
+
+	for _, name := range sortedKeys(r.Header) {
+		t.add("REQUEST_HEADERS_NAMES", name, name)
+		for _, value := range r.Header[name] {
+			t.add("REQUEST_HEADERS", name, value)
+		}
+	}
+
+	for _, cookie := range r.Cookies() {
+		t.add("REQUEST_COOKIES_NAMES", cookie.Name, cookie.Name)
+		t.add("REQUEST_COOKIES", cookie.Name, cookie.Value)
+	}
+}
+
+// addWAFBodyVariables populates REQUEST_BODY and body arguments from
+// urlencoded, JSON and multipart bodies.
+func addWAFBodyVariables(t *wafTransaction, contentType string, body []byte) {
+	t.set("REQUEST_BODY", string(body))
+	if len(body) == 0 {
+		return
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		form, _ := url.ParseQuery(string(body))
+		addWAFArgs(t, "ARGS_POST", form)
+
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var document any
+		if err := decoder.Decode(&document); err == nil {
+			addWAFJSONArgs(t, "json", document)
+		}
+
+	case strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "":
+		addWAFMultipartArgs(t, multipart.NewReader(bytes.NewReader(body), params["boundary"]))
+	}
+}
+
+// addWAFArgs adds arguments to a collection and to ARGS.
+func addWAFArgs(t *wafTransaction, collection string, values url.Values) {
+	for _, name := range sortedKeys(values) {
+		for _, value := range values[name] {
+			addWAFArg(t, collection, name, value)
+		}
+	}
+}
+
+// addWAFArg adds one argument to a collection, ARGS and their name lists.
+func addWAFArg(t *wafTransaction, collection, name, value string) {
+	t.add(collection, name, value)
+	t.add(collection+"_NAMES", name, name)
+	t.add("ARGS", name, value)
+	t.add("ARGS_NAMES", name, name)
+}
+
+// addWAFJSONArgs flattens a JSON document into body arguments named like
+// json.user.name and json.items.0.
+func addWAFJSONArgs(t *wafTransaction, prefix string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			addWAFJSONArgs(t, prefix+"."+key, v[key])
+		}
+	case []any:
+		for i, item := range v {
+			addWAFJSONArgs(t, prefix+"."+strconv.Itoa(i), item)
+		}
+	case nil:
+		addWAFArg(t, "ARGS_POST", prefix, "")
+	default:
+		addWAFArg(t, "ARGS_POST", prefix, fmt.Sprint(v))
+	}
+}
+
+// addWAFMultipartArgs adds form fields as body arguments and uploaded file
+// names to FILES. A body truncated by the inspection limit stops parsing.
+func addWAFMultipartArgs(t *wafTransaction, reader *multipart.Reader) {
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			return
+		}
+
+		name := part.FormName()
+		if filename := part.FileName(); filename != "" {
+			t.add("FILES", name, filename)
+			_ = part.Close()
+			continue
+		}
+
+		value, err := io.ReadAll(part)
+		_ = part.Close()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return
+		}
+		addWAFArg(t, "ARGS_POST", name, string(value))
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WAFValidator validates web application firewall configuration.
+type WAFValidator struct{}
+
+// NewWAFValidator creates a new WAF validator.
+func NewWAFValidator() *WAFValidator {
+	return &WAFValidator{}
+}
+
+// Validate validates the WAF configuration.
+func (v *WAFValidator) Validate(config WAFConfig) error {
+	switch config.Mode {
+	case "", WAFModeBlocking, WAFModeDetection:
+	default:
+		return fmt.Errorf("%w: %q", ErrInvalidWAFMode, config.Mode)
+	}
+
+	if !config.CoreRules && len(config.RuleFiles) == 0 && strings.TrimSpace(config.Rules) == "" {
+		return ErrWAFNoRules
+	}
+
+	if config.AnomalyThreshold <= 0 {
+		return ErrInvalidWAFThreshold
+	}
+
+	if config.BodyLimit < 0 {
+		return ErrInvalidWAFBodyLimit
+	}
+
+	for i, exclusion := range config.Exclusions {
+		if exclusion.PathPrefix != "" && !strings.HasPrefix(exclusion.PathPrefix, "/") {
+			return fmt.Errorf("%w: exclusion %d path prefix must start with /", ErrInvalidWAFExclusion, i)
+		}
+		if len(exclusion.RuleIDs) == 0 && len(exclusion.Tags) == 0 && len(exclusion.Targets) == 0 {
+			return fmt.Errorf("%w: exclusion %d must list rule IDs, tags or targets", ErrInvalidWAFExclusion, i)
+		}
+	}
+
+	return nil
+}
+
+// WAF validation errors.
+var (
+	ErrInvalidWAFMode      = fmt.Errorf("invalid WAF mode: must be blocking or detection")
+	ErrWAFNoRules          = fmt.Errorf("WAF requires core rules, rule files or inline rules")
+	ErrInvalidWAFThreshold = fmt.Errorf("WAF anomaly threshold must be positive")
+	ErrInvalidWAFBodyLimit = fmt.Errorf("WAF body limit cannot be negative")
+	ErrInvalidWAFExclusion = fmt.Errorf("invalid WAF exclusion")
+	ErrWAFRuleFileNotFound = fmt.Errorf("WAF rule file not found")
+	ErrInvalidWAFRule      = fmt.Errorf("invalid WAF rule")
+)
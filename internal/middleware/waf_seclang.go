@@ -0,0 +1,1352 @@
+// Package middleware implements a ModSecurity SecLang subset for the WAF.
+package middleware
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/albedosehen/rwwwrse/internal/clientip"
+)
+
+// Rule actions that decide what happens on a match.
+const (
+	wafActionPass  = "pass"
+	wafActionBlock = "block"
+	wafActionDeny  = "deny"
+	wafActionAllow = "allow"
+)
+
+// Rule phases. Response phases are accepted in rule files but not evaluated.
+const (
+	wafPhaseRequestHeaders = 1
+	wafPhaseRequestBody    = 2
+)
+
+// wafSeverityScores maps SecLang severities to their default anomaly score.
+var wafSeverityScores = map[int]int{
+	0: 5, // EMERGENCY
+	1: 5, // ALERT
+	2: 5, // CRITICAL
+	3: 4, // ERROR
+	4: 3, // WARNING
+	5: 2, // NOTICE
+}
+
+// wafSeverityNames maps SecLang severity names to their numeric level.
+var wafSeverityNames = map[string]int{
+	"EMERGENCY": 0,
+	"ALERT":     1,
+	"CRITICAL":  2,
+	"ERROR":     3,
+	"WARNING":   4,
+	"NOTICE":    5,
+	"INFO":      6,
+	"DEBUG":     7,
+}
+
+// wafCollections lists the supported variables and whether they are keyed.
+var wafCollections = map[string]bool{
+	"REQUEST_METHOD":        false,
+	"REQUEST_PROTOCOL":      false,
+	"REQUEST_LINE":          false,
+	"REQUEST_URI":           false,
+	"REQUEST_URI_RAW":       false,
+	"REQUEST_FILENAME":      false,
+	"REQUEST_BASENAME":      false,
+	"QUERY_STRING":          false,
+	"REMOTE_ADDR":           false,
+	"REQUEST_BODY":          false,
+	"ARGS":                  true,
+	"ARGS_NAMES":            true,
+	"ARGS_GET":              true,
+	"ARGS_GET_NAMES":        true,
+	"ARGS_POST":             true,
+	"ARGS_POST_NAMES":       true,
+	"REQUEST_HEADERS":       true,
+	"REQUEST_HEADERS_NAMES": true,
+	"REQUEST_COOKIES":       true,
+	"REQUEST_COOKIES_NAMES": true,
+	"FILES":                 true,
+	"TX":                    true,
+}
+
+// wafIgnoredDirectives are engine settings that are configured through
+// rwwwrse itself and therefore accepted and ignored in rule files.
+var wafIgnoredDirectives = map[string]bool{
+	"secruleengine":              true,
+	"secrequestbodyaccess":       true,
+	"secrequestbodylimit":        true,
+	"secrequestbodynofileslimit": true,
+	"secrequestbodylimitaction":  true,
+	"secresponsebodyaccess":      true,
+	"secresponsebodymimetype":    true,
+	"secdefaultaction":           true,
+	"seccomponentsignature":      true,
+	"seccollectiontimeout":       true,
+	"secauditengine":             true,
+	"secauditlog":                true,
+	"secauditlogparts":           true,
+	"secauditlogtype":            true,
+	"secauditlogrelevantstatus":  true,
+	"secdebuglog":                true,
+	"secdebugloglevel":           true,
+	"secargumentseparator":       true,
+	"secpcrematchlimit":          true,
+	"secpcrematchlimitrecursion": true,
+}
+
+// wafMetadataActions are informational actions that do not affect evaluation.
+var wafMetadataActions = map[string]bool{
+	"rev":        true,
+	"ver":        true,
+	"maturity":   true,
+	"accuracy":   true,
+	"logdata":    true,
+	"capture":    true,
+	"auditlog":   true,
+	"noauditlog": true,
+	"multimatch": true,
+}
+
+// wafMacroPattern matches %{collection.key} macros.
+var wafMacroPattern = regexp.MustCompile(`%\{([^}]+)\}`)
+
+// wafRule is a compiled SecRule, SecAction or SecMarker.
+type wafRule struct {
+	id         int
+	phase      int
+	msg        string
+	tags       []string
+	severity   int
+	action     string
+	status     int
+	log        bool
+	targets    []wafTarget
+	excluded   []wafTarget
+	operator   *wafOperator
+	transforms []wafTransform
+	setvars    []wafSetVar
+	skipAfter  string
+	marker     string
+	chain      *wafRule
+}
+
+// wafTarget is a variable reference such as ARGS:id, !ARGS:password or &ARGS.
+type wafTarget struct {
+	collection string
+	key        string
+	keyRx      *regexp.Regexp
+	count      bool
+}
+
+// wafOperator tests a transformed variable value.
+type wafOperator struct {
+	name   string
+	negate bool
+	eval   func(t *wafTransaction, value string) bool
+}
+
+// wafTransform normalizes a value before it is tested.
+type wafTransform func(string) string
+
+// wafSetVar is a setvar action on the TX collection.
+type wafSetVar struct {
+	name  string
+	op    byte
+	value string
+}
+
+// wafVar is a single variable value collected from a request.
+type wafVar struct {
+	key   string
+	value string
+}
+
+// wafRuleSet is an ordered list of rules with the positions of their markers.
+type wafRuleSet struct {
+	rules   []*wafRule
+	markers map[string]int
+	phases  map[int]bool
+}
+
+// wafIDRange is an inclusive range of rule IDs.
+type wafIDRange struct {
+	from, to int
+}
+
+// wafTargetUpdate adds exclusions to the targets of existing rules.
+type wafTargetUpdate struct {
+	ids      []wafIDRange
+	excluded []wafTarget
+}
+
+// wafParser collects rules and rule-modifying directives across sources.
+type wafParser struct {
+	rules      []*wafRule
+	ids        map[int]bool
+	removeIDs  []wafIDRange
+	removeTags []*regexp.Regexp
+	updates    []wafTargetUpdate
+	chainTail  *wafRule
+}
+
+// newWAFParser creates an empty SecLang parser.
+func newWAFParser() *wafParser {
+	return &wafParser{ids: make(map[int]bool)}
+}
+
+// parse reads SecLang directives from src. Relative data files referenced by
+// operators are resolved against baseDir; name labels errors.
+func (p *wafParser) parse(src, baseDir, name string) error {
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	var (
+		line      strings.Builder
+		lineNo    int
+		startLine int
+	)
+	for scanner.Scan() {
+		lineNo++
+		text := strings.TrimSpace(scanner.Text())
+		if line.Len() == 0 {
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			startLine = lineNo
+		}
+
+		if strings.HasSuffix(text, "\\") {
+			line.WriteString(strings.TrimSuffix(text, "\\"))
+			line.WriteByte(' ')
+			continue
+		}
+		line.WriteString(text)
+
+		if err := p.parseDirective(line.String(), baseDir); err != nil {
+			return fmt.Errorf("%w: %s:%d: %v", ErrInvalidWAFRule, name, startLine, err)
+		}
+		line.Reset()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidWAFRule, name, err)
+	}
+
+	if line.Len() > 0 {
+		if err := p.parseDirective(line.String(), baseDir); err != nil {
+			return fmt.Errorf("%w: %s:%d: %v", ErrInvalidWAFRule, name, startLine, err)
+		}
+	}
+
+	return nil
+}
+
+// parseDirective parses a single logical directive line.
+func (p *wafParser) parseDirective(line, baseDir string) error {
+	words, err := splitWAFDirective(line)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		return nil
+	}
+
+	directive := strings.ToLower(words[0])
+	args := words[1:]
+
+	if p.chainTail != nil && directive != "secrule" {
+		return fmt.Errorf("chained rule %d is missing its next SecRule", p.chainTail.id)
+	}
+
+	switch directive {
+	case "secrule":
+		if len(args) < 2 || len(args) > 3 {
+			return fmt.Errorf("SecRule requires variables, an operator and optional actions")
+		}
+		actions := ""
+		if len(args) == 3 {
+			actions = args[2]
+		}
+		return p.addRule(args[0], args[1], actions, baseDir)
+
+	case "secaction":
+		if len(args) != 1 {
+			return fmt.Errorf("SecAction requires a single action list")
+		}
+		return p.addRule("", "@unconditionalMatch", args[0], baseDir)
+
+	case "secmarker":
+		if len(args) != 1 {
+			return fmt.Errorf("SecMarker requires a name")
+		}
+		p.rules = append(p.rules, &wafRule{marker: args[0]})
+		return nil
+
+	case "secruleremovebyid":
+		for _, arg := range args {
+			ranges, err := parseWAFIDRanges(arg)
+			if err != nil {
+				return err
+			}
+			p.removeIDs = append(p.removeIDs, ranges...)
+		}
+		return nil
+
+	case "secruleremovebytag":
+		for _, arg := range args {
+			rx, err := regexp.Compile(arg)
+			if err != nil {
+				return fmt.Errorf("invalid tag pattern %q: %v", arg, err)
+			}
+			p.removeTags = append(p.removeTags, rx)
+		}
+		return nil
+
+	case "secruleupdatetargetbyid":
+		if len(args) != 2 {
+			return fmt.Errorf("SecRuleUpdateTargetById requires a rule ID and targets")
+		}
+		ranges, err := parseWAFIDRanges(args[0])
+		if err != nil {
+			return err
+		}
+		targets, excluded, err := parseWAFTargets(args[1])
+		if err != nil {
+			return err
+		}
+		if len(targets) > 0 {
+			return fmt.Errorf("SecRuleUpdateTargetById only supports target exclusions")
+		}
+		p.updates = append(p.updates, wafTargetUpdate{ids: ranges, excluded: excluded})
+		return nil
+	}
+
+	if wafIgnoredDirectives[directive] {
+		return nil
+	}
+
+	return fmt.Errorf("unsupported directive %s", words[0])
+}
+
+// addRule compiles a rule and appends it, or links it to a pending chain.
+func (p *wafParser) addRule(variables, operator, actions, baseDir string) error {
+	rule := &wafRule{
+		phase:    wafPhaseRequestBody,
+		severity: -1,
+		action:   wafActionPass,
+		log:      true,
+	}
+
+	if variables != "" {
+		targets, excluded, err := parseWAFTargets(variables)
+		if err != nil {
+			return err
+		}
+		rule.targets = targets
+		rule.excluded = excluded
+	}
+
+	op, err := compileWAFOperator(operator, baseDir)
+	if err != nil {
+		return err
+	}
+	rule.operator = op
+
+	chained := p.chainTail != nil
+	hasChain, err := applyWAFActions(rule, actions, chained)
+	if err != nil {
+		return err
+	}
+
+	if chained {
+		p.chainTail.chain = rule
+	} else {
+		if rule.id <= 0 {
+			return fmt.Errorf("rule is missing an id action")
+		}
+		if p.ids[rule.id] {
+			return fmt.Errorf("duplicate rule id %d", rule.id)
+		}
+		p.ids[rule.id] = true
+		p.rules = append(p.rules, rule)
+	}
+
+	if hasChain {
+		p.chainTail = rule
+	} else {
+		p.chainTail = nil
+	}
+
+	return nil
+}
+
+// build applies removals and target updates and returns the rule set.
+func (p *wafParser) build() (*wafRuleSet, error) {
+	if p.chainTail != nil {
+		return nil, fmt.Errorf("%w: chained rule is missing its next SecRule", ErrInvalidWAFRule)
+	}
+
+	set := &wafRuleSet{
+		markers: make(map[string]int),
+		phases:  make(map[int]bool),
+	}
+
+	for _, rule := range p.rules {
+		if rule.marker != "" {
+			set.markers[rule.marker] = len(set.rules)
+			set.rules = append(set.rules, rule)
+			continue
+		}
+
+		if rule.phase > wafPhaseRequestBody || p.removed(rule) {
+			continue
+		}
+
+		for _, update := range p.updates {
+			if wafIDInRanges(rule.id, update.ids) {
+				rule.excluded = append(rule.excluded, update.excluded...)
+			}
+		}
+
+		set.phases[rule.phase] = true
+		set.rules = append(set.rules, rule)
+	}
+
+	for _, rule := range set.rules {
+		if rule.skipAfter != "" {
+			if _, ok := set.markers[rule.skipAfter]; !ok {
+				return nil, fmt.Errorf("%w: rule %d skips to unknown marker %q", ErrInvalidWAFRule, rule.id, rule.skipAfter)
+			}
+		}
+	}
+
+	return set, nil
+}
+
+// removed reports whether a SecRuleRemoveBy* directive disables rule.
+func (p *wafParser) removed(rule *wafRule) bool {
+	if wafIDInRanges(rule.id, p.removeIDs) {
+		return true
+	}
+	for _, rx := range p.removeTags {
+		for _, tag := range rule.tags {
+			if rx.MatchString(tag) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// splitWAFDirective splits a directive into words, honoring double quotes.
+// Backslashes are kept except when escaping a quote, so regular expressions
+// survive unchanged.
+func splitWAFDirective(line string) ([]string, error) {
+	var (
+		words   []string
+		current strings.Builder
+		inWord  bool
+		quoted  bool
+	)
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(line) && line[i+1] == '"':
+			current.WriteByte('"')
+			i++
+		case c == '"':
+			quoted = !quoted
+			inWord = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteByte(c)
+			inWord = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if inWord {
+		words = append(words, current.String())
+	}
+
+	return words, nil
+}
+
+// parseWAFTargets parses a |-separated variable list into targets and exclusions.
+func parseWAFTargets(spec string) ([]wafTarget, []wafTarget, error) {
+	var targets, excluded []wafTarget
+
+	for _, part := range splitWAFTargets(spec) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		exclude := strings.HasPrefix(part, "!")
+		count := strings.HasPrefix(part, "&")
+		if exclude || count {
+			part = part[1:]
+		}
+
+		collection, key, hasKey := strings.Cut(part, ":")
+		collection = strings.ToUpper(collection)
+		keyed, ok := wafCollections[collection]
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported variable %s", collection)
+		}
+		if hasKey && !keyed {
+			return nil, nil, fmt.Errorf("variable %s does not take a key", collection)
+		}
+
+		target := wafTarget{collection: collection, count: count}
+		if hasKey {
+			key = strings.Trim(key, "'")
+			if len(key) > 1 && strings.HasPrefix(key, "/") && strings.HasSuffix(key, "/") {
+				rx, err := regexp.Compile("(?i)" + key[1:len(key)-1])
+				if err != nil {
+					return nil, nil, fmt.Errorf("invalid key pattern %q: %v", key, err)
+				}
+				target.keyRx = rx
+			} else {
+				target.key = key
+			}
+		}
+
+		if exclude {
+			excluded = append(excluded, target)
+		} else {
+			targets = append(targets, target)
+		}
+	}
+
+	return targets, excluded, nil
+}
+
+// splitWAFTargets splits on | outside of /regex/ keys.
+func splitWAFTargets(spec string) []string {
+	var (
+		parts []string
+		start int
+		inRx  bool
+	)
+	for i := 0; i < len(spec); i++ {
+		switch {
+		case !inRx && spec[i] == '/' && i > 0 && spec[i-1] == ':':
+			inRx = true
+		case inRx && spec[i] == '/' && spec[i-1] != '\\':
+			inRx = false
+		case !inRx && spec[i] == '|':
+			parts = append(parts, spec[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, spec[start:])
+}
+
+// compileWAFOperator compiles an operator such as "@rx ^a", "!@pm foo bar" or
+// a bare regular expression.
+func compileWAFOperator(spec, baseDir string) (*wafOperator, error) {
+	op := &wafOperator{}
+	if strings.HasPrefix(spec, "!") {
+		op.negate = true
+		spec = spec[1:]
+	}
+
+	name, arg := "rx", spec
+	if strings.HasPrefix(spec, "@") {
+		name, arg, _ = strings.Cut(spec[1:], " ")
+		arg = strings.TrimSpace(arg)
+	}
+	op.name = name
+
+	switch name {
+	case "rx":
+		rx, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression %q: %v", arg, err)
+		}
+		op.eval = func(_ *wafTransaction, value string) bool { return rx.MatchString(value) }
+
+	case "pm":
+		phrases := strings.Fields(strings.ToLower(arg))
+		op.eval = wafPhraseMatcher(phrases)
+
+	case "pmFromFile", "pmf":
+		var phrases []string
+		for _, file := range strings.Fields(arg) {
+			loaded, err := loadWAFPhrases(file, baseDir)
+			if err != nil {
+				return nil, err
+			}
+			phrases = append(phrases, loaded...)
+		}
+		op.eval = wafPhraseMatcher(phrases)
+
+	case "contains":
+		op.eval = func(t *wafTransaction, value string) bool { return strings.Contains(value, t.expand(arg)) }
+	case "beginsWith":
+		op.eval = func(t *wafTransaction, value string) bool { return strings.HasPrefix(value, t.expand(arg)) }
+	case "endsWith":
+		op.eval = func(t *wafTransaction, value string) bool { return strings.HasSuffix(value, t.expand(arg)) }
+	case "streq":
+		op.eval = func(t *wafTransaction, value string) bool { return value == t.expand(arg) }
+	case "within":
+		op.eval = func(t *wafTransaction, value string) bool { return strings.Contains(t.expand(arg), value) }
+
+	case "eq", "ge", "gt", "le", "lt":
+		compare := wafNumericComparisons[name]
+		op.eval = func(t *wafTransaction, value string) bool {
+			return compare(wafAtoi(value), wafAtoi(t.expand(arg)))
+		}
+
+	case "ipMatch":
+		var networks []*net.IPNet
+		for _, cidr := range strings.Split(arg, ",") {
+			network, err := clientip.ParseNetwork(strings.TrimSpace(cidr))
+			if err != nil {
+				return nil, fmt.Errorf("invalid ipMatch network %q", cidr)
+			}
+			networks = append(networks, network)
+		}
+		op.eval = func(_ *wafTransaction, value string) bool {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return false
+			}
+			for _, network := range networks {
+				if network.Contains(ip) {
+					return true
+				}
+			}
+			return false
+		}
+
+	case "unconditionalMatch":
+		op.eval = func(*wafTransaction, string) bool { return true }
+	case "noMatch":
+		op.eval = func(*wafTransaction, string) bool { return false }
+
+	default:
+		return nil, fmt.Errorf("unsupported operator @%s", name)
+	}
+
+	return op, nil
+}
+
+// wafNumericComparisons implements the numeric operators.
+var wafNumericComparisons = map[string]func(a, b int) bool{
+	"eq": func(a, b int) bool { return a == b },
+	"ge": func(a, b int) bool { return a >= b },
+	"gt": func(a, b int) bool { return a > b },
+	"le": func(a, b int) bool { return a <= b },
+	"lt": func(a, b int) bool { return a < b },
+}
+
+// wafPhraseMatcher returns a case-insensitive substring matcher for phrases.
+func wafPhraseMatcher(phrases []string) func(*wafTransaction, string) bool {
+	return func(_ *wafTransaction, value string) bool {
+		value = strings.ToLower(value)
+		for _, phrase := range phrases {
+			if strings.Contains(value, phrase) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// loadWAFPhrases reads a phrase file with one phrase per line.
+func loadWAFPhrases(file, baseDir string) ([]string, error) {
+	if !filepath.IsAbs(file) && baseDir != "" {
+		file = filepath.Join(baseDir, file)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read phrase file: %v", err)
+	}
+
+	var phrases []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		phrases = append(phrases, strings.ToLower(line))
+	}
+	return phrases, nil
+}
+
+// applyWAFActions parses a comma-separated action list into rule. It reports
+// whether the rule chains to the next SecRule.
+func applyWAFActions(rule *wafRule, actions string, chained bool) (bool, error) {
+	hasChain := false
+
+	for _, action := range splitWAFActions(actions) {
+		name, value, _ := strings.Cut(action, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.Trim(strings.TrimSpace(value), "'")
+
+		if chained {
+			switch name {
+			case "t", "setvar", "chain", "capture", "logdata":
+			default:
+				return false, fmt.Errorf("action %s is not allowed in a chained rule", name)
+			}
+		}
+
+		switch name {
+		case "id":
+			id, err := strconv.Atoi(value)
+			if err != nil || id <= 0 {
+				return false, fmt.Errorf("invalid rule id %q", value)
+			}
+			rule.id = id
+		case "phase":
+			phase, err := parseWAFPhase(value)
+			if err != nil {
+				return false, err
+			}
+			rule.phase = phase
+		case "msg":
+			rule.msg = value
+		case "tag":
+			rule.tags = append(rule.tags, value)
+		case "severity":
+			severity, err := parseWAFSeverity(value)
+			if err != nil {
+				return false, err
+			}
+			rule.severity = severity
+		case wafActionPass, wafActionBlock, wafActionDeny, wafActionAllow:
+			rule.action = name
+		case "drop":
+			rule.action = wafActionDeny
+		case "status":
+			status, err := strconv.Atoi(value)
+			if err != nil || status < 400 || status > 599 {
+				return false, fmt.Errorf("invalid status %q", value)
+			}
+			rule.status = status
+		case "log":
+			rule.log = true
+		case "nolog":
+			rule.log = false
+		case "t":
+			if strings.EqualFold(value, "none") {
+				rule.transforms = nil
+				continue
+			}
+			transform, ok := wafTransforms[value]
+			if !ok {
+				return false, fmt.Errorf("unsupported transformation %s", value)
+			}
+			rule.transforms = append(rule.transforms, transform)
+		case "setvar":
+			setvar, err := parseWAFSetVar(value)
+			if err != nil {
+				return false, err
+			}
+			rule.setvars = append(rule.setvars, setvar)
+		case "skipafter":
+			rule.skipAfter = value
+		case "chain":
+			hasChain = true
+		default:
+			if !wafMetadataActions[name] {
+				return false, fmt.Errorf("unsupported action %s", name)
+			}
+		}
+	}
+
+	return hasChain, nil
+}
+
+// splitWAFActions splits an action list on commas outside single quotes.
+func splitWAFActions(actions string) []string {
+	var (
+		parts  []string
+		start  int
+		quoted bool
+	)
+	for i := 0; i < len(actions); i++ {
+		switch actions[i] {
+		case '\'':
+			if i == 0 || actions[i-1] != '\\' {
+				quoted = !quoted
+			}
+		case ',':
+			if !quoted {
+				parts = append(parts, actions[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, actions[start:])
+
+	result := parts[:0]
+	for _, part := range parts {
+		if strings.TrimSpace(part) != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+// parseWAFPhase parses a phase number or name.
+func parseWAFPhase(value string) (int, error) {
+	switch strings.ToLower(value) {
+	case "request":
+		return wafPhaseRequestBody, nil
+	case "response":
+		return 4, nil
+	case "logging":
+		return 5, nil
+	}
+
+	phase, err := strconv.Atoi(value)
+	if err != nil || phase < 1 || phase > 5 {
+		return 0, fmt.Errorf("invalid phase %q", value)
+	}
+	return phase, nil
+}
+
+// parseWAFSeverity parses a severity name or number.
+func parseWAFSeverity(value string) (int, error) {
+	if severity, ok := wafSeverityNames[strings.ToUpper(value)]; ok {
+		return severity, nil
+	}
+	severity, err := strconv.Atoi(value)
+	if err != nil || severity < 0 || severity > 7 {
+		return 0, fmt.Errorf("invalid severity %q", value)
+	}
+	return severity, nil
+}
+
+// parseWAFSetVar parses setvar values such as tx.score=+5, tx.flag and !tx.flag.
+func parseWAFSetVar(value string) (wafSetVar, error) {
+	setvar := wafSetVar{op: '='}
+	if strings.HasPrefix(value, "!") {
+		setvar.op = '!'
+		value = value[1:]
+	}
+
+	name, assigned, hasValue := strings.Cut(value, "=")
+	collection, key, ok := strings.Cut(name, ".")
+	if !ok || !strings.EqualFold(collection, "tx") || key == "" {
+		return wafSetVar{}, fmt.Errorf("setvar only supports the tx collection: %q", value)
+	}
+	setvar.name = strings.ToLower(key)
+
+	switch {
+	case setvar.op == '!':
+	case !hasValue:
+		setvar.value = "1"
+	case strings.HasPrefix(assigned, "+"), strings.HasPrefix(assigned, "-"):
+		setvar.op = assigned[0]
+		setvar.value = assigned[1:]
+	default:
+		setvar.value = assigned
+	}
+
+	return setvar, nil
+}
+
+// parseWAFIDRanges parses "942100", "942100-942199" or a space separated list.
+func parseWAFIDRanges(value string) ([]wafIDRange, error) {
+	var ranges []wafIDRange
+	for _, field := range strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }) {
+		fromText, toText, isRange := strings.Cut(field, "-")
+		from, err := strconv.Atoi(fromText)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule id %q", field)
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(toText); err != nil || to < from {
+				return nil, fmt.Errorf("invalid rule id range %q", field)
+			}
+		}
+		ranges = append(ranges, wafIDRange{from: from, to: to})
+	}
+	return ranges, nil
+}
+
+// wafIDInRanges reports whether id falls in any of ranges.
+func wafIDInRanges(id int, ranges []wafIDRange) bool {
+	for _, r := range ranges {
+		if id >= r.from && id <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// wafTransforms lists the supported t: transformations.
+var wafTransforms = map[string]wafTransform{
+	"lowercase":          strings.ToLower,
+	"uppercase":          strings.ToUpper,
+	"trim":               strings.TrimSpace,
+	"trimLeft":           func(s string) string { return strings.TrimLeftFunc(s, unicode.IsSpace) },
+	"trimRight":          func(s string) string { return strings.TrimRightFunc(s, unicode.IsSpace) },
+	"urlDecode":          func(s string) string { return wafURLDecode(s, false) },
+	"urlDecodeUni":       func(s string) string { return wafURLDecode(s, true) },
+	"htmlEntityDecode":   html.UnescapeString,
+	"compressWhitespace": wafCompressWhitespace,
+	"removeWhitespace":   func(s string) string { return strings.Join(strings.Fields(s), "") },
+	"removeNulls":        func(s string) string { return strings.ReplaceAll(s, "\x00", "") },
+	"replaceNulls":       func(s string) string { return strings.ReplaceAll(s, "\x00", " ") },
+	"replaceComments":    wafReplaceComments,
+	"normalizePath":      wafNormalizePath,
+	"normalisePath":      wafNormalizePath,
+	"normalizePathWin":   func(s string) string { return wafNormalizePath(strings.ReplaceAll(s, "\\", "/")) },
+	"normalisePathWin":   func(s string) string { return wafNormalizePath(strings.ReplaceAll(s, "\\", "/")) },
+	"base64Decode":       wafBase64Decode,
+	"hexDecode":          wafHexDecode,
+	"length":             func(s string) string { return strconv.Itoa(len(s)) },
+	"cmdLine":            wafCmdLine,
+}
+
+// wafURLDecode decodes %XX escapes and +, leaving invalid escapes intact.
+// With unicode set, IIS-style %uXXXX escapes are decoded too.
+func wafURLDecode(s string, unicode bool) string {
+	if !strings.ContainsAny(s, "%+") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '+':
+			b.WriteByte(' ')
+		case s[i] == '%' && unicode && i+5 < len(s) && (s[i+1] == 'u' || s[i+1] == 'U') && isHex(s[i+2:i+6]):
+			code, _ := strconv.ParseUint(s[i+2:i+6], 16, 32)
+			if code >= 0xff01 && code <= 0xff5e {
+				// Map full-width ASCII variants to ASCII, as IIS does.
+				code -= 0xfee0
+			}
+			b.WriteRune(rune(code))
+			i += 5
+		case s[i] == '%' && i+2 < len(s) && isHex(s[i+1:i+3]):
+			value, _ := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			b.WriteByte(byte(value))
+			i += 2
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// isHex reports whether s consists only of hex digits.
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// wafCompressWhitespace replaces runs of whitespace with a single space.
+func wafCompressWhitespace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// wafReplaceComments replaces C-style comments, including an unterminated
+// trailing one, with a single space.
+func wafReplaceComments(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "/*")
+		if start < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:start])
+		b.WriteByte(' ')
+		end := strings.Index(s[start+2:], "*/")
+		if end < 0 {
+			return b.String()
+		}
+		s = s[start+2+end+2:]
+	}
+}
+
+// wafNormalizePath removes ./ and ../ segments and duplicate slashes.
+func wafNormalizePath(s string) string {
+	if s == "" {
+		return s
+	}
+	cleaned := path.Clean(s)
+	if strings.HasSuffix(s, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// wafBase64Decode decodes standard base64, returning s unchanged if invalid.
+func wafBase64Decode(s string) string {
+	decoded, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		if decoded, err = base64.RawStdEncoding.DecodeString(s); err != nil {
+			return s
+		}
+	}
+	return string(decoded)
+}
+
+// wafHexDecode decodes a hex string, returning s unchanged if invalid.
+func wafHexDecode(s string) string {
+	decoded, err := hex.DecodeString(s)
+	if err != nil {
+		return s
+	}
+	return string(decoded)
+}
+
+// wafCmdLine normalizes shell command lines the way ModSecurity does:
+// escape and quote characters are removed, separators become spaces and
+// the result is lowercased.
+func wafCmdLine(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r == '\\' || r == '"' || r == '\'' || r == '^':
+			continue
+		case r == ',' || r == ';' || unicode.IsSpace(r):
+			if !space {
+				b.WriteByte(' ')
+			}
+			space = true
+			continue
+		case r == '/' || r == '(':
+			if space {
+				// Drop the space before a path or parenthesis.
+				trimmed := strings.TrimSuffix(b.String(), " ")
+				b.Reset()
+				b.WriteString(trimmed)
+			}
+		}
+		space = false
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// wafAtoi parses a leading integer, treating anything else as zero.
+func wafAtoi(s string) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// wafTransaction holds the variables of one request and its TX collection.
+type wafTransaction struct {
+	collections    map[string][]wafVar
+	tx             map[string]string
+	matchedVar     string
+	matchedVarName string
+	severityScore  int
+}
+
+// newWAFTransaction creates a transaction with the CRS anomaly score settings.
+func newWAFTransaction(threshold int) *wafTransaction {
+	return &wafTransaction{
+		collections: make(map[string][]wafVar),
+		tx: map[string]string{
+			"critical_anomaly_score":          "5",
+			"error_anomaly_score":             "4",
+			"warning_anomaly_score":           "3",
+			"notice_anomaly_score":            "2",
+			"inbound_anomaly_score_threshold": strconv.Itoa(threshold),
+			"detection_paranoia_level":        "1",
+			"blocking_paranoia_level":         "1",
+			"paranoia_level":                  "1",
+		},
+	}
+}
+
+// set stores a scalar variable.
+func (t *wafTransaction) set(collection, value string) {
+	t.collections[collection] = []wafVar{{value: value}}
+}
+
+// add appends a keyed variable.
+func (t *wafTransaction) add(collection, key, value string) {
+	t.collections[collection] = append(t.collections[collection], wafVar{key: key, value: value})
+}
+
+// values returns the variables selected by target that are not excluded.
+func (t *wafTransaction) values(target wafTarget, excluded []wafTarget) []wafVar {
+	var vars []wafVar
+	if target.collection == "TX" {
+		keys := make([]string, 0, len(t.tx))
+		for key := range t.tx {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			vars = append(vars, wafVar{key: key, value: t.tx[key]})
+		}
+	} else {
+		vars = t.collections[target.collection]
+	}
+
+	var selected []wafVar
+	for _, v := range vars {
+		if !target.selects(v.key) {
+			continue
+		}
+		if wafExcluded(target.collection, v.key, excluded) {
+			continue
+		}
+		selected = append(selected, v)
+	}
+
+	if target.count {
+		return []wafVar{{value: strconv.Itoa(len(selected))}}
+	}
+	return selected
+}
+
+// selects reports whether the target's key selector matches key.
+func (target wafTarget) selects(key string) bool {
+	switch {
+	case target.keyRx != nil:
+		return target.keyRx.MatchString(key)
+	case target.key != "":
+		return strings.EqualFold(target.key, key)
+	default:
+		return true
+	}
+}
+
+// wafExcluded reports whether a variable is removed by an exclusion. An
+// exclusion on ARGS also covers ARGS_GET and ARGS_POST.
+func wafExcluded(collection, key string, excluded []wafTarget) bool {
+	for _, exclusion := range excluded {
+		if exclusion.collection != collection &&
+			!(exclusion.collection == "ARGS" && (collection == "ARGS_GET" || collection == "ARGS_POST")) &&
+			!(exclusion.collection == "ARGS_NAMES" && (collection == "ARGS_GET_NAMES" || collection == "ARGS_POST_NAMES")) {
+			continue
+		}
+		if exclusion.selects(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// expand substitutes %{tx.name}, %{matched_var} and %{matched_var_name} macros.
+func (t *wafTransaction) expand(s string) string {
+	if !strings.Contains(s, "%{") {
+		return s
+	}
+	return wafMacroPattern.ReplaceAllStringFunc(s, func(macro string) string {
+		name := strings.ToLower(macro[2 : len(macro)-1])
+		switch {
+		case strings.HasPrefix(name, "tx."):
+			return t.tx[strings.TrimPrefix(name, "tx.")]
+		case name == "matched_var":
+			return t.matchedVar
+		case name == "matched_var_name":
+			return t.matchedVarName
+		default:
+			return ""
+		}
+	})
+}
+
+// anomalyScore returns the inbound anomaly score accumulated so far.
+func (t *wafTransaction) anomalyScore() int {
+	score := t.severityScore + wafAtoi(t.tx["anomaly_score"])
+	if total, ok := t.tx["inbound_anomaly_score"]; ok {
+		return score + wafAtoi(total)
+	}
+	for name, value := range t.tx {
+		if strings.HasPrefix(name, "inbound_anomaly_score_pl") {
+			score += wafAtoi(value)
+		}
+	}
+	return score
+}
+
+// wafMatch records a rule that matched a request.
+type wafMatch struct {
+	rule     *wafRule
+	variable string
+	value    string
+	score    int
+}
+
+// wafResult is the outcome of evaluating a transaction.
+type wafResult struct {
+	matches     []wafMatch
+	interrupted *wafMatch
+	allowed     bool
+}
+
+// done reports whether evaluation stopped early.
+func (r *wafResult) done() bool {
+	return r.interrupted != nil || r.allowed
+}
+
+// wafRuleFilter decides per request which rules are skipped and which
+// variables are excluded from a rule.
+type wafRuleFilter interface {
+	skip(rule *wafRule) bool
+	excludedTargets(rule *wafRule) []wafTarget
+}
+
+// evaluate runs the rules of one phase against t.
+func (s *wafRuleSet) evaluate(t *wafTransaction, phase int, filter wafRuleFilter, result *wafResult) {
+	for i := 0; i < len(s.rules) && !result.done(); i++ {
+		rule := s.rules[i]
+		if rule.marker != "" || rule.phase != phase || filter.skip(rule) {
+			continue
+		}
+
+		match, ok := rule.evaluate(t, filter.excludedTargets(rule))
+		if !ok {
+			continue
+		}
+
+		if rule.log {
+			result.matches = append(result.matches, match)
+		}
+
+		switch rule.action {
+		case wafActionDeny:
+			result.interrupted = &match
+		case wafActionAllow:
+			result.allowed = true
+		}
+
+		if rule.skipAfter != "" {
+			i = s.markers[rule.skipAfter]
+		}
+	}
+}
+
+// evaluate tests the rule and its chain and applies their setvars on a match.
+func (r *wafRule) evaluate(t *wafTransaction, excluded []wafTarget) (wafMatch, bool) {
+	match := wafMatch{rule: r}
+	for link := r; link != nil; link = link.chain {
+		variable, value, ok := link.test(t, excluded)
+		if !ok {
+			return wafMatch{}, false
+		}
+		if link == r {
+			match.variable = variable
+			match.value = value
+		}
+	}
+
+	before := t.anomalyScore()
+	scored := false
+	for link := r; link != nil; link = link.chain {
+		for _, setvar := range link.setvars {
+			setvar.apply(t)
+			if strings.Contains(setvar.name, "anomaly_score") {
+				scored = true
+			}
+		}
+	}
+
+	// Rules that block without keeping their own score contribute their severity.
+	if !scored && r.action == wafActionBlock {
+		t.severityScore += wafSeverityScores[r.severity]
+	}
+
+	match.score = t.anomalyScore() - before
+	return match, true
+}
+
+// test evaluates a single rule link and returns the first matching variable.
+func (r *wafRule) test(t *wafTransaction, excluded []wafTarget) (string, string, bool) {
+	if len(r.targets) == 0 {
+		if r.operator.eval(t, "") != r.operator.negate {
+			return "", "", true
+		}
+		return "", "", false
+	}
+
+	if len(r.excluded) > 0 {
+		excluded = append(excluded[:len(excluded):len(excluded)], r.excluded...)
+	}
+	for _, target := range r.targets {
+		for _, v := range t.values(target, excluded) {
+			value := v.value
+			for _, transform := range r.transforms {
+				value = transform(value)
+			}
+
+			if r.operator.eval(t, value) == r.operator.negate {
+				continue
+			}
+
+			name := target.collection
+			if v.key != "" {
+				name += ":" + v.key
+			}
+			t.matchedVar = v.value
+			t.matchedVarName = name
+			return name, v.value, true
+		}
+	}
+
+	return "", "", false
+}
+
+// apply executes the setvar against the TX collection.
+func (s wafSetVar) apply(t *wafTransaction) {
+	value := t.expand(s.value)
+	switch s.op {
+	case '!':
+		delete(t.tx, s.name)
+	case '+':
+		t.tx[s.name] = strconv.Itoa(wafAtoi(t.tx[s.name]) + wafAtoi(value))
+	case '-':
+		t.tx[s.name] = strconv.Itoa(wafAtoi(t.tx[s.name]) - wafAtoi(value))
+	default:
+		t.tx[s.name] = value
+	}
+}
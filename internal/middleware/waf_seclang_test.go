@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// evaluateWAFRules parses rules and evaluates both request phases against args.
+func evaluateWAFRules(t *testing.T, rules string, args map[string]string) (*wafTransaction, *wafResult) {
+	t.Helper()
+
+	parser := newWAFParser()
+	require.NoError(t, parser.parse(rules, "", "test"))
+	set, err := parser.build()
+	require.NoError(t, err)
+
+	tx := newWAFTransaction(5)
+	for _, name := range sortedKeys(args) {
+		addWAFArg(tx, "ARGS_GET", name, args[name])
+	}
+
+	result := &wafResult{}
+	set.evaluate(tx, wafPhaseRequestHeaders, wafExclusions{}, result)
+	set.evaluate(tx, wafPhaseRequestBody, wafExclusions{}, result)
+	return tx, result
+}
+
+// matchedWAFRuleIDs returns the IDs of the matched rules.
+func matchedWAFRuleIDs(result *wafResult) []int {
+	ids := []int{}
+	for _, match := range result.matches {
+		ids = append(ids, match.rule.id)
+	}
+	return ids
+}
+
+func TestWAFParser_Evaluate(t *testing.T) {
+	tests := []struct {
+		name          string
+		rules         string
+		args          map[string]string
+		expectedIDs   []int
+		expectedScore int
+		expectDeny    bool
+	}{
+		{
+			name:          "Evaluate_SeverityWithoutSetvar_AddsSeverityScore",
+			rules:         `SecRule ARGS "@contains evil" "id:1,block,severity:WARNING"`,
+			args:          map[string]string{"q": "evil"},
+			expectedIDs:   []int{1},
+			expectedScore: 3,
+		},
+		{
+			name: "Evaluate_SetvarMacro_AddsAnomalyScore",
+			rules: `SecRule ARGS:q "@rx ^a+$" "id:1,block,severity:CRITICAL,\
+				setvar:'tx.inbound_anomaly_score_pl1=+%{tx.critical_anomaly_score}'"`,
+			args:          map[string]string{"q": "aaa"},
+			expectedIDs:   []int{1},
+			expectedScore: 5,
+		},
+		{
+			name: "Evaluate_Chain_RequiresAllLinks",
+			rules: `SecRule ARGS:a "@streq x" "id:1,deny,chain"
+				SecRule ARGS:b "@streq y"`,
+			args:        map[string]string{"a": "x", "b": "z"},
+			expectedIDs: []int{},
+		},
+		{
+			name: "Evaluate_ChainMatched_Denies",
+			rules: `SecRule ARGS:a "@streq x" "id:1,deny,chain"
+				SecRule ARGS:b "@streq y"`,
+			args:        map[string]string{"a": "x", "b": "y"},
+			expectedIDs: []int{1},
+			expectDeny:  true,
+		},
+		{
+			name: "Evaluate_SkipAfter_JumpsToMarker",
+			rules: `SecAction "id:1,phase:1,pass,nolog,skipAfter:END"
+				SecRule ARGS "@unconditionalMatch" "id:2,phase:1,deny"
+				SecMarker END
+				SecRule ARGS "@unconditionalMatch" "id:3,phase:1,pass"`,
+			args:        map[string]string{"q": "x"},
+			expectedIDs: []int{3},
+		},
+		{
+			name: "Evaluate_TransformsAndNegation_Applied",
+			rules: `SecRule ARGS "!@rx ^[a-z]+$" "id:1,pass,t:urlDecodeUni,t:lowercase"
+				SecRule ARGS "@streq <b>" "id:2,pass,t:htmlEntityDecode"`,
+			args:        map[string]string{"q": "HeLLo", "r": "&lt;b&gt;"},
+			expectedIDs: []int{1, 2},
+		},
+		{
+			name: "Evaluate_CountAndTX_Supported",
+			rules: `SecRule &ARGS "@ge 2" "id:1,pass,setvar:tx.many=1"
+				SecRule TX:many "@eq 1" "id:2,pass"`,
+			args:        map[string]string{"a": "1", "b": "2"},
+			expectedIDs: []int{1, 2},
+		},
+		{
+			name: "Evaluate_RemoveByIDAndTag_DisablesRules",
+			rules: `SecRule ARGS "@unconditionalMatch" "id:1,pass"
+				SecRule ARGS "@unconditionalMatch" "id:2,pass,tag:'attack-sqli'"
+				SecRule ARGS "@unconditionalMatch" "id:3,pass"
+				SecRuleRemoveById 1
+				SecRuleRemoveByTag ^attack-`,
+			args:        map[string]string{"q": "x"},
+			expectedIDs: []int{3},
+		},
+		{
+			name: "Evaluate_UpdateTargetByID_ExcludesVariable",
+			rules: `SecRule ARGS "@contains x" "id:1,pass"
+				SecRuleUpdateTargetById 1 "!ARGS:password"`,
+			args:        map[string]string{"password": "x"},
+			expectedIDs: []int{},
+		},
+		{
+			name: "Evaluate_ResponsePhaseRule_Ignored",
+			rules: `SecRule ARGS "@unconditionalMatch" "id:1,phase:4,deny"
+				SecRuleEngine On`,
+			args:        map[string]string{"q": "x"},
+			expectedIDs: []int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			tx, result := evaluateWAFRules(t, tt.rules, tt.args)
+
+			// Assert
+			assert.Equal(t, tt.expectedIDs, matchedWAFRuleIDs(result))
+			assert.Equal(t, tt.expectedScore, tx.anomalyScore())
+			assert.Equal(t, tt.expectDeny, result.interrupted != nil)
+		})
+	}
+}
+
+func TestWAFParser_Parse_Errors(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+	}{
+		{name: "Parse_MissingID_ReturnsError", rules: `SecRule ARGS "@rx a" "pass"`},
+		{name: "Parse_DuplicateID_ReturnsError", rules: "SecRule ARGS \"@rx a\" \"id:1\"\nSecRule ARGS \"@rx b\" \"id:1\""},
+		{name: "Parse_UnknownVariable_ReturnsError", rules: `SecRule RESPONSE_BODY "@rx a" "id:1"`},
+		{name: "Parse_UnsupportedOperator_ReturnsError", rules: `SecRule ARGS "@detectSQLi" "id:1"`},
+		{name: "Parse_UnsupportedTransform_ReturnsError", rules: `SecRule ARGS "@rx a" "id:1,t:jsDecode"`},
+		{name: "Parse_UnknownDirective_ReturnsError", rules: `Include rules/*.conf`},
+		{name: "Parse_InvalidRegex_ReturnsError", rules: `SecRule ARGS "@rx (?<=a)b" "id:1"`},
+		{name: "Parse_DanglingChain_ReturnsError", rules: `SecRule ARGS "@rx a" "id:1,chain"`},
+		{name: "Parse_UnknownMarker_ReturnsError", rules: `SecAction "id:1,skipAfter:MISSING"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			parser := newWAFParser()
+			err := parser.parse(tt.rules, "", "test")
+			if err == nil {
+				_, err = parser.build()
+			}
+
+			// Assert
+			assert.ErrorIs(t, err, ErrInvalidWAFRule)
+		})
+	}
+}
+
+func TestWAFTransforms(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform string
+		input     string
+		expected  string
+	}{
+		{name: "Transform_URLDecodeUni_DecodesUnicode", transform: "urlDecodeUni", input: "%u003cscript%3E+x", expected: "<script> x"},
+		{name: "Transform_URLDecode_KeepsInvalidEscape", transform: "urlDecode", input: "100%zz", expected: "100%zz"},
+		{name: "Transform_ReplaceComments_Replaces", transform: "replaceComments", input: "union/**/select/* tail", expected: "union select "},
+		{name: "Transform_NormalizePathWin_Cleans", transform: "normalizePathWin", input: `a\..\..\etc/passwd`, expected: "../etc/passwd"},
+		{name: "Transform_CompressWhitespace_Collapses", transform: "compressWhitespace", input: "a \t\n b", expected: "a b"},
+		{name: "Transform_CmdLine_Normalizes", transform: "cmdLine", input: `C^at  "/etc/passwd"`, expected: "cat/etc/passwd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			result := wafTransforms[tt.transform](tt.input)
+
+			// Assert
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
@@ -0,0 +1,323 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/albedosehen/rwwwrse/internal/observability"
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+// newTestWAFHandler wraps a handler that echoes the request body in a WAF middleware.
+func newTestWAFHandler(t *testing.T, mutate func(*WAFConfig), metrics observability.MetricsCollector) http.Handler {
+	t.Helper()
+
+	config := DefaultWAFConfig()
+	config.Name = "app.example.com"
+	mutate(&config)
+
+	mw, err := NewWAFMiddleware(config, nil, metrics)
+	require.NoError(t, err)
+
+	return mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	}))
+}
+
+func TestWAFMiddleware_CoreRules(t *testing.T) {
+	tests := []struct {
+		name           string
+		method         string
+		target         string
+		contentType    string
+		body           string
+		header         http.Header
+		expectedStatus int
+	}{
+		{
+			name:           "CoreRules_BenignRequest_Passes",
+			method:         http.MethodGet,
+			target:         "/products?id=42&sort=price",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "CoreRules_UnionSelectQuery_Blocked",
+			method:         http.MethodGet,
+			target:         "/products?id=1%20UNION/**/SELECT%20password%20FROM%20users",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "CoreRules_TautologyForm_Blocked",
+			method:         http.MethodPost,
+			target:         "/login",
+			contentType:    "application/x-www-form-urlencoded",
+			body:           "user=admin%27%20or%201%3D1--&password=x",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "CoreRules_ScriptTagJSON_Blocked",
+			method:         http.MethodPost,
+			target:         "/comments",
+			contentType:    "application/json",
+			body:           `{"comment":{"text":"<script>alert(1)</script>"}}`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "CoreRules_PathTraversal_Blocked",
+			method:         http.MethodGet,
+			target:         "/download?file=..%2f..%2fetc%2fpasswd",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "CoreRules_ScannerUserAgent_Blocked",
+			method:         http.MethodGet,
+			target:         "/",
+			header:         http.Header{"User-Agent": {"sqlmap/1.7"}},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "CoreRules_PlainJSON_Passes",
+			method:         http.MethodPost,
+			target:         "/comments",
+			contentType:    "application/json",
+			body:           `{"comment":{"text":"Select the best option or leave it"}}`,
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	handler := newTestWAFHandler(t, func(*WAFConfig) {}, nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, tt.body, rec.Body.String())
+			} else {
+				assert.Contains(t, rec.Body.String(), `"code":"access_denied"`)
+			}
+		})
+	}
+}
+
+func TestWAFMiddleware_DetectionMode_LogsWithoutBlocking(t *testing.T) {
+	// Arrange
+	metrics := testhelpers.NewMockMetricsCollector()
+	metrics.On("RecordWAFRuleMatch", "app.example.com", "942100").Return().Once()
+	metrics.On("RecordWAFDecision", "app.example.com", WAFOutcomeDetected).Return().Once()
+	handler := newTestWAFHandler(t, func(c *WAFConfig) { c.Mode = WAFModeDetection }, metrics)
+	req := httptest.NewRequest(http.MethodGet, "/?q=1+union+select+1", nil)
+	rec := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rec, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+	metrics.AssertExpectations(t)
+}
+
+func TestWAFMiddleware_AnomalyThreshold(t *testing.T) {
+	tests := []struct {
+		name           string
+		threshold      int
+		expectedStatus int
+	}{
+		{
+			name:           "AnomalyThreshold_ScoreBelow_Passes",
+			threshold:      10,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "AnomalyThreshold_ScoreReached_Blocked",
+			threshold:      5,
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			handler := newTestWAFHandler(t, func(c *WAFConfig) { c.AnomalyThreshold = tt.threshold }, nil)
+			req := httptest.NewRequest(http.MethodGet, "/?q=1+union+select+1", nil)
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestWAFMiddleware_Exclusions(t *testing.T) {
+	tests := []struct {
+		name           string
+		exclusion      WAFExclusion
+		target         string
+		expectedStatus int
+	}{
+		{
+			name:           "Exclusion_RuleIDOnPath_Skipped",
+			exclusion:      WAFExclusion{PathPrefix: "/search", RuleIDs: []int{942100}},
+			target:         "/search?q=union+select",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Exclusion_OtherPath_StillBlocked",
+			exclusion:      WAFExclusion{PathPrefix: "/search", RuleIDs: []int{942100}},
+			target:         "/products?q=union+select",
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Exclusion_TagTarget_IgnoresVariable",
+			exclusion:      WAFExclusion{Tags: []string{"attack-sqli"}, Targets: []string{"ARGS:q"}},
+			target:         "/search?q=union+select",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Exclusion_TagTarget_OtherVariableBlocked",
+			exclusion:      WAFExclusion{Tags: []string{"attack-sqli"}, Targets: []string{"ARGS:q"}},
+			target:         "/search?id=union+select",
+			expectedStatus: http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			handler := newTestWAFHandler(t, func(c *WAFConfig) {
+				c.Exclusions = []WAFExclusion{tt.exclusion}
+			}, nil)
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+		})
+	}
+}
+
+func TestWAFMiddleware_CustomRules(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "bad-agents.data"), []byte("# bots\nbadbot\n"), 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "custom.conf"), []byte(`
+SecRule REQUEST_HEADERS:User-Agent "@pmFromFile bad-agents.data" \
+    "id:10001,phase:1,deny,status:429,msg:'Bad bot'"
+`), 0o600))
+
+	metrics := testhelpers.NewMockMetricsCollector()
+	metrics.On("RecordWAFRuleMatch", "app.example.com", "10001").Return().Once()
+	metrics.On("RecordWAFDecision", "app.example.com", mock.Anything).Return().Once()
+	handler := newTestWAFHandler(t, func(c *WAFConfig) {
+		c.CoreRules = false
+		c.RuleFiles = []string{filepath.Join(dir, "*.conf")}
+	}, metrics)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "BadBot/2.0")
+	rec := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rec, req)
+
+	// Assert
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	metrics.AssertExpectations(t)
+}
+
+func TestWAFMiddleware_BodyLimit_InspectsPrefixAndForwardsAll(t *testing.T) {
+	// Arrange
+	handler := newTestWAFHandler(t, func(c *WAFConfig) { c.BodyLimit = 16 }, nil)
+	body := "safe=" + strings.Repeat("a", 32) + "&q=union+select+1"
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rec, req)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, body, rec.Body.String())
+}
+
+func TestWAFValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*WAFConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Defaults_Valid",
+			mutate: func(*WAFConfig) {},
+		},
+		{
+			name:        "Validate_UnknownMode_ReturnsError",
+			mutate:      func(c *WAFConfig) { c.Mode = "enforce" },
+			expectedErr: ErrInvalidWAFMode,
+		},
+		{
+			name:        "Validate_NoRules_ReturnsError",
+			mutate:      func(c *WAFConfig) { c.CoreRules = false },
+			expectedErr: ErrWAFNoRules,
+		},
+		{
+			name:        "Validate_ZeroThreshold_ReturnsError",
+			mutate:      func(c *WAFConfig) { c.AnomalyThreshold = 0 },
+			expectedErr: ErrInvalidWAFThreshold,
+		},
+		{
+			name:        "Validate_EmptyExclusion_ReturnsError",
+			mutate:      func(c *WAFConfig) { c.Exclusions = []WAFExclusion{{PathPrefix: "/api"}} },
+			expectedErr: ErrInvalidWAFExclusion,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultWAFConfig()
+			tt.mutate(&config)
+
+			// Act
+			err := NewWAFValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
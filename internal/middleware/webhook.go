@@ -0,0 +1,574 @@
+// Package middleware implements HMAC signature verification for inbound webhooks.
+package middleware
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/observability"
+)
+
+// Webhook signature presets.
+const (
+	WebhookPresetGitHub  = "github"
+	WebhookPresetStripe  = "stripe"
+	WebhookPresetSlack   = "slack"
+	WebhookPresetShopify = "shopify"
+)
+
+// Webhook signature placeholders used in payload templates.
+const (
+	webhookPlaceholderBody      = "{body}"
+	webhookPlaceholderTimestamp = "{timestamp}"
+	webhookPlaceholderMethod    = "{method}"
+	webhookPlaceholderPath      = "{path}"
+)
+
+// webhookReplayMaxEntries bounds the number of remembered signatures.
+const webhookReplayMaxEntries = 100000
+
+// WebhookScheme describes how a sender signs webhook requests.
+type WebhookScheme struct {
+	// Header carries the signature.
+	Header string
+
+	// Algorithm is the HMAC hash: sha1, sha256 or sha512.
+	Algorithm string
+
+	// Encoding of the signature: hex or base64.
+	Encoding string
+
+	// Prefix is stripped from the signature value, e.g. "sha256=".
+	Prefix string
+
+	// SignatureParam and TimestampParam are set when the signature header is
+	// a comma-separated key=value list, as in "t=1700000000,v1=abc".
+	SignatureParam string
+	TimestampParam string
+
+	// TimestampHeader carries the signing time in Unix seconds.
+	TimestampHeader string
+
+	// Payload is the signed payload template. It may reference {body},
+	// {timestamp}, {method} and {path}, and must contain {body}.
+	Payload string
+
+	// Tolerance is the maximum age of a signed timestamp.
+	Tolerance time.Duration
+}
+
+// webhookPresets are the built-in signing schemes of common providers.
+var webhookPresets = map[string]WebhookScheme{
+	WebhookPresetGitHub: {
+		Header:    "X-Hub-Signature-256",
+		Algorithm: "sha256",
+		Encoding:  "hex",
+		Prefix:    "sha256=",
+		Payload:   webhookPlaceholderBody,
+	},
+	WebhookPresetStripe: {
+		Header:         "Stripe-Signature",
+		Algorithm:      "sha256",
+		Encoding:       "hex",
+		SignatureParam: "v1",
+		TimestampParam: "t",
+		Payload:        webhookPlaceholderTimestamp + "." + webhookPlaceholderBody,
+		Tolerance:      5 * time.Minute,
+	},
+	WebhookPresetSlack: {
+		Header:          "X-Slack-Signature",
+		Algorithm:       "sha256",
+		Encoding:        "hex",
+		Prefix:          "v0=",
+		TimestampHeader: "X-Slack-Request-Timestamp",
+		Payload:         "v0:" + webhookPlaceholderTimestamp + ":" + webhookPlaceholderBody,
+		Tolerance:       5 * time.Minute,
+	},
+	WebhookPresetShopify: {
+		Header:    "X-Shopify-Hmac-Sha256",
+		Algorithm: "sha256",
+		Encoding:  "base64",
+		Payload:   webhookPlaceholderBody,
+	},
+}
+
+// WebhookConfig holds configuration for the webhook signature middleware.
+type WebhookConfig struct {
+	// Name identifies the route in logs.
+	Name string
+
+	// Preset selects a built-in scheme. Non-empty fields of Scheme override it.
+	Preset string
+
+	// Scheme describes the signature format.
+	Scheme WebhookScheme
+
+	// Secret, SecretEnv and SecretFile are alternative sources of the
+	// signing secret. Exactly one must be set.
+	Secret     string
+	SecretEnv  string
+	SecretFile string
+
+	// Paths limits verification to these path prefixes. Empty verifies
+	// every request of the route.
+	Paths []string
+
+	// MaxBodySize limits the size of a buffered webhook body.
+	MaxBodySize int64
+
+	// ReplayWindow is how long verified signatures are remembered to reject
+	// replays. Zero disables replay protection.
+	ReplayWindow time.Duration
+}
+
+// DefaultWebhookConfig returns a webhook configuration with sensible defaults.
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		Paths:        []string{},
+		MaxBodySize:  1 << 20,
+		ReplayWindow: 10 * time.Minute,
+	}
+}
+
+// resolvedScheme returns the preset merged with the configured overrides.
+func (c WebhookConfig) resolvedScheme() WebhookScheme {
+	scheme := webhookPresets[c.Preset]
+	override := c.Scheme
+
+	if override.Header != "" {
+		scheme.Header = override.Header
+	}
+	if override.Algorithm != "" {
+		scheme.Algorithm = override.Algorithm
+	}
+	if override.Encoding != "" {
+		scheme.Encoding = override.Encoding
+	}
+	if override.Prefix != "" {
+		scheme.Prefix = override.Prefix
+	}
+	if override.SignatureParam != "" {
+		scheme.SignatureParam = override.SignatureParam
+	}
+	if override.TimestampParam != "" {
+		scheme.TimestampParam = override.TimestampParam
+	}
+	if override.TimestampHeader != "" {
+		scheme.TimestampHeader = override.TimestampHeader
+	}
+	if override.Payload != "" {
+		scheme.Payload = override.Payload
+	}
+	if override.Tolerance != 0 {
+		scheme.Tolerance = override.Tolerance
+	}
+	if scheme.Encoding == "" {
+		scheme.Encoding = "hex"
+	}
+	if scheme.Payload == "" {
+		scheme.Payload = webhookPlaceholderBody
+	}
+
+	return scheme
+}
+
+// webhookMiddleware verifies HMAC signatures of webhook requests.
+type webhookMiddleware struct {
+	config  WebhookConfig
+	scheme  WebhookScheme
+	label   string
+	secret  []byte
+	newHash func() hash.Hash
+	logger  observability.Logger
+	metrics observability.MetricsCollector
+
+	now  func() time.Time
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// NewWebhookMiddleware creates a new webhook signature middleware.
+func NewWebhookMiddleware(
+	config WebhookConfig,
+	logger observability.Logger,
+	metrics observability.MetricsCollector,
+) (Middleware, error) {
+	validator := NewWebhookValidator()
+	if err := validator.Validate(config); err != nil {
+		return nil, err
+	}
+
+	secret, err := loadWebhookSecret(config)
+	if err != nil {
+		return nil, err
+	}
+
+	scheme := config.resolvedScheme()
+	label := config.Preset
+	if label == "" {
+		label = "custom"
+	}
+
+	return &webhookMiddleware{
+		config:  config,
+		scheme:  scheme,
+		label:   label,
+		secret:  secret,
+		newHash: webhookHashes[scheme.Algorithm],
+		logger:  logger,
+		metrics: metrics,
+		now:     time.Now,
+		seen:    make(map[string]time.Time),
+	}, nil
+}
+
+// loadWebhookSecret reads the signing secret from its configured source.
+func loadWebhookSecret(config WebhookConfig) ([]byte, error) {
+	var secret string
+	switch {
+	case config.Secret != "":
+		secret = config.Secret
+	case config.SecretEnv != "":
+		secret = os.Getenv(config.SecretEnv)
+	case config.SecretFile != "":
+		data, err := os.ReadFile(config.SecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWebhookSecretRequired, err)
+		}
+		secret = strings.TrimRight(string(data), "\r\n")
+	}
+
+	if secret == "" {
+		return nil, ErrWebhookSecretRequired
+	}
+	return []byte(secret), nil
+}
+
+// Wrap implements the Middleware interface.
+func (m *webhookMiddleware) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.applies(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := m.readBody(r)
+		if err != nil {
+			m.reject(w, r, "body_too_large")
+			return
+		}
+
+		if reason := m.verify(r, body); reason != "" {
+			m.reject(w, r, reason)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// applies reports whether path requires a signature.
+func (m *webhookMiddleware) applies(path string) bool {
+	if len(m.config.Paths) == 0 {
+		return true
+	}
+	for _, prefix := range m.config.Paths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readBody buffers the request body and restores it for the backend.
+func (m *webhookMiddleware) readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, m.config.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > m.config.MaxBodySize {
+		return nil, ErrWebhookBodyTooLarge
+	}
+
+	r.Body = &replayBody{Reader: bytes.NewReader(body), Closer: r.Body}
+	r.ContentLength = int64(len(body))
+	return body, nil
+}
+
+// verify checks the signature of a request. It returns the reason for
+// rejection, or "" when the signature is valid and not replayed.
+func (m *webhookMiddleware) verify(r *http.Request, body []byte) string {
+	header := r.Header.Get(m.scheme.Header)
+	if header == "" {
+		return "missing_signature"
+	}
+
+	signatures, timestamp := m.parseHeader(header)
+	if m.scheme.TimestampHeader != "" {
+		timestamp = r.Header.Get(m.scheme.TimestampHeader)
+	}
+	if len(signatures) == 0 {
+		return "missing_signature"
+	}
+
+	if m.scheme.TimestampHeader != "" || m.scheme.TimestampParam != "" {
+		if reason := m.checkTimestamp(timestamp); reason != "" {
+			return reason
+		}
+	}
+
+	expected := m.sign(r, body, timestamp)
+	valid := false
+	for _, signature := range signatures {
+		decoded, err := m.decode(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return "invalid_signature"
+	}
+
+	if m.config.ReplayWindow > 0 && !m.firstSeen(hex.EncodeToString(expected)) {
+		return "replayed"
+	}
+
+	return ""
+}
+
+// parseHeader extracts the candidate signatures and, for key=value
+// headers, the signed timestamp.
+func (m *webhookMiddleware) parseHeader(header string) ([]string, string) {
+	if m.scheme.SignatureParam == "" {
+		signature, ok := strings.CutPrefix(strings.TrimSpace(header), m.scheme.Prefix)
+		if !ok {
+			return nil, ""
+		}
+		return []string{signature}, ""
+	}
+
+	var signatures []string
+	timestamp := ""
+	for _, part := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case m.scheme.SignatureParam:
+			signatures = append(signatures, value)
+		case m.scheme.TimestampParam:
+			timestamp = value
+		}
+	}
+	return signatures, timestamp
+}
+
+// checkTimestamp verifies that the signing time is within the tolerance.
+func (m *webhookMiddleware) checkTimestamp(timestamp string) string {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "missing_timestamp"
+	}
+
+	if m.scheme.Tolerance > 0 {
+		age := m.now().Sub(time.Unix(seconds, 0))
+		if age > m.scheme.Tolerance || age < -m.scheme.Tolerance {
+			return "timestamp_out_of_tolerance"
+		}
+	}
+	return ""
+}
+
+// sign computes the HMAC of the payload template expanded for r.
+func (m *webhookMiddleware) sign(r *http.Request, body []byte, timestamp string) []byte {
+	expand := strings.NewReplacer(
+		webhookPlaceholderTimestamp, timestamp,
+		webhookPlaceholderMethod, r.Method,
+		webhookPlaceholderPath, r.URL.RequestURI(),
+	)
+
+	mac := hmac.New(m.newHash, m.secret)
+	parts := strings.Split(m.scheme.Payload, webhookPlaceholderBody)
+	for i, part := range parts {
+		_, _ = io.WriteString(mac, expand.Replace(part))
+		if i < len(parts)-1 {
+			_, _ = mac.Write(body)
+		}
+	}
+	return mac.Sum(nil)
+}
+
+// decode decodes a signature in the configured encoding.
+func (m *webhookMiddleware) decode(signature string) ([]byte, error) {
+	if m.scheme.Encoding == "base64" {
+		return base64.StdEncoding.DecodeString(signature)
+	}
+	return hex.DecodeString(strings.ToLower(signature))
+}
+
+// firstSeen records a verified signature and reports whether it was not
+// seen within the replay window.
+func (m *webhookMiddleware) firstSeen(key string) bool {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if seen, ok := m.seen[key]; ok && now.Sub(seen) < m.config.ReplayWindow {
+		return false
+	}
+
+	if len(m.seen) >= webhookReplayMaxEntries {
+		for k, seen := range m.seen {
+			if now.Sub(seen) >= m.config.ReplayWindow {
+				delete(m.seen, k)
+			}
+		}
+		if len(m.seen) >= webhookReplayMaxEntries {
+			// Only validly signed requests get here; accept rather than
+			// failing every delivery while the cache is saturated.
+			return true
+		}
+	}
+
+	m.seen[key] = now
+	return true
+}
+
+// reject logs, records and denies a request that failed verification.
+func (m *webhookMiddleware) reject(w http.ResponseWriter, r *http.Request, reason string) {
+	route := m.config.Name
+	if route == "" {
+		route = normalizeRouteHost(r.Host)
+	}
+
+	ReportOffense(r, OffenseAuthFailure)
+
+	if m.logger != nil {
+		m.logger.Warn(r.Context(), "Webhook signature verification failed",
+			observability.String("request_id", GetRequestID(r.Context())),
+			observability.String("client_ip", getClientIP(r)),
+			observability.String("route", route),
+			observability.String("scheme", m.label),
+			observability.String("reason", reason),
+			observability.String("path", r.URL.Path),
+		)
+	}
+
+	if m.metrics != nil {
+		m.metrics.RecordWebhookVerificationFailure(m.label, reason)
+	}
+
+	writeErrorResponse(w, r, proxyerrors.NewSecurityError(
+		proxyerrors.ErrCodeUnauthorized,
+		"invalid webhook signature",
+		nil,
+	))
+}
+
+// webhookHashes maps supported HMAC algorithms to hash constructors.
+var webhookHashes = map[string]func() hash.Hash{
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// WebhookValidator validates webhook signature configuration.
+type WebhookValidator struct{}
+
+// NewWebhookValidator creates a new webhook validator.
+func NewWebhookValidator() *WebhookValidator {
+	return &WebhookValidator{}
+}
+
+// Validate validates the webhook configuration.
+func (v *WebhookValidator) Validate(config WebhookConfig) error {
+	if config.Preset != "" {
+		if _, ok := webhookPresets[config.Preset]; !ok {
+			return fmt.Errorf("%w: %q", ErrUnknownWebhookPreset, config.Preset)
+		}
+	}
+
+	scheme := config.resolvedScheme()
+	if scheme.Header == "" {
+		return ErrWebhookHeaderRequired
+	}
+
+	if _, ok := webhookHashes[scheme.Algorithm]; !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidWebhookAlgorithm, scheme.Algorithm)
+	}
+
+	if scheme.Encoding != "hex" && scheme.Encoding != "base64" {
+		return fmt.Errorf("%w: %q", ErrInvalidWebhookEncoding, scheme.Encoding)
+	}
+
+	if !strings.Contains(scheme.Payload, webhookPlaceholderBody) {
+		return ErrInvalidWebhookPayload
+	}
+
+	hasTimestamp := scheme.TimestampHeader != "" || scheme.TimestampParam != ""
+	if strings.Contains(scheme.Payload, webhookPlaceholderTimestamp) && !hasTimestamp {
+		return ErrWebhookTimestampRequired
+	}
+	if scheme.Tolerance < 0 || (scheme.Tolerance > 0 && !hasTimestamp) {
+		return ErrInvalidWebhookTolerance
+	}
+
+	sources := 0
+	for _, source := range []string{config.Secret, config.SecretEnv, config.SecretFile} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return ErrWebhookSecretRequired
+	}
+
+	for _, path := range config.Paths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("%w: %q", ErrInvalidWebhookPath, path)
+		}
+	}
+
+	if config.MaxBodySize <= 0 || config.ReplayWindow < 0 {
+		return ErrInvalidWebhookLimits
+	}
+
+	return nil
+}
+
+// Webhook validation errors.
+var (
+	ErrUnknownWebhookPreset     = fmt.Errorf("unknown webhook preset")
+	ErrWebhookHeaderRequired    = fmt.Errorf("webhook signature header is required")
+	ErrInvalidWebhookAlgorithm  = fmt.Errorf("webhook algorithm must be sha1, sha256 or sha512")
+	ErrInvalidWebhookEncoding   = fmt.Errorf("webhook signature encoding must be hex or base64")
+	ErrInvalidWebhookPayload    = fmt.Errorf("webhook payload template must contain {body}")
+	ErrWebhookTimestampRequired = fmt.Errorf("webhook payload uses {timestamp} without a timestamp header or parameter")
+	ErrInvalidWebhookTolerance  = fmt.Errorf("webhook timestamp tolerance requires a timestamp and must not be negative")
+	ErrWebhookSecretRequired    = fmt.Errorf("webhook requires exactly one of secret, secret_env or secret_file")
+	ErrInvalidWebhookPath       = fmt.Errorf("webhook path must start with /")
+	ErrInvalidWebhookLimits     = fmt.Errorf("webhook max body size must be positive and replay window non-negative")
+	ErrWebhookBodyTooLarge      = fmt.Errorf("webhook body exceeds the maximum size")
+)
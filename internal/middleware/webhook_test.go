@@ -0,0 +1,335 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	testhelpers "github.com/albedosehen/rwwwrse/internal/testing"
+)
+
+// webhookTestSecret signs all test webhooks.
+const webhookTestSecret = "whsec_test"
+
+// webhookTestNow is the fixed clock of the webhook tests.
+var webhookTestNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// signWebhook returns the HMAC-SHA256 of payload with the test secret.
+func signWebhook(payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(webhookTestSecret))
+	_, _ = mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
+
+// newTestWebhookHandler wraps a handler that echoes the request body in a
+// webhook middleware with a fixed clock.
+func newTestWebhookHandler(t *testing.T, mutate func(*WebhookConfig)) http.Handler {
+	t.Helper()
+
+	config := DefaultWebhookConfig()
+	config.Secret = webhookTestSecret
+	mutate(&config)
+
+	mw, err := NewWebhookMiddleware(config, nil, nil)
+	require.NoError(t, err)
+	mw.(*webhookMiddleware).now = func() time.Time { return webhookTestNow }
+
+	return mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(body)
+	}))
+}
+
+func TestWebhookMiddleware_Presets(t *testing.T) {
+	body := `{"action":"opened"}`
+	ts := strconv.FormatInt(webhookTestNow.Unix(), 10)
+	stale := strconv.FormatInt(webhookTestNow.Add(-10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name           string
+		preset         string
+		header         http.Header
+		expectedStatus int
+	}{
+		{
+			name:   "Presets_GitHubValid_Passes",
+			preset: WebhookPresetGitHub,
+			header: http.Header{
+				"X-Hub-Signature-256": {"sha256=" + hex.EncodeToString(signWebhook(body))},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Presets_GitHubWrongSignature_Unauthorized",
+			preset: WebhookPresetGitHub,
+			header: http.Header{
+				"X-Hub-Signature-256": {"sha256=" + hex.EncodeToString(signWebhook("other"))},
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "Presets_GitHubMissingSignature_Unauthorized",
+			preset:         WebhookPresetGitHub,
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "Presets_StripeRotatedSecrets_Passes",
+			preset: WebhookPresetStripe,
+			header: http.Header{
+				"Stripe-Signature": {"t=" + ts + ",v1=deadbeef,v1=" + hex.EncodeToString(signWebhook(ts+"."+body))},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Presets_StripeStaleTimestamp_Unauthorized",
+			preset: WebhookPresetStripe,
+			header: http.Header{
+				"Stripe-Signature": {"t=" + stale + ",v1=" + hex.EncodeToString(signWebhook(stale+"."+body))},
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:   "Presets_SlackValid_Passes",
+			preset: WebhookPresetSlack,
+			header: http.Header{
+				"X-Slack-Signature":         {"v0=" + hex.EncodeToString(signWebhook("v0:"+ts+":"+body))},
+				"X-Slack-Request-Timestamp": {ts},
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "Presets_ShopifyValid_Passes",
+			preset: WebhookPresetShopify,
+			header: http.Header{
+				"X-Shopify-Hmac-Sha256": {base64.StdEncoding.EncodeToString(signWebhook(body))},
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			handler := newTestWebhookHandler(t, func(c *WebhookConfig) { c.Preset = tt.preset })
+			req := httptest.NewRequest(http.MethodPost, "/hooks", strings.NewReader(body))
+			for name, values := range tt.header {
+				req.Header[name] = values
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			handler.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.expectedStatus, rec.Code)
+			if tt.expectedStatus == http.StatusOK {
+				assert.Equal(t, body, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebhookMiddleware_CustomScheme(t *testing.T) {
+	// Arrange
+	handler := newTestWebhookHandler(t, func(c *WebhookConfig) {
+		c.Scheme = WebhookScheme{
+			Header:    "X-Signature",
+			Algorithm: "sha256",
+			Payload:   "{method} {path}\n{body}",
+		}
+		c.Paths = []string{"/events"}
+	})
+	body := "ping"
+	signed := httptest.NewRequest(http.MethodPost, "/events?id=1", strings.NewReader(body))
+	signed.Header.Set("X-Signature", hex.EncodeToString(signWebhook("POST /events?id=1\n"+body)))
+	unsigned := httptest.NewRequest(http.MethodPost, "/health", nil)
+
+	// Act
+	signedRec := httptest.NewRecorder()
+	handler.ServeHTTP(signedRec, signed)
+	unsignedRec := httptest.NewRecorder()
+	handler.ServeHTTP(unsignedRec, unsigned)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, signedRec.Code)
+	assert.Equal(t, body, signedRec.Body.String())
+	assert.Equal(t, http.StatusOK, unsignedRec.Code)
+}
+
+func TestWebhookMiddleware_Replay_Rejected(t *testing.T) {
+	// Arrange
+	metrics := testhelpers.NewMockMetricsCollector()
+	metrics.On("RecordWebhookVerificationFailure", WebhookPresetGitHub, "replayed").Return().Once()
+
+	config := DefaultWebhookConfig()
+	config.Preset = WebhookPresetGitHub
+	config.Secret = webhookTestSecret
+	mw, err := NewWebhookMiddleware(config, nil, metrics)
+	require.NoError(t, err)
+	handler := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("{}"))
+		req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(signWebhook("{}")))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Act
+	first := send()
+	replay := send()
+
+	// Assert
+	assert.Equal(t, http.StatusOK, first)
+	assert.Equal(t, http.StatusUnauthorized, replay)
+	metrics.AssertExpectations(t)
+}
+
+func TestWebhookMiddleware_OversizedBody_Unauthorized(t *testing.T) {
+	// Arrange
+	handler := newTestWebhookHandler(t, func(c *WebhookConfig) {
+		c.Preset = WebhookPresetGitHub
+		c.MaxBodySize = 8
+	})
+	body := strings.Repeat("a", 16)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("X-Hub-Signature-256", "sha256="+hex.EncodeToString(signWebhook(body)))
+	rec := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rec, req)
+
+	// Assert
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestNewWebhookMiddleware_SecretSources(t *testing.T) {
+	secretFile := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte(webhookTestSecret+"\n"), 0o600))
+	t.Setenv("RWWWRSE_TEST_WEBHOOK_SECRET", webhookTestSecret)
+
+	tests := []struct {
+		name      string
+		mutate    func(*WebhookConfig)
+		expectErr bool
+	}{
+		{
+			name:   "SecretSources_File_Loaded",
+			mutate: func(c *WebhookConfig) { c.SecretFile = secretFile },
+		},
+		{
+			name:   "SecretSources_Env_Loaded",
+			mutate: func(c *WebhookConfig) { c.SecretEnv = "RWWWRSE_TEST_WEBHOOK_SECRET" },
+		},
+		{
+			name:      "SecretSources_EmptyEnv_ReturnsError",
+			mutate:    func(c *WebhookConfig) { c.SecretEnv = "RWWWRSE_TEST_WEBHOOK_UNSET" },
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultWebhookConfig()
+			config.Preset = WebhookPresetGitHub
+			tt.mutate(&config)
+
+			// Act
+			mw, err := NewWebhookMiddleware(config, nil, nil)
+
+			// Assert
+			if tt.expectErr {
+				assert.ErrorIs(t, err, ErrWebhookSecretRequired)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []byte(webhookTestSecret), mw.(*webhookMiddleware).secret)
+		})
+	}
+}
+
+func TestWebhookValidator_Validate(t *testing.T) {
+	tests := []struct {
+		name        string
+		mutate      func(*WebhookConfig)
+		expectedErr error
+	}{
+		{
+			name:   "Validate_Preset_Valid",
+			mutate: func(*WebhookConfig) {},
+		},
+		{
+			name:        "Validate_UnknownPreset_ReturnsError",
+			mutate:      func(c *WebhookConfig) { c.Preset = "gitlab" },
+			expectedErr: ErrUnknownWebhookPreset,
+		},
+		{
+			name:        "Validate_CustomWithoutHeader_ReturnsError",
+			mutate:      func(c *WebhookConfig) { c.Preset = "" },
+			expectedErr: ErrWebhookHeaderRequired,
+		},
+		{
+			name:        "Validate_UnsupportedAlgorithm_ReturnsError",
+			mutate:      func(c *WebhookConfig) { c.Scheme.Algorithm = "md5" },
+			expectedErr: ErrInvalidWebhookAlgorithm,
+		},
+		{
+			name:        "Validate_PayloadWithoutBody_ReturnsError",
+			mutate:      func(c *WebhookConfig) { c.Scheme.Payload = "{timestamp}" },
+			expectedErr: ErrInvalidWebhookPayload,
+		},
+		{
+			name:        "Validate_TimestampPayloadWithoutSource_ReturnsError",
+			mutate:      func(c *WebhookConfig) { c.Scheme.Payload = "{timestamp}.{body}" },
+			expectedErr: ErrWebhookTimestampRequired,
+		},
+		{
+			name:        "Validate_TwoSecretSources_ReturnsError",
+			mutate:      func(c *WebhookConfig) { c.SecretFile = "/etc/secret" },
+			expectedErr: ErrWebhookSecretRequired,
+		},
+		{
+			name:        "Validate_RelativePath_ReturnsError",
+			mutate:      func(c *WebhookConfig) { c.Paths = []string{"hooks"} },
+			expectedErr: ErrInvalidWebhookPath,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			config := DefaultWebhookConfig()
+			config.Preset = WebhookPresetGitHub
+			config.Secret = webhookTestSecret
+			tt.mutate(&config)
+
+			// Act
+			err := NewWebhookValidator().Validate(config)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
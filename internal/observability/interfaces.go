@@ -46,11 +46,56 @@ type MetricsCollector interface {
 	// RecordCertificateRenewal records certificate renewal metrics.
 	RecordCertificateRenewal(domain string, success bool)
 
-	// RecordRateLimitHit records rate limiting metrics.
-	RecordRateLimitHit(key string)
+	// RecordRateLimitHit records a request rejected by the named rate limit policy.
+	RecordRateLimitHit(policy string)
 
 	// RecordHealthCheck records health check metrics.
 	RecordHealthCheck(target string, success bool, duration time.Duration)
+
+	// RecordAccessDenied records requests denied by an access control rule.
+	RecordAccessDenied(route, rule string)
+
+	// SetConcurrencyLimit sets the adaptive concurrency limit of a backend.
+	SetConcurrencyLimit(backend string, limit int)
+
+	// SetConcurrencyQueueDepth sets the number of requests queued for a backend.
+	SetConcurrencyQueueDepth(backend string, depth int)
+
+	// RecordLoadShed records a request shed by the concurrency limiter.
+	RecordLoadShed(backend, reason string)
+
+	// RecordWAFRuleMatch records a web application firewall rule match.
+	RecordWAFRuleMatch(route, ruleID string)
+
+	// RecordWAFDecision records a request the web application firewall blocked or would have blocked.
+	RecordWAFDecision(route, outcome string)
+
+	// RecordBan records a client ban triggered by an offense event.
+	RecordBan(event string)
+
+	// SetActiveBans sets the number of currently banned clients.
+	SetActiveBans(count int)
+
+	// RecordCSPViolation records a Content-Security-Policy violation report.
+	RecordCSPViolation(route, directive string)
+
+	// RecordWebhookVerificationFailure records a rejected webhook signature by scheme and reason.
+	RecordWebhookVerificationFailure(scheme, reason string)
+
+	// RecordOpenAPIViolation records a request or response that does not match the route's OpenAPI document.
+	RecordOpenAPIViolation(route, direction string)
+
+	// RecordRequestLimitExceeded records a request rejected by a size or upload rate limit.
+	RecordRequestLimitExceeded(route, limit string)
+
+	// RecordStrictHTTPRejection records a request rejected by strict HTTP parsing.
+	RecordStrictHTTPRejection(reason string)
+
+	// RecordCompression records a compressed response with its size before and after compression.
+	RecordCompression(route, encoding string, originalBytes, compressedBytes int64)
+
+	// RecordCacheLookup records how the response cache answered a request: hit, miss, stale, revalidated or bypass.
+	RecordCacheLookup(route, result string)
 }
 
 // Tracer provides distributed tracing capabilities.
@@ -29,6 +29,40 @@ type prometheusCollector struct {
 	// Rate limiting metrics
 	rateLimitHitsTotal *prometheus.CounterVec
 
+	// Access control metrics
+	accessDeniedTotal *prometheus.CounterVec
+
+	// Concurrency limiting metrics
+	concurrencyLimit      *prometheus.GaugeVec
+	concurrencyQueueDepth *prometheus.GaugeVec
+	loadShedTotal         *prometheus.CounterVec
+
+	// Web application firewall metrics
+	wafRuleMatchesTotal *prometheus.CounterVec
+	wafDecisionsTotal   *prometheus.CounterVec
+
+	// Ban manager metrics
+	bansTotal  *prometheus.CounterVec
+	activeBans prometheus.Gauge
+
+	// Content-Security-Policy metrics
+	cspViolationsTotal *prometheus.CounterVec
+
+	// Webhook signature metrics
+	webhookFailuresTotal *prometheus.CounterVec
+
+	// OpenAPI validation metrics
+	openAPIViolationsTotal *prometheus.CounterVec
+
+	// Request limit metrics
+	requestLimitsExceededTotal *prometheus.CounterVec
+
+	// Strict HTTP parsing metrics
+	strictHTTPRejectionsTotal *prometheus.CounterVec
+	compressedResponsesTotal  *prometheus.CounterVec
+	compressionBytesSaved     *prometheus.CounterVec
+	cacheLookupsTotal         *prometheus.CounterVec
+
 	// Health check metrics
 	healthChecksTotal   *prometheus.CounterVec
 	healthCheckDuration *prometheus.HistogramVec
@@ -140,7 +174,168 @@ func NewPrometheusCollector(namespace, subsystem string) MetricsCollector {
 				Name:      "rate_limit_hits_total",
 				Help:      "Total number of rate limit hits",
 			},
-			[]string{"key"},
+			[]string{"policy"},
+		),
+
+		// Access control metrics
+		accessDeniedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "access_denied_total",
+				Help:      "Total number of requests denied by access control rules",
+			},
+			[]string{"route", "rule"},
+		),
+
+		// Concurrency limiting metrics
+		concurrencyLimit: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "concurrency_limit",
+				Help:      "Current adaptive concurrency limit per backend",
+			},
+			[]string{"backend"},
+		),
+
+		concurrencyQueueDepth: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "concurrency_queue_depth",
+				Help:      "Number of requests waiting for a concurrency slot per backend",
+			},
+			[]string{"backend"},
+		),
+
+		loadShedTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "load_shed_total",
+				Help:      "Total number of requests shed by the concurrency limiter",
+			},
+			[]string{"backend", "reason"},
+		),
+
+		wafRuleMatchesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "waf_rule_matches_total",
+				Help:      "Total number of web application firewall rule matches",
+			},
+			[]string{"route", "rule_id"},
+		),
+
+		wafDecisionsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "waf_decisions_total",
+				Help:      "Total number of requests blocked or flagged by the web application firewall",
+			},
+			[]string{"route", "outcome"},
+		),
+
+		bansTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "bans_total",
+				Help:      "Total number of client bans by triggering event",
+			},
+			[]string{"event"},
+		),
+
+		activeBans: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "active_bans",
+				Help:      "Number of currently banned clients",
+			},
+		),
+
+		cspViolationsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "csp_violations_total",
+				Help:      "Total number of Content-Security-Policy violation reports by route and directive",
+			},
+			[]string{"route", "directive"},
+		),
+
+		webhookFailuresTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "webhook_verification_failures_total",
+				Help:      "Total number of rejected webhook signatures by scheme and reason",
+			},
+			[]string{"scheme", "reason"},
+		),
+
+		openAPIViolationsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "openapi_violations_total",
+				Help:      "Total number of requests and responses not matching the OpenAPI document by route and direction",
+			},
+			[]string{"route", "direction"},
+		),
+
+		requestLimitsExceededTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "request_limits_exceeded_total",
+				Help:      "Total number of requests rejected by request size and upload rate limits by route and limit",
+			},
+			[]string{"route", "limit"},
+		),
+
+		strictHTTPRejectionsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "strict_http_rejections_total",
+				Help:      "Total number of requests rejected by strict HTTP parsing by reason",
+			},
+			[]string{"reason"},
+		),
+
+		compressedResponsesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "compressed_responses_total",
+				Help:      "Total number of compressed responses by route and encoding",
+			},
+			[]string{"route", "encoding"},
+		),
+
+		compressionBytesSaved: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "compression_bytes_saved_total",
+				Help:      "Total number of response bytes saved by compression by route and encoding",
+			},
+			[]string{"route", "encoding"},
+		),
+
+		cacheLookupsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Subsystem: subsystem,
+				Name:      "cache_lookups_total",
+				Help:      "Total number of response cache lookups by route and result",
+			},
+			[]string{"route", "result"},
 		),
 
 		// Health check metrics
@@ -196,6 +391,22 @@ func (p *prometheusCollector) registerMetrics() {
 		p.certificateRenewalsTotal,
 		p.certificateExpiry,
 		p.rateLimitHitsTotal,
+		p.accessDeniedTotal,
+		p.concurrencyLimit,
+		p.concurrencyQueueDepth,
+		p.loadShedTotal,
+		p.wafRuleMatchesTotal,
+		p.wafDecisionsTotal,
+		p.bansTotal,
+		p.activeBans,
+		p.cspViolationsTotal,
+		p.webhookFailuresTotal,
+		p.openAPIViolationsTotal,
+		p.requestLimitsExceededTotal,
+		p.strictHTTPRejectionsTotal,
+		p.compressedResponsesTotal,
+		p.compressionBytesSaved,
+		p.cacheLookupsTotal,
 		p.healthChecksTotal,
 		p.healthCheckDuration,
 		p.startTime,
@@ -243,9 +454,9 @@ func (p *prometheusCollector) RecordCertificateRenewal(domain string, success bo
 	}).Inc()
 }
 
-func (p *prometheusCollector) RecordRateLimitHit(key string) {
+func (p *prometheusCollector) RecordRateLimitHit(policy string) {
 	p.rateLimitHitsTotal.With(prometheus.Labels{
-		"key": key,
+		"policy": policy,
 	}).Inc()
 }
 
@@ -271,6 +482,102 @@ func (p *prometheusCollector) RecordHealthCheck(target string, success bool, dur
 	p.backendHealthStatus.With(prometheus.Labels{"backend": target}).Set(healthValue)
 }
 
+func (p *prometheusCollector) RecordAccessDenied(route, rule string) {
+	p.accessDeniedTotal.With(prometheus.Labels{
+		"route": route,
+		"rule":  rule,
+	}).Inc()
+}
+
+func (p *prometheusCollector) SetConcurrencyLimit(backend string, limit int) {
+	p.concurrencyLimit.With(prometheus.Labels{"backend": backend}).Set(float64(limit))
+}
+
+func (p *prometheusCollector) SetConcurrencyQueueDepth(backend string, depth int) {
+	p.concurrencyQueueDepth.With(prometheus.Labels{"backend": backend}).Set(float64(depth))
+}
+
+func (p *prometheusCollector) RecordLoadShed(backend, reason string) {
+	p.loadShedTotal.With(prometheus.Labels{
+		"backend": backend,
+		"reason":  reason,
+	}).Inc()
+}
+
+func (p *prometheusCollector) RecordWAFRuleMatch(route, ruleID string) {
+	p.wafRuleMatchesTotal.With(prometheus.Labels{
+		"route":   route,
+		"rule_id": ruleID,
+	}).Inc()
+}
+
+func (p *prometheusCollector) RecordWAFDecision(route, outcome string) {
+	p.wafDecisionsTotal.With(prometheus.Labels{
+		"route":   route,
+		"outcome": outcome,
+	}).Inc()
+}
+
+func (p *prometheusCollector) RecordBan(event string) {
+	p.bansTotal.With(prometheus.Labels{"event": event}).Inc()
+}
+
+func (p *prometheusCollector) SetActiveBans(count int) {
+	p.activeBans.Set(float64(count))
+}
+
+func (p *prometheusCollector) RecordCSPViolation(route, directive string) {
+	p.cspViolationsTotal.With(prometheus.Labels{
+		"route":     route,
+		"directive": directive,
+	}).Inc()
+}
+
+func (p *prometheusCollector) RecordWebhookVerificationFailure(scheme, reason string) {
+	p.webhookFailuresTotal.With(prometheus.Labels{
+		"scheme": scheme,
+		"reason": reason,
+	}).Inc()
+}
+
+func (p *prometheusCollector) RecordOpenAPIViolation(route, direction string) {
+	p.openAPIViolationsTotal.With(prometheus.Labels{
+		"route":     route,
+		"direction": direction,
+	}).Inc()
+}
+
+func (p *prometheusCollector) RecordRequestLimitExceeded(route, limit string) {
+	p.requestLimitsExceededTotal.With(prometheus.Labels{
+		"route": route,
+		"limit": limit,
+	}).Inc()
+}
+
+func (p *prometheusCollector) RecordStrictHTTPRejection(reason string) {
+	p.strictHTTPRejectionsTotal.With(prometheus.Labels{
+		"reason": reason,
+	}).Inc()
+}
+
+func (p *prometheusCollector) RecordCompression(route, encoding string, originalBytes, compressedBytes int64) {
+	labels := prometheus.Labels{
+		"route":    route,
+		"encoding": encoding,
+	}
+	p.compressedResponsesTotal.With(labels).Inc()
+	if saved := originalBytes - compressedBytes; saved > 0 {
+		p.compressionBytesSaved.With(labels).Add(float64(saved))
+	}
+}
+
+func (p *prometheusCollector) RecordCacheLookup(route, result string) {
+	p.cacheLookupsTotal.With(prometheus.Labels{
+		"route":  route,
+		"result": result,
+	}).Inc()
+}
+
 func (p *prometheusCollector) SetCertificateExpiry(domain string, expiry time.Time) {
 	p.certificateExpiry.With(prometheus.Labels{
 		"domain": domain,
@@ -411,3 +718,7 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
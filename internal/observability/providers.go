@@ -82,9 +82,25 @@ func (n *noopMetricsCollector) RecordBackendRequest(backend, status string, dura
 func (n *noopMetricsCollector) IncActiveConnections()                                               {}
 func (n *noopMetricsCollector) DecActiveConnections()                                               {}
 func (n *noopMetricsCollector) RecordCertificateRenewal(domain string, success bool)                {}
-func (n *noopMetricsCollector) RecordRateLimitHit(key string)                                       {}
+func (n *noopMetricsCollector) RecordRateLimitHit(policy string)                                    {}
 func (n *noopMetricsCollector) RecordHealthCheck(target string, success bool, duration time.Duration) {
 }
+func (n *noopMetricsCollector) RecordAccessDenied(route, rule string)                  {}
+func (n *noopMetricsCollector) SetConcurrencyLimit(backend string, limit int)          {}
+func (n *noopMetricsCollector) SetConcurrencyQueueDepth(backend string, depth int)     {}
+func (n *noopMetricsCollector) RecordLoadShed(backend, reason string)                  {}
+func (n *noopMetricsCollector) RecordWAFRuleMatch(route, ruleID string)                {}
+func (n *noopMetricsCollector) RecordWAFDecision(route, outcome string)                {}
+func (n *noopMetricsCollector) RecordBan(event string)                                 {}
+func (n *noopMetricsCollector) SetActiveBans(count int)                                {}
+func (n *noopMetricsCollector) RecordCSPViolation(route, directive string)             {}
+func (n *noopMetricsCollector) RecordWebhookVerificationFailure(scheme, reason string) {}
+func (n *noopMetricsCollector) RecordOpenAPIViolation(route, direction string)         {}
+func (n *noopMetricsCollector) RecordRequestLimitExceeded(route, limit string)         {}
+func (n *noopMetricsCollector) RecordStrictHTTPRejection(reason string)                {}
+func (n *noopMetricsCollector) RecordCompression(route, encoding string, originalBytes, compressedBytes int64) {
+}
+func (n *noopMetricsCollector) RecordCacheLookup(route, result string) {}
 
 // noopTracer is a placeholder tracer that does nothing.
 type noopTracer struct{}
@@ -8,9 +8,12 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/albedosehen/rwwwrse/internal/bodyfilter"
 	"github.com/albedosehen/rwwwrse/internal/config"
 	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/headers"
 	"github.com/albedosehen/rwwwrse/internal/observability"
+	"github.com/albedosehen/rwwwrse/internal/proxyproto"
 )
 
 type backend struct {
@@ -19,6 +22,9 @@ type backend struct {
 	transport http.RoundTripper
 	healthy   int64 // atomic boolean: 1 = healthy, 0 = unhealthy
 	config    config.BackendRoute
+	headers   *headers.Rules
+	rewriter  *headers.Rewriter
+	filter    *bodyfilter.Filter
 	logger    observability.Logger
 	metrics   observability.MetricsCollector
 }
@@ -71,11 +77,53 @@ func NewBackendImpl(
 		)
 	}
 
+	headerRules, err := headers.Compile(newHeaderRulesConfig(route.Headers))
+	if err != nil {
+		return nil, proxyerrors.NewConfigError(
+			proxyerrors.ErrCodeConfigInvalid,
+			"headers",
+			err,
+		)
+	}
+
+	var rewriter *headers.Rewriter
+	if route.Rewrite.Enabled {
+		rewriter, err = headers.NewRewriter(headers.RewriteConfig{
+			BackendURL:     backendURL,
+			PublicURL:      route.Rewrite.PublicURL,
+			CookieDomain:   route.Rewrite.CookieDomain,
+			CookieSecure:   route.Rewrite.CookieSecure,
+			CookieHTTPOnly: route.Rewrite.CookieHTTPOnly,
+			CookieSameSite: route.Rewrite.CookieSameSite,
+		})
+		if err != nil {
+			return nil, proxyerrors.NewConfigError(
+				proxyerrors.ErrCodeConfigInvalid,
+				"rewrite",
+				err,
+			)
+		}
+	}
+
+	var bodyFilter *bodyfilter.Filter
+	if route.BodyFilter.Enabled {
+		bodyFilter, err = bodyfilter.New(newBodyFilterConfig(route.BodyFilter))
+		if err != nil {
+			return nil, proxyerrors.NewConfigError(
+				proxyerrors.ErrCodeConfigInvalid,
+				"body_filter",
+				err,
+			)
+		}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   route.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
 	transport := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout:   route.DialTimeout,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		DialContext:           dialer.DialContext,
 		MaxIdleConns:          route.MaxIdleConns,
 		MaxIdleConnsPerHost:   route.MaxIdlePerHost,
 		IdleConnTimeout:       90 * time.Second,
@@ -85,12 +133,27 @@ func NewBackendImpl(
 		ForceAttemptHTTP2:     true,
 	}
 
+	// A PROXY protocol header describes a single client, so connections
+	// to such backends are never shared between requests.
+	if route.ProxyProtocol != "" {
+		version := proxyproto.Version2
+		if route.ProxyProtocol == "v1" {
+			version = proxyproto.Version1
+		}
+		transport.DialContext = proxyproto.Dialer(dialer.DialContext, version)
+		transport.DisableKeepAlives = true
+		transport.ForceAttemptHTTP2 = false
+	}
+
 	b := &backend{
 		name:      name,
 		url:       backendURL,
 		transport: transport,
 		healthy:   1, // Start as healthy
 		config:    route,
+		headers:   headerRules,
+		rewriter:  rewriter,
+		filter:    bodyFilter,
 		logger:    logger,
 		metrics:   metrics,
 	}
@@ -157,6 +220,35 @@ func (b *backend) GetConfig() config.BackendRoute {
 	return b.config
 }
 
+// HeaderRules returns the compiled header rules of the backend route.
+func (b *backend) HeaderRules() *headers.Rules {
+	return b.headers
+}
+
+// ResponseRewriter returns the response header rewriter of the backend
+// route, or nil when rewriting is disabled.
+func (b *backend) ResponseRewriter() *headers.Rewriter {
+	return b.rewriter
+}
+
+// BodyFilter returns the response body filter of the backend route, or nil
+// when filtering is disabled.
+func (b *backend) BodyFilter() *bodyfilter.Filter {
+	return b.filter
+}
+
+// newHeaderRulesConfig maps the header rules of a route configuration.
+func newHeaderRulesConfig(cfg config.HeaderRulesConfig) headers.Config {
+	rules := headers.Config{Presets: cfg.Presets}
+	for _, rule := range cfg.Request {
+		rules.Request = append(rules.Request, headers.Rule(rule))
+	}
+	for _, rule := range cfg.Response {
+		rules.Response = append(rules.Response, headers.Rule(rule))
+	}
+	return rules
+}
+
 func (b *backend) Close() error {
 	if transport, ok := b.transport.(*http.Transport); ok {
 		transport.CloseIdleConnections()
@@ -353,3 +445,16 @@ func (bm *backendManager) ListBackends(ctx context.Context) (map[string]Backend,
 
 	return backends, nil
 }
+
+// newBodyFilterConfig maps the body filter of a route configuration.
+func newBodyFilterConfig(cfg config.BodyFilterConfig) bodyfilter.Config {
+	filter := bodyfilter.Config{
+		ContentTypes:   cfg.ContentTypes,
+		HTMLAttributes: cfg.HTMLAttributes,
+		MaxMatchSize:   cfg.MaxMatchSize,
+	}
+	for _, sub := range cfg.Substitutions {
+		filter.Substitutions = append(filter.Substitutions, bodyfilter.Substitution(sub))
+	}
+	return filter
+}
@@ -4,12 +4,18 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"net"
 	"net/http"
 	"net/http/httputil"
+	"strconv"
 	"time"
 
+	"github.com/albedosehen/rwwwrse/internal/bodyfilter"
+	"github.com/albedosehen/rwwwrse/internal/clientip"
 	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
+	"github.com/albedosehen/rwwwrse/internal/headers"
 	"github.com/albedosehen/rwwwrse/internal/observability"
+	"github.com/albedosehen/rwwwrse/internal/proxyproto"
 )
 
 const (
@@ -24,6 +30,9 @@ const (
 
 	// HeaderForwardedHost is the header name for forwarded host
 	HeaderForwardedHost = "X-Forwarded-Host"
+
+	// HeaderRealIP is the header name for the resolved client IP address
+	HeaderRealIP = "X-Real-IP"
 )
 
 type proxyHandler struct {
@@ -86,6 +95,7 @@ func (ph *proxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		observability.String("host", r.Host),
 		observability.String("path", r.URL.Path),
 		observability.String("remote_addr", r.RemoteAddr),
+		observability.String("client_ip", clientip.FromRequest(r).IP),
 		observability.String("user_agent", r.Header.Get("User-Agent")),
 	)
 
@@ -103,11 +113,14 @@ func (ph *proxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Create reverse proxy for the backend
-	proxy := ph.createReverseProxy(backend)
+	proxy := ph.createReverseProxy(backend, headers.NewVars(r, backend.Name(), clientip.FromRequest(r).IP, requestID))
 
 	// Set up forwarded headers
 	ph.setupForwardedHeaders(r)
 
+	// Describe the client connection for backends that receive PROXY protocol
+	r = r.WithContext(proxyproto.WithOutbound(r.Context(), outboundProxyHeader(r)))
+
 	// Record metrics for backend request
 	if ph.metrics != nil {
 		defer func() {
@@ -130,22 +143,64 @@ func (ph *proxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	proxy.ServeHTTP(w, r)
 }
 
-func (ph *proxyHandler) createReverseProxy(backend Backend) *httputil.ReverseProxy {
+func (ph *proxyHandler) createReverseProxy(backend Backend, vars headers.Vars) *httputil.ReverseProxy {
 	targetURL := backend.URL()
 
+	var headerRules *headers.Rules
+	if provider, ok := backend.(HeaderRulesProvider); ok {
+		headerRules = provider.HeaderRules()
+	}
+
+	var rewriter *headers.Rewriter
+	if provider, ok := backend.(ResponseRewriterProvider); ok {
+		rewriter = provider.ResponseRewriter()
+	}
+
+	var bodyFilter *bodyfilter.Filter
+	if provider, ok := backend.(BodyFilterProvider); ok {
+		bodyFilter = provider.BodyFilter()
+	}
+
 	proxy := &httputil.ReverseProxy{
 		Rewrite: func(r *httputil.ProxyRequest) {
 			r.SetURL(targetURL)
+
+			// Only a resolved chain is forwarded; raw inbound headers
+			// from untrusted clients never reach the backend.
+			client := clientip.FromRequest(r.In)
+			if len(client.Chain) > 0 {
+				r.Out.Header.Set(HeaderForwardedFor, client.ForwardedFor())
+			}
 			r.SetXForwarded()
+			// SetXForwarded only sees the connection, not a TLS-terminating
+			// proxy in front of it.
+			if client.Scheme != "" {
+				r.Out.Header.Set(HeaderForwardedProto, client.Scheme)
+			}
+			r.Out.Header.Set(HeaderRealIP, client.IP)
 
 			// Add custom headers
 			r.Out.Header.Set("X-Forwarded-By", "rwwwrse")
+
+			// Route header rules run last so they can override the above
+			headerRules.ApplyRequest(r.Out.Header, vars)
+
+			// Bodies in codings the filter cannot decode would bypass it
+			if bodyFilter != nil {
+				bodyfilter.RestrictAcceptEncoding(r.Out.Header)
+			}
 		},
 		Transport: backend.Transport(),
 		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
 			ph.handleProxyError(w, r, backend, err)
 		},
 		ModifyResponse: func(resp *http.Response) error {
+			// Backend URLs and cookie scopes are mapped to the public
+			// URL before the route header rules run
+			rewriter.Apply(resp.Header, vars.Scheme, vars.Host)
+			headerRules.ApplyResponse(resp.Header, vars)
+			bodyFilter.Apply(resp)
+
 			// Store status code for metrics
 			resp.Header.Set("X-Status-Code", resp.Status)
 			return nil
@@ -156,19 +211,11 @@ func (ph *proxyHandler) createReverseProxy(backend Backend) *httputil.ReversePro
 }
 
 func (ph *proxyHandler) setupForwardedHeaders(r *http.Request) {
-	// Set X-Forwarded-For
-	if clientIP := r.Header.Get("X-Real-IP"); clientIP != "" {
-		r.Header.Set(HeaderForwardedFor, clientIP)
-	} else if r.RemoteAddr != "" {
-		r.Header.Set(HeaderForwardedFor, r.RemoteAddr)
-	}
+	// X-Forwarded-For is derived from the resolved client chain when the
+	// outbound request is rewritten.
 
-	// Set X-Forwarded-Proto
-	if r.TLS != nil {
-		r.Header.Set(HeaderForwardedProto, "https")
-	} else {
-		r.Header.Set(HeaderForwardedProto, "http")
-	}
+	// Set X-Forwarded-Proto from the scheme the client used
+	r.Header.Set(HeaderForwardedProto, clientip.FromRequest(r).Scheme)
 
 	// Set X-Forwarded-Host
 	if r.Host != "" {
@@ -176,6 +223,32 @@ func (ph *proxyHandler) setupForwardedHeaders(r *http.Request) {
 	}
 }
 
+// outboundProxyHeader builds the PROXY protocol header describing the
+// resolved client, forwarding any TLVs received from the load balancer. A
+// forwarded CRC32C checksum is recomputed when the header is formatted.
+func outboundProxyHeader(r *http.Request) *proxyproto.Header {
+	client := clientip.FromRequest(r)
+	sourceIP := net.ParseIP(client.IP)
+	destination, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	if sourceIP == nil || !ok {
+		return &proxyproto.Header{Command: proxyproto.CommandLocal}
+	}
+
+	// The source port is only known when the client is the peer itself.
+	source := &net.TCPAddr{IP: sourceIP}
+	if client.IP == client.Peer {
+		if _, port, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			source.Port, _ = strconv.Atoi(port)
+		}
+	}
+
+	header := proxyproto.NewProxyHeader(source, destination)
+	if inbound := proxyproto.FromContext(r.Context()); inbound != nil {
+		header.TLVs = inbound.TLVs
+	}
+	return header
+}
+
 func (ph *proxyHandler) handleProxyError(w http.ResponseWriter, r *http.Request, backend Backend, err error) {
 	requestID := r.Header.Get(HeaderRequestID)
 
@@ -213,7 +286,7 @@ func (ph *proxyHandler) handleError(w http.ResponseWriter, r *http.Request, err
 	if ph.metrics != nil {
 		status := "500"
 		if proxyErr, ok := err.(*proxyerrors.ProxyError); ok {
-			status = string(rune(proxyErr.Code.HTTPStatus()))
+			status = strconv.Itoa(proxyErrorStatus(proxyErr))
 		}
 		ph.metrics.RecordRequest(r.Method, r.Host, status, duration)
 	}
@@ -235,29 +308,17 @@ func (ph *proxyHandler) writeErrorResponse(w http.ResponseWriter, r *http.Reques
 		proxyErr = err.(*proxyerrors.ProxyError)
 	}
 
-	// Set response headers
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("X-Request-ID", r.Header.Get(HeaderRequestID))
-
-	// Write status code
-	statusCode := proxyErr.Code.HTTPStatus()
-	w.WriteHeader(statusCode)
-
-	// Write error response body
-	response := map[string]any{
-		"error":      proxyErr.Message,
-		"status":     statusCode,
-		"request_id": r.Header.Get(HeaderRequestID),
-		"timestamp":  time.Now().UTC().Format(time.RFC3339),
-	}
+	requestID := r.Header.Get(HeaderRequestID)
+	w.Header().Set(HeaderRequestID, requestID)
+	proxyerrors.WriteProblem(w, r, proxyErr, requestID)
+}
 
-	// Include error context if available
-	if len(proxyErr.Context) > 0 {
-		response["context"] = proxyErr.Context
+// proxyErrorStatus returns the HTTP status code of a proxy error.
+func proxyErrorStatus(err *proxyerrors.ProxyError) int {
+	if err.HTTPStatus != 0 {
+		return err.HTTPStatus
 	}
-
-	// Write JSON response
-	_, _ = w.Write([]byte(`{"error":"` + proxyErr.Message + `","status":` + string(rune(statusCode)) + `,"request_id":"` + r.Header.Get(HeaderRequestID) + `","timestamp":"` + time.Now().UTC().Format(time.RFC3339) + `"}`))
+	return err.Code.HTTPStatus()
 }
 
 func (ph *proxyHandler) Shutdown(ctx context.Context) error {
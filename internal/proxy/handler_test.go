@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -16,6 +17,8 @@ import (
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
 
+	"github.com/albedosehen/rwwwrse/internal/clientip"
+	"github.com/albedosehen/rwwwrse/internal/config"
 	proxyerrors "github.com/albedosehen/rwwwrse/internal/errors"
 	"github.com/albedosehen/rwwwrse/internal/observability"
 )
@@ -256,6 +259,7 @@ func TestProxyHandler_ServeHTTP_Headers(t *testing.T) {
 	tests := []struct {
 		name            string
 		requestHeaders  map[string]string
+		clientScheme    string
 		expectedHeaders map[string]string
 	}{
 		{
@@ -269,6 +273,16 @@ func TestProxyHandler_ServeHTTP_Headers(t *testing.T) {
 				"User-Agent":      "test-client/1.0",
 			},
 		},
+		{
+			name: "ServeHTTP_XForwardedProto_UsesClientScheme",
+			requestHeaders: map[string]string{
+				"X-Forwarded-Proto": "http",
+			},
+			clientScheme: "https",
+			expectedHeaders: map[string]string{
+				"X-Forwarded-Proto": "https",
+			},
+		},
 		{
 			name: "ServeHTTP_CustomHeaders_Preserved",
 			requestHeaders: map[string]string{
@@ -318,6 +332,13 @@ func TestProxyHandler_ServeHTTP_Headers(t *testing.T) {
 			for k, v := range tt.requestHeaders {
 				req.Header.Set(k, v)
 			}
+			if tt.clientScheme != "" {
+				req = req.WithContext(clientip.WithResult(req.Context(), clientip.Result{
+					IP:     "192.0.2.1",
+					Peer:   "192.0.2.1",
+					Scheme: tt.clientScheme,
+				}))
+			}
 
 			rr := httptest.NewRecorder()
 
@@ -341,6 +362,153 @@ func TestProxyHandler_ServeHTTP_Headers(t *testing.T) {
 	}
 }
 
+func TestProxyHandler_ServeHTTP_HeaderRules(t *testing.T) {
+	// Arrange
+	var receivedHeaders http.Header
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		receivedHeaders = r.Header.Clone()
+		w.Header().Set("Server", "nginx/1.25")
+		w.Header().Set("X-Powered-By", "Express")
+		w.Header().Set("X-Backend-User", "alice")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	logger := observability.NewLogger(observability.LoggingConfig{Level: observability.LevelError, Output: "stderr"})
+	backend, err := NewBackendImpl("api", config.BackendRoute{
+		URL:         testServer.URL,
+		Timeout:     5 * time.Second,
+		DialTimeout: 5 * time.Second,
+		Headers: config.HeaderRulesConfig{
+			Presets: []string{"hide_backend", "strip_internal"},
+			Request: []config.HeaderRuleConfig{
+				{Action: "set", Name: "X-Client", Value: "{client_ip} {route} {request_id}"},
+				{Action: "remove", Name: "X-Forwarded-By"},
+			},
+			Response: []config.HeaderRuleConfig{
+				{Action: "rename", Name: "X-Backend-User", To: "X-User"},
+				{Action: "set", Name: "X-Served-By", Value: "{host}", IfPresent: "X-User"},
+			},
+		},
+	}, logger, nil)
+	require.NoError(t, err)
+
+	mockRouter := &mockRouter{}
+	mockRouter.On("Route", mock.Anything, "api.example.com").Return(backend, nil)
+
+	handler, err := NewProxyHandlerImpl(mockRouter, logger, nil)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "http://api.example.com/test", nil)
+	req.RemoteAddr = "192.0.2.10:4321"
+	req.Header.Set(HeaderRequestID, "req-42")
+	req.Header.Set("X-Internal-Role", "admin")
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rr, req)
+
+	// Assert
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "192.0.2.10 api req-42", receivedHeaders.Get("X-Client"))
+	assert.Empty(t, receivedHeaders.Get("X-Forwarded-By"))
+	assert.Empty(t, receivedHeaders.Get("X-Internal-Role"))
+	assert.Empty(t, rr.Header().Get("Server"))
+	assert.Empty(t, rr.Header().Get("X-Powered-By"))
+	assert.Empty(t, rr.Header().Get("X-Backend-User"))
+	assert.Equal(t, "alice", rr.Header().Get("X-User"))
+	assert.Equal(t, "api.example.com", rr.Header().Get("X-Served-By"))
+}
+
+func TestProxyHandler_ServeHTTP_ResponseRewrite(t *testing.T) {
+	// Arrange
+	var backendURL string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", backendURL+"/app/login")
+		w.Header().Add("Set-Cookie", "sid=abc; Path=/app; Domain=127.0.0.1")
+		w.WriteHeader(http.StatusFound)
+	}))
+	defer testServer.Close()
+	backendURL = testServer.URL
+
+	logger := observability.NewLogger(observability.LoggingConfig{Level: observability.LevelError, Output: "stderr"})
+	backend, err := NewBackendImpl("api", config.BackendRoute{
+		URL:         testServer.URL + "/app",
+		Timeout:     5 * time.Second,
+		DialTimeout: 5 * time.Second,
+		Rewrite: config.RewriteConfig{
+			Enabled:        true,
+			CookieSecure:   true,
+			CookieHTTPOnly: true,
+		},
+	}, logger, nil)
+	require.NoError(t, err)
+
+	mockRouter := &mockRouter{}
+	mockRouter.On("Route", mock.Anything, "api.example.com").Return(backend, nil)
+
+	handler, err := NewProxyHandlerImpl(mockRouter, logger, nil)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "http://api.example.com/", nil)
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rr, req)
+
+	// Assert
+	require.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "http://api.example.com/login", rr.Header().Get("Location"))
+	assert.Equal(t, "sid=abc; Path=/; Secure; HttpOnly", rr.Header().Get("Set-Cookie"))
+}
+
+func TestProxyHandler_ServeHTTP_BodyFilter(t *testing.T) {
+	// Arrange
+	var acceptEncoding string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		body := `<a href="http://10.0.0.5:3000/docs">http://10.0.0.5:3000/</a>`
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write([]byte(body))
+	}))
+	defer testServer.Close()
+
+	logger := observability.NewLogger(observability.LoggingConfig{Level: observability.LevelError, Output: "stderr"})
+	backend, err := NewBackendImpl("api", config.BackendRoute{
+		URL:         testServer.URL,
+		Timeout:     5 * time.Second,
+		DialTimeout: 5 * time.Second,
+		BodyFilter: config.BodyFilterConfig{
+			Enabled: true,
+			Substitutions: []config.BodyFilterSubstitution{
+				{Pattern: "http://10.0.0.5:3000/", Replacement: "/wiki/"},
+			},
+			HTMLAttributes: true,
+		},
+	}, logger, nil)
+	require.NoError(t, err)
+
+	mockRouter := &mockRouter{}
+	mockRouter.On("Route", mock.Anything, "api.example.com").Return(backend, nil)
+
+	handler, err := NewProxyHandlerImpl(mockRouter, logger, nil)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "http://api.example.com/", nil)
+	req.Header.Set("Accept-Encoding", "br, deflate, gzip")
+	rr := httptest.NewRecorder()
+
+	// Act
+	handler.ServeHTTP(rr, req)
+
+	// Assert
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "br, gzip", acceptEncoding)
+	assert.Empty(t, rr.Header().Get("Content-Length"))
+	assert.Equal(t, `<a href="/wiki/docs">http://10.0.0.5:3000/</a>`, rr.Body.String())
+}
+
 // Mock types for handler tests
 type mockHandlerLogger struct {
 	mock.Mock
@@ -424,6 +592,66 @@ func (m *mockHandlerMetrics) RecordHealthCheck(target string, success bool, dura
 	m.Called(target, success, duration)
 }
 
+func (m *mockHandlerMetrics) RecordAccessDenied(route, rule string) {
+	m.Called(route, rule)
+}
+
+func (m *mockHandlerMetrics) SetConcurrencyLimit(backend string, limit int) {
+	m.Called(backend, limit)
+}
+
+func (m *mockHandlerMetrics) SetConcurrencyQueueDepth(backend string, depth int) {
+	m.Called(backend, depth)
+}
+
+func (m *mockHandlerMetrics) RecordLoadShed(backend, reason string) {
+	m.Called(backend, reason)
+}
+
+func (m *mockHandlerMetrics) RecordWAFRuleMatch(route, ruleID string) {
+	m.Called(route, ruleID)
+}
+
+func (m *mockHandlerMetrics) RecordWAFDecision(route, outcome string) {
+	m.Called(route, outcome)
+}
+
+func (m *mockHandlerMetrics) RecordBan(event string) {
+	m.Called(event)
+}
+
+func (m *mockHandlerMetrics) SetActiveBans(count int) {
+	m.Called(count)
+}
+
+func (m *mockHandlerMetrics) RecordCSPViolation(route, directive string) {
+	m.Called(route, directive)
+}
+
+func (m *mockHandlerMetrics) RecordWebhookVerificationFailure(scheme, reason string) {
+	m.Called(scheme, reason)
+}
+
+func (m *mockHandlerMetrics) RecordOpenAPIViolation(route, direction string) {
+	m.Called(route, direction)
+}
+
+func (m *mockHandlerMetrics) RecordRequestLimitExceeded(route, limit string) {
+	m.Called(route, limit)
+}
+
+func (m *mockHandlerMetrics) RecordStrictHTTPRejection(reason string) {
+	m.Called(reason)
+}
+
+func (m *mockHandlerMetrics) RecordCompression(route, encoding string, originalBytes, compressedBytes int64) {
+	m.Called(route, encoding, originalBytes, compressedBytes)
+}
+
+func (m *mockHandlerMetrics) RecordCacheLookup(route, result string) {
+	m.Called(route, result)
+}
+
 // Benchmark tests for handler operations
 func BenchmarkProxyHandler_ServeHTTP(b *testing.B) {
 	// Setup
@@ -4,6 +4,9 @@ import (
 	"context"
 	"net/http"
 	"net/url"
+
+	"github.com/albedosehen/rwwwrse/internal/bodyfilter"
+	"github.com/albedosehen/rwwwrse/internal/headers"
 )
 
 // Router defines request routing based on host header.
@@ -44,6 +47,28 @@ type Backend interface {
 	Name() string
 }
 
+// HeaderRulesProvider is implemented by backends with header manipulation
+// rules. The proxy applies them to the outbound request and the backend
+// response.
+type HeaderRulesProvider interface {
+	// HeaderRules returns the compiled header rules of the backend route.
+	HeaderRules() *headers.Rules
+}
+
+// ResponseRewriterProvider is implemented by backends that rewrite backend
+// URLs and cookie scopes in response headers.
+type ResponseRewriterProvider interface {
+	// ResponseRewriter returns the response header rewriter of the backend route.
+	ResponseRewriter() *headers.Rewriter
+}
+
+// BodyFilterProvider is implemented by backends that filter response
+// bodies.
+type BodyFilterProvider interface {
+	// BodyFilter returns the response body filter of the backend route.
+	BodyFilter() *bodyfilter.Filter
+}
+
 // ProxyHandler handles the core HTTP proxying logic.
 // It processes incoming requests and forwards them to appropriate backends.
 type ProxyHandler interface {
@@ -525,6 +525,66 @@ func (m *mockMetricsCollector) RecordHealthCheck(target string, success bool, du
 	m.Called(target, success, duration)
 }
 
+func (m *mockMetricsCollector) RecordAccessDenied(route, rule string) {
+	m.Called(route, rule)
+}
+
+func (m *mockMetricsCollector) SetConcurrencyLimit(backend string, limit int) {
+	m.Called(backend, limit)
+}
+
+func (m *mockMetricsCollector) SetConcurrencyQueueDepth(backend string, depth int) {
+	m.Called(backend, depth)
+}
+
+func (m *mockMetricsCollector) RecordLoadShed(backend, reason string) {
+	m.Called(backend, reason)
+}
+
+func (m *mockMetricsCollector) RecordWAFRuleMatch(route, ruleID string) {
+	m.Called(route, ruleID)
+}
+
+func (m *mockMetricsCollector) RecordWAFDecision(route, outcome string) {
+	m.Called(route, outcome)
+}
+
+func (m *mockMetricsCollector) RecordBan(event string) {
+	m.Called(event)
+}
+
+func (m *mockMetricsCollector) SetActiveBans(count int) {
+	m.Called(count)
+}
+
+func (m *mockMetricsCollector) RecordCSPViolation(route, directive string) {
+	m.Called(route, directive)
+}
+
+func (m *mockMetricsCollector) RecordWebhookVerificationFailure(scheme, reason string) {
+	m.Called(scheme, reason)
+}
+
+func (m *mockMetricsCollector) RecordOpenAPIViolation(route, direction string) {
+	m.Called(route, direction)
+}
+
+func (m *mockMetricsCollector) RecordRequestLimitExceeded(route, limit string) {
+	m.Called(route, limit)
+}
+
+func (m *mockMetricsCollector) RecordStrictHTTPRejection(reason string) {
+	m.Called(reason)
+}
+
+func (m *mockMetricsCollector) RecordCompression(route, encoding string, originalBytes, compressedBytes int64) {
+	m.Called(route, encoding, originalBytes, compressedBytes)
+}
+
+func (m *mockMetricsCollector) RecordCacheLookup(route, result string) {
+	m.Called(route, result)
+}
+
 // Benchmark tests for connection pool operations
 func BenchmarkConnectionPool_GetConnection(b *testing.B) {
 	// Setup
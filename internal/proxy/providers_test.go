@@ -419,6 +419,66 @@ func (m *mockProvidersMetrics) RecordHealthCheck(target string, success bool, du
 	m.Called(target, success, duration)
 }
 
+func (m *mockProvidersMetrics) RecordAccessDenied(route, rule string) {
+	m.Called(route, rule)
+}
+
+func (m *mockProvidersMetrics) SetConcurrencyLimit(backend string, limit int) {
+	m.Called(backend, limit)
+}
+
+func (m *mockProvidersMetrics) SetConcurrencyQueueDepth(backend string, depth int) {
+	m.Called(backend, depth)
+}
+
+func (m *mockProvidersMetrics) RecordLoadShed(backend, reason string) {
+	m.Called(backend, reason)
+}
+
+func (m *mockProvidersMetrics) RecordWAFRuleMatch(route, ruleID string) {
+	m.Called(route, ruleID)
+}
+
+func (m *mockProvidersMetrics) RecordWAFDecision(route, outcome string) {
+	m.Called(route, outcome)
+}
+
+func (m *mockProvidersMetrics) RecordBan(event string) {
+	m.Called(event)
+}
+
+func (m *mockProvidersMetrics) SetActiveBans(count int) {
+	m.Called(count)
+}
+
+func (m *mockProvidersMetrics) RecordCSPViolation(route, directive string) {
+	m.Called(route, directive)
+}
+
+func (m *mockProvidersMetrics) RecordWebhookVerificationFailure(scheme, reason string) {
+	m.Called(scheme, reason)
+}
+
+func (m *mockProvidersMetrics) RecordOpenAPIViolation(route, direction string) {
+	m.Called(route, direction)
+}
+
+func (m *mockProvidersMetrics) RecordRequestLimitExceeded(route, limit string) {
+	m.Called(route, limit)
+}
+
+func (m *mockProvidersMetrics) RecordStrictHTTPRejection(reason string) {
+	m.Called(reason)
+}
+
+func (m *mockProvidersMetrics) RecordCompression(route, encoding string, originalBytes, compressedBytes int64) {
+	m.Called(route, encoding, originalBytes, compressedBytes)
+}
+
+func (m *mockProvidersMetrics) RecordCacheLookup(route, result string) {
+	m.Called(route, result)
+}
+
 // Benchmark tests for providers
 func BenchmarkProvideRouter(b *testing.B) {
 	// Setup
@@ -99,6 +99,66 @@ func (m *mockRouterMetrics) RecordRateLimitHit(key string) {
 	m.Called(key)
 }
 
+func (m *mockRouterMetrics) RecordAccessDenied(route, rule string) {
+	m.Called(route, rule)
+}
+
+func (m *mockRouterMetrics) SetConcurrencyLimit(backend string, limit int) {
+	m.Called(backend, limit)
+}
+
+func (m *mockRouterMetrics) SetConcurrencyQueueDepth(backend string, depth int) {
+	m.Called(backend, depth)
+}
+
+func (m *mockRouterMetrics) RecordLoadShed(backend, reason string) {
+	m.Called(backend, reason)
+}
+
+func (m *mockRouterMetrics) RecordWAFRuleMatch(route, ruleID string) {
+	m.Called(route, ruleID)
+}
+
+func (m *mockRouterMetrics) RecordWAFDecision(route, outcome string) {
+	m.Called(route, outcome)
+}
+
+func (m *mockRouterMetrics) RecordBan(event string) {
+	m.Called(event)
+}
+
+func (m *mockRouterMetrics) SetActiveBans(count int) {
+	m.Called(count)
+}
+
+func (m *mockRouterMetrics) RecordCSPViolation(route, directive string) {
+	m.Called(route, directive)
+}
+
+func (m *mockRouterMetrics) RecordWebhookVerificationFailure(scheme, reason string) {
+	m.Called(scheme, reason)
+}
+
+func (m *mockRouterMetrics) RecordOpenAPIViolation(route, direction string) {
+	m.Called(route, direction)
+}
+
+func (m *mockRouterMetrics) RecordRequestLimitExceeded(route, limit string) {
+	m.Called(route, limit)
+}
+
+func (m *mockRouterMetrics) RecordStrictHTTPRejection(reason string) {
+	m.Called(reason)
+}
+
+func (m *mockRouterMetrics) RecordCompression(route, encoding string, originalBytes, compressedBytes int64) {
+	m.Called(route, encoding, originalBytes, compressedBytes)
+}
+
+func (m *mockRouterMetrics) RecordCacheLookup(route, result string) {
+	m.Called(route, result)
+}
+
 func TestNewRouterImpl(t *testing.T) {
 	tests := []struct {
 		name           string
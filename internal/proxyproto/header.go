@@ -0,0 +1,469 @@
+// Package proxyproto implements the HAProxy PROXY protocol, versions 1 and 2,
+// for accepting client addresses from load balancers and sending them to
+// backends.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Protocol versions.
+const (
+	Version1 = 1
+	Version2 = 2
+)
+
+// Commands carried by a version 2 header.
+const (
+	CommandLocal = 0x0
+	CommandProxy = 0x1
+)
+
+// Type-length-value types defined by the specification and cloud providers.
+const (
+	TLVTypeALPN      = 0x01
+	TLVTypeAuthority = 0x02
+	TLVTypeCRC32C    = 0x03
+	TLVTypeNoop      = 0x04
+	TLVTypeUniqueID  = 0x05
+	TLVTypeSSL       = 0x20
+	TLVTypeNetNS     = 0x30
+	TLVTypeAWS       = 0xEA
+	TLVTypeAzure     = 0xEE
+	TLVTypeGCP       = 0xE0
+)
+
+// Sub-types of the SSL TLV.
+const (
+	tlvSubtypeSSLVersion = 0x21
+	tlvSubtypeSSLCN      = 0x22
+	tlvSubtypeSSLCipher  = 0x23
+	tlvSubtypeSSLSigAlg  = 0x24
+	tlvSubtypeSSLKeyAlg  = 0x25
+)
+
+// Sub-types of the AWS TLV.
+const tlvSubtypeAWSVPCEndpointID = 0x01
+
+// Wire format constants.
+const (
+	// v1Prefix starts every version 1 header.
+	v1Prefix = "PROXY "
+
+	// v1MaxLength is the longest valid version 1 header including CRLF.
+	v1MaxLength = 107
+
+	// v2HeaderLength is the fixed part of a version 2 header.
+	v2HeaderLength = 16
+
+	// sslClientSSL is the client flag set when the client connected over TLS.
+	sslClientSSL = 0x01
+)
+
+// v2Signature starts every version 2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// TLV is a version 2 type-length-value extension.
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// SSLInfo describes the TLS session between the client and the load balancer.
+type SSLInfo struct {
+	// ClientSSL reports whether the client connected over TLS.
+	ClientSSL bool
+
+	// Verified reports whether the client presented a verified certificate.
+	Verified bool
+
+	Version            string
+	CommonName         string
+	Cipher             string
+	SignatureAlgorithm string
+	KeyAlgorithm       string
+}
+
+// Header is a decoded PROXY protocol header.
+type Header struct {
+	// Version is 1 or 2.
+	Version int
+
+	// Command is CommandProxy, or CommandLocal for connections the load
+	// balancer originated itself, such as health checks.
+	Command int
+
+	// Source and Destination are the original connection endpoints.
+	// They are nil for LOCAL and UNKNOWN headers.
+	Source      net.Addr
+	Destination net.Addr
+
+	// TLVs lists version 2 extensions in the order received.
+	TLVs []TLV
+}
+
+// NewProxyHeader returns a header describing a proxied connection.
+func NewProxyHeader(source, destination net.Addr) *Header {
+	return &Header{
+		Version:     Version2,
+		Command:     CommandProxy,
+		Source:      source,
+		Destination: destination,
+	}
+}
+
+// TLV returns the value of the first TLV of type t.
+func (h *Header) TLV(t byte) ([]byte, bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == t {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// ALPN returns the application protocol negotiated by the load balancer.
+func (h *Header) ALPN() string {
+	value, _ := h.TLV(TLVTypeALPN)
+	return string(value)
+}
+
+// Authority returns the TLS server name sent by the client.
+func (h *Header) Authority() string {
+	value, _ := h.TLV(TLVTypeAuthority)
+	return string(value)
+}
+
+// UniqueID returns the connection identifier assigned by the load balancer.
+func (h *Header) UniqueID() string {
+	value, _ := h.TLV(TLVTypeUniqueID)
+	return string(value)
+}
+
+// AWSVPCEndpointID returns the VPC endpoint ID added by AWS PrivateLink.
+func (h *Header) AWSVPCEndpointID() string {
+	value, ok := h.TLV(TLVTypeAWS)
+	if !ok || len(value) < 1 || value[0] != tlvSubtypeAWSVPCEndpointID {
+		return ""
+	}
+	return string(value[1:])
+}
+
+// SSL returns the TLS details reported by the load balancer, or nil.
+func (h *Header) SSL() *SSLInfo {
+	value, ok := h.TLV(TLVTypeSSL)
+	if !ok || len(value) < 5 {
+		return nil
+	}
+
+	info := &SSLInfo{
+		ClientSSL: value[0]&sslClientSSL != 0,
+		Verified:  binary.BigEndian.Uint32(value[1:5]) == 0,
+	}
+
+	subTLVs, err := parseTLVs(value[5:])
+	if err != nil {
+		return info
+	}
+
+	for _, tlv := range subTLVs {
+		switch tlv.Type {
+		case tlvSubtypeSSLVersion:
+			info.Version = string(tlv.Value)
+		case tlvSubtypeSSLCN:
+			info.CommonName = string(tlv.Value)
+		case tlvSubtypeSSLCipher:
+			info.Cipher = string(tlv.Value)
+		case tlvSubtypeSSLSigAlg:
+			info.SignatureAlgorithm = string(tlv.Value)
+		case tlvSubtypeSSLKeyAlg:
+			info.KeyAlgorithm = string(tlv.Value)
+		}
+	}
+
+	return info
+}
+
+// Format encodes the header in the given protocol version.
+func (h *Header) Format(version int) ([]byte, error) {
+	switch version {
+	case Version1:
+		return h.formatV1(), nil
+	case Version2:
+		return h.formatV2()
+	default:
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+}
+
+// formatV1 encodes a version 1 header. Endpoints that are not TCP addresses
+// are sent as UNKNOWN.
+func (h *Header) formatV1() []byte {
+	source, sourceOK := h.Source.(*net.TCPAddr)
+	destination, destinationOK := h.Destination.(*net.TCPAddr)
+	if h.Command != CommandProxy || !sourceOK || !destinationOK {
+		return []byte("PROXY UNKNOWN\r\n")
+	}
+
+	if source.IP.To4() != nil && destination.IP.To4() != nil {
+		return []byte(fmt.Sprintf("PROXY TCP4 %s %s %d %d\r\n",
+			source.IP.To4(), destination.IP.To4(), source.Port, destination.Port))
+	}
+
+	return []byte(fmt.Sprintf("PROXY TCP6 %s %s %d %d\r\n",
+		formatIPv6(source.IP), formatIPv6(destination.IP), source.Port, destination.Port))
+}
+
+// formatIPv6 renders ip in IPv6 notation, mapping IPv4 addresses into ::ffff:0:0/96.
+func formatIPv6(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
+	return ip.String()
+}
+
+// crc32cTable is the Castagnoli table used by the CRC32C TLV.
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// formatV2 encodes a version 2 header including its TLVs. A CRC32C TLV is
+// recomputed over the encoded header, since a forwarded one describes
+// different addresses.
+func (h *Header) formatV2() ([]byte, error) {
+	var buffer bytes.Buffer
+	buffer.Write(v2Signature)
+
+	var addresses []byte
+	family := byte(0x00)
+	command := byte(CommandLocal)
+
+	source, sourceOK := h.Source.(*net.TCPAddr)
+	destination, destinationOK := h.Destination.(*net.TCPAddr)
+	if h.Command == CommandProxy && sourceOK && destinationOK {
+		command = CommandProxy
+		sourceIP, destinationIP := source.IP.To4(), destination.IP.To4()
+		family = 0x11 // AF_INET, STREAM
+		if sourceIP == nil || destinationIP == nil {
+			family = 0x21 // AF_INET6, STREAM
+			sourceIP, destinationIP = source.IP.To16(), destination.IP.To16()
+		}
+		addresses = append(addresses, sourceIP...)
+		addresses = append(addresses, destinationIP...)
+		addresses = binary.BigEndian.AppendUint16(addresses, uint16(source.Port))
+		addresses = binary.BigEndian.AppendUint16(addresses, uint16(destination.Port))
+	}
+
+	checksumAt := -1
+	for _, tlv := range h.TLVs {
+		value := tlv.Value
+		if tlv.Type == TLVTypeCRC32C {
+			if checksumAt >= 0 {
+				continue
+			}
+			value = make([]byte, 4)
+		}
+		if len(value) > 0xFFFF {
+			return nil, fmt.Errorf("%w: TLV 0x%02x too long", ErrInvalidHeader, tlv.Type)
+		}
+		addresses = append(addresses, tlv.Type)
+		addresses = binary.BigEndian.AppendUint16(addresses, uint16(len(value)))
+		if tlv.Type == TLVTypeCRC32C {
+			checksumAt = len(addresses)
+		}
+		addresses = append(addresses, value...)
+	}
+
+	if len(addresses) > 0xFFFF {
+		return nil, fmt.Errorf("%w: header too long", ErrInvalidHeader)
+	}
+
+	buffer.WriteByte(0x20 | command)
+	buffer.WriteByte(family)
+	_ = binary.Write(&buffer, binary.BigEndian, uint16(len(addresses)))
+	buffer.Write(addresses)
+
+	encoded := buffer.Bytes()
+	if checksumAt >= 0 {
+		// The checksum covers the whole header with its own value zeroed.
+		checksumAt += v2HeaderLength
+		binary.BigEndian.PutUint32(encoded[checksumAt:], crc32.Checksum(encoded, crc32cTable))
+	}
+
+	return encoded, nil
+}
+
+// ReadHeader reads a PROXY protocol header from reader. It returns nil
+// without consuming input when the stream does not start with a header.
+func ReadHeader(reader *bufio.Reader) (*Header, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	switch first[0] {
+	case v1Prefix[0]:
+		prefix, err := reader.Peek(len(v1Prefix))
+		if err != nil || string(prefix) != v1Prefix {
+			return nil, nil
+		}
+		return readV1(reader)
+	case v2Signature[0]:
+		signature, err := reader.Peek(len(v2Signature))
+		if err != nil || !bytes.Equal(signature, v2Signature) {
+			return nil, nil
+		}
+		return readV2(reader)
+	default:
+		return nil, nil
+	}
+}
+
+// readV1 reads a version 1 text header.
+func readV1(reader *bufio.Reader) (*Header, error) {
+	line := make([]byte, 0, v1MaxLength)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= v1MaxLength {
+			return nil, fmt.Errorf("%w: v1 header too long", ErrInvalidHeader)
+		}
+	}
+
+	text, found := strings.CutSuffix(string(line), "\r\n")
+	if !found {
+		return nil, fmt.Errorf("%w: v1 header not terminated by CRLF", ErrInvalidHeader)
+	}
+
+	fields := strings.Split(text, " ")
+	header := &Header{Version: Version1, Command: CommandProxy}
+
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		header.Command = CommandLocal
+		return header, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: malformed v1 header", ErrInvalidHeader)
+	}
+
+	sourceIP, destinationIP := net.ParseIP(fields[2]), net.ParseIP(fields[3])
+	if sourceIP == nil || destinationIP == nil ||
+		(fields[1] == "TCP4" && (sourceIP.To4() == nil || destinationIP.To4() == nil)) {
+		return nil, fmt.Errorf("%w: invalid v1 address", ErrInvalidHeader)
+	}
+
+	sourcePort, err := parsePort(fields[4])
+	if err != nil {
+		return nil, err
+	}
+	destinationPort, err := parsePort(fields[5])
+	if err != nil {
+		return nil, err
+	}
+
+	header.Source = &net.TCPAddr{IP: sourceIP, Port: sourcePort}
+	header.Destination = &net.TCPAddr{IP: destinationIP, Port: destinationPort}
+	return header, nil
+}
+
+// readV2 reads a version 2 binary header.
+func readV2(reader *bufio.Reader) (*Header, error) {
+	fixed := make([]byte, v2HeaderLength)
+	if _, err := io.ReadFull(reader, fixed); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+
+	if fixed[12]>>4 != Version2 {
+		return nil, fmt.Errorf("%w: v2 version %d", ErrUnsupportedVersion, fixed[12]>>4)
+	}
+
+	header := &Header{Version: Version2, Command: int(fixed[12] & 0x0F)}
+	if header.Command != CommandLocal && header.Command != CommandProxy {
+		return nil, fmt.Errorf("%w: v2 command %d", ErrInvalidHeader, header.Command)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidHeader, err)
+	}
+
+	family, transport := fixed[13]>>4, fixed[13]&0x0F
+	addressLength := 0
+	switch family {
+	case 0x1:
+		addressLength = 12
+	case 0x2:
+		addressLength = 36
+	case 0x3:
+		addressLength = 216
+	}
+	if len(payload) < addressLength {
+		return nil, fmt.Errorf("%w: v2 address block truncated", ErrInvalidHeader)
+	}
+
+	if header.Command == CommandProxy && transport == 0x1 {
+		switch family {
+		case 0x1:
+			header.Source = &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+			header.Destination = &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+		case 0x2:
+			header.Source = &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+			header.Destination = &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+		}
+	}
+
+	tlvs, err := parseTLVs(payload[addressLength:])
+	if err != nil {
+		return nil, err
+	}
+	header.TLVs = tlvs
+
+	return header, nil
+}
+
+// parseTLVs decodes a sequence of type-length-value entries.
+func parseTLVs(data []byte) ([]TLV, error) {
+	var tlvs []TLV
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return nil, fmt.Errorf("%w: truncated TLV", ErrInvalidHeader)
+		}
+		length := int(binary.BigEndian.Uint16(data[1:3]))
+		if len(data) < 3+length {
+			return nil, fmt.Errorf("%w: TLV 0x%02x exceeds header", ErrInvalidHeader, data[0])
+		}
+		if data[0] != TLVTypeNoop {
+			tlvs = append(tlvs, TLV{Type: data[0], Value: append([]byte(nil), data[3:3+length]...)})
+		}
+		data = data[3+length:]
+	}
+	return tlvs, nil
+}
+
+// parsePort parses a decimal TCP port.
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 0 || port > 65535 || (len(value) > 1 && value[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid v1 port %q", ErrInvalidHeader, value)
+	}
+	return port, nil
+}
+
+// PROXY protocol errors.
+var (
+	ErrInvalidHeader      = fmt.Errorf("invalid PROXY protocol header")
+	ErrUnsupportedVersion = fmt.Errorf("unsupported PROXY protocol version")
+)
@@ -0,0 +1,265 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// v2Header builds a version 2 PROXY header for an IPv4 connection with TLVs.
+func v2Header(t *testing.T, tlvs ...TLV) []byte {
+	t.Helper()
+
+	header := NewProxyHeader(
+		&net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51000},
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 443},
+	)
+	header.TLVs = tlvs
+
+	data, err := header.Format(Version2)
+	require.NoError(t, err)
+	return data
+}
+
+// sslTLV builds an SSL TLV reporting a TLS client session.
+func sslTLV(version, cipher string) TLV {
+	value := []byte{sslClientSSL, 0, 0, 0, 0}
+	for _, sub := range []TLV{{Type: tlvSubtypeSSLVersion, Value: []byte(version)}, {Type: tlvSubtypeSSLCipher, Value: []byte(cipher)}} {
+		value = append(value, sub.Type)
+		value = binary.BigEndian.AppendUint16(value, uint16(len(sub.Value)))
+		value = append(value, sub.Value...)
+	}
+	return TLV{Type: TLVTypeSSL, Value: value}
+}
+
+func TestReadHeader(t *testing.T) {
+	tests := []struct {
+		name                string
+		input               []byte
+		expectedVersion     int
+		expectedSource      string
+		expectedDestination string
+		expectedRemainder   string
+		expectedErr         error
+	}{
+		{
+			name:                "ReadHeader_V1TCP4_ParsesAddresses",
+			input:               []byte("PROXY TCP4 203.0.113.7 10.0.0.5 51000 443\r\nGET / HTTP/1.1\r\n"),
+			expectedVersion:     Version1,
+			expectedSource:      "203.0.113.7:51000",
+			expectedDestination: "10.0.0.5:443",
+			expectedRemainder:   "GET / HTTP/1.1\r\n",
+		},
+		{
+			name:                "ReadHeader_V1TCP6_ParsesAddresses",
+			input:               []byte("PROXY TCP6 2001:db8::1 2001:db8::2 51000 443\r\n"),
+			expectedVersion:     Version1,
+			expectedSource:      "[2001:db8::1]:51000",
+			expectedDestination: "[2001:db8::2]:443",
+		},
+		{
+			name:              "ReadHeader_V1Unknown_NoAddresses",
+			input:             []byte("PROXY UNKNOWN\r\nGET"),
+			expectedVersion:   Version1,
+			expectedRemainder: "GET",
+		},
+		{
+			name:                "ReadHeader_V2_ParsesAddresses",
+			input:               append(v2Header(t), "GET"...),
+			expectedVersion:     Version2,
+			expectedSource:      "203.0.113.7:51000",
+			expectedDestination: "10.0.0.5:443",
+			expectedRemainder:   "GET",
+		},
+		{
+			name:              "ReadHeader_PlainHTTP_NoHeader",
+			input:             []byte("POST / HTTP/1.1\r\n"),
+			expectedRemainder: "POST / HTTP/1.1\r\n",
+		},
+		{
+			name:        "ReadHeader_V1Malformed_ReturnsError",
+			input:       []byte("PROXY TCP4 203.0.113.7\r\n"),
+			expectedErr: ErrInvalidHeader,
+		},
+		{
+			name:        "ReadHeader_V1AddressFamilyMismatch_ReturnsError",
+			input:       []byte("PROXY TCP4 2001:db8::1 10.0.0.5 51000 443\r\n"),
+			expectedErr: ErrInvalidHeader,
+		},
+		{
+			name:        "ReadHeader_V1Unterminated_ReturnsError",
+			input:       []byte("PROXY TCP4 " + strings.Repeat("1", 120)),
+			expectedErr: ErrInvalidHeader,
+		},
+		{
+			name:        "ReadHeader_V2Truncated_ReturnsError",
+			input:       v2Header(t)[:20],
+			expectedErr: ErrInvalidHeader,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			reader := bufio.NewReader(bytes.NewReader(tt.input))
+
+			// Act
+			header, err := ReadHeader(reader)
+
+			// Assert
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.expectedVersion == 0 {
+				assert.Nil(t, header)
+			} else {
+				require.NotNil(t, header)
+				assert.Equal(t, tt.expectedVersion, header.Version)
+				if tt.expectedSource != "" {
+					assert.Equal(t, tt.expectedSource, header.Source.String())
+					assert.Equal(t, tt.expectedDestination, header.Destination.String())
+				} else {
+					assert.Nil(t, header.Source)
+				}
+			}
+
+			remainder, _ := reader.Peek(reader.Buffered())
+			assert.Equal(t, tt.expectedRemainder, string(remainder))
+		})
+	}
+}
+
+func TestHeader_TLVs(t *testing.T) {
+	// Arrange
+	vpce := append([]byte{tlvSubtypeAWSVPCEndpointID}, "vpce-0123456789abcdef0"...)
+	data := v2Header(t,
+		TLV{Type: TLVTypeAWS, Value: vpce},
+		TLV{Type: TLVTypeAuthority, Value: []byte("app.example.com")},
+		sslTLV("TLSv1.3", "TLS_AES_128_GCM_SHA256"),
+	)
+
+	// Act
+	header, err := ReadHeader(bufio.NewReader(bytes.NewReader(data)))
+
+	// Assert
+	require.NoError(t, err)
+	require.NotNil(t, header)
+	assert.Equal(t, "vpce-0123456789abcdef0", header.AWSVPCEndpointID())
+	assert.Equal(t, "app.example.com", header.Authority())
+
+	ssl := header.SSL()
+	require.NotNil(t, ssl)
+	assert.True(t, ssl.ClientSSL)
+	assert.Equal(t, "TLSv1.3", ssl.Version)
+	assert.Equal(t, "TLS_AES_128_GCM_SHA256", ssl.Cipher)
+}
+
+func TestHeader_Format(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   *Header
+		version  int
+		expected string
+	}{
+		{
+			name: "Format_V1IPv4_TextHeader",
+			header: NewProxyHeader(
+				&net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51000},
+				&net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 443},
+			),
+			version:  Version1,
+			expected: "PROXY TCP4 203.0.113.7 10.0.0.5 51000 443\r\n",
+		},
+		{
+			name: "Format_V1MixedFamilies_UsesTCP6",
+			header: NewProxyHeader(
+				&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51000},
+				&net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 443},
+			),
+			version:  Version1,
+			expected: "PROXY TCP6 2001:db8::1 ::ffff:10.0.0.5 51000 443\r\n",
+		},
+		{
+			name:     "Format_V1Local_Unknown",
+			header:   &Header{Command: CommandLocal},
+			version:  Version1,
+			expected: "PROXY UNKNOWN\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			data, err := tt.header.Format(tt.version)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, string(data))
+		})
+	}
+}
+
+func TestHeader_FormatV2RoundTrip(t *testing.T) {
+	// Arrange
+	original := NewProxyHeader(
+		&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 51000},
+		&net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 443},
+	)
+	original.TLVs = []TLV{{Type: TLVTypeUniqueID, Value: []byte("conn-1")}}
+
+	// Act
+	data, err := original.Format(Version2)
+	require.NoError(t, err)
+	parsed, err := ReadHeader(bufio.NewReader(bytes.NewReader(data)))
+
+	// Assert
+	require.NoError(t, err)
+	require.NotNil(t, parsed)
+	assert.Equal(t, CommandProxy, parsed.Command)
+	assert.Equal(t, "[2001:db8::1]:51000", parsed.Source.String())
+	assert.Equal(t, "[2001:db8::2]:443", parsed.Destination.String())
+	assert.Equal(t, "conn-1", parsed.UniqueID())
+}
+
+func TestHeader_FormatV2_ForwardedCRC32C_Recomputed(t *testing.T) {
+	// Arrange: an inbound header with a valid checksum, forwarded with the
+	// addresses of the outbound connection.
+	inboundData := v2Header(t,
+		TLV{Type: TLVTypeCRC32C, Value: []byte{0, 0, 0, 0}},
+		TLV{Type: TLVTypeUniqueID, Value: []byte("conn-1")},
+	)
+	inbound, err := ReadHeader(bufio.NewReader(bytes.NewReader(inboundData)))
+	require.NoError(t, err)
+
+	outbound := NewProxyHeader(
+		&net.TCPAddr{IP: net.ParseIP("198.51.100.9"), Port: 40000},
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.9"), Port: 8443},
+	)
+	outbound.TLVs = inbound.TLVs
+
+	// Act
+	data, err := outbound.Format(Version2)
+	require.NoError(t, err)
+
+	// Assert
+	offset := bytes.Index(data, []byte{TLVTypeCRC32C, 0, 4}) + 3
+	require.Greater(t, offset, v2HeaderLength)
+	checksum := binary.BigEndian.Uint32(data[offset:])
+
+	zeroed := append([]byte(nil), data...)
+	copy(zeroed[offset:offset+4], []byte{0, 0, 0, 0})
+	assert.Equal(t, crc32.Checksum(zeroed, crc32.MakeTable(crc32.Castagnoli)), checksum)
+
+	inboundChecksum, _ := inbound.TLV(TLVTypeCRC32C)
+	assert.NotEqual(t, inboundChecksum, data[offset:offset+4])
+}
@@ -0,0 +1,240 @@
+package proxyproto
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/albedosehen/rwwwrse/internal/clientip"
+)
+
+// DefaultHeaderTimeout bounds how long a connection may take to send its header.
+const DefaultHeaderTimeout = 5 * time.Second
+
+// contextKey is the context key type for PROXY protocol values.
+type contextKey int
+
+const (
+	connKey contextKey = iota
+	outboundKey
+)
+
+// Listener accepts connections that may be prefixed by a PROXY protocol
+// header. Headers are only honoured from trusted source networks; other
+// peers are served as plain connections.
+type Listener struct {
+	net.Listener
+	trusted []*net.IPNet
+	timeout time.Duration
+}
+
+// NewListener wraps inner so that connections from trustedCIDRs may carry a
+// PROXY protocol header, which must arrive within timeout.
+func NewListener(inner net.Listener, trustedCIDRs []string, timeout time.Duration) (*Listener, error) {
+	if timeout <= 0 {
+		timeout = DefaultHeaderTimeout
+	}
+
+	l := &Listener{Listener: inner, timeout: timeout}
+	for _, cidr := range trustedCIDRs {
+		network, err := clientip.ParseNetwork(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PROXY protocol trusted CIDR %q: %w", cidr, err)
+		}
+		l.trusted = append(l.trusted, network)
+	}
+
+	return l, nil
+}
+
+// Accept waits for and returns the next connection. The header is read
+// lazily so that a slow peer cannot stall the accept loop.
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		Conn:    conn,
+		reader:  bufio.NewReader(conn),
+		trusted: l.isTrusted(conn.RemoteAddr()),
+		timeout: l.timeout,
+	}, nil
+}
+
+// isTrusted reports whether addr is inside a trusted network.
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, network := range l.trusted {
+		if network.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection whose addresses reflect its PROXY protocol header.
+type Conn struct {
+	net.Conn
+	reader  *bufio.Reader
+	trusted bool
+	timeout time.Duration
+
+	once   sync.Once
+	header *Header
+	err    error
+
+	deadlineMu   sync.Mutex
+	readDeadline time.Time
+}
+
+// Header returns the PROXY protocol header of the connection, or nil when
+// none was sent.
+func (c *Conn) Header() (*Header, error) {
+	c.once.Do(c.readHeader)
+	return c.header, c.err
+}
+
+// Read reads data following the header.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.once.Do(c.readHeader)
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	if c.reader.Buffered() > 0 {
+		return c.reader.Read(b)
+	}
+	return c.Conn.Read(b)
+}
+
+// RemoteAddr returns the original client address when a header was received.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.header != nil && c.header.Source != nil {
+		return c.header.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client originally connected to when a
+// header was received.
+func (c *Conn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.header != nil && c.header.Destination != nil {
+		return c.header.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// SetDeadline sets the read and write deadlines.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	c.readDeadline = t
+	c.deadlineMu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	c.readDeadline = t
+	c.deadlineMu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+// readHeader reads the header under the header timeout, then restores the
+// caller's read deadline.
+func (c *Conn) readHeader() {
+	if !c.trusted {
+		return
+	}
+
+	_ = c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	c.header, c.err = ReadHeader(c.reader)
+
+	c.deadlineMu.Lock()
+	_ = c.Conn.SetReadDeadline(c.readDeadline)
+	c.deadlineMu.Unlock()
+}
+
+// WithConn returns a context carrying the PROXY protocol connection behind c.
+// It matches the signature of http.Server.ConnContext.
+// Wrappers such as TLS connections are unwrapped through their NetConn method.
+func WithConn(ctx context.Context, c net.Conn) context.Context {
+	for {
+		if conn, ok := c.(*Conn); ok {
+			return context.WithValue(ctx, connKey, conn)
+		}
+		wrapper, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			return ctx
+		}
+		c = wrapper.NetConn()
+	}
+}
+
+// FromContext returns the PROXY protocol header of the request's connection,
+// or nil when the connection did not send one.
+func FromContext(ctx context.Context) *Header {
+	conn, ok := ctx.Value(connKey).(*Conn)
+	if !ok {
+		return nil
+	}
+	header, err := conn.Header()
+	if err != nil {
+		return nil
+	}
+	return header
+}
+
+// WithOutbound returns a context carrying the header to send to backends
+// dialed on behalf of the request.
+func WithOutbound(ctx context.Context, header *Header) context.Context {
+	return context.WithValue(ctx, outboundKey, header)
+}
+
+// OutboundFromContext returns the header to send to backends, or nil.
+func OutboundFromContext(ctx context.Context) *Header {
+	header, _ := ctx.Value(outboundKey).(*Header)
+	return header
+}
+
+// DialFunc dials a network connection.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// Dialer returns a DialFunc that writes the request's outbound header in the
+// given version on every new connection. Connections without an outbound
+// header announce themselves as LOCAL.
+func Dialer(dial DialFunc, version int) DialFunc {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		header := OutboundFromContext(ctx)
+		if header == nil {
+			header = &Header{Command: CommandLocal}
+		}
+
+		data, err := header.Format(version)
+		if err == nil {
+			_, err = conn.Write(data)
+		}
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to send PROXY protocol header: %w", err)
+		}
+
+		return conn, nil
+	}
+}
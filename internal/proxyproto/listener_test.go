@@ -0,0 +1,174 @@
+package proxyproto
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveProxyHTTP starts an HTTP server behind a PROXY protocol listener and
+// returns its address. The handler reports the remote address and header.
+func serveProxyHTTP(t *testing.T, trusted []string, timeout time.Duration) string {
+	t.Helper()
+
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	listener, err := NewListener(inner, trusted, timeout)
+	require.NoError(t, err)
+
+	server := &http.Server{
+		ConnContext: WithConn,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			vpce := ""
+			if header := FromContext(r.Context()); header != nil {
+				vpce = header.AWSVPCEndpointID()
+			}
+			_, _ = io.WriteString(w, r.RemoteAddr+"|"+vpce)
+		}),
+	}
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(func() { _ = server.Close() })
+
+	return inner.Addr().String()
+}
+
+// sendRaw writes prefix followed by a GET request and returns the response body.
+func sendRaw(t *testing.T, address string, prefix []byte) (string, error) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write(append(prefix, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n"...))
+	require.NoError(t, err)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestListener_Accept(t *testing.T) {
+	vpce := append([]byte{tlvSubtypeAWSVPCEndpointID}, "vpce-0abc"...)
+
+	tests := []struct {
+		name     string
+		trusted  []string
+		prefix   []byte
+		expected string
+	}{
+		{
+			name:     "Listener_TrustedV1Header_ExposesClientAddress",
+			trusted:  []string{"127.0.0.0/8"},
+			prefix:   []byte("PROXY TCP4 203.0.113.7 10.0.0.5 51000 80\r\n"),
+			expected: "203.0.113.7:51000|",
+		},
+		{
+			name:     "Listener_TrustedV2Header_ExposesTLVs",
+			trusted:  []string{"127.0.0.1"},
+			prefix:   v2Header(t, TLV{Type: TLVTypeAWS, Value: vpce}),
+			expected: "203.0.113.7:51000|vpce-0abc",
+		},
+		{
+			name:     "Listener_TrustedWithoutHeader_UsesPeer",
+			trusted:  []string{"127.0.0.0/8"},
+			expected: "127.0.0.1:",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			address := serveProxyHTTP(t, tt.trusted, time.Second)
+
+			// Act
+			body, err := sendRaw(t, address, tt.prefix)
+
+			// Assert
+			require.NoError(t, err)
+			assert.Contains(t, body, tt.expected)
+		})
+	}
+}
+
+func TestListener_UntrustedSource_HeaderNotHonoured(t *testing.T) {
+	// Arrange
+	address := serveProxyHTTP(t, []string{"192.0.2.0/24"}, time.Second)
+
+	// Act
+	body, err := sendRaw(t, address, []byte("PROXY TCP4 203.0.113.7 10.0.0.5 51000 80\r\n"))
+
+	// Assert
+	require.NoError(t, err)
+	assert.NotContains(t, body, "203.0.113.7")
+}
+
+func TestListener_SlowHeader_TimesOut(t *testing.T) {
+	// Arrange
+	address := serveProxyHTTP(t, []string{"127.0.0.0/8"}, 100*time.Millisecond)
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("PROXY TCP4 203.0.113.7"))
+	require.NoError(t, err)
+
+	// Act
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	data, err := io.ReadAll(conn)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), "HTTP/1.1 400"), "unexpected response %q", data)
+}
+
+func TestDialer_WritesOutboundHeader(t *testing.T) {
+	// Arrange
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		received <- line
+	}()
+
+	ctx := WithOutbound(context.Background(), NewProxyHeader(
+		&net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51000},
+		&net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 443},
+	))
+	dial := Dialer((&net.Dialer{}).DialContext, Version1)
+
+	// Act
+	conn, err := dial(ctx, "tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Assert
+	select {
+	case line := <-received:
+		assert.Equal(t, "PROXY TCP4 203.0.113.7 10.0.0.5 51000 443\r\n", line)
+	case <-time.After(2 * time.Second):
+		t.Fatal("backend did not receive a PROXY header")
+	}
+}
@@ -0,0 +1,232 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds connection settings for a Redis-protocol store.
+type Config struct {
+	// Address is the host:port of the store.
+	Address string
+
+	// Username and Password authenticate each new connection. An empty
+	// password skips AUTH; an empty username uses the legacy AUTH form.
+	Username string
+	Password string
+
+	// DB is selected on each new connection when non-zero.
+	DB int
+
+	// TLS connects with TLS 1.2 or later, verifying the address host.
+	TLS bool
+
+	// DialTimeout bounds connecting; Timeout bounds each command.
+	DialTimeout time.Duration
+	Timeout     time.Duration
+
+	// PoolSize caps the open connections, which are kept for reuse once
+	// idle. Commands wait for a free connection when all are in use.
+	PoolSize int
+}
+
+// conn is a single connection to the store.
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Client issues commands over a small pool of connections. It is safe for
+// concurrent use.
+type Client struct {
+	config Config
+	pool   chan *conn
+
+	// slots holds a token for every open connection.
+	slots chan struct{}
+}
+
+// Script is a Lua script invoked by its SHA1 digest.
+type Script struct {
+	source string
+	sha    string
+}
+
+// NewScript prepares a script for EVALSHA.
+func NewScript(source string) *Script {
+	sum := sha1.Sum([]byte(source))
+	return &Script{source: source, sha: hex.EncodeToString(sum[:])}
+}
+
+// SHA returns the hex SHA1 digest the store knows the script by.
+func (s *Script) SHA() string {
+	return s.sha
+}
+
+// NewClient creates a client; connections are opened on demand.
+func NewClient(config Config) *Client {
+	if config.PoolSize <= 0 {
+		config.PoolSize = 1
+	}
+
+	return &Client{
+		config: config,
+		pool:   make(chan *conn, config.PoolSize),
+		slots:  make(chan struct{}, config.PoolSize),
+	}
+}
+
+// Do sends a command and returns its reply. Error replies are returned as Error.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := cn.do(ctx, c.config.Timeout, args...)
+	if err != nil {
+		var replyErr Error
+		if errors.As(err, &replyErr) {
+			c.put(cn)
+		} else {
+			c.discard(cn)
+		}
+		return nil, err
+	}
+
+	c.put(cn)
+	return reply, nil
+}
+
+// Eval runs script, loading it into the store's script cache when needed.
+func (c *Client) Eval(ctx context.Context, script *Script, keys []string, args ...string) (any, error) {
+	command := append([]string{"EVALSHA", script.sha, strconv.Itoa(len(keys))}, keys...)
+	reply, err := c.Do(ctx, append(command, args...)...)
+
+	var replyErr Error
+	if errors.As(err, &replyErr) && strings.HasPrefix(string(replyErr), "NOSCRIPT") {
+		command = append([]string{"EVAL", script.source, strconv.Itoa(len(keys))}, keys...)
+		return c.Do(ctx, append(command, args...)...)
+	}
+
+	return reply, err
+}
+
+// Close closes all idle connections.
+func (c *Client) Close() error {
+	for {
+		select {
+		case cn := <-c.pool:
+			c.discard(cn)
+		default:
+			return nil
+		}
+	}
+}
+
+// get returns an idle connection, or dials a new one while fewer than
+// PoolSize are open. Otherwise it waits for a connection to be returned.
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+	}
+
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	cn, err := c.dial(ctx)
+	if err != nil {
+		<-c.slots
+		return nil, err
+	}
+	return cn, nil
+}
+
+// dial opens and prepares a new connection.
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	dialer := &net.Dialer{Timeout: c.config.DialTimeout}
+	var netConn net.Conn
+	var err error
+	if c.config.TLS {
+		host, _, _ := net.SplitHostPort(c.config.Address)
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}}
+		netConn, err = tlsDialer.DialContext(ctx, "tcp", c.config.Address)
+	} else {
+		netConn, err = dialer.DialContext(ctx, "tcp", c.config.Address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to store: %w", err)
+	}
+
+	cn := &conn{conn: netConn, reader: bufio.NewReader(netConn)}
+
+	if c.config.Password != "" {
+		auth := []string{"AUTH", c.config.Password}
+		if c.config.Username != "" {
+			auth = []string{"AUTH", c.config.Username, c.config.Password}
+		}
+		if _, err := cn.do(ctx, c.config.Timeout, auth...); err != nil {
+			_ = netConn.Close()
+			return nil, fmt.Errorf("store authentication failed: %w", err)
+		}
+	}
+
+	if c.config.DB != 0 {
+		if _, err := cn.do(ctx, c.config.Timeout, "SELECT", strconv.Itoa(c.config.DB)); err != nil {
+			_ = netConn.Close()
+			return nil, fmt.Errorf("failed to select store database: %w", err)
+		}
+	}
+
+	return cn, nil
+}
+
+// put returns a healthy connection to the pool, closing it when the pool is full.
+func (c *Client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		c.discard(cn)
+	}
+}
+
+// discard closes a connection and frees its slot.
+func (c *Client) discard(cn *conn) {
+	_ = cn.conn.Close()
+	<-c.slots
+}
+
+// do writes a command and reads one reply under the earlier of the command
+// timeout and the context deadline. Without either it does not time out.
+func (cn *conn) do(ctx context.Context, timeout time.Duration, args ...string) (any, error) {
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if ctxDeadline, ok := ctx.Deadline(); ok && (deadline.IsZero() || ctxDeadline.Before(deadline)) {
+		deadline = ctxDeadline
+	}
+	_ = cn.conn.SetDeadline(deadline)
+
+	if _, err := cn.conn.Write(EncodeCommand(args)); err != nil {
+		return nil, err
+	}
+
+	return ReadReply(cn.reader)
+}
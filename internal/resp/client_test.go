@@ -0,0 +1,195 @@
+package resp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T, config Config) *Client {
+	t.Helper()
+
+	client := NewClient(config)
+	t.Cleanup(func() { _ = client.Close() })
+	return client
+}
+
+func TestClient_Do(t *testing.T) {
+	// Arrange
+	server := miniredis.RunT(t)
+	client := newTestClient(t, Config{Address: server.Addr(), Timeout: time.Second})
+
+	// Act
+	setReply, setErr := client.Do(context.Background(), "SET", "key", "value")
+	getReply, getErr := client.Do(context.Background(), "GET", "key")
+	missingReply, missingErr := client.Do(context.Background(), "GET", "missing")
+
+	// Assert
+	require.NoError(t, setErr)
+	require.NoError(t, getErr)
+	require.NoError(t, missingErr)
+	assert.Equal(t, "OK", setReply)
+	assert.Equal(t, "value", getReply)
+	assert.Nil(t, missingReply)
+}
+
+func TestClient_Do_ErrorReply_KeepsConnection(t *testing.T) {
+	// Arrange
+	server := miniredis.RunT(t)
+	client := newTestClient(t, Config{Address: server.Addr(), Timeout: time.Second})
+
+	// Act
+	_, err := client.Do(context.Background(), "NOSUCHCOMMAND")
+	_, pingErr := client.Do(context.Background(), "PING")
+
+	// Assert
+	var replyErr Error
+	assert.ErrorAs(t, err, &replyErr)
+	assert.NoError(t, pingErr)
+	assert.Equal(t, 1, server.TotalConnectionCount())
+}
+
+func TestClient_Do_WithoutTimeout_DoesNotExpire(t *testing.T) {
+	// Arrange
+	server := miniredis.RunT(t)
+	client := newTestClient(t, Config{Address: server.Addr()})
+
+	// Act
+	reply, err := client.Do(context.Background(), "PING")
+
+	// Assert
+	require.NoError(t, err)
+	assert.Equal(t, "PONG", reply)
+}
+
+func TestClient_Connect(t *testing.T) {
+	tests := []struct {
+		name          string
+		configure     func(server *miniredis.Miniredis)
+		config        Config
+		expectedError string
+	}{
+		{
+			name:      "Connect_Password_Authenticates",
+			configure: func(server *miniredis.Miniredis) { server.RequireAuth("secret") },
+			config:    Config{Password: "secret"},
+		},
+		{
+			name:      "Connect_UsernameAndPassword_Authenticates",
+			configure: func(server *miniredis.Miniredis) { server.RequireUserAuth("proxy", "secret") },
+			config:    Config{Username: "proxy", Password: "secret"},
+		},
+		{
+			name:          "Connect_WrongPassword_ReturnsError",
+			configure:     func(server *miniredis.Miniredis) { server.RequireAuth("secret") },
+			config:        Config{Password: "wrong"},
+			expectedError: "store authentication failed",
+		},
+		{
+			name:      "Connect_DB_SelectsDatabase",
+			configure: func(*miniredis.Miniredis) {},
+			config:    Config{DB: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			server := miniredis.RunT(t)
+			tt.configure(server)
+			config := tt.config
+			config.Address = server.Addr()
+			config.Timeout = time.Second
+			client := newTestClient(t, config)
+
+			// Act
+			_, err := client.Do(context.Background(), "SET", "key", "value")
+
+			// Assert
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			value, err := server.DB(tt.config.DB).Get("key")
+			require.NoError(t, err)
+			assert.Equal(t, "value", value)
+		})
+	}
+}
+
+func TestClient_Do_Unreachable_ReturnsError(t *testing.T) {
+	// Arrange
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+	client := newTestClient(t, Config{Address: address, DialTimeout: 200 * time.Millisecond})
+
+	// Act
+	_, err = client.Do(context.Background(), "PING")
+
+	// Assert
+	assert.ErrorContains(t, err, "failed to connect to store")
+}
+
+func TestClient_Eval_UnknownScript_LoadsWithEval(t *testing.T) {
+	// Arrange
+	server := miniredis.RunT(t)
+	client := newTestClient(t, Config{Address: server.Addr(), Timeout: time.Second})
+	script := NewScript(`return redis.call("INCRBY", KEYS[1], ARGV[1])`)
+
+	// Act
+	first, firstErr := client.Eval(context.Background(), script, []string{"counter"}, "2")
+	second, secondErr := client.Eval(context.Background(), script, []string{"counter"}, "3")
+
+	// Assert
+	require.NoError(t, firstErr)
+	require.NoError(t, secondErr)
+	assert.Equal(t, int64(2), first)
+	assert.Equal(t, int64(5), second)
+}
+
+func TestClient_PoolSize_CapsOpenConnections(t *testing.T) {
+	// Arrange
+	server := miniredis.RunT(t)
+	client := newTestClient(t, Config{Address: server.Addr(), Timeout: time.Second, PoolSize: 1})
+	held, err := client.get(context.Background())
+	require.NoError(t, err)
+
+	// Act
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, waitErr := client.Do(ctx, "PING")
+	client.put(held)
+	reply, err := client.Do(context.Background(), "PING")
+
+	// Assert
+	assert.ErrorIs(t, waitErr, context.DeadlineExceeded)
+	require.NoError(t, err)
+	assert.Equal(t, "PONG", reply)
+	assert.Equal(t, 1, server.TotalConnectionCount())
+}
+
+func TestClient_Close_ClosesIdleConnections(t *testing.T) {
+	// Arrange
+	server := miniredis.RunT(t)
+	client := NewClient(Config{Address: server.Addr(), Timeout: time.Second, PoolSize: 2})
+	_, err := client.Do(context.Background(), "PING")
+	require.NoError(t, err)
+	require.Equal(t, 1, server.CurrentConnectionCount())
+
+	// Act
+	err = client.Close()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return server.CurrentConnectionCount() == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,140 @@
+package resp
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeCommand(t *testing.T) {
+	// Act
+	encoded := EncodeCommand([]string{"SET", "key", "two words"})
+
+	// Assert
+	assert.Equal(t, "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$9\r\ntwo words\r\n", string(encoded))
+}
+
+func TestReadReply(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expected      any
+		expectedError string
+	}{
+		{
+			name:     "ReadReply_SimpleString_ReturnsString",
+			input:    "+OK\r\n",
+			expected: "OK",
+		},
+		{
+			name:          "ReadReply_ErrorReply_ReturnsError",
+			input:         "-NOSCRIPT No matching script\r\n",
+			expectedError: "NOSCRIPT No matching script",
+		},
+		{
+			name:     "ReadReply_Integer_ReturnsInt64",
+			input:    ":-42\r\n",
+			expected: int64(-42),
+		},
+		{
+			name:     "ReadReply_BulkString_KeepsCRLF",
+			input:    "$8\r\na\r\nb c d\r\n",
+			expected: "a\r\nb c d",
+		},
+		{
+			name:     "ReadReply_NilBulkString_ReturnsNil",
+			input:    "$-1\r\n",
+			expected: nil,
+		},
+		{
+			name:     "ReadReply_NestedArray_DecodesElements",
+			input:    "*3\r\n:1\r\n*1\r\n$1\r\nx\r\n-ERR inner\r\n",
+			expected: []any{int64(1), []any{"x"}, Error("ERR inner")},
+		},
+		{
+			name:     "ReadReply_NilArray_ReturnsNil",
+			input:    "*-1\r\n",
+			expected: nil,
+		},
+		{
+			name:          "ReadReply_MissingCRLF_ReturnsError",
+			input:         "+OK\n",
+			expectedError: "malformed RESP reply",
+		},
+		{
+			name:          "ReadReply_OversizedBulkString_ReturnsError",
+			input:         "$536870913\r\n",
+			expectedError: "malformed RESP bulk length",
+		},
+		{
+			name:          "ReadReply_UnknownType_ReturnsError",
+			input:         "%1\r\n",
+			expectedError: "unsupported RESP reply type",
+		},
+		{
+			name:          "ReadReply_TruncatedBulkString_ReturnsError",
+			input:         "$5\r\nab",
+			expectedError: "unexpected EOF",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			reader := bufio.NewReader(strings.NewReader(tt.input))
+
+			// Act
+			reply, err := ReadReply(reader)
+
+			// Assert
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, reply)
+		})
+	}
+}
+
+func TestInt(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       any
+		expected    int64
+		expectError bool
+	}{
+		{
+			name:     "Int_Int64_ReturnsValue",
+			value:    int64(7),
+			expected: 7,
+		},
+		{
+			name:     "Int_NumericString_Parses",
+			value:    "12",
+			expected: 12,
+		},
+		{
+			name:        "Int_Array_ReturnsError",
+			value:       []any{int64(1)},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			value, err := Int(tt.value)
+
+			// Assert
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, value)
+		})
+	}
+}
@@ -9,7 +9,9 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/albedosehen/rwwwrse/internal/httpstrict"
 	"github.com/albedosehen/rwwwrse/internal/observability"
+	"github.com/albedosehen/rwwwrse/internal/proxyproto"
 )
 
 type contextKey string
@@ -47,6 +49,13 @@ func (s *httpServer) setupServer() {
 		readTimeout = 30 * time.Second
 	}
 
+	// Bounds how long a client may take to send the request headers,
+	// which protects against slowloris style connections.
+	readHeaderTimeout, _ := time.ParseDuration(s.config.ReadHeaderTimeout)
+	if readHeaderTimeout == 0 {
+		readHeaderTimeout = 10 * time.Second
+	}
+
 	writeTimeout, _ := time.ParseDuration(s.config.WriteTimeout)
 	if writeTimeout == 0 {
 		writeTimeout = 30 * time.Second
@@ -65,13 +74,15 @@ func (s *httpServer) setupServer() {
 	wrappedHandler := s.wrapHandler(s.handler)
 
 	s.server = &http.Server{
-		Addr:           s.getAddress(),
-		Handler:        wrappedHandler,
-		ReadTimeout:    readTimeout,
-		WriteTimeout:   writeTimeout,
-		IdleTimeout:    idleTimeout,
-		MaxHeaderBytes: maxHeaderBytes,
-		ConnState:      s.onConnStateChange,
+		Addr:              s.getAddress(),
+		Handler:           wrappedHandler,
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    maxHeaderBytes,
+		ConnState:         s.onConnStateChange,
+		ConnContext:       withConnContext,
 	}
 
 	if !s.config.KeepAlivesEnabled {
@@ -79,6 +90,12 @@ func (s *httpServer) setupServer() {
 	}
 }
 
+// withConnContext attaches the PROXY protocol and strict parsing state of
+// the connection to the request context.
+func withConnContext(ctx context.Context, c net.Conn) context.Context {
+	return httpstrict.WithConn(proxyproto.WithConn(ctx, c), c)
+}
+
 func (s *httpServer) wrapHandler(handler http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
@@ -96,6 +113,11 @@ func (s *httpServer) wrapHandler(handler http.Handler) http.Handler {
 		ctx = context.WithValue(ctx, serverNameKey, s.getServerName())
 		r = r.WithContext(ctx)
 
+		// Strictly parsed TLS connections are served as plain connections.
+		if r.TLS == nil {
+			r.TLS = httpstrict.TLSState(ctx)
+		}
+
 		handler.ServeHTTP(rw, r)
 
 		// Record metrics
@@ -118,6 +140,8 @@ func (s *httpServer) wrapHandler(handler http.Handler) http.Handler {
 }
 
 func (s *httpServer) onConnStateChange(conn net.Conn, state http.ConnState) {
+	httpstrict.TrackState(conn, state)
+
 	switch state {
 	case http.StateNew:
 		atomic.AddInt64(&s.activeConnections, 1)
@@ -133,6 +157,22 @@ func (s *httpServer) onConnStateChange(conn net.Conn, state http.ConnState) {
 	}
 }
 
+// wrapListener accepts PROXY protocol headers on listener when enabled.
+func (s *httpServer) wrapListener(listener net.Listener, enabled bool) (net.Listener, error) {
+	if !enabled {
+		return listener, nil
+	}
+
+	timeout, _ := time.ParseDuration(s.config.ProxyProtocolTimeout)
+	proxyListener, err := proxyproto.NewListener(listener, s.config.ProxyProtocolTrusted, timeout)
+	if err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to enable PROXY protocol: %w", err)
+	}
+
+	return proxyListener, nil
+}
+
 func (s *httpServer) getAddress() string {
 	host := s.config.Host
 	if host == "" {
@@ -158,6 +198,16 @@ func (s *httpServer) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to create listener: %w", err)
 	}
 
+	listener, err = s.wrapListener(listener, s.config.ProxyProtocolHTTP)
+	if err != nil {
+		atomic.StoreInt32(&s.running, 0)
+		return err
+	}
+
+	if s.config.StrictHTTP {
+		listener = httpstrict.NewListener(listener)
+	}
+
 	s.listener = listener
 
 	if s.logger != nil {
@@ -308,7 +358,20 @@ func (s *httpsServer) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to create listener: %w", err)
 	}
 
-	tlsListener := tls.NewListener(listener, s.server.TLSConfig)
+	listener, err = s.wrapListener(listener, s.config.ProxyProtocolHTTPS)
+	if err != nil {
+		atomic.StoreInt32(&s.running, 0)
+		return err
+	}
+
+	// Strict parsing needs the decrypted stream, so the listener completes
+	// the handshakes itself; HTTP/2 connections are not inspected.
+	var tlsListener net.Listener
+	if s.config.StrictHTTP {
+		tlsListener = httpstrict.NewTLSListener(listener, s.server.TLSConfig, s.server.ReadHeaderTimeout)
+	} else {
+		tlsListener = tls.NewListener(listener, s.server.TLSConfig)
+	}
 	s.listener = tlsListener
 
 	if s.logger != nil {
@@ -352,3 +415,7 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -71,10 +71,11 @@ type ServerConfig struct {
 	Port int
 
 	// Timeout settings
-	ReadTimeout    string
-	WriteTimeout   string
-	IdleTimeout    string
-	RequestTimeout string
+	ReadTimeout       string
+	ReadHeaderTimeout string
+	WriteTimeout      string
+	IdleTimeout       string
+	RequestTimeout    string
 
 	// TLS settings
 	TLSEnabled  bool
@@ -91,6 +92,16 @@ type ServerConfig struct {
 	// Additional settings
 	MaxHeaderBytes    int
 	KeepAlivesEnabled bool
+
+	// PROXY protocol settings
+	ProxyProtocolHTTP    bool
+	ProxyProtocolHTTPS   bool
+	ProxyProtocolTrusted []string
+	ProxyProtocolTimeout string
+
+	// StrictHTTP inspects the raw request stream of HTTP/1.x connections,
+	// after the TLS handshake on the HTTPS listener.
+	StrictHTTP bool
 }
 
 // ServerStats represents server runtime statistics.
@@ -29,12 +29,19 @@ func ProvideServerConfig(cfg config.Config) ServerConfig {
 		TLSEnabled:        cfg.TLS.Enabled,
 		TLSPort:           cfg.Server.HTTPSPort,
 		ReadTimeout:       cfg.Server.ReadTimeout.String(),
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout.String(),
 		WriteTimeout:      cfg.Server.WriteTimeout.String(),
 		IdleTimeout:       cfg.Server.IdleTimeout.String(),
 		ShutdownTimeout:   cfg.Server.GracefulTimeout.String(),
 		HTTP2Enabled:      true,    // Enable HTTP/2 by default
 		MaxHeaderBytes:    1 << 20, // 1MB default
 		KeepAlivesEnabled: true,
+
+		ProxyProtocolHTTP:    cfg.Server.ProxyProtocol.HTTP,
+		ProxyProtocolHTTPS:   cfg.Server.ProxyProtocol.HTTPS,
+		ProxyProtocolTrusted: cfg.Server.ProxyProtocol.TrustedCIDRs,
+		ProxyProtocolTimeout: cfg.Server.ProxyProtocol.HeaderTimeout.String(),
+		StrictHTTP:           cfg.Server.StrictHTTP.Enabled,
 	}
 }
 
@@ -210,11 +217,18 @@ func ConfigFromMain(mainConfig config.Config) ServerConfig {
 		TLSEnabled:        mainConfig.TLS.Enabled,
 		TLSPort:           mainConfig.Server.HTTPSPort,
 		ReadTimeout:       mainConfig.Server.ReadTimeout.String(),
+		ReadHeaderTimeout: mainConfig.Server.ReadHeaderTimeout.String(),
 		WriteTimeout:      mainConfig.Server.WriteTimeout.String(),
 		IdleTimeout:       mainConfig.Server.IdleTimeout.String(),
 		ShutdownTimeout:   mainConfig.Server.GracefulTimeout.String(),
 		HTTP2Enabled:      true,
 		MaxHeaderBytes:    1 << 20, // 1MB
 		KeepAlivesEnabled: true,
+
+		ProxyProtocolHTTP:    mainConfig.Server.ProxyProtocol.HTTP,
+		ProxyProtocolHTTPS:   mainConfig.Server.ProxyProtocol.HTTPS,
+		ProxyProtocolTrusted: mainConfig.Server.ProxyProtocol.TrustedCIDRs,
+		ProxyProtocolTimeout: mainConfig.Server.ProxyProtocol.HeaderTimeout.String(),
+		StrictHTTP:           mainConfig.Server.StrictHTTP.Enabled,
 	}
 }
@@ -177,14 +177,74 @@ func (m *MockMetricsCollector) RecordCertificateRenewal(domain string, success b
 	m.Called(domain, success)
 }
 
-func (m *MockMetricsCollector) RecordRateLimitHit(key string) {
-	m.Called(key)
+func (m *MockMetricsCollector) RecordRateLimitHit(policy string) {
+	m.Called(policy)
 }
 
 func (m *MockMetricsCollector) RecordHealthCheck(target string, success bool, duration time.Duration) {
 	m.Called(target, success, duration)
 }
 
+func (m *MockMetricsCollector) RecordAccessDenied(route, rule string) {
+	m.Called(route, rule)
+}
+
+func (m *MockMetricsCollector) SetConcurrencyLimit(backend string, limit int) {
+	m.Called(backend, limit)
+}
+
+func (m *MockMetricsCollector) SetConcurrencyQueueDepth(backend string, depth int) {
+	m.Called(backend, depth)
+}
+
+func (m *MockMetricsCollector) RecordLoadShed(backend, reason string) {
+	m.Called(backend, reason)
+}
+
+func (m *MockMetricsCollector) RecordWAFRuleMatch(route, ruleID string) {
+	m.Called(route, ruleID)
+}
+
+func (m *MockMetricsCollector) RecordWAFDecision(route, outcome string) {
+	m.Called(route, outcome)
+}
+
+func (m *MockMetricsCollector) RecordBan(event string) {
+	m.Called(event)
+}
+
+func (m *MockMetricsCollector) SetActiveBans(count int) {
+	m.Called(count)
+}
+
+func (m *MockMetricsCollector) RecordCSPViolation(route, directive string) {
+	m.Called(route, directive)
+}
+
+func (m *MockMetricsCollector) RecordWebhookVerificationFailure(scheme, reason string) {
+	m.Called(scheme, reason)
+}
+
+func (m *MockMetricsCollector) RecordOpenAPIViolation(route, direction string) {
+	m.Called(route, direction)
+}
+
+func (m *MockMetricsCollector) RecordRequestLimitExceeded(route, limit string) {
+	m.Called(route, limit)
+}
+
+func (m *MockMetricsCollector) RecordStrictHTTPRejection(reason string) {
+	m.Called(reason)
+}
+
+func (m *MockMetricsCollector) RecordCompression(route, encoding string, originalBytes, compressedBytes int64) {
+	m.Called(route, encoding, originalBytes, compressedBytes)
+}
+
+func (m *MockMetricsCollector) RecordCacheLookup(route, result string) {
+	m.Called(route, result)
+}
+
 func (m *MockMetricsCollector) Reset() {
 	m.mu.Lock()
 	defer m.mu.Unlock()